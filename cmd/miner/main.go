@@ -1,11 +1,14 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
@@ -13,41 +16,58 @@ import (
 	"time"
 
 	"github.com/aliexe/blockChain/internal/blockchain"
+	"github.com/aliexe/blockChain/internal/consensus"
+	"github.com/aliexe/blockChain/internal/network"
+	"github.com/aliexe/blockChain/internal/transactions"
 )
 
 type MinerCLI struct {
-	bc         *blockchain.Blockchain
-	isMining   bool
-	minerID    string
-	difficulty int
-	stats      *MiningStats
-	statsMu    sync.RWMutex
+	bc           *blockchain.Blockchain
+	mempool      *transactions.Mempool
+	assembler    *blockchain.BlockAssembler
+	feeEstimator *transactions.FeeEstimator
+	nodeKey      *network.NodeKey
+	dataDir      string
+	isMining     bool
+	minerID      string
+	minerAddress string
+	difficulty   int    // Deprecated: blocks are mined at the consensus target
+	bits         uint32 // Target of the block being mined
+	stats        *MiningStats
+	statsMu      sync.RWMutex
 }
 
 type MiningStats struct {
 	BlocksMined   int
-	TotalRewards  float64
+	TotalRewards  transactions.Amount
 	StartTime     time.Time
 	LastBlockTime time.Time
 	AverageTime   time.Duration
+	Hashrate      float64 // Hashes per second of the last mined block
 }
 
 const (
-	DefaultMinerID      = "default-miner"
-	DefaultDifficulty   = 2
-	StatsUpdateInterval = 5 * time.Second
+	DefaultMinerID       = "default-miner"
+	DefaultDifficulty    = 2
+	StatsUpdateInterval  = 5 * time.Second
+	FeeEstimatesFileName = "fee-estimates.json"
+	MempoolFileName      = "mempool.dat"
+	DefaultFeeTarget     = 6
 )
 
 func main() {
 	cli := &MinerCLI{
 		difficulty: DefaultDifficulty,
 		minerID:    DefaultMinerID,
+		dataDir:    DefaultDataDir,
 		stats:      &MiningStats{},
 	}
 
 	// Parse command line flags
 	flag.StringVar(&cli.minerID, "miner", DefaultMinerID, "Miner identifier")
-	flag.IntVar(&cli.difficulty, "difficulty", DefaultDifficulty, "Mining difficulty (1-8)")
+	flag.StringVar(&cli.minerAddress, "address", "", "Wallet address that receives block rewards")
+	flag.IntVar(&cli.difficulty, "difficulty", DefaultDifficulty, "Deprecated and ignored: blocks are mined at the consensus target")
+	flag.StringVar(&cli.dataDir, "datadir", DefaultDataDir, "Directory for node data such as the node key, mempool and fee estimates")
 
 	flag.Parse()
 
@@ -69,6 +89,8 @@ func main() {
 		cli.showDetailedStats()
 	case "set-difficulty":
 		cli.setDifficulty()
+	case "estimate-fee":
+		cli.estimateFee()
 	case "help", "--help", "-h":
 		cli.showHelp()
 	default:
@@ -89,17 +111,20 @@ func (cli *MinerCLI) showHelp() {
 	fmt.Println("  stop            Stop mining process")
 	fmt.Println("  status          Show current mining status")
 	fmt.Println("  stats           Show detailed mining statistics")
-	fmt.Println("  set-difficulty  Set mining difficulty")
+	fmt.Println("  set-difficulty  Deprecated: blocks are mined at the consensus target")
+	fmt.Println("  estimate-fee    Estimate the fee rate to confirm within N blocks")
 	fmt.Println("  help            Show this help message")
 	fmt.Println()
 	fmt.Println("OPTIONS:")
 	fmt.Println("  -miner string        Miner identifier (default \"default-miner\")")
-	fmt.Println("  -difficulty int      Mining difficulty 1-8 (default 2)")
+	fmt.Println("  -address string      Wallet address that receives block rewards (required for start)")
+	fmt.Println("  -difficulty int      Deprecated and ignored: blocks are mined at the consensus target")
+	fmt.Println("  -datadir string      Directory for the node key, mempool and fee estimates (default \"miner-data\")")
 	fmt.Println()
 	fmt.Println("EXAMPLES:")
-	fmt.Println("  miner start -miner alice -difficulty 3")
+	fmt.Println("  miner start -miner alice -address mxm1...")
 	fmt.Println("  miner status")
-	fmt.Println("  miner set-difficulty 4")
+	fmt.Println("  miner estimate-fee 3")
 	fmt.Println("  miner stop")
 }
 
@@ -109,16 +134,54 @@ func (cli *MinerCLI) startMining() {
 		return
 	}
 
+	if cli.minerAddress == "" {
+		fmt.Println("❌ Please provide a reward address with -address")
+		return
+	}
+
+	rules := consensus.DefaultConsensusRules()
 	cli.bc = blockchain.NewBlockchain()
+	if err := cli.bc.AttachChainState(rules.NewChainState(nil)); err != nil {
+		fmt.Printf("❌ Failed to initialize chain state: %v\n", err)
+		return
+	}
+	nodeKey, err := network.LoadOrCreateNodeKey(filepath.Join(cli.dataDir, network.NodeKeyFileName))
+	if err != nil {
+		fmt.Printf("❌ Failed to load node key: %v\n", err)
+		return
+	}
+	cli.nodeKey = nodeKey
+	fmt.Printf("🔑 Node ID: %s\n", cli.nodeKey.ID())
+	mempoolConfig := transactions.DefaultMempoolConfig()
+	mempoolConfig.PersistPath = filepath.Join(cli.dataDir, MempoolFileName)
+	cli.mempool = transactions.NewMempoolWithConfig(mempoolConfig)
+	cli.feeEstimator = cli.loadFeeEstimator()
+	cli.mempool.SetFeeEstimator(cli.feeEstimator)
+	cli.loadMempool()
+	cli.mempool.Start()
+	cli.assembler = rules.NewBlockAssembler(cli.bc, cli.mempool)
 	cli.isMining = true
 	cli.stats.StartTime = time.Now()
 
-	fmt.Printf("🚀 Starting mining with difficulty %d for miner %s\n", cli.difficulty, cli.minerID)
+	if cli.difficulty != DefaultDifficulty {
+		fmt.Println("⚠️  -difficulty is deprecated and ignored: blocks are mined at the consensus target")
+	}
+	fmt.Printf("🚀 Starting mining for miner %s\n", cli.minerID)
 	fmt.Println("Press Ctrl+C to stop mining...")
 
-	// Setup signal handling for graceful shutdown
+	// Setup signal handling for graceful shutdown, cancelling the block
+	// being mined
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-sigChan:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
 
 	// Start stats display goroutine
 	go cli.displayStatsPeriodically()
@@ -127,28 +190,48 @@ func (cli *MinerCLI) startMining() {
 	blockCount := 0
 	for cli.isMining {
 		select {
-		case <-sigChan:
+		case <-ctx.Done():
 			cli.stopMining()
 			return
 		default:
-			// Mine a new block
-			blockData := fmt.Sprintf("Block #%d mined by %s", blockCount+1, cli.minerID)
-
-			duration, err := cli.bc.AddBlockWithMining(blockData, cli.minerID, cli.difficulty)
-
+			// Build a block from the mempool and mine it at the target the
+			// consensus rules expect for the next block
+			template, err := cli.assembler.CreateTemplate(cli.minerAddress, nil)
 			if err != nil {
-				log.Printf("❌ Error mining block: %v", err)
+				log.Printf("❌ Error creating block template: %v", err)
+				continue
+			}
+			bits, err := rules.CalculateNextBits(cli.bc)
+			if err != nil {
+				log.Printf("❌ Error calculating the next target: %v", err)
 				continue
 			}
+			cli.statsMu.Lock()
+			cli.bits = bits
+			cli.statsMu.Unlock()
 
-			if duration > 0 {
-				blockCount++
-				cli.updateStats(duration)
-				cli.showMiningSuccess(blockCount, duration)
-			} else {
+			result, err := template.Block.MineBlockWithBits(ctx, bits)
+			if ctx.Err() != nil {
+				continue // Stopped while mining
+			}
+			if err != nil || !template.Block.IsValidProof() {
 				fmt.Printf("⏳ Mining attempt failed, retrying...\n")
+				continue
+			}
+			duration := result.Duration
+
+			if _, err := cli.assembler.SubmitBlock(template.Block); err != nil {
+				log.Printf("❌ Error mining block: %v", err)
+				continue
 			}
 
+			blockCount++
+			cli.updateStats(duration)
+			cli.statsMu.Lock()
+			cli.stats.Hashrate = result.Hashrate()
+			cli.statsMu.Unlock()
+			cli.showMiningSuccess(blockCount, duration)
+
 			// Small delay to prevent excessive CPU usage
 			time.Sleep(100 * time.Millisecond)
 		}
@@ -164,6 +247,18 @@ func (cli *MinerCLI) stopMining() {
 	cli.isMining = false
 	fmt.Println("\n🛑 Mining stopped")
 
+	if cli.mempool != nil {
+		cli.mempool.Stop()
+		if err, failed := cli.mempool.GetStats()["persist_error"]; failed {
+			fmt.Printf("⚠️  Failed to save mempool: %v\n", err)
+		}
+	}
+	if cli.feeEstimator != nil {
+		if err := cli.feeEstimator.SaveToFile(cli.feeEstimatesPath()); err != nil {
+			fmt.Printf("⚠️  Failed to save fee estimates: %v\n", err)
+		}
+	}
+
 	if cli.stats.BlocksMined > 0 {
 		cli.showMiningSummary()
 	}
@@ -176,17 +271,23 @@ func (cli *MinerCLI) showStatus() {
 		blocksMined := cli.stats.BlocksMined
 		totalRewards := cli.stats.TotalRewards
 		averageTime := cli.stats.AverageTime
+		hashrate := cli.stats.Hashrate
+		bits := cli.bits
 		cli.statsMu.RUnlock()
 
 		fmt.Printf("🔥 Mining Status: ACTIVE\n")
 		fmt.Printf("⛏️  Miner: %s\n", cli.minerID)
-		fmt.Printf("🎯 Difficulty: %d\n", cli.difficulty)
+		fmt.Printf("🏦 Reward Address: %s\n", cli.minerAddress)
+		fmt.Printf("🎯 Target: %08x (difficulty %d)\n", bits, blockchain.DifficultyForBits(bits))
 		fmt.Printf("⏱️  Uptime: %v\n", uptime.Round(time.Second))
 		fmt.Printf("📊 Blocks Mined: %d\n", blocksMined)
-		fmt.Printf("💰 Total Rewards: %.2f\n", totalRewards)
+		fmt.Printf("💰 Total Rewards: %s\n", totalRewards)
 		if averageTime > 0 {
 			fmt.Printf("⚡ Average Block Time: %v\n", averageTime.Round(time.Millisecond))
 		}
+		if hashrate > 0 {
+			fmt.Printf("🚀 Hashrate: %.0f H/s\n", hashrate)
+		}
 	} else {
 		fmt.Println("🔥 Mining Status: STOPPED")
 	}
@@ -205,14 +306,14 @@ func (cli *MinerCLI) showDetailedStats() {
 
 	// Blockchain stats
 	fmt.Printf("📦 Total Blocks: %v\n", stats["total_blocks"])
-	fmt.Printf("💰 Total Rewards: %.2f\n", stats["total_rewards"].(float64))
+	fmt.Printf("💰 Total Rewards: %s\n", stats["total_rewards"].(transactions.Amount))
 	fmt.Printf("🏆 Reward Count: %v\n", stats["reward_count"])
 
 	// Miner stats
-	if minerRewards, ok := stats["miner_rewards"].(map[string]float64); ok {
+	if minerRewards, ok := stats["miner_rewards"].(map[string]transactions.Amount); ok {
 		fmt.Println("\n👥 Miner Rewards:")
 		for miner, reward := range minerRewards {
-			fmt.Printf("  💎 %s: %.2f\n", miner, reward)
+			fmt.Printf("  💎 %s: %s\n", miner, reward)
 		}
 	}
 
@@ -224,7 +325,10 @@ func (cli *MinerCLI) showDetailedStats() {
 	}
 }
 
+// setDifficulty records a difficulty for compatibility. It is deprecated:
+// blocks are mined at the target the consensus rules expect.
 func (cli *MinerCLI) setDifficulty() {
+	fmt.Println("⚠️  set-difficulty is deprecated: blocks are mined at the consensus target")
 	if len(flag.Args()) < 2 {
 		fmt.Println("❌ Please provide a difficulty value (1-8)")
 		fmt.Println("Usage: miner set-difficulty <difficulty>")
@@ -243,11 +347,69 @@ func (cli *MinerCLI) setDifficulty() {
 	}
 
 	cli.difficulty = newDifficulty
-	fmt.Printf("✅ Mining difficulty set to %d\n", newDifficulty)
+	fmt.Printf("✅ Difficulty recorded as %d; it does not affect mining\n", newDifficulty)
+}
 
-	if cli.isMining {
-		fmt.Printf("⚠️  New difficulty will apply to the next block\n")
+func (cli *MinerCLI) estimateFee() {
+	target := DefaultFeeTarget
+	if len(flag.Args()) >= 2 {
+		var err error
+		target, err = strconv.Atoi(flag.Args()[1])
+		if err != nil {
+			fmt.Printf("❌ Invalid confirmation target: %v\n", err)
+			return
+		}
+	}
+	if target < 1 || target > transactions.MaxConfirmationTarget {
+		fmt.Printf("❌ Confirmation target must be between 1 and %d blocks\n", transactions.MaxConfirmationTarget)
+		return
+	}
+
+	estimator := cli.feeEstimator
+	if estimator == nil {
+		estimator = cli.loadFeeEstimator()
+	}
+
+	feeRate, err := estimator.EstimateFeeRate(target)
+	if err != nil {
+		fmt.Printf("⚠️  %v\n", err)
+		fmt.Printf("💡 Default fee for a 1-input, 2-output transaction: %s\n", transactions.CalculateOptimalFee(1, 2, 1.0))
+		return
+	}
+
+	fee, _ := estimator.EstimateFee(1, 2, target)
+	fmt.Printf("🎯 Target: %d blocks\n", target)
+	fmt.Printf("📈 Fee Rate: %.0f base units/byte\n", feeRate)
+	fmt.Printf("💰 Fee for a 1-input, 2-output transaction: %s\n", fee)
+}
+
+// feeEstimatesPath returns the file fee estimates are saved to
+func (cli *MinerCLI) feeEstimatesPath() string {
+	return filepath.Join(cli.dataDir, FeeEstimatesFileName)
+}
+
+// loadFeeEstimator returns a fee estimator with the saved fee history, or an
+// empty one if there is none
+func (cli *MinerCLI) loadFeeEstimator() *transactions.FeeEstimator {
+	estimator := transactions.NewFeeEstimator()
+	if err := estimator.LoadFromFile(cli.feeEstimatesPath()); err != nil && !errors.Is(err, os.ErrNotExist) {
+		fmt.Printf("⚠️  Ignoring saved fee estimates: %v\n", err)
 	}
+	return estimator
+}
+
+// loadMempool adds the transactions saved by the last run that are still
+// valid against the current UTXO set
+func (cli *MinerCLI) loadMempool() {
+	utxos := cli.bc.ChainState().UTXOSet().ToMap()
+	count, err := cli.mempool.LoadFromFile(filepath.Join(cli.dataDir, MempoolFileName), utxos)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			fmt.Printf("⚠️  Ignoring saved mempool: %v\n", err)
+		}
+		return
+	}
+	fmt.Printf("📥 Loaded %d mempool transactions\n", count)
 }
 
 func (cli *MinerCLI) updateStats(duration time.Duration) {
@@ -259,7 +421,11 @@ func (cli *MinerCLI) updateStats(duration time.Duration) {
 
 	// Update total rewards from blockchain
 	if cli.bc != nil {
-		cli.stats.TotalRewards = cli.bc.GetMinerRewards(cli.minerID)
+		if rewards, err := cli.bc.GetMinerRewards(cli.minerAddress); err != nil {
+			fmt.Printf("⚠️  Failed to total mining rewards: %v\n", err)
+		} else {
+			cli.stats.TotalRewards = rewards
+		}
 	}
 
 	// Calculate average time
@@ -272,8 +438,8 @@ func (cli *MinerCLI) updateStats(duration time.Duration) {
 }
 
 func (cli *MinerCLI) showMiningSuccess(blockCount int, duration time.Duration) {
-	reward := cli.bc.CalculateReward(cli.difficulty)
-	fmt.Printf("✅ Block #%d mined in %v (Reward: %.2f)\n",
+	reward := blockchain.BlockSubsidy(cli.bc.GetChainLength() - 1)
+	fmt.Printf("✅ Block #%d mined in %v (Reward: %s)\n",
 		blockCount, duration.Round(time.Millisecond), reward)
 }
 
@@ -290,7 +456,7 @@ func (cli *MinerCLI) showMiningSummary() {
 	fmt.Println("=================")
 	fmt.Printf("⏱️  Total Uptime: %v\n", uptime.Round(time.Second))
 	fmt.Printf("📦 Blocks Mined: %d\n", blocksMined)
-	fmt.Printf("💰 Total Rewards: %.2f\n", totalRewards)
+	fmt.Printf("💰 Total Rewards: %s\n", totalRewards)
 	if averageTime > 0 {
 		fmt.Printf("⚡ Average Block Time: %v\n", averageTime.Round(time.Millisecond))
 		fmt.Printf("🚀 Mining Rate: %.2f blocks/hour\n",
@@ -311,6 +477,7 @@ func (cli *MinerCLI) displayStatsPeriodically() {
 		totalRewards := cli.stats.TotalRewards
 		startTime := cli.stats.StartTime
 		averageTime := cli.stats.AverageTime
+		hashrate := cli.stats.Hashrate
 		cli.statsMu.RUnlock()
 
 		if !isMining {
@@ -319,11 +486,12 @@ func (cli *MinerCLI) displayStatsPeriodically() {
 
 		if blocksMined > 0 {
 			uptime := time.Since(startTime)
-			fmt.Printf("\n📊 [Live] Blocks: %d | Rewards: %.2f | Uptime: %v | Avg Time: %v\n",
+			fmt.Printf("\n📊 [Live] Blocks: %d | Rewards: %s | Uptime: %v | Avg Time: %v | Hashrate: %.0f H/s\n",
 				blocksMined,
 				totalRewards,
 				uptime.Round(time.Second),
-				averageTime.Round(time.Millisecond))
+				averageTime.Round(time.Millisecond),
+				hashrate)
 		}
 	}
 }
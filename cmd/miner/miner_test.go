@@ -12,6 +12,7 @@ import (
 	"time"
 
 	"github.com/aliexe/blockChain/internal/blockchain"
+	"github.com/aliexe/blockChain/internal/transactions"
 )
 
 func TestCLICommands(t *testing.T) {
@@ -132,20 +133,20 @@ func TestMiningStats(t *testing.T) {
 	}
 
 	if stats.TotalRewards != 0 {
-		t.Errorf("Expected 0 total rewards, got %f", stats.TotalRewards)
+		t.Errorf("Expected 0 total rewards, got %v", stats.TotalRewards)
 	}
 
 	// Test updating stats
 	stats.BlocksMined++
-	stats.TotalRewards = 12.5
+	stats.TotalRewards = 12.5 * transactions.Coin
 	_ = time.Now() // Time is used for duration calculation
 
 	if stats.BlocksMined != 1 {
 		t.Errorf("Expected 1 block mined, got %d", stats.BlocksMined)
 	}
 
-	if stats.TotalRewards != 12.5 {
-		t.Errorf("Expected 12.5 total rewards, got %f", stats.TotalRewards)
+	if stats.TotalRewards != 12.5*transactions.Coin {
+		t.Errorf("Expected 12.5 total rewards, got %v", stats.TotalRewards)
 	}
 }
 
@@ -288,7 +289,7 @@ func TestMinerCLIShowStatusMining(t *testing.T) {
 		difficulty: 2,
 		stats: &MiningStats{
 			BlocksMined:  5,
-			TotalRewards: 75.0,
+			TotalRewards: 75.0 * transactions.Coin,
 			StartTime:    time.Now().Add(-10 * time.Second),
 			AverageTime:  50 * time.Millisecond,
 		},
@@ -579,7 +580,7 @@ func TestMinerCLIDisplayStatsPeriodically(t *testing.T) {
 		isMining: true,
 		stats: &MiningStats{
 			BlocksMined:  3,
-			TotalRewards: 45.0,
+			TotalRewards: 45.0 * transactions.Coin,
 			StartTime:    time.Now().Add(-5 * time.Second),
 			AverageTime:  50 * time.Millisecond,
 		},
@@ -637,7 +638,7 @@ func TestMinerCLIShowMiningSummary(t *testing.T) {
 	cli := &MinerCLI{
 		stats: &MiningStats{
 			BlocksMined:  10,
-			TotalRewards: 150.0,
+			TotalRewards: 150.0 * transactions.Coin,
 			StartTime:    time.Now().Add(-30 * time.Second),
 			AverageTime:  45 * time.Millisecond,
 		},
@@ -1156,9 +1157,11 @@ func TestActualSaveConfigFunction(t *testing.T) {
 
 func TestStartMiningFunctionFullCoverage(t *testing.T) {
 	cli := &MinerCLI{
-		minerID:    "test-miner",
-		difficulty: 1, // Low difficulty for fast testing
-		stats:      &MiningStats{},
+		minerID:      "test-miner",
+		minerAddress: "mxm1qzyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg344kydn",
+		difficulty:   1, // Low difficulty for fast testing
+		dataDir:      t.TempDir(),
+		stats:        &MiningStats{},
 	}
 
 	// Test starting mining when already mining
@@ -1317,7 +1320,7 @@ func TestDisplayStatsPeriodicallyFullCoverage(t *testing.T) {
 		isMining: true,
 		stats: &MiningStats{
 			BlocksMined:  10,
-			TotalRewards: 150.0,
+			TotalRewards: 150.0 * transactions.Coin,
 			StartTime:    time.Now().Add(-30 * time.Second),
 			AverageTime:  45 * time.Millisecond,
 		},
@@ -1406,7 +1409,7 @@ func TestDisplayStatsPeriodicallyCoverage(t *testing.T) {
 		isMining: true,
 		stats: &MiningStats{
 			BlocksMined:  5,
-			TotalRewards: 75.0,
+			TotalRewards: 75.0 * transactions.Coin,
 			StartTime:    time.Now().Add(-10 * time.Second),
 			AverageTime:  50 * time.Millisecond,
 		},
@@ -1587,3 +1590,57 @@ func TestEdgeCases(t *testing.T) {
 		}
 	})
 }
+
+func TestMinerCLIEstimateFee(t *testing.T) {
+	originalArgs := os.Args
+	defer func() { os.Args = originalArgs }()
+
+	run := func(cli *MinerCLI, args ...string) string {
+		os.Args = append([]string{"miner", "estimate-fee"}, args...)
+		flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+		flag.Parse()
+
+		oldStdout := os.Stdout
+		r, w, _ := os.Pipe()
+		os.Stdout = w
+
+		cli.estimateFee()
+
+		w.Close()
+		os.Stdout = oldStdout
+
+		var buf bytes.Buffer
+		buf.ReadFrom(r)
+		return buf.String()
+	}
+
+	cli := &MinerCLI{dataDir: t.TempDir()}
+
+	if output := run(cli, "abc"); !strings.Contains(output, "❌") {
+		t.Errorf("Expected error for invalid target, got %q", output)
+	}
+	if output := run(cli, "0"); !strings.Contains(output, "❌") {
+		t.Errorf("Expected error for out of range target, got %q", output)
+	}
+	if output := run(cli); !strings.Contains(output, "⚠️") {
+		t.Errorf("Expected warning without fee history, got %q", output)
+	}
+
+	// Fee history saved by a previous run is used
+	estimator := transactions.NewFeeEstimator()
+	var txIDs []string
+	for i := 0; i < 10; i++ {
+		txID := fmt.Sprintf("tx%d", i)
+		estimator.TrackTransaction(txID, 20000, 1)
+		txIDs = append(txIDs, txID)
+	}
+	estimator.ProcessBlock(1, txIDs)
+	if err := estimator.SaveToFile(cli.feeEstimatesPath()); err != nil {
+		t.Fatalf("Failed to save fee estimates: %v", err)
+	}
+
+	output := run(cli, "2")
+	if !strings.Contains(output, "🎯 Target: 2 blocks") || !strings.Contains(output, "Fee Rate") {
+		t.Errorf("Expected fee estimate, got %q", output)
+	}
+}
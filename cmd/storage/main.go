@@ -11,6 +11,7 @@ import (
 
 	"github.com/aliexe/blockChain/internal/blockchain"
 	"github.com/aliexe/blockChain/internal/storage"
+	"github.com/aliexe/blockChain/internal/transactions"
 )
 
 type StorageCLI struct {
@@ -653,15 +654,15 @@ func (cli *StorageCLI) showBlockchainInfo(bc *blockchain.Blockchain) {
 
 	// Show mining rewards
 	stats := bc.GetMiningStats()
-	totalRewards := stats["total_rewards"].(float64)
+	totalRewards := stats["total_rewards"].(transactions.Amount)
 	if totalRewards > 0 {
-		fmt.Printf("💰 Total Rewards: %.2f\n", totalRewards)
+		fmt.Printf("💰 Total Rewards: %s\n", totalRewards)
 		fmt.Printf("🏆 Miners: %d\n", stats["reward_count"])
 
-		if minerRewards, ok := stats["miner_rewards"].(map[string]float64); ok {
+		if minerRewards, ok := stats["miner_rewards"].(map[string]transactions.Amount); ok {
 			fmt.Println("\n👥 Miner Rewards:")
 			for miner, reward := range minerRewards {
-				fmt.Printf("   💎 %s: %.2f\n", miner, reward)
+				fmt.Printf("   💎 %s: %s\n", miner, reward)
 			}
 		}
 	}
@@ -1,31 +1,111 @@
 package blockchain
 
 import (
+	"bytes"
 	"context"
 	"crypto/sha256"
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
+	"math/big"
 	"time"
+
+	"github.com/aliexe/blockChain/internal/encoding"
+	"github.com/aliexe/blockChain/internal/transactions"
 )
 
-type Block struct {
-	Timestamp  int64  `json:"timestamp"`
-	Data       []byte `json:"data"`
+// BlockHeader holds the fields of a block that are hashed for proof of work.
+// The body (Data and Transactions) is committed through MerkleRoot.
+type BlockHeader struct {
 	PrevHash   []byte `json:"prev_hash"`
-	Hash       []byte `json:"hash"`
+	MerkleRoot []byte `json:"merkle_root"`
+	Timestamp  int64  `json:"timestamp"`
+	Bits       uint32 `json:"bits"` // Compact proof-of-work target
 	Nonce      uint32 `json:"nonce"`
-	Difficulty int    `json:"difficulty"`
 }
 
-func (b *Block) CalculateHash() []byte {
-	data := b.PrevHash
-	data = append(data, b.Data...)
-	data = append(data, []byte(fmt.Sprintf("%d", b.Timestamp))...)
-	data = append(data, []byte(fmt.Sprintf("%d", b.Difficulty))...)
-	data = append(data, []byte(fmt.Sprintf("%d", b.Nonce))...)
+// Hash calculates the hash of the header
+func (h *BlockHeader) Hash() []byte {
+	hash := sha256.Sum256(h.hashData(h.Bits, h.Nonce))
+	return hash[:]
+}
+
+// IsValidProof checks that the header hash meets the target of its bits
+func (h *BlockHeader) IsValidProof() bool {
+	target := CompactToBig(h.Bits)
+	return new(big.Int).SetBytes(h.Hash()).Cmp(target) < 0
+}
+
+// Work returns the expected number of hashes needed to mine the header at
+// its target. Headers without a target count as one unit of work.
+func (h *BlockHeader) Work() *big.Int {
+	work := WorkForBits(h.Bits)
+	if work.Sign() == 0 {
+		return big.NewInt(1)
+	}
+	return work
+}
+
+// hashData serializes the header for hashing with the given target bits and nonce
+func (h *BlockHeader) hashData(bits uint32, nonce uint32) []byte {
+	data, _ := h.hashTemplate(bits)
+	binary.BigEndian.PutUint32(data[len(data)-4:], nonce)
+	return data
+}
+
+// hashTemplate serializes the header with a zero nonce. It also returns the
+// offset of the timestamp so miners can patch the timestamp and nonce in place.
+func (h *BlockHeader) hashTemplate(bits uint32) ([]byte, int) {
+	w := encoding.NewWriter()
+	w.WriteUint8(BlockEncodingVersion)
+	w.WriteBytes(h.PrevHash)
+	w.WriteBytes(h.MerkleRoot)
+	timestampOffset := w.Len()
+	w.WriteInt64(h.Timestamp)
+	w.WriteUint32(bits)
+	w.WriteUint32(0)
+	return w.Bytes(), timestampOffset
+}
+
+type Block struct {
+	Timestamp    int64                       `json:"timestamp"`
+	Data         []byte                      `json:"data"`
+	Transactions []*transactions.Transaction `json:"transactions"`
+	MerkleRoot   []byte                      `json:"merkle_root"`
+	PrevHash     []byte                      `json:"prev_hash"`
+	Hash         []byte                      `json:"hash"`
+	Nonce        uint32                      `json:"nonce"`
+	Bits         uint32                      `json:"bits"`       // Compact proof-of-work target
+	Difficulty   int                         `json:"difficulty"` // Leading zero hex digits required by Bits, for display
+}
+
+// Header returns the block header as stored in the block
+func (b *Block) Header() *BlockHeader {
+	return &BlockHeader{
+		PrevHash:   b.PrevHash,
+		MerkleRoot: b.MerkleRoot,
+		Timestamp:  b.Timestamp,
+		Bits:       b.Bits,
+		Nonce:      b.Nonce,
+	}
+}
+
+// CalculateMerkleRoot computes the Merkle root of the block body
+func (b *Block) CalculateMerkleRoot() []byte {
+	return CalculateMerkleRoot(merkleLeaves(b.Data, b.Transactions))
+}
+
+// HasValidMerkleRoot checks that the stored Merkle root matches the block body
+func (b *Block) HasValidMerkleRoot() bool {
+	return bytes.Equal(b.MerkleRoot, b.CalculateMerkleRoot())
+}
 
-	h := sha256.Sum256(data)
-	return h[:]
+// CalculateHash hashes the block header, recomputing the Merkle root from the
+// body so that any change to Data or Transactions changes the hash
+func (b *Block) CalculateHash() []byte {
+	header := b.Header()
+	header.MerkleRoot = b.CalculateMerkleRoot()
+	return header.Hash()
 }
 
 func NewGenesisBlock() *Block {
@@ -34,8 +114,10 @@ func NewGenesisBlock() *Block {
 		Data:       []byte("Genesis Block"),
 		PrevHash:   []byte{},
 		Nonce:      0,
+		Bits:       DefaultBits,
 		Difficulty: DefaultDifficulty,
 	}
+	block.MerkleRoot = block.CalculateMerkleRoot()
 	block.Hash = block.CalculateHash()
 	return block
 
@@ -48,33 +130,89 @@ func NewBlock(data []byte, prevHash []byte) *Block {
 		PrevHash:   prevHash,
 		Hash:       []byte{},
 		Nonce:      0,
+		Bits:       DefaultBits,
 		Difficulty: DefaultDifficulty,
 	}
+	block.MerkleRoot = block.CalculateMerkleRoot()
+	block.Hash = block.CalculateHash()
+	return block
+}
+
+// NewBlockWithTransactions creates a block whose body is the given transactions
+func NewBlockWithTransactions(txs []*transactions.Transaction, prevHash []byte) *Block {
+	block := &Block{
+		Timestamp:    time.Now().Unix(),
+		Transactions: txs,
+		PrevHash:     prevHash,
+		Hash:         []byte{},
+		Nonce:        0,
+		Bits:         DefaultBits,
+		Difficulty:   DefaultDifficulty,
+	}
+	block.MerkleRoot = block.CalculateMerkleRoot()
 	block.Hash = block.CalculateHash()
 	return block
 }
 
+// GetTransaction returns the transaction with the given ID from the block body
+func (b *Block) GetTransaction(txID string) (*transactions.Transaction, bool) {
+	for _, tx := range b.Transactions {
+		if tx.ID == txID {
+			return tx, true
+		}
+	}
+	return nil, false
+}
+
+// Size returns the approximate serialized size of the block body in bytes
+func (b *Block) Size() int {
+	size := len(b.Data)
+	for _, tx := range b.Transactions {
+		size += transactions.EstimateTransactionSize(len(tx.Inputs), len(tx.Outputs))
+	}
+	return size
+}
+
 func (b *Block) MineBlock(difficulty int) time.Duration {
-	pow := NewProofOfWork(b, difficulty)
-	nonce, hash, duration := pow.Run(context.Background())
-	// Always set the difficulty, even if mining fails
-	b.Difficulty = difficulty
-	if hash != nil {
-		b.Nonce = nonce
-		b.Hash = hash
+	result, _ := b.MineBlockWithContext(context.Background(), difficulty)
+	return result.Duration
+}
+
+// MineBlockWithContext mines the block with the default worker pool until a
+// solution is found or ctx is cancelled. The result reports the hashrate.
+func (b *Block) MineBlockWithContext(ctx context.Context, difficulty int) (*MiningResult, error) {
+	return b.MineBlockWithBits(ctx, BitsForDifficulty(difficulty))
+}
+
+// MineBlockWithBits mines the block against an exact compact target, e.g. one
+// produced by retargeting
+func (b *Block) MineBlockWithBits(ctx context.Context, bits uint32) (*MiningResult, error) {
+	b.MerkleRoot = b.CalculateMerkleRoot()
+	// Always set the target, even if mining fails
+	b.Bits = bits
+	b.Difficulty = DifficultyForBits(bits)
+	pow := NewProofOfWorkWithBits(b, bits)
+	result, err := pow.Mine(ctx)
+	if err != nil {
+		return result, err
 	}
-	return duration
+	b.Timestamp = result.Timestamp
+	b.Nonce = result.Nonce
+	b.Hash = result.Hash
+	return result, nil
 }
 
 // MineBlockCancellable returns a ProofOfWork instance that can be cancelled
 func (b *Block) MineBlockCancellable(difficulty int) (*ProofOfWork, func() time.Duration) {
+	b.MerkleRoot = b.CalculateMerkleRoot()
 	pow := NewProofOfWork(b, difficulty)
 
 	// Return the mining function that can be called to start mining
 	miningFunc := func() time.Duration {
-		nonce, hash, duration := pow.Run(context.Background())
-		// Always set the difficulty, even if mining fails
+		// Always set the target, even if mining fails
+		b.Bits = pow.Bits
 		b.Difficulty = difficulty
+		nonce, hash, duration := pow.Run(context.Background())
 		if hash != nil {
 			b.Nonce = nonce
 			b.Hash = hash
@@ -88,26 +226,42 @@ func (b *Block) MineBlockCancellable(difficulty int) (*ProofOfWork, func() time.
 }
 
 func (b *Block) IsValidProof() bool {
-	pow := NewProofOfWork(b, b.Difficulty)
+	pow := NewProofOfWorkWithBits(b, b.Bits)
 	return pow.Validate()
 }
 
+// Work returns the expected number of hashes needed to mine the block at its
+// target. Blocks without a target count as one unit of work.
+func (b *Block) Work() *big.Int {
+	work := WorkForBits(b.Bits)
+	if work.Sign() == 0 {
+		return big.NewInt(1)
+	}
+	return work
+}
+
 func (b *Block) MarshalJSON() ([]byte, error) {
 	type Alias Block
 	return json.Marshal(&struct {
-		Timestamp  int64  `json:"timestamp"`
-		Data       []byte `json:"data"`
-		PrevHash   []byte `json:"prev_hash"`
-		Hash       []byte `json:"hash"`
-		Nonce      uint32 `json:"nonce"`
-		Difficulty int    `json:"difficulty"`
+		Timestamp    int64                       `json:"timestamp"`
+		Data         []byte                      `json:"data"`
+		Transactions []*transactions.Transaction `json:"transactions,omitempty"`
+		MerkleRoot   []byte                      `json:"merkle_root"`
+		PrevHash     []byte                      `json:"prev_hash"`
+		Hash         []byte                      `json:"hash"`
+		Nonce        uint32                      `json:"nonce"`
+		Bits         uint32                      `json:"bits"`
+		Difficulty   int                         `json:"difficulty"`
 	}{
-		Timestamp:  b.Timestamp,
-		Data:       []byte(b.Data),
-		PrevHash:   []byte(b.PrevHash),
-		Hash:       []byte(b.Hash),
-		Nonce:      b.Nonce,
-		Difficulty: b.Difficulty,
+		Timestamp:    b.Timestamp,
+		Data:         []byte(b.Data),
+		Transactions: b.Transactions,
+		MerkleRoot:   []byte(b.MerkleRoot),
+		PrevHash:     []byte(b.PrevHash),
+		Hash:         []byte(b.Hash),
+		Nonce:        b.Nonce,
+		Bits:         b.Bits,
+		Difficulty:   b.Difficulty,
 	})
 }
 
@@ -115,21 +269,31 @@ func (b *Block) UnmarshalJSON(data []byte) error {
 	type Alias Block
 
 	aux := struct {
-		Timestamp  int64  `json:"timestamp"`
-		Data       []byte `json:"data"`
-		PrevHash   []byte `json:"prev_hash"`
-		Hash       []byte `json:"hash"`
-		Nonce      uint32 `json:"nonce"`
-		Difficulty int    `json:"difficulty"`
+		Timestamp    int64                       `json:"timestamp"`
+		Data         []byte                      `json:"data"`
+		Transactions []*transactions.Transaction `json:"transactions"`
+		MerkleRoot   []byte                      `json:"merkle_root"`
+		PrevHash     []byte                      `json:"prev_hash"`
+		Hash         []byte                      `json:"hash"`
+		Nonce        uint32                      `json:"nonce"`
+		Bits         uint32                      `json:"bits"`
+		Difficulty   int                         `json:"difficulty"`
 	}{}
 	if err := json.Unmarshal(data, &aux); err != nil {
 		return fmt.Errorf("Failed to unmarshal block json:%w", err)
 	}
 	b.Timestamp = aux.Timestamp
 	b.Data = []byte(aux.Data)
+	b.Transactions = aux.Transactions
+	b.MerkleRoot = []byte(aux.MerkleRoot)
 	b.PrevHash = []byte(aux.PrevHash)
 	b.Hash = []byte(aux.Hash)
 	b.Nonce = aux.Nonce
+	b.Bits = aux.Bits
 	b.Difficulty = aux.Difficulty
+	// Blocks saved before targets were stored only carry a difficulty
+	if b.Bits == 0 && b.Difficulty > 0 {
+		b.Bits = BitsForDifficulty(b.Difficulty)
+	}
 	return nil
 }
@@ -3,6 +3,8 @@ package blockchain
 import (
 	"bytes"
 	"testing"
+
+	"github.com/aliexe/blockChain/internal/transactions"
 )
 
 func TestBlockHashCalculation(t *testing.T) {
@@ -69,3 +71,115 @@ func TestNewBlock(t *testing.T) {
 	}
 
 }
+
+func TestCalculateMerkleRoot(t *testing.T) {
+	empty := CalculateMerkleRoot(nil)
+	if len(empty) != MerkleRootSize || !bytes.Equal(empty, make([]byte, MerkleRootSize)) {
+		t.Errorf("Expected all-zero root for empty leaves, got %x", empty)
+	}
+
+	a := bytes.Repeat([]byte{1}, 32)
+	b := bytes.Repeat([]byte{2}, 32)
+	c := bytes.Repeat([]byte{3}, 32)
+
+	single := CalculateMerkleRoot([][]byte{a})
+	if !bytes.Equal(single, a) {
+		t.Errorf("Expected single leaf to be its own root")
+	}
+
+	// An odd leaf is paired with itself
+	odd := CalculateMerkleRoot([][]byte{a, b, c})
+	even := CalculateMerkleRoot([][]byte{a, b, c, c})
+	if !bytes.Equal(odd, even) {
+		t.Errorf("Expected odd leaf to be duplicated, got %x and %x", odd, even)
+	}
+
+	swapped := CalculateMerkleRoot([][]byte{b, a, c})
+	if bytes.Equal(odd, swapped) {
+		t.Error("Expected Merkle root to depend on leaf order")
+	}
+}
+
+func TestBlockWithTransactions(t *testing.T) {
+	tx1 := transactions.NewCoinbaseTransaction("mxm1qzyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg344kydn", 50)
+	tx2 := transactions.NewCoinbaseTransaction("mxm1qyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg3z6gnz9y", 25)
+
+	block := NewBlockWithTransactions([]*transactions.Transaction{tx1, tx2}, []byte("prev"))
+
+	if !block.HasValidMerkleRoot() {
+		t.Fatal("Expected new block to have a valid merkle root")
+	}
+	if !bytes.Equal(block.Hash, block.CalculateHash()) {
+		t.Error("Expected block hash to match calculated hash")
+	}
+	if found, ok := block.GetTransaction(tx2.ID); !ok || found != tx2 {
+		t.Error("Expected to find transaction in block body")
+	}
+
+	// Changing the body invalidates the stored root and the hash
+	block.Transactions[1].Outputs[0].Amount = 1000
+	if block.HasValidMerkleRoot() {
+		t.Error("Expected merkle root to be invalid after tampering with a transaction")
+	}
+	if bytes.Equal(block.Hash, block.CalculateHash()) {
+		t.Error("Expected block hash to change after tampering with a transaction")
+	}
+}
+
+func TestBlockBinaryRoundTrip(t *testing.T) {
+	coinbase := transactions.NewCoinbaseTransaction("mxm1qzyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg344kydn", 50*transactions.Coin)
+	block := NewBlockWithTransactions([]*transactions.Transaction{coinbase}, []byte("prev"))
+
+	data, err := block.MarshalBinary()
+	if err != nil {
+		t.Fatalf("Failed to marshal block: %v", err)
+	}
+	again, _ := block.MarshalBinary()
+	if !bytes.Equal(data, again) {
+		t.Error("Expected block encoding to be deterministic")
+	}
+
+	var decoded Block
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatalf("Failed to unmarshal block: %v", err)
+	}
+	if !bytes.Equal(decoded.Hash, block.Hash) || !bytes.Equal(decoded.CalculateHash(), block.Hash) {
+		t.Error("Expected decoded block to keep its hash")
+	}
+	if !decoded.HasValidMerkleRoot() || len(decoded.Transactions) != 1 {
+		t.Error("Expected decoded block to keep its transactions")
+	}
+	if decoded.Transactions[0].ID != coinbase.ID || decoded.Transactions[0].Outputs[0].Amount != 50*transactions.Coin {
+		t.Error("Expected decoded coinbase to match original")
+	}
+
+	if err := decoded.UnmarshalBinary(data[:len(data)-1]); err == nil {
+		t.Error("Expected truncated block to be rejected")
+	}
+
+	blocks, err := DecodeBlocks(EncodeBlocks([]*Block{block, &decoded}))
+	if err != nil || len(blocks) != 2 {
+		t.Fatalf("Failed to round-trip block list: %v", err)
+	}
+}
+
+func TestHeaderProof(t *testing.T) {
+	block := NewBlock([]byte("header proof"), []byte("prev"))
+	block.MineBlock(1)
+
+	header := block.Header()
+	if !bytes.Equal(header.Hash(), block.Hash) {
+		t.Fatal("Expected header to hash to the block hash")
+	}
+	if !header.IsValidProof() {
+		t.Error("Expected mined header to meet its target")
+	}
+	if header.Work().Cmp(block.Work()) != 0 {
+		t.Error("Expected header work to match block work")
+	}
+
+	header.Bits = BitsForDifficulty(MaxDifficulty)
+	if header.IsValidProof() {
+		t.Error("Expected header to miss a harder target")
+	}
+}
@@ -5,43 +5,72 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"math/big"
 	"os"
+	"sort"
 	"sync"
 	"time"
 	"unicode"
+
+	"github.com/aliexe/blockChain/internal/transactions"
 )
 
-// MiningReward represents a reward for mining a block
+// MiningReward describes the coinbase reward paid by a block.
+// It is derived from the coinbase transactions on chain.
 type MiningReward struct {
-	MinerID    string    `json:"miner_id"`
-	BlockIndex int       `json:"block_index"`
-	Reward     float64   `json:"reward"`
-	Timestamp  time.Time `json:"timestamp"`
-	Difficulty int       `json:"difficulty"`
+	MinerID    string              `json:"miner_id"`
+	BlockIndex int                 `json:"block_index"`
+	Reward     transactions.Amount `json:"reward"`
+	Timestamp  time.Time           `json:"timestamp"`
+	Difficulty int                 `json:"difficulty"`
 }
 
-// validateMinerID validates miner ID for security
-func validateMinerID(minerID string) error {
-	if len(minerID) == 0 {
-		return fmt.Errorf("miner ID cannot be empty")
+const (
+	// InitialBlockSubsidy is the coinbase subsidy of the first blocks
+	InitialBlockSubsidy transactions.Amount = 50 * transactions.Coin
+	// SubsidyHalvingInterval is the number of blocks between subsidy halvings
+	SubsidyHalvingInterval = 210000
+	// DefaultCoinbaseMaturity is the number of blocks before a coinbase output can be spent
+	DefaultCoinbaseMaturity = 100
+	// MedianTimeSpan is the number of blocks whose median timestamp forms the median time past
+	MedianTimeSpan = 11
+)
+
+// BlockSubsidy returns the newly created coins a block at the given height may claim
+func BlockSubsidy(height int) transactions.Amount {
+	if height <= 0 {
+		return 0 // The genesis block has no spendable reward
 	}
-	if len(minerID) > 256 {
-		return fmt.Errorf("miner ID too long (max 256 characters)")
+	halvings := height / SubsidyHalvingInterval
+	if halvings >= 64 {
+		return 0
 	}
-	for _, r := range minerID {
+	return InitialBlockSubsidy >> uint(halvings)
+}
+
+// validateMinerAddress validates the address a coinbase pays to
+func validateMinerAddress(address string) error {
+	if len(address) == 0 {
+		return fmt.Errorf("miner address cannot be empty")
+	}
+	if len(address) > 256 {
+		return fmt.Errorf("miner address too long (max 256 characters)")
+	}
+	for _, r := range address {
 		if !unicode.IsPrint(r) || unicode.IsControl(r) {
-			return fmt.Errorf("invalid character in miner ID")
+			return fmt.Errorf("invalid character in miner address")
 		}
 	}
+	if err := transactions.ValidateAddressFormat(address); err != nil {
+		return fmt.Errorf("invalid miner address: %w", err)
+	}
 	return nil
 }
 
 type Blockchain struct {
-	Blocks        []*Block        `json:"blocks"`
-	MiningRewards []*MiningReward `json:"mining_rewards"`
-	TotalRewards  float64         `json:"total_rewards"`
-	rewardMutex   sync.RWMutex
-	mu            sync.RWMutex
+	Blocks     []*Block `json:"blocks"`
+	chainState *ChainState
+	mu         sync.RWMutex
 }
 
 func NewBlockchain() *Blockchain {
@@ -50,12 +79,54 @@ func NewBlockchain() *Blockchain {
 	genesis.Hash = genesis.CalculateHash()
 
 	return &Blockchain{
-		Blocks:        []*Block{genesis},
-		MiningRewards: []*MiningReward{},
-		TotalRewards:  0.0,
+		Blocks: []*Block{genesis},
 	}
 }
 
+// AttachChainState connects every block of the chain to cs and keeps it in
+// sync from then on: new blocks are only appended if their transactions
+// connect to the UTXO set, and fork resolution reorganizes it.
+func (bc *Blockchain) AttachChainState(cs *ChainState) error {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	if cs.Tip() != nil {
+		return fmt.Errorf("chain state already has connected blocks")
+	}
+
+	for i, block := range bc.Blocks {
+		if _, err := cs.ConnectBlock(block); err != nil {
+			for j := i - 1; j >= 0; j-- {
+				cs.DisconnectBlock(bc.Blocks[j])
+			}
+			return fmt.Errorf("failed to connect block %d: %w", i, err)
+		}
+	}
+
+	bc.chainState = cs
+	return nil
+}
+
+// ChainState returns the attached chain state, or nil if none is attached
+func (bc *Blockchain) ChainState() *ChainState {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.chainState
+}
+
+// appendBlockLocked connects the block to the chain state, if any, and
+// appends it to the chain (assumes lock is held)
+func (bc *Blockchain) appendBlockLocked(block *Block) error {
+	if bc.chainState != nil {
+		if _, err := bc.chainState.ConnectBlock(block); err != nil {
+			return fmt.Errorf("failed to connect block: %w", err)
+		}
+	}
+	bc.Blocks = append(bc.Blocks, block)
+	return nil
+}
+
+// AddBlock mines a block carrying data at the easiest target and appends it
 func (bc *Blockchain) AddBlock(data string) error {
 	bc.mu.Lock()
 	defer bc.mu.Unlock()
@@ -66,32 +137,81 @@ func (bc *Blockchain) AddBlock(data string) error {
 
 	latestBlock := bc.Blocks[len(bc.Blocks)-1]
 	newBlock := NewBlock([]byte(data), latestBlock.Hash)
-	bc.Blocks = append(bc.Blocks, newBlock)
-	return nil
+	newBlock.MineBlock(MinDifficulty)
+	return bc.appendBlockLocked(newBlock)
 }
 
-// AddBlockWithMining adds a block with mining and rewards
-func (bc *Blockchain) AddBlockWithMining(data string, minerID string, difficulty int) (time.Duration, error) {
+// AddBlockWithTransactions mines a block whose body is the given transactions
+// at the easiest target and appends it
+func (bc *Blockchain) AddBlockWithTransactions(txs []*transactions.Transaction) error {
 	bc.mu.Lock()
 	defer bc.mu.Unlock()
 
 	if len(bc.Blocks) == 0 {
-		return 0, fmt.Errorf("no blocks in blockchain")
+		return fmt.Errorf("no blocks in blockchain")
+	}
+
+	latestBlock := bc.Blocks[len(bc.Blocks)-1]
+	newBlock := NewBlockWithTransactions(txs, latestBlock.Hash)
+	newBlock.MineBlock(MinDifficulty)
+	return bc.appendBlockLocked(newBlock)
+}
+
+// AppendBlock appends an already built block (e.g. received from a peer) to the chain.
+// The block must link to the current tip, its hash must match its contents and
+// meet its target.
+func (bc *Blockchain) AppendBlock(block *Block) error {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	if len(bc.Blocks) == 0 {
+		return fmt.Errorf("no blocks in blockchain")
 	}
 
 	latestBlock := bc.Blocks[len(bc.Blocks)-1]
+	if !bytes.Equal(block.PrevHash, latestBlock.Hash) {
+		return fmt.Errorf("block does not extend the current tip")
+	}
+	if !block.HasValidMerkleRoot() {
+		return fmt.Errorf("block merkle root does not match its body")
+	}
+	if !bytes.Equal(block.Hash, block.CalculateHash()) {
+		return fmt.Errorf("block hash does not match its contents")
+	}
+	if !block.IsValidProof() {
+		return fmt.Errorf("block has invalid proof of work")
+	}
+
+	return bc.appendBlockLocked(block)
+}
+
+// AddBlockWithMining mines a block carrying data and a coinbase transaction
+// that pays the block subsidy to minerAddress
+func (bc *Blockchain) AddBlockWithMining(data string, minerAddress string, difficulty int) (time.Duration, error) {
+	if err := validateMinerAddress(minerAddress); err != nil {
+		return 0, fmt.Errorf("invalid miner address: %w", err)
+	}
+
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	if len(bc.Blocks) == 0 {
+		return 0, fmt.Errorf("no blocks in blockchain")
+	}
+
+	height := len(bc.Blocks)
+	latestBlock := bc.Blocks[height-1]
+	coinbase := transactions.NewBlockCoinbaseTransaction(minerAddress, BlockSubsidy(height), height)
+
 	newBlock := NewBlock([]byte(data), latestBlock.Hash)
+	newBlock.Transactions = []*transactions.Transaction{coinbase}
 
 	// Mine the block
 	duration := newBlock.MineBlock(difficulty)
 
 	// Add block to chain
-	bc.Blocks = append(bc.Blocks, newBlock)
-
-	// Calculate and add reward
-	reward := bc.CalculateReward(difficulty)
-	if err := bc.AddMiningReward(minerID, len(bc.Blocks)-1, reward, difficulty); err != nil {
-		return duration, fmt.Errorf("failed to add mining reward: %w", err)
+	if err := bc.appendBlockLocked(newBlock); err != nil {
+		return duration, err
 	}
 
 	return duration, nil
@@ -121,71 +241,95 @@ func (bc *Blockchain) SetDifficulty(difficulty int) {
 	bc.Blocks[len(bc.Blocks)-1].Difficulty = difficulty
 }
 
-// CalculateReward calculates mining reward based on difficulty
-func (bc *Blockchain) CalculateReward(difficulty int) float64 {
-	// Base reward + difficulty bonus
-	baseReward := 10.0
-	difficultyBonus := float64(difficulty) * 2.5
-	return baseReward + difficultyBonus
+// GetMiningRewards returns the coinbase reward of every block, in chain order
+func (bc *Blockchain) GetMiningRewards() []*MiningReward {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.miningRewardsLocked()
 }
 
-// AddMiningReward adds a mining reward to the tracking system
-func (bc *Blockchain) AddMiningReward(minerID string, blockIndex int, reward float64, difficulty int) error {
-	// Validate miner ID
-	if err := validateMinerID(minerID); err != nil {
-		return fmt.Errorf("invalid miner ID: %w", err)
+// miningRewardsLocked collects coinbase rewards (assumes lock is held)
+func (bc *Blockchain) miningRewardsLocked() []*MiningReward {
+	var rewards []*MiningReward
+	for i, block := range bc.Blocks {
+		if len(block.Transactions) == 0 || !block.Transactions[0].IsCoinbase() {
+			continue
+		}
+		coinbase := block.Transactions[0]
+		for _, output := range coinbase.Outputs {
+			rewards = append(rewards, &MiningReward{
+				MinerID:    output.Address,
+				BlockIndex: i,
+				Reward:     output.Amount,
+				Timestamp:  time.Unix(block.Timestamp, 0),
+				Difficulty: block.Difficulty,
+			})
+		}
 	}
+	return rewards
+}
 
-	bc.rewardMutex.Lock()
-	defer bc.rewardMutex.Unlock()
-
-	miningReward := &MiningReward{
-		MinerID:    minerID,
-		BlockIndex: blockIndex,
-		Reward:     reward,
-		Timestamp:  time.Now(),
-		Difficulty: difficulty,
+// GetTotalRewards returns the sum of all coinbase outputs on chain
+func (bc *Blockchain) GetTotalRewards() (transactions.Amount, error) {
+	var total transactions.Amount
+	var err error
+	for _, reward := range bc.GetMiningRewards() {
+		if total, err = total.Add(reward.Reward); err != nil {
+			return 0, fmt.Errorf("total rewards: %w", err)
+		}
 	}
-
-	bc.MiningRewards = append(bc.MiningRewards, miningReward)
-	bc.TotalRewards += reward
-	return nil
+	return total, nil
 }
 
-// GetMinerRewards returns total rewards for a specific miner
-func (bc *Blockchain) GetMinerRewards(minerID string) float64 {
-	bc.rewardMutex.RLock()
-	defer bc.rewardMutex.RUnlock()
-
-	var total float64
-	for _, reward := range bc.MiningRewards {
-		if reward.MinerID == minerID {
-			total += reward.Reward
+// GetMinerRewards returns total coinbase rewards paid to an address
+func (bc *Blockchain) GetMinerRewards(minerAddress string) (transactions.Amount, error) {
+	var total transactions.Amount
+	var err error
+	for _, reward := range bc.GetMiningRewards() {
+		if reward.MinerID != minerAddress {
+			continue
+		}
+		if total, err = total.Add(reward.Reward); err != nil {
+			return 0, fmt.Errorf("rewards of %s: %w", minerAddress, err)
 		}
 	}
-	return total
+	return total, nil
 }
 
 // GetMiningStats returns mining statistics
 func (bc *Blockchain) GetMiningStats() map[string]interface{} {
-	bc.rewardMutex.RLock()
-	defer bc.rewardMutex.RUnlock()
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
 
-	minerStats := make(map[string]float64)
+	rewards := bc.miningRewardsLocked()
+	minerStats := make(map[string]transactions.Amount)
 	blockCount := make(map[string]int)
+	var totalRewards transactions.Amount
+	var rewardsErr error
 
-	for _, reward := range bc.MiningRewards {
-		minerStats[reward.MinerID] += reward.Reward
+	for _, reward := range rewards {
 		blockCount[reward.MinerID]++
+		minerTotal, err := minerStats[reward.MinerID].Add(reward.Reward)
+		if err == nil {
+			minerStats[reward.MinerID] = minerTotal
+			totalRewards, err = totalRewards.Add(reward.Reward)
+		}
+		if err != nil {
+			rewardsErr = err
+		}
 	}
 
-	return map[string]interface{}{
+	stats := map[string]interface{}{
 		"total_blocks":  len(bc.Blocks),
-		"total_rewards": bc.TotalRewards,
+		"total_rewards": totalRewards,
 		"miner_rewards": minerStats,
 		"miner_blocks":  blockCount,
-		"reward_count":  len(bc.MiningRewards),
+		"reward_count":  len(rewards),
 	}
+	if rewardsErr != nil {
+		stats["rewards_error"] = rewardsErr.Error()
+	}
+	return stats
 }
 
 func (bc *Blockchain) GetLatestBlock() *Block {
@@ -198,16 +342,81 @@ func (bc *Blockchain) GetLatestBlock() *Block {
 	return bc.Blocks[len(bc.Blocks)-1]
 }
 
+// MedianTimePast returns the median timestamp of the last MedianTimeSpan
+// blocks. A new block must not be timestamped before it, so a single miner
+// cannot move time backwards.
+func MedianTimePast(blocks []*Block) int64 {
+	if len(blocks) > MedianTimeSpan {
+		blocks = blocks[len(blocks)-MedianTimeSpan:]
+	}
+	if len(blocks) == 0 {
+		return 0
+	}
+
+	timestamps := make([]int64, len(blocks))
+	for i, block := range blocks {
+		timestamps[i] = block.Timestamp
+	}
+	return medianTimestamp(timestamps)
+}
+
+// HeaderMedianTimePast returns the median timestamp of the last
+// MedianTimeSpan headers, like MedianTimePast does for blocks
+func HeaderMedianTimePast(headers []*BlockHeader) int64 {
+	if len(headers) > MedianTimeSpan {
+		headers = headers[len(headers)-MedianTimeSpan:]
+	}
+	if len(headers) == 0 {
+		return 0
+	}
+
+	timestamps := make([]int64, len(headers))
+	for i, header := range headers {
+		timestamps[i] = header.Timestamp
+	}
+	return medianTimestamp(timestamps)
+}
+
+// medianTimestamp sorts timestamps and returns the middle one
+func medianTimestamp(timestamps []int64) int64 {
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+	return timestamps[len(timestamps)/2]
+}
+
+// MedianTimePast returns the median time past of the chain tip
+func (bc *Blockchain) MedianTimePast() int64 {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return MedianTimePast(bc.Blocks)
+}
+
+// MedianTimePastAt returns the median time past of the block at index
+func (bc *Blockchain) MedianTimePastAt(index int) int64 {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	if index < 0 || index >= len(bc.Blocks) {
+		return 0
+	}
+	return MedianTimePast(bc.Blocks[:index+1])
+}
+
 func (bc *Blockchain) IsValid() bool {
 	bc.mu.RLock()
 	defer bc.mu.RUnlock()
 
+	return bc.isValidLocked()
+}
+
+// isValidLocked validates hashes, links, Merkle roots and proofs of work (assumes lock is held)
+func (bc *Blockchain) isValidLocked() bool {
 	if len(bc.Blocks) == 0 {
 		return false
 	}
 	if len(bc.Blocks) == 1 {
 		genesis := bc.Blocks[0]
 		return string(genesis.PrevHash) == "" &&
+			genesis.HasValidMerkleRoot() &&
 			bytes.Equal(genesis.Hash, genesis.CalculateHash()) &&
 			(genesis.Nonce == 0 || genesis.IsValidProof()) // Genesis may not be mined
 	}
@@ -215,57 +424,45 @@ func (bc *Blockchain) IsValid() bool {
 		currentBlock := bc.Blocks[i]
 		previousBlock := bc.Blocks[i-1]
 
+		if !currentBlock.HasValidMerkleRoot() {
+			return false
+		}
 		if !bytes.Equal(currentBlock.Hash, currentBlock.CalculateHash()) {
 			return false
 		}
 		if !bytes.Equal(currentBlock.PrevHash, previousBlock.Hash) {
 			return false
 		}
-		// Check proof-of-work for mined blocks
-		if currentBlock.Nonce > 0 && !currentBlock.IsValidProof() {
+		// Every block after genesis must meet its target, whatever its nonce
+		if !currentBlock.IsValidProof() {
 			return false
 		}
 	}
 	return true
 }
 
-// IsValidWithUTXO validates the blockchain with UTXO double-spend protection
-// This method ensures that no UTXOs are spent twice across the entire blockchain
-func (bc *Blockchain) IsValidWithUTXO(utxoSet interface{}) bool {
+// IsValidWithUTXO validates the blockchain and replays every block through a
+// fresh chain state built on a copy of utxoSet (the state before the first
+// block, nil for an empty set), so the spending, script, reward and coinbase
+// maturity rules hold across the entire blockchain. utxoSet is not modified.
+func (bc *Blockchain) IsValidWithUTXO(utxoSet *transactions.UTXOSet) bool {
 	bc.mu.RLock()
 	defer bc.mu.RUnlock()
 
 	// First check basic blockchain validity
-	if !bc.IsValid() {
+	if !bc.isValidLocked() {
 		return false
 	}
 
-	// Create a temporary UTXO set for validation
-	// This prevents double-spending by tracking spent UTXOs
-	type UTXOValidator interface {
-		ValidateTransaction(tx interface{}) error
-		ProcessTransaction(tx interface{}) error
+	// Replay blocks on a scratch copy of the UTXO set
+	var working *transactions.UTXOSet
+	if utxoSet != nil {
+		working = utxoSet.Clone()
 	}
-
-	// If a UTXO set is provided, use it for validation
-	if _, ok := utxoSet.(UTXOValidator); ok {
-		// Clone the UTXO set to avoid modifying the original
-		// and validate each transaction in order
-		// Note: Currently blocks store data as bytes, not structured transactions
-		// Full transaction validation will require Block struct refactoring
-		// For now, we validate that data is not corrupted and has proper structure
-
-		// Validate that all blocks have valid data
-		for i, block := range bc.Blocks {
-			if len(block.Data) == 0 && i > 0 {
-				// Only genesis block can have empty data
-				return false
-			}
-
-			// Validate data integrity (basic check)
-			if !bytes.Equal(block.Hash, block.CalculateHash()) {
-				return false
-			}
+	cs := NewChainState(working)
+	for _, block := range bc.Blocks {
+		if _, err := cs.ConnectBlock(block); err != nil {
+			return false
 		}
 	}
 
@@ -294,27 +491,18 @@ func (bc *Blockchain) FindCommonAncestor(other *Blockchain) int {
 	return -1 // No common ancestor found
 }
 
-// CalculateTotalWork calculates the total work (cumulative difficulty) of the blockchain
-// Work is calculated as 2^difficulty for each block
+// CalculateTotalWork calculates the total work of the blockchain from fromIndex.
+// Each block contributes the expected number of hashes needed to meet its target.
 func (bc *Blockchain) CalculateTotalWork(fromIndex int) float64 {
-	bc.mu.RLock()
-	defer bc.mu.RUnlock()
-
-	var totalWork float64
-	for i := fromIndex; i < len(bc.Blocks); i++ {
-		// Work = 2^difficulty
-		totalWork += calculateBlockWork(bc.Blocks[i].Difficulty)
-	}
-	return totalWork
+	work, _ := new(big.Float).SetInt(bc.TotalWork(fromIndex)).Float64()
+	return work
 }
 
-// calculateBlockWork calculates the work required to mine a block with given difficulty
-func calculateBlockWork(difficulty int) float64 {
-	if difficulty <= 0 {
-		return 1.0
-	}
-	// Work = 2^difficulty
-	return float64(uint64(1) << uint(difficulty))
+// TotalWork returns the exact total work of the blockchain from fromIndex
+func (bc *Blockchain) TotalWork(fromIndex int) *big.Int {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.calculateTotalWorkLocked(fromIndex)
 }
 
 // ResolveFork resolves a blockchain fork by comparing total work
@@ -333,10 +521,10 @@ func (bc *Blockchain) ResolveFork(other *Blockchain) error {
 
 	// Calculate total work for both chains from the common ancestor
 	myWork := bc.calculateTotalWorkLocked(commonIndex)
-	otherWork := other.CalculateTotalWork(commonIndex)
+	otherWork := other.TotalWork(commonIndex)
 
 	// Accept chain with more work (longest chain rule)
-	if otherWork > myWork {
+	if otherWork.Cmp(myWork) > 0 {
 		return bc.replaceChainLocked(other, commonIndex)
 	}
 
@@ -344,10 +532,10 @@ func (bc *Blockchain) ResolveFork(other *Blockchain) error {
 }
 
 // calculateTotalWorkLocked calculates total work (assumes lock is held)
-func (bc *Blockchain) calculateTotalWorkLocked(fromIndex int) float64 {
-	var totalWork float64
+func (bc *Blockchain) calculateTotalWorkLocked(fromIndex int) *big.Int {
+	totalWork := big.NewInt(0)
 	for i := fromIndex; i < len(bc.Blocks); i++ {
-		totalWork += calculateBlockWork(bc.Blocks[i].Difficulty)
+		totalWork.Add(totalWork, bc.Blocks[i].Work())
 	}
 	return totalWork
 }
@@ -359,30 +547,24 @@ func (bc *Blockchain) replaceChainLocked(other *Blockchain, commonIndex int) err
 		return fmt.Errorf("other blockchain is invalid")
 	}
 
-	// Replace blocks from common ancestor onwards
-	bc.Blocks = append(bc.Blocks[:commonIndex+1], other.Blocks[commonIndex+1:]...)
-
-	// Update mining rewards (remove rewards from replaced blocks)
-	var newRewards []*MiningReward
-	for _, reward := range bc.MiningRewards {
-		if reward.BlockIndex <= commonIndex {
-			newRewards = append(newRewards, reward)
+	other.mu.RLock()
+	newBranch := make([]*Block, len(other.Blocks)-commonIndex-1)
+	copy(newBranch, other.Blocks[commonIndex+1:])
+	other.mu.RUnlock()
+
+	// Roll the UTXO set back to the common ancestor and forward along the new branch
+	if bc.chainState != nil {
+		oldBranch := make([]*Block, 0, len(bc.Blocks)-commonIndex-1)
+		for i := len(bc.Blocks) - 1; i > commonIndex; i-- {
+			oldBranch = append(oldBranch, bc.Blocks[i])
 		}
-	}
-	bc.MiningRewards = newRewards
-
-	// Add rewards from the new chain
-	for _, reward := range other.MiningRewards {
-		if reward.BlockIndex > commonIndex {
-			bc.MiningRewards = append(bc.MiningRewards, reward)
+		if err := bc.chainState.Reorganize(oldBranch, newBranch); err != nil {
+			return fmt.Errorf("failed to reorganize chain state: %w", err)
 		}
 	}
 
-	// Recalculate total rewards
-	bc.TotalRewards = 0.0
-	for _, reward := range bc.MiningRewards {
-		bc.TotalRewards += reward.Reward
-	}
+	// Replace blocks from common ancestor onwards
+	bc.Blocks = append(bc.Blocks[:commonIndex+1], newBranch...)
 
 	return nil
 }
@@ -400,10 +582,10 @@ func (bc *Blockchain) ShouldReplaceChain(other *Blockchain) bool {
 
 	// Calculate total work
 	myWork := bc.calculateTotalWorkLocked(commonIndex)
-	otherWork := other.CalculateTotalWork(commonIndex)
+	otherWork := other.TotalWork(commonIndex)
 
 	// Replace if other chain has more work
-	return otherWork > myWork
+	return otherWork.Cmp(myWork) > 0
 }
 
 func (bc *Blockchain) GetBlockByIndex(index int) (*Block, error) {
@@ -443,6 +625,8 @@ func (bc *Blockchain) PrintBlockChain() {
 		fmt.Printf("Block:%d\n", i)
 		fmt.Printf("Timestamp:%d\n", block.Timestamp)
 		fmt.Printf("Data:%s\n", block.Data)
+		fmt.Printf("Transactions:%d\n", len(block.Transactions))
+		fmt.Printf("MerkleRoot:%s\n", hex.EncodeToString(block.MerkleRoot))
 		fmt.Printf("PrevHash:%s\n", hex.EncodeToString(block.PrevHash))
 		fmt.Printf("Hash:%s\n", hex.EncodeToString(block.Hash))
 		fmt.Println()
@@ -460,6 +644,8 @@ func (bc *Blockchain) ToJSON() ([]byte, error) {
 	return jsonData, nil
 }
 
+// FromJSON replaces the blocks of the chain with the valid chain encoded in
+// data, rebuilding the attached chain state, if any
 func (bc *Blockchain) FromJSON(data []byte) error {
 	var newBlockchain Blockchain
 
@@ -473,9 +659,30 @@ func (bc *Blockchain) FromJSON(data []byte) error {
 	bc.mu.Lock()
 	defer bc.mu.Unlock()
 
-	bc.Blocks = newBlockchain.Blocks
-	bc.MiningRewards = newBlockchain.MiningRewards
-	bc.TotalRewards = newBlockchain.TotalRewards
+	return bc.replaceBlocksLocked(newBlockchain.Blocks)
+}
+
+// replaceBlocksLocked replaces the blocks of the chain with blocks, first
+// reorganizing the attached chain state, if any, from the last block both
+// share onwards (assumes lock is held)
+func (bc *Blockchain) replaceBlocksLocked(blocks []*Block) error {
+	if bc.chainState != nil {
+		common := -1
+		for common+1 < len(bc.Blocks) && common+1 < len(blocks) &&
+			bytes.Equal(bc.Blocks[common+1].Hash, blocks[common+1].Hash) {
+			common++
+		}
+
+		oldBranch := make([]*Block, 0, len(bc.Blocks)-common-1)
+		for i := len(bc.Blocks) - 1; i > common; i-- {
+			oldBranch = append(oldBranch, bc.Blocks[i])
+		}
+		if err := bc.chainState.Reorganize(oldBranch, blocks[common+1:]); err != nil {
+			return fmt.Errorf("failed to rebuild chain state: %w", err)
+		}
+	}
+
+	bc.Blocks = blocks
 	return nil
 }
 
@@ -494,6 +701,8 @@ func (bc *Blockchain) SaveToFile(filename string) error {
 	return nil
 }
 
+// LoadFromFile replaces the blocks of the chain with the valid chain saved
+// in filename, rebuilding the attached chain state, if any
 func (bc *Blockchain) LoadFromFile(filename string) error {
 	if _, err := os.Stat(filename); os.IsNotExist(err) {
 		return fmt.Errorf("files %s does not exist", filename)
@@ -512,10 +721,7 @@ func (bc *Blockchain) LoadFromFile(filename string) error {
 	if !newBlockchain.IsValid() {
 		return fmt.Errorf("Loaded blockchain is invalid")
 	}
-	bc.Blocks = newBlockchain.Blocks
-	bc.MiningRewards = newBlockchain.MiningRewards
-	bc.TotalRewards = newBlockchain.TotalRewards
-	return nil
+	return bc.replaceBlocksLocked(newBlockchain.Blocks)
 }
 
 func (bc *Blockchain) ExportPrettyJSON() (string, error) {
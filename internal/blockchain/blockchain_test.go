@@ -2,7 +2,10 @@ package blockchain
 
 import (
 	"bytes"
+	"fmt"
 	"testing"
+
+	"github.com/aliexe/blockChain/internal/transactions"
 )
 
 func TestNewBlockchain(t *testing.T) {
@@ -265,87 +268,71 @@ func TestIsValidInvalidGenesis(t *testing.T) {
 	}
 }
 
-func TestCalculateReward(t *testing.T) {
-	bc := NewBlockchain()
+const (
+	testMiner1 = "mxm1qzyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg344kydn"
+	testMiner2 = "mxm1qyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg3z6gnz9y"
+)
 
-	// Test reward calculation for different difficulties
+func TestBlockSubsidy(t *testing.T) {
 	tests := []struct {
-		difficulty int
-		expected   float64
+		height   int
+		expected transactions.Amount
 	}{
-		{1, 12.5}, // 10 + 1*2.5
-		{2, 15.0}, // 10 + 2*2.5
-		{4, 20.0}, // 10 + 4*2.5
-		{8, 30.0}, // 10 + 8*2.5
+		{0, 0},
+		{1, InitialBlockSubsidy},
+		{SubsidyHalvingInterval - 1, InitialBlockSubsidy},
+		{SubsidyHalvingInterval, InitialBlockSubsidy / 2},
+		{2 * SubsidyHalvingInterval, InitialBlockSubsidy / 4},
+		{64 * SubsidyHalvingInterval, 0},
 	}
 
 	for _, test := range tests {
-		reward := bc.CalculateReward(test.difficulty)
-		if reward != test.expected {
-			t.Errorf("Expected reward %f for difficulty %d, got %f", test.expected, test.difficulty, reward)
+		if subsidy := BlockSubsidy(test.height); subsidy != test.expected {
+			t.Errorf("Expected subsidy %v at height %d, got %v", test.expected, test.height, subsidy)
 		}
 	}
 }
 
-func TestAddMiningReward(t *testing.T) {
+func TestGetMinerRewards(t *testing.T) {
 	bc := NewBlockchain()
 
-	// Add some rewards
-	bc.AddMiningReward("miner1", 1, 12.5, 1)
-	bc.AddMiningReward("miner1", 2, 15.0, 2)
-	bc.AddMiningReward("miner2", 3, 20.0, 4)
+	bc.AddBlockWithMining("Block 1", testMiner1, 1)
+	bc.AddBlockWithMining("Block 2", testMiner1, 1)
+	bc.AddBlockWithMining("Block 3", testMiner2, 1)
 
-	// Check total rewards
-	if bc.TotalRewards != 47.5 {
-		t.Errorf("Expected total rewards 47.5, got %f", bc.TotalRewards)
+	if rewards, err := bc.GetMinerRewards(testMiner1); err != nil || rewards != 2*InitialBlockSubsidy {
+		t.Errorf("Expected miner1 rewards %v, got %v (%v)", 2*InitialBlockSubsidy, rewards, err)
 	}
 
-	// Check reward count
-	if len(bc.MiningRewards) != 3 {
-		t.Errorf("Expected 3 rewards, got %d", len(bc.MiningRewards))
+	if rewards, err := bc.GetMinerRewards(testMiner2); err != nil || rewards != InitialBlockSubsidy {
+		t.Errorf("Expected miner2 rewards %v, got %v (%v)", InitialBlockSubsidy, rewards, err)
 	}
 
-	// Check individual rewards
-	reward1 := bc.MiningRewards[0]
-	if reward1.MinerID != "miner1" || reward1.BlockIndex != 1 || reward1.Reward != 12.5 {
-		t.Error("First reward details incorrect")
+	if rewards, err := bc.GetMinerRewards("mxm1qxvenxvenxvenxvenxvenxvenxvenxvengkylsk"); err != nil || rewards != 0 {
+		t.Errorf("Expected 0 for non-existent miner, got %v (%v)", rewards, err)
 	}
 
-	reward2 := bc.MiningRewards[1]
-	if reward2.MinerID != "miner1" || reward2.BlockIndex != 2 || reward2.Reward != 15.0 {
-		t.Error("Second reward details incorrect")
-	}
-
-	reward3 := bc.MiningRewards[2]
-	if reward3.MinerID != "miner2" || reward3.BlockIndex != 3 || reward3.Reward != 20.0 {
-		t.Error("Third reward details incorrect")
+	if total, err := bc.GetTotalRewards(); err != nil || total != 3*InitialBlockSubsidy {
+		t.Errorf("Expected total rewards %v, got %v (%v)", 3*InitialBlockSubsidy, total, err)
 	}
 }
 
-func TestGetMinerRewards(t *testing.T) {
+func TestAppendBlockRequiresProofOfWork(t *testing.T) {
 	bc := NewBlockchain()
+	coinbase := transactions.NewBlockCoinbaseTransaction(testMiner1, BlockSubsidy(1), 1)
+	block := NewBlockWithTransactions([]*transactions.Transaction{coinbase}, bc.GetLatestBlock().Hash)
 
-	// Add rewards for different miners
-	bc.AddMiningReward("miner1", 1, 12.5, 1)
-	bc.AddMiningReward("miner1", 2, 15.0, 2)
-	bc.AddMiningReward("miner2", 3, 20.0, 4)
-	bc.AddMiningReward("miner1", 4, 17.5, 3)
-
-	// Check individual miner rewards
-	miner1Rewards := bc.GetMinerRewards("miner1")
-	if miner1Rewards != 45.0 { // 12.5 + 15.0 + 17.5
-		t.Errorf("Expected miner1 rewards 45.0, got %f", miner1Rewards)
+	// An unmined block has a nonce of zero and no target
+	if err := bc.AppendBlock(block); err == nil {
+		t.Error("Expected block without proof of work to be rejected")
 	}
 
-	miner2Rewards := bc.GetMinerRewards("miner2")
-	if miner2Rewards != 20.0 {
-		t.Errorf("Expected miner2 rewards 20.0, got %f", miner2Rewards)
+	block.MineBlock(1)
+	if err := bc.AppendBlock(block); err != nil {
+		t.Fatalf("Expected mined block to be appended: %v", err)
 	}
-
-	// Check non-existent miner
-	nonExistentRewards := bc.GetMinerRewards("nonexistent")
-	if nonExistentRewards != 0.0 {
-		t.Errorf("Expected 0 for non-existent miner, got %f", nonExistentRewards)
+	if bc.GetChainLength() != 2 {
+		t.Errorf("Expected chain length 2, got %d", bc.GetChainLength())
 	}
 }
 
@@ -353,7 +340,7 @@ func TestAddBlockWithMining(t *testing.T) {
 	bc := NewBlockchain()
 
 	// Add block with mining
-	duration, err := bc.AddBlockWithMining("Test transaction", "miner1", 1)
+	duration, err := bc.AddBlockWithMining("Test transaction", testMiner1, 1)
 	if err != nil {
 		t.Errorf("Error adding block with mining: %v", err)
 	}
@@ -373,20 +360,26 @@ func TestAddBlockWithMining(t *testing.T) {
 		t.Error("Block should have valid proof")
 	}
 
-	// Check reward was added
-	if len(bc.MiningRewards) != 1 {
-		t.Errorf("Expected 1 mining reward, got %d", len(bc.MiningRewards))
+	// Check the reward is paid by a coinbase transaction
+	if len(newBlock.Transactions) != 1 || !newBlock.Transactions[0].IsCoinbase() {
+		t.Fatal("Mined block should carry a coinbase transaction")
 	}
 
-	if bc.TotalRewards != 12.5 { // Base 10 + difficulty 1 * 2.5
-		t.Errorf("Expected total rewards 12.5, got %f", bc.TotalRewards)
+	coinbase := newBlock.Transactions[0]
+	if coinbase.Height != 1 || coinbase.Outputs[0].Address != testMiner1 || coinbase.Outputs[0].Amount != BlockSubsidy(1) {
+		t.Error("Coinbase transaction details incorrect")
 	}
 
-	reward := bc.MiningRewards[0]
-	if reward.MinerID != "miner1" || reward.BlockIndex != 1 || reward.Reward != 12.5 {
+	rewards := bc.GetMiningRewards()
+	if len(rewards) != 1 || rewards[0].MinerID != testMiner1 || rewards[0].BlockIndex != 1 {
 		t.Error("Mining reward details incorrect")
 	}
 
+	// Rewards must be paid to an address
+	if _, err := bc.AddBlockWithMining("Bad miner", "miner1", 1); err == nil {
+		t.Error("Expected error when mining to an invalid address")
+	}
+
 	// Duration should be positive
 	if duration <= 0 {
 		t.Skip("Mining took too long, skipping duration check")
@@ -397,9 +390,9 @@ func TestGetMiningStats(t *testing.T) {
 	bc := NewBlockchain()
 
 	// Add some blocks with mining
-	bc.AddBlockWithMining("Block 1", "miner1", 1)
-	bc.AddBlockWithMining("Block 2", "miner2", 2)
-	bc.AddBlockWithMining("Block 3", "miner1", 3)
+	bc.AddBlockWithMining("Block 1", testMiner1, 1)
+	bc.AddBlockWithMining("Block 2", testMiner2, 2)
+	bc.AddBlockWithMining("Block 3", testMiner1, 3)
 
 	stats := bc.GetMiningStats()
 
@@ -408,8 +401,8 @@ func TestGetMiningStats(t *testing.T) {
 		t.Errorf("Expected total_blocks 4, got %v", stats["total_blocks"])
 	}
 
-	if stats["total_rewards"] != 45.0 { // 12.5 + 15.0 + 17.5
-		t.Errorf("Expected total_rewards 45.0, got %v", stats["total_rewards"])
+	if stats["total_rewards"] != 3*InitialBlockSubsidy {
+		t.Errorf("Expected total_rewards %v, got %v", 3*InitialBlockSubsidy, stats["total_rewards"])
 	}
 
 	if stats["reward_count"] != 3 {
@@ -417,23 +410,23 @@ func TestGetMiningStats(t *testing.T) {
 	}
 
 	// Check miner stats with correct type assertion
-	minerRewards := stats["miner_rewards"].(map[string]float64)
-	if minerRewards["miner1"] != 30.0 { // 12.5 + 17.5
-		t.Errorf("Expected miner1 rewards 30.0, got %v", minerRewards["miner1"])
+	minerRewards := stats["miner_rewards"].(map[string]transactions.Amount)
+	if minerRewards[testMiner1] != 2*InitialBlockSubsidy {
+		t.Errorf("Expected miner1 rewards %v, got %v", 2*InitialBlockSubsidy, minerRewards[testMiner1])
 	}
 
-	if minerRewards["miner2"] != 15.0 {
-		t.Errorf("Expected miner2 rewards 15.0, got %v", minerRewards["miner2"])
+	if minerRewards[testMiner2] != InitialBlockSubsidy {
+		t.Errorf("Expected miner2 rewards %v, got %v", InitialBlockSubsidy, minerRewards[testMiner2])
 	}
 
 	// Check miner block counts with correct type assertion
 	minerBlocks := stats["miner_blocks"].(map[string]int)
-	if minerBlocks["miner1"] != 2 {
-		t.Errorf("Expected miner1 blocks 2, got %v", minerBlocks["miner1"])
+	if minerBlocks[testMiner1] != 2 {
+		t.Errorf("Expected miner1 blocks 2, got %v", minerBlocks[testMiner1])
 	}
 
-	if minerBlocks["miner2"] != 1 {
-		t.Errorf("Expected miner2 blocks 1, got %v", minerBlocks["miner2"])
+	if minerBlocks[testMiner2] != 1 {
+		t.Errorf("Expected miner2 blocks 1, got %v", minerBlocks[testMiner2])
 	}
 }
 
@@ -467,6 +460,20 @@ func TestSetDifficulty(t *testing.T) {
 	}
 }
 
+func TestIsValidRequiresProofOfWork(t *testing.T) {
+	bc := NewBlockchain()
+
+	// An unmined block with a zero nonce must still meet its target
+	block := NewBlock([]byte("Unmined block"), bc.GetLatestBlock().Hash)
+	block.Bits = BitsForDifficulty(MaxDifficulty)
+	block.Hash = block.CalculateHash()
+	bc.Blocks = append(bc.Blocks, block)
+
+	if bc.IsValid() {
+		t.Error("Expected blockchain with an unmined block to be invalid")
+	}
+}
+
 func TestIsValidWithUTXO(t *testing.T) {
 	bc := NewBlockchain()
 
@@ -491,6 +498,60 @@ func TestIsValidWithUTXO(t *testing.T) {
 	bc.Blocks[1].Hash = originalHash
 }
 
+func TestIsValidWithUTXODoubleSpend(t *testing.T) {
+	bc := NewBlockchain()
+	owner := newTestKeyPair(t)
+
+	coinbase := transactions.NewBlockCoinbaseTransaction(owner.Address, 50*transactions.Coin, 1)
+	if err := bc.AddBlockWithTransactions([]*transactions.Transaction{coinbase}); err != nil {
+		t.Fatalf("Failed to add coinbase block: %v", err)
+	}
+	for i := 0; i < DefaultCoinbaseMaturity; i++ {
+		if err := bc.AddBlock(fmt.Sprintf("Maturity block %d", i)); err != nil {
+			t.Fatalf("Failed to add block: %v", err)
+		}
+	}
+
+	spend := func(to string) *transactions.Transaction {
+		tx := transactions.NewTransaction(
+			[]transactions.TxInput{{TxID: coinbase.ID, Index: 0}},
+			[]transactions.TxOutput{{Address: to, Amount: 50 * transactions.Coin}},
+		)
+		signTestInputs(t, tx, owner, coinbase.Outputs[0])
+		return tx
+	}
+
+	if err := bc.AddBlockWithTransactions([]*transactions.Transaction{spend("mxm1qyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg3z6gnz9y")}); err != nil {
+		t.Fatalf("Failed to add spending block: %v", err)
+	}
+	if !bc.IsValidWithUTXO(nil) {
+		t.Fatal("Expected blockchain with a single spend to be valid")
+	}
+
+	if err := bc.AddBlockWithTransactions([]*transactions.Transaction{spend("mxm1qxvenxvenxvenxvenxvenxvenxvenxvengkylsk")}); err != nil {
+		t.Fatalf("Failed to add double-spending block: %v", err)
+	}
+	if bc.IsValidWithUTXO(nil) {
+		t.Error("Expected blockchain with a double spend across blocks to be invalid")
+	}
+}
+
+func TestIsValidWithUTXOEnforcesRewards(t *testing.T) {
+	bc := NewBlockchain()
+
+	// The coinbase claims more than the block subsidy
+	coinbase := transactions.NewBlockCoinbaseTransaction(testMiner1, BlockSubsidy(1)+1, 1)
+	if err := bc.AddBlockWithTransactions([]*transactions.Transaction{coinbase}); err != nil {
+		t.Fatalf("Failed to add coinbase block: %v", err)
+	}
+	if !bc.IsValid() {
+		t.Fatal("Expected blockchain to pass basic validation")
+	}
+	if bc.IsValidWithUTXO(nil) {
+		t.Error("Expected blockchain with an overpaying coinbase to be invalid")
+	}
+}
+
 func TestFindCommonAncestor(t *testing.T) {
 	bc1 := NewBlockchain()
 	bc1.AddBlock("Block 1")
@@ -525,8 +586,36 @@ func TestCalculateTotalWork(t *testing.T) {
 }
 
 func TestResolveFork(t *testing.T) {
-	// Skip this test as it can cause deadlock in test environment
-	t.Skip("ResolveFork test skipped due to potential deadlock")
+	bc1 := NewBlockchain()
+	bc2 := &Blockchain{Blocks: []*Block{bc1.Blocks[0]}}
+
+	cs := NewChainState(nil)
+	if err := bc1.AttachChainState(cs); err != nil {
+		t.Fatalf("Failed to attach chain state: %v", err)
+	}
+
+	localTx := transactions.NewBlockCoinbaseTransaction(testMiner1, 50, 1)
+	bc1.AddBlockWithTransactions([]*transactions.Transaction{localTx})
+
+	forkTx := transactions.NewBlockCoinbaseTransaction(testMiner2, 50, 1)
+	bc2.AddBlockWithTransactions([]*transactions.Transaction{forkTx})
+	bc2.AddBlock("Fork block 2")
+
+	if err := bc1.ResolveFork(bc2); err != nil {
+		t.Fatalf("ResolveFork failed: %v", err)
+	}
+
+	if bc1.GetChainLength() != 3 {
+		t.Errorf("Expected chain length 3 after reorg, got %d", bc1.GetChainLength())
+	}
+
+	utxoSet := cs.UTXOSet()
+	if utxoSet.Exists(localTx.ID, 0) {
+		t.Error("Expected output from the abandoned branch to be removed")
+	}
+	if !utxoSet.Exists(forkTx.ID, 0) {
+		t.Error("Expected output from the new branch to be unspent")
+	}
 }
 
 func TestShouldReplaceChain(t *testing.T) {
@@ -561,3 +650,41 @@ func TestShouldReplaceChain(t *testing.T) {
 		t.Error("Should not replace with equal length chain")
 	}
 }
+
+func TestMedianTimePast(t *testing.T) {
+	bc := NewBlockchain()
+	bc.Blocks[0].Timestamp = 1000
+
+	// A single block with a wildly wrong timestamp does not move the median
+	timestamps := []int64{1100, 1200, 99999, 1300, 1400}
+	for _, ts := range timestamps {
+		bc.Blocks = append(bc.Blocks, &Block{Timestamp: ts})
+	}
+
+	if mtp := bc.MedianTimePast(); mtp != 1300 {
+		t.Errorf("Expected median time past 1300, got %d", mtp)
+	}
+	if mtp := bc.MedianTimePastAt(1); mtp != 1100 {
+		t.Errorf("Expected median time past 1100 at index 1, got %d", mtp)
+	}
+
+	// Only the last MedianTimeSpan blocks count
+	for i := 0; i < MedianTimeSpan; i++ {
+		bc.Blocks = append(bc.Blocks, &Block{Timestamp: int64(2000 + i)})
+	}
+	if mtp := bc.MedianTimePast(); mtp != 2000+MedianTimeSpan/2 {
+		t.Errorf("Expected median of the last %d blocks, got %d", MedianTimeSpan, mtp)
+	}
+
+	// Headers give the same median as their blocks
+	headers := make([]*BlockHeader, 0, len(bc.Blocks))
+	for _, block := range bc.Blocks {
+		headers = append(headers, block.Header())
+	}
+	if mtp := HeaderMedianTimePast(headers); mtp != bc.MedianTimePast() {
+		t.Errorf("Expected header median time past %d, got %d", bc.MedianTimePast(), mtp)
+	}
+	if mtp := HeaderMedianTimePast(headers[:2]); mtp != bc.MedianTimePastAt(1) {
+		t.Errorf("Expected header median time past %d at index 1, got %d", bc.MedianTimePastAt(1), mtp)
+	}
+}
@@ -0,0 +1,359 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/aliexe/blockChain/internal/transactions"
+)
+
+// ErrRollbackFailed is returned when a failed reorganization could not be
+// rolled back, leaving the chain state on neither branch
+var ErrRollbackFailed = errors.New("chain state rollback failed")
+
+// BlockUndo is the undo log of a connected block: the outputs its
+// transactions spent, in transaction and input order
+type BlockUndo struct {
+	BlockHash []byte                     `json:"block_hash"`
+	Spent     []transactions.SpentOutput `json:"spent"`
+}
+
+// ChainState applies blocks to a UTXO set and keeps the undo logs needed to
+// disconnect them again during a reorganization. It enforces the coinbase
+// rules: the coinbase may claim at most the block subsidy plus fees, and its
+// outputs can only be spent after CoinbaseMaturity blocks. Transactions must
+// also be final: past their lock time and the relative locks of their inputs.
+type ChainState struct {
+	CoinbaseMaturity int
+
+	utxoSet         *transactions.UTXOSet
+	undoLogs        map[string]*BlockUndo
+	coinbaseHeights map[string]int
+	txHeights       map[string]int // Height of the block containing each transaction
+	blockTimes      []int64        // Timestamp of each connected block, by height
+	tip             []byte
+	height          int
+	mu              sync.Mutex
+}
+
+// NewChainState creates a chain state on top of the given UTXO set
+func NewChainState(utxoSet *transactions.UTXOSet) *ChainState {
+	if utxoSet == nil {
+		utxoSet = transactions.NewUTXOSet()
+	}
+	return &ChainState{
+		CoinbaseMaturity: DefaultCoinbaseMaturity,
+		utxoSet:          utxoSet,
+		undoLogs:         make(map[string]*BlockUndo),
+		coinbaseHeights:  make(map[string]int),
+		txHeights:        make(map[string]int),
+		height:           -1,
+	}
+}
+
+// UTXOSet returns the UTXO set maintained by the chain state
+func (cs *ChainState) UTXOSet() *transactions.UTXOSet {
+	return cs.utxoSet
+}
+
+// Tip returns the hash of the last connected block
+func (cs *ChainState) Tip() []byte {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	return cs.tip
+}
+
+// Height returns the height of the last connected block, or -1 if none
+func (cs *ChainState) Height() int {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	return cs.height
+}
+
+// IsCoinbaseMature reports whether outputs of the given transaction can be
+// spent in a block at the given height
+func (cs *ChainState) IsCoinbaseMature(txID string, height int) bool {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	return cs.isMatureLocked(txID, height)
+}
+
+// isMatureLocked checks coinbase maturity (assumes lock is held)
+func (cs *ChainState) isMatureLocked(txID string, height int) bool {
+	createdAt, isCoinbase := cs.coinbaseHeights[txID]
+	return !isCoinbase || height-createdAt >= cs.CoinbaseMaturity
+}
+
+// LockContext describes the next block for transaction lock checks. Inputs
+// spending outputs created in connected blocks get their confirmation height
+// and time from the chain state.
+func (cs *ChainState) LockContext() transactions.LockContext {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	return transactions.LockContext{
+		Height:     cs.height + 1,
+		MedianTime: cs.medianTimeLocked(cs.height),
+		Confirmation: func(txID string) (int, int64, bool) {
+			cs.mu.Lock()
+			defer cs.mu.Unlock()
+			return cs.confirmationLocked(txID)
+		},
+	}
+}
+
+// confirmationLocked returns the height of the block containing a transaction
+// and the median time past before it (assumes lock is held)
+func (cs *ChainState) confirmationLocked(txID string) (int, int64, bool) {
+	height, exists := cs.txHeights[txID]
+	if !exists {
+		return 0, 0, false
+	}
+	return height, cs.medianTimeLocked(height - 1), true
+}
+
+// medianTimeLocked returns the median time past of the block at height, or 0
+// below the genesis block (assumes lock is held)
+func (cs *ChainState) medianTimeLocked(height int) int64 {
+	if height < 0 || height >= len(cs.blockTimes) {
+		return 0
+	}
+	start := height + 1 - MedianTimeSpan
+	if start < 0 {
+		start = 0
+	}
+	timestamps := append([]int64{}, cs.blockTimes[start:height+1]...)
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+	return timestamps[len(timestamps)/2]
+}
+
+// checkLocksLocked checks that every transaction of a block at height is
+// final. Inputs may spend outputs of earlier transactions in the same block.
+// (assumes lock is held)
+func (cs *ChainState) checkLocksLocked(block *Block, height int) error {
+	medianTime := cs.medianTimeLocked(height - 1)
+	inBlock := make(map[string]bool, len(block.Transactions))
+	ctx := transactions.LockContext{
+		Height:     height,
+		MedianTime: medianTime,
+		Confirmation: func(txID string) (int, int64, bool) {
+			if inBlock[txID] {
+				return height, medianTime, true
+			}
+			return cs.confirmationLocked(txID)
+		},
+	}
+
+	for _, tx := range block.Transactions {
+		if err := tx.CheckLocks(ctx); err != nil {
+			return fmt.Errorf("transaction %s: %w", tx.ID, err)
+		}
+		inBlock[tx.ID] = true
+	}
+	return nil
+}
+
+// GetUndo returns the undo log of a connected block
+func (cs *ChainState) GetUndo(blockHash []byte) (*BlockUndo, bool) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	undo, exists := cs.undoLogs[hex.EncodeToString(blockHash)]
+	return undo, exists
+}
+
+// ConnectBlock applies the block's transactions to the UTXO set atomically
+// and records an undo log. The block must build on the current tip.
+func (cs *ChainState) ConnectBlock(block *Block) (*BlockUndo, error) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	return cs.connectBlockLocked(block)
+}
+
+// DisconnectBlock reverts the block at the current tip using its undo log
+func (cs *ChainState) DisconnectBlock(block *Block) error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	return cs.disconnectBlockLocked(block)
+}
+
+// Reorganize disconnects the blocks in disconnect (tip first) and then connects
+// the blocks in connect (oldest first). If any block fails to connect, the
+// chain state is restored to the original branch. If that fails too, the
+// returned error wraps ErrRollbackFailed.
+func (cs *ChainState) Reorganize(disconnect []*Block, connect []*Block) error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	for i, block := range disconnect {
+		if err := cs.disconnectBlockLocked(block); err != nil {
+			if restoreErr := cs.restoreLocked(nil, disconnect[:i]); restoreErr != nil {
+				return fmt.Errorf("failed to disconnect block %x: %w (%w)", block.Hash, err, restoreErr)
+			}
+			return fmt.Errorf("failed to disconnect block %x: %w", block.Hash, err)
+		}
+	}
+
+	for i, block := range connect {
+		if _, err := cs.connectBlockLocked(block); err != nil {
+			if restoreErr := cs.restoreLocked(connect[:i], disconnect); restoreErr != nil {
+				return fmt.Errorf("failed to connect block %x: %w (%w)", block.Hash, err, restoreErr)
+			}
+			return fmt.Errorf("failed to connect block %x: %w", block.Hash, err)
+		}
+	}
+
+	return nil
+}
+
+// restoreLocked rolls back a partial reorganization: the connected blocks are
+// disconnected and the disconnected blocks reconnected (assumes lock is held).
+// It stops at the first block that fails, returning an error wrapping
+// ErrRollbackFailed.
+func (cs *ChainState) restoreLocked(connected []*Block, disconnected []*Block) error {
+	for i := len(connected) - 1; i >= 0; i-- {
+		if err := cs.disconnectBlockLocked(connected[i]); err != nil {
+			return fmt.Errorf("%w: failed to roll back block %x: %v", ErrRollbackFailed, connected[i].Hash, err)
+		}
+	}
+	for i := len(disconnected) - 1; i >= 0; i-- {
+		if _, err := cs.connectBlockLocked(disconnected[i]); err != nil {
+			return fmt.Errorf("%w: failed to reconnect block %x: %v", ErrRollbackFailed, disconnected[i].Hash, err)
+		}
+	}
+	return nil
+}
+
+// connectBlockLocked connects a block (assumes lock is held)
+func (cs *ChainState) connectBlockLocked(block *Block) (*BlockUndo, error) {
+	if cs.tip != nil && !bytes.Equal(block.PrevHash, cs.tip) {
+		return nil, fmt.Errorf("block does not build on chain state tip")
+	}
+	height := cs.height + 1
+
+	for i, tx := range block.Transactions {
+		if err := tx.ValidateBasic(); err != nil {
+			return nil, fmt.Errorf("invalid transaction %d: %w", i, err)
+		}
+		if tx.IsCoinbase() && i != 0 {
+			return nil, fmt.Errorf("coinbase transaction must be the first transaction")
+		}
+	}
+	if err := cs.checkLocksLocked(block, height); err != nil {
+		return nil, err
+	}
+
+	spent, err := cs.utxoSet.ApplyTransactions(block.Transactions)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cs.checkBlockRewardsLocked(block, height, spent); err != nil {
+		cs.utxoSet.RevertTransactions(block.Transactions, spent)
+		return nil, err
+	}
+
+	if coinbase := blockCoinbase(block); coinbase != nil {
+		cs.coinbaseHeights[coinbase.ID] = height
+	}
+	for _, tx := range block.Transactions {
+		cs.txHeights[tx.ID] = height
+	}
+	cs.blockTimes = append(cs.blockTimes[:height], block.Timestamp)
+
+	undo := &BlockUndo{BlockHash: block.Hash, Spent: spent}
+	cs.undoLogs[hex.EncodeToString(block.Hash)] = undo
+	cs.tip = block.Hash
+	cs.height = height
+	return undo, nil
+}
+
+// checkBlockRewardsLocked validates fees, the coinbase amount and coinbase
+// maturity against the outputs spent by the block (assumes lock is held)
+func (cs *ChainState) checkBlockRewardsLocked(block *Block, height int, spent []transactions.SpentOutput) error {
+	var fees transactions.Amount
+	next := 0
+	for _, tx := range block.Transactions {
+		if tx.IsCoinbase() {
+			continue
+		}
+
+		var inputAmount transactions.Amount
+		for _, entry := range spent[next : next+len(tx.Inputs)] {
+			if !cs.isMatureLocked(entry.Key.TxID, height) {
+				return fmt.Errorf("transaction %s spends immature coinbase output %s", tx.ID, entry.Key.String())
+			}
+			var err error
+			if inputAmount, err = inputAmount.Add(entry.Output.Amount); err != nil {
+				return fmt.Errorf("transaction %s: %w", tx.ID, err)
+			}
+		}
+		next += len(tx.Inputs)
+
+		outputAmount := tx.GetOutputAmount()
+		if outputAmount > inputAmount {
+			return fmt.Errorf("transaction %s spends %s but only has %s in inputs", tx.ID, outputAmount, inputAmount)
+		}
+		var err error
+		if fees, err = fees.Add(inputAmount - outputAmount); err != nil {
+			return fmt.Errorf("block fees: %w", err)
+		}
+	}
+
+	coinbase := blockCoinbase(block)
+	if coinbase == nil {
+		return nil
+	}
+	if coinbase.Height != height {
+		return fmt.Errorf("coinbase height %d does not match block height %d", coinbase.Height, height)
+	}
+	maxReward, err := BlockSubsidy(height).Add(fees)
+	if err != nil {
+		return fmt.Errorf("block reward: %w", err)
+	}
+	if coinbase.GetOutputAmount() > maxReward {
+		return fmt.Errorf("coinbase pays %s, exceeding subsidy plus fees of %s", coinbase.GetOutputAmount(), maxReward)
+	}
+	return nil
+}
+
+// blockCoinbase returns the coinbase transaction of a block, if any
+func blockCoinbase(block *Block) *transactions.Transaction {
+	if len(block.Transactions) == 0 || !block.Transactions[0].IsCoinbase() {
+		return nil
+	}
+	return block.Transactions[0]
+}
+
+// disconnectBlockLocked disconnects the tip block (assumes lock is held)
+func (cs *ChainState) disconnectBlockLocked(block *Block) error {
+	if !bytes.Equal(block.Hash, cs.tip) {
+		return fmt.Errorf("block is not the chain state tip")
+	}
+
+	key := hex.EncodeToString(block.Hash)
+	undo, exists := cs.undoLogs[key]
+	if !exists {
+		return fmt.Errorf("no undo log for block")
+	}
+
+	if err := cs.utxoSet.RevertTransactions(block.Transactions, undo.Spent); err != nil {
+		return err
+	}
+
+	if coinbase := blockCoinbase(block); coinbase != nil {
+		delete(cs.coinbaseHeights, coinbase.ID)
+	}
+	for _, tx := range block.Transactions {
+		delete(cs.txHeights, tx.ID)
+	}
+	cs.blockTimes = cs.blockTimes[:cs.height]
+
+	delete(cs.undoLogs, key)
+	cs.tip = block.PrevHash
+	cs.height--
+	return nil
+}
@@ -0,0 +1,393 @@
+package blockchain
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/aliexe/blockChain/internal/crypto"
+	"github.com/aliexe/blockChain/internal/transactions"
+)
+
+// newTestKeyPair returns a new key pair whose address test outputs can be
+// paid to and spent from
+func newTestKeyPair(t *testing.T) *crypto.KeyPair {
+	t.Helper()
+	keyPair, err := crypto.NewKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+	return keyPair
+}
+
+// signTestInputs signs every input of tx with keyPair. prevOutputs are the
+// outputs the inputs spend, in input order.
+func signTestInputs(t *testing.T, tx *transactions.Transaction, keyPair *crypto.KeyPair, prevOutputs ...transactions.TxOutput) {
+	t.Helper()
+	for i := range tx.Inputs {
+		if err := tx.SignTransaction(i, keyPair.PrivateKey, prevOutputs); err != nil {
+			t.Fatalf("Failed to sign input %d: %v", i, err)
+		}
+	}
+}
+
+func TestChainStateConnectDisconnect(t *testing.T) {
+	bc := NewBlockchain()
+	cs := NewChainState(nil)
+	cs.CoinbaseMaturity = 1
+	if err := bc.AttachChainState(cs); err != nil {
+		t.Fatalf("Failed to attach chain state: %v", err)
+	}
+	owner := newTestKeyPair(t)
+
+	coinbase := transactions.NewBlockCoinbaseTransaction(owner.Address, 50*transactions.Coin, 1)
+	if err := bc.AddBlockWithTransactions([]*transactions.Transaction{coinbase}); err != nil {
+		t.Fatalf("Failed to add coinbase block: %v", err)
+	}
+
+	spend := transactions.NewTransaction(
+		[]transactions.TxInput{{TxID: coinbase.ID, Index: 0}},
+		[]transactions.TxOutput{{Address: "mxm1qyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg3z6gnz9y", Amount: 50 * transactions.Coin}},
+	)
+	signTestInputs(t, spend, owner, coinbase.Outputs[0])
+	if err := bc.AddBlockWithTransactions([]*transactions.Transaction{spend}); err != nil {
+		t.Fatalf("Failed to add spending block: %v", err)
+	}
+
+	utxoSet := cs.UTXOSet()
+	if utxoSet.Exists(coinbase.ID, 0) || !utxoSet.Exists(spend.ID, 0) {
+		t.Fatal("Expected coinbase output to be spent and new output to be unspent")
+	}
+
+	tip := bc.GetLatestBlock()
+	undo, ok := cs.GetUndo(tip.Hash)
+	if !ok || len(undo.Spent) != 1 {
+		t.Fatalf("Expected undo log with one spent output, got %v", undo)
+	}
+
+	// A second spend of the same output must be rejected and leave the chain unchanged
+	doubleSpend := transactions.NewTransaction(
+		[]transactions.TxInput{{TxID: coinbase.ID, Index: 0}},
+		[]transactions.TxOutput{{Address: "mxm1qxvenxvenxvenxvenxvenxvenxvenxvengkylsk", Amount: 50 * transactions.Coin}},
+	)
+	signTestInputs(t, doubleSpend, owner, coinbase.Outputs[0])
+	if err := bc.AddBlockWithTransactions([]*transactions.Transaction{doubleSpend}); err == nil {
+		t.Error("Expected double-spending block to be rejected")
+	}
+	if bc.GetChainLength() != 3 {
+		t.Errorf("Expected chain length 3, got %d", bc.GetChainLength())
+	}
+
+	if err := cs.DisconnectBlock(tip); err != nil {
+		t.Fatalf("Failed to disconnect tip: %v", err)
+	}
+	if !utxoSet.Exists(coinbase.ID, 0) || utxoSet.Exists(spend.ID, 0) {
+		t.Error("Expected disconnect to restore the spent coinbase output")
+	}
+	if _, ok := cs.GetUndo(tip.Hash); ok {
+		t.Error("Expected undo log to be removed after disconnect")
+	}
+}
+
+func TestChainStateVerifiesInputScripts(t *testing.T) {
+	genesis := NewGenesisBlock()
+	cs := NewChainState(nil)
+	cs.CoinbaseMaturity = 0
+	if _, err := cs.ConnectBlock(genesis); err != nil {
+		t.Fatalf("Failed to connect genesis: %v", err)
+	}
+
+	owner := newTestKeyPair(t)
+	coinbase := transactions.NewBlockCoinbaseTransaction(owner.Address, 50*transactions.Coin, 1)
+	funding := NewBlockWithTransactions([]*transactions.Transaction{coinbase}, genesis.Hash)
+	if _, err := cs.ConnectBlock(funding); err != nil {
+		t.Fatalf("Failed to connect block: %v", err)
+	}
+
+	newSpend := func() *transactions.Transaction {
+		return transactions.NewTransaction(
+			[]transactions.TxInput{{TxID: coinbase.ID, Index: 0}},
+			[]transactions.TxOutput{{Address: testMiner2, Amount: 50 * transactions.Coin}},
+		)
+	}
+
+	unsigned := newSpend()
+	if _, err := cs.ConnectBlock(NewBlockWithTransactions([]*transactions.Transaction{unsigned}, funding.Hash)); err == nil {
+		t.Error("Expected block with an unsigned spend to be rejected")
+	}
+
+	wrongKey := newSpend()
+	signTestInputs(t, wrongKey, newTestKeyPair(t), coinbase.Outputs[0])
+	if _, err := cs.ConnectBlock(NewBlockWithTransactions([]*transactions.Transaction{wrongKey}, funding.Hash)); err == nil {
+		t.Error("Expected block with a spend signed by the wrong key to be rejected")
+	}
+
+	// A signature made for another transaction does not unlock this one
+	tampered := newSpend()
+	signTestInputs(t, tampered, owner, coinbase.Outputs[0])
+	tampered.Outputs[0].Address = testMiner1
+	tampered.ID = tampered.CalculateID()
+	if _, err := cs.ConnectBlock(NewBlockWithTransactions([]*transactions.Transaction{tampered}, funding.Hash)); err == nil {
+		t.Error("Expected block with a tampered spend to be rejected")
+	}
+
+	// Nor may a transaction carry an ID that does not commit to its contents
+	misnamed := newSpend()
+	signTestInputs(t, misnamed, owner, coinbase.Outputs[0])
+	misnamed.ID = coinbase.ID
+	if _, err := cs.ConnectBlock(NewBlockWithTransactions([]*transactions.Transaction{misnamed}, funding.Hash)); err == nil {
+		t.Error("Expected block with a mismatched transaction ID to be rejected")
+	}
+
+	if !cs.UTXOSet().Exists(coinbase.ID, 0) || string(cs.Tip()) != string(funding.Hash) {
+		t.Fatal("Expected rejected blocks to leave the chain state unchanged")
+	}
+
+	signed := newSpend()
+	signTestInputs(t, signed, owner, coinbase.Outputs[0])
+	if _, err := cs.ConnectBlock(NewBlockWithTransactions([]*transactions.Transaction{signed}, funding.Hash)); err != nil {
+		t.Fatalf("Expected block with a signed spend to connect: %v", err)
+	}
+	if cs.UTXOSet().Exists(coinbase.ID, 0) {
+		t.Error("Expected signed spend to consume the coinbase output")
+	}
+}
+
+func TestChainStateReorganizeRollsBackOnFailure(t *testing.T) {
+	genesis := NewGenesisBlock()
+	cs := NewChainState(nil)
+	cs.CoinbaseMaturity = 0
+	if _, err := cs.ConnectBlock(genesis); err != nil {
+		t.Fatalf("Failed to connect genesis: %v", err)
+	}
+
+	coinbase := transactions.NewBlockCoinbaseTransaction("mxm1qzyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg344kydn", 50*transactions.Coin, 1)
+	oldBlock := NewBlockWithTransactions([]*transactions.Transaction{coinbase}, genesis.Hash)
+	if _, err := cs.ConnectBlock(oldBlock); err != nil {
+		t.Fatalf("Failed to connect block: %v", err)
+	}
+
+	// The new branch spends an output that does not exist on it
+	spend := transactions.NewTransaction(
+		[]transactions.TxInput{{TxID: coinbase.ID, Index: 0}},
+		[]transactions.TxOutput{{Address: "mxm1qyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg3z6gnz9y", Amount: 50 * transactions.Coin}},
+	)
+	newBlock := NewBlockWithTransactions([]*transactions.Transaction{spend}, genesis.Hash)
+
+	if err := cs.Reorganize([]*Block{oldBlock}, []*Block{newBlock}); err == nil {
+		t.Fatal("Expected reorganization onto invalid branch to fail")
+	}
+	if !cs.UTXOSet().Exists(coinbase.ID, 0) {
+		t.Error("Expected original branch to be reconnected")
+	}
+	if string(cs.Tip()) != string(oldBlock.Hash) {
+		t.Error("Expected chain state tip to be restored")
+	}
+}
+
+func TestChainStateReorganizeReportsFailedRollback(t *testing.T) {
+	genesis := NewGenesisBlock()
+	cs := NewChainState(nil)
+	cs.CoinbaseMaturity = 0
+	if _, err := cs.ConnectBlock(genesis); err != nil {
+		t.Fatalf("Failed to connect genesis: %v", err)
+	}
+
+	owner := newTestKeyPair(t)
+	coinbase := transactions.NewBlockCoinbaseTransaction(owner.Address, 50*transactions.Coin, 1)
+	funding := NewBlockWithTransactions([]*transactions.Transaction{coinbase}, genesis.Hash)
+	if _, err := cs.ConnectBlock(funding); err != nil {
+		t.Fatalf("Failed to connect block: %v", err)
+	}
+	spend := transactions.NewTransaction(
+		[]transactions.TxInput{{TxID: coinbase.ID, Index: 0}},
+		[]transactions.TxOutput{{Address: testMiner2, Amount: 50 * transactions.Coin}},
+	)
+	signTestInputs(t, spend, owner, coinbase.Outputs[0])
+	spending := NewBlockWithTransactions([]*transactions.Transaction{spend}, funding.Hash)
+	if _, err := cs.ConnectBlock(spending); err != nil {
+		t.Fatalf("Failed to connect spending block: %v", err)
+	}
+
+	// The spend is no longer mature, so the old branch cannot be reconnected
+	// once the new branch fails
+	cs.CoinbaseMaturity = 100
+	invalid := NewBlockWithTransactions([]*transactions.Transaction{spend}, genesis.Hash)
+
+	err := cs.Reorganize([]*Block{spending}, []*Block{invalid})
+	if !errors.Is(err, ErrRollbackFailed) {
+		t.Fatalf("Expected failed rollback to be reported, got %v", err)
+	}
+}
+
+func TestChainStateCoinbaseRules(t *testing.T) {
+	bc := NewBlockchain()
+	cs := NewChainState(nil)
+	cs.CoinbaseMaturity = 2
+	if err := bc.AttachChainState(cs); err != nil {
+		t.Fatalf("Failed to attach chain state: %v", err)
+	}
+
+	// A coinbase may not claim more than the subsidy when there are no fees
+	greedy := transactions.NewBlockCoinbaseTransaction(testMiner1, BlockSubsidy(1)+1, 1)
+	if err := bc.AddBlockWithTransactions([]*transactions.Transaction{greedy}); err == nil {
+		t.Error("Expected coinbase exceeding the subsidy to be rejected")
+	}
+
+	// The coinbase must commit to the block height
+	wrongHeight := transactions.NewBlockCoinbaseTransaction(testMiner1, BlockSubsidy(1), 5)
+	if err := bc.AddBlockWithTransactions([]*transactions.Transaction{wrongHeight}); err == nil {
+		t.Error("Expected coinbase with wrong height to be rejected")
+	}
+
+	miner := newTestKeyPair(t)
+	if _, err := bc.AddBlockWithMining("Block 1", miner.Address, 1); err != nil {
+		t.Fatalf("Failed to mine block: %v", err)
+	}
+	reward := bc.GetLatestBlock().Transactions[0]
+
+	spend := transactions.NewTransaction(
+		[]transactions.TxInput{{TxID: reward.ID, Index: 0}},
+		[]transactions.TxOutput{{Address: testMiner2, Amount: 40 * transactions.Coin}},
+	)
+	signTestInputs(t, spend, miner, reward.Outputs[0])
+
+	// Height 2 is only one block after the coinbase
+	if err := bc.AddBlockWithTransactions([]*transactions.Transaction{spend}); err == nil {
+		t.Fatal("Expected spend of immature coinbase to be rejected")
+	}
+	if cs.IsCoinbaseMature(reward.ID, 2) || !cs.IsCoinbaseMature(reward.ID, 3) {
+		t.Error("Expected coinbase to mature after two blocks")
+	}
+
+	if _, err := bc.AddBlockWithMining("Block 2", testMiner1, 1); err != nil {
+		t.Fatalf("Failed to mine block: %v", err)
+	}
+
+	// Once mature, the spend is accepted and its fee can be claimed by the coinbase
+	feeCoinbase := transactions.NewBlockCoinbaseTransaction(testMiner2, BlockSubsidy(3)+10*transactions.Coin, 3)
+	if err := bc.AddBlockWithTransactions([]*transactions.Transaction{feeCoinbase, spend}); err != nil {
+		t.Fatalf("Expected mature spend with fee to be accepted: %v", err)
+	}
+	if !cs.UTXOSet().Exists(feeCoinbase.ID, 0) {
+		t.Error("Expected fee-paying coinbase output to be unspent")
+	}
+}
+
+func TestChainStateLockTimes(t *testing.T) {
+	bc := NewBlockchain()
+	cs := NewChainState(nil)
+	cs.CoinbaseMaturity = 1
+	if err := bc.AttachChainState(cs); err != nil {
+		t.Fatalf("Failed to attach chain state: %v", err)
+	}
+
+	owner := newTestKeyPair(t)
+	coinbase := transactions.NewBlockCoinbaseTransaction(owner.Address, BlockSubsidy(1), 1)
+	if err := bc.AddBlockWithTransactions([]*transactions.Transaction{coinbase}); err != nil {
+		t.Fatalf("Failed to add coinbase block: %v", err)
+	}
+
+	// The coinbase confirmed at height 1, so the input is locked until height 3
+	relative := transactions.NewTransaction(
+		[]transactions.TxInput{{TxID: coinbase.ID, Index: 0, Sequence: transactions.BlockSequence(2)}},
+		[]transactions.TxOutput{{Address: owner.Address, Amount: BlockSubsidy(1)}},
+	)
+	signTestInputs(t, relative, owner, coinbase.Outputs[0])
+	if err := bc.AddBlockWithTransactions([]*transactions.Transaction{relative}); err == nil {
+		t.Fatal("Expected relative lock to reject the spend at height 2")
+	}
+	if err := bc.AddBlockWithTransactions(nil); err != nil {
+		t.Fatalf("Failed to add empty block: %v", err)
+	}
+	if err := bc.AddBlockWithTransactions([]*transactions.Transaction{relative}); err != nil {
+		t.Fatalf("Expected relative lock to pass at height 3: %v", err)
+	}
+
+	absolute := transactions.NewTransaction(
+		[]transactions.TxInput{{TxID: relative.ID, Index: 0}},
+		[]transactions.TxOutput{{Address: testMiner1, Amount: BlockSubsidy(1)}},
+	)
+	absolute.LockTime = 4
+	absolute.ID = absolute.CalculateID()
+	signTestInputs(t, absolute, owner, relative.Outputs[0])
+
+	ctx := cs.LockContext()
+	if ctx.Height != 4 {
+		t.Errorf("Expected lock context for height 4, got %d", ctx.Height)
+	}
+	if height, _, ok := ctx.Confirmation(relative.ID); !ok || height != 3 {
+		t.Errorf("Expected transaction confirmed at height 3, got %d (%v)", height, ok)
+	}
+
+	// A lock time of 4 allows the first block above height 4
+	if err := bc.AddBlockWithTransactions([]*transactions.Transaction{absolute}); err == nil {
+		t.Fatal("Expected lock time to reject the transaction at height 4")
+	}
+	if err := bc.AddBlockWithTransactions(nil); err != nil {
+		t.Fatalf("Failed to add empty block: %v", err)
+	}
+	if err := bc.AddBlockWithTransactions([]*transactions.Transaction{absolute}); err != nil {
+		t.Fatalf("Expected lock time to pass at height 5: %v", err)
+	}
+
+	// Disconnecting forgets the confirmation
+	if err := cs.DisconnectBlock(bc.GetLatestBlock()); err != nil {
+		t.Fatalf("Failed to disconnect tip: %v", err)
+	}
+	if _, _, ok := cs.LockContext().Confirmation(absolute.ID); ok {
+		t.Error("Expected disconnected transaction to be unconfirmed")
+	}
+}
+
+func TestChainStateFollowsLoadedBlocks(t *testing.T) {
+	newChainData := func(reward transactions.Amount) ([]byte, *transactions.Transaction) {
+		t.Helper()
+		source := NewBlockchain()
+		coinbase := transactions.NewBlockCoinbaseTransaction(testMiner1, reward, 1)
+		if err := source.AddBlockWithTransactions([]*transactions.Transaction{coinbase}); err != nil {
+			t.Fatalf("Failed to add coinbase block: %v", err)
+		}
+		data, err := source.ToJSON()
+		if err != nil {
+			t.Fatalf("ToJSON failed: %v", err)
+		}
+		return data, coinbase
+	}
+
+	bc := NewBlockchain()
+	cs := NewChainState(nil)
+	if err := bc.AttachChainState(cs); err != nil {
+		t.Fatalf("Failed to attach chain state: %v", err)
+	}
+	local := transactions.NewBlockCoinbaseTransaction(testMiner2, BlockSubsidy(1), 1)
+	if err := bc.AddBlockWithTransactions([]*transactions.Transaction{local}); err != nil {
+		t.Fatalf("Failed to add local block: %v", err)
+	}
+
+	// Loading another chain replaces the local block in the chain state too
+	data, coinbase := newChainData(BlockSubsidy(1))
+	if err := bc.FromJSON(data); err != nil {
+		t.Fatalf("FromJSON failed: %v", err)
+	}
+	if cs.UTXOSet().Exists(local.ID, 0) || !cs.UTXOSet().Exists(coinbase.ID, 0) {
+		t.Error("Expected the chain state to hold the outputs of the loaded blocks")
+	}
+	if string(cs.Tip()) != string(bc.GetLatestBlock().Hash) {
+		t.Error("Expected the chain state tip to match the loaded chain")
+	}
+
+	// Blocks that do not connect are not loaded
+	tip := bc.GetLatestBlock()
+	invalid, _ := newChainData(BlockSubsidy(1) + 1)
+	filename := t.TempDir() + "/invalid.json"
+	if err := os.WriteFile(filename, invalid, 0600); err != nil {
+		t.Fatalf("Failed to write chain: %v", err)
+	}
+	if err := bc.LoadFromFile(filename); err == nil {
+		t.Error("Expected chain with an overpaying coinbase to be rejected")
+	}
+	if bc.GetLatestBlock() != tip || string(cs.Tip()) != string(tip.Hash) {
+		t.Error("Expected the rejected load to leave the chain and chain state unchanged")
+	}
+}
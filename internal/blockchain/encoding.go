@@ -0,0 +1,139 @@
+package blockchain
+
+import (
+	"fmt"
+
+	"github.com/aliexe/blockChain/internal/encoding"
+	"github.com/aliexe/blockChain/internal/transactions"
+)
+
+// BlockEncodingVersion is the version of the binary block and header encoding.
+// Version 2 replaced the difficulty in the header with compact target bits.
+const BlockEncodingVersion uint8 = 2
+
+// MarshalBinary encodes the block header, hash and body
+func (b *Block) MarshalBinary() ([]byte, error) {
+	w := encoding.NewWriter()
+	b.encode(w)
+	return w.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a block produced by MarshalBinary
+func (b *Block) UnmarshalBinary(data []byte) error {
+	r := encoding.NewReader(data)
+	decoded := decodeBlock(r)
+	if err := r.Finish(); err != nil {
+		return fmt.Errorf("failed to decode block: %w", err)
+	}
+	*b = *decoded
+	return nil
+}
+
+func (b *Block) encode(w *encoding.Writer) {
+	w.WriteUint8(BlockEncodingVersion)
+	w.WriteBytes(b.PrevHash)
+	w.WriteBytes(b.MerkleRoot)
+	w.WriteInt64(b.Timestamp)
+	w.WriteUint32(b.Bits)
+	w.WriteUint32(b.Nonce)
+	w.WriteVarint(int64(b.Difficulty))
+	w.WriteBytes(b.Hash)
+	w.WriteBytes(b.Data)
+	transactions.WriteTransactions(w, b.Transactions)
+}
+
+func decodeBlock(r *encoding.Reader) *Block {
+	r.ReadVersion(BlockEncodingVersion)
+	b := &Block{
+		PrevHash:   r.ReadBytes(),
+		MerkleRoot: r.ReadBytes(),
+		Timestamp:  r.ReadInt64(),
+		Bits:       r.ReadUint32(),
+		Nonce:      r.ReadUint32(),
+		Difficulty: int(r.ReadVarint()),
+		Hash:       r.ReadBytes(),
+		Data:       r.ReadBytes(),
+	}
+	if txs := transactions.ReadTransactions(r); len(txs) > 0 {
+		b.Transactions = txs
+	}
+	return b
+}
+
+// EncodeBlocks encodes a list of blocks, e.g. for a network response
+func EncodeBlocks(blocks []*Block) []byte {
+	w := encoding.NewWriter()
+	w.WriteUvarint(uint64(len(blocks)))
+	for _, block := range blocks {
+		data, _ := block.MarshalBinary()
+		w.WriteBytes(data)
+	}
+	return w.Bytes()
+}
+
+// DecodeBlocks decodes a list produced by EncodeBlocks
+func DecodeBlocks(data []byte) ([]*Block, error) {
+	r := encoding.NewReader(data)
+	count := r.ReadCount(1)
+	blocks := make([]*Block, 0, count)
+	for i := 0; i < count && r.Err() == nil; i++ {
+		block := &Block{}
+		if err := block.UnmarshalBinary(r.ReadBytes()); err != nil {
+			r.Fail(fmt.Errorf("block %d: %w", i, err))
+			break
+		}
+		blocks = append(blocks, block)
+	}
+	if err := r.Finish(); err != nil {
+		return nil, fmt.Errorf("failed to decode blocks: %w", err)
+	}
+	return blocks, nil
+}
+
+// minHeaderSize bounds the entry count of a header list: a version, two
+// empty hashes, timestamp, bits and nonce
+const minHeaderSize = 1 + 1 + 1 + 8 + 4 + 4
+
+func (h *BlockHeader) encode(w *encoding.Writer) {
+	w.WriteUint8(BlockEncodingVersion)
+	w.WriteBytes(h.PrevHash)
+	w.WriteBytes(h.MerkleRoot)
+	w.WriteInt64(h.Timestamp)
+	w.WriteUint32(h.Bits)
+	w.WriteUint32(h.Nonce)
+}
+
+func decodeHeader(r *encoding.Reader) *BlockHeader {
+	r.ReadVersion(BlockEncodingVersion)
+	return &BlockHeader{
+		PrevHash:   r.ReadBytes(),
+		MerkleRoot: r.ReadBytes(),
+		Timestamp:  r.ReadInt64(),
+		Bits:       r.ReadUint32(),
+		Nonce:      r.ReadUint32(),
+	}
+}
+
+// EncodeHeaders encodes a list of headers, e.g. for a network response
+func EncodeHeaders(headers []*BlockHeader) []byte {
+	w := encoding.NewWriter()
+	w.WriteUvarint(uint64(len(headers)))
+	for _, header := range headers {
+		header.encode(w)
+	}
+	return w.Bytes()
+}
+
+// DecodeHeaders decodes a list produced by EncodeHeaders
+func DecodeHeaders(data []byte) ([]*BlockHeader, error) {
+	r := encoding.NewReader(data)
+	count := r.ReadCount(minHeaderSize)
+	headers := make([]*BlockHeader, 0, count)
+	for i := 0; i < count && r.Err() == nil; i++ {
+		headers = append(headers, decodeHeader(r))
+	}
+	if err := r.Finish(); err != nil {
+		return nil, fmt.Errorf("failed to decode headers: %w", err)
+	}
+	return headers, nil
+}
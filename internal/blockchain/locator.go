@@ -0,0 +1,92 @@
+package blockchain
+
+// locatorDenseHashes is how many of the most recent blocks a block locator
+// lists one by one before it starts doubling the step back
+const locatorDenseHashes = 10
+
+// BlockLocator returns block hashes from the tip back to the genesis block:
+// the most recent blocks one by one, then exponentially spaced. A peer finds
+// the last block it shares with the chain from the first hash it knows, in
+// one round trip however long the chains are.
+func (bc *Blockchain) BlockLocator() [][]byte {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	if len(bc.Blocks) == 0 {
+		return nil
+	}
+
+	var locator [][]byte
+	step := 1
+	for i := len(bc.Blocks) - 1; i > 0; i -= step {
+		locator = append(locator, bc.Blocks[i].Hash)
+		if len(locator) >= locatorDenseHashes {
+			step *= 2
+		}
+	}
+	return append(locator, bc.Blocks[0].Hash)
+}
+
+// LocateFork returns the index of the highest block of the chain listed in
+// locator, or -1 if the chain has none of them
+func (bc *Blockchain) LocateFork(locator [][]byte) int {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.locateForkLocked(locator)
+}
+
+// locateForkLocked finds the highest block listed in locator (assumes lock
+// is held)
+func (bc *Blockchain) locateForkLocked(locator [][]byte) int {
+	hashes := make(map[string]bool, len(locator))
+	for _, hash := range locator {
+		hashes[string(hash)] = true
+	}
+	for i := len(bc.Blocks) - 1; i >= 0; i-- {
+		if hashes[string(bc.Blocks[i].Hash)] {
+			return i
+		}
+	}
+	return -1
+}
+
+// HeadersAfter returns the headers of up to max blocks following the fork
+// point of locator, stopping after the block with stopHash if it comes
+// first. Without a known locator hash it starts after the genesis block.
+func (bc *Blockchain) HeadersAfter(locator [][]byte, stopHash []byte, max int) []*BlockHeader {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	fork := bc.locateForkLocked(locator)
+	if fork < 0 {
+		fork = 0
+	}
+
+	var headers []*BlockHeader
+	for i := fork + 1; i < len(bc.Blocks) && len(headers) < max; i++ {
+		headers = append(headers, bc.Blocks[i].Header())
+		if len(stopHash) > 0 && string(bc.Blocks[i].Hash) == string(stopHash) {
+			break
+		}
+	}
+	return headers
+}
+
+// HeadersTo returns the headers of the blocks from the genesis block up to
+// and including the block at index
+func (bc *Blockchain) HeadersTo(index int) []*BlockHeader {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	if index >= len(bc.Blocks) {
+		index = len(bc.Blocks) - 1
+	}
+	if index < 0 {
+		return nil
+	}
+	headers := make([]*BlockHeader, 0, index+1)
+	for _, block := range bc.Blocks[:index+1] {
+		headers = append(headers, block.Header())
+	}
+	return headers
+}
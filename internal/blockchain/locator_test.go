@@ -0,0 +1,123 @@
+package blockchain
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestBlockLocator(t *testing.T) {
+	bc := NewBlockchain()
+	for i := 1; i <= 40; i++ {
+		if err := bc.AddBlock(fmt.Sprintf("Block %d", i)); err != nil {
+			t.Fatalf("Failed to add block: %v", err)
+		}
+	}
+
+	locator := bc.BlockLocator()
+	if !bytes.Equal(locator[0], bc.GetLatestBlock().Hash) {
+		t.Error("Expected locator to start at the tip")
+	}
+	if !bytes.Equal(locator[len(locator)-1], bc.Blocks[0].Hash) {
+		t.Error("Expected locator to end at the genesis block")
+	}
+
+	// Heights 40..31 one by one, then steps of 2, 4, 8 and 16, and genesis
+	expected := []int{40, 39, 38, 37, 36, 35, 34, 33, 32, 31, 29, 25, 17, 1, 0}
+	if len(locator) != len(expected) {
+		t.Fatalf("Expected %d locator hashes, got %d", len(expected), len(locator))
+	}
+	for i, height := range expected {
+		if !bytes.Equal(locator[i], bc.Blocks[height].Hash) {
+			t.Errorf("Expected locator hash %d to be block %d", i, height)
+		}
+	}
+
+	if index := bc.LocateFork(locator); index != 40 {
+		t.Errorf("Expected fork at the tip, got %d", index)
+	}
+	if index := bc.LocateFork([][]byte{[]byte("unknown")}); index != -1 {
+		t.Errorf("Expected no fork point for unknown hashes, got %d", index)
+	}
+}
+
+func TestHeadersAfter(t *testing.T) {
+	bc := NewBlockchain()
+	for i := 1; i <= 20; i++ {
+		if err := bc.AddBlock(fmt.Sprintf("Block %d", i)); err != nil {
+			t.Fatalf("Failed to add block: %v", err)
+		}
+	}
+
+	// A peer that forked off after block 12 locates the fork from its locator
+	fork := &Blockchain{Blocks: append([]*Block{}, bc.Blocks[:13]...)}
+	for i := 13; i <= 15; i++ {
+		if err := fork.AddBlock(fmt.Sprintf("Fork block %d", i)); err != nil {
+			t.Fatalf("Failed to add fork block: %v", err)
+		}
+	}
+
+	headers := bc.HeadersAfter(fork.BlockLocator(), nil, 100)
+	if len(headers) != 8 {
+		t.Fatalf("Expected 8 headers after the fork, got %d", len(headers))
+	}
+	if !bytes.Equal(headers[0].PrevHash, bc.Blocks[12].Hash) {
+		t.Error("Expected first header to follow the fork point")
+	}
+	for i, header := range headers {
+		if !bytes.Equal(header.Hash(), bc.Blocks[13+i].Hash) {
+			t.Errorf("Expected header %d to hash to block %d", i, 13+i)
+		}
+	}
+
+	if headers := bc.HeadersAfter(fork.BlockLocator(), nil, 3); len(headers) != 3 {
+		t.Errorf("Expected 3 headers with a limit, got %d", len(headers))
+	}
+	if headers := bc.HeadersAfter(fork.BlockLocator(), bc.Blocks[15].Hash, 100); len(headers) != 3 {
+		t.Errorf("Expected headers up to the stop hash, got %d", len(headers))
+	}
+	if headers := bc.HeadersAfter(bc.BlockLocator(), nil, 100); len(headers) != 0 {
+		t.Errorf("Expected no headers for a chain at our tip, got %d", len(headers))
+	}
+	if headers := bc.HeadersAfter(nil, nil, 100); len(headers) != 20 {
+		t.Errorf("Expected headers after genesis without a locator, got %d", len(headers))
+	}
+
+	decoded, err := DecodeHeaders(EncodeHeaders(headers))
+	if err != nil {
+		t.Fatalf("Failed to round-trip headers: %v", err)
+	}
+	for i := range headers {
+		if !bytes.Equal(decoded[i].Hash(), headers[i].Hash()) {
+			t.Errorf("Expected decoded header %d to keep its hash", i)
+		}
+	}
+	if _, err := DecodeHeaders(EncodeHeaders(headers)[:10]); err == nil {
+		t.Error("Expected truncated headers to be rejected")
+	}
+}
+
+func TestHeadersTo(t *testing.T) {
+	bc := NewBlockchain()
+	for i := 1; i <= 5; i++ {
+		if err := bc.AddBlock(fmt.Sprintf("Block %d", i)); err != nil {
+			t.Fatalf("Failed to add block: %v", err)
+		}
+	}
+
+	headers := bc.HeadersTo(3)
+	if len(headers) != 4 {
+		t.Fatalf("Expected 4 headers up to block 3, got %d", len(headers))
+	}
+	for i, header := range headers {
+		if !bytes.Equal(header.Hash(), bc.Blocks[i].Hash) {
+			t.Errorf("Expected header %d to hash to block %d", i, i)
+		}
+	}
+	if headers := bc.HeadersTo(100); len(headers) != 6 {
+		t.Errorf("Expected every header past the tip, got %d", len(headers))
+	}
+	if headers := bc.HeadersTo(-1); len(headers) != 0 {
+		t.Errorf("Expected no headers before genesis, got %d", len(headers))
+	}
+}
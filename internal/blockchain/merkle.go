@@ -0,0 +1,64 @@
+package blockchain
+
+import (
+	"crypto/sha256"
+
+	"github.com/aliexe/blockChain/internal/transactions"
+)
+
+// MerkleRootSize is the size in bytes of a Merkle root
+const MerkleRootSize = sha256.Size
+
+// CalculateMerkleRoot builds a Merkle tree over the given leaves and returns its root.
+// Pairs are combined with double SHA256 and an odd node is paired with itself (like Bitcoin).
+// An empty leaf set yields an all-zero root.
+func CalculateMerkleRoot(leaves [][]byte) []byte {
+	if len(leaves) == 0 {
+		return make([]byte, MerkleRootSize)
+	}
+
+	level := make([][]byte, len(leaves))
+	copy(level, leaves)
+
+	for len(level) > 1 {
+		if len(level)%2 == 1 {
+			level = append(level, level[len(level)-1])
+		}
+
+		next := make([][]byte, 0, len(level)/2)
+		for i := 0; i < len(level); i += 2 {
+			next = append(next, hashMerklePair(level[i], level[i+1]))
+		}
+		level = next
+	}
+
+	root := make([]byte, len(level[0]))
+	copy(root, level[0])
+	return root
+}
+
+// hashMerklePair hashes two child nodes into their parent node
+func hashMerklePair(left, right []byte) []byte {
+	data := make([]byte, 0, len(left)+len(right))
+	data = append(data, left...)
+	data = append(data, right...)
+
+	first := sha256.Sum256(data)
+	second := sha256.Sum256(first[:])
+	return second[:]
+}
+
+// merkleLeaves returns the Merkle leaves committing to the block body.
+// The free-form Data payload, if present, is the first leaf so that
+// data-only blocks remain tamper-evident; each transaction follows in order.
+func merkleLeaves(data []byte, txs []*transactions.Transaction) [][]byte {
+	leaves := make([][]byte, 0, len(txs)+1)
+	if len(data) > 0 {
+		h := sha256.Sum256(data)
+		leaves = append(leaves, h[:])
+	}
+	for _, tx := range txs {
+		leaves = append(leaves, tx.Hash())
+	}
+	return leaves
+}
@@ -3,17 +3,22 @@ package blockchain
 import (
 	"context"
 	"crypto/sha256"
+	"encoding/binary"
 	"encoding/hex"
 	"fmt"
 	"math/big"
-	"strconv"
+	"runtime"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 const (
-	DefaultDifficulty    = 4
-	MaxNonce             = 10000000        // Reasonable limit to prevent infinite loop
-	DefaultMiningTimeout = 5 * time.Second // Default timeout for mining operations
+	DefaultDifficulty = 4
+
+	// hashBatchSize is how many hashes a worker computes between checks for
+	// cancellation and updates of the shared hash counter
+	hashBatchSize = 4096
 
 	// Difficulty adjustment constants
 	TargetBlockTime    = 2 * time.Minute // Target time between blocks
@@ -25,75 +30,196 @@ const (
 type ProofOfWork struct {
 	Block      *Block
 	Target     *big.Int
+	Bits       uint32 // Compact form of Target, committed to in the header
 	Difficulty int
+	Workers    int // Number of mining goroutines, defaults to runtime.NumCPU()
 	cancelCtx  context.Context
 	cancelFunc context.CancelFunc
+
+	hashes    atomic.Uint64 // Hashes computed by the current or last run
+	startTime atomic.Int64  // Start of the current or last run in Unix nanoseconds
+	duration  atomic.Int64  // Length of the last run, zero while mining
+}
+
+// MiningResult describes the outcome of a mining run. Hash is nil when no
+// solution was found.
+type MiningResult struct {
+	Nonce     uint32
+	Timestamp int64 // Header timestamp of the solution, may be rolled forward
+	Hash      []byte
+	Hashes    uint64
+	Duration  time.Duration
 }
 
+// Hashrate returns the average number of hashes per second during the run
+func (r *MiningResult) Hashrate() float64 {
+	if r.Duration <= 0 {
+		return 0
+	}
+	return float64(r.Hashes) / r.Duration.Seconds()
+}
+
+// NewProofOfWork creates a proof of work whose target requires difficulty
+// leading zero hex digits
 func NewProofOfWork(b *Block, difficulty int) *ProofOfWork {
-	target := big.NewInt(1)
-	target.Lsh(target, uint(256-4*difficulty))
+	pow := NewProofOfWorkWithBits(b, BitsForDifficulty(difficulty))
+	pow.Difficulty = difficulty
+	return pow
+}
 
+// NewProofOfWorkWithBits creates a proof of work for a compact target
+func NewProofOfWorkWithBits(b *Block, bits uint32) *ProofOfWork {
 	ctx, cancel := context.WithCancel(context.Background())
 
 	pow := &ProofOfWork{
 		Block:      b,
-		Target:     target,
-		Difficulty: difficulty,
+		Target:     CompactToBig(bits),
+		Bits:       bits,
+		Difficulty: DifficultyForBits(bits),
+		Workers:    runtime.NumCPU(),
 		cancelCtx:  ctx,
 		cancelFunc: cancel,
 	}
 	return pow
 }
 
+// prepareData serializes the block header for the given nonce.
+// The Merkle root is recomputed from the block body.
 func (pow *ProofOfWork) prepareData(nonce uint32) []byte {
-	data := pow.Block.PrevHash
-	data = append(data, pow.Block.Data...)
-	data = append(data, []byte(strconv.FormatInt(pow.Block.Timestamp, 10))...)
-	data = append(data, []byte(strconv.FormatInt(int64(pow.Difficulty), 10))...)
-	data = append(data, []byte(strconv.FormatInt(int64(nonce), 10))...)
-	return data
+	return pow.prepareHeaderData(pow.Block.CalculateMerkleRoot(), nonce)
+}
+
+// prepareHeaderData serializes the block header using a precomputed Merkle root
+func (pow *ProofOfWork) prepareHeaderData(merkleRoot []byte, nonce uint32) []byte {
+	header := pow.Block.Header()
+	header.MerkleRoot = merkleRoot
+	return header.hashData(pow.Bits, nonce)
 }
 
+// Run mines the block and returns the winning nonce and hash, or a nil hash
+// if mining was cancelled. If the nonce space was exhausted and the timestamp
+// rolled forward, the block timestamp is updated to match the solution.
 func (pow *ProofOfWork) Run(ctx context.Context) (uint32, []byte, time.Duration) {
-	var hashInt big.Int
-	var hash [32]byte
-	var nonce uint32
+	result, err := pow.Mine(ctx)
+	if err != nil {
+		return 0, nil, result.Duration
+	}
+	pow.Block.Timestamp = result.Timestamp
+	return result.Nonce, result.Hash, result.Duration
+}
 
+// Mine searches for a valid nonce using a pool of worker goroutines. Worker i
+// of n tries nonces i, i+n, i+2n, ...; when a worker exhausts the 32-bit nonce
+// space it rolls its timestamp forward by one second and starts over, so the
+// workers never hash the same header twice. All workers stop as soon as one
+// finds a solution, ctx is cancelled or Cancel is called.
+func (pow *ProofOfWork) Mine(ctx context.Context) (*MiningResult, error) {
 	startTime := time.Now()
+	pow.hashes.Store(0)
+	pow.startTime.Store(startTime.UnixNano())
+	pow.duration.Store(0)
+
+	workers := pow.Workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	// The body does not change while mining, so hash it only once
+	header := pow.Block.Header()
+	header.MerkleRoot = pow.Block.CalculateMerkleRoot()
+	template, timestampOffset := header.hashTemplate(pow.Bits)
 
 	// Combine contexts for proper cancellation
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
-
-	// Use configurable timeout instead of hardcoded 200ms
-	for nonce = 0; nonce < MaxNonce; nonce++ {
-		// Check for cancellation
+	go func() {
 		select {
-		case <-ctx.Done():
-			return 0, nil, time.Since(startTime)
 		case <-pow.cancelCtx.Done():
-			return 0, nil, time.Since(startTime)
-		default:
-			// Continue mining
+			cancel()
+		case <-ctx.Done():
 		}
+	}()
+
+	found := make(chan *MiningResult, 1)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(worker uint32) {
+			defer wg.Done()
+			if result := pow.mineWorker(ctx, worker, uint32(workers), template, timestampOffset, header.Timestamp); result != nil {
+				select {
+				case found <- result:
+					cancel()
+				default:
+				}
+			}
+		}(uint32(i))
+	}
+	wg.Wait()
+
+	duration := time.Since(startTime)
+	pow.duration.Store(int64(duration))
+	select {
+	case result := <-found:
+		result.Hashes = pow.hashes.Load()
+		result.Duration = duration
+		return result, nil
+	default:
+		return &MiningResult{Hashes: pow.hashes.Load(), Duration: duration}, fmt.Errorf("mining cancelled: %w", context.Cause(ctx))
+	}
+}
 
-		data := pow.prepareData(nonce)
-		hash = sha256.Sum256(data)
-		hashInt.SetBytes(hash[:])
+// mineWorker searches the worker's share of the nonce space until it finds a
+// solution or ctx is done
+func (pow *ProofOfWork) mineWorker(ctx context.Context, worker, workers uint32, template []byte, timestampOffset int, timestamp int64) *MiningResult {
+	data := append([]byte{}, template...)
+	nonceOffset := len(data) - 4
+	var hashInt big.Int
 
-		if hashInt.Cmp(pow.Target) == -1 {
-			duration := time.Since(startTime)
-			return nonce, hash[:], duration
+	nonce := worker
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		default:
 		}
 
-		// Check for timeout
-		if time.Since(startTime) > DefaultMiningTimeout {
-			return 0, nil, time.Since(startTime)
+		for i := 0; i < hashBatchSize; i++ {
+			binary.BigEndian.PutUint32(data[nonceOffset:], nonce)
+			hash := sha256.Sum256(data)
+			hashInt.SetBytes(hash[:])
+			if hashInt.Cmp(pow.Target) == -1 {
+				pow.hashes.Add(uint64(i + 1))
+				return &MiningResult{Nonce: nonce, Timestamp: timestamp, Hash: hash[:]}
+			}
+
+			next := nonce + workers
+			if next < nonce {
+				// Nonce space exhausted: roll the timestamp and start over
+				timestamp++
+				binary.BigEndian.PutUint64(data[timestampOffset:], uint64(timestamp))
+				next = worker
+			}
+			nonce = next
 		}
+		pow.hashes.Add(hashBatchSize)
 	}
-	duration := time.Since(startTime)
-	return 0, nil, duration
+}
+
+// Hashrate returns the hashes per second of the current or last mining run
+func (pow *ProofOfWork) Hashrate() float64 {
+	start := pow.startTime.Load()
+	if start == 0 {
+		return 0
+	}
+	elapsed := time.Duration(pow.duration.Load()).Seconds()
+	if elapsed == 0 {
+		elapsed = time.Since(time.Unix(0, start)).Seconds()
+	}
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(pow.hashes.Load()) / elapsed
 }
 
 // Cancel stops the mining process
@@ -113,10 +239,16 @@ func (pow *ProofOfWork) Validate() bool {
 
 func (pow *ProofOfWork) GetMiningStats() map[string]interface{} {
 	return map[string]interface{}{
-		"difficulty": pow.Difficulty,
-		"target":     pow.Target.String(),
-		"block_data": string(pow.Block.Data),
-		"prev_hash":  hex.EncodeToString(pow.Block.PrevHash),
+		"difficulty":  pow.Difficulty,
+		"target":      pow.Target.String(),
+		"bits":        fmt.Sprintf("%08x", pow.Bits),
+		"block_data":  string(pow.Block.Data),
+		"tx_count":    len(pow.Block.Transactions),
+		"merkle_root": hex.EncodeToString(pow.Block.MerkleRoot),
+		"prev_hash":   hex.EncodeToString(pow.Block.PrevHash),
+		"workers":     pow.Workers,
+		"hashes":      pow.hashes.Load(),
+		"hashrate":    pow.Hashrate(),
 	}
 }
 
@@ -126,8 +258,8 @@ func (pow *ProofOfWork) SetDifficulty(difficulty int) {
 		difficulty = DefaultDifficulty
 	}
 	pow.Difficulty = difficulty
-	pow.Target = big.NewInt(1)
-	pow.Target.Lsh(pow.Target, uint(256-4*difficulty))
+	pow.Bits = BitsForDifficulty(difficulty)
+	pow.Target = CompactToBig(pow.Bits)
 
 	// Create new cancellation context
 	if pow.cancelFunc != nil {
@@ -150,41 +282,30 @@ func NewDifficultyAdjuster(blocks []*Block) *DifficultyAdjuster {
 	}
 }
 
-// CalculateNewDifficulty calculates the new difficulty based on recent block times
+// CalculateNewDifficulty returns the difficulty level of the next target.
 // This ensures stable block production regardless of network hashrate changes
 func (da *DifficultyAdjuster) CalculateNewDifficulty() int {
 	if len(da.blocks) < AdjustmentInterval {
 		return DefaultDifficulty
 	}
+	return DifficultyForBits(da.CalculateNextBits())
+}
 
-	// Get the last AdjustmentInterval blocks
-	startIndex := len(da.blocks) - AdjustmentInterval
-	recentBlocks := da.blocks[startIndex:]
-
-	// Calculate average block time
-	var totalTime time.Duration
-	for i := 1; i < len(recentBlocks); i++ {
-		blockTime := time.Duration(recentBlocks[i].Timestamp - recentBlocks[i-1].Timestamp)
-		totalTime += blockTime
+// CalculateNextBits retargets proportionally to how long the last
+// AdjustmentInterval blocks took compared to TargetBlockTime, changing the
+// target by at most MaxRetargetFactor. The timespan is measured between the
+// median time past at both ends of the interval, so a miner cannot skew it
+// by lying about the timestamp of a single block.
+func (da *DifficultyAdjuster) CalculateNextBits() uint32 {
+	if len(da.blocks) < AdjustmentInterval {
+		return DefaultBits
 	}
 
-	avgBlockTime := totalTime / time.Duration(AdjustmentInterval-1)
-	currentDifficulty := da.blocks[len(da.blocks)-1].Difficulty
-
-	// Adjust difficulty based on average block time
-	// If blocks are too fast, increase difficulty
-	// If blocks are too slow, decrease difficulty
-	newDifficulty := currentDifficulty
-
-	if avgBlockTime > TargetBlockTime*2 {
-		// Blocks are too slow, decrease difficulty
-		newDifficulty = max(MinDifficulty, currentDifficulty-1)
-	} else if avgBlockTime < TargetBlockTime/2 {
-		// Blocks are too fast, increase difficulty
-		newDifficulty = min(MaxDifficulty, currentDifficulty+1)
-	}
+	first := len(da.blocks) - AdjustmentInterval
+	actual := time.Duration(MedianTimePast(da.blocks)-MedianTimePast(da.blocks[:first+1])) * time.Second
+	expected := TargetBlockTime * time.Duration(AdjustmentInterval-1)
 
-	return newDifficulty
+	return RetargetBits(da.blocks[len(da.blocks)-1].Bits, actual, expected, MaxRetargetFactor)
 }
 
 // CalculateNewDifficultyForBlockchain calculates the new difficulty for a blockchain
@@ -1,7 +1,9 @@
 package blockchain
 
 import (
+	"bytes"
 	"context"
+	"encoding/binary"
 	"math/big"
 	"testing"
 	"time"
@@ -432,3 +434,61 @@ func TestCancellableMining(t *testing.T) {
 		t.Errorf("Mining should have been cancelled quickly, but took %v", duration)
 	}
 }
+
+func TestParallelMining(t *testing.T) {
+	block := NewBlock([]byte("parallel mining"), []byte("prevhash"))
+	pow := NewProofOfWork(block, 2)
+	pow.Workers = 4
+
+	result, err := pow.Mine(context.Background())
+	if err != nil {
+		t.Fatalf("Mining failed: %v", err)
+	}
+	if result.Hash == nil || result.Hashes == 0 {
+		t.Errorf("Unexpected mining result: %+v", result)
+	}
+	if result.Hashrate() <= 0 || pow.Hashrate() <= 0 {
+		t.Error("Expected a positive hashrate")
+	}
+
+	block.Timestamp = result.Timestamp
+	block.Nonce = result.Nonce
+	block.Hash = result.Hash
+	if !pow.Validate() {
+		t.Error("Block mined by worker pool should be valid")
+	}
+}
+
+func TestMineStopsOnContextCancel(t *testing.T) {
+	block := NewBlock([]byte("context cancel"), []byte("prevhash"))
+	pow := NewProofOfWork(block, 32) // Unreachable difficulty
+	pow.Workers = 2
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	result, err := pow.Mine(ctx)
+	if err == nil {
+		t.Fatal("Expected mining to be cancelled")
+	}
+	if result.Hash != nil {
+		t.Error("Cancelled mining should not return a hash")
+	}
+	if result.Hashes == 0 {
+		t.Error("Workers should have computed hashes before cancellation")
+	}
+}
+
+func TestHashTemplateMatchesHashData(t *testing.T) {
+	header := &BlockHeader{PrevHash: []byte("prev"), MerkleRoot: []byte("root"), Timestamp: 100}
+	template, offset := header.hashTemplate(3)
+
+	// Patch a rolled timestamp and nonce the way mining workers do
+	binary.BigEndian.PutUint64(template[offset:], 101)
+	binary.BigEndian.PutUint32(template[len(template)-4:], 7)
+
+	header.Timestamp = 101
+	if !bytes.Equal(template, header.hashData(3, 7)) {
+		t.Error("Patched template should match serialized header")
+	}
+}
@@ -0,0 +1,131 @@
+package blockchain
+
+import (
+	"math/big"
+	"time"
+)
+
+// MaxRetargetFactor bounds how much the target may change in one adjustment
+// interval: it is at most multiplied or divided by this factor.
+const MaxRetargetFactor = 4
+
+var (
+	// PowLimit is the easiest allowed target, at MinDifficulty
+	PowLimit = TargetForDifficulty(MinDifficulty)
+	// MinTarget is the hardest allowed target, at MaxDifficulty
+	MinTarget = TargetForDifficulty(MaxDifficulty)
+
+	// DefaultBits is the compact target of DefaultDifficulty
+	DefaultBits = BitsForDifficulty(DefaultDifficulty)
+
+	oneLsh256 = new(big.Int).Lsh(big.NewInt(1), 256)
+)
+
+// CompactToBig expands a compact target (like Bitcoin's nBits) into a big
+// integer. The high byte is the size of the number in bytes and the low three
+// bytes are its most significant bytes. Negative targets decode to zero.
+func CompactToBig(bits uint32) *big.Int {
+	mantissa := bits & 0x007fffff
+	exponent := uint(bits >> 24)
+	if bits&0x00800000 != 0 {
+		return big.NewInt(0)
+	}
+
+	target := big.NewInt(int64(mantissa))
+	if exponent <= 3 {
+		return target.Rsh(target, 8*(3-exponent))
+	}
+	return target.Lsh(target, 8*(exponent-3))
+}
+
+// BigToCompact encodes a non-negative target in compact form, dropping all
+// but its three most significant bytes
+func BigToCompact(target *big.Int) uint32 {
+	if target.Sign() <= 0 {
+		return 0
+	}
+
+	exponent := uint((target.BitLen() + 7) / 8)
+	var mantissa uint32
+	if exponent <= 3 {
+		mantissa = uint32(target.Uint64()) << (8 * (3 - exponent))
+	} else {
+		mantissa = uint32(new(big.Int).Rsh(target, 8*(exponent-3)).Uint64())
+	}
+
+	// The mantissa is signed, so move a set sign bit into the exponent
+	if mantissa&0x00800000 != 0 {
+		mantissa >>= 8
+		exponent++
+	}
+	return uint32(exponent<<24) | mantissa
+}
+
+// TargetForDifficulty returns the target requiring difficulty leading zero
+// hex digits in the block hash
+func TargetForDifficulty(difficulty int) *big.Int {
+	target := big.NewInt(1)
+	return target.Lsh(target, uint(256-4*difficulty))
+}
+
+// BitsForDifficulty returns the compact form of TargetForDifficulty
+func BitsForDifficulty(difficulty int) uint32 {
+	return BigToCompact(TargetForDifficulty(difficulty))
+}
+
+// DifficultyForBits returns the number of leading zero hex digits a hash
+// needs to meet the target, rounded down. It is used for display and for the
+// coarse difficulty limits; consensus uses the exact target.
+func DifficultyForBits(bits uint32) int {
+	target := CompactToBig(bits)
+	if target.Sign() == 0 {
+		return MaxDifficulty
+	}
+	return (257 - target.BitLen()) / 4
+}
+
+// WorkForBits returns the expected number of hashes needed to meet the
+// target, 2^256 / (target + 1)
+func WorkForBits(bits uint32) *big.Int {
+	target := CompactToBig(bits)
+	if target.Sign() == 0 {
+		return big.NewInt(0)
+	}
+	denominator := new(big.Int).Add(target, big.NewInt(1))
+	return new(big.Int).Div(oneLsh256, denominator)
+}
+
+// RetargetBits scales the target by actual/expected timespan. The timespan is
+// clamped so the target changes by at most maxFactor per interval, and the
+// result is kept between MinTarget and PowLimit.
+func RetargetBits(bits uint32, actual, expected time.Duration, maxFactor int64) uint32 {
+	if expected <= 0 {
+		return bits
+	}
+	if maxFactor < 1 {
+		maxFactor = 1
+	}
+
+	if actual < expected/time.Duration(maxFactor) {
+		actual = expected / time.Duration(maxFactor)
+	}
+	if actual > expected*time.Duration(maxFactor) {
+		actual = expected * time.Duration(maxFactor)
+	}
+
+	target := CompactToBig(bits)
+	target.Mul(target, big.NewInt(int64(actual)))
+	target.Div(target, big.NewInt(int64(expected)))
+	return BigToCompact(ClampTarget(target, MinTarget, PowLimit))
+}
+
+// ClampTarget limits target to the range [hardest, easiest]
+func ClampTarget(target, hardest, easiest *big.Int) *big.Int {
+	if target.Cmp(easiest) > 0 {
+		return new(big.Int).Set(easiest)
+	}
+	if target.Cmp(hardest) < 0 {
+		return new(big.Int).Set(hardest)
+	}
+	return target
+}
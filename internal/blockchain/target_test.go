@@ -0,0 +1,90 @@
+package blockchain
+
+import (
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestCompactRoundTrip(t *testing.T) {
+	for difficulty := MinDifficulty; difficulty <= MaxDifficulty; difficulty++ {
+		bits := BitsForDifficulty(difficulty)
+		if CompactToBig(bits).Cmp(TargetForDifficulty(difficulty)) != 0 {
+			t.Errorf("Difficulty %d: compact target %08x does not round trip", difficulty, bits)
+		}
+		if got := DifficultyForBits(bits); got != difficulty {
+			t.Errorf("Expected difficulty %d for bits %08x, got %d", difficulty, bits, got)
+		}
+	}
+
+	// Known values from Bitcoin
+	if bits := BigToCompact(CompactToBig(0x1d00ffff)); bits != 0x1d00ffff {
+		t.Errorf("Expected 1d00ffff, got %08x", bits)
+	}
+	if bits := BigToCompact(big.NewInt(0x80)); bits != 0x02008000 {
+		t.Errorf("Expected sign bit to move into exponent, got %08x", bits)
+	}
+	if CompactToBig(0x01fedcba).Sign() != 0 {
+		t.Error("Expected negative compact target to decode to zero")
+	}
+}
+
+func TestRetargetBitsIsProportional(t *testing.T) {
+	bits := BitsForDifficulty(8)
+	target := CompactToBig(bits)
+	expected := 10 * time.Minute
+
+	// Blocks twice as slow as expected double the target
+	doubled := CompactToBig(RetargetBits(bits, 2*expected, expected, MaxRetargetFactor))
+	if doubled.Cmp(new(big.Int).Mul(target, big.NewInt(2))) != 0 {
+		t.Errorf("Expected target to double, got %s", doubled)
+	}
+
+	// Blocks twice as fast halve it
+	halved := CompactToBig(RetargetBits(bits, expected/2, expected, MaxRetargetFactor))
+	if halved.Cmp(new(big.Int).Div(target, big.NewInt(2))) != 0 {
+		t.Errorf("Expected target to halve, got %s", halved)
+	}
+
+	// Extreme timespans are clamped to the retarget factor
+	clamped := CompactToBig(RetargetBits(bits, 100*expected, expected, MaxRetargetFactor))
+	if clamped.Cmp(new(big.Int).Mul(target, big.NewInt(MaxRetargetFactor))) != 0 {
+		t.Errorf("Expected target to change by at most %dx, got %s", MaxRetargetFactor, clamped)
+	}
+
+	// The target never exceeds the proof-of-work limit
+	if CompactToBig(RetargetBits(BitsForDifficulty(MinDifficulty), 4*expected, expected, MaxRetargetFactor)).Cmp(PowLimit) != 0 {
+		t.Error("Expected target to be capped at the proof-of-work limit")
+	}
+}
+
+func TestWorkForBits(t *testing.T) {
+	easy := WorkForBits(BitsForDifficulty(1))
+	hard := WorkForBits(BitsForDifficulty(2))
+	if new(big.Int).Mul(easy, big.NewInt(16)).Cmp(hard) > 0 {
+		t.Errorf("Expected one difficulty level to be 16x more work: %s vs %s", easy, hard)
+	}
+
+	// Halving the target doubles the work
+	bits := BitsForDifficulty(8)
+	halved := RetargetBits(bits, time.Minute, 2*time.Minute, MaxRetargetFactor)
+	ratio := new(big.Int).Div(WorkForBits(halved), WorkForBits(bits))
+	if ratio.Int64() != 2 {
+		t.Errorf("Expected halved target to double work, got ratio %s", ratio)
+	}
+}
+
+func TestDifficultyAdjusterRetargets(t *testing.T) {
+	blocks := make([]*Block, AdjustmentInterval)
+	for i := range blocks {
+		// Blocks arrive every 30 seconds, four times faster than the target
+		blocks[i] = &Block{Timestamp: int64(i * 30), Bits: BitsForDifficulty(8)}
+	}
+
+	adjuster := NewDifficultyAdjuster(blocks)
+	next := CompactToBig(adjuster.CalculateNextBits())
+	want := new(big.Int).Div(CompactToBig(BitsForDifficulty(8)), big.NewInt(4))
+	if next.Cmp(want) != 0 {
+		t.Errorf("Expected target to shrink 4x, got %s want %s", next, want)
+	}
+}
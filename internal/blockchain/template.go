@@ -0,0 +1,228 @@
+package blockchain
+
+import (
+	"fmt"
+
+	"github.com/aliexe/blockChain/internal/transactions"
+)
+
+// BlockTemplate is a candidate block filled from the mempool and ready for proof of work
+type BlockTemplate struct {
+	Block   *Block
+	Height  int
+	Subsidy transactions.Amount
+	Fees    transactions.Amount
+	Size    int
+}
+
+// ProofOfWork returns a proof of work for the template block at the given difficulty
+func (t *BlockTemplate) ProofOfWork(difficulty int) *ProofOfWork {
+	t.Block.MerkleRoot = t.Block.CalculateMerkleRoot()
+	return NewProofOfWork(t.Block, difficulty)
+}
+
+// BlockAssembler builds block templates from mempool transactions and
+// updates the mempool once a block is accepted
+type BlockAssembler struct {
+	MaxBlockSize int
+	MaxTxCount   int
+
+	chain   *Blockchain
+	mempool *transactions.Mempool
+}
+
+// NewBlockAssembler creates a block assembler. The chain must have a chain
+// state attached so that inputs and fees can be checked against the UTXO set.
+func NewBlockAssembler(chain *Blockchain, mempool *transactions.Mempool, maxBlockSize, maxTxCount int) *BlockAssembler {
+	return &BlockAssembler{
+		MaxBlockSize: maxBlockSize,
+		MaxTxCount:   maxTxCount,
+		chain:        chain,
+		mempool:      mempool,
+	}
+}
+
+// CreateTemplate assembles the next block: the best mempool transactions that
+// fit the size and count limits, are final and spend available, mature outputs, preceded
+// by a coinbase paying the subsidy plus collected fees to minerAddress.
+// Transactions that conflict with an already selected spend are dropped.
+func (ba *BlockAssembler) CreateTemplate(minerAddress string, data []byte) (*BlockTemplate, error) {
+	if err := validateMinerAddress(minerAddress); err != nil {
+		return nil, fmt.Errorf("invalid miner address: %w", err)
+	}
+
+	ba.chain.mu.RLock()
+	chainState := ba.chain.chainState
+	height := len(ba.chain.Blocks)
+	var prevHash []byte
+	if height > 0 {
+		prevHash = ba.chain.Blocks[height-1].Hash
+	}
+	medianTimePast := MedianTimePast(ba.chain.Blocks)
+	ba.chain.mu.RUnlock()
+
+	if chainState == nil {
+		return nil, fmt.Errorf("chain has no chain state attached")
+	}
+	if height == 0 {
+		return nil, fmt.Errorf("no blocks in blockchain")
+	}
+
+	subsidy := BlockSubsidy(height)
+	coinbaseSize := transactions.EstimateTransactionSize(0, 1)
+
+	maxSize := 0
+	if ba.MaxBlockSize > 0 {
+		maxSize = ba.MaxBlockSize - coinbaseSize - len(data)
+		if maxSize <= 0 {
+			return nil, fmt.Errorf("block size limit %d leaves no room for transactions", ba.MaxBlockSize)
+		}
+	}
+	maxCount := 0
+	if ba.MaxTxCount > 0 {
+		maxCount = ba.MaxTxCount - 1
+		if maxCount <= 0 {
+			return nil, fmt.Errorf("block transaction limit %d leaves no room for transactions", ba.MaxTxCount)
+		}
+	}
+
+	candidates := ba.mempool.GetTransactionsForBlock(maxSize, maxCount)
+	selected, fees, err := selectTransactions(candidates, chainState, height)
+	if err != nil {
+		return nil, err
+	}
+
+	reward, err := subsidy.Add(fees)
+	if err != nil {
+		return nil, fmt.Errorf("invalid block reward: %w", err)
+	}
+	coinbase := transactions.NewBlockCoinbaseTransaction(minerAddress, reward, height)
+	txs := make([]*transactions.Transaction, 0, len(selected)+1)
+	txs = append(txs, coinbase)
+	txs = append(txs, selected...)
+
+	block := NewBlockWithTransactions(txs, prevHash)
+	if len(data) > 0 {
+		block.Data = data
+		block.MerkleRoot = block.CalculateMerkleRoot()
+	}
+	// Never timestamp the block before the median time past, even if the
+	// local clock is behind the chain
+	if block.Timestamp < medianTimePast {
+		block.Timestamp = medianTimePast
+	}
+	block.Hash = block.CalculateHash()
+
+	return &BlockTemplate{
+		Block:   block,
+		Height:  height,
+		Subsidy: subsidy,
+		Fees:    fees,
+		Size:    block.Size(),
+	}, nil
+}
+
+// selectTransactions keeps the candidates that apply cleanly, in order, on a
+// scratch copy of the UTXO set. A transaction whose parent comes later in the
+// list is retried until no more progress is made. Transactions that are not
+// final at height are left out. It fails if the fees collected overflow.
+func selectTransactions(candidates []*transactions.Transaction, chainState *ChainState, height int) ([]*transactions.Transaction, transactions.Amount, error) {
+	working := chainState.UTXOSet().Clone()
+
+	// Parents selected into the template confirm in the template block
+	lockCtx := chainState.LockContext()
+	lockCtx.Height = height
+	confirmed := lockCtx.Confirmation
+	inTemplate := make(map[string]bool)
+	lockCtx.Confirmation = func(txID string) (int, int64, bool) {
+		if inTemplate[txID] {
+			return height, lockCtx.MedianTime, true
+		}
+		return confirmed(txID)
+	}
+
+	var selected []*transactions.Transaction
+	var fees transactions.Amount
+	pending := candidates
+
+	for len(pending) > 0 {
+		var deferred []*transactions.Transaction
+		for _, tx := range pending {
+			if tx.IsCoinbase() {
+				continue
+			}
+
+			fee, err := applyTemplateTransaction(working, chainState, tx, lockCtx)
+			if err != nil {
+				deferred = append(deferred, tx)
+				continue
+			}
+
+			if fees, err = fees.Add(fee); err != nil {
+				return nil, 0, fmt.Errorf("invalid template fees: %w", err)
+			}
+			selected = append(selected, tx)
+			inTemplate[tx.ID] = true
+		}
+
+		if len(deferred) == len(pending) {
+			break // Remaining transactions conflict or spend unknown outputs
+		}
+		pending = deferred
+	}
+
+	return selected, fees, nil
+}
+
+// applyTemplateTransaction applies tx to the working set and returns its fee
+func applyTemplateTransaction(working *transactions.UTXOSet, chainState *ChainState, tx *transactions.Transaction, lockCtx transactions.LockContext) (transactions.Amount, error) {
+	if err := tx.CheckLocks(lockCtx); err != nil {
+		return 0, err
+	}
+	for _, input := range tx.Inputs {
+		if !chainState.IsCoinbaseMature(input.TxID, lockCtx.Height) {
+			return 0, fmt.Errorf("input %s:%d spends immature coinbase", input.TxID, input.Index)
+		}
+	}
+
+	spent, err := working.ApplyTransactions([]*transactions.Transaction{tx})
+	if err != nil {
+		return 0, err
+	}
+
+	var amounts []transactions.Amount
+	for _, entry := range spent {
+		amounts = append(amounts, entry.Output.Amount)
+	}
+	inputAmount, err := transactions.SumAmounts(amounts...)
+	if err != nil {
+		working.RevertTransactions([]*transactions.Transaction{tx}, spent)
+		return 0, fmt.Errorf("transaction %s: %w", tx.ID, err)
+	}
+
+	fee, err := inputAmount.Sub(tx.GetOutputAmount())
+	if err != nil {
+		working.RevertTransactions([]*transactions.Transaction{tx}, spent)
+		return 0, fmt.Errorf("transaction %s spends more than its inputs", tx.ID)
+	}
+	return fee, nil
+}
+
+// SubmitBlock appends a mined block to the chain, evicts its transactions from
+// the mempool and revalidates the remaining pool against the new UTXO set.
+// Held transactions that became final are moved into the pool.
+// It returns the IDs of mempool transactions removed as no longer valid.
+func (ba *BlockAssembler) SubmitBlock(block *Block) ([]string, error) {
+	if err := ba.chain.AppendBlock(block); err != nil {
+		return nil, fmt.Errorf("block rejected: %w", err)
+	}
+
+	ba.mempool.RemoveBlockTransactions(ba.chain.GetChainLength()-1, block.Transactions)
+
+	chainState := ba.chain.ChainState()
+	if chainState == nil {
+		return nil, nil
+	}
+	ba.mempool.UpdateLockContext(chainState.LockContext())
+	return ba.mempool.ValidateAndRemoveInvalid(chainState.UTXOSet().ToMap()), nil
+}
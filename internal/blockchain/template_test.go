@@ -0,0 +1,118 @@
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/aliexe/blockChain/internal/transactions"
+)
+
+func TestBlockAssemblerCreateAndSubmit(t *testing.T) {
+	bc := NewBlockchain()
+	cs := NewChainState(nil)
+	cs.CoinbaseMaturity = 0
+	if err := bc.AttachChainState(cs); err != nil {
+		t.Fatalf("Failed to attach chain state: %v", err)
+	}
+
+	miner := newTestKeyPair(t)
+	if _, err := bc.AddBlockWithMining("Block 1", miner.Address, 1); err != nil {
+		t.Fatalf("Failed to mine block: %v", err)
+	}
+	reward := bc.GetLatestBlock().Transactions[0]
+
+	mempool := transactions.NewMempool()
+	utxos := cs.UTXOSet().ToMap()
+
+	// A higher fee spend replaces a conflicting one that signals replacement
+	lowFee := transactions.NewTransaction(
+		[]transactions.TxInput{{TxID: reward.ID, Index: 0, Sequence: transactions.SequenceReplaceable}},
+		[]transactions.TxOutput{{Address: testMiner2, Amount: 49 * transactions.Coin}},
+	)
+	highFee := transactions.NewTransaction(
+		[]transactions.TxInput{{TxID: reward.ID, Index: 0}},
+		[]transactions.TxOutput{{Address: testMiner2, Amount: 45 * transactions.Coin}},
+	)
+	signTestInputs(t, lowFee, miner, reward.Outputs[0])
+	signTestInputs(t, highFee, miner, reward.Outputs[0])
+	if err := mempool.AddTransaction(lowFee, utxos); err != nil {
+		t.Fatalf("Failed to add transaction: %v", err)
+	}
+	if err := mempool.AddTransaction(highFee, utxos); err != nil {
+		t.Fatalf("Failed to add replacement: %v", err)
+	}
+	if _, exists := mempool.GetTransaction(lowFee.ID); exists {
+		t.Error("Expected the replaced spend to leave the mempool")
+	}
+
+	assembler := NewBlockAssembler(bc, mempool, 1_000_000, 100)
+	template, err := assembler.CreateTemplate(testMiner1, nil)
+	if err != nil {
+		t.Fatalf("Failed to create template: %v", err)
+	}
+
+	if template.Height != 2 {
+		t.Errorf("Expected template height 2, got %d", template.Height)
+	}
+	if len(template.Block.Transactions) != 2 {
+		t.Fatalf("Expected coinbase and one transaction, got %d transactions", len(template.Block.Transactions))
+	}
+	if template.Block.Transactions[1].ID != highFee.ID {
+		t.Error("Expected the replacement to be selected")
+	}
+	if template.Fees != 5*transactions.Coin {
+		t.Errorf("Expected fees 5, got %v", template.Fees)
+	}
+
+	coinbase := template.Block.Transactions[0]
+	if !coinbase.IsCoinbase() || coinbase.GetOutputAmount() != BlockSubsidy(2)+5*transactions.Coin {
+		t.Errorf("Expected coinbase to pay subsidy plus fees, got %v", coinbase.GetOutputAmount())
+	}
+
+	template.Block.MineBlock(1)
+	removed, err := assembler.SubmitBlock(template.Block)
+	if err != nil {
+		t.Fatalf("Failed to submit block: %v", err)
+	}
+
+	if bc.GetChainLength() != 3 {
+		t.Errorf("Expected chain length 3, got %d", bc.GetChainLength())
+	}
+	if !mempool.IsEmpty() {
+		t.Errorf("Expected mempool to be empty, got %d transactions", mempool.Size())
+	}
+	if len(removed) != 0 {
+		t.Errorf("Expected no invalid transactions to be removed, got %v", removed)
+	}
+	if !cs.UTXOSet().Exists(coinbase.ID, 0) {
+		t.Error("Expected new coinbase output to be unspent")
+	}
+}
+
+func TestBlockAssemblerLimits(t *testing.T) {
+	bc := NewBlockchain()
+	mempool := transactions.NewMempool()
+
+	if _, err := NewBlockAssembler(bc, mempool, 0, 0).CreateTemplate(testMiner1, nil); err == nil {
+		t.Error("Expected error without chain state")
+	}
+
+	if err := bc.AttachChainState(NewChainState(nil)); err != nil {
+		t.Fatalf("Failed to attach chain state: %v", err)
+	}
+
+	if _, err := NewBlockAssembler(bc, mempool, 0, 1).CreateTemplate(testMiner1, nil); err == nil {
+		t.Error("Expected error when the transaction limit leaves no room")
+	}
+
+	if _, err := NewBlockAssembler(bc, mempool, 10, 0).CreateTemplate(testMiner1, nil); err == nil {
+		t.Error("Expected error when the size limit leaves no room")
+	}
+
+	template, err := NewBlockAssembler(bc, mempool, 0, 0).CreateTemplate(testMiner1, []byte("note"))
+	if err != nil {
+		t.Fatalf("Failed to create template: %v", err)
+	}
+	if string(template.Block.Data) != "note" || !template.Block.HasValidMerkleRoot() {
+		t.Error("Expected template to carry data committed in its merkle root")
+	}
+}
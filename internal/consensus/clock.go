@@ -0,0 +1,112 @@
+package consensus
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// MaxClockSamples is the number of peer time samples kept
+	MaxClockSamples = 200
+	// MinClockSamples is the number of samples needed before adjusting the clock
+	MinClockSamples = 5
+	// MaxClockAdjustment is the largest offset applied to the local clock
+	MaxClockAdjustment = 70 * time.Minute
+)
+
+// NetworkClock is the local clock adjusted by the median offset reported by
+// peers. Each peer contributes one sample, so a single peer cannot move the
+// clock, and offsets beyond MaxClockAdjustment are ignored.
+type NetworkClock struct {
+	mu      sync.RWMutex
+	samples map[string]time.Duration // Offset of each peer's clock from ours
+	order   []string                 // Peers in the order their samples arrived
+	offset  time.Duration
+}
+
+// NewNetworkClock creates a clock with no peer samples
+func NewNetworkClock() *NetworkClock {
+	return &NetworkClock{
+		samples: make(map[string]time.Duration),
+	}
+}
+
+// AddSample records the time reported by a peer. Only the first sample of
+// each peer is used; the oldest sample is dropped once MaxClockSamples is reached.
+func (nc *NetworkClock) AddSample(peerID string, peerTime time.Time) {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+
+	if _, exists := nc.samples[peerID]; exists {
+		return
+	}
+	if len(nc.order) >= MaxClockSamples {
+		delete(nc.samples, nc.order[0])
+		nc.order = nc.order[1:]
+	}
+
+	nc.samples[peerID] = time.Until(peerTime).Round(time.Second)
+	nc.order = append(nc.order, peerID)
+	nc.updateOffsetLocked()
+}
+
+// RemoveSample forgets the sample of a peer, e.g. after it was banned
+func (nc *NetworkClock) RemoveSample(peerID string) {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+
+	if _, exists := nc.samples[peerID]; !exists {
+		return
+	}
+	delete(nc.samples, peerID)
+	for i, id := range nc.order {
+		if id == peerID {
+			nc.order = append(nc.order[:i], nc.order[i+1:]...)
+			break
+		}
+	}
+	nc.updateOffsetLocked()
+}
+
+// updateOffsetLocked recomputes the median offset (assumes lock is held)
+func (nc *NetworkClock) updateOffsetLocked() {
+	if len(nc.samples) < MinClockSamples {
+		nc.offset = 0
+		return
+	}
+
+	offsets := make([]time.Duration, 0, len(nc.samples))
+	for _, offset := range nc.samples {
+		offsets = append(offsets, offset)
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+	median := offsets[len(offsets)/2]
+
+	if median > MaxClockAdjustment || median < -MaxClockAdjustment {
+		fmt.Printf("⚠️  Network time offset %v exceeds %v, check the local clock\n", median, MaxClockAdjustment)
+		nc.offset = 0
+		return
+	}
+	nc.offset = median
+}
+
+// Offset returns the adjustment applied to the local clock
+func (nc *NetworkClock) Offset() time.Duration {
+	nc.mu.RLock()
+	defer nc.mu.RUnlock()
+	return nc.offset
+}
+
+// Now returns the network-adjusted time
+func (nc *NetworkClock) Now() time.Time {
+	return time.Now().Add(nc.Offset())
+}
+
+// SampleCount returns the number of peers that reported their time
+func (nc *NetworkClock) SampleCount() int {
+	nc.mu.RLock()
+	defer nc.mu.RUnlock()
+	return len(nc.samples)
+}
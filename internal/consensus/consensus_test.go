@@ -2,10 +2,14 @@ package consensus
 
 import (
 	"context"
+	"fmt"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/aliexe/blockChain/internal/blockchain"
+	"github.com/aliexe/blockChain/internal/crypto"
+	"github.com/aliexe/blockChain/internal/transactions"
 )
 
 func TestDefaultConsensusRules(t *testing.T) {
@@ -33,7 +37,7 @@ func TestValidateBlock(t *testing.T) {
 	bc := blockchain.NewBlockchain()
 
 	// Add a mined block
-	duration, err := bc.AddBlockWithMining("Test block", "test-miner", 2)
+	duration, err := bc.AddBlockWithMining("Test block", "mxm1qzyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg344kydn", 2)
 	if err != nil {
 		t.Fatalf("Failed to add block with mining: %v", err)
 	}
@@ -59,13 +63,48 @@ func TestValidateBlock(t *testing.T) {
 	}
 }
 
+func TestValidateBlockMerkleRoot(t *testing.T) {
+	rules := DefaultConsensusRules()
+	genesis := blockchain.NewGenesisBlock()
+
+	coinbase := transactions.NewCoinbaseTransaction("mxm1qzyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg344kydn", 50)
+	block := blockchain.NewBlockWithTransactions([]*transactions.Transaction{coinbase}, genesis.Hash)
+	block.MineBlock(1)
+
+	if err := rules.ValidateBlock(block, genesis); err != nil {
+		t.Fatalf("Block validation failed: %v", err)
+	}
+
+	// A body that no longer matches the header must be rejected
+	block.Transactions = append(block.Transactions, transactions.NewCoinbaseTransaction("mxm1qyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg3z6gnz9y", 50))
+	if err := rules.ValidateBlock(block, genesis); err == nil {
+		t.Error("Expected validation to fail for block with mismatched merkle root")
+	}
+}
+
+func TestValidateBlockTransactionIDs(t *testing.T) {
+	rules := DefaultConsensusRules()
+	genesis := blockchain.NewGenesisBlock()
+
+	// The merkle root commits to the forged ID, so only the ID check catches it
+	coinbase := transactions.NewCoinbaseTransaction("mxm1qzyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg344kydn", 50)
+	coinbase.ID = "forged"
+	block := blockchain.NewBlockWithTransactions([]*transactions.Transaction{coinbase}, genesis.Hash)
+	block.MineBlock(1)
+
+	err := rules.ValidateBlock(block, genesis)
+	if err == nil || !strings.Contains(err.Error(), "does not match its contents") {
+		t.Errorf("Expected block with a mismatched transaction ID to be rejected, got %v", err)
+	}
+}
+
 func TestValidateChain(t *testing.T) {
 	rules := DefaultConsensusRules()
 	bc := blockchain.NewBlockchain()
 
 	// Add some blocks
 	for i := 0; i < 5; i++ {
-		_, err := bc.AddBlockWithMining("Test block", "test-miner", 2)
+		_, err := bc.AddBlockWithMining("Test block", "mxm1qzyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg344kydn", 1)
 		if err != nil {
 			t.Fatalf("Failed to add block %d: %v", i, err)
 		}
@@ -78,13 +117,32 @@ func TestValidateChain(t *testing.T) {
 	}
 }
 
+func TestValidateRejectsOffScheduleTarget(t *testing.T) {
+	rules := DefaultConsensusRules()
+	bc := blockchain.NewBlockchain()
+
+	// A harder target than the schedule sets is still off schedule
+	block := blockchain.NewBlock([]byte("Off schedule"), bc.GetLatestBlock().Hash)
+	block.MineBlock(2)
+	if err := rules.ValidateBlockForChain(bc, block); err == nil {
+		t.Error("Expected error for block with a target off the retarget schedule")
+	}
+
+	if err := bc.AppendBlock(block); err != nil {
+		t.Fatalf("Failed to append block: %v", err)
+	}
+	if err := rules.ValidateChain(bc); err == nil {
+		t.Error("Expected chain with an off-schedule target to fail validation")
+	}
+}
+
 func TestCalculateNewDifficulty(t *testing.T) {
 	rules := DefaultConsensusRules()
 	bc := blockchain.NewBlockchain()
 
 	// Add enough blocks for difficulty adjustment
 	for i := 0; i < rules.AdjustmentInterval; i++ {
-		_, err := bc.AddBlockWithMining("Test block", "test-miner", 2)
+		_, err := bc.AddBlockWithMining("Test block", "mxm1qzyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg344kydn", 2)
 		if err != nil {
 			t.Fatalf("Failed to add block %d: %v", i, err)
 		}
@@ -111,7 +169,7 @@ func TestSelectBestChain(t *testing.T) {
 
 	// Add blocks to chain A
 	for i := 0; i < 5; i++ {
-		_, err := chainA.AddBlockWithMining("Chain A block", "miner-a", 2)
+		_, err := chainA.AddBlockWithMining("Chain A block", "mxm1q42424242424242424242424242424242fk6jyq", 1)
 		if err != nil {
 			t.Fatalf("Failed to add block to chain A: %v", err)
 		}
@@ -119,7 +177,7 @@ func TestSelectBestChain(t *testing.T) {
 
 	// Add blocks to chain B (more work)
 	for i := 0; i < 7; i++ {
-		_, err := chainB.AddBlockWithMining("Chain B block", "miner-b", 2)
+		_, err := chainB.AddBlockWithMining("Chain B block", "mxm1qhwamhwamhwamhwamhwamhwamhwamhwammgd03j", 1)
 		if err != nil {
 			t.Fatalf("Failed to add block to chain B: %v", err)
 		}
@@ -162,7 +220,7 @@ func TestSyncWithPeer(t *testing.T) {
 	defer cancel()
 
 	// Add a block first
-	_, err := bc.AddBlockWithMining("Test block", "test-miner", 2)
+	_, err := bc.AddBlockWithMining("Test block", "mxm1qzyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg344kydn", 2)
 	if err != nil {
 		t.Fatalf("Failed to add block: %v", err)
 	}
@@ -262,7 +320,7 @@ func TestValidateDuringPartition(t *testing.T) {
 	pm := NewPartitionManager(bc, rules)
 
 	// Add a block
-	_, err := bc.AddBlockWithMining("Test block", "test-miner", 2)
+	_, err := bc.AddBlockWithMining("Test block", "mxm1qzyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg344kydn", 2)
 	if err != nil {
 		t.Fatalf("Failed to add block: %v", err)
 	}
@@ -506,7 +564,7 @@ func TestValidateNewBlock(t *testing.T) {
 	ncm := NewNetworkConsensusManager(bc)
 
 	// Add a block
-	_, err := bc.AddBlockWithMining("Test block", "test-miner", 2)
+	_, err := bc.AddBlockWithMining("Test block", "mxm1qzyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg344kydn", 1)
 	if err != nil {
 		t.Fatalf("Failed to add block: %v", err)
 	}
@@ -519,7 +577,7 @@ func TestValidateNewBlock(t *testing.T) {
 
 	// Create and mine a new valid block that would follow the latest block
 	newBlock := blockchain.NewBlock([]byte("New block"), latestBlock.Hash)
-	newBlock.MineBlock(2)
+	newBlock.MineBlock(1)
 
 	// Validate the new block
 	err = ncm.ValidateNewBlock(newBlock)
@@ -529,10 +587,197 @@ func TestValidateNewBlock(t *testing.T) {
 
 	// Test with invalid block (wrong previous hash)
 	invalidBlock := blockchain.NewBlock([]byte("Invalid block"), []byte("wrong hash"))
-	invalidBlock.MineBlock(2)
+	invalidBlock.MineBlock(1)
 
 	err = ncm.ValidateNewBlock(invalidBlock)
 	if err == nil {
 		t.Error("Expected error for invalid block with wrong previous hash")
 	}
-}
\ No newline at end of file
+}
+func TestNewChainStateUsesCoinbaseMaturity(t *testing.T) {
+	rules := DefaultConsensusRules()
+	rules.CoinbaseMaturity = 3
+
+	chainState := rules.NewChainState(nil)
+	if chainState.CoinbaseMaturity != 3 {
+		t.Errorf("Expected coinbase maturity 3, got %d", chainState.CoinbaseMaturity)
+	}
+
+	miner, err := crypto.NewKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+	bc := blockchain.NewBlockchain()
+	if _, err := bc.AddBlockWithMining("Test block", miner.Address, 1); err != nil {
+		t.Fatalf("Failed to add block with mining: %v", err)
+	}
+	coinbase := bc.GetLatestBlock().Transactions[0]
+
+	// Spending the coinbase in the very next block violates maturity
+	spend := transactions.NewTransaction(
+		[]transactions.TxInput{{TxID: coinbase.ID, Index: 0}},
+		[]transactions.TxOutput{{Address: "mxm1qyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg3z6gnz9y", Amount: 10}},
+	)
+	if err := spend.SignTransaction(0, miner.PrivateKey, coinbase.Outputs); err != nil {
+		t.Fatalf("Failed to sign spend: %v", err)
+	}
+	block := blockchain.NewBlockWithTransactions([]*transactions.Transaction{spend}, bc.GetLatestBlock().Hash)
+	block.MineBlock(1)
+	if err := bc.AppendBlock(block); err != nil {
+		t.Fatalf("Failed to append block: %v", err)
+	}
+
+	err = rules.ValidateChain(bc)
+	if err == nil || !strings.Contains(err.Error(), "immature") {
+		t.Errorf("Expected chain spending an immature coinbase to be invalid, got %v", err)
+	}
+}
+
+func TestCalculateNextBitsClampsToRules(t *testing.T) {
+	rules := DefaultConsensusRules()
+	rules.MaxDifficulty = 3
+	bc := blockchain.NewBlockchain()
+
+	// Blocks mined back to back are far faster than the target block time
+	for i := 0; i < rules.AdjustmentInterval; i++ {
+		if _, err := bc.AddBlockWithMining("Fast block", "mxm1qzyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg344kydn", 2); err != nil {
+			t.Fatalf("Failed to add block %d: %v", i, err)
+		}
+	}
+
+	bits, err := rules.CalculateNextBits(bc)
+	if err != nil {
+		t.Fatalf("Failed to calculate next bits: %v", err)
+	}
+
+	// The target shrinks by at most the retarget factor and stays within MaxDifficulty
+	latest := blockchain.CompactToBig(bc.GetLatestBlock().Bits)
+	next := blockchain.CompactToBig(bits)
+	if next.Cmp(latest) >= 0 {
+		t.Errorf("Expected fast blocks to lower the target")
+	}
+	if next.Cmp(blockchain.TargetForDifficulty(rules.MaxDifficulty)) < 0 {
+		t.Errorf("Expected target to be clamped to MaxDifficulty")
+	}
+}
+
+func TestValidateBlockTimestampRules(t *testing.T) {
+	rules := DefaultConsensusRules()
+	now := time.Now().Unix()
+
+	// Median of 11 timestamps one minute apart is the sixth block
+	blocks := make([]*blockchain.Block, blockchain.MedianTimeSpan)
+	for i := range blocks {
+		blocks[i] = &blockchain.Block{Timestamp: now - int64(len(blocks)-i)*60}
+	}
+	median := blockchain.MedianTimePast(blocks)
+	if median != blocks[5].Timestamp {
+		t.Fatalf("Expected median time past %d, got %d", blocks[5].Timestamp, median)
+	}
+
+	// Earlier than the previous block but not than the median is allowed
+	if err := rules.ValidateBlockTimestamp(&blockchain.Block{Timestamp: median + 1}, median); err != nil {
+		t.Errorf("Expected timestamp after the median to be valid: %v", err)
+	}
+	if err := rules.ValidateBlockTimestamp(&blockchain.Block{Timestamp: median - 1}, median); err == nil {
+		t.Error("Expected timestamp before the median to be rejected")
+	}
+
+	future := time.Now().Add(rules.MaxFutureDrift + time.Minute).Unix()
+	if err := rules.ValidateBlockTimestamp(&blockchain.Block{Timestamp: future}, median); err == nil {
+		t.Error("Expected timestamp too far in the future to be rejected")
+	}
+}
+
+func TestNetworkClock(t *testing.T) {
+	clock := NewNetworkClock()
+
+	// Too few samples leave the clock unadjusted
+	for i := 0; i < MinClockSamples-1; i++ {
+		clock.AddSample(fmt.Sprintf("peer-%d", i), time.Now().Add(10*time.Minute))
+	}
+	if clock.Offset() != 0 {
+		t.Errorf("Expected no offset with %d samples, got %v", clock.SampleCount(), clock.Offset())
+	}
+
+	// A repeated peer does not count twice
+	clock.AddSample("peer-0", time.Now().Add(10*time.Minute))
+	if clock.SampleCount() != MinClockSamples-1 {
+		t.Errorf("Expected %d samples, got %d", MinClockSamples-1, clock.SampleCount())
+	}
+
+	// The median ignores a single outlier
+	clock.AddSample("outlier", time.Now().Add(60*time.Minute))
+	if offset := clock.Offset(); offset < 9*time.Minute || offset > 11*time.Minute {
+		t.Errorf("Expected offset of about 10 minutes, got %v", offset)
+	}
+
+	// Offsets beyond the maximum adjustment are ignored
+	far := NewNetworkClock()
+	for i := 0; i < MinClockSamples; i++ {
+		far.AddSample(fmt.Sprintf("peer-%d", i), time.Now().Add(3*time.Hour))
+	}
+	if far.Offset() != 0 {
+		t.Errorf("Expected large offset to be ignored, got %v", far.Offset())
+	}
+}
+
+func TestValidateHeaders(t *testing.T) {
+	bc := blockchain.NewBlockchain()
+	for i := 0; i < 3; i++ {
+		if _, err := bc.AddBlockWithMining(fmt.Sprintf("Block %d", i), "mxm1qzyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg344kydn", 1); err != nil {
+			t.Fatalf("Failed to mine block: %v", err)
+		}
+	}
+	genesis, _ := bc.GetBlockByIndex(0)
+	ancestors := bc.HeadersTo(0)
+	headers := bc.HeadersAfter([][]byte{genesis.Hash}, nil, 10)
+
+	rules := DefaultConsensusRules()
+	if err := rules.ValidateHeaders(ancestors, headers); err != nil {
+		t.Fatalf("Expected valid headers, got %v", err)
+	}
+	if err := rules.ValidateHeaders(nil, headers); err == nil {
+		t.Error("Expected error for headers without ancestors")
+	}
+
+	// Headers must link to the block they follow and to each other
+	if err := rules.ValidateHeaders(bc.HeadersTo(1), headers); err == nil {
+		t.Error("Expected error for headers not following the previous block")
+	}
+	if err := rules.ValidateHeaders(ancestors, []*blockchain.BlockHeader{headers[0], headers[2]}); err == nil {
+		t.Error("Expected error for a gap in the headers")
+	}
+
+	// Changing a header invalidates its proof of work
+	forged := *headers[1]
+	forged.Timestamp++
+	for forged.IsValidProof() {
+		forged.Nonce++
+	}
+	if err := rules.ValidateHeaders(ancestors, []*blockchain.BlockHeader{headers[0], &forged}); err == nil {
+		t.Error("Expected error for invalid proof of work")
+	}
+
+	// A header may not be timestamped before the median time past
+	early := *headers[2]
+	early.Timestamp = genesis.Timestamp - 60
+	for !early.IsValidProof() {
+		early.Nonce++
+	}
+	if err := rules.ValidateHeaders(ancestors, []*blockchain.BlockHeader{headers[0], headers[1], &early}); err == nil ||
+		!strings.Contains(err.Error(), "median time past") {
+		t.Errorf("Expected error for a header before the median time past, got %v", err)
+	}
+
+	// Headers must carry the target the retarget schedule sets
+	rules.MinDifficulty = 30
+	if err := rules.ValidateHeaders(ancestors, headers); err == nil {
+		t.Error("Expected error for target below minimum difficulty")
+	}
+	rules = DefaultConsensusRules()
+	rules.AdjustmentInterval = 3
+	if err := rules.ValidateHeaders(ancestors, headers); err == nil || !strings.Contains(err.Error(), "header 2 has target") {
+		t.Errorf("Expected the first retargeted header to be rejected, got %v", err)
+	}
+}
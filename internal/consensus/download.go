@@ -0,0 +1,330 @@
+package consensus
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/aliexe/blockChain/internal/blockchain"
+	"github.com/aliexe/blockChain/internal/network"
+)
+
+// Reputation changes applied to peers serving block downloads
+const (
+	downloadRangeReward         = 1
+	downloadStallPenalty        = -1
+	downloadInvalidBlockPenalty = -10
+)
+
+// downloadPeer is a peer blocks are downloaded from
+type downloadPeer struct {
+	session  *syncSession
+	inFlight int // ranges requested and not yet received
+	stalls   int
+	dropped  bool
+}
+
+// blockRange is a run of consecutive blocks requested from one peer at a time
+type blockRange struct {
+	start, end int // header indexes, end exclusive
+	missing    int
+	peer       *downloadPeer // peer the range is requested from, nil if none
+	stalledBy  *downloadPeer // last peer that failed to deliver it
+	deadline   time.Time
+}
+
+// blockArrival is a block received from a download peer
+type blockArrival struct {
+	peer *downloadPeer
+	msg  *network.Message
+}
+
+// downloadScheduler downloads the blocks of a validated header chain from
+// several peers at once. The headers are split into ranges of BlockSize
+// blocks, each requested from the least busy peer with fewer than
+// MaxConcurrentRequests ranges in flight. Only ranges within a window ahead
+// of the first block not yet delivered are requested, so a slow peer cannot
+// make the others buffer the rest of the chain. A range not received within
+// Timeout is requested from another peer, and a peer stalling RetryAttempts
+// times is no longer used. A peer sending a malformed block is dropped at
+// once and the block requested from another peer. Blocks are delivered in
+// header order; as a delivered block matches its header, every peer would
+// serve the same one, so a block that is rejected when delivered aborts the
+// download and penalizes the peer that supplied the headers.
+type downloadScheduler struct {
+	sm       *SyncManager
+	headers  []*blockchain.BlockHeader
+	config   SyncConfig
+	peers    []*downloadPeer
+	ranges   []*blockRange
+	wanted   map[string]int // block hash -> header index
+	received []*blockchain.Block
+	next     int // index of the first block not yet delivered
+	arrivals chan blockArrival
+	lastErr  error // last invalid block received, reported if no peers are left
+}
+
+// newDownloadScheduler creates a scheduler downloading the blocks of
+// headers from the peers of sessions. The first session supplied headers.
+func newDownloadScheduler(sm *SyncManager, sessions []*syncSession, headers []*blockchain.BlockHeader, config SyncConfig) *downloadScheduler {
+	ds := &downloadScheduler{
+		sm:       sm,
+		headers:  headers,
+		config:   config,
+		wanted:   make(map[string]int, len(headers)),
+		received: make([]*blockchain.Block, len(headers)),
+		arrivals: make(chan blockArrival, 64),
+	}
+	for _, session := range sessions {
+		ds.peers = append(ds.peers, &downloadPeer{session: session})
+	}
+	for i, header := range headers {
+		ds.wanted[string(header.Hash())] = i
+	}
+	for start := 0; start < len(headers); start += config.BlockSize {
+		end := syncMin(start+config.BlockSize, len(headers))
+		ds.ranges = append(ds.ranges, &blockRange{start: start, end: end, missing: end - start})
+	}
+	return ds
+}
+
+// run downloads the blocks, passing each to deliver in order. run fails
+// once a block is rejected by deliver or no peers are left.
+func (ds *downloadScheduler) run(ctx context.Context, deliver func(*blockchain.Block) error) error {
+	stop := make(chan struct{})
+	defer close(stop)
+	for _, peer := range ds.peers {
+		go ds.forward(peer, stop)
+	}
+
+	ticker := time.NewTicker(ds.config.Timeout / 4)
+	defer ticker.Stop()
+
+	for ds.next < len(ds.headers) {
+		ds.assign()
+		if ds.activePeers() == 0 {
+			if ds.lastErr != nil {
+				return fmt.Errorf("no peers left to download blocks %d to %d from: %w", ds.next, len(ds.headers)-1, ds.lastErr)
+			}
+			return fmt.Errorf("no peers left to download blocks %d to %d from", ds.next, len(ds.headers)-1)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case arrival := <-ds.arrivals:
+			ds.receive(arrival)
+			if err := ds.deliverInOrder(deliver); err != nil {
+				return err
+			}
+		case <-ticker.C:
+			ds.checkStalls(time.Now())
+		}
+	}
+	return nil
+}
+
+// forward passes the blocks a peer sends to the scheduler until stop is
+// closed
+func (ds *downloadScheduler) forward(peer *downloadPeer, stop chan struct{}) {
+	for {
+		select {
+		case msg := <-peer.session.responses:
+			if msg.Type != network.MessageTypeNewBlock {
+				continue
+			}
+			select {
+			case ds.arrivals <- blockArrival{peer: peer, msg: msg}:
+			case <-stop:
+				return
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// assign requests the unassigned ranges within the window from peers with
+// room in their own window
+func (ds *downloadScheduler) assign() {
+	first := ds.next / ds.config.BlockSize
+	window := ds.config.MaxConcurrentRequests * len(ds.peers)
+	last := syncMin(first+window, len(ds.ranges))
+
+	for _, r := range ds.ranges[first:last] {
+		if r.missing == 0 || r.peer != nil {
+			continue
+		}
+		peer := ds.pickPeer(r)
+		if peer == nil {
+			return // Every peer is busy
+		}
+		if err := ds.request(peer, r); err != nil {
+			fmt.Printf("⚠️  Dropping download peer %s: %v\n", peer.session.peerAddr, err)
+			ds.drop(peer)
+		}
+	}
+}
+
+// pickPeer returns the least busy peer with room for another range,
+// avoiding the peer that last stalled on r while others are available
+func (ds *downloadScheduler) pickPeer(r *blockRange) *downloadPeer {
+	var best *downloadPeer
+	for _, peer := range ds.peers {
+		if peer.dropped || peer.inFlight >= ds.config.MaxConcurrentRequests {
+			continue
+		}
+		if best == nil || (best == r.stalledBy && peer != r.stalledBy) ||
+			(peer != r.stalledBy && peer.inFlight < best.inFlight) {
+			best = peer
+		}
+	}
+	return best
+}
+
+// request asks a peer for the blocks of a range not received yet
+func (ds *downloadScheduler) request(peer *downloadPeer, r *blockRange) error {
+	vectors := make([]network.InvVector, 0, r.missing)
+	for i := r.start; i < r.end; i++ {
+		if i >= ds.next && ds.received[i] == nil {
+			vectors = append(vectors, network.InvVector{
+				Type: network.InvTypeBlock,
+				Hash: hex.EncodeToString(ds.headers[i].Hash()),
+			})
+		}
+	}
+
+	msg, err := network.NewGetDataMessage(vectors)
+	if err != nil {
+		return fmt.Errorf("failed to create get data message: %w", err)
+	}
+	if err := peer.session.client.Send(msg); err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+
+	r.peer = peer
+	r.deadline = time.Now().Add(ds.config.Timeout)
+	peer.inFlight++
+	return nil
+}
+
+// receive stores a block matching one of the headers, whichever peer sent
+// it. A peer sending a block that cannot be parsed or does not match its
+// hash is rejected.
+func (ds *downloadScheduler) receive(arrival blockArrival) {
+	var block blockchain.Block
+	if err := block.UnmarshalBinary(arrival.msg.Payload); err != nil {
+		ds.reject(arrival.peer, fmt.Errorf("failed to parse block: %w", err))
+		return
+	}
+	if string(block.CalculateHash()) != string(block.Hash) {
+		ds.reject(arrival.peer, fmt.Errorf("block %x does not match its hash", block.Hash))
+		return
+	}
+	i, ok := ds.wanted[string(block.Hash)]
+	if !ok || i < ds.next || ds.received[i] != nil {
+		return
+	}
+	ds.received[i] = &block
+
+	r := ds.ranges[i/ds.config.BlockSize]
+	r.missing--
+	if r.missing == 0 {
+		if r.peer != nil {
+			r.peer.inFlight--
+			r.peer = nil
+		}
+		ds.sm.updatePeerReputation(arrival.peer.session, downloadRangeReward)
+	}
+
+	ds.sm.progressMu.Lock()
+	ds.sm.progress.ReceivedBlocks++
+	ds.sm.progress.BytesReceived += estimateBlocksSize([]*blockchain.Block{&block})
+	ds.sm.progress.BlocksPerSecond = ds.sm.blocksPerSecondLocked()
+	ds.sm.progress.LastUpdateTime = time.Now()
+	ds.sm.progressMu.Unlock()
+}
+
+// deliverInOrder passes the consecutive blocks received from the first
+// block not yet delivered onwards to deliver. A block deliver rejects
+// invalidates the header chain it matches, so the peer that supplied the
+// headers is penalized and the error returned.
+func (ds *downloadScheduler) deliverInOrder(deliver func(*blockchain.Block) error) error {
+	for ds.next < len(ds.received) && ds.received[ds.next] != nil {
+		i := ds.next
+		block := ds.received[i]
+		ds.received[i] = nil
+
+		if err := deliver(block); err != nil {
+			source := ds.peers[0].session
+			fmt.Printf("❌ Block %d of the headers from %s is invalid: %v\n", i, source.peerAddr, err)
+			ds.sm.updatePeerReputation(source, downloadInvalidBlockPenalty)
+			return fmt.Errorf("block %d of the headers from peer %s rejected: %w", i, source.peerAddr, err)
+		}
+		ds.next++
+	}
+	return nil
+}
+
+// reject drops a peer that sent an invalid block and penalizes it
+func (ds *downloadScheduler) reject(peer *downloadPeer, err error) {
+	fmt.Printf("⚠️  Dropping download peer %s: %v\n", peer.session.peerAddr, err)
+	ds.lastErr = fmt.Errorf("peer %s: %w", peer.session.peerAddr, err)
+	ds.sm.updatePeerReputation(peer.session, downloadInvalidBlockPenalty)
+	ds.drop(peer)
+}
+
+// release marks blocks of a range as missing again and frees the range, so
+// its missing blocks are requested from the next peer with room
+func (ds *downloadScheduler) release(r *blockRange, blocks int) {
+	r.missing += blocks
+	if r.peer != nil {
+		r.peer.inFlight--
+		r.peer = nil
+	}
+}
+
+// checkStalls releases the ranges whose peers missed their deadline, so
+// they are requested from another peer, and penalizes those peers
+func (ds *downloadScheduler) checkStalls(now time.Time) {
+	for _, r := range ds.ranges {
+		if r.peer == nil || now.Before(r.deadline) {
+			continue
+		}
+		peer := r.peer
+		fmt.Printf("⚠️  Peer %s stalled on blocks %d to %d\n", peer.session.peerAddr, r.start, r.end-1)
+		peer.inFlight--
+		peer.stalls++
+		r.peer = nil
+		r.stalledBy = peer
+
+		ds.sm.updatePeerReputation(peer.session, downloadStallPenalty)
+		if peer.stalls >= ds.config.RetryAttempts {
+			ds.drop(peer)
+		}
+	}
+}
+
+// drop stops using a peer and releases its ranges
+func (ds *downloadScheduler) drop(peer *downloadPeer) {
+	peer.dropped = true
+	for _, r := range ds.ranges {
+		if r.peer == peer {
+			r.peer = nil
+			r.stalledBy = peer
+		}
+	}
+	peer.inFlight = 0
+}
+
+// activePeers returns the number of peers still used
+func (ds *downloadScheduler) activePeers() int {
+	count := 0
+	for _, peer := range ds.peers {
+		if !peer.dropped {
+			count++
+		}
+	}
+	return count
+}
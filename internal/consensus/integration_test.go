@@ -1,10 +1,16 @@
 package consensus
 
 import (
+	"context"
 	"fmt"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/aliexe/blockChain/internal/blockchain"
+	"github.com/aliexe/blockChain/internal/crypto"
+	"github.com/aliexe/blockChain/internal/network"
+	"github.com/aliexe/blockChain/internal/transactions"
 )
 
 // TestMultiNodeConsensus tests consensus across multiple nodes
@@ -18,8 +24,8 @@ func TestMultiNodeConsensus(t *testing.T) {
 	for i := 0; i < 3; i++ {
 		_, err := bc1.AddBlockWithMining(
 			fmt.Sprintf("Block %d from node1", i),
-			"node1",
-			2,
+			"mxm1qzyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg344kydn",
+			1,
 		)
 		if err != nil {
 			t.Fatalf("Failed to mine block %d: %v", i, err)
@@ -67,12 +73,12 @@ func TestMultiNodeConsensus(t *testing.T) {
 	}
 
 	// Add different blocks to create a fork
-	_, err := bc4.AddBlockWithMining("Fork block A", "miner-a", 2)
+	_, err := bc4.AddBlockWithMining("Fork block A", "mxm1q42424242424242424242424242424242fk6jyq", 2)
 	if err != nil {
 		t.Fatalf("Failed to mine fork block A: %v", err)
 	}
 
-	_, err = bc5.AddBlockWithMining("Fork block B", "miner-b", 2)
+	_, err = bc5.AddBlockWithMining("Fork block B", "mxm1qhwamhwamhwamhwamhwamhwamhwamhwammgd03j", 2)
 	if err != nil {
 		t.Fatalf("Failed to mine fork block B: %v", err)
 	}
@@ -117,12 +123,12 @@ func TestForkResolution(t *testing.T) {
 	}
 
 	// Mine different blocks on each chain (creating a fork)
-	_, err := bc1.AddBlockWithMining("Fork block A", "miner-a", 2)
+	_, err := bc1.AddBlockWithMining("Fork block A", "mxm1q42424242424242424242424242424242fk6jyq", 2)
 	if err != nil {
 		t.Fatalf("Failed to mine fork block A: %v", err)
 	}
 
-	_, err = bc2.AddBlockWithMining("Fork block B", "miner-b", 2)
+	_, err = bc2.AddBlockWithMining("Fork block B", "mxm1qhwamhwamhwamhwamhwamhwamhwamhwammgd03j", 2)
 	if err != nil {
 		t.Fatalf("Failed to mine fork block B: %v", err)
 	}
@@ -180,7 +186,7 @@ func TestPartitionRecovery(t *testing.T) {
 	for i := 0; i < 2; i++ {
 		_, err := bc1.AddBlockWithMining(
 			fmt.Sprintf("Partition block %d", i),
-			"node1",
+			"mxm1qzyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg344kydn",
 			2,
 		)
 		if err != nil {
@@ -214,4 +220,762 @@ func TestPartitionRecovery(t *testing.T) {
 	if bestChain.GetChainLength() != 5 {
 		t.Errorf("Expected best chain to have 5 blocks, got %d", bestChain.GetChainLength())
 	}
-}
\ No newline at end of file
+}
+// relayNode is a node with a copy of a chain, a mempool and a listening
+// server
+type relayNode struct {
+	ncm     *NetworkConsensusManager
+	mempool *transactions.Mempool
+	server  *network.Server
+	getData atomic.Int32 // GET_DATA messages received
+}
+
+func newRelayNode(t *testing.T, chainData []byte) *relayNode {
+	t.Helper()
+
+	bc := blockchain.NewBlockchain()
+	if err := bc.FromJSON(chainData); err != nil {
+		t.Fatalf("Failed to copy chain: %v", err)
+	}
+	cs := blockchain.NewChainState(nil)
+	cs.CoinbaseMaturity = 0
+	if err := bc.AttachChainState(cs); err != nil {
+		t.Fatalf("Failed to attach chain state: %v", err)
+	}
+
+	node := &relayNode{
+		ncm:     NewNetworkConsensusManager(bc),
+		mempool: transactions.NewMempool(),
+	}
+	node.ncm.SetMempool(node.mempool)
+	node.server = network.NewServer("127.0.0.1", 0, func(peer *network.Peer, msg *network.Message) {
+		if msg.Type == network.MessageTypeGetData {
+			node.getData.Add(1)
+		}
+		node.ncm.HandleMessage(peer, msg)
+	})
+	if err := node.server.Start(); err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+	node.ncm.SetNetworkServer(node.server)
+	return node
+}
+
+// connect makes the node an outbound peer of another node
+func (n *relayNode) connect(t *testing.T, other *relayNode) *network.Client {
+	t.Helper()
+
+	client := network.NewClient(other.server.Addr(), n.ncm.GetMessageHandler())
+	if err := client.Connect(); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	return client
+}
+
+// TestTransactionRelay tests that a transaction submitted on one node reaches
+// a node two hops away through INV and GET_DATA
+func TestTransactionRelay(t *testing.T) {
+	miner, err := crypto.NewKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+	bc := blockchain.NewBlockchain()
+	if _, err := bc.AddBlockWithMining("Funding block", miner.Address, 1); err != nil {
+		t.Fatalf("Failed to mine block: %v", err)
+	}
+	reward := bc.GetLatestBlock().Transactions[0]
+	chainData, err := bc.ToJSON()
+	if err != nil {
+		t.Fatalf("Failed to encode chain: %v", err)
+	}
+
+	// node1 <- node2 <- node3, each arrow an outbound connection
+	node1 := newRelayNode(t, chainData)
+	defer node1.server.Stop()
+	node2 := newRelayNode(t, chainData)
+	defer node2.server.Stop()
+	node3 := newRelayNode(t, chainData)
+	defer node3.server.Stop()
+
+	client2 := node2.connect(t, node1)
+	defer client2.Close()
+	client3 := node3.connect(t, node2)
+	defer client3.Close()
+
+	// Wait for connections to establish
+	time.Sleep(100 * time.Millisecond)
+
+	tx := transactions.NewTransaction(
+		[]transactions.TxInput{{TxID: reward.ID, Index: 0}},
+		[]transactions.TxOutput{{Address: "mxm1qyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg3z6gnz9y", Amount: 49 * transactions.Coin}},
+	)
+	if err := tx.SignTransaction(0, miner.PrivateKey, reward.Outputs); err != nil {
+		t.Fatalf("Failed to sign transaction: %v", err)
+	}
+	if err := node1.ncm.SubmitTransaction(tx); err != nil {
+		t.Fatalf("Failed to submit transaction: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for node3.mempool.Size() == 0 && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	for i, node := range []*relayNode{node1, node2, node3} {
+		if _, exists := node.mempool.GetTransaction(tx.ID); !exists {
+			t.Errorf("Expected node%d to have the transaction", i+1)
+		}
+	}
+
+	// A transaction already seen is not admitted or relayed again
+	if err := node2.ncm.HandleTransaction(tx, nil); err != nil {
+		t.Errorf("Expected seen transaction to be ignored, got %v", err)
+	}
+	if node2.mempool.Size() != 1 {
+		t.Errorf("Expected 1 transaction on node2, got %d", node2.mempool.Size())
+	}
+}
+
+// TestHandleTransactionRejectsMismatchedID tests that a relayed transaction
+// must carry the ID of its contents
+func TestHandleTransactionRejectsMismatchedID(t *testing.T) {
+	bc := blockchain.NewBlockchain()
+	if err := bc.AttachChainState(blockchain.NewChainState(nil)); err != nil {
+		t.Fatalf("Failed to attach chain state: %v", err)
+	}
+	ncm := NewNetworkConsensusManager(bc)
+	mempool := transactions.NewMempool()
+	ncm.SetMempool(mempool)
+
+	tx := transactions.NewTransaction(
+		[]transactions.TxInput{{TxID: "prev", Index: 0}},
+		[]transactions.TxOutput{{Address: "mxm1qyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg3z6gnz9y", Amount: 1}},
+	)
+	tx.ID = "forged"
+
+	if err := ncm.HandleTransaction(tx, nil); err == nil {
+		t.Error("Expected error for mismatched transaction ID")
+	}
+	if !mempool.IsEmpty() {
+		t.Error("Expected mempool to stay empty")
+	}
+}
+
+// TestHandleTransactionVerifiesScripts tests that a relayed transaction is
+// only admitted with valid unlocking scripts, spending confirmed outputs or
+// outputs of mempool transactions, even when the mempool does not validate
+func TestHandleTransactionVerifiesScripts(t *testing.T) {
+	owner, err := crypto.NewKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+	bc := blockchain.NewBlockchain()
+	if err := bc.AttachChainState(blockchain.NewChainState(nil)); err != nil {
+		t.Fatalf("Failed to attach chain state: %v", err)
+	}
+	if _, err := bc.AddBlockWithMining("Funding block", owner.Address, 1); err != nil {
+		t.Fatalf("Failed to mine block: %v", err)
+	}
+	reward := bc.GetLatestBlock().Transactions[0]
+
+	ncm := NewNetworkConsensusManager(bc)
+	config := transactions.DefaultMempoolConfig()
+	config.ValidateTx = false
+	mempool := transactions.NewMempoolWithConfig(config)
+	ncm.SetMempool(mempool)
+
+	parent := transactions.NewTransaction(
+		[]transactions.TxInput{{TxID: reward.ID, Index: 0}},
+		[]transactions.TxOutput{{Address: owner.Address, Amount: 49 * transactions.Coin}},
+	)
+	if err := ncm.HandleTransaction(parent, nil); err == nil {
+		t.Error("Expected unsigned transaction to be rejected")
+	}
+
+	parent = transactions.NewTransaction(
+		[]transactions.TxInput{{TxID: reward.ID, Index: 0}},
+		[]transactions.TxOutput{{Address: owner.Address, Amount: 48 * transactions.Coin}},
+	)
+	if err := parent.SignTransaction(0, owner.PrivateKey, reward.Outputs); err != nil {
+		t.Fatalf("Failed to sign transaction: %v", err)
+	}
+	if err := ncm.HandleTransaction(parent, nil); err != nil {
+		t.Fatalf("Expected signed transaction to be accepted: %v", err)
+	}
+
+	// The child spends the output of its unconfirmed parent
+	child := transactions.NewTransaction(
+		[]transactions.TxInput{{TxID: parent.ID, Index: 0}},
+		[]transactions.TxOutput{{Address: "mxm1qyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg3z6gnz9y", Amount: 47 * transactions.Coin}},
+	)
+	if err := ncm.HandleTransaction(child, nil); err == nil {
+		t.Error("Expected unsigned child to be rejected")
+	}
+
+	child = transactions.NewTransaction(
+		[]transactions.TxInput{{TxID: parent.ID, Index: 0}},
+		[]transactions.TxOutput{{Address: "mxm1qyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg3z6gnz9y", Amount: 46 * transactions.Coin}},
+	)
+	if err := child.SignTransaction(0, owner.PrivateKey, parent.Outputs); err != nil {
+		t.Fatalf("Failed to sign transaction: %v", err)
+	}
+	if err := ncm.HandleTransaction(child, nil); err != nil {
+		t.Fatalf("Expected signed child to be accepted: %v", err)
+	}
+	if mempool.Size() != 2 {
+		t.Errorf("Expected 2 transactions in the mempool, got %d", mempool.Size())
+	}
+}
+
+// TestHandshakeRecordsPeerChain tests that the chain a peer advertises in its
+// VERSION message is recorded for sync
+func TestHandshakeRecordsPeerChain(t *testing.T) {
+	bc := blockchain.NewBlockchain()
+	if _, err := bc.AddBlockWithMining("Block 1", "mxm1qzyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg344kydn", 1); err != nil {
+		t.Fatalf("Failed to mine block: %v", err)
+	}
+	chainData, err := bc.ToJSON()
+	if err != nil {
+		t.Fatalf("Failed to encode chain: %v", err)
+	}
+	node1 := newRelayNode(t, chainData)
+	defer node1.server.Stop()
+
+	emptyData, err := blockchain.NewBlockchain().ToJSON()
+	if err != nil {
+		t.Fatalf("Failed to encode chain: %v", err)
+	}
+	node2 := newRelayNode(t, emptyData)
+	defer node2.server.Stop()
+	client := node2.connect(t, node1)
+	defer client.Close()
+
+	deadline := time.Now().Add(3 * time.Second)
+	for len(node2.ncm.GetPeerInfo()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	peers := node2.ncm.GetPeerInfo()
+	info, exists := peers["127.0.0.1"]
+	if !exists {
+		t.Fatalf("Expected node1 to be recorded, got %v", peers)
+	}
+	if info.ChainHeight != 1 {
+		t.Errorf("Expected advertised height 1, got %d", info.ChainHeight)
+	}
+	height, work := node1.ncm.ChainInfo()
+	if height != 1 || info.Work != work {
+		t.Errorf("Expected work %s, got %s", work, info.Work)
+	}
+}
+
+// mineBlocks mines blocks at the targets set by the default retarget
+// schedule onto a copy of chainData and returns the encoded result
+func mineBlocks(t *testing.T, chainData []byte, label string, count int) []byte {
+	t.Helper()
+
+	bc := blockchain.NewBlockchain()
+	if err := bc.FromJSON(chainData); err != nil {
+		t.Fatalf("Failed to copy chain: %v", err)
+	}
+	rules := DefaultConsensusRules()
+	for i := 0; i < count; i++ {
+		height := bc.GetChainLength()
+		coinbase := transactions.NewBlockCoinbaseTransaction("mxm1qzyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg344kydn", blockchain.BlockSubsidy(height), height)
+		block := blockchain.NewBlockWithTransactions([]*transactions.Transaction{coinbase}, bc.GetLatestBlock().Hash)
+		block.Data = []byte(fmt.Sprintf("%s %d", label, i))
+
+		bits, err := rules.CalculateNextBits(bc)
+		if err != nil {
+			t.Fatalf("Failed to calculate target: %v", err)
+		}
+		if _, err := block.MineBlockWithBits(context.Background(), bits); err != nil {
+			t.Fatalf("Failed to mine block: %v", err)
+		}
+		if err := bc.AppendBlock(block); err != nil {
+			t.Fatalf("Failed to append block: %v", err)
+		}
+	}
+	data, err := bc.ToJSON()
+	if err != nil {
+		t.Fatalf("Failed to encode chain: %v", err)
+	}
+	return data
+}
+
+// TestHeadersFirstSync tests that a node behind a peer catches up by
+// downloading its headers and then its blocks over one connection
+func TestHeadersFirstSync(t *testing.T) {
+	baseData, err := blockchain.NewBlockchain().ToJSON()
+	if err != nil {
+		t.Fatalf("Failed to encode chain: %v", err)
+	}
+	node1 := newRelayNode(t, mineBlocks(t, baseData, "Block", 12))
+	defer node1.server.Stop()
+	node2 := newRelayNode(t, baseData)
+	defer node2.server.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := node2.ncm.ForceSync(ctx, node1.server.Addr()); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+
+	chain1 := node1.ncm.syncManager.localChain
+	chain2 := node2.ncm.syncManager.localChain
+	if chain2.GetChainLength() != chain1.GetChainLength() {
+		t.Fatalf("Expected %d blocks, got %d", chain1.GetChainLength(), chain2.GetChainLength())
+	}
+	if string(chain2.GetLatestBlock().Hash) != string(chain1.GetLatestBlock().Hash) {
+		t.Error("Expected both nodes to share the same tip")
+	}
+
+	progress := node2.ncm.GetSyncProgress()
+	if progress.TotalBlocks != 12 || progress.ReceivedBlocks != 12 || progress.CurrentHeight != 12 {
+		t.Errorf("Unexpected progress: %+v", progress)
+	}
+
+	// A node already up to date has nothing to download
+	if err := node2.ncm.ForceSync(ctx, node1.server.Addr()); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if chain2.GetChainLength() != chain1.GetChainLength() {
+		t.Errorf("Expected chain to stay at %d blocks, got %d", chain1.GetChainLength(), chain2.GetChainLength())
+	}
+}
+
+// TestHeadersFirstSyncCapsHeaders tests that a sync accepts at most
+// MaxHeaders headers and leaves the rest of the peer's chain to the next one
+func TestHeadersFirstSyncCapsHeaders(t *testing.T) {
+	baseData, err := blockchain.NewBlockchain().ToJSON()
+	if err != nil {
+		t.Fatalf("Failed to encode chain: %v", err)
+	}
+	node1 := newRelayNode(t, mineBlocks(t, baseData, "Block", 12))
+	defer node1.server.Stop()
+	node2 := newRelayNode(t, baseData)
+	defer node2.server.Stop()
+
+	config := DefaultSyncConfig()
+	config.MaxHeaders = 5
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	chain2 := node2.ncm.syncManager.localChain
+	for _, expected := range []int{6, 11, 13} {
+		if err := node2.ncm.syncManager.SyncWithPeers(ctx, []string{node1.server.Addr()}, config); err != nil {
+			t.Fatalf("Sync failed: %v", err)
+		}
+		if chain2.GetChainLength() != expected {
+			t.Fatalf("Expected %d blocks, got %d", expected, chain2.GetChainLength())
+		}
+	}
+}
+
+// TestHeadersFirstSyncReorg tests that a node on a competing branch
+// reorganizes to a peer's branch with more work, and not to one with less
+func TestHeadersFirstSyncReorg(t *testing.T) {
+	baseData, err := blockchain.NewBlockchain().ToJSON()
+	if err != nil {
+		t.Fatalf("Failed to encode chain: %v", err)
+	}
+	baseData = mineBlocks(t, baseData, "Common block", 2)
+
+	node1 := newRelayNode(t, mineBlocks(t, baseData, "Branch A", 3))
+	defer node1.server.Stop()
+	node2 := newRelayNode(t, mineBlocks(t, baseData, "Branch B", 1))
+	defer node2.server.Stop()
+
+	chain1 := node1.ncm.syncManager.localChain
+	chain2 := node2.ncm.syncManager.localChain
+	tip1 := chain1.GetLatestBlock().Hash
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// The shorter branch does not replace the longer one
+	if err := node1.ncm.ForceSync(ctx, node2.server.Addr()); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if string(chain1.GetLatestBlock().Hash) != string(tip1) {
+		t.Error("Expected node1 to keep its branch")
+	}
+
+	if err := node2.ncm.ForceSync(ctx, node1.server.Addr()); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if chain2.GetChainLength() != 6 {
+		t.Fatalf("Expected 6 blocks after reorg, got %d", chain2.GetChainLength())
+	}
+	if string(chain2.GetLatestBlock().Hash) != string(tip1) {
+		t.Error("Expected node2 to switch to node1's branch")
+	}
+}
+
+// TestHandleNewBlockResolvesFork tests that a block on a competing branch
+// with more work makes the node sync with the peer that sent it, without
+// holding the consensus lock while it waits on the peer
+func TestHandleNewBlockResolvesFork(t *testing.T) {
+	baseData, err := blockchain.NewBlockchain().ToJSON()
+	if err != nil {
+		t.Fatalf("Failed to encode chain: %v", err)
+	}
+	node1 := newRelayNode(t, mineBlocks(t, baseData, "Branch A", 3))
+	defer node1.server.Stop()
+	node2 := newRelayNode(t, mineBlocks(t, baseData, "Branch B", 1))
+	defer node2.server.Stop()
+
+	// The peer serves node1's chain, but only once node2's consensus lock
+	// can be taken while node2 syncs with it
+	var lockFree atomic.Bool
+	peer := network.NewServer("127.0.0.1", 0, func(peer *network.Peer, msg *network.Message) {
+		if msg.Type == network.MessageTypeGetHeaders {
+			done := make(chan struct{})
+			go func() {
+				node2.ncm.SetMempool(node2.mempool)
+				close(done)
+			}()
+			select {
+			case <-done:
+				lockFree.Store(true)
+			case <-time.After(2 * time.Second):
+			}
+		}
+		node1.ncm.HandleMessage(peer, msg)
+	})
+	if err := peer.Start(); err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+	defer peer.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	tip := node1.ncm.syncManager.localChain.GetLatestBlock()
+	if err := node2.ncm.HandleNewBlock(ctx, tip, peer.Addr()); err != nil {
+		t.Fatalf("Failed to handle fork block: %v", err)
+	}
+
+	if !lockFree.Load() {
+		t.Error("Expected the consensus lock to be released while syncing the fork")
+	}
+	if string(node2.ncm.syncManager.localChain.GetLatestBlock().Hash) != string(tip.Hash) {
+		t.Error("Expected node2 to switch to the branch with more work")
+	}
+}
+
+// TestParallelBlockDownload tests that blocks are downloaded from every peer
+// and appended in order
+func TestParallelBlockDownload(t *testing.T) {
+	baseData, err := blockchain.NewBlockchain().ToJSON()
+	if err != nil {
+		t.Fatalf("Failed to encode chain: %v", err)
+	}
+	fullData := mineBlocks(t, baseData, "Block", 12)
+	node1 := newRelayNode(t, fullData)
+	defer node1.server.Stop()
+	node3 := newRelayNode(t, fullData)
+	defer node3.server.Stop()
+	node2 := newRelayNode(t, baseData)
+	defer node2.server.Stop()
+	behind := newRelayNode(t, baseData)
+	defer behind.server.Stop()
+
+	config := DefaultSyncConfig()
+	config.BlockSize = 2
+	config.MaxConcurrentRequests = 2
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	peers := []string{node1.server.Addr(), node3.server.Addr(), behind.server.Addr()}
+	if err := node2.ncm.syncManager.SyncWithPeers(ctx, peers, config); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+
+	chain1 := node1.ncm.syncManager.localChain
+	chain2 := node2.ncm.syncManager.localChain
+	if chain2.GetChainLength() != chain1.GetChainLength() {
+		t.Fatalf("Expected %d blocks, got %d", chain1.GetChainLength(), chain2.GetChainLength())
+	}
+	if string(chain2.GetLatestBlock().Hash) != string(chain1.GetLatestBlock().Hash) {
+		t.Error("Expected both nodes to share the same tip")
+	}
+	if node1.getData.Load() == 0 || node3.getData.Load() == 0 {
+		t.Errorf("Expected both peers to serve blocks, got %d and %d requests",
+			node1.getData.Load(), node3.getData.Load())
+	}
+	if behind.getData.Load() != 0 {
+		t.Errorf("Expected the peer without the branch not to be asked for blocks, got %d requests", behind.getData.Load())
+	}
+	if progress := node2.ncm.GetSyncProgress(); progress.DownloadPeers != 2 {
+		t.Errorf("Expected 2 download peers, got %d", progress.DownloadPeers)
+	}
+
+	// Only MaxDownloadPeers peers are used
+	node4 := newRelayNode(t, baseData)
+	defer node4.server.Stop()
+	config.MaxDownloadPeers = 1
+	if err := node4.ncm.syncManager.SyncWithPeers(ctx, peers, config); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if progress := node4.ncm.GetSyncProgress(); progress.DownloadPeers != 1 {
+		t.Errorf("Expected 1 download peer, got %d", progress.DownloadPeers)
+	}
+}
+
+// TestBlockDownloadReassignsStalls tests that ranges requested from a peer
+// that announces the branch but never sends its blocks are requested from
+// another peer, and that the silent peer loses reputation
+func TestBlockDownloadReassignsStalls(t *testing.T) {
+	baseData, err := blockchain.NewBlockchain().ToJSON()
+	if err != nil {
+		t.Fatalf("Failed to encode chain: %v", err)
+	}
+	node1 := newRelayNode(t, mineBlocks(t, baseData, "Block", 6))
+	defer node1.server.Stop()
+	node2 := newRelayNode(t, baseData)
+	defer node2.server.Stop()
+
+	silent := network.NewServer("127.0.0.1", 0, func(peer *network.Peer, msg *network.Message) {
+		if msg.Type != network.MessageTypeGetHeaders {
+			return
+		}
+		locator, stopHash, err := network.ParseGetHeadersMessage(msg)
+		if err != nil {
+			return
+		}
+		headers := node1.ncm.HandleGetHeaders(locator, stopHash)
+		peer.Send(network.NewMessage(network.MessageTypeHeaders, blockchain.EncodeHeaders(headers)))
+	})
+	if err := silent.Start(); err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+	defer silent.Stop()
+
+	discovery := network.NewDiscovery(node2.server, []string{silent.Addr()})
+	discovery.Start()
+	defer discovery.Stop()
+	node2.ncm.SetDiscovery(discovery)
+	before := discovery.GetKnownPeers()[silent.Addr()]
+	if before == nil {
+		t.Fatal("Expected the silent peer to be known")
+	}
+
+	config := DefaultSyncConfig()
+	config.BlockSize = 2
+	config.Timeout = 400 * time.Millisecond
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	peers := []string{node1.server.Addr(), silent.Addr()}
+	if err := node2.ncm.syncManager.SyncWithPeers(ctx, peers, config); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+
+	if length := node2.ncm.syncManager.localChain.GetChainLength(); length != 7 {
+		t.Fatalf("Expected 7 blocks, got %d", length)
+	}
+	after := discovery.GetKnownPeers()[silent.Addr()]
+	if after == nil || after.Score >= before.Score {
+		t.Errorf("Expected the silent peer to lose reputation, had %d", before.Score)
+	}
+}
+
+// TestBlockDownloadDropsInvalidBlocks tests that a peer sending malformed
+// blocks is dropped and loses reputation, both by address and by node
+// identity, while the blocks are downloaded from another peer
+func TestBlockDownloadDropsInvalidBlocks(t *testing.T) {
+	baseData, err := blockchain.NewBlockchain().ToJSON()
+	if err != nil {
+		t.Fatalf("Failed to encode chain: %v", err)
+	}
+	node1 := newRelayNode(t, mineBlocks(t, baseData, "Block", 6))
+	defer node1.server.Stop()
+	node2 := newRelayNode(t, baseData)
+	defer node2.server.Stop()
+
+	// The liar announces the branch but answers every request for its
+	// blocks with garbage
+	liar := network.NewServer("127.0.0.1", 0, func(peer *network.Peer, msg *network.Message) {
+		switch msg.Type {
+		case network.MessageTypeGetHeaders:
+			locator, stopHash, err := network.ParseGetHeadersMessage(msg)
+			if err != nil {
+				return
+			}
+			headers := node1.ncm.HandleGetHeaders(locator, stopHash)
+			peer.Send(network.NewMessage(network.MessageTypeHeaders, blockchain.EncodeHeaders(headers)))
+		case network.MessageTypeGetData:
+			peer.Send(network.NewMessage(network.MessageTypeNewBlock, []byte("not a block")))
+		}
+	})
+	liarKey, err := network.NewNodeKey()
+	if err != nil {
+		t.Fatalf("Failed to create node key: %v", err)
+	}
+	liarConfig := liar.GetHandshakeConfig()
+	liarConfig.NodeKey = liarKey
+	liar.SetHandshakeConfig(liarConfig)
+	if err := liar.Start(); err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+	defer liar.Stop()
+
+	discovery := network.NewDiscovery(node2.server, []string{liar.Addr()})
+	discovery.Start()
+	defer discovery.Stop()
+	node2.ncm.SetDiscovery(discovery)
+	before := discovery.GetKnownPeers()[liar.Addr()]
+	if before == nil {
+		t.Fatal("Expected the liar to be known")
+	}
+
+	config := DefaultSyncConfig()
+	config.BlockSize = 2
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	peers := []string{node1.server.Addr(), liar.Addr()}
+	if err := node2.ncm.syncManager.SyncWithPeers(ctx, peers, config); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if length := node2.ncm.syncManager.localChain.GetChainLength(); length != 7 {
+		t.Fatalf("Expected 7 blocks, got %d", length)
+	}
+
+	after := discovery.GetKnownPeers()[liar.Addr()]
+	if after == nil || after.Score >= before.Score {
+		t.Errorf("Expected the liar to lose reputation, had %d", before.Score)
+	}
+	node := discovery.GetNodeReputations()[liarKey.ID()]
+	if node == nil || node.Score >= 100 {
+		t.Errorf("Expected the liar's node identity to lose reputation, got %+v", node)
+	}
+}
+
+// TestDownloadSchedulerAbortsOnRejectedBlock tests that a block rejected on
+// delivery aborts the download instead of being requested again, and keeps
+// the peer that sent it, as the block matches the headers it was asked for
+func TestDownloadSchedulerAbortsOnRejectedBlock(t *testing.T) {
+	bc := blockchain.NewBlockchain()
+	for i := 0; i < 4; i++ {
+		if _, err := bc.AddBlockWithMining(fmt.Sprintf("Block %d", i), "mxm1qzyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg344kydn", 1); err != nil {
+			t.Fatalf("Failed to mine block: %v", err)
+		}
+	}
+	genesis, _ := bc.GetBlockByIndex(0)
+	headers := bc.HeadersAfter([][]byte{genesis.Hash}, nil, 10)
+
+	newSession := func(addr string) *syncSession {
+		return &syncSession{
+			peerAddr:  addr,
+			client:    network.NewClient(addr, nil),
+			responses: make(chan *network.Message),
+			done:      make(chan struct{}),
+		}
+	}
+	config := DefaultSyncConfig()
+	config.BlockSize = 2
+	sm := NewSyncManager(blockchain.NewBlockchain())
+	ds := newDownloadScheduler(sm, []*syncSession{newSession("peer-a"), newSession("peer-b")}, headers, config)
+	peerB := ds.peers[1]
+
+	arrive := func(peer *downloadPeer, index int) {
+		block, err := bc.GetBlockByIndex(index + 1)
+		if err != nil {
+			t.Fatalf("Failed to get block: %v", err)
+		}
+		data, err := block.MarshalBinary()
+		if err != nil {
+			t.Fatalf("Failed to encode block: %v", err)
+		}
+		ds.receive(blockArrival{peer: peer, msg: network.NewMessage(network.MessageTypeNewBlock, data)})
+	}
+
+	// Block 1 is rejected
+	delivered := 0
+	deliver := func(block *blockchain.Block) error {
+		if string(block.Hash) == string(headers[1].Hash()) {
+			return fmt.Errorf("invalid block")
+		}
+		delivered++
+		return nil
+	}
+
+	arrive(peerB, 0)
+	arrive(peerB, 1)
+	if err := ds.deliverInOrder(deliver); err == nil {
+		t.Fatal("Expected the rejected block to abort the download")
+	}
+	if delivered != 1 || ds.next != 1 {
+		t.Errorf("Expected only block 0 delivered, next %d, delivered %d", ds.next, delivered)
+	}
+	if ds.ranges[0].missing != 0 {
+		t.Errorf("Expected the rejected block not to be requested again, missing %d", ds.ranges[0].missing)
+	}
+	if peerB.dropped {
+		t.Error("Expected the peer that sent the block matching its header to be kept")
+	}
+}
+
+// TestBlockDownloadAbortsInvalidBranch tests that a branch whose headers
+// are valid but whose blocks break consensus is abandoned once an invalid
+// block is delivered, and the peer that supplied it loses reputation
+func TestBlockDownloadAbortsInvalidBranch(t *testing.T) {
+	baseData, err := blockchain.NewBlockchain().ToJSON()
+	if err != nil {
+		t.Fatalf("Failed to encode chain: %v", err)
+	}
+
+	// The forger's chain has a block whose coinbase claims too much, mined
+	// at the target its header must carry
+	forged := blockchain.NewBlockchain()
+	if err := forged.FromJSON(mineBlocks(t, baseData, "Block", 2)); err != nil {
+		t.Fatalf("Failed to copy chain: %v", err)
+	}
+	height := forged.GetChainLength()
+	coinbase := transactions.NewBlockCoinbaseTransaction("mxm1qzyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg344kydn", blockchain.BlockSubsidy(height)+1, height)
+	block := blockchain.NewBlockWithTransactions([]*transactions.Transaction{coinbase}, forged.GetLatestBlock().Hash)
+	bits, err := DefaultConsensusRules().CalculateNextBits(forged)
+	if err != nil {
+		t.Fatalf("Failed to calculate target: %v", err)
+	}
+	if _, err := block.MineBlockWithBits(context.Background(), bits); err != nil {
+		t.Fatalf("Failed to mine block: %v", err)
+	}
+	if err := forged.AppendBlock(block); err != nil {
+		t.Fatalf("Failed to append block: %v", err)
+	}
+
+	forgerNCM := NewNetworkConsensusManager(forged)
+	forger := network.NewServer("127.0.0.1", 0, forgerNCM.HandleMessage)
+	if err := forger.Start(); err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+	defer forger.Stop()
+	forgerNCM.SetNetworkServer(forger)
+
+	node := newRelayNode(t, baseData)
+	defer node.server.Stop()
+	discovery := network.NewDiscovery(node.server, []string{forger.Addr()})
+	discovery.Start()
+	defer discovery.Stop()
+	node.ncm.SetDiscovery(discovery)
+	before := discovery.GetKnownPeers()[forger.Addr()]
+	if before == nil {
+		t.Fatal("Expected the forger to be known")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := node.ncm.syncManager.SyncWithPeers(ctx, []string{forger.Addr()}, DefaultSyncConfig()); err == nil {
+		t.Fatal("Expected sync of the invalid branch to fail")
+	}
+	if length := node.ncm.syncManager.localChain.GetChainLength(); length != 3 {
+		t.Errorf("Expected the 2 valid blocks to be kept, got %d blocks", length)
+	}
+
+	after := discovery.GetKnownPeers()[forger.Addr()]
+	if after == nil || after.Score >= before.Score {
+		t.Errorf("Expected the forger to lose reputation, had %d", before.Score)
+	}
+}
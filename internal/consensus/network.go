@@ -2,21 +2,31 @@ package consensus
 
 import (
 	"context"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/aliexe/blockChain/internal/blockchain"
 	"github.com/aliexe/blockChain/internal/network"
+	"github.com/aliexe/blockChain/internal/transactions"
 )
 
+// InvRequestTimeout is how long a requested inventory item is waited for
+// before it may be requested from another peer
+const InvRequestTimeout = 30 * time.Second
+
 // NetworkConsensusManager integrates consensus with the network layer
 type NetworkConsensusManager struct {
 	syncManager      *SyncManager
 	consensusRules   *ConsensusRules
 	partitionManager *PartitionManager
 	networkServer    *network.Server
+	mempool          *transactions.Mempool
+	seen             *network.SeenFilter // inventory already processed
+	requested        *network.SeenFilter // inventory requested with GET_DATA
 	mu               sync.RWMutex
 	peers            map[string]*PeerInfo
 	peerMu           sync.RWMutex
@@ -54,10 +64,16 @@ func DefaultNetworkConfig() NetworkConfig {
 func NewNetworkConsensusManager(localChain *blockchain.Blockchain) *NetworkConsensusManager {
 	rules := DefaultConsensusRules()
 
+	syncManager := NewSyncManager(localChain)
+	syncManager.rules = rules
+	syncManager.clock = rules.Clock
+
 	return &NetworkConsensusManager{
-		syncManager:      NewSyncManager(localChain),
+		syncManager:      syncManager,
 		consensusRules:   rules,
 		partitionManager: NewPartitionManager(localChain, rules),
+		seen:             network.NewSeenFilter(network.DefaultSeenFilterSize, network.DefaultSeenFilterTTL),
+		requested:        network.NewSeenFilter(network.DefaultSeenFilterSize, InvRequestTimeout),
 		peers:            make(map[string]*PeerInfo),
 	}
 }
@@ -68,8 +84,36 @@ func (ncm *NetworkConsensusManager) SetNetworkServer(server *network.Server) {
 	defer ncm.mu.Unlock()
 
 	ncm.networkServer = server
+	ncm.syncManager.SetNetworkServer(server)
 	// Register this manager as the message handler for the network server
 	// This enables the network layer to route incoming messages to consensus logic
+
+	// Advertise the local chain in the handshake with new peers
+	config := server.GetHandshakeConfig()
+	config.ChainInfo = ncm.ChainInfo
+	server.SetHandshakeConfig(config)
+}
+
+// ChainInfo returns the height and total work of the local chain, as
+// advertised in VERSION messages
+func (ncm *NetworkConsensusManager) ChainInfo() (int64, string) {
+	localChain := ncm.syncManager.localChain
+	return int64(localChain.GetChainLength() - 1), localChain.TotalWork(0).String()
+}
+
+// SetDiscovery sets the peer discovery service. Its known peers serve block
+// downloads along with the best peer, and their reputation reflects how
+// well they do.
+func (ncm *NetworkConsensusManager) SetDiscovery(discovery *network.Discovery) {
+	ncm.syncManager.SetDiscovery(discovery)
+}
+
+// SetMempool sets the mempool that relayed transactions are admitted to
+func (ncm *NetworkConsensusManager) SetMempool(mempool *transactions.Mempool) {
+	ncm.mu.Lock()
+	defer ncm.mu.Unlock()
+
+	ncm.mempool = mempool
 }
 
 // GetMessageHandler returns the message handler function for network integration
@@ -83,10 +127,19 @@ func (ncm *NetworkConsensusManager) HandleMessage(peer *network.Peer, msg *netwo
 	peerAddr := peer.GetInfo().Address
 
 	switch msg.Type {
+	case network.MessageTypeVersion:
+		// Record the chain the peer advertised when the handshake completed
+		info, err := network.ParseVersionMessage(msg)
+		if err != nil {
+			fmt.Printf("❌ Failed to parse version message from %s: %v\n", peerAddr, err)
+			return
+		}
+		ncm.UpdatePeerInfo(peerAddr, int(info.BestHeight), info.TotalWork)
+
 	case network.MessageTypeNewBlock:
 		// Handle new block received from peer
 		var block blockchain.Block
-		if err := json.Unmarshal(msg.Payload, &block); err != nil {
+		if err := block.UnmarshalBinary(msg.Payload); err != nil {
 			fmt.Printf("❌ Failed to unmarshal block from %s: %v\n", peerAddr, err)
 			return
 		}
@@ -96,6 +149,50 @@ func (ncm *NetworkConsensusManager) HandleMessage(peer *network.Peer, msg *netwo
 			return
 		}
 
+		// Announce the block to the other peers once it is in our chain
+		vector := network.InvVector{Type: network.InvTypeBlock, Hash: hex.EncodeToString(block.Hash)}
+		ncm.requested.Remove(vector.Key())
+		if ncm.syncManager.localChain.GetBlockByHash(block.Hash) != nil && ncm.seen.Add(vector.Key()) {
+			ncm.announce(vector, peer)
+		}
+
+	case network.MessageTypeTransaction:
+		// Handle transaction relayed by a peer
+		var tx transactions.Transaction
+		if err := tx.UnmarshalBinary(msg.Payload); err != nil {
+			fmt.Printf("❌ Failed to unmarshal transaction from %s: %v\n", peerAddr, err)
+			return
+		}
+
+		if err := ncm.HandleTransaction(&tx, peer); err != nil {
+			fmt.Printf("❌ Failed to handle transaction from %s: %v\n", peerAddr, err)
+			return
+		}
+
+	case network.MessageTypeInv:
+		// Request the announced items we have not seen yet
+		vectors, err := network.ParseInvMessage(msg)
+		if err != nil {
+			fmt.Printf("❌ Failed to parse inv message from %s: %v\n", peerAddr, err)
+			return
+		}
+
+		if err := ncm.HandleInv(peer, vectors); err != nil {
+			fmt.Printf("❌ Failed to request inventory from %s: %v\n", peerAddr, err)
+		}
+
+	case network.MessageTypeGetData:
+		// Send the requested transactions and blocks
+		vectors, err := network.ParseGetDataMessage(msg)
+		if err != nil {
+			fmt.Printf("❌ Failed to parse get data message from %s: %v\n", peerAddr, err)
+			return
+		}
+
+		if err := ncm.HandleGetData(peer, vectors); err != nil {
+			fmt.Printf("❌ Failed to send data to %s: %v\n", peerAddr, err)
+		}
+
 	case network.MessageTypeGetBlocks:
 		// Handle request for blocks
 		startIndex, count, err := network.ParseGetBlocksMessage(msg)
@@ -111,15 +208,24 @@ func (ncm *NetworkConsensusManager) HandleMessage(peer *network.Peer, msg *netwo
 		}
 
 		// Send blocks back to peer
-		blockData, err := json.Marshal(blocks)
+		blockData := blockchain.EncodeBlocks(blocks)
+		response := network.NewMessage(network.MessageTypeBlocks, blockData)
+		if err := peer.Send(response); err != nil {
+			fmt.Printf("❌ Failed to send blocks to %s: %v\n", peerAddr, err)
+		}
+
+	case network.MessageTypeGetHeaders:
+		// Send the headers following the fork point of the peer's locator
+		locator, stopHash, err := network.ParseGetHeadersMessage(msg)
 		if err != nil {
-			fmt.Printf("❌ Failed to marshal blocks for %s: %v\n", peerAddr, err)
+			fmt.Printf("❌ Failed to parse get headers message from %s: %v\n", peerAddr, err)
 			return
 		}
 
-		response := network.NewMessage(network.MessageTypeBlocks, blockData)
+		headers := ncm.HandleGetHeaders(locator, stopHash)
+		response := network.NewMessage(network.MessageTypeHeaders, blockchain.EncodeHeaders(headers))
 		if err := peer.Send(response); err != nil {
-			fmt.Printf("❌ Failed to send blocks to %s: %v\n", peerAddr, err)
+			fmt.Printf("❌ Failed to send headers to %s: %v\n", peerAddr, err)
 		}
 
 	case network.MessageTypeGetBlockchain:
@@ -128,6 +234,7 @@ func (ncm *NetworkConsensusManager) HandleMessage(peer *network.Peer, msg *netwo
 
 		chainInfo := map[string]interface{}{
 			"height": height,
+			"time":   time.Now().Unix(),
 		}
 
 		chainData, err := json.Marshal(chainInfo)
@@ -218,7 +325,50 @@ func (ncm *NetworkConsensusManager) syncWithBestPeer(ctx context.Context, config
 		return fmt.Errorf("no peers available for sync")
 	}
 
-	return ncm.syncManager.SyncWithPeer(ctx, bestPeer, config)
+	return ncm.syncManager.SyncWithPeers(ctx, ncm.downloadPeers(bestPeer), config)
+}
+
+// downloadPeers returns the best peer followed by the other peers blocks
+// can be downloaded from: the peers recorded, highest chain first, then,
+// with discovery set, the known peers that are not banned, best reputation
+// first. SyncWithPeers keeps the first MaxDownloadPeers of them.
+func (ncm *NetworkConsensusManager) downloadPeers(bestPeer string) []string {
+	peers := []string{bestPeer}
+	seen := map[string]bool{bestPeer: true}
+
+	ncm.peerMu.RLock()
+	recorded := make([]*PeerInfo, 0, len(ncm.peers))
+	for addr, info := range ncm.peers {
+		if !seen[addr] {
+			seen[addr] = true
+			recorded = append(recorded, &PeerInfo{Address: addr, ChainHeight: info.ChainHeight})
+		}
+	}
+	ncm.peerMu.RUnlock()
+	sort.Slice(recorded, func(i, j int) bool { return recorded[i].ChainHeight > recorded[j].ChainHeight })
+	for _, info := range recorded {
+		peers = append(peers, info.Address)
+	}
+
+	ncm.syncManager.syncMu.RLock()
+	discovery := ncm.syncManager.discovery
+	ncm.syncManager.syncMu.RUnlock()
+	if discovery == nil {
+		return peers
+	}
+
+	now := time.Now()
+	known := discovery.GetKnownPeers()
+	var candidates []string
+	for addr, rep := range known {
+		if seen[addr] || (rep.Banned && now.Before(rep.BanUntil)) {
+			continue
+		}
+		seen[addr] = true
+		candidates = append(candidates, addr)
+	}
+	sort.Slice(candidates, func(i, j int) bool { return known[candidates[i]].Score > known[candidates[j]].Score })
+	return append(peers, candidates...)
 }
 
 // findBestPeer finds the peer with the highest chain
@@ -239,32 +389,68 @@ func (ncm *NetworkConsensusManager) findBestPeer() string {
 	return bestPeer
 }
 
-// HandleNewBlock handles a new block received from the network
+// HandleNewBlock handles a new block received from the network. A block
+// extending the local tip is validated and appended; any other block may
+// belong to a fork, which is resolved by syncing with the peer after the
+// lock is released, as that waits on the network.
 func (ncm *NetworkConsensusManager) HandleNewBlock(ctx context.Context, block *blockchain.Block, peerAddr string) error {
+	extended, err := ncm.appendNewBlock(block, peerAddr)
+	if err != nil || extended {
+		return err
+	}
+
+	// Block doesn't extend our chain, might be a fork
+	if !block.IsValidProof() {
+		return fmt.Errorf("block validation failed: invalid proof of work")
+	}
+	return ncm.handleFork(ctx, block, peerAddr)
+}
+
+// appendNewBlock validates and appends a block if it extends the local tip,
+// reporting whether it does
+func (ncm *NetworkConsensusManager) appendNewBlock(block *blockchain.Block, peerAddr string) (bool, error) {
 	ncm.mu.RLock()
 	defer ncm.mu.RUnlock()
 
 	// Get latest block
 	latestBlock := ncm.syncManager.localChain.GetLatestBlock()
 	if latestBlock == nil {
-		return fmt.Errorf("failed to get latest block")
+		return false, fmt.Errorf("failed to get latest block")
+	}
+	if string(block.PrevHash) != string(latestBlock.Hash) {
+		return false, nil
 	}
 
 	// Validate block
-	if err := ncm.consensusRules.ValidateBlock(block, latestBlock); err != nil {
-		return fmt.Errorf("block validation failed: %w", err)
+	if err := ncm.consensusRules.ValidateBlockForChain(ncm.syncManager.localChain, block); err != nil {
+		return false, fmt.Errorf("block validation failed: %w", err)
 	}
 
-	// Check if block extends our chain
-	if string(block.PrevHash) == string(latestBlock.Hash) {
-		// Add block to our chain
-		ncm.syncManager.localChain.AddBlock(string(block.Data))
-		fmt.Printf("✅ Added new block %d from peer %s\n", ncm.syncManager.localChain.GetChainLength()-1, peerAddr)
-		return nil
+	// Add block to our chain
+	if err := ncm.syncManager.localChain.AppendBlock(block); err != nil {
+		return false, fmt.Errorf("failed to add block: %w", err)
 	}
+	fmt.Printf("✅ Added new block %d from peer %s\n", ncm.syncManager.localChain.GetChainLength()-1, peerAddr)
+	ncm.updateMempoolLocked(block)
+	return true, nil
+}
 
-	// Block doesn't extend our chain, might be a fork
-	return ncm.handleFork(ctx, block, peerAddr)
+// updateMempoolLocked removes the transactions of a block appended to the
+// chain from the mempool and revalidates the rest (assumes lock is held)
+func (ncm *NetworkConsensusManager) updateMempoolLocked(block *blockchain.Block) {
+	if ncm.mempool == nil {
+		return
+	}
+
+	localChain := ncm.syncManager.localChain
+	ncm.mempool.RemoveBlockTransactions(localChain.GetChainLength()-1, block.Transactions)
+
+	chainState := localChain.ChainState()
+	if chainState == nil {
+		return
+	}
+	ncm.mempool.UpdateLockContext(chainState.LockContext())
+	ncm.mempool.ValidateAndRemoveInvalid(chainState.UTXOSet().ToMap())
 }
 
 // handleFork handles a potential fork when receiving a block
@@ -298,6 +484,14 @@ func (ncm *NetworkConsensusManager) HandleGetBlocks(startIndex, count int) ([]*b
 	return blocks, nil
 }
 
+// HandleGetHeaders returns the headers of the local chain after the last
+// block listed in a peer's locator, as many as fit in a HEADERS message
+func (ncm *NetworkConsensusManager) HandleGetHeaders(locator [][]byte, stopHash []byte) []*blockchain.BlockHeader {
+	ncm.mu.RLock()
+	defer ncm.mu.RUnlock()
+	return ncm.syncManager.localChain.HeadersAfter(locator, stopHash, network.MaxHeadersPerMessage)
+}
+
 // HandleGetChainHeight returns the local chain height
 func (ncm *NetworkConsensusManager) HandleGetChainHeight() int {
 	ncm.mu.RLock()
@@ -356,7 +550,7 @@ func (ncm *NetworkConsensusManager) BroadcastBlock(block *blockchain.Block) erro
 	}
 
 	// Create block message
-	blockData, err := json.Marshal(block)
+	blockData, err := block.MarshalBinary()
 	if err != nil {
 		return fmt.Errorf("failed to marshal block: %w", err)
 	}
@@ -369,6 +563,188 @@ func (ncm *NetworkConsensusManager) BroadcastBlock(block *blockchain.Block) erro
 	return nil
 }
 
+// SubmitTransaction adds a local transaction to the mempool and announces it
+// to all peers
+func (ncm *NetworkConsensusManager) SubmitTransaction(tx *transactions.Transaction) error {
+	vector := network.InvVector{Type: network.InvTypeTransaction, Hash: tx.ID}
+	if err := ncm.acceptTransaction(tx); err != nil {
+		return err
+	}
+	ncm.seen.Add(vector.Key())
+	ncm.announce(vector, nil)
+	return nil
+}
+
+// HandleTransaction admits a transaction relayed by a peer to the mempool and
+// announces it to the other peers. Transactions already seen are ignored, and
+// rejected ones are not requested again while they are remembered.
+func (ncm *NetworkConsensusManager) HandleTransaction(tx *transactions.Transaction, from *network.Peer) error {
+	vector := network.InvVector{Type: network.InvTypeTransaction, Hash: tx.ID}
+	ncm.requested.Remove(vector.Key())
+	if !ncm.seen.Add(vector.Key()) {
+		return nil
+	}
+
+	if err := ncm.acceptTransaction(tx); err != nil {
+		return err
+	}
+	fmt.Printf("✅ Accepted transaction %s\n", tx.ID)
+
+	ncm.announce(vector, from)
+	return nil
+}
+
+// acceptTransaction validates a transaction, including its input scripts,
+// against the chain state and the mempool, and adds it to the mempool
+func (ncm *NetworkConsensusManager) acceptTransaction(tx *transactions.Transaction) error {
+	ncm.mu.RLock()
+	mempool := ncm.mempool
+	ncm.mu.RUnlock()
+
+	if mempool == nil {
+		return fmt.Errorf("mempool not configured")
+	}
+	if tx.ID != tx.CalculateID() {
+		return fmt.Errorf("transaction ID %s does not match its contents", tx.ID)
+	}
+	if tx.IsCoinbase() {
+		return fmt.Errorf("coinbase transaction %s cannot be relayed", tx.ID)
+	}
+
+	chainState := ncm.syncManager.localChain.ChainState()
+	if chainState == nil {
+		return fmt.Errorf("chain has no chain state attached")
+	}
+
+	// Scripts are checked whatever the mempool validates, so that no
+	// transaction with invalid unlocking scripts is relayed
+	utxos := chainState.UTXOSet().ToMap()
+	if err := mempool.VerifyInputScripts(tx, utxos); err != nil {
+		return fmt.Errorf("transaction %s rejected: %w", tx.ID, err)
+	}
+	if err := mempool.AddTransaction(tx, utxos); err != nil {
+		return fmt.Errorf("transaction %s rejected: %w", tx.ID, err)
+	}
+	return nil
+}
+
+// HandleInv requests the announced items that are neither known nor already
+// requested from another peer
+func (ncm *NetworkConsensusManager) HandleInv(peer *network.Peer, vectors []network.InvVector) error {
+	var wanted []network.InvVector
+	for _, vector := range vectors {
+		if ncm.seen.Contains(vector.Key()) || ncm.haveInventory(vector) {
+			continue
+		}
+		if !ncm.requested.Add(vector.Key()) {
+			continue // Already requested and not timed out
+		}
+		wanted = append(wanted, vector)
+	}
+	if len(wanted) == 0 {
+		return nil
+	}
+
+	msg, err := network.NewGetDataMessage(wanted)
+	if err != nil {
+		return err
+	}
+	return peer.Send(msg)
+}
+
+// HandleGetData sends the requested transactions and blocks to a peer.
+// Unknown items are skipped.
+func (ncm *NetworkConsensusManager) HandleGetData(peer *network.Peer, vectors []network.InvVector) error {
+	ncm.mu.RLock()
+	mempool := ncm.mempool
+	ncm.mu.RUnlock()
+
+	for _, vector := range vectors {
+		var msg *network.Message
+		switch vector.Type {
+		case network.InvTypeTransaction:
+			if mempool == nil {
+				continue
+			}
+			tx, exists := mempool.GetTransaction(vector.Hash)
+			if !exists {
+				continue
+			}
+			data, err := tx.MarshalBinary()
+			if err != nil {
+				return fmt.Errorf("failed to marshal transaction: %w", err)
+			}
+			msg = network.NewMessage(network.MessageTypeTransaction, data)
+
+		case network.InvTypeBlock:
+			hash, err := hex.DecodeString(vector.Hash)
+			if err != nil {
+				continue
+			}
+			block := ncm.syncManager.localChain.GetBlockByHash(hash)
+			if block == nil {
+				continue
+			}
+			data, err := block.MarshalBinary()
+			if err != nil {
+				return fmt.Errorf("failed to marshal block: %w", err)
+			}
+			msg = network.NewMessage(network.MessageTypeNewBlock, data)
+
+		default:
+			continue
+		}
+
+		if err := peer.Send(msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// haveInventory reports whether an item is in the mempool or the chain
+func (ncm *NetworkConsensusManager) haveInventory(vector network.InvVector) bool {
+	switch vector.Type {
+	case network.InvTypeTransaction:
+		ncm.mu.RLock()
+		mempool := ncm.mempool
+		ncm.mu.RUnlock()
+
+		if mempool == nil {
+			return false
+		}
+		_, exists := mempool.GetTransaction(vector.Hash)
+		return exists
+
+	case network.InvTypeBlock:
+		hash, err := hex.DecodeString(vector.Hash)
+		if err != nil {
+			return false
+		}
+		return ncm.syncManager.localChain.GetBlockByHash(hash) != nil
+	}
+	return false
+}
+
+// announce sends an inventory announcement to every peer except the one the
+// item came from
+func (ncm *NetworkConsensusManager) announce(vector network.InvVector, except *network.Peer) {
+	ncm.mu.RLock()
+	server := ncm.networkServer
+	ncm.mu.RUnlock()
+
+	if server == nil {
+		return
+	}
+
+	msg, err := network.NewInvMessage([]network.InvVector{vector})
+	if err != nil {
+		fmt.Printf("❌ Failed to create inv message: %v\n", err)
+		return
+	}
+	server.Relay(msg, except)
+}
+
 // GetNetworkStats returns network statistics
 func (ncm *NetworkConsensusManager) GetNetworkStats() map[string]interface{} {
 	ncm.mu.RLock()
@@ -382,6 +758,7 @@ func (ncm *NetworkConsensusManager) GetNetworkStats() map[string]interface{} {
 		"local_height":      ncm.syncManager.localChain.GetChainLength() - 1,
 		"syncing":          ncm.syncManager.IsSyncing(),
 		"partition_status":  ncm.partitionManager.GetPartitionStatus(),
+		"seen_inventory":    ncm.seen.Len(),
 	}
 
 	// Add peer details
@@ -423,10 +800,5 @@ func (ncm *NetworkConsensusManager) ValidateNewBlock(block *blockchain.Block) er
 	ncm.mu.RLock()
 	defer ncm.mu.RUnlock()
 
-	latestBlock := ncm.syncManager.localChain.GetLatestBlock()
-	if latestBlock == nil {
-		return fmt.Errorf("failed to get latest block")
-	}
-
-	return ncm.consensusRules.ValidateBlock(block, latestBlock)
+	return ncm.consensusRules.ValidateBlockForChain(ncm.syncManager.localChain, block)
 }
\ No newline at end of file
@@ -19,6 +19,11 @@ type ConsensusRules struct {
 	AdjustmentInterval int
 	MinDifficulty      int
 	MaxDifficulty      int
+	MaxRetargetFactor  int64 // Maximum factor the target may change by per interval
+
+	// Block timestamps
+	MaxFutureDrift time.Duration // How far ahead of network time a block may be
+	Clock          *NetworkClock // Network-adjusted clock, the local clock if nil
 
 	// Block validation
 	MaxBlockSize      int
@@ -37,6 +42,9 @@ func DefaultConsensusRules() *ConsensusRules {
 		AdjustmentInterval: 10,
 		MinDifficulty:      1,
 		MaxDifficulty:      32,
+		MaxRetargetFactor:  blockchain.MaxRetargetFactor,
+		MaxFutureDrift:     2 * time.Hour,
+		Clock:              NewNetworkClock(),
 		MaxBlockSize:       1_000_000, // 1MB
 		MaxTxCount:         10000,
 		CoinbaseMaturity:   100,
@@ -45,27 +53,103 @@ func DefaultConsensusRules() *ConsensusRules {
 	}
 }
 
-// ValidateBlock validates a block against consensus rules
+// ValidateBlock validates a block against consensus rules. Without the rest of
+// the chain, the previous block's timestamp stands in for the median time past.
 func (cr *ConsensusRules) ValidateBlock(block *blockchain.Block, prevBlock *blockchain.Block) error {
 	cr.rulesMu.RLock()
 	defer cr.rulesMu.RUnlock()
+	return cr.validateBlockLocked(block, prevBlock, prevBlock.Timestamp)
+}
+
+// ValidateBlockForChain validates a block that is to extend the tip of bc,
+// including the median-time-past rule over the last blocks of bc and the
+// target the retarget schedule sets after them
+func (cr *ConsensusRules) ValidateBlockForChain(bc *blockchain.Blockchain, block *blockchain.Block) error {
+	cr.rulesMu.RLock()
+	defer cr.rulesMu.RUnlock()
+
+	prevBlock := bc.GetLatestBlock()
+	if prevBlock == nil {
+		return fmt.Errorf("failed to get latest block")
+	}
+	expectedBits, err := cr.calculateNextBits(bc)
+	if err != nil {
+		return fmt.Errorf("failed to calculate expected target: %w", err)
+	}
+	if block.Bits != expectedBits {
+		return fmt.Errorf("block target %08x does not match the expected target %08x", block.Bits, expectedBits)
+	}
+	return cr.validateBlockLocked(block, prevBlock, bc.MedianTimePast())
+}
+
+// ValidateBlockTimestamp checks that a block is not timestamped before the
+// median time past of the blocks before it, nor more than MaxFutureDrift
+// ahead of the network-adjusted clock.
+// Blocks mined in quick succession may share the median's timestamp.
+func (cr *ConsensusRules) ValidateBlockTimestamp(block *blockchain.Block, medianTimePast int64) error {
+	cr.rulesMu.RLock()
+	defer cr.rulesMu.RUnlock()
+	return cr.validateBlockTimestampLocked(block, medianTimePast)
+}
+
+// validateBlockTimestampLocked checks the block timestamp (assumes lock is held)
+func (cr *ConsensusRules) validateBlockTimestampLocked(block *blockchain.Block, medianTimePast int64) error {
+	if block.Timestamp < medianTimePast {
+		return fmt.Errorf("block timestamp (%d) is before the median time past (%d)",
+			block.Timestamp, medianTimePast)
+	}
+
+	if cr.MaxFutureDrift > 0 {
+		maxTime := cr.now().Add(cr.MaxFutureDrift).Unix()
+		if block.Timestamp > maxTime {
+			return fmt.Errorf("block timestamp (%d) is more than %v ahead of network time",
+				block.Timestamp, cr.MaxFutureDrift)
+		}
+	}
+
+	return nil
+}
+
+// clockOffset returns the network time offset, zero without a clock
+func (cr *ConsensusRules) clockOffset() time.Duration {
+	if cr.Clock != nil {
+		return cr.Clock.Offset()
+	}
+	return 0
+}
+
+// now returns the network-adjusted time
+func (cr *ConsensusRules) now() time.Time {
+	if cr.Clock != nil {
+		return cr.Clock.Now()
+	}
+	return time.Now()
+}
 
-	// Validate basic block structure
-	// Allow same timestamp for blocks mined in quick succession
-	if block.Timestamp < prevBlock.Timestamp {
-		return fmt.Errorf("block timestamp (%d) must be greater than or equal to previous block (%d)",
-			block.Timestamp, prevBlock.Timestamp)
+// validateBlockLocked validates a block against consensus rules (assumes lock is held)
+func (cr *ConsensusRules) validateBlockLocked(block *blockchain.Block, prevBlock *blockchain.Block, medianTimePast int64) error {
+	if err := cr.validateBlockTimestampLocked(block, medianTimePast); err != nil {
+		return err
 	}
 
 	// Validate block size
-	if len(block.Data) > cr.MaxBlockSize {
-		return fmt.Errorf("block size (%d) exceeds maximum (%d)", len(block.Data), cr.MaxBlockSize)
+	if size := block.Size(); size > cr.MaxBlockSize {
+		return fmt.Errorf("block size (%d) exceeds maximum (%d)", size, cr.MaxBlockSize)
 	}
 
-	// Validate difficulty
-	if block.Difficulty < cr.MinDifficulty || block.Difficulty > cr.MaxDifficulty {
-		return fmt.Errorf("invalid difficulty (%d): must be between %d and %d",
-			block.Difficulty, cr.MinDifficulty, cr.MaxDifficulty)
+	// Validate transaction count
+	if len(block.Transactions) > cr.MaxTxCount {
+		return fmt.Errorf("block transaction count (%d) exceeds maximum (%d)", len(block.Transactions), cr.MaxTxCount)
+	}
+
+	// Validate that the header commits to the block body
+	if !block.HasValidMerkleRoot() {
+		return fmt.Errorf("block merkle root does not match its transactions")
+	}
+
+	// Validate the target against the difficulty limits
+	if err := cr.validateTargetLocked(block.Bits); err != nil {
+		return err
 	}
 
 	// Validate proof of work
@@ -79,22 +163,85 @@ func (cr *ConsensusRules) ValidateBlock(block *blockchain.Block, prevBlock *bloc
 	}
 
 	// Validate transactions in the block
-	// Note: Currently blocks store data as bytes, not structured transactions
-	// This validation will be enhanced when Block struct is refactored
-	// For now, we perform basic data integrity checks
-	if len(block.Data) > 0 {
-		// Try to parse as transaction JSON for validation
-		tx, err := transactions.FromJSON(string(block.Data))
-		if err == nil {
-			// Successfully parsed as transaction, validate it
-			if err := tx.ValidateBasic(); err != nil {
-				return fmt.Errorf("invalid transaction in block: %w", err)
-			}
+	if err := validateBlockTransactions(block.Transactions); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// validateTargetLocked checks that target bits lie within the difficulty
+// limits (assumes lock is held)
+func (cr *ConsensusRules) validateTargetLocked(bits uint32) error {
+	target := blockchain.CompactToBig(bits)
+	if target.Sign() == 0 ||
+		target.Cmp(blockchain.TargetForDifficulty(cr.MinDifficulty)) > 0 ||
+		target.Cmp(blockchain.TargetForDifficulty(cr.MaxDifficulty)) < 0 {
+		return fmt.Errorf("invalid target bits (%08x): difficulty must be between %d and %d",
+			bits, cr.MinDifficulty, cr.MaxDifficulty)
+	}
+	return nil
+}
+
+// ValidateHeaders checks headers extending ancestors, the headers of the
+// chain from its genesis block up to the block they follow, before their
+// blocks are downloaded: each header must link to the one before it, carry
+// the target the retarget schedule sets after it and meet it, and be
+// timestamped no earlier than the median time past of the headers before it
+// nor too far ahead of network time
+func (cr *ConsensusRules) ValidateHeaders(ancestors []*blockchain.BlockHeader, headers []*blockchain.BlockHeader) error {
+	cr.rulesMu.RLock()
+	defer cr.rulesMu.RUnlock()
+
+	if len(ancestors) == 0 {
+		return fmt.Errorf("headers have no ancestors")
+	}
+	chain := make([]*blockchain.BlockHeader, len(ancestors), len(ancestors)+len(headers))
+	copy(chain, ancestors)
+
+	maxTime := cr.now().Add(cr.MaxFutureDrift).Unix()
+	for i, header := range headers {
+		prev := chain[len(chain)-1]
+		if string(header.PrevHash) != string(prev.Hash()) {
+			return fmt.Errorf("header %d does not link to the previous header", i)
+		}
+		if expected := cr.nextBitsForHeadersLocked(chain); header.Bits != expected {
+			return fmt.Errorf("header %d has target %08x, expected %08x", i, header.Bits, expected)
+		}
+		if !header.IsValidProof() {
+			return fmt.Errorf("header %d has invalid proof of work", i)
 		}
-		// If parsing fails, we assume it's non-transaction data and skip validation
-		// This is acceptable for the current implementation
+		if medianTimePast := blockchain.HeaderMedianTimePast(chain); header.Timestamp < medianTimePast {
+			return fmt.Errorf("header %d timestamp (%d) is before the median time past (%d)",
+				i, header.Timestamp, medianTimePast)
+		}
+		if cr.MaxFutureDrift > 0 && header.Timestamp > maxTime {
+			return fmt.Errorf("header %d timestamp (%d) is more than %v ahead of network time",
+				i, header.Timestamp, cr.MaxFutureDrift)
+		}
+		chain = append(chain, header)
 	}
+	return nil
+}
 
+// validateBlockTransactions performs context-free checks on a block body
+func validateBlockTransactions(txs []*transactions.Transaction) error {
+	seen := make(map[string]bool, len(txs))
+	for i, tx := range txs {
+		if tx == nil {
+			return fmt.Errorf("transaction %d in block is nil", i)
+		}
+		if err := tx.ValidateBasic(); err != nil {
+			return fmt.Errorf("invalid transaction %d in block: %w", i, err)
+		}
+		if tx.IsCoinbase() && i != 0 {
+			return fmt.Errorf("coinbase transaction %s must be the first transaction in block", tx.ID)
+		}
+		if seen[tx.ID] {
+			return fmt.Errorf("duplicate transaction %s in block", tx.ID)
+		}
+		seen[tx.ID] = true
+	}
 	return nil
 }
 
@@ -107,91 +254,126 @@ func (cr *ConsensusRules) ValidateChain(bc *blockchain.Blockchain) error {
 		return fmt.Errorf("blockchain basic validation failed")
 	}
 
-	// Validate each block against consensus rules
+	// Validate each block against consensus rules, including the target the
+	// retarget schedule sets after the headers before it
+	headers := bc.HeadersTo(bc.GetChainLength() - 1)
 	for i := 1; i < bc.GetChainLength(); i++ {
 		block, err := bc.GetBlockByIndex(i)
 		if err != nil {
 			return fmt.Errorf("failed to get block %d: %w", i, err)
 		}
 
+		if expected := cr.nextBitsForHeadersLocked(headers[:i]); block.Bits != expected {
+			return fmt.Errorf("block %d has target %08x, expected %08x", i, block.Bits, expected)
+		}
+
 		prevBlock, err := bc.GetBlockByIndex(i - 1)
 		if err != nil {
 			return fmt.Errorf("failed to get previous block %d: %w", i-1, err)
 		}
 
-		if err := cr.ValidateBlock(block, prevBlock); err != nil {
+		if err := cr.validateBlockLocked(block, prevBlock, bc.MedianTimePastAt(i-1)); err != nil {
 			return fmt.Errorf("block %d validation failed: %w", i, err)
 		}
 	}
 
+	// Replay the chain against a fresh UTXO set to enforce spending,
+	// coinbase reward and coinbase maturity rules
+	chainState := cr.newChainStateLocked(nil)
+	for i := 0; i < bc.GetChainLength(); i++ {
+		block, err := bc.GetBlockByIndex(i)
+		if err != nil {
+			return fmt.Errorf("failed to get block %d: %w", i, err)
+		}
+		if _, err := chainState.ConnectBlock(block); err != nil {
+			return fmt.Errorf("block %d failed to connect: %w", i, err)
+		}
+	}
+
 	return nil
 }
 
-// CalculateNewDifficulty calculates the new difficulty based on recent block times
-func (cr *ConsensusRules) CalculateNewDifficulty(bc *blockchain.Blockchain) (int, error) {
+// NewChainState creates a chain state that enforces these consensus rules
+func (cr *ConsensusRules) NewChainState(utxoSet *transactions.UTXOSet) *blockchain.ChainState {
 	cr.rulesMu.RLock()
 	defer cr.rulesMu.RUnlock()
+	return cr.newChainStateLocked(utxoSet)
+}
 
-	if bc.GetChainLength() < cr.AdjustmentInterval {
-		return cr.MinDifficulty, nil
-	}
+// NewBlockAssembler creates a block assembler bounded by the block size and
+// transaction count limits of these consensus rules
+func (cr *ConsensusRules) NewBlockAssembler(bc *blockchain.Blockchain, mempool *transactions.Mempool) *blockchain.BlockAssembler {
+	cr.rulesMu.RLock()
+	defer cr.rulesMu.RUnlock()
+	return blockchain.NewBlockAssembler(bc, mempool, cr.MaxBlockSize, cr.MaxTxCount)
+}
 
-	// Get the last AdjustmentInterval blocks
-	startIndex := bc.GetChainLength() - cr.AdjustmentInterval
-	recentBlocks := make([]*blockchain.Block, 0, cr.AdjustmentInterval)
+// newChainStateLocked creates a chain state (assumes lock is held)
+func (cr *ConsensusRules) newChainStateLocked(utxoSet *transactions.UTXOSet) *blockchain.ChainState {
+	chainState := blockchain.NewChainState(utxoSet)
+	chainState.CoinbaseMaturity = cr.CoinbaseMaturity
+	return chainState
+}
 
-	for i := startIndex; i < bc.GetChainLength(); i++ {
-		block, err := bc.GetBlockByIndex(i)
-		if err != nil {
-			return 0, fmt.Errorf("failed to get block %d: %w", i, err)
-		}
-		recentBlocks = append(recentBlocks, block)
+// CalculateNewDifficulty returns the difficulty level of the next target
+func (cr *ConsensusRules) CalculateNewDifficulty(bc *blockchain.Blockchain) (int, error) {
+	bits, err := cr.CalculateNextBits(bc)
+	if err != nil {
+		return 0, err
 	}
+	return blockchain.DifficultyForBits(bits), nil
+}
 
-	// Calculate average block time
-	var totalTime time.Duration
-	for i := 1; i < len(recentBlocks); i++ {
-		blockTime := time.Duration(recentBlocks[i].Timestamp - recentBlocks[i-1].Timestamp)
-		totalTime += blockTime
-	}
+// CalculateNextBits calculates the target of the next block from recent block times.
+// The target is scaled by the ratio of the actual to the expected timespan of the
+// last AdjustmentInterval blocks, changing by at most MaxRetargetFactor.
+func (cr *ConsensusRules) CalculateNextBits(bc *blockchain.Blockchain) (uint32, error) {
+	cr.rulesMu.RLock()
+	defer cr.rulesMu.RUnlock()
+	return cr.calculateNextBits(bc)
+}
 
-	avgBlockTime := totalTime / time.Duration(cr.AdjustmentInterval-1)
-	currentDifficulty := recentBlocks[len(recentBlocks)-1].Difficulty
+// calculateNextBits calculates the next target (assumes lock is held)
+func (cr *ConsensusRules) calculateNextBits(bc *blockchain.Blockchain) (uint32, error) {
+	if bc.GetChainLength() < cr.AdjustmentInterval {
+		return blockchain.BitsForDifficulty(cr.MinDifficulty), nil
+	}
 
-	// Calculate deviation percentage from target
-	deviation := float64(avgBlockTime) / float64(cr.TargetBlockTime)
+	last := bc.GetLatestBlock()
+	if last == nil {
+		return 0, fmt.Errorf("failed to get latest block")
+	}
 
-	// Proportional difficulty adjustment
-	// If blocks are too fast (deviation < 1.0), increase difficulty
-	// If blocks are too slow (deviation > 1.0), decrease difficulty
-	// The adjustment is proportional to the deviation
-	adjustment := 0
+	first := bc.GetChainLength() - cr.AdjustmentInterval
+	return cr.retargetLocked(last.Bits, bc.MedianTimePastAt(first), bc.MedianTimePastAt(bc.GetChainLength()-1)), nil
+}
 
-	switch {
-	case deviation < 0.5:
-		// Blocks are significantly too fast, increase by 2
-		adjustment = 2
-	case deviation < 0.75:
-		// Blocks are moderately too fast, increase by 1
-		adjustment = 1
-	case deviation < 1.25:
-		// Within tolerance range, no change
-		adjustment = 0
-	case deviation < 1.5:
-		// Blocks are moderately too slow, decrease by 1
-		adjustment = -1
-	default:
-		// Blocks are significantly too slow, decrease by 2
-		adjustment = -2
+// nextBitsForHeadersLocked calculates the target of the header following
+// chain, like calculateNextBits does for a blockchain (assumes lock is held)
+func (cr *ConsensusRules) nextBitsForHeadersLocked(chain []*blockchain.BlockHeader) uint32 {
+	if len(chain) < cr.AdjustmentInterval {
+		return blockchain.BitsForDifficulty(cr.MinDifficulty)
 	}
 
-	newDifficulty := currentDifficulty + adjustment
-
-	// Clamp to min/max bounds
-	newDifficulty = rulesMax(cr.MinDifficulty, newDifficulty)
-	newDifficulty = rulesMin(cr.MaxDifficulty, newDifficulty)
+	first := len(chain) - cr.AdjustmentInterval
+	return cr.retargetLocked(chain[len(chain)-1].Bits,
+		blockchain.HeaderMedianTimePast(chain[:first+1]), blockchain.HeaderMedianTimePast(chain))
+}
 
-	return newDifficulty, nil
+// retargetLocked scales lastBits by the time the last AdjustmentInterval
+// blocks took, from the median time past firstTime to lastTime, clamped to
+// the difficulty limits (assumes lock is held). Measuring between medians
+// keeps a miner from skewing the retarget by lying about a single timestamp.
+func (cr *ConsensusRules) retargetLocked(lastBits uint32, firstTime, lastTime int64) uint32 {
+	actual := time.Duration(lastTime-firstTime) * time.Second
+	expected := cr.TargetBlockTime * time.Duration(cr.AdjustmentInterval-1)
+	bits := blockchain.RetargetBits(lastBits, actual, expected, cr.MaxRetargetFactor)
+
+	// Clamp to min/max difficulty bounds
+	target := blockchain.ClampTarget(blockchain.CompactToBig(bits),
+		blockchain.TargetForDifficulty(cr.MaxDifficulty),
+		blockchain.TargetForDifficulty(cr.MinDifficulty))
+	return blockchain.BigToCompact(target)
 }
 
 // SelectBestChain selects the best chain from multiple candidates
@@ -281,10 +463,7 @@ func calculateTotalWorkFromIndex(bc *blockchain.Blockchain, fromIndex int) *big.
 			continue
 		}
 
-		// Work = 2^difficulty
-		work := big.NewInt(1)
-		work.Lsh(work, uint(block.Difficulty))
-		totalWork.Add(totalWork, work)
+		totalWork.Add(totalWork, block.Work())
 	}
 
 	return totalWork
@@ -321,45 +500,6 @@ func (cr *ConsensusRules) GetForkPoint(chainA, chainB *blockchain.Blockchain) (i
 	return commonIndex, nil
 }
 
-// ValidateDifficultyTransition validates that difficulty transitions are valid
-func (cr *ConsensusRules) ValidateDifficultyTransition(bc *blockchain.Blockchain, newBlock *blockchain.Block) error {
-	cr.rulesMu.RLock()
-	defer cr.rulesMu.RUnlock()
-
-	if bc.GetChainLength() < cr.AdjustmentInterval {
-		return nil // No difficulty adjustment needed yet
-	}
-
-	// Check if this is an adjustment block
-	if (bc.GetChainLength() % cr.AdjustmentInterval) != 0 {
-		// Difficulty should remain the same
-		prevBlock := bc.GetLatestBlock()
-		if prevBlock == nil {
-			return fmt.Errorf("failed to get previous block")
-		}
-
-		if newBlock.Difficulty != prevBlock.Difficulty {
-			return fmt.Errorf("difficulty changed at non-adjustment block: expected %d, got %d",
-				prevBlock.Difficulty, newBlock.Difficulty)
-		}
-
-		return nil
-	}
-
-	// Calculate expected difficulty
-	expectedDifficulty, err := cr.CalculateNewDifficulty(bc)
-	if err != nil {
-		return fmt.Errorf("failed to calculate new difficulty: %w", err)
-	}
-
-	if newBlock.Difficulty != expectedDifficulty {
-		return fmt.Errorf("invalid difficulty at adjustment block: expected %d, got %d",
-			expectedDifficulty, newBlock.Difficulty)
-	}
-
-	return nil
-}
-
 // GetConsensusInfo returns information about the consensus rules
 func (cr *ConsensusRules) GetConsensusInfo() map[string]interface{} {
 	cr.rulesMu.RLock()
@@ -370,6 +510,9 @@ func (cr *ConsensusRules) GetConsensusInfo() map[string]interface{} {
 		"adjustment_interval":  cr.AdjustmentInterval,
 		"min_difficulty":       cr.MinDifficulty,
 		"max_difficulty":       cr.MaxDifficulty,
+		"max_retarget_factor":  cr.MaxRetargetFactor,
+		"max_future_drift":     cr.MaxFutureDrift.String(),
+		"network_time_offset":  cr.clockOffset().String(),
 		"max_block_size":       cr.MaxBlockSize,
 		"max_tx_count":         cr.MaxTxCount,
 		"coinbase_maturity":    cr.CoinbaseMaturity,
@@ -377,17 +520,3 @@ func (cr *ConsensusRules) GetConsensusInfo() map[string]interface{} {
 		"min_confirmations":    cr.MinConfirmations,
 	}
 }
-
-func rulesMax(a, b int) int {
-	if a > b {
-		return a
-	}
-	return b
-}
-
-func rulesMin(a, b int) int {
-	if a < b {
-		return a
-	}
-	return b
-}
\ No newline at end of file
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"math/big"
 	"sync"
 	"time"
 
@@ -13,12 +14,15 @@ import (
 
 // SyncManager manages blockchain synchronization between nodes
 type SyncManager struct {
-	localChain    *blockchain.Blockchain
-	networkClient *network.Client
-	syncing       bool
-	syncMu        sync.RWMutex
-	progress      *SyncProgress
-	progressMu    sync.RWMutex
+	localChain *blockchain.Blockchain
+	rules      *ConsensusRules    // Validates received headers and blocks
+	server     *network.Server    // Sync connections use its handshake config, if set
+	discovery  *network.Discovery // Scores download peers, if set
+	syncing    bool
+	syncMu     sync.RWMutex
+	progress   *SyncProgress
+	progressMu sync.RWMutex
+	clock      *NetworkClock // Receives the time reported by peers, if set
 }
 
 // SyncProgress tracks synchronization progress
@@ -32,6 +36,7 @@ type SyncProgress struct {
 	Errors           []string
 	BytesReceived    int64
 	BlocksPerSecond  float64
+	DownloadPeers    int
 }
 
 // SyncConfig holds synchronization configuration
@@ -41,6 +46,8 @@ type SyncConfig struct {
 	Timeout               time.Duration
 	RetryAttempts         int
 	VerifyBlocks          bool
+	MaxHeaders            int // Headers accepted per sync, later ones are left to the next sync
+	MaxDownloadPeers      int // Peers blocks are downloaded from, including the one synced with
 }
 
 // DefaultSyncConfig returns default synchronization configuration
@@ -51,6 +58,8 @@ func DefaultSyncConfig() SyncConfig {
 		Timeout:               30 * time.Second,
 		RetryAttempts:         3,
 		VerifyBlocks:          true,
+		MaxHeaders:            50 * network.MaxHeadersPerMessage,
+		MaxDownloadPeers:      8,
 	}
 }
 
@@ -58,15 +67,42 @@ func DefaultSyncConfig() SyncConfig {
 func NewSyncManager(localChain *blockchain.Blockchain) *SyncManager {
 	return &SyncManager{
 		localChain: localChain,
+		rules:      DefaultConsensusRules(),
 		syncing:    false,
 		progress:   &SyncProgress{},
 	}
 }
 
-// SetNetworkClient sets the network client for peer communication
-// This enables the sync manager to communicate with peers for blockchain synchronization
-func (sm *SyncManager) SetNetworkClient(client *network.Client) {
-	sm.networkClient = client
+// SetNetworkServer sets the server whose handshake configuration, and with
+// it the node key, is used to connect to peers for synchronization
+func (sm *SyncManager) SetNetworkServer(server *network.Server) {
+	sm.syncMu.Lock()
+	defer sm.syncMu.Unlock()
+	sm.server = server
+}
+
+// SetDiscovery sets the peer discovery service whose reputation scores are
+// updated as peers serve or stall block downloads
+func (sm *SyncManager) SetDiscovery(discovery *network.Discovery) {
+	sm.syncMu.Lock()
+	defer sm.syncMu.Unlock()
+	sm.discovery = discovery
+}
+
+// updatePeerReputation adjusts the reputation of a sync peer, both of its
+// address and of its node identity, if discovery is set
+func (sm *SyncManager) updatePeerReputation(session *syncSession, delta int) {
+	sm.syncMu.RLock()
+	discovery := sm.discovery
+	sm.syncMu.RUnlock()
+
+	if discovery == nil {
+		return
+	}
+	discovery.UpdatePeerReputation(session.peerAddr, delta)
+	if peer := session.client.Peer(); peer != nil {
+		discovery.UpdateNodeReputation(peer.NodeID(), delta)
+	}
 }
 
 // IsSyncing returns whether synchronization is in progress
@@ -78,6 +114,21 @@ func (sm *SyncManager) IsSyncing() bool {
 
 // SyncWithPeer synchronizes the blockchain with a specific peer
 func (sm *SyncManager) SyncWithPeer(ctx context.Context, peerAddr string, config SyncConfig) error {
+	return sm.SyncWithPeers(ctx, []string{peerAddr}, config)
+}
+
+// SyncWithPeers synchronizes the blockchain with the first of peerAddrs. It
+// first downloads and validates the headers of that peer's chain after the
+// last block both chains share, then fetches the blocks of those headers
+// from up to MaxDownloadPeers of the peers at once if they carry more work
+// than the local blocks after that point. The other peers are dialed in
+// parallel, and those that cannot be reached or do not hold the last header
+// are skipped.
+func (sm *SyncManager) SyncWithPeers(ctx context.Context, peerAddrs []string, config SyncConfig) error {
+	if len(peerAddrs) == 0 {
+		return fmt.Errorf("no peers to sync with")
+	}
+
 	sm.syncMu.Lock()
 	if sm.syncing {
 		sm.syncMu.Unlock()
@@ -92,6 +143,26 @@ func (sm *SyncManager) SyncWithPeer(ctx context.Context, peerAddr string, config
 		sm.syncMu.Unlock()
 	}()
 
+	defaults := DefaultSyncConfig()
+	if config.MaxConcurrentRequests <= 0 {
+		config.MaxConcurrentRequests = defaults.MaxConcurrentRequests
+	}
+	if config.BlockSize <= 0 {
+		config.BlockSize = defaults.BlockSize
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = defaults.Timeout
+	}
+	if config.RetryAttempts <= 0 {
+		config.RetryAttempts = defaults.RetryAttempts
+	}
+	if config.MaxDownloadPeers <= 0 {
+		config.MaxDownloadPeers = defaults.MaxDownloadPeers
+	}
+	if len(peerAddrs) > config.MaxDownloadPeers {
+		peerAddrs = peerAddrs[:config.MaxDownloadPeers]
+	}
+
 	// Initialize progress
 	sm.progressMu.Lock()
 	sm.progress = &SyncProgress{
@@ -101,341 +172,354 @@ func (sm *SyncManager) SyncWithPeer(ctx context.Context, peerAddr string, config
 	}
 	sm.progressMu.Unlock()
 
-	// Find common ancestor
-	commonIndex, err := sm.findCommonAncestor(ctx, peerAddr)
+	session, err := sm.openSession(peerAddrs[0])
 	if err != nil {
-		return fmt.Errorf("failed to find common ancestor: %w", err)
-	}
-
-	// Request missing blocks
-	if err := sm.requestBlocks(ctx, peerAddr, commonIndex, config); err != nil {
-		return fmt.Errorf("failed to request blocks: %w", err)
+		return err
 	}
+	defer session.close()
 
-	// Verify and integrate blocks
-	if err := sm.verifyAndIntegrateBlocks(config.VerifyBlocks); err != nil {
-		return fmt.Errorf("failed to verify blocks: %w", err)
+	peerHeight, err := sm.getPeerChainHeight(ctx, session, config.Timeout)
+	if err != nil {
+		return fmt.Errorf("failed to get peer chain height: %w", err)
 	}
+	sm.progressMu.Lock()
+	sm.progress.TargetHeight = peerHeight
+	sm.progressMu.Unlock()
 
-	return nil
-}
-
-// findCommonAncestor finds the last common block with a peer
-func (sm *SyncManager) findCommonAncestor(ctx context.Context, peerAddr string) (int, error) {
-	// Start from the tip of our chain and work backwards
-	localHeight := sm.localChain.GetChainLength() - 1
-
-	// Request peer's chain height
-	peerHeight, err := sm.getPeerChainHeight(ctx, peerAddr)
+	fork, headers, err := sm.syncHeaders(ctx, session, config)
 	if err != nil {
-		return -1, fmt.Errorf("failed to get peer chain height: %w", err)
+		return fmt.Errorf("failed to sync headers: %w", err)
 	}
-
-	// Find common ancestor by comparing hashes
-	commonIndex := -1
-	checkIndex := min(localHeight, peerHeight)
-
-	for checkIndex >= 0 {
-		localBlock, err := sm.localChain.GetBlockByIndex(checkIndex)
-		if err != nil {
-			return -1, fmt.Errorf("failed to get local block %d: %w", checkIndex, err)
-		}
-
-		peerBlock, err := sm.getPeerBlock(ctx, peerAddr, checkIndex)
-		if err != nil {
-			return -1, fmt.Errorf("failed to get peer block %d: %w", checkIndex, err)
-		}
-
-		// Compare hashes
-		if string(localBlock.Hash) == string(peerBlock.Hash) {
-			commonIndex = checkIndex
-			break
-		}
-
-		checkIndex--
+	if len(headers) == 0 {
+		return nil // Nothing we do not have
 	}
 
-	if commonIndex == -1 {
-		return -1, fmt.Errorf("no common ancestor found")
+	// Only download a branch with more work than ours after the fork
+	work := big.NewInt(0)
+	for _, header := range headers {
+		work.Add(work, header.Work())
+	}
+	if work.Cmp(sm.localChain.TotalWork(fork+1)) <= 0 {
+		return nil
 	}
 
-	sm.progressMu.Lock()
-	sm.progress.CurrentHeight = commonIndex
-	sm.progressMu.Unlock()
-
-	return commonIndex, nil
-}
-
-// requestBlocks requests missing blocks from a peer
-func (sm *SyncManager) requestBlocks(ctx context.Context, peerAddr string, fromIndex int, config SyncConfig) error {
-	// Get peer's chain height
-	peerHeight, err := sm.getPeerChainHeight(ctx, peerAddr)
-	if err != nil {
-		return fmt.Errorf("failed to get peer chain height: %w", err)
+	// Download the blocks from every peer holding the branch
+	sessions := []*syncSession{session}
+	others := sm.openDownloadSessions(ctx, peerAddrs[1:], headers[len(headers)-1], config.Timeout)
+	for _, other := range others {
+		defer other.close()
 	}
+	sessions = append(sessions, others...)
 
 	sm.progressMu.Lock()
-	sm.progress.TargetHeight = peerHeight
-	sm.progress.TotalBlocks = peerHeight - fromIndex - 1
+	sm.progress.CurrentHeight = fork
+	sm.progress.TargetHeight = fork + len(headers)
+	sm.progress.TotalBlocks = len(headers)
+	sm.progress.DownloadPeers = len(sessions)
 	sm.progressMu.Unlock()
 
-	// Request blocks in batches
-	currentIndex := fromIndex + 1
-	tempBlocks := make([]*blockchain.Block, 0, config.BlockSize)
-
-	for currentIndex <= peerHeight {
-		batchSize := syncMin(config.BlockSize, peerHeight-currentIndex+1)
-
-		blocks, err := sm.getPeerBlocks(ctx, peerAddr, currentIndex, batchSize)
-		if err != nil {
-			return fmt.Errorf("failed to get blocks starting at %d: %w", currentIndex, err)
-		}
-
-		if len(blocks) == 0 {
-			break
-		}
-
-		// Store blocks temporarily for verification
-		tempBlocks = append(tempBlocks, blocks...)
-
-		sm.progressMu.Lock()
-		sm.progress.ReceivedBlocks = currentIndex - fromIndex
-		sm.progress.BytesReceived += estimateBlocksSize(blocks)
-		sm.progress.BlocksPerSecond = sm.calculateBlocksPerSecond()
-		sm.progress.LastUpdateTime = time.Now()
-		sm.progressMu.Unlock()
+	if err := sm.downloadBlocks(ctx, sessions, fork, headers, config); err != nil {
+		return fmt.Errorf("failed to download blocks: %w", err)
+	}
 
-		currentIndex += len(blocks)
+	return nil
+}
 
-		// Verify batch periodically
-		if len(tempBlocks) >= config.BlockSize || currentIndex > peerHeight {
-			if err := sm.verifyBatch(tempBlocks, fromIndex); err != nil {
-				return fmt.Errorf("batch verification failed: %w", err)
+// openDownloadSessions connects to peerAddrs in parallel and returns the
+// sessions of the peers that hold tip, the last header to download. Peers
+// that cannot be reached or do not answer with tip are skipped.
+func (sm *SyncManager) openDownloadSessions(ctx context.Context, peerAddrs []string, tip *blockchain.BlockHeader, timeout time.Duration) []*syncSession {
+	opened := make([]*syncSession, len(peerAddrs))
+	var wg sync.WaitGroup
+	for i, addr := range peerAddrs {
+		wg.Add(1)
+		go func(i int, addr string) {
+			defer wg.Done()
+
+			session, err := sm.openSession(addr)
+			if err != nil {
+				fmt.Printf("⚠️  Skipping download peer %s: %v\n", addr, err)
+				return
 			}
-			tempBlocks = tempBlocks[:0] // Clear batch
-		}
+			if err := sm.checkHoldsHeader(ctx, session, tip, timeout); err != nil {
+				fmt.Printf("⚠️  Skipping download peer %s: %v\n", addr, err)
+				session.close()
+				return
+			}
+			opened[i] = session
+		}(i, addr)
+	}
+	wg.Wait()
 
-		// Check for context cancellation
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
+	var sessions []*syncSession
+	for _, session := range opened {
+		if session != nil {
+			sessions = append(sessions, session)
 		}
 	}
+	return sessions
+}
 
+// checkHoldsHeader asks the peer for the header following tip's parent and
+// checks that it answers with tip. Headers commit to their parents, so the
+// peer then holds every block of the branch up to tip.
+func (sm *SyncManager) checkHoldsHeader(ctx context.Context, session *syncSession, tip *blockchain.BlockHeader, timeout time.Duration) error {
+	tipHash := tip.Hash()
+	msg, err := network.NewGetHeadersMessage([][]byte{tip.PrevHash}, tipHash)
+	if err != nil {
+		return fmt.Errorf("failed to create get headers message: %w", err)
+	}
+	response, err := session.request(ctx, msg, network.MessageTypeHeaders, timeout)
+	if err != nil {
+		return err
+	}
+	headers, err := blockchain.DecodeHeaders(response.Payload)
+	if err != nil {
+		return fmt.Errorf("failed to parse headers: %w", err)
+	}
+	if len(headers) == 0 || string(headers[0].Hash()) != string(tipHash) {
+		return fmt.Errorf("peer does not hold block %x", tipHash)
+	}
 	return nil
 }
 
-// verifyAndIntegrateBlocks verifies and integrates received blocks
-func (sm *SyncManager) verifyAndIntegrateBlocks(verify bool) error {
-	sm.progressMu.RLock()
-	currentHeight := sm.progress.CurrentHeight
-	sm.progressMu.RUnlock()
+// syncSession is the connection to the peer being synced with, shared by
+// every request of a sync
+type syncSession struct {
+	peerAddr  string
+	client    *network.Client
+	responses chan *network.Message
+	done      chan struct{}
+}
 
-	// Get all blocks after the common ancestor
-	blocks := make([]*blockchain.Block, 0)
-	for i := currentHeight + 1; i < sm.localChain.GetChainLength(); i++ {
-		block, err := sm.localChain.GetBlockByIndex(i)
-		if err != nil {
-			return fmt.Errorf("failed to get block %d: %w", i, err)
-		}
-		blocks = append(blocks, block)
+// openSession connects to a peer for a sync
+func (sm *SyncManager) openSession(peerAddr string) (*syncSession, error) {
+	session := &syncSession{
+		peerAddr:  peerAddr,
+		responses: make(chan *network.Message, 64),
+		done:      make(chan struct{}),
 	}
-
-	// Verify each block
-	if verify {
-		for i, block := range blocks {
-			if !block.IsValidProof() {
-				return fmt.Errorf("block %d has invalid proof of work", currentHeight+1+i)
-			}
-
-			// Verify hash linking
-			if i > 0 {
-				prevBlock := blocks[i-1]
-				if string(block.PrevHash) != string(prevBlock.Hash) {
-					return fmt.Errorf("block %d has invalid previous hash", currentHeight+1+i)
-				}
-			} else {
-				// Check against local chain
-				prevBlock, err := sm.localChain.GetBlockByIndex(currentHeight)
-				if err != nil {
-					return fmt.Errorf("failed to get previous block: %w", err)
-				}
-				if string(block.PrevHash) != string(prevBlock.Hash) {
-					return fmt.Errorf("block %d has invalid previous hash", currentHeight+1)
-				}
+	session.client = network.NewClient(peerAddr, func(peer *network.Peer, msg *network.Message) {
+		switch msg.Type {
+		case network.MessageTypeBlockchain, network.MessageTypeHeaders, network.MessageTypeNewBlock:
+			select {
+			case session.responses <- msg:
+			case <-session.done:
 			}
 		}
+	})
+
+	sm.syncMu.RLock()
+	server := sm.server
+	sm.syncMu.RUnlock()
+	if server != nil {
+		session.client.SetHandshakeConfig(server.GetHandshakeConfig())
 	}
 
-	return nil
+	if err := session.client.Connect(); err != nil {
+		return nil, fmt.Errorf("failed to connect to peer %s: %w", peerAddr, err)
+	}
+	return session, nil
 }
 
-// verifyBatch verifies a batch of blocks
-func (sm *SyncManager) verifyBatch(blocks []*blockchain.Block, startIndex int) error {
-	for i, block := range blocks {
-		// Verify proof of work
-		if !block.IsValidProof() {
-			return fmt.Errorf("block %d has invalid proof of work", startIndex+i+1)
-		}
+// close disconnects from the peer
+func (s *syncSession) close() {
+	close(s.done)
+	s.client.Close()
+}
 
-		// Verify hash linking
-		if i == 0 {
-			// First block should link to our chain
-			prevBlock, err := sm.localChain.GetBlockByIndex(startIndex)
-			if err != nil {
-				return fmt.Errorf("failed to get previous block: %w", err)
-			}
-			if string(block.PrevHash) != string(prevBlock.Hash) {
-				return fmt.Errorf("block %d has invalid previous hash", startIndex+1)
-			}
-		} else {
-			// Subsequent blocks should link to previous block in batch
-			prevBlock := blocks[i-1]
-			if string(block.PrevHash) != string(prevBlock.Hash) {
-				return fmt.Errorf("block %d has invalid previous hash", startIndex+i+1)
+// request sends a message to the peer and waits for the first response of
+// type want, dropping anything else received meanwhile
+func (s *syncSession) request(ctx context.Context, msg *network.Message, want network.MessageType, timeout time.Duration) (*network.Message, error) {
+	if err := s.client.Send(msg); err != nil {
+		return nil, fmt.Errorf("failed to send message to peer %s: %w", s.peerAddr, err)
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case response := <-s.responses:
+			if response.Type == want {
+				return response, nil
 			}
+		case <-timer.C:
+			return nil, fmt.Errorf("timeout waiting for %s from peer %s", want, s.peerAddr)
 		}
-
-		// Add block to local chain
-		sm.localChain.AddBlock(string(block.Data))
 	}
-
-	return nil
 }
 
 // getPeerChainHeight gets the chain height from a peer
-func (sm *SyncManager) getPeerChainHeight(ctx context.Context, peerAddr string) (int, error) {
-	if sm.networkClient == nil {
-		return -1, fmt.Errorf("network client not configured")
+func (sm *SyncManager) getPeerChainHeight(ctx context.Context, session *syncSession, timeout time.Duration) (int, error) {
+	msg := network.NewMessage(network.MessageTypeGetBlockchain, nil)
+	response, err := session.request(ctx, msg, network.MessageTypeBlockchain, timeout)
+	if err != nil {
+		return -1, err
 	}
 
-	// Create a get blockchain info message
-	msg := network.NewMessage(network.MessageTypeGetBlockchain, nil)
+	// Parse the blockchain info from response
+	var chainInfo struct {
+		Height int   `json:"height"`
+		Time   int64 `json:"time"`
+	}
+	if err := json.Unmarshal(response.Payload, &chainInfo); err != nil {
+		return -1, fmt.Errorf("failed to parse chain info: %w", err)
+	}
+	if sm.clock != nil && chainInfo.Time > 0 {
+		sm.clock.AddSample(session.peerAddr, time.Unix(chainInfo.Time, 0))
+	}
+	return chainInfo.Height, nil
+}
 
-	// Send message to peer and wait for response
-	responseChan := make(chan *network.Message, 1)
-	errChan := make(chan error, 1)
+// syncHeaders downloads and validates the headers of the peer's chain after
+// the last block both chains share, and returns the index of that block.
+// The first request carries a block locator of the local chain, so the fork
+// point is found in one round trip; later ones continue from the last header
+// received until the peer sends a partial batch or MaxHeaders headers have
+// been accepted. Each batch is validated against the local chain up to the
+// fork point and the headers received before it.
+func (sm *SyncManager) syncHeaders(ctx context.Context, session *syncSession, config SyncConfig) (int, []*blockchain.BlockHeader, error) {
+	locator := sm.localChain.BlockLocator()
+	fork := -1
+	var headers []*blockchain.BlockHeader
+	var chain []*blockchain.BlockHeader // Local headers up to the fork, then the headers received
+
+	for {
+		msg, err := network.NewGetHeadersMessage(locator, nil)
+		if err != nil {
+			return -1, nil, fmt.Errorf("failed to create get headers message: %w", err)
+		}
+		response, err := session.request(ctx, msg, network.MessageTypeHeaders, config.Timeout)
+		if err != nil {
+			return -1, nil, err
+		}
+		batch, err := blockchain.DecodeHeaders(response.Payload)
+		if err != nil {
+			return -1, nil, fmt.Errorf("failed to parse headers: %w", err)
+		}
+		if len(batch) > network.MaxHeadersPerMessage {
+			return -1, nil, fmt.Errorf("peer %s sent %d headers, maximum is %d",
+				session.peerAddr, len(batch), network.MaxHeadersPerMessage)
+		}
+		if len(batch) == 0 {
+			break
+		}
 
-	go func() {
-		client := network.NewClient(peerAddr, func(peer *network.Peer, msg *network.Message) {
-			if msg.Type == network.MessageTypeBlockchain {
-				responseChan <- msg
+		if len(headers) == 0 {
+			if fork = sm.localChain.LocateFork([][]byte{batch[0].PrevHash}); fork < 0 {
+				return -1, nil, fmt.Errorf("no common ancestor found")
 			}
-		})
-
-		if err := client.Connect(); err != nil {
-			errChan <- fmt.Errorf("failed to connect to peer %s: %w", peerAddr, err)
-			return
+			chain = sm.localChain.HeadersTo(fork)
 		}
-		defer client.Close()
-
-		if err := client.Send(msg); err != nil {
-			errChan <- fmt.Errorf("failed to send message to peer %s: %w", peerAddr, err)
-			return
+		full := len(batch) == network.MaxHeadersPerMessage
+		if config.MaxHeaders > 0 && len(headers)+len(batch) >= config.MaxHeaders {
+			batch = batch[:config.MaxHeaders-len(headers)]
+			full = false
 		}
-	}()
+		if err := sm.rules.ValidateHeaders(chain, batch); err != nil {
+			return -1, nil, fmt.Errorf("invalid headers from peer %s: %w", session.peerAddr, err)
+		}
+		chain = append(chain, batch...)
+		headers = append(headers, batch...)
 
-	// Get timeout from config (use default if not set)
-	timeout := sm.getTimeout()
+		sm.progressMu.Lock()
+		sm.progress.TargetHeight = fork + len(headers)
+		sm.progress.LastUpdateTime = time.Now()
+		sm.progressMu.Unlock()
 
-	// Wait for response or timeout
-	select {
-	case <-ctx.Done():
-		return -1, ctx.Err()
-	case err := <-errChan:
-		return -1, err
-	case response := <-responseChan:
-		// Parse the blockchain info from response
-		var chainInfo struct {
-			Height int `json:"height"`
+		if !full {
+			break
 		}
-		if err := json.Unmarshal(response.Payload, &chainInfo); err != nil {
-			return -1, fmt.Errorf("failed to parse chain info: %w", err)
+		locator = [][]byte{headers[len(headers)-1].Hash()}
+	}
+
+	// The locator is sparse, so the peer may start below the fork
+	for len(headers) > 0 {
+		block, err := sm.localChain.GetBlockByIndex(fork + 1)
+		if err != nil || string(block.Hash) != string(headers[0].Hash()) {
+			break
 		}
-		return chainInfo.Height, nil
-	case <-time.After(timeout):
-		return -1, fmt.Errorf("timeout waiting for chain height from peer %s", peerAddr)
+		fork++
+		headers = headers[1:]
 	}
-}
 
-// getTimeout returns the current timeout duration
-func (sm *SyncManager) getTimeout() time.Duration {
-	sm.progressMu.RLock()
-	defer sm.progressMu.RUnlock()
-	// Default to 30 seconds if not configured
-	return 30 * time.Second
+	return fork, headers, nil
 }
 
-// getPeerBlock gets a specific block from a peer
-func (sm *SyncManager) getPeerBlock(ctx context.Context, peerAddr string, index int) (*blockchain.Block, error) {
-	if sm.networkClient == nil {
-		return nil, fmt.Errorf("network client not configured")
+// downloadBlocks downloads the blocks of the headers following the block at
+// index fork from the peers of sessions. Blocks extending the local tip are
+// validated and appended as they arrive in order; a competing branch
+// replaces the local blocks after the fork once it is complete, if the
+// resulting chain is valid and has more work. The first session supplied
+// the headers and is penalized if their blocks turn out to be invalid.
+func (sm *SyncManager) downloadBlocks(ctx context.Context, sessions []*syncSession, fork int, headers []*blockchain.BlockHeader, config SyncConfig) error {
+	scheduler := newDownloadScheduler(sm, sessions, headers, config)
+
+	if fork == sm.localChain.GetChainLength()-1 {
+		return scheduler.run(ctx, func(block *blockchain.Block) error {
+			return sm.appendBlocks([]*blockchain.Block{block}, config.VerifyBlocks)
+		})
 	}
 
-	// Create a get blocks message
-	msg, err := network.NewGetBlocksMessage(uint32(index), 1)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create get blocks message: %w", err)
+	var branch []*blockchain.Block
+	if err := scheduler.run(ctx, func(block *blockchain.Block) error {
+		branch = append(branch, block)
+		return nil
+	}); err != nil {
+		return err
 	}
+	if err := sm.switchBranch(fork, branch); err != nil {
+		// The blocks match their headers, so the peer that supplied the
+		// headers offered an invalid branch
+		sm.updatePeerReputation(sessions[0], downloadInvalidBlockPenalty)
+		return err
+	}
+	return nil
+}
 
-	// Send message to peer and wait for response
-	responseChan := make(chan *network.Message, 1)
-	errChan := make(chan error, 1)
-
-	go func() {
-		client := network.NewClient(peerAddr, func(peer *network.Peer, msg *network.Message) {
-			if msg.Type == network.MessageTypeBlocks {
-				responseChan <- msg
+// appendBlocks validates blocks and appends them to the local chain
+func (sm *SyncManager) appendBlocks(blocks []*blockchain.Block, verify bool) error {
+	for _, block := range blocks {
+		height := sm.localChain.GetChainLength()
+		if verify {
+			if err := sm.rules.ValidateBlockForChain(sm.localChain, block); err != nil {
+				return fmt.Errorf("block %d validation failed: %w", height, err)
 			}
-		})
-
-		if err := client.Connect(); err != nil {
-			errChan <- fmt.Errorf("failed to connect to peer %s: %w", peerAddr, err)
-			return
 		}
-		defer client.Close()
-
-		if err := client.Send(msg); err != nil {
-			errChan <- fmt.Errorf("failed to send message to peer %s: %w", peerAddr, err)
-			return
+		if err := sm.localChain.AppendBlock(block); err != nil {
+			return fmt.Errorf("failed to add block %d: %w", height, err)
 		}
-	}()
 
-	// Wait for response or timeout
-	select {
-	case <-ctx.Done():
-		return nil, ctx.Err()
-	case err := <-errChan:
-		return nil, err
-	case response := <-responseChan:
-		// Parse the block from response
-		var blocks []*blockchain.Block
-		if err := json.Unmarshal(response.Payload, &blocks); err != nil {
-			return nil, fmt.Errorf("failed to parse blocks: %w", err)
-		}
-		if len(blocks) == 0 {
-			return nil, fmt.Errorf("no blocks received from peer %s", peerAddr)
-		}
-		return blocks[0], nil
-	case <-time.After(30 * time.Second):
-		return nil, fmt.Errorf("timeout waiting for block from peer %s", peerAddr)
+		sm.progressMu.Lock()
+		sm.progress.CurrentHeight = height
+		sm.progressMu.Unlock()
 	}
+	return nil
 }
 
-// getPeerBlocks gets a range of blocks from a peer
-func (sm *SyncManager) getPeerBlocks(ctx context.Context, peerAddr string, startIndex, count int) ([]*blockchain.Block, error) {
-	blocks := make([]*blockchain.Block, 0, count)
-
-	for i := 0; i < count; i++ {
-		block, err := sm.getPeerBlock(ctx, peerAddr, startIndex+i)
+// switchBranch replaces the local blocks after the block at index fork with
+// branch if the resulting chain is valid and has more work
+func (sm *SyncManager) switchBranch(fork int, branch []*blockchain.Block) error {
+	candidate := &blockchain.Blockchain{Blocks: make([]*blockchain.Block, 0, fork+1+len(branch))}
+	for i := 0; i <= fork; i++ {
+		block, err := sm.localChain.GetBlockByIndex(i)
 		if err != nil {
-			return nil, err
+			return fmt.Errorf("failed to get local block %d: %w", i, err)
 		}
-		blocks = append(blocks, block)
+		candidate.Blocks = append(candidate.Blocks, block)
 	}
+	candidate.Blocks = append(candidate.Blocks, branch...)
 
-	return blocks, nil
+	if err := sm.rules.ResolveFork(sm.localChain, candidate); err != nil {
+		return fmt.Errorf("failed to resolve fork: %w", err)
+	}
+
+	sm.progressMu.Lock()
+	sm.progress.CurrentHeight = sm.localChain.GetChainLength() - 1
+	sm.progressMu.Unlock()
+	return nil
 }
 
 // GetProgress returns the current synchronization progress
@@ -454,17 +538,16 @@ func (sm *SyncManager) GetProgress() *SyncProgress {
 		Errors:           make([]string, len(sm.progress.Errors)),
 		BytesReceived:    sm.progress.BytesReceived,
 		BlocksPerSecond:  sm.progress.BlocksPerSecond,
+		DownloadPeers:    sm.progress.DownloadPeers,
 	}
 	copy(progress.Errors, sm.progress.Errors)
 
 	return progress
 }
 
-// calculateBlocksPerSecond calculates the current synchronization speed
-func (sm *SyncManager) calculateBlocksPerSecond() float64 {
-	sm.progressMu.RLock()
-	defer sm.progressMu.RUnlock()
-
+// blocksPerSecondLocked calculates the current synchronization speed
+// (assumes lock is held)
+func (sm *SyncManager) blocksPerSecondLocked() float64 {
 	if sm.progress.ReceivedBlocks == 0 {
 		return 0
 	}
@@ -481,7 +564,7 @@ func (sm *SyncManager) calculateBlocksPerSecond() float64 {
 func estimateBlocksSize(blocks []*blockchain.Block) int64 {
 	var size int64
 	for _, block := range blocks {
-		size += int64(len(block.Data)) + 100 // Rough estimate
+		size += int64(block.Size()) + 100 // Rough header estimate
 	}
 	return size
 }
@@ -520,6 +603,7 @@ func (sm *SyncManager) GetSyncStats() map[string]interface{} {
 		"elapsed_time":     elapsed.String(),
 		"blocks_per_sec":   sm.progress.BlocksPerSecond,
 		"bytes_received":   sm.progress.BytesReceived,
+		"download_peers":   sm.progress.DownloadPeers,
 		"error_count":      len(sm.progress.Errors),
 	}
 }
@@ -0,0 +1,262 @@
+package crypto
+
+import (
+	"fmt"
+	"strings"
+)
+
+// AddressType identifies what an address pays to
+type AddressType byte
+
+const (
+	// AddressPubKeyHash pays to the hash of a single public key
+	AddressPubKeyHash AddressType = 0
+	// AddressScriptHash pays to the hash of a script
+	AddressScriptHash AddressType = 1
+)
+
+// String returns the name of the address type
+func (t AddressType) String() string {
+	switch t {
+	case AddressPubKeyHash:
+		return "pubkeyhash"
+	case AddressScriptHash:
+		return "scripthash"
+	default:
+		return fmt.Sprintf("unknown(%d)", byte(t))
+	}
+}
+
+// Network holds the parameters that keep addresses of different networks apart
+type Network struct {
+	Name string // Network name, e.g. "mainnet"
+	HRP  string // Human-readable prefix of Bech32 addresses
+}
+
+var (
+	// MainNet is the main network
+	MainNet = &Network{Name: "mainnet", HRP: "mxm"}
+	// TestNet is the test network; its coins have no value
+	TestNet = &Network{Name: "testnet", HRP: "tmxm"}
+
+	networks = []*Network{MainNet, TestNet}
+)
+
+// NetworkByName returns the network with the given name
+func NetworkByName(name string) (*Network, error) {
+	for _, network := range networks {
+		if network.Name == name {
+			return network, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown network: %s", name)
+}
+
+// networkByHRP returns the network using a human-readable prefix
+func networkByHRP(hrp string) (*Network, bool) {
+	for _, network := range networks {
+		if network.HRP == hrp {
+			return network, true
+		}
+	}
+	return nil, false
+}
+
+// Address is a decoded address: the network and type it belongs to and the
+// 20-byte hash it pays to
+type Address struct {
+	Network *Network
+	Type    AddressType
+	Hash    []byte
+}
+
+// EncodeAddress encodes a hash as a Bech32 address. The first data character
+// is the address type, followed by the hash in 5-bit groups.
+func EncodeAddress(network *Network, addressType AddressType, hash []byte) (string, error) {
+	if network == nil {
+		return "", fmt.Errorf("network is nil")
+	}
+	if len(hash) != AddressSize {
+		return "", fmt.Errorf("address hash must be %d bytes, got %d", AddressSize, len(hash))
+	}
+	if addressType != AddressPubKeyHash && addressType != AddressScriptHash {
+		return "", fmt.Errorf("unknown address type %d", addressType)
+	}
+
+	data := append([]byte{byte(addressType)}, convertBits(hash, 8, 5, true)...)
+	return bech32Encode(network.HRP, data), nil
+}
+
+// DecodeAddress parses and checks an address. The Bech32 checksum detects any
+// error in up to four characters, so mistyped addresses are rejected.
+func DecodeAddress(address string) (*Address, error) {
+	hrp, data, err := bech32Decode(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address %q: %w", address, err)
+	}
+
+	network, ok := networkByHRP(hrp)
+	if !ok {
+		return nil, fmt.Errorf("invalid address %q: unknown network prefix %q", address, hrp)
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("invalid address %q: missing address type", address)
+	}
+
+	addressType := AddressType(data[0])
+	if addressType != AddressPubKeyHash && addressType != AddressScriptHash {
+		return nil, fmt.Errorf("invalid address %q: unknown address type %d", address, data[0])
+	}
+
+	hash, err := convertBitsStrict(data[1:])
+	if err != nil {
+		return nil, fmt.Errorf("invalid address %q: %w", address, err)
+	}
+	if len(hash) != AddressSize {
+		return nil, fmt.Errorf("invalid address %q: hash must be %d bytes, got %d", address, AddressSize, len(hash))
+	}
+
+	return &Address{Network: network, Type: addressType, Hash: hash}, nil
+}
+
+// DecodeAddressForNetwork parses an address and checks that it belongs to network
+func DecodeAddressForNetwork(address string, network *Network) (*Address, error) {
+	decoded, err := DecodeAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	if network != nil && decoded.Network != network {
+		return nil, fmt.Errorf("address %q is for %s, expected %s", address, decoded.Network.Name, network.Name)
+	}
+	return decoded, nil
+}
+
+// String returns the canonical lowercase encoding of the address
+func (a *Address) String() string {
+	encoded, err := EncodeAddress(a.Network, a.Type, a.Hash)
+	if err != nil {
+		return ""
+	}
+	return encoded
+}
+
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+var bech32Generator = [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+
+// bech32Polymod computes the BCH checksum of BIP173
+func bech32Polymod(values []byte) uint32 {
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := 0; i < 5; i++ {
+			if (top>>uint(i))&1 == 1 {
+				chk ^= bech32Generator[i]
+			}
+		}
+	}
+	return chk
+}
+
+// bech32HRPExpand prepares the human-readable prefix for checksumming
+func bech32HRPExpand(hrp string) []byte {
+	expanded := make([]byte, 0, len(hrp)*2+1)
+	for i := 0; i < len(hrp); i++ {
+		expanded = append(expanded, hrp[i]>>5)
+	}
+	expanded = append(expanded, 0)
+	for i := 0; i < len(hrp); i++ {
+		expanded = append(expanded, hrp[i]&31)
+	}
+	return expanded
+}
+
+// bech32Encode encodes 5-bit data with a human-readable prefix and checksum
+func bech32Encode(hrp string, data []byte) string {
+	values := append(bech32HRPExpand(hrp), data...)
+	polymod := bech32Polymod(append(values, 0, 0, 0, 0, 0, 0)) ^ 1
+
+	var sb strings.Builder
+	sb.WriteString(hrp)
+	sb.WriteByte('1')
+	for _, d := range data {
+		sb.WriteByte(bech32Charset[d])
+	}
+	for i := 0; i < 6; i++ {
+		sb.WriteByte(bech32Charset[(polymod>>uint(5*(5-i)))&31])
+	}
+	return sb.String()
+}
+
+// bech32Decode splits a Bech32 string into its prefix and 5-bit data, after
+// verifying the checksum
+func bech32Decode(s string) (string, []byte, error) {
+	if len(s) > 90 {
+		return "", nil, fmt.Errorf("too long")
+	}
+	lower := strings.ToLower(s)
+	if lower != s && strings.ToUpper(s) != s {
+		return "", nil, fmt.Errorf("mixed case")
+	}
+
+	sep := strings.LastIndexByte(lower, '1')
+	if sep < 1 || sep+7 > len(lower) {
+		return "", nil, fmt.Errorf("missing separator or checksum")
+	}
+
+	hrp := lower[:sep]
+	for i := 0; i < len(hrp); i++ {
+		if hrp[i] < 33 || hrp[i] > 126 {
+			return "", nil, fmt.Errorf("invalid prefix character")
+		}
+	}
+
+	data := make([]byte, 0, len(lower)-sep-1)
+	for i := sep + 1; i < len(lower); i++ {
+		d := strings.IndexByte(bech32Charset, lower[i])
+		if d < 0 {
+			return "", nil, fmt.Errorf("invalid character %q", lower[i])
+		}
+		data = append(data, byte(d))
+	}
+
+	if bech32Polymod(append(bech32HRPExpand(hrp), data...)) != 1 {
+		return "", nil, fmt.Errorf("checksum mismatch")
+	}
+	return hrp, data[:len(data)-6], nil
+}
+
+// convertBits regroups data from fromBits-bit to toBits-bit values
+func convertBits(data []byte, fromBits, toBits uint, pad bool) []byte {
+	var acc uint32
+	var bits uint
+	maxValue := uint32(1)<<toBits - 1
+	out := make([]byte, 0, len(data)*int(fromBits)/int(toBits)+1)
+	for _, v := range data {
+		acc = acc<<fromBits | uint32(v)
+		bits += fromBits
+		for bits >= toBits {
+			bits -= toBits
+			out = append(out, byte(acc>>bits&maxValue))
+		}
+	}
+	if pad && bits > 0 {
+		out = append(out, byte(acc<<(toBits-bits)&maxValue))
+	}
+	return out
+}
+
+// convertBitsStrict converts 5-bit groups back to bytes, rejecting non-zero
+// or oversized padding
+func convertBitsStrict(data []byte) ([]byte, error) {
+	out := convertBits(data, 5, 8, false)
+	bits := uint(len(data)*5) % 8
+	if bits >= 5 {
+		return nil, fmt.Errorf("invalid padding")
+	}
+	if bits > 0 && data[len(data)-1]&(1<<bits-1) != 0 {
+		return nil, fmt.Errorf("non-zero padding")
+	}
+	return out, nil
+}
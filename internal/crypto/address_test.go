@@ -0,0 +1,110 @@
+package crypto
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestBech32Vectors(t *testing.T) {
+	valid := []string{
+		"A12UEL5L",
+		"an83characterlonghumanreadablepartthatcontainsthenumber1andtheexcludedcharactersbio1tt5tgs",
+		"abcdef1qpzry9x8gf2tvdw0s3jn54khce6mua7lmqqqxw",
+		"split1checkupstagehandshakeupstreamerranterredcaperred2y9e3w",
+	}
+	for _, s := range valid {
+		if _, _, err := bech32Decode(s); err != nil {
+			t.Errorf("%s should be valid: %v", s, err)
+		}
+	}
+
+	invalid := []string{
+		"pzry9x0s0muk",  // no separator
+		"1pzry9x0s0muk", // empty prefix
+		"x1b4n0q5v",     // invalid character
+		"li1dgmt3",      // checksum too short
+		"A1G7SGD8",      // checksum computed with uppercase prefix
+	}
+	for _, s := range invalid {
+		if _, _, err := bech32Decode(s); err == nil {
+			t.Errorf("%s should be invalid", s)
+		}
+	}
+}
+
+func TestEncodeDecodeAddress(t *testing.T) {
+	hash := bytes.Repeat([]byte{0xab}, AddressSize)
+
+	for _, network := range []*Network{MainNet, TestNet} {
+		for _, addressType := range []AddressType{AddressPubKeyHash, AddressScriptHash} {
+			address, err := EncodeAddress(network, addressType, hash)
+			if err != nil {
+				t.Fatalf("EncodeAddress failed: %v", err)
+			}
+			if !strings.HasPrefix(address, network.HRP+"1") {
+				t.Errorf("Address %s should start with %s1", address, network.HRP)
+			}
+
+			decoded, err := DecodeAddress(address)
+			if err != nil {
+				t.Fatalf("DecodeAddress failed: %v", err)
+			}
+			if decoded.Network != network || decoded.Type != addressType || !bytes.Equal(decoded.Hash, hash) {
+				t.Errorf("Decoded %+v doesn't match", decoded)
+			}
+			if decoded.String() != address {
+				t.Errorf("Expected %s, got %s", address, decoded.String())
+			}
+
+			// Uppercase is the same address
+			if _, err := DecodeAddress(strings.ToUpper(address)); err != nil {
+				t.Errorf("Uppercase address should decode: %v", err)
+			}
+		}
+	}
+
+	if _, err := EncodeAddress(MainNet, AddressPubKeyHash, hash[:10]); err == nil {
+		t.Error("Expected error for short hash")
+	}
+	if _, err := EncodeAddress(MainNet, AddressType(7), hash); err == nil {
+		t.Error("Expected error for unknown address type")
+	}
+}
+
+func TestAddressRejectsTyposAndWrongNetwork(t *testing.T) {
+	keyPair, err := NewKeyPairForNetwork(TestNet)
+	if err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+	address := keyPair.Address
+
+	// Every single-character substitution is detected
+	sep := strings.LastIndexByte(address, '1')
+	for i := sep + 1; i < len(address); i++ {
+		for _, c := range bech32Charset {
+			if byte(c) == address[i] {
+				continue
+			}
+			typo := address[:i] + string(c) + address[i+1:]
+			if ValidateAddress(typo) {
+				t.Fatalf("Typo %s accepted", typo)
+			}
+		}
+	}
+
+	if _, err := DecodeAddressForNetwork(address, TestNet); err != nil {
+		t.Errorf("Address should be valid on testnet: %v", err)
+	}
+	if _, err := DecodeAddressForNetwork(address, MainNet); err == nil {
+		t.Error("Testnet address should be rejected on mainnet")
+	}
+	if !AddressMatchesPublicKey(address, keyPair.PublicKey) {
+		t.Error("Address should match its public key")
+	}
+
+	network, err := NetworkByName("testnet")
+	if err != nil || network != TestNet {
+		t.Errorf("Expected testnet, got %v (%v)", network, err)
+	}
+}
@@ -0,0 +1,172 @@
+package crypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// HardenedKeyStart is the first hardened child index. Hardened children are
+// derived from the parent private key, so a leaked child key and parent chain
+// code cannot be used to recover the parent.
+const HardenedKeyStart uint32 = 0x80000000
+
+// ErrInvalidChild is returned for the rare child indexes that do not give a
+// valid key; callers should skip to the next index
+var ErrInvalidChild = errors.New("derived key is invalid")
+
+// masterKeySalt is the HMAC key used to derive the master key from a seed
+var masterKeySalt = []byte("Bitcoin seed")
+
+// ExtendedKey is a private key with the chain code needed to derive child
+// keys, as described in BIP32
+type ExtendedKey struct {
+	privateKey *ecdsa.PrivateKey
+	chainCode  []byte
+	depth      uint8
+	index      uint32
+}
+
+// NewMasterKey derives the root key of a hierarchy from a seed
+func NewMasterKey(seed []byte) (*ExtendedKey, error) {
+	if len(seed) < 16 || len(seed) > 64 {
+		return nil, fmt.Errorf("invalid seed length: %d bytes", len(seed))
+	}
+
+	mac := hmac.New(sha512.New, masterKeySalt)
+	mac.Write(seed)
+	sum := mac.Sum(nil)
+
+	privateKey, err := PrivateKeyFromBytes(sum[:32])
+	if err != nil {
+		return nil, fmt.Errorf("invalid master key: %w", err)
+	}
+	return &ExtendedKey{
+		privateKey: privateKey,
+		chainCode:  sum[32:],
+	}, nil
+}
+
+// Child derives the child key at index. Indexes from HardenedKeyStart upwards
+// give hardened children.
+func (k *ExtendedKey) Child(index uint32) (*ExtendedKey, error) {
+	if k.depth == 255 {
+		return nil, fmt.Errorf("cannot derive beyond depth 255")
+	}
+
+	data := make([]byte, 0, 37)
+	if index >= HardenedKeyStart {
+		data = append(data, 0x00)
+		data = append(data, privateKeyBytes(k.privateKey)...)
+	} else {
+		data = append(data, CompressPublicKey(&k.privateKey.PublicKey)...)
+	}
+	data = binary.BigEndian.AppendUint32(data, index)
+
+	mac := hmac.New(sha512.New, k.chainCode)
+	mac.Write(data)
+	sum := mac.Sum(nil)
+
+	n := k.privateKey.Curve.Params().N
+	tweak := new(big.Int).SetBytes(sum[:32])
+	if tweak.Cmp(n) >= 0 {
+		return nil, ErrInvalidChild
+	}
+	childScalar := tweak.Add(tweak, k.privateKey.D)
+	childScalar.Mod(childScalar, n)
+	if childScalar.Sign() == 0 {
+		return nil, ErrInvalidChild
+	}
+
+	privateKey, err := PrivateKeyFromBytes(childScalar.FillBytes(make([]byte, PrivateKeySize)))
+	if err != nil {
+		return nil, err
+	}
+	return &ExtendedKey{
+		privateKey: privateKey,
+		chainCode:  sum[32:],
+		depth:      k.depth + 1,
+		index:      index,
+	}, nil
+}
+
+// DerivePath derives a descendant key from a path such as "m/44'/0'/0'/0/1".
+// The path must start at this key ("m").
+func (k *ExtendedKey) DerivePath(path string) (*ExtendedKey, error) {
+	indexes, err := ParseDerivationPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	key := k
+	for _, index := range indexes {
+		key, err = key.Child(index)
+		if err != nil {
+			return nil, fmt.Errorf("failed to derive %s: %w", path, err)
+		}
+	}
+	return key, nil
+}
+
+// ParseDerivationPath converts a path such as "m/44'/0'/0'" into child
+// indexes. Hardened levels are marked with ' or h.
+func ParseDerivationPath(path string) ([]uint32, error) {
+	parts := strings.Split(strings.TrimSpace(path), "/")
+	if parts[0] != "m" {
+		return nil, fmt.Errorf("invalid derivation path %q: must start with m", path)
+	}
+
+	indexes := make([]uint32, 0, len(parts)-1)
+	for _, part := range parts[1:] {
+		hardened := strings.HasSuffix(part, "'") || strings.HasSuffix(part, "h")
+		if hardened {
+			part = part[:len(part)-1]
+		}
+		value, err := strconv.ParseUint(part, 10, 32)
+		if err != nil || uint32(value) >= HardenedKeyStart {
+			return nil, fmt.Errorf("invalid derivation path %q: bad index %q", path, part)
+		}
+		index := uint32(value)
+		if hardened {
+			index += HardenedKeyStart
+		}
+		indexes = append(indexes, index)
+	}
+	return indexes, nil
+}
+
+// KeyPair returns the key pair and mainnet address of this key
+func (k *ExtendedKey) KeyPair() (*KeyPair, error) {
+	return GetKeyPairFromPrivate(k.privateKey)
+}
+
+// KeyPairForNetwork returns the key pair and its address on network
+func (k *ExtendedKey) KeyPairForNetwork(network *Network) (*KeyPair, error) {
+	return GetKeyPairFromPrivateForNetwork(k.privateKey, network)
+}
+
+// PrivateKey returns the private key
+func (k *ExtendedKey) PrivateKey() *ecdsa.PrivateKey {
+	return k.privateKey
+}
+
+// ChainCode returns the chain code used to derive children
+func (k *ExtendedKey) ChainCode() []byte {
+	return append([]byte{}, k.chainCode...)
+}
+
+// Depth returns the number of derivation steps from the master key
+func (k *ExtendedKey) Depth() uint8 {
+	return k.depth
+}
+
+// Index returns the child index this key was derived with
+func (k *ExtendedKey) Index() uint32 {
+	return k.index
+}
@@ -0,0 +1,110 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestExtendedKeyDerivation(t *testing.T) {
+	seed, err := MnemonicToSeed("abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about", "")
+	if err != nil {
+		t.Fatalf("MnemonicToSeed failed: %v", err)
+	}
+	master, err := NewMasterKey(seed)
+	if err != nil {
+		t.Fatalf("NewMasterKey failed: %v", err)
+	}
+
+	key, err := master.DerivePath("m/44'/0'/0'/0/1")
+	if err != nil {
+		t.Fatalf("DerivePath failed: %v", err)
+	}
+	if key.Depth() != 5 || key.Index() != 1 {
+		t.Errorf("Expected depth 5 index 1, got depth %d index %d", key.Depth(), key.Index())
+	}
+
+	// Deriving step by step gives the same key
+	step := master
+	for _, index := range []uint32{44 + HardenedKeyStart, HardenedKeyStart, HardenedKeyStart, 0, 1} {
+		step, err = step.Child(index)
+		if err != nil {
+			t.Fatalf("Child failed: %v", err)
+		}
+	}
+	if step.PrivateKey().D.Cmp(key.PrivateKey().D) != 0 || !bytes.Equal(step.ChainCode(), key.ChainCode()) {
+		t.Error("Step-by-step derivation should match DerivePath")
+	}
+
+	// Hardened and normal children differ
+	normal, _ := master.Child(0)
+	hardened, _ := master.Child(HardenedKeyStart)
+	if normal.PrivateKey().D.Cmp(hardened.PrivateKey().D) == 0 {
+		t.Error("Hardened child should differ from normal child")
+	}
+
+	keyPair, err := key.KeyPair()
+	if err != nil {
+		t.Fatalf("KeyPair failed: %v", err)
+	}
+	if !keyPair.IsValidKeyPair() {
+		t.Error("Derived key pair should be valid")
+	}
+}
+
+func TestParseDerivationPath(t *testing.T) {
+	indexes, err := ParseDerivationPath("m/44'/1h/2")
+	if err != nil {
+		t.Fatalf("ParseDerivationPath failed: %v", err)
+	}
+	expected := []uint32{44 + HardenedKeyStart, 1 + HardenedKeyStart, 2}
+	if len(indexes) != len(expected) {
+		t.Fatalf("Expected %d indexes, got %d", len(expected), len(indexes))
+	}
+	for i := range expected {
+		if indexes[i] != expected[i] {
+			t.Errorf("Index %d: expected %d, got %d", i, expected[i], indexes[i])
+		}
+	}
+
+	for _, path := range []string{"", "44'/0'", "m/x", "m/2147483648"} {
+		if _, err := ParseDerivationPath(path); err == nil {
+			t.Errorf("Path %q should be invalid", path)
+		}
+	}
+
+	if _, err := NewMasterKey(make([]byte, 8)); err == nil {
+		t.Error("Expected error for short seed")
+	}
+}
+
+func TestExtendedKeyBIP32Vector(t *testing.T) {
+	seed, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+	master, err := NewMasterKey(seed)
+	if err != nil {
+		t.Fatalf("NewMasterKey failed: %v", err)
+	}
+
+	vectors := []struct {
+		path      string
+		chainCode string
+		key       string
+	}{
+		{"m", "873dff81c02f525623fd1fe5167eac3a55a049de3d314bb42ee227ffed37d508", "e8f32e723decf4051aefac8e2c93c9c5b214313817cdb01a1494b917c8436b35"},
+		{"m/0'", "47fdacbd0f1097043b78c63c20c34ef4ed9a111d980047ad16282c7ae6236141", "edb2e14f9ee77d26dd93b4ecede8d16ed408ce149b6cd80b0715a2d911a0afea"},
+		{"m/0'/1", "2a7857631386ba23dacac34180dd1983734e444fdbf774041578e9b6adb37c19", "3c6cb8d0f6a264c91ea8b5030fadaa8e538b020f0a387421a12de9319dc93368"},
+	}
+
+	for _, v := range vectors {
+		key, err := master.DerivePath(v.path)
+		if err != nil {
+			t.Fatalf("DerivePath(%s) failed: %v", v.path, err)
+		}
+		if got := hex.EncodeToString(key.ChainCode()); got != v.chainCode {
+			t.Errorf("%s: expected chain code %s, got %s", v.path, v.chainCode, got)
+		}
+		if got := hex.EncodeToString(privateKeyBytes(key.PrivateKey())); got != v.key {
+			t.Errorf("%s: expected key %s, got %s", v.path, v.key, got)
+		}
+	}
+}
@@ -3,10 +3,11 @@ package crypto
 import (
 	"bytes"
 	"crypto/ecdsa"
-	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/sha256"
 	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
 	"encoding/hex"
 	"encoding/json"
 	"encoding/pem"
@@ -30,56 +31,66 @@ type KeyStorage struct {
 	Address       string `json:"address"`
 }
 
-// NewKeyPair generates a new ECDSA key pair using secp256k1 curve
+// AddressSize is the number of hash bytes an address pays to
+const AddressSize = 20
+
+var (
+	oidPublicKeyECDSA      = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	oidNamedCurveSecp256k1 = asn1.ObjectIdentifier{1, 3, 132, 0, 10}
+)
+
+// ecPrivateKey is the SEC 1 private key structure. crypto/x509 only knows
+// the NIST curves, so secp256k1 keys are marshalled here.
+type ecPrivateKey struct {
+	Version       int
+	PrivateKey    []byte
+	NamedCurveOID asn1.ObjectIdentifier `asn1:"optional,explicit,tag:0"`
+	PublicKey     asn1.BitString        `asn1:"optional,explicit,tag:1"`
+}
+
+// publicKeyInfo is the PKIX SubjectPublicKeyInfo structure
+type publicKeyInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	PublicKey asn1.BitString
+}
+
+// NewKeyPair generates a new ECDSA key pair using secp256k1 curve, with a
+// mainnet address
 func NewKeyPair() (*KeyPair, error) {
-	// Use secp256k1 curve (same as Bitcoin)
-	curve := elliptic.P256()
+	return NewKeyPairForNetwork(MainNet)
+}
 
-	privateKey, err := ecdsa.GenerateKey(curve, rand.Reader)
+// NewKeyPairForNetwork generates a new key pair with an address on network
+func NewKeyPairForNetwork(network *Network) (*KeyPair, error) {
+	// Use secp256k1 curve (same as Bitcoin)
+	privateKey, err := ecdsa.GenerateKey(Secp256k1(), rand.Reader)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate private key: %w", err)
 	}
 
-	publicKey := &privateKey.PublicKey
-	address, err := generateAddress(publicKey)
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate address: %w", err)
-	}
-
-	return &KeyPair{
-		PrivateKey: privateKey,
-		PublicKey:  publicKey,
-		Address:    address,
-	}, nil
+	return GetKeyPairFromPrivateForNetwork(privateKey, network)
 }
 
-// generateAddress creates an address from a public key
-func generateAddress(publicKey *ecdsa.PublicKey) (string, error) {
-	// Serialize public key in uncompressed format (0x04 + X + Y)
-	pubKeyBytes := make([]byte, 0, 65)
-	pubKeyBytes = append(pubKeyBytes, 0x04)
-	pubKeyBytes = append(pubKeyBytes, publicKey.X.Bytes()...)
-	pubKeyBytes = append(pubKeyBytes, publicKey.Y.Bytes()...)
-
-	// Double SHA256 for better collision resistance (like Bitcoin)
-	hash1 := sha256.Sum256(pubKeyBytes)
+// Hash160 returns the 20-byte hash used in addresses: the first bytes of the
+// double SHA256 of data
+func Hash160(data []byte) []byte {
+	hash1 := sha256.Sum256(data)
 	hash2 := sha256.Sum256(hash1[:])
+	return hash2[:AddressSize]
+}
 
-	// Take first 20 bytes of double hash as address bytes
-	addressBytes := hash2[:20]
-
-	// Calculate checksum by double hashing the address bytes
-	checksumHash1 := sha256.Sum256(addressBytes)
-	checksumHash2 := sha256.Sum256(checksumHash1[:])
-	checksum := checksumHash2[:4]
-
-	// Combine address bytes and checksum
-	fullAddress := append(addressBytes, checksum...)
-
-	// Convert to hex string with prefix
-	address := "0x" + hex.EncodeToString(fullAddress)
+// PublicKeyHash returns the 20-byte hash that addresses pay to, the Hash160
+// of the compressed key
+func PublicKeyHash(publicKey *ecdsa.PublicKey) []byte {
+	return Hash160(CompressPublicKey(publicKey))
+}
 
-	return address, nil
+// generateAddress creates the pay-to-public-key-hash address of a public key
+func generateAddress(publicKey *ecdsa.PublicKey, network *Network) (string, error) {
+	if publicKey == nil || publicKey.X == nil || publicKey.Y == nil {
+		return "", fmt.Errorf("public key is nil")
+	}
+	return EncodeAddress(network, AddressPubKeyHash, PublicKeyHash(publicKey))
 }
 
 // SerializePrivateKey converts private key to PEM format
@@ -87,7 +98,7 @@ func SerializePrivateKey(privateKey *ecdsa.PrivateKey) (string, error) {
 	if privateKey == nil {
 		return "", fmt.Errorf("private key is nil")
 	}
-	derBytes, err := x509.MarshalECPrivateKey(privateKey)
+	derBytes, err := marshalPrivateKey(privateKey)
 	if err != nil {
 		return "", fmt.Errorf("failed to marshal private key: %w", err)
 	}
@@ -105,7 +116,7 @@ func SerializePublicKey(publicKey *ecdsa.PublicKey) (string, error) {
 	if publicKey == nil {
 		return "", fmt.Errorf("public key is nil")
 	}
-	derBytes, err := x509.MarshalPKIXPublicKey(publicKey)
+	derBytes, err := marshalPublicKey(publicKey)
 	if err != nil {
 		return "", fmt.Errorf("failed to marshal public key: %w", err)
 	}
@@ -125,7 +136,7 @@ func DeserializePrivateKey(pemData string) (*ecdsa.PrivateKey, error) {
 		return nil, fmt.Errorf("failed to decode PEM block")
 	}
 
-	privateKey, err := x509.ParseECPrivateKey(block.Bytes)
+	privateKey, err := parsePrivateKey(block.Bytes)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse private key: %w", err)
 	}
@@ -140,6 +151,15 @@ func DeserializePublicKey(pemData string) (*ecdsa.PublicKey, error) {
 		return nil, fmt.Errorf("failed to decode PEM block")
 	}
 
+	var info publicKeyInfo
+	if rest, err := asn1.Unmarshal(block.Bytes, &info); err == nil && len(rest) == 0 && isSecp256k1Algorithm(info.Algorithm) {
+		publicKey, err := DecompressPublicKey(info.PublicKey.RightAlign())
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse public key: %w", err)
+		}
+		return publicKey, nil
+	}
+
 	publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse public key: %w", err)
@@ -153,6 +173,62 @@ func DeserializePublicKey(pemData string) (*ecdsa.PublicKey, error) {
 	return ecPublicKey, nil
 }
 
+// marshalPrivateKey encodes a private key as SEC 1 DER
+func marshalPrivateKey(privateKey *ecdsa.PrivateKey) ([]byte, error) {
+	if privateKey.Curve != Secp256k1() {
+		return x509.MarshalECPrivateKey(privateKey)
+	}
+	return asn1.Marshal(ecPrivateKey{
+		Version:       1,
+		PrivateKey:    privateKeyBytes(privateKey),
+		NamedCurveOID: oidNamedCurveSecp256k1,
+		PublicKey:     asn1.BitString{Bytes: CompressPublicKey(&privateKey.PublicKey), BitLength: 8 * PublicKeySize},
+	})
+}
+
+// parsePrivateKey decodes a SEC 1 DER private key
+func parsePrivateKey(der []byte) (*ecdsa.PrivateKey, error) {
+	var key ecPrivateKey
+	if rest, err := asn1.Unmarshal(der, &key); err == nil && len(rest) == 0 && key.NamedCurveOID.Equal(oidNamedCurveSecp256k1) {
+		if len(key.PrivateKey) > PrivateKeySize {
+			return nil, fmt.Errorf("private key too long")
+		}
+		scalar := make([]byte, PrivateKeySize)
+		copy(scalar[PrivateKeySize-len(key.PrivateKey):], key.PrivateKey)
+		return PrivateKeyFromBytes(scalar)
+	}
+	return x509.ParseECPrivateKey(der)
+}
+
+// marshalPublicKey encodes a public key as PKIX DER. secp256k1 keys are
+// stored compressed.
+func marshalPublicKey(publicKey *ecdsa.PublicKey) ([]byte, error) {
+	if publicKey.Curve != Secp256k1() {
+		return x509.MarshalPKIXPublicKey(publicKey)
+	}
+	params, err := asn1.Marshal(oidNamedCurveSecp256k1)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(publicKeyInfo{
+		Algorithm: pkix.AlgorithmIdentifier{
+			Algorithm:  oidPublicKeyECDSA,
+			Parameters: asn1.RawValue{FullBytes: params},
+		},
+		PublicKey: asn1.BitString{Bytes: CompressPublicKey(publicKey), BitLength: 8 * PublicKeySize},
+	})
+}
+
+// isSecp256k1Algorithm reports whether a PKIX algorithm is ECDSA on secp256k1
+func isSecp256k1Algorithm(algorithm pkix.AlgorithmIdentifier) bool {
+	if !algorithm.Algorithm.Equal(oidPublicKeyECDSA) {
+		return false
+	}
+	var curve asn1.ObjectIdentifier
+	rest, err := asn1.Unmarshal(algorithm.Parameters.FullBytes, &curve)
+	return err == nil && len(rest) == 0 && curve.Equal(oidNamedCurveSecp256k1)
+}
+
 // ToStorage converts KeyPair to KeyStorage for serialization
 func (kp *KeyPair) ToStorage() (*KeyStorage, error) {
 	privateKeyPEM, err := SerializePrivateKey(kp.PrivateKey)
@@ -237,52 +313,29 @@ func LoadFromFile(filename string) (*KeyPair, error) {
 	return FromStorage(&storage)
 }
 
-// GetPublicKeyBytes returns the public key as bytes (uncompressed format)
+// GetPublicKeyBytes returns the 33-byte compressed public key
 func (kp *KeyPair) GetPublicKeyBytes() []byte {
-	// Uncompressed format: 0x04 + X + Y
-	pubKeyBytes := make([]byte, 0, 65)
-	pubKeyBytes = append(pubKeyBytes, 0x04)
-	pubKeyBytes = append(pubKeyBytes, kp.PublicKey.X.Bytes()...)
-	pubKeyBytes = append(pubKeyBytes, kp.PublicKey.Y.Bytes()...)
-	return pubKeyBytes
+	return CompressPublicKey(kp.PublicKey)
 }
 
-// GetPrivateKeyBytes returns the private key as bytes
+// GetPrivateKeyBytes returns the private key as a 32-byte scalar
 func (kp *KeyPair) GetPrivateKeyBytes() []byte {
-	return kp.PrivateKey.D.Bytes()
+	return privateKeyBytes(kp.PrivateKey)
 }
 
-// ValidateAddress checks if an address is valid
+// ValidateAddress checks if an address is valid on any known network
 func ValidateAddress(address string) bool {
-	if !strings.HasPrefix(address, "0x") {
-		return false
-	}
-
-	hexPart := strings.TrimPrefix(address, "0x")
-	if len(hexPart) != 48 { // 24 bytes = 48 hex characters (20 address + 4 checksum)
-		return false
-	}
-
-	decodedBytes, err := hex.DecodeString(hexPart)
-	if err != nil {
-		return false
-	}
+	_, err := DecodeAddress(address)
+	return err == nil
+}
 
-	// Verify checksum
-	if len(decodedBytes) != 24 {
+// AddressMatchesPublicKey reports whether address pays to publicKey
+func AddressMatchesPublicKey(address string, publicKey *ecdsa.PublicKey) bool {
+	decoded, err := DecodeAddress(address)
+	if err != nil || decoded.Type != AddressPubKeyHash || publicKey == nil || publicKey.X == nil {
 		return false
 	}
-
-	addressBytes := decodedBytes[:20]
-	checksum := decodedBytes[20:24]
-
-	// Recalculate checksum
-	hash1 := sha256.Sum256(addressBytes)
-	hash2 := sha256.Sum256(hash1[:])
-	expectedChecksum := hash2[:4]
-
-	// Compare checksums
-	return bytes.Equal(checksum, expectedChecksum)
+	return bytes.Equal(decoded.Hash, PublicKeyHash(publicKey))
 }
 
 // DerivePublicKey derives public key from private key
@@ -290,10 +343,16 @@ func DerivePublicKey(privateKey *ecdsa.PrivateKey) *ecdsa.PublicKey {
 	return &privateKey.PublicKey
 }
 
-// GetKeyPairFromPrivate creates a KeyPair from just a private key
+// GetKeyPairFromPrivate creates a KeyPair with a mainnet address from just a
+// private key
 func GetKeyPairFromPrivate(privateKey *ecdsa.PrivateKey) (*KeyPair, error) {
+	return GetKeyPairFromPrivateForNetwork(privateKey, MainNet)
+}
+
+// GetKeyPairFromPrivateForNetwork creates a KeyPair with an address on network
+func GetKeyPairFromPrivateForNetwork(privateKey *ecdsa.PrivateKey, network *Network) (*KeyPair, error) {
 	publicKey := DerivePublicKey(privateKey)
-	address, err := generateAddress(publicKey)
+	address, err := generateAddress(publicKey, network)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate address: %w", err)
 	}
@@ -337,18 +396,8 @@ func (kp *KeyPair) IsValidKeyPair() bool {
 		return false
 	}
 
-	// Check if address is valid
-	if !ValidateAddress(kp.Address) {
-		return false
-	}
-
-	// Check if address matches public key
-	expectedAddr, err := generateAddress(kp.PublicKey)
-	if err != nil {
-		return false
-	}
-
-	return CompareAddresses(kp.Address, expectedAddr)
+	// Check if address is valid and matches public key
+	return AddressMatchesPublicKey(kp.Address, kp.PublicKey)
 }
 
 // GetKeyInfo returns information about the key pair
@@ -1,8 +1,6 @@
 package crypto
 
 import (
-	"crypto/ecdsa"
-	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
@@ -32,12 +30,12 @@ func TestNewKeyPair(t *testing.T) {
 		t.Fatal("Address is empty")
 	}
 
-	if !strings.HasPrefix(keyPair.Address, "0x") {
-		t.Errorf("Address should start with 0x, got: %s", keyPair.Address)
+	if !strings.HasPrefix(keyPair.Address, "mxm1q") {
+		t.Errorf("Address should start with mxm1q, got: %s", keyPair.Address)
 	}
 
-	if len(keyPair.Address) != 50 { // 0x + 48 hex chars (24 bytes with checksum)
-		t.Errorf("Address should be 50 characters long, got: %d", len(keyPair.Address))
+	if len(keyPair.Address) != 43 { // mxm1 + type + 32 hash chars + 6 checksum chars
+		t.Errorf("Address should be 43 characters long, got: %d", len(keyPair.Address))
 	}
 }
 
@@ -53,7 +51,7 @@ func TestGenerateAddress(t *testing.T) {
 	}
 
 	// Test address generation from public key directly
-	derivedAddr, err := generateAddress(keyPair.PublicKey)
+	derivedAddr, err := generateAddress(keyPair.PublicKey, MainNet)
 	if err != nil {
 		t.Fatalf("Failed to generate address from public key: %v", err)
 	}
@@ -75,14 +73,24 @@ func TestValidateAddress(t *testing.T) {
 		t.Errorf("Generated valid address rejected: %s", validAddress)
 	}
 
+	// Change one character, keeping it in the Bech32 charset
+	typo := []byte(validAddress)
+	if typo[10] == 'q' {
+		typo[10] = 'p'
+	} else {
+		typo[10] = 'q'
+	}
+
 	invalidAddresses := []string{
-		"1234567890123456789012345678901234567890123456789012",    // missing 0x
-		"0x123456789012345678901234567890123456789012345678901",   // too short
-		"0x12345678901234567890123456789012345678901234567890123", // too long
-		"0xg234567890123456789012345678901234567890123456789012",  // invalid hex
-		"",   // empty
-		"0x", // just prefix
-		"0x1234567890123456789012345678901234567890123456789012", // invalid checksum
+		string(typo),                       // typo
+		validAddress[:len(validAddress)-1], // too short
+		validAddress + "q",                 // too long
+		"btc" + validAddress[3:],           // unknown network
+		strings.ToUpper(validAddress[:10]) + validAddress[10:], // mixed case
+		"mxm1" + validAddress[4:len(validAddress)-1] + "b",     // invalid character
+		"",     // empty
+		"mxm1", // just prefix
+		"0x1234567890123456789012345678901234567890123456789012", // old hex format
 	}
 
 	for _, addr := range invalidAddresses {
@@ -383,8 +391,8 @@ func TestGetKeyInfo(t *testing.T) {
 		t.Error("Address in info doesn't match")
 	}
 
-	if info["curve"] != "P-256" {
-		t.Errorf("Expected curve P-256, got: %s", info["curve"])
+	if info["curve"] != "secp256k1" {
+		t.Errorf("Expected curve secp256k1, got: %s", info["curve"])
 	}
 }
 
@@ -400,26 +408,20 @@ func TestGetPublicKeyBytes(t *testing.T) {
 	}
 
 	// Verify the bytes can be unmarshaled back to a public key
-	curve := elliptic.P256()
-	if len(pubKeyBytes) != 65 || pubKeyBytes[0] != 0x04 {
+	if len(pubKeyBytes) != PublicKeySize || (pubKeyBytes[0] != 0x02 && pubKeyBytes[0] != 0x03) {
 		t.Error("Invalid public key byte format")
 	}
 
-	// Extract X and Y coordinates
-	x := new(big.Int).SetBytes(pubKeyBytes[1:33])
-	y := new(big.Int).SetBytes(pubKeyBytes[33:65])
+	reconstructedPubKey, err := DecompressPublicKey(pubKeyBytes)
+	if err != nil {
+		t.Fatalf("Failed to decompress public key: %v", err)
+	}
 
 	// Verify the point is on the curve
-	if !curve.IsOnCurve(x, y) {
+	if !Secp256k1().IsOnCurve(reconstructedPubKey.X, reconstructedPubKey.Y) {
 		t.Error("Public key point is not on the curve")
 	}
 
-	reconstructedPubKey := &ecdsa.PublicKey{
-		Curve: curve,
-		X:     x,
-		Y:     y,
-	}
-
 	if !keyPair.PublicKey.Equal(reconstructedPubKey) {
 		t.Error("Reconstructed public key doesn't match original")
 	}
@@ -432,8 +434,8 @@ func TestGetPrivateKeyBytes(t *testing.T) {
 	}
 
 	privKeyBytes := keyPair.GetPrivateKeyBytes()
-	if len(privKeyBytes) == 0 {
-		t.Error("Private key bytes should not be empty")
+	if len(privKeyBytes) != PrivateKeySize {
+		t.Errorf("Private key bytes should be %d bytes, got %d", PrivateKeySize, len(privKeyBytes))
 	}
 
 	// Verify the bytes represent the same private key
@@ -638,7 +640,7 @@ func TestKeyPairConsistency(t *testing.T) {
 	}
 
 	// Verify address is derived correctly from public key
-	expectedAddr, err := generateAddress(keyPair.PublicKey)
+	expectedAddr, err := generateAddress(keyPair.PublicKey, MainNet)
 	if err != nil {
 		t.Fatalf("Failed to generate expected address: %v", err)
 	}
@@ -708,7 +710,7 @@ func BenchmarkGenerateAddress(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		_, err := generateAddress(keyPair.PublicKey)
+		_, err := generateAddress(keyPair.PublicKey, MainNet)
 		if err != nil {
 			b.Fatalf("Failed to generate address: %v", err)
 		}
@@ -0,0 +1,145 @@
+package crypto
+
+import (
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+const (
+	// DefaultEntropyBits gives a 12-word mnemonic
+	DefaultEntropyBits = 128
+	// MnemonicSeedSize is the length of the seed derived from a mnemonic
+	MnemonicSeedSize = 64
+
+	mnemonicSeedIterations = 2048
+	bitsPerWord            = 11
+)
+
+// NewEntropy returns random entropy for a mnemonic. bits must be a multiple
+// of 32 between 128 and 256.
+func NewEntropy(bits int) ([]byte, error) {
+	if err := validateEntropyBits(bits); err != nil {
+		return nil, err
+	}
+	entropy := make([]byte, bits/8)
+	if _, err := rand.Read(entropy); err != nil {
+		return nil, fmt.Errorf("failed to generate entropy: %w", err)
+	}
+	return entropy, nil
+}
+
+// NewMnemonic generates a new random mnemonic phrase with the given entropy size
+func NewMnemonic(bits int) (string, error) {
+	entropy, err := NewEntropy(bits)
+	if err != nil {
+		return "", err
+	}
+	return EntropyToMnemonic(entropy)
+}
+
+// EntropyToMnemonic encodes entropy as BIP39 words. A checksum of
+// len(entropy)/4 bits, taken from its SHA-256 hash, is appended before the
+// bits are split into 11-bit word indexes.
+func EntropyToMnemonic(entropy []byte) (string, error) {
+	bits := len(entropy) * 8
+	if err := validateEntropyBits(bits); err != nil {
+		return "", err
+	}
+	checksumBits := bits / 32
+	wordCount := (bits + checksumBits) / bitsPerWord
+
+	hash := sha256.Sum256(entropy)
+	value := new(big.Int).SetBytes(entropy)
+	value.Lsh(value, uint(checksumBits))
+	value.Or(value, big.NewInt(int64(hash[0]>>(8-checksumBits))))
+
+	words := make([]string, wordCount)
+	mask := big.NewInt(1<<bitsPerWord - 1)
+	index := new(big.Int)
+	for i := wordCount - 1; i >= 0; i-- {
+		index.And(value, mask)
+		words[i] = englishWords[index.Int64()]
+		value.Rsh(value, bitsPerWord)
+	}
+	return strings.Join(words, " "), nil
+}
+
+// MnemonicToEntropy decodes a mnemonic phrase and verifies its checksum
+func MnemonicToEntropy(mnemonic string) ([]byte, error) {
+	words := strings.Fields(mnemonic)
+	totalBits := len(words) * bitsPerWord
+	checksumBits := totalBits / 33
+	bits := totalBits - checksumBits
+	if len(words)%3 != 0 || validateEntropyBits(bits) != nil {
+		return nil, fmt.Errorf("invalid mnemonic length: %d words", len(words))
+	}
+
+	value := new(big.Int)
+	for _, word := range words {
+		index, ok := wordIndex(word)
+		if !ok {
+			return nil, fmt.Errorf("invalid mnemonic word: %q", word)
+		}
+		value.Lsh(value, bitsPerWord)
+		value.Or(value, big.NewInt(int64(index)))
+	}
+
+	checksum := new(big.Int).And(value, big.NewInt(1<<checksumBits-1)).Int64()
+	value.Rsh(value, uint(checksumBits))
+	entropy := value.FillBytes(make([]byte, bits/8))
+
+	hash := sha256.Sum256(entropy)
+	if int64(hash[0]>>(8-checksumBits)) != checksum {
+		return nil, fmt.Errorf("invalid mnemonic checksum")
+	}
+	return entropy, nil
+}
+
+// ValidateMnemonic checks that a phrase uses known words and has a valid checksum
+func ValidateMnemonic(mnemonic string) bool {
+	_, err := MnemonicToEntropy(mnemonic)
+	return err == nil
+}
+
+// MnemonicToSeed stretches a mnemonic and optional passphrase into a 64-byte
+// seed with PBKDF2-HMAC-SHA512. The phrase is not validated, matching BIP39.
+// The English wordlist is ASCII, so only the passphrase could need Unicode
+// normalization; it is used as given.
+func MnemonicToSeed(mnemonic, passphrase string) ([]byte, error) {
+	password := strings.Join(strings.Fields(mnemonic), " ")
+	seed, err := pbkdf2.Key(sha512.New, password, []byte("mnemonic"+passphrase), mnemonicSeedIterations, MnemonicSeedSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive seed: %w", err)
+	}
+	return seed, nil
+}
+
+// wordIndex returns the position of a word in the wordlist
+func wordIndex(word string) (int, bool) {
+	lo, hi := 0, len(englishWords)
+	for lo < hi {
+		mid := (lo + hi) / 2
+		switch {
+		case englishWords[mid] == word:
+			return mid, true
+		case englishWords[mid] < word:
+			lo = mid + 1
+		default:
+			hi = mid
+		}
+	}
+	return 0, false
+}
+
+// validateEntropyBits checks the entropy size allowed by BIP39
+func validateEntropyBits(bits int) error {
+	if bits < 128 || bits > 256 || bits%32 != 0 {
+		return fmt.Errorf("invalid entropy size: %d bits (must be a multiple of 32 between 128 and 256)", bits)
+	}
+	return nil
+}
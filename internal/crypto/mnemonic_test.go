@@ -0,0 +1,87 @@
+package crypto
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestMnemonicVectors(t *testing.T) {
+	vectors := []struct {
+		entropy  string
+		mnemonic string
+		seed     string
+	}{
+		{
+			entropy:  "00000000000000000000000000000000",
+			mnemonic: "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about",
+			seed:     "c55257c360c07c72029aebc1b53c05ed0362ada38ead3e3e9efa3708e53495531f09a6987599d18264c1e1c92f2cf141630c7a3c4ab7c81b2f001698e7463b04",
+		},
+		{
+			entropy:  "7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f",
+			mnemonic: "legal winner thank year wave sausage worth useful legal winner thank yellow",
+			seed:     "2e8905819b8723fe2c1d161860e5ee1830318dbf49a83bd451cfb8440c28bd6fa457fe1296106559a3c80937a1c1069be3a3a5bd381ee6260e8d9739fce1f607",
+		},
+		{
+			entropy:  "ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff",
+			mnemonic: "zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo vote",
+			seed:     "dd48c104698c30cfe2b6142103248622fb7bb0ff692eebb00089b32d22484e1613912f0a5b694407be899ffd31ed3992c456cdf60f5d4564b8ba3f05a69890ad",
+		},
+	}
+
+	for _, v := range vectors {
+		entropy, _ := hex.DecodeString(v.entropy)
+		mnemonic, err := EntropyToMnemonic(entropy)
+		if err != nil {
+			t.Fatalf("EntropyToMnemonic failed: %v", err)
+		}
+		if mnemonic != v.mnemonic {
+			t.Errorf("Expected mnemonic %q, got %q", v.mnemonic, mnemonic)
+		}
+
+		decoded, err := MnemonicToEntropy(mnemonic)
+		if err != nil {
+			t.Fatalf("MnemonicToEntropy failed: %v", err)
+		}
+		if hex.EncodeToString(decoded) != v.entropy {
+			t.Errorf("Expected entropy %s, got %x", v.entropy, decoded)
+		}
+
+		seed, err := MnemonicToSeed(mnemonic, "TREZOR")
+		if err != nil {
+			t.Fatalf("MnemonicToSeed failed: %v", err)
+		}
+		if hex.EncodeToString(seed) != v.seed {
+			t.Errorf("Expected seed %s, got %x", v.seed, seed)
+		}
+	}
+}
+
+func TestValidateMnemonic(t *testing.T) {
+	mnemonic, err := NewMnemonic(DefaultEntropyBits)
+	if err != nil {
+		t.Fatalf("NewMnemonic failed: %v", err)
+	}
+	if len(strings.Fields(mnemonic)) != 12 {
+		t.Errorf("Expected 12 words, got %d", len(strings.Fields(mnemonic)))
+	}
+	if !ValidateMnemonic(mnemonic) {
+		t.Error("Generated mnemonic should be valid")
+	}
+
+	invalid := []string{
+		"",
+		"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon",
+		"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon",
+		"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon notaword",
+	}
+	for _, phrase := range invalid {
+		if ValidateMnemonic(phrase) {
+			t.Errorf("Mnemonic %q should be invalid", phrase)
+		}
+	}
+
+	if _, err := NewMnemonic(100); err == nil {
+		t.Error("Expected error for invalid entropy size")
+	}
+}
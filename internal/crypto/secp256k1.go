@@ -0,0 +1,291 @@
+package crypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"fmt"
+	"math/big"
+)
+
+// PublicKeySize is the length of a compressed public key
+const PublicKeySize = 33
+
+// PrivateKeySize is the length of a serialized private key
+const PrivateKeySize = 32
+
+// secp256k1Curve implements elliptic.Curve for secp256k1, y² = x³ + 7, the
+// curve used by Bitcoin. elliptic.CurveParams only supports curves with
+// a = -3, so the group law is implemented here in Jacobian coordinates.
+//
+// The arithmetic uses math/big and is not constant time.
+type secp256k1Curve struct {
+	params *elliptic.CurveParams
+}
+
+var secp256k1 = newSecp256k1()
+
+func newSecp256k1() *secp256k1Curve {
+	params := &elliptic.CurveParams{Name: "secp256k1", BitSize: 256}
+	params.P, _ = new(big.Int).SetString("FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFEFFFFFC2F", 16)
+	params.N, _ = new(big.Int).SetString("FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFEBAAEDCE6AF48A03BBFD25E8CD0364141", 16)
+	params.B = big.NewInt(7)
+	params.Gx, _ = new(big.Int).SetString("79BE667EF9DCBBAC55A06295CE870B07029BFCDB2DCE28D959F2815B16F81798", 16)
+	params.Gy, _ = new(big.Int).SetString("483ADA7726A3C4655DA4FBFC0E1108A8FD17B448A68554199C47D08FFB10D4B8", 16)
+	return &secp256k1Curve{params: params}
+}
+
+// Secp256k1 returns the secp256k1 curve. Keys on it work with crypto/ecdsa.
+func Secp256k1() elliptic.Curve {
+	return secp256k1
+}
+
+// Params returns the curve parameters
+func (c *secp256k1Curve) Params() *elliptic.CurveParams {
+	return c.params
+}
+
+// IsOnCurve reports whether (x, y) is a point on the curve
+func (c *secp256k1Curve) IsOnCurve(x, y *big.Int) bool {
+	p := c.params.P
+	if x.Sign() < 0 || x.Cmp(p) >= 0 || y.Sign() < 0 || y.Cmp(p) >= 0 {
+		return false
+	}
+	y2 := new(big.Int).Mul(y, y)
+	y2.Mod(y2, p)
+	return y2.Cmp(c.rhs(x)) == 0
+}
+
+// rhs returns x³ + 7 mod p
+func (c *secp256k1Curve) rhs(x *big.Int) *big.Int {
+	x3 := new(big.Int).Mul(x, x)
+	x3.Mul(x3, x)
+	x3.Add(x3, c.params.B)
+	return x3.Mod(x3, c.params.P)
+}
+
+// Add returns the sum of two points
+func (c *secp256k1Curve) Add(x1, y1, x2, y2 *big.Int) (*big.Int, *big.Int) {
+	return c.toAffine(c.addJacobian(c.toJacobian(x1, y1), c.toJacobian(x2, y2)))
+}
+
+// Double returns 2 * (x, y)
+func (c *secp256k1Curve) Double(x, y *big.Int) (*big.Int, *big.Int) {
+	return c.toAffine(c.doubleJacobian(c.toJacobian(x, y)))
+}
+
+// ScalarMult returns k * (x, y), with k a big-endian integer
+func (c *secp256k1Curve) ScalarMult(x, y *big.Int, k []byte) (*big.Int, *big.Int) {
+	base := c.toJacobian(x, y)
+	result := jacobianPoint{new(big.Int), new(big.Int), new(big.Int)}
+	for _, b := range k {
+		for bit := 7; bit >= 0; bit-- {
+			result = c.doubleJacobian(result)
+			if b>>uint(bit)&1 == 1 {
+				result = c.addJacobian(result, base)
+			}
+		}
+	}
+	return c.toAffine(result)
+}
+
+// ScalarBaseMult returns k * G, with k a big-endian integer
+func (c *secp256k1Curve) ScalarBaseMult(k []byte) (*big.Int, *big.Int) {
+	return c.ScalarMult(c.params.Gx, c.params.Gy, k)
+}
+
+// jacobianPoint is (X / Z², Y / Z³); Z = 0 is the point at infinity
+type jacobianPoint struct {
+	x, y, z *big.Int
+}
+
+// toJacobian converts an affine point, treating (0, 0) as infinity
+func (c *secp256k1Curve) toJacobian(x, y *big.Int) jacobianPoint {
+	z := big.NewInt(1)
+	if x.Sign() == 0 && y.Sign() == 0 {
+		z.SetInt64(0)
+	}
+	return jacobianPoint{new(big.Int).Set(x), new(big.Int).Set(y), z}
+}
+
+// toAffine converts back to affine coordinates, returning (0, 0) for infinity
+func (c *secp256k1Curve) toAffine(pt jacobianPoint) (*big.Int, *big.Int) {
+	if pt.z.Sign() == 0 {
+		return new(big.Int), new(big.Int)
+	}
+	p := c.params.P
+	zInv := new(big.Int).ModInverse(pt.z, p)
+	zInv2 := new(big.Int).Mul(zInv, zInv)
+	x := new(big.Int).Mul(pt.x, zInv2)
+	x.Mod(x, p)
+	zInv2.Mul(zInv2, zInv)
+	y := new(big.Int).Mul(pt.y, zInv2)
+	y.Mod(y, p)
+	return x, y
+}
+
+// doubleJacobian doubles a point (dbl-2009-l, for a = 0)
+func (c *secp256k1Curve) doubleJacobian(pt jacobianPoint) jacobianPoint {
+	p := c.params.P
+	if pt.z.Sign() == 0 || pt.y.Sign() == 0 {
+		return jacobianPoint{new(big.Int), new(big.Int), new(big.Int)}
+	}
+
+	a := new(big.Int).Mul(pt.x, pt.x)
+	a.Mod(a, p)
+	b := new(big.Int).Mul(pt.y, pt.y)
+	b.Mod(b, p)
+	cc := new(big.Int).Mul(b, b)
+	cc.Mod(cc, p)
+
+	// D = 2((X + B)² - A - C)
+	d := new(big.Int).Add(pt.x, b)
+	d.Mul(d, d)
+	d.Sub(d, a)
+	d.Sub(d, cc)
+	d.Lsh(d, 1)
+	d.Mod(d, p)
+
+	e := new(big.Int).Lsh(a, 1)
+	e.Add(e, a)
+	f := new(big.Int).Mul(e, e)
+
+	x3 := new(big.Int).Sub(f, new(big.Int).Lsh(d, 1))
+	x3.Mod(x3, p)
+
+	y3 := new(big.Int).Sub(d, x3)
+	y3.Mul(y3, e)
+	y3.Sub(y3, new(big.Int).Lsh(cc, 3))
+	y3.Mod(y3, p)
+
+	z3 := new(big.Int).Mul(pt.y, pt.z)
+	z3.Lsh(z3, 1)
+	z3.Mod(z3, p)
+
+	return jacobianPoint{x3, y3, z3}
+}
+
+// addJacobian adds two points (add-2007-bl)
+func (c *secp256k1Curve) addJacobian(p1, p2 jacobianPoint) jacobianPoint {
+	if p1.z.Sign() == 0 {
+		return p2
+	}
+	if p2.z.Sign() == 0 {
+		return p1
+	}
+	p := c.params.P
+
+	z1z1 := new(big.Int).Mul(p1.z, p1.z)
+	z1z1.Mod(z1z1, p)
+	z2z2 := new(big.Int).Mul(p2.z, p2.z)
+	z2z2.Mod(z2z2, p)
+
+	u1 := new(big.Int).Mul(p1.x, z2z2)
+	u1.Mod(u1, p)
+	u2 := new(big.Int).Mul(p2.x, z1z1)
+	u2.Mod(u2, p)
+
+	s1 := new(big.Int).Mul(p1.y, p2.z)
+	s1.Mul(s1, z2z2)
+	s1.Mod(s1, p)
+	s2 := new(big.Int).Mul(p2.y, p1.z)
+	s2.Mul(s2, z1z1)
+	s2.Mod(s2, p)
+
+	h := new(big.Int).Sub(u2, u1)
+	h.Mod(h, p)
+	r := new(big.Int).Sub(s2, s1)
+	r.Mod(r, p)
+	if h.Sign() == 0 {
+		if r.Sign() == 0 {
+			return c.doubleJacobian(p1)
+		}
+		return jacobianPoint{new(big.Int), new(big.Int), new(big.Int)}
+	}
+	r.Lsh(r, 1)
+
+	i := new(big.Int).Lsh(h, 1)
+	i.Mul(i, i)
+	i.Mod(i, p)
+	j := new(big.Int).Mul(h, i)
+	j.Mod(j, p)
+	v := new(big.Int).Mul(u1, i)
+	v.Mod(v, p)
+
+	x3 := new(big.Int).Mul(r, r)
+	x3.Sub(x3, j)
+	x3.Sub(x3, new(big.Int).Lsh(v, 1))
+	x3.Mod(x3, p)
+
+	y3 := new(big.Int).Sub(v, x3)
+	y3.Mul(y3, r)
+	s1j := new(big.Int).Mul(s1, j)
+	y3.Sub(y3, s1j.Lsh(s1j, 1))
+	y3.Mod(y3, p)
+
+	z3 := new(big.Int).Add(p1.z, p2.z)
+	z3.Mul(z3, z3)
+	z3.Sub(z3, z1z1)
+	z3.Sub(z3, z2z2)
+	z3.Mul(z3, h)
+	z3.Mod(z3, p)
+
+	return jacobianPoint{x3, y3, z3}
+}
+
+// CompressPublicKey serializes a public key as 33 bytes: 0x02 or 0x03 for an
+// even or odd Y, followed by X padded to 32 bytes
+func CompressPublicKey(publicKey *ecdsa.PublicKey) []byte {
+	compressed := make([]byte, PublicKeySize)
+	compressed[0] = 0x02 + byte(publicKey.Y.Bit(0))
+	publicKey.X.FillBytes(compressed[1:])
+	return compressed
+}
+
+// DecompressPublicKey parses a 33-byte compressed secp256k1 public key
+func DecompressPublicKey(data []byte) (*ecdsa.PublicKey, error) {
+	if len(data) != PublicKeySize || (data[0] != 0x02 && data[0] != 0x03) {
+		return nil, fmt.Errorf("invalid compressed public key")
+	}
+
+	p := secp256k1.params.P
+	x := new(big.Int).SetBytes(data[1:])
+	if x.Cmp(p) >= 0 {
+		return nil, fmt.Errorf("public key X coordinate out of range")
+	}
+
+	// p ≡ 3 (mod 4), so a square root is rhs^((p+1)/4)
+	rhs := secp256k1.rhs(x)
+	exponent := new(big.Int).Add(p, big.NewInt(1))
+	exponent.Rsh(exponent, 2)
+	y := new(big.Int).Exp(rhs, exponent, p)
+	if new(big.Int).Exp(y, big.NewInt(2), p).Cmp(rhs) != 0 {
+		return nil, fmt.Errorf("public key point is not on the curve")
+	}
+	if y.Bit(0) != uint(data[0]&1) {
+		y.Sub(p, y)
+	}
+
+	return &ecdsa.PublicKey{Curve: secp256k1, X: x, Y: y}, nil
+}
+
+// PrivateKeyFromBytes builds a secp256k1 key pair from a 32-byte big-endian
+// scalar, which must be between 1 and the curve order
+func PrivateKeyFromBytes(scalar []byte) (*ecdsa.PrivateKey, error) {
+	if len(scalar) != PrivateKeySize {
+		return nil, fmt.Errorf("private key must be %d bytes, got %d", PrivateKeySize, len(scalar))
+	}
+	d := new(big.Int).SetBytes(scalar)
+	if d.Sign() == 0 || d.Cmp(secp256k1.params.N) >= 0 {
+		return nil, fmt.Errorf("private key out of range")
+	}
+
+	privateKey := &ecdsa.PrivateKey{D: d}
+	privateKey.Curve = secp256k1
+	privateKey.X, privateKey.Y = secp256k1.ScalarBaseMult(scalar)
+	return privateKey, nil
+}
+
+// privateKeyBytes serializes a private key as a fixed-width 32-byte scalar
+func privateKeyBytes(privateKey *ecdsa.PrivateKey) []byte {
+	return privateKey.D.FillBytes(make([]byte, PrivateKeySize))
+}
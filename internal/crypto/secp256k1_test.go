@@ -0,0 +1,105 @@
+package crypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+)
+
+func TestSecp256k1Curve(t *testing.T) {
+	curve := Secp256k1()
+	params := curve.Params()
+
+	if !curve.IsOnCurve(params.Gx, params.Gy) {
+		t.Fatal("Generator should be on the curve")
+	}
+
+	// 1 * G is the generator, whose compressed form is well known
+	one := make([]byte, PrivateKeySize)
+	one[PrivateKeySize-1] = 1
+	privateKey, err := PrivateKeyFromBytes(one)
+	if err != nil {
+		t.Fatalf("PrivateKeyFromBytes failed: %v", err)
+	}
+	expected := "0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"
+	if got := hex.EncodeToString(CompressPublicKey(&privateKey.PublicKey)); got != expected {
+		t.Errorf("Expected %s, got %s", expected, got)
+	}
+
+	// 2 * G computed by doubling and by scalar multiplication agree
+	dx, dy := curve.Double(params.Gx, params.Gy)
+	sx, sy := curve.ScalarBaseMult([]byte{2})
+	if dx.Cmp(sx) != 0 || dy.Cmp(sy) != 0 || !curve.IsOnCurve(dx, dy) {
+		t.Error("Double and ScalarBaseMult disagree")
+	}
+	ax, ay := curve.Add(params.Gx, params.Gy, dx, dy)
+	tx, ty := curve.ScalarBaseMult([]byte{3})
+	if ax.Cmp(tx) != 0 || ay.Cmp(ty) != 0 {
+		t.Error("Add and ScalarBaseMult disagree")
+	}
+
+	// N * G is the point at infinity
+	nx, ny := curve.ScalarBaseMult(params.N.Bytes())
+	if nx.Sign() != 0 || ny.Sign() != 0 {
+		t.Error("N * G should be the point at infinity")
+	}
+
+	if _, err := PrivateKeyFromBytes(params.N.FillBytes(make([]byte, PrivateKeySize))); err == nil {
+		t.Error("Private key equal to the curve order should be rejected")
+	}
+	if _, err := PrivateKeyFromBytes(make([]byte, PrivateKeySize)); err == nil {
+		t.Error("Zero private key should be rejected")
+	}
+}
+
+func TestCompressedPublicKeys(t *testing.T) {
+	for i := 0; i < 10; i++ {
+		keyPair, err := NewKeyPair()
+		if err != nil {
+			t.Fatalf("Failed to generate key pair: %v", err)
+		}
+
+		compressed := keyPair.GetPublicKeyBytes()
+		if len(compressed) != PublicKeySize {
+			t.Fatalf("Expected %d bytes, got %d", PublicKeySize, len(compressed))
+		}
+		publicKey, err := DecompressPublicKey(compressed)
+		if err != nil {
+			t.Fatalf("DecompressPublicKey failed: %v", err)
+		}
+		if !publicKey.Equal(keyPair.PublicKey) {
+			t.Error("Decompressed key doesn't match original")
+		}
+		if !AddressMatchesPublicKey(keyPair.Address, publicKey) {
+			t.Error("Address should match the public key")
+		}
+
+		hash := sha256.Sum256([]byte("message"))
+		signature, err := ecdsa.SignASN1(rand.Reader, keyPair.PrivateKey, hash[:])
+		if err != nil {
+			t.Fatalf("SignASN1 failed: %v", err)
+		}
+		if !ecdsa.VerifyASN1(publicKey, hash[:], signature) {
+			t.Error("Signature should verify with the decompressed key")
+		}
+	}
+
+	// About half of all X coordinates have no point on the curve
+	invalid := make([]byte, PublicKeySize)
+	invalid[0] = 0x02
+	rejected := false
+	for x := byte(1); x < 20 && !rejected; x++ {
+		invalid[PublicKeySize-1] = x
+		_, err := DecompressPublicKey(invalid)
+		rejected = err != nil
+	}
+	if !rejected {
+		t.Error("X coordinates off the curve should be rejected")
+	}
+
+	if _, err := DecompressPublicKey([]byte{0x04, 0x01}); err == nil {
+		t.Error("Short key should be rejected")
+	}
+}
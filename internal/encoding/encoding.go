@@ -0,0 +1,248 @@
+// Package encoding implements the deterministic binary serialization used for
+// hashing, signing, network transfer and storage of blocks and transactions.
+//
+// Fixed-width integers are big-endian, signed variable-width integers use
+// zig-zag varints, and byte strings are prefixed with their length as an
+// unsigned varint. Every top-level object starts with a one-byte version.
+package encoding
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// ErrTruncated is returned when the input ends before a value is complete
+var ErrTruncated = errors.New("encoding: unexpected end of data")
+
+// Writer appends binary-encoded values to a buffer
+type Writer struct {
+	buf bytes.Buffer
+}
+
+// NewWriter creates an empty writer
+func NewWriter() *Writer {
+	return &Writer{}
+}
+
+// Bytes returns the encoded data
+func (w *Writer) Bytes() []byte {
+	return w.buf.Bytes()
+}
+
+// Len returns the number of bytes written so far
+func (w *Writer) Len() int {
+	return w.buf.Len()
+}
+
+// WriteUint8 writes a single byte
+func (w *Writer) WriteUint8(v uint8) {
+	w.buf.WriteByte(v)
+}
+
+// WriteUint32 writes a fixed-width 32-bit integer
+func (w *Writer) WriteUint32(v uint32) {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], v)
+	w.buf.Write(b[:])
+}
+
+// WriteUint64 writes a fixed-width 64-bit integer
+func (w *Writer) WriteUint64(v uint64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], v)
+	w.buf.Write(b[:])
+}
+
+// WriteInt64 writes a fixed-width signed 64-bit integer
+func (w *Writer) WriteInt64(v int64) {
+	w.WriteUint64(uint64(v))
+}
+
+// WriteUvarint writes an unsigned varint
+func (w *Writer) WriteUvarint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(b[:], v)
+	w.buf.Write(b[:n])
+}
+
+// WriteVarint writes a signed zig-zag varint
+func (w *Writer) WriteVarint(v int64) {
+	var b [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(b[:], v)
+	w.buf.Write(b[:n])
+}
+
+// WriteBytes writes a length-prefixed byte string
+func (w *Writer) WriteBytes(v []byte) {
+	w.WriteUvarint(uint64(len(v)))
+	w.buf.Write(v)
+}
+
+// WriteString writes a length-prefixed string
+func (w *Writer) WriteString(v string) {
+	w.WriteUvarint(uint64(len(v)))
+	w.buf.WriteString(v)
+}
+
+// Reader decodes values written by Writer. The first error is sticky: once a
+// read fails, all later reads return zero values and Err reports the failure.
+type Reader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+// NewReader creates a reader over data
+func NewReader(data []byte) *Reader {
+	return &Reader{data: data}
+}
+
+// Err returns the first error encountered while reading
+func (r *Reader) Err() error {
+	return r.err
+}
+
+// Fail records err as the reader error unless an error is already set
+func (r *Reader) Fail(err error) {
+	if r.err == nil {
+		r.err = err
+	}
+}
+
+// Remaining returns the number of unread bytes
+func (r *Reader) Remaining() int {
+	return len(r.data) - r.pos
+}
+
+// Finish returns an error if reading failed or unread bytes remain
+func (r *Reader) Finish() error {
+	if r.err != nil {
+		return r.err
+	}
+	if r.Remaining() != 0 {
+		return fmt.Errorf("encoding: %d trailing bytes", r.Remaining())
+	}
+	return nil
+}
+
+// next consumes n bytes, or records ErrTruncated
+func (r *Reader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || r.Remaining() < n {
+		r.err = ErrTruncated
+		return nil
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+// ReadUint8 reads a single byte
+func (r *Reader) ReadUint8() uint8 {
+	b := r.next(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+// ReadUint32 reads a fixed-width 32-bit integer
+func (r *Reader) ReadUint32() uint32 {
+	b := r.next(4)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(b)
+}
+
+// ReadUint64 reads a fixed-width 64-bit integer
+func (r *Reader) ReadUint64() uint64 {
+	b := r.next(8)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint64(b)
+}
+
+// ReadInt64 reads a fixed-width signed 64-bit integer
+func (r *Reader) ReadInt64() int64 {
+	return int64(r.ReadUint64())
+}
+
+// ReadUvarint reads an unsigned varint
+func (r *Reader) ReadUvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(r.data[r.pos:])
+	if n <= 0 {
+		r.err = fmt.Errorf("encoding: invalid uvarint at offset %d", r.pos)
+		return 0
+	}
+	r.pos += n
+	return v
+}
+
+// ReadVarint reads a signed zig-zag varint
+func (r *Reader) ReadVarint() int64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(r.data[r.pos:])
+	if n <= 0 {
+		r.err = fmt.Errorf("encoding: invalid varint at offset %d", r.pos)
+		return 0
+	}
+	r.pos += n
+	return v
+}
+
+// ReadCount reads a collection length. Each element takes at least minSize
+// bytes, so counts that cannot fit in the remaining data are rejected before
+// anything is allocated.
+func (r *Reader) ReadCount(minSize int) int {
+	count := r.ReadUvarint()
+	if r.err != nil {
+		return 0
+	}
+	if minSize < 1 {
+		minSize = 1
+	}
+	if count > uint64(r.Remaining()/minSize) {
+		r.err = fmt.Errorf("encoding: count %d exceeds remaining data", count)
+		return 0
+	}
+	return int(count)
+}
+
+// ReadBytes reads a length-prefixed byte string. The result is a copy.
+func (r *Reader) ReadBytes() []byte {
+	length := r.ReadCount(1)
+	b := r.next(length)
+	if b == nil {
+		return nil
+	}
+	return append([]byte{}, b...)
+}
+
+// ReadString reads a length-prefixed string
+func (r *Reader) ReadString() string {
+	length := r.ReadCount(1)
+	b := r.next(length)
+	if b == nil {
+		return ""
+	}
+	return string(b)
+}
+
+// ReadVersion reads a version byte and fails unless it equals want
+func (r *Reader) ReadVersion(want uint8) {
+	version := r.ReadUint8()
+	if r.err == nil && version != want {
+		r.err = fmt.Errorf("encoding: unsupported version %d, expected %d", version, want)
+	}
+}
@@ -23,6 +23,57 @@ type PeerReputation struct {
 	SuccessCount int       `json:"success_count"`
 	Banned       bool      `json:"banned"`
 	BanUntil     time.Time `json:"ban_until"`
+	NodeID       string    `json:"node_id,omitempty"` // last identity verified at an address
+}
+
+// newPeerReputation returns the reputation of a newly seen peer
+func newPeerReputation() *PeerReputation {
+	return &PeerReputation{
+		Score:       100,
+		LastContact: time.Now(),
+	}
+}
+
+// isBanned reports whether the ban is still in effect
+func (rep *PeerReputation) isBanned() bool {
+	return rep.Banned && time.Now().Before(rep.BanUntil)
+}
+
+// adjust applies a reputation change, banning the peer after MaxFailCount
+// failures in a row. It returns false if the peer should be forgotten.
+func (rep *PeerReputation) adjust(key string, delta int) bool {
+	// Don't update reputation while banned
+	if rep.isBanned() {
+		return true
+	}
+
+	// Update score with bounds
+	rep.Score += delta
+	if rep.Score < MinReputation {
+		rep.Score = MinReputation
+	}
+	if rep.Score > MaxReputation {
+		rep.Score = MaxReputation
+	}
+
+	rep.LastContact = time.Now()
+
+	if delta < 0 {
+		rep.FailCount++
+	} else {
+		rep.SuccessCount++
+		rep.FailCount = 0
+	}
+
+	// Ban peer if too many failures
+	if rep.FailCount >= MaxFailCount {
+		rep.Banned = true
+		rep.BanUntil = time.Now().Add(BanDuration)
+		fmt.Printf("Banned peer %s for %v due to %d failures\n", key, BanDuration, rep.FailCount)
+	}
+
+	// Remove peers with very low reputation (but not banned peers)
+	return rep.Score > 0 || rep.Banned
 }
 
 const (
@@ -36,7 +87,8 @@ const (
 type Discovery struct {
 	server            *Server
 	bootstrapPeers    []string
-	knownPeers        map[string]*PeerReputation
+	knownPeers        map[string]*PeerReputation // address -> reputation
+	nodes             map[string]*PeerReputation // node ID -> reputation
 	peersMu           sync.RWMutex
 	maxPeers          int
 	healthInterval    time.Duration
@@ -50,10 +102,11 @@ type Discovery struct {
 func NewDiscovery(server *Server, bootstrapPeers []string) *Discovery {
 	ctx, cancel := context.WithCancel(context.Background())
 
-	return &Discovery{
+	d := &Discovery{
 		server:            server,
 		bootstrapPeers:    bootstrapPeers,
 		knownPeers:        make(map[string]*PeerReputation),
+		nodes:             make(map[string]*PeerReputation),
 		maxPeers:          DefaultMaxPeers,
 		healthInterval:    DefaultPeerHealthInterval,
 		peerTimeout:       DefaultPeerTimeout,
@@ -61,6 +114,36 @@ func NewDiscovery(server *Server, bootstrapPeers []string) *Discovery {
 		ctx:               ctx,
 		cancel:            cancel,
 	}
+
+	// Refuse handshakes with banned identities
+	config := server.GetHandshakeConfig()
+	config.AcceptNode = d.acceptNode
+	server.SetHandshakeConfig(config)
+
+	return d
+}
+
+// newClient creates a client sharing the server's node identity and
+// handshake rules
+func (d *Discovery) newClient(addr string, handler MessageHandler) *Client {
+	client := NewClient(addr, func(peer *Peer, msg *Message) {
+		// The handshake delivers the peer's VERSION once its identity is
+		// verified
+		if msg.Type == MessageTypeVersion {
+			d.linkNode(addr, peer.NodeID())
+		}
+		handler(peer, msg)
+	})
+	client.SetHandshakeConfig(d.server.GetHandshakeConfig())
+	return client
+}
+
+// acceptNode rejects banned node identities during the handshake
+func (d *Discovery) acceptNode(nodeID string) error {
+	if d.IsNodeBanned(nodeID) {
+		return fmt.Errorf("node is banned")
+	}
+	return nil
 }
 
 // Start starts the discovery service
@@ -105,17 +188,15 @@ func (d *Discovery) connectToPeer(addr string) error {
 		return fmt.Errorf("peer %s already known", addr)
 	}
 
-	client := NewClient(addr, func(peer *Peer, msg *Message) {
-		d.handleMessage(peer, msg)
-	})
+	client := d.newClient(addr, d.handleMessage)
 
 	if err := client.Connect(); err != nil {
-		d.updatePeerReputation(addr, -5)
+		d.UpdatePeerReputation(addr, -5)
 		return fmt.Errorf("failed to connect to peer %s: %w", addr, err)
 	}
 
 	d.addKnownPeer(addr)
-	d.updatePeerReputation(addr, 10) // Bonus for successful connection
+	d.UpdatePeerReputation(addr, 10) // Bonus for successful connection
 	fmt.Printf("Connected to bootstrap peer: %s\n", addr)
 
 	// Request peers from this peer
@@ -132,83 +213,118 @@ func (d *Discovery) cleanUpExpiredBans() {
 	defer d.peersMu.Unlock()
 
 	now := time.Now()
-	for addr, rep := range d.knownPeers {
-		if rep.Banned && now.After(rep.BanUntil) {
-			rep.Banned = false
-			rep.BanUntil = time.Time{}
-			rep.Score = 50 // Reset to neutral reputation
-			fmt.Printf("Unbanned peer %s\n", addr)
+	for _, peers := range []map[string]*PeerReputation{d.knownPeers, d.nodes} {
+		for key, rep := range peers {
+			if rep.Banned && now.After(rep.BanUntil) {
+				rep.Banned = false
+				rep.BanUntil = time.Time{}
+				rep.Score = 50 // Reset to neutral reputation
+				fmt.Printf("Unbanned peer %s\n", key)
+			}
 		}
 	}
 }
 
-// isPeerBanned checks if a peer is currently banned
+// isPeerBanned checks if a peer is currently banned, either by address or by
+// the identity last verified at the address
 func (d *Discovery) isPeerBanned(addr string) bool {
 	d.peersMu.RLock()
 	defer d.peersMu.RUnlock()
 
-	if rep, exists := d.knownPeers[addr]; exists {
-		if rep.Banned && time.Now().Before(rep.BanUntil) {
-			return true
-		}
+	rep, exists := d.knownPeers[addr]
+	if !exists {
+		return false
+	}
+	if rep.isBanned() {
+		return true
+	}
+	if node, exists := d.nodes[rep.NodeID]; exists && node.isBanned() {
+		return true
 	}
 	return false
 }
 
-// addKnownPeer adds a peer to the known peers list
-func (d *Discovery) addKnownPeer(addr string) {
+// linkNode records the identity verified at a known address
+func (d *Discovery) linkNode(addr, nodeID string) {
+	if nodeID == "" {
+		return
+	}
+
 	d.peersMu.Lock()
 	defer d.peersMu.Unlock()
 
-	if _, exists := d.knownPeers[addr]; !exists {
-		d.knownPeers[addr] = &PeerReputation{
-			Score:        100,
-			LastContact:  time.Now(),
-			FailCount:    0,
-			SuccessCount: 0,
-			Banned:       false,
-		}
+	if rep, exists := d.knownPeers[addr]; exists {
+		rep.NodeID = nodeID
+	}
+	if _, exists := d.nodes[nodeID]; !exists {
+		d.nodes[nodeID] = newPeerReputation()
 	}
 }
 
-// updatePeerReputation updates a peer's reputation
-func (d *Discovery) updatePeerReputation(addr string, delta int) {
+// UpdateNodeReputation updates the reputation of a node identity. Like
+// address reputation, MaxFailCount failures in a row ban it for BanDuration.
+func (d *Discovery) UpdateNodeReputation(nodeID string, delta int) {
+	if nodeID == "" {
+		return
+	}
+
 	d.peersMu.Lock()
 	defer d.peersMu.Unlock()
 
-	if rep, exists := d.knownPeers[addr]; exists {
-		// Check if peer is banned
-		if rep.Banned && time.Now().Before(rep.BanUntil) {
-			return // Don't update reputation while banned
-		}
+	rep, exists := d.nodes[nodeID]
+	if !exists {
+		rep = newPeerReputation()
+		d.nodes[nodeID] = rep
+	}
+	if !rep.adjust(nodeID, delta) {
+		delete(d.nodes, nodeID)
+		fmt.Printf("Removed node %s due to low reputation\n", nodeID)
+	}
+}
 
-		// Update score with bounds
-		rep.Score += delta
-		if rep.Score < MinReputation {
-			rep.Score = MinReputation
-		}
-		if rep.Score > MaxReputation {
-			rep.Score = MaxReputation
-		}
+// BanNode bans a node identity for the given duration, whatever address it
+// connects from
+func (d *Discovery) BanNode(nodeID string, duration time.Duration) {
+	d.peersMu.Lock()
+	defer d.peersMu.Unlock()
 
-		rep.LastContact = time.Now()
+	rep, exists := d.nodes[nodeID]
+	if !exists {
+		rep = newPeerReputation()
+		d.nodes[nodeID] = rep
+	}
+	rep.Banned = true
+	rep.BanUntil = time.Now().Add(duration)
+	fmt.Printf("Banned node %s for %v\n", nodeID, duration)
+}
 
-		if delta < 0 {
-			rep.FailCount++
-		} else {
-			rep.SuccessCount++
-			rep.FailCount = 0
-		}
+// IsNodeBanned checks if a node identity is currently banned
+func (d *Discovery) IsNodeBanned(nodeID string) bool {
+	d.peersMu.RLock()
+	defer d.peersMu.RUnlock()
 
-		// Ban peer if too many failures
-		if rep.FailCount >= MaxFailCount {
-			rep.Banned = true
-			rep.BanUntil = time.Now().Add(BanDuration)
-			fmt.Printf("Banned peer %s for %v due to %d failures\n", addr, BanDuration, rep.FailCount)
-		}
+	rep, exists := d.nodes[nodeID]
+	return exists && rep.isBanned()
+}
 
-		// Remove peers with very low reputation (but not banned peers)
-		if rep.Score <= 0 && !rep.Banned {
+// addKnownPeer adds a peer to the known peers list
+func (d *Discovery) addKnownPeer(addr string) {
+	d.peersMu.Lock()
+	defer d.peersMu.Unlock()
+
+	if _, exists := d.knownPeers[addr]; !exists {
+		d.knownPeers[addr] = newPeerReputation()
+	}
+}
+
+// UpdatePeerReputation updates the reputation of a known peer address. Like
+// node reputation, MaxFailCount failures in a row ban it for BanDuration.
+func (d *Discovery) UpdatePeerReputation(addr string, delta int) {
+	d.peersMu.Lock()
+	defer d.peersMu.Unlock()
+
+	if rep, exists := d.knownPeers[addr]; exists {
+		if !rep.adjust(addr, delta) {
 			delete(d.knownPeers, addr)
 			fmt.Printf("Removed peer %s due to low reputation\n", addr)
 		}
@@ -265,23 +381,24 @@ func (d *Discovery) checkPeerHealth() {
 		// Check if peer has timed out
 		if now.Sub(rep.LastContact) > d.peerTimeout {
 			fmt.Printf("Peer %s timed out\n", addr)
-			d.updatePeerReputation(addr, -10)
+			d.UpdatePeerReputation(addr, -10)
 		}
 
 		// Send ping to check connectivity
-		client := NewClient(addr, func(peer *Peer, msg *Message) {
+		client := d.newClient(addr, func(peer *Peer, msg *Message) {
 			if msg.Type == MessageTypePong {
-				d.updatePeerReputation(addr, 1)
+				d.UpdatePeerReputation(addr, 1)
+				d.UpdateNodeReputation(peer.NodeID(), 1)
 			}
 		})
 
 		if err := client.Connect(); err != nil {
-			d.updatePeerReputation(addr, -1)
+			d.UpdatePeerReputation(addr, -1)
 			continue
 		}
 
 		if err := client.Send(NewPingMessage()); err != nil {
-			d.updatePeerReputation(addr, -1)
+			d.UpdatePeerReputation(addr, -1)
 			client.Close()
 			continue
 		}
@@ -289,7 +406,7 @@ func (d *Discovery) checkPeerHealth() {
 		// Wait for pong with timeout
 		select {
 		case <-time.After(5 * time.Second):
-			d.updatePeerReputation(addr, -1)
+			d.UpdatePeerReputation(addr, -1)
 		case <-d.ctx.Done():
 			return
 		}
@@ -326,12 +443,10 @@ func (d *Discovery) discoverPeers() {
 			break
 		}
 
-		client := NewClient(addr, func(peer *Peer, msg *Message) {
-			d.handleMessage(peer, msg)
-		})
+		client := d.newClient(addr, d.handleMessage)
 
 		if err := client.Connect(); err != nil {
-			d.updatePeerReputation(addr, -1)
+			d.UpdatePeerReputation(addr, -1)
 			continue
 		}
 
@@ -355,7 +470,8 @@ func (d *Discovery) handleMessage(peer *Peer, msg *Message) {
 		}
 	case MessageTypePong:
 		// Update peer reputation
-		d.updatePeerReputation(peer.GetInfo().Address, 1)
+		d.UpdatePeerReputation(peer.GetInfo().Address, 1)
+		d.UpdateNodeReputation(peer.NodeID(), 1)
 	case MessageTypeGetPeers:
 		// Send list of known peers
 		peers := d.getPeerList()
@@ -445,12 +561,21 @@ func (d *Discovery) GetStats() map[string]interface{} {
 		}
 	}
 
+	bannedNodes := 0
+	for _, rep := range d.nodes {
+		if rep.isBanned() {
+			bannedNodes++
+		}
+	}
+
 	return map[string]interface{}{
 		"total_peers":     totalPeers,
 		"connected_peers": connectedPeers,
 		"good_reputation": goodReputation,
 		"max_peers":       d.maxPeers,
 		"bootstrap_peers": len(d.bootstrapPeers),
+		"known_nodes":     len(d.nodes),
+		"banned_nodes":    bannedNodes,
 	}
 }
 
@@ -467,7 +592,21 @@ func (d *Discovery) GetKnownPeers() map[string]*PeerReputation {
 			FailCount:   rep.FailCount,
 			Banned:      rep.Banned,
 			BanUntil:    rep.BanUntil,
+			NodeID:      rep.NodeID,
 		}
 	}
 	return peers
 }
+
+// GetNodeReputations returns the reputation of every known node identity
+func (d *Discovery) GetNodeReputations() map[string]*PeerReputation {
+	d.peersMu.RLock()
+	defer d.peersMu.RUnlock()
+
+	nodes := make(map[string]*PeerReputation, len(d.nodes))
+	for nodeID, rep := range d.nodes {
+		copied := *rep
+		nodes[nodeID] = &copied
+	}
+	return nodes
+}
@@ -70,21 +70,21 @@ func TestDiscoveryUpdatePeerReputation(t *testing.T) {
 	discovery.addKnownPeer(addr)
 
 	// Increase reputation
-	discovery.updatePeerReputation(addr, 10)
+	discovery.UpdatePeerReputation(addr, 10)
 	peers := discovery.GetKnownPeers()
 	if peers[addr].Score != 110 {
 		t.Errorf("Expected score 110, got %d", peers[addr].Score)
 	}
 
 	// Decrease reputation
-	discovery.updatePeerReputation(addr, -5)
+	discovery.UpdatePeerReputation(addr, -5)
 	peers = discovery.GetKnownPeers()
 	if peers[addr].Score != 105 {
 		t.Errorf("Expected score 105, got %d", peers[addr].Score)
 	}
 
 	// Increase fail count (negative delta also increases fail count)
-	discovery.updatePeerReputation(addr, -1)
+	discovery.UpdatePeerReputation(addr, -1)
 	peers = discovery.GetKnownPeers()
 	if peers[addr].FailCount != 2 {
 		t.Errorf("Expected fail count 2, got %d", peers[addr].FailCount)
@@ -101,7 +101,7 @@ func TestDiscoveryUpdatePeerReputationRemoveLowScore(t *testing.T) {
 
 	// Reduce reputation below threshold
 	for i := 0; i < MaxFailCount; i++ {
-		discovery.updatePeerReputation(addr, -10)
+		discovery.UpdatePeerReputation(addr, -10)
 	}
 
 	// Peer should be banned, not removed
@@ -432,3 +432,41 @@ func TestDiscoveryConnectToPeer(t *testing.T) {
 		t.Error("Expected discovery to be created")
 	}
 }
+
+func TestDiscoveryNodeReputation(t *testing.T) {
+	handler := func(peer *Peer, msg *Message) {}
+	server := NewServer("127.0.0.1", 0, handler)
+	discovery := NewDiscovery(server, []string{})
+
+	nodeID := "node-1"
+	discovery.UpdateNodeReputation(nodeID, 10)
+	nodes := discovery.GetNodeReputations()
+	if nodes[nodeID] == nil || nodes[nodeID].Score != 110 {
+		t.Fatalf("Expected node score 110, got %+v", nodes[nodeID])
+	}
+
+	for i := 0; i < MaxFailCount; i++ {
+		discovery.UpdateNodeReputation(nodeID, -1)
+	}
+	if !discovery.IsNodeBanned(nodeID) {
+		t.Error("Expected node to be banned after repeated failures")
+	}
+
+	// An address is banned once the identity verified there is banned
+	addr := "127.0.0.1:8000"
+	discovery.addKnownPeer(addr)
+	discovery.linkNode(addr, nodeID)
+	if !discovery.isPeerBanned(addr) {
+		t.Error("Expected address of banned node to be banned")
+	}
+	if discovery.GetKnownPeers()[addr].NodeID != nodeID {
+		t.Error("Expected address to record the node ID")
+	}
+
+	// Expired identity bans are lifted
+	discovery.nodes[nodeID].BanUntil = time.Now().Add(-time.Minute)
+	discovery.cleanUpExpiredBans()
+	if discovery.IsNodeBanned(nodeID) || discovery.isPeerBanned(addr) {
+		t.Error("Expected expired ban to be lifted")
+	}
+}
@@ -0,0 +1,346 @@
+package network
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/aliexe/blockChain/internal/encoding"
+)
+
+const (
+	// MinProtocolVersion is the oldest protocol version peers may speak
+	MinProtocolVersion = 1
+	// HandshakeTimeout is how long a new connection has to complete the
+	// VERSION/VERACK handshake
+	HandshakeTimeout = 10 * time.Second
+
+	DefaultUserAgent   = "/mxm:0.1.0/"
+	MaxUserAgentLength = 256
+)
+
+// Network magic numbers keep nodes of different networks from talking to
+// each other
+const (
+	MagicMainnet uint32 = 0x6d786d00 // "mxm\0"
+	MagicTestnet uint32 = 0x746d786d // "tmxm"
+)
+
+// Feature bits advertised in VERSION messages
+const (
+	// FeatureTxRelay means the node relays transactions
+	FeatureTxRelay uint64 = 1 << iota
+)
+
+// VersionInfo is the payload of a VERSION message
+type VersionInfo struct {
+	ProtocolVersion uint32 `json:"protocol_version"`
+	Magic           uint32 `json:"magic"`
+	Features        uint64 `json:"features"`
+	BestHeight      int64  `json:"best_height"`
+	TotalWork       string `json:"total_work"` // decimal
+	UserAgent       string `json:"user_agent"`
+	Timestamp       int64  `json:"timestamp"`
+	Challenge       []byte `json:"challenge"` // signed by the peer in its VERACK
+}
+
+// HasFeature reports whether the node advertised a feature
+func (v *VersionInfo) HasFeature(feature uint64) bool {
+	return v.Features&feature == feature
+}
+
+// HandshakeConfig describes what a node advertises in its VERSION message
+// and how it sets up connections
+type HandshakeConfig struct {
+	Magic     uint32
+	Features  uint64
+	UserAgent string
+
+	// ChainInfo returns the best height and total work of the local chain.
+	// Nil advertises an empty chain.
+	ChainInfo func() (height int64, work string)
+
+	// NodeKey proves the node identity to peers. Nil makes a server
+	// generate a key for its lifetime and a client one per connection.
+	NodeKey *NodeKey
+
+	// AcceptNode is called with the verified node ID of a peer and rejects
+	// the connection if it returns an error. Nil accepts every peer.
+	AcceptNode func(nodeID string) error
+
+	// Encryption selects whether connections are encrypted with the node
+	// key before the VERSION exchange
+	Encryption EncryptionMode
+}
+
+// DefaultHandshakeConfig returns the handshake configuration of a mainnet
+// node relaying transactions, encrypting its connections where peers allow
+func DefaultHandshakeConfig() HandshakeConfig {
+	return HandshakeConfig{
+		Magic:      MagicMainnet,
+		Features:   FeatureTxRelay,
+		UserAgent:  DefaultUserAgent,
+		Encryption: EncryptionEnabled,
+	}
+}
+
+// localVersion returns the VERSION payload to send
+func (c HandshakeConfig) localVersion() *VersionInfo {
+	info := &VersionInfo{
+		ProtocolVersion: ProtocolVersion,
+		Magic:           c.Magic,
+		Features:        c.Features,
+		TotalWork:       "0",
+		UserAgent:       c.UserAgent,
+		Timestamp:       time.Now().Unix(),
+	}
+	if c.ChainInfo != nil {
+		info.BestHeight, info.TotalWork = c.ChainInfo()
+	}
+	return info
+}
+
+// checkVersion checks that a peer's VERSION is compatible with ours
+func (c HandshakeConfig) checkVersion(remote *VersionInfo) error {
+	if remote.Magic != c.Magic {
+		return fmt.Errorf("network magic mismatch: expected %#x, got %#x", c.Magic, remote.Magic)
+	}
+	if remote.ProtocolVersion < MinProtocolVersion {
+		return fmt.Errorf("protocol version %d is older than minimum %d", remote.ProtocolVersion, MinProtocolVersion)
+	}
+	return nil
+}
+
+// NewVersionMessage creates a version message
+func NewVersionMessage(info *VersionInfo) (*Message, error) {
+	if len(info.UserAgent) > MaxUserAgentLength {
+		return nil, fmt.Errorf("user agent length %d exceeds maximum %d", len(info.UserAgent), MaxUserAgentLength)
+	}
+
+	w := encoding.NewWriter()
+	w.WriteUint32(info.ProtocolVersion)
+	w.WriteUint32(info.Magic)
+	w.WriteUint64(info.Features)
+	w.WriteVarint(info.BestHeight)
+	w.WriteString(info.TotalWork)
+	w.WriteString(info.UserAgent)
+	w.WriteInt64(info.Timestamp)
+	w.WriteBytes(info.Challenge)
+	return NewMessage(MessageTypeVersion, w.Bytes()), nil
+}
+
+// ParseVersionMessage parses a version message
+func ParseVersionMessage(msg *Message) (*VersionInfo, error) {
+	if msg.Type != MessageTypeVersion {
+		return nil, fmt.Errorf("not a version message: %s", msg.Type)
+	}
+
+	r := encoding.NewReader(msg.Payload)
+	info := &VersionInfo{
+		ProtocolVersion: r.ReadUint32(),
+		Magic:           r.ReadUint32(),
+		Features:        r.ReadUint64(),
+		BestHeight:      r.ReadVarint(),
+		TotalWork:       r.ReadString(),
+		UserAgent:       r.ReadString(),
+		Timestamp:       r.ReadInt64(),
+		Challenge:       r.ReadBytes(),
+	}
+	if err := r.Finish(); err != nil {
+		return nil, fmt.Errorf("failed to decode version: %w", err)
+	}
+
+	if len(info.UserAgent) > MaxUserAgentLength {
+		return nil, fmt.Errorf("user agent length %d exceeds maximum %d", len(info.UserAgent), MaxUserAgentLength)
+	}
+	if info.BestHeight < 0 {
+		return nil, fmt.Errorf("invalid best height %d", info.BestHeight)
+	}
+	if work, ok := new(big.Int).SetString(info.TotalWork, 10); !ok || work.Sign() < 0 {
+		return nil, fmt.Errorf("invalid total work %q", info.TotalWork)
+	}
+	if len(info.Challenge) != ChallengeSize {
+		return nil, fmt.Errorf("invalid challenge length %d", len(info.Challenge))
+	}
+	return info, nil
+}
+
+// handshakeState tracks the VERSION/VERACK exchange of a peer. Until it
+// completes, only handshake messages are sent and accepted.
+type handshakeState struct {
+	config     HandshakeConfig
+	key        *NodeKey
+	challenge  []byte        // sent in our VERSION
+	control    chan *Message // handshake messages, sent ahead of the queue
+	ready      chan struct{} // closed once the handshake completed
+	timer      *time.Timer
+	remote     *VersionInfo
+	remoteMsg  *Message
+	gotVerAck  bool
+	negotiated uint32
+	complete   bool
+}
+
+// startHandshake queues our VERSION message and holds back every other
+// message until the peer has answered with its own VERSION and a VERACK
+// signing our challenge with its node key. The connection is closed if that
+// takes longer than HandshakeTimeout. It must be called before the sender
+// and receiver are started.
+func (p *Peer) startHandshake(config HandshakeConfig) error {
+	key := config.NodeKey
+	if key == nil {
+		var err error
+		if key, err = NewNodeKey(); err != nil {
+			return err
+		}
+	}
+	challenge, err := newChallenge()
+	if err != nil {
+		return err
+	}
+
+	info := config.localVersion()
+	info.Challenge = challenge
+	msg, err := NewVersionMessage(info)
+	if err != nil {
+		return fmt.Errorf("failed to create version message: %w", err)
+	}
+
+	hs := &handshakeState{
+		config:    config,
+		key:       key,
+		challenge: challenge,
+		control:   make(chan *Message, 2),
+		ready:     make(chan struct{}),
+	}
+	hs.control <- msg
+	hs.timer = time.AfterFunc(HandshakeTimeout, func() {
+		if p.IsConnected() && !p.HandshakeComplete() {
+			fmt.Printf("Handshake with %s timed out\n", p.GetInfo().ID)
+			p.Close()
+		}
+	})
+
+	p.mu.Lock()
+	p.handshake = hs
+	p.mu.Unlock()
+	return nil
+}
+
+// handleHandshakeMessage runs a received message through the handshake. It
+// returns the message to pass on to the handler, if any: the peer's VERSION
+// once the handshake completes, or any other message after that. An error
+// means the peer must be disconnected.
+func (p *Peer) handleHandshakeMessage(msg *Message) (*Message, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	hs := p.handshake
+	switch msg.Type {
+	case MessageTypeVersion:
+		if hs.remote != nil {
+			return nil, fmt.Errorf("duplicate version message")
+		}
+		remote, err := ParseVersionMessage(msg)
+		if err != nil {
+			return nil, err
+		}
+		if err := hs.config.checkVersion(remote); err != nil {
+			return nil, err
+		}
+
+		verAck, err := NewAuthVerAckMessage(hs.key, hs.config.Magic, remote.Challenge)
+		if err != nil {
+			return nil, err
+		}
+
+		hs.remote = remote
+		hs.remoteMsg = msg
+		hs.negotiated = remote.ProtocolVersion
+		if hs.negotiated > ProtocolVersion {
+			hs.negotiated = ProtocolVersion
+		}
+		p.info.Version = remote.UserAgent
+		hs.control <- verAck
+
+	case MessageTypeVerAck:
+		if hs.remote == nil {
+			return nil, fmt.Errorf("verack before version")
+		}
+		if hs.gotVerAck {
+			return nil, fmt.Errorf("duplicate verack message")
+		}
+		nodeID, err := VerifyAuthVerAck(msg, hs.config.Magic, hs.challenge)
+		if err != nil {
+			return nil, err
+		}
+		if nodeID == hs.key.ID() {
+			return nil, fmt.Errorf("connected to self")
+		}
+		if secure, ok := p.conn.(*secureConn); ok && secure.remoteID != nodeID {
+			return nil, fmt.Errorf("node %s does not match encrypted session of %s", nodeID, secure.remoteID)
+		}
+		if hs.config.AcceptNode != nil {
+			if err := hs.config.AcceptNode(nodeID); err != nil {
+				return nil, fmt.Errorf("node %s rejected: %w", nodeID, err)
+			}
+		}
+		hs.gotVerAck = true
+		p.info.NodeID = nodeID
+
+	default:
+		if !hs.complete {
+			return nil, fmt.Errorf("%s message before handshake completed", msg.Type)
+		}
+		return msg, nil
+	}
+
+	if hs.complete || hs.remote == nil || !hs.gotVerAck {
+		return nil, nil
+	}
+	hs.complete = true
+	hs.timer.Stop()
+	close(hs.ready)
+	return hs.remoteMsg, nil
+}
+
+// HandshakeComplete reports whether the VERSION/VERACK exchange completed.
+// Peers created without a handshake are always complete.
+func (p *Peer) HandshakeComplete() bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.handshake == nil || p.handshake.complete
+}
+
+// RemoteVersion returns the VERSION the peer sent, or nil before the
+// handshake completed
+func (p *Peer) RemoteVersion() *VersionInfo {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.handshake == nil || !p.handshake.complete {
+		return nil
+	}
+	remote := *p.handshake.remote
+	return &remote
+}
+
+// NodeID returns the verified node ID of the peer, or an empty string before
+// the handshake proved it
+func (p *Peer) NodeID() string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.info.NodeID
+}
+
+// NegotiatedVersion returns the protocol version both sides speak: the lower
+// of the two advertised versions
+func (p *Peer) NegotiatedVersion() uint32 {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.handshake == nil || !p.handshake.complete {
+		return ProtocolVersion
+	}
+	return p.handshake.negotiated
+}
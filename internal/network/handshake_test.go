@@ -0,0 +1,206 @@
+package network
+
+import (
+	"io"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestVersionMessageRoundTrip(t *testing.T) {
+	info := &VersionInfo{
+		ProtocolVersion: ProtocolVersion,
+		Magic:           MagicTestnet,
+		Features:        FeatureTxRelay,
+		BestHeight:      42,
+		TotalWork:       "123456789012345678901234567890",
+		UserAgent:       DefaultUserAgent,
+		Timestamp:       time.Now().Unix(),
+		Challenge:       make([]byte, ChallengeSize),
+	}
+
+	msg, err := NewVersionMessage(info)
+	if err != nil {
+		t.Fatalf("Failed to create version message: %v", err)
+	}
+	parsed, err := ParseVersionMessage(msg)
+	if err != nil {
+		t.Fatalf("Failed to parse version message: %v", err)
+	}
+	if !reflect.DeepEqual(parsed, info) {
+		t.Errorf("Expected %+v, got %+v", info, parsed)
+	}
+	if !parsed.HasFeature(FeatureTxRelay) {
+		t.Error("Expected tx relay feature")
+	}
+}
+
+func TestParseVersionMessageInvalid(t *testing.T) {
+	info := DefaultHandshakeConfig().localVersion()
+	info.Challenge = make([]byte, ChallengeSize)
+	info.TotalWork = "lots"
+	msg, err := NewVersionMessage(info)
+	if err != nil {
+		t.Fatalf("Failed to create version message: %v", err)
+	}
+	if _, err := ParseVersionMessage(msg); err == nil {
+		t.Error("Expected error for invalid total work")
+	}
+
+	info = DefaultHandshakeConfig().localVersion()
+	msg, err = NewVersionMessage(info)
+	if err != nil {
+		t.Fatalf("Failed to create version message: %v", err)
+	}
+	if _, err := ParseVersionMessage(msg); err == nil {
+		t.Error("Expected error for missing challenge")
+	}
+
+	if _, err := ParseVersionMessage(NewMessage(MessageTypeVersion, []byte{1, 2, 3})); err == nil {
+		t.Error("Expected error for truncated payload")
+	}
+
+	info = DefaultHandshakeConfig().localVersion()
+	info.UserAgent = string(make([]byte, MaxUserAgentLength+1))
+	if _, err := NewVersionMessage(info); err == nil {
+		t.Error("Expected error for long user agent")
+	}
+}
+
+func TestHandshake(t *testing.T) {
+	received := make(chan *Message, 4)
+	server := NewServer("127.0.0.1", 0, func(peer *Peer, msg *Message) {
+		received <- msg
+	})
+	config := DefaultHandshakeConfig()
+	config.ChainInfo = func() (int64, string) { return 7, "900" }
+	server.SetHandshakeConfig(config)
+	if err := server.Start(); err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+	defer server.Stop()
+
+	clientReceived := make(chan *Message, 4)
+	client := NewClient(server.Addr(), func(peer *Peer, msg *Message) {
+		clientReceived <- msg
+	})
+	if err := client.Connect(); err != nil {
+		t.Fatalf("Failed to connect client: %v", err)
+	}
+	defer client.Close()
+
+	// Queued before the handshake completes, delivered after it
+	if err := client.Send(NewPingMessage()); err != nil {
+		t.Fatalf("Failed to send ping: %v", err)
+	}
+
+	// The handler sees the peer's VERSION first, then other messages
+	for _, expected := range []MessageType{MessageTypeVersion, MessageTypePing} {
+		select {
+		case msg := <-received:
+			if msg.Type != expected {
+				t.Errorf("Expected %s, got %s", expected, msg.Type)
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatalf("Timeout waiting for %s", expected)
+		}
+	}
+
+	select {
+	case msg := <-clientReceived:
+		info, err := ParseVersionMessage(msg)
+		if err != nil {
+			t.Fatalf("Expected version message, got %v", err)
+		}
+		if info.BestHeight != 7 || info.TotalWork != "900" {
+			t.Errorf("Expected height 7 and work 900, got %d and %s", info.BestHeight, info.TotalWork)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("Timeout waiting for server version")
+	}
+
+	peer := client.Peer()
+	if !peer.HandshakeComplete() {
+		t.Error("Expected handshake to be complete")
+	}
+	if peer.RemoteVersion() == nil || peer.NegotiatedVersion() != ProtocolVersion {
+		t.Error("Expected negotiated remote version")
+	}
+	if peer.GetInfo().Version != DefaultUserAgent {
+		t.Errorf("Expected peer version %s, got %s", DefaultUserAgent, peer.GetInfo().Version)
+	}
+}
+
+func TestHandshakeMagicMismatch(t *testing.T) {
+	received := make(chan *Message, 4)
+	server := NewServer("127.0.0.1", 0, func(peer *Peer, msg *Message) {
+		received <- msg
+	})
+	if err := server.Start(); err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+	defer server.Stop()
+
+	client := NewClient(server.Addr(), func(peer *Peer, msg *Message) {})
+	config := DefaultHandshakeConfig()
+	config.Magic = MagicTestnet
+	config.Encryption = EncryptionDisabled // reach the VERSION exchange
+	client.SetHandshakeConfig(config)
+	if err := client.Connect(); err != nil {
+		t.Fatalf("Failed to connect client: %v", err)
+	}
+	defer client.Close()
+	client.Send(NewPingMessage())
+
+	deadline := time.Now().Add(3 * time.Second)
+	for client.IsConnected() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if client.IsConnected() {
+		t.Error("Expected peer on another network to be disconnected")
+	}
+
+	select {
+	case msg := <-received:
+		t.Errorf("Expected no message to reach the handler, got %s", msg.Type)
+	default:
+	}
+}
+
+func TestHandshakeRequiredBeforeMessages(t *testing.T) {
+	received := make(chan *Message, 4)
+	server := NewServer("127.0.0.1", 0, func(peer *Peer, msg *Message) {
+		received <- msg
+	})
+	if err := server.Start(); err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+	defer server.Stop()
+
+	conn, err := net.Dial("tcp", server.Addr())
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer conn.Close()
+
+	data, err := NewPingMessage().Serialize()
+	if err != nil {
+		t.Fatalf("Failed to serialize ping: %v", err)
+	}
+	if _, err := conn.Write(data); err != nil {
+		t.Fatalf("Failed to write ping: %v", err)
+	}
+
+	// The server sends its VERSION and then drops the connection
+	conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	if _, err := io.ReadAll(conn); err != nil {
+		t.Fatalf("Expected connection to be closed, got %v", err)
+	}
+
+	select {
+	case msg := <-received:
+		t.Errorf("Expected no message to reach the handler, got %s", msg.Type)
+	default:
+	}
+}
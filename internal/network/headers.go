@@ -0,0 +1,54 @@
+package network
+
+import (
+	"fmt"
+
+	"github.com/aliexe/blockChain/internal/encoding"
+)
+
+const (
+	// MaxHeadersPerMessage is the most block headers a HEADERS message may
+	// carry. A shorter answer means the peer has no more headers.
+	MaxHeadersPerMessage = 2000
+	// MaxLocatorHashes is the most hashes a block locator may list
+	MaxLocatorHashes = 101
+)
+
+// NewGetHeadersMessage creates a request for the headers following the
+// first locator hash the peer knows, up to stopHash or as many as fit in a
+// HEADERS message if stopHash is empty
+func NewGetHeadersMessage(locator [][]byte, stopHash []byte) (*Message, error) {
+	if len(locator) > MaxLocatorHashes {
+		return nil, fmt.Errorf("%d locator hashes exceed maximum %d", len(locator), MaxLocatorHashes)
+	}
+
+	w := encoding.NewWriter()
+	w.WriteUvarint(uint64(len(locator)))
+	for _, hash := range locator {
+		w.WriteBytes(hash)
+	}
+	w.WriteBytes(stopHash)
+	return NewMessage(MessageTypeGetHeaders, w.Bytes()), nil
+}
+
+// ParseGetHeadersMessage parses a request for headers
+func ParseGetHeadersMessage(msg *Message) (locator [][]byte, stopHash []byte, err error) {
+	if msg.Type != MessageTypeGetHeaders {
+		return nil, nil, fmt.Errorf("not a get headers message: %s", msg.Type)
+	}
+
+	r := encoding.NewReader(msg.Payload)
+	count := r.ReadCount(1)
+	if count > MaxLocatorHashes {
+		return nil, nil, fmt.Errorf("%d locator hashes exceed maximum %d", count, MaxLocatorHashes)
+	}
+	locator = make([][]byte, 0, count)
+	for i := 0; i < count && r.Err() == nil; i++ {
+		locator = append(locator, r.ReadBytes())
+	}
+	stopHash = r.ReadBytes()
+	if err := r.Finish(); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode get headers: %w", err)
+	}
+	return locator, stopHash, nil
+}
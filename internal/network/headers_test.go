@@ -0,0 +1,82 @@
+package network
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestGetHeadersMessageRoundTrip(t *testing.T) {
+	locator := [][]byte{{0x01, 0x02}, {0x03}, bytes.Repeat([]byte{0xaa}, 32)}
+	stopHash := bytes.Repeat([]byte{0xff}, 32)
+
+	msg, err := NewGetHeadersMessage(locator, stopHash)
+	if err != nil {
+		t.Fatalf("Failed to create get headers message: %v", err)
+	}
+	if msg.Type != MessageTypeGetHeaders {
+		t.Errorf("Expected type %s, got %s", MessageTypeGetHeaders, msg.Type)
+	}
+
+	data, err := msg.Serialize()
+	if err != nil {
+		t.Fatalf("Failed to serialize: %v", err)
+	}
+	decoded, err := Deserialize(data)
+	if err != nil {
+		t.Fatalf("Failed to deserialize: %v", err)
+	}
+
+	parsedLocator, parsedStop, err := ParseGetHeadersMessage(decoded)
+	if err != nil {
+		t.Fatalf("Failed to parse get headers message: %v", err)
+	}
+	if len(parsedLocator) != len(locator) {
+		t.Fatalf("Expected %d locator hashes, got %d", len(locator), len(parsedLocator))
+	}
+	for i := range locator {
+		if !bytes.Equal(parsedLocator[i], locator[i]) {
+			t.Errorf("Locator hash %d mismatch: expected %x, got %x", i, locator[i], parsedLocator[i])
+		}
+	}
+	if !bytes.Equal(parsedStop, stopHash) {
+		t.Errorf("Expected stop hash %x, got %x", stopHash, parsedStop)
+	}
+
+	// An empty stop hash asks for as many headers as fit
+	msg, err = NewGetHeadersMessage(locator[:1], nil)
+	if err != nil {
+		t.Fatalf("Failed to create get headers message: %v", err)
+	}
+	if _, parsedStop, err = ParseGetHeadersMessage(msg); err != nil || len(parsedStop) != 0 {
+		t.Errorf("Expected empty stop hash, got %x (%v)", parsedStop, err)
+	}
+}
+
+func TestParseGetHeadersMessageInvalid(t *testing.T) {
+	if _, _, err := ParseGetHeadersMessage(NewPingMessage()); err == nil {
+		t.Error("Expected error for invalid message type")
+	}
+
+	locator := make([][]byte, MaxLocatorHashes+1)
+	for i := range locator {
+		locator[i] = []byte{byte(i)}
+	}
+	if _, err := NewGetHeadersMessage(locator, nil); err == nil {
+		t.Error("Expected error for too many locator hashes")
+	}
+
+	msg, err := NewGetHeadersMessage(locator[:MaxLocatorHashes], nil)
+	if err != nil {
+		t.Fatalf("Failed to create get headers message: %v", err)
+	}
+	// Bump the count past the limit
+	msg.Payload[0] = MaxLocatorHashes + 1
+	if _, _, err := ParseGetHeadersMessage(msg); err == nil {
+		t.Error("Expected error for too many locator hashes")
+	}
+
+	truncated := NewMessage(MessageTypeGetHeaders, msg.Payload[:len(msg.Payload)-2])
+	if _, _, err := ParseGetHeadersMessage(truncated); err == nil {
+		t.Error("Expected error for truncated payload")
+	}
+}
@@ -0,0 +1,161 @@
+package network
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/aliexe/blockChain/internal/crypto"
+	"github.com/aliexe/blockChain/internal/encoding"
+)
+
+const (
+	// NodeKeyFileName is the file in the data directory holding the node key
+	NodeKeyFileName = "node_key.json"
+	// ChallengeSize is the length of the random challenge in VERSION messages
+	ChallengeSize = 32
+)
+
+// nodeAuthTag separates node authentication signatures from other uses of
+// the key
+const nodeAuthTag = "mxm node auth"
+
+// NodeKey is the key pair identifying a node to its peers. The node ID is
+// derived from the public key, so a peer proving possession of the private
+// key proves its identity.
+type NodeKey struct {
+	privateKey *ecdsa.PrivateKey
+}
+
+// NewNodeKey generates a new node key
+func NewNodeKey() (*NodeKey, error) {
+	keyPair, err := crypto.NewKeyPair()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate node key: %w", err)
+	}
+	return &NodeKey{privateKey: keyPair.PrivateKey}, nil
+}
+
+// LoadOrCreateNodeKey loads the node key from filename, creating and saving a
+// new one if the file does not exist
+func LoadOrCreateNodeKey(filename string) (*NodeKey, error) {
+	keyPair, err := crypto.LoadFromFile(filename)
+	if err == nil {
+		return &NodeKey{privateKey: keyPair.PrivateKey}, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to load node key: %w", err)
+	}
+
+	keyPair, err = crypto.NewKeyPair()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate node key: %w", err)
+	}
+	if err := keyPair.SaveToFile(filename); err != nil {
+		return nil, fmt.Errorf("failed to save node key: %w", err)
+	}
+	return &NodeKey{privateKey: keyPair.PrivateKey}, nil
+}
+
+// PublicKey returns the compressed public key
+func (k *NodeKey) PublicKey() []byte {
+	return crypto.CompressPublicKey(&k.privateKey.PublicKey)
+}
+
+// ID returns the node ID
+func (k *NodeKey) ID() string {
+	return NodeIDFromPublicKey(k.PublicKey())
+}
+
+// NodeIDFromPublicKey returns the node ID of a compressed public key: the hex
+// encoded SHA256 of the key
+func NodeIDFromPublicKey(publicKey []byte) string {
+	hash := sha256.Sum256(publicKey)
+	return hex.EncodeToString(hash[:])
+}
+
+// newChallenge returns a random handshake challenge
+func newChallenge() ([]byte, error) {
+	challenge := make([]byte, ChallengeSize)
+	if _, err := rand.Read(challenge); err != nil {
+		return nil, fmt.Errorf("failed to generate challenge: %w", err)
+	}
+	return challenge, nil
+}
+
+// authDigest returns the hash a node signs to answer a challenge: it commits
+// to the network, the challenge and the public key answering it
+func authDigest(magic uint32, challenge, publicKey []byte) []byte {
+	hash := sha256.New()
+	hash.Write([]byte(nodeAuthTag))
+	binary.Write(hash, binary.BigEndian, magic)
+	hash.Write(challenge)
+	hash.Write(publicKey)
+	return hash.Sum(nil)
+}
+
+// NewAuthVerAckMessage creates a VERACK answering the peer's challenge with
+// the node key
+func NewAuthVerAckMessage(key *NodeKey, magic uint32, challenge []byte) (*Message, error) {
+	payload, err := signNodeProof(key, func(publicKey []byte) []byte {
+		return authDigest(magic, challenge, publicKey)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign challenge: %w", err)
+	}
+	return NewMessage(MessageTypeVerAck, payload), nil
+}
+
+// VerifyAuthVerAck checks that a VERACK answers our challenge and returns
+// the node ID of the peer that signed it
+func VerifyAuthVerAck(msg *Message, magic uint32, challenge []byte) (string, error) {
+	if msg.Type != MessageTypeVerAck {
+		return "", fmt.Errorf("not a verack message: %s", msg.Type)
+	}
+	return verifyNodeProof(msg.Payload, func(publicKey []byte) []byte {
+		return authDigest(magic, challenge, publicKey)
+	})
+}
+
+// signNodeProof encodes the node public key with its signature of the digest
+// computed from it
+func signNodeProof(key *NodeKey, digest func(publicKey []byte) []byte) ([]byte, error) {
+	publicKey := key.PublicKey()
+	signature, err := ecdsa.SignASN1(rand.Reader, key.privateKey, digest(publicKey))
+	if err != nil {
+		return nil, err
+	}
+
+	w := encoding.NewWriter()
+	w.WriteBytes(publicKey)
+	w.WriteBytes(signature)
+	return w.Bytes(), nil
+}
+
+// verifyNodeProof checks a proof written by signNodeProof and returns the
+// node ID of the key that signed it
+func verifyNodeProof(payload []byte, digest func(publicKey []byte) []byte) (string, error) {
+	r := encoding.NewReader(payload)
+	publicKeyBytes := r.ReadBytes()
+	signature := r.ReadBytes()
+	if err := r.Finish(); err != nil {
+		return "", fmt.Errorf("failed to decode node proof: %w", err)
+	}
+	if len(signature) > MaxSignatureLength {
+		return "", fmt.Errorf("signature length %d exceeds maximum %d", len(signature), MaxSignatureLength)
+	}
+
+	publicKey, err := crypto.DecompressPublicKey(publicKeyBytes)
+	if err != nil {
+		return "", fmt.Errorf("invalid node key: %w", err)
+	}
+	if !ecdsa.VerifyASN1(publicKey, digest(publicKeyBytes), signature) {
+		return "", fmt.Errorf("invalid node signature")
+	}
+	return NodeIDFromPublicKey(publicKeyBytes), nil
+}
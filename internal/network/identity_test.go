@@ -0,0 +1,171 @@
+package network
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadOrCreateNodeKey(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), NodeKeyFileName)
+
+	key, err := LoadOrCreateNodeKey(filename)
+	if err != nil {
+		t.Fatalf("Failed to create node key: %v", err)
+	}
+	if _, err := os.Stat(filename); err != nil {
+		t.Fatalf("Expected node key file: %v", err)
+	}
+
+	loaded, err := LoadOrCreateNodeKey(filename)
+	if err != nil {
+		t.Fatalf("Failed to load node key: %v", err)
+	}
+	if loaded.ID() != key.ID() {
+		t.Errorf("Expected node ID %s after reload, got %s", key.ID(), loaded.ID())
+	}
+	if len(key.ID()) != 64 {
+		t.Errorf("Expected 64 character node ID, got %d", len(key.ID()))
+	}
+
+	if err := os.WriteFile(filename, []byte("not a key"), 0600); err != nil {
+		t.Fatalf("Failed to corrupt key file: %v", err)
+	}
+	if _, err := LoadOrCreateNodeKey(filename); err == nil {
+		t.Error("Expected error for corrupt key file")
+	}
+}
+
+func TestAuthVerAck(t *testing.T) {
+	key, err := NewNodeKey()
+	if err != nil {
+		t.Fatalf("Failed to create node key: %v", err)
+	}
+	challenge, err := newChallenge()
+	if err != nil {
+		t.Fatalf("Failed to create challenge: %v", err)
+	}
+
+	msg, err := NewAuthVerAckMessage(key, MagicMainnet, challenge)
+	if err != nil {
+		t.Fatalf("Failed to create verack: %v", err)
+	}
+
+	nodeID, err := VerifyAuthVerAck(msg, MagicMainnet, challenge)
+	if err != nil {
+		t.Fatalf("Failed to verify verack: %v", err)
+	}
+	if nodeID != key.ID() {
+		t.Errorf("Expected node ID %s, got %s", key.ID(), nodeID)
+	}
+
+	// The answer is bound to the challenge and the network
+	other, _ := newChallenge()
+	if _, err := VerifyAuthVerAck(msg, MagicMainnet, other); err == nil {
+		t.Error("Expected error for answer to another challenge")
+	}
+	if _, err := VerifyAuthVerAck(msg, MagicTestnet, challenge); err == nil {
+		t.Error("Expected error for answer on another network")
+	}
+	if _, err := VerifyAuthVerAck(NewMessage(MessageTypeVerAck, nil), MagicMainnet, challenge); err == nil {
+		t.Error("Expected error for verack without a key")
+	}
+}
+
+func TestHandshakeVerifiesNodeIdentity(t *testing.T) {
+	serverKey, _ := NewNodeKey()
+	clientKey, _ := NewNodeKey()
+
+	identified := make(chan string, 1)
+	server := NewServer("127.0.0.1", 0, func(peer *Peer, msg *Message) {
+		if msg.Type == MessageTypeVersion {
+			identified <- peer.NodeID()
+		}
+	})
+	config := server.GetHandshakeConfig()
+	config.NodeKey = serverKey
+	server.SetHandshakeConfig(config)
+	if err := server.Start(); err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+	defer server.Stop()
+
+	client := NewClient(server.Addr(), func(peer *Peer, msg *Message) {})
+	clientConfig := DefaultHandshakeConfig()
+	clientConfig.NodeKey = clientKey
+	client.SetHandshakeConfig(clientConfig)
+	if err := client.Connect(); err != nil {
+		t.Fatalf("Failed to connect client: %v", err)
+	}
+	defer client.Close()
+
+	select {
+	case nodeID := <-identified:
+		if nodeID != clientKey.ID() {
+			t.Errorf("Expected client node ID %s, got %s", clientKey.ID(), nodeID)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("Timeout waiting for handshake")
+	}
+
+	deadline := time.Now().Add(3 * time.Second)
+	for !client.Peer().HandshakeComplete() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if client.Peer().NodeID() != serverKey.ID() {
+		t.Errorf("Expected server node ID %s, got %s", serverKey.ID(), client.Peer().NodeID())
+	}
+}
+
+func TestHandshakeRejectsSelfAndBannedNodes(t *testing.T) {
+	key, _ := NewNodeKey()
+
+	server := NewServer("127.0.0.1", 0, func(peer *Peer, msg *Message) {})
+	discovery := NewDiscovery(server, []string{})
+	config := server.GetHandshakeConfig()
+	config.NodeKey = key
+	server.SetHandshakeConfig(config)
+	if err := server.Start(); err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+	defer server.Stop()
+
+	waitDisconnected := func(client *Client) bool {
+		deadline := time.Now().Add(3 * time.Second)
+		for client.IsConnected() && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		return !client.IsConnected()
+	}
+
+	// A node connecting to itself is dropped
+	self := NewClient(server.Addr(), func(peer *Peer, msg *Message) {})
+	self.SetHandshakeConfig(server.GetHandshakeConfig())
+	if err := self.Connect(); err != nil {
+		t.Fatalf("Failed to connect client: %v", err)
+	}
+	defer self.Close()
+	if !waitDisconnected(self) {
+		t.Error("Expected connection to self to be dropped")
+	}
+
+	// A banned identity is dropped whatever address it uses
+	bannedKey, _ := NewNodeKey()
+	discovery.BanNode(bannedKey.ID(), time.Hour)
+	if !discovery.IsNodeBanned(bannedKey.ID()) {
+		t.Fatal("Expected node to be banned")
+	}
+
+	banned := NewClient(server.Addr(), func(peer *Peer, msg *Message) {})
+	bannedConfig := DefaultHandshakeConfig()
+	bannedConfig.NodeKey = bannedKey
+	banned.SetHandshakeConfig(bannedConfig)
+	if err := banned.Connect(); err != nil {
+		t.Fatalf("Failed to connect client: %v", err)
+	}
+	defer banned.Close()
+	if !waitDisconnected(banned) {
+		t.Error("Expected banned node to be dropped")
+	}
+}
@@ -0,0 +1,218 @@
+package network
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aliexe/blockChain/internal/encoding"
+)
+
+const (
+	// MaxInvVectors is the most inventory items an INV or GET_DATA message
+	// may carry
+	MaxInvVectors = 50000
+
+	DefaultSeenFilterSize = 50000
+	DefaultSeenFilterTTL  = 10 * time.Minute
+)
+
+// InvType identifies the kind of object an inventory item refers to
+type InvType uint8
+
+const (
+	InvTypeTransaction InvType = iota + 1
+	InvTypeBlock
+)
+
+func (it InvType) String() string {
+	switch it {
+	case InvTypeTransaction:
+		return "TX"
+	case InvTypeBlock:
+		return "BLOCK"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// InvVector announces or requests a transaction or block by its hash: the
+// transaction ID or the hex encoded block hash
+type InvVector struct {
+	Type InvType `json:"type"`
+	Hash string  `json:"hash"`
+}
+
+// Key returns a string identifying the item across types
+func (iv InvVector) Key() string {
+	return fmt.Sprintf("%s:%s", iv.Type, iv.Hash)
+}
+
+// NewInvMessage creates an inventory announcement
+func NewInvMessage(vectors []InvVector) (*Message, error) {
+	payload, err := encodeInvVectors(vectors)
+	if err != nil {
+		return nil, err
+	}
+	return NewMessage(MessageTypeInv, payload), nil
+}
+
+// ParseInvMessage parses an inventory announcement
+func ParseInvMessage(msg *Message) ([]InvVector, error) {
+	if msg.Type != MessageTypeInv {
+		return nil, fmt.Errorf("not an inv message: %s", msg.Type)
+	}
+	return decodeInvVectors(msg.Payload)
+}
+
+// NewGetDataMessage creates a request for the announced items
+func NewGetDataMessage(vectors []InvVector) (*Message, error) {
+	payload, err := encodeInvVectors(vectors)
+	if err != nil {
+		return nil, err
+	}
+	return NewMessage(MessageTypeGetData, payload), nil
+}
+
+// ParseGetDataMessage parses a request for announced items
+func ParseGetDataMessage(msg *Message) ([]InvVector, error) {
+	if msg.Type != MessageTypeGetData {
+		return nil, fmt.Errorf("not a get data message: %s", msg.Type)
+	}
+	return decodeInvVectors(msg.Payload)
+}
+
+// encodeInvVectors encodes a list of inventory items
+func encodeInvVectors(vectors []InvVector) ([]byte, error) {
+	if len(vectors) == 0 {
+		return nil, fmt.Errorf("no inventory items")
+	}
+	if len(vectors) > MaxInvVectors {
+		return nil, fmt.Errorf("%d inventory items exceed maximum %d", len(vectors), MaxInvVectors)
+	}
+
+	w := encoding.NewWriter()
+	w.WriteUvarint(uint64(len(vectors)))
+	for _, vector := range vectors {
+		w.WriteUint8(uint8(vector.Type))
+		w.WriteString(vector.Hash)
+	}
+	return w.Bytes(), nil
+}
+
+// decodeInvVectors decodes a list of inventory items
+func decodeInvVectors(data []byte) ([]InvVector, error) {
+	r := encoding.NewReader(data)
+	count := r.ReadCount(2)
+	if count > MaxInvVectors {
+		return nil, fmt.Errorf("%d inventory items exceed maximum %d", count, MaxInvVectors)
+	}
+
+	vectors := make([]InvVector, 0, count)
+	for i := 0; i < count && r.Err() == nil; i++ {
+		vector := InvVector{
+			Type: InvType(r.ReadUint8()),
+			Hash: r.ReadString(),
+		}
+		if r.Err() == nil && vector.Type != InvTypeTransaction && vector.Type != InvTypeBlock {
+			r.Fail(fmt.Errorf("unknown inventory type %d", vector.Type))
+		}
+		vectors = append(vectors, vector)
+	}
+	if err := r.Finish(); err != nil {
+		return nil, fmt.Errorf("failed to decode inventory: %w", err)
+	}
+	return vectors, nil
+}
+
+// SeenFilter remembers recently seen keys, so announcements and objects are
+// processed once. It holds at most size keys, each for at most ttl; the
+// oldest keys are forgotten first.
+type SeenFilter struct {
+	size  int
+	ttl   time.Duration
+	seen  map[string]time.Time
+	order []string // oldest first
+	mu    sync.Mutex
+}
+
+// NewSeenFilter creates a filter holding up to size keys for ttl
+func NewSeenFilter(size int, ttl time.Duration) *SeenFilter {
+	if size <= 0 {
+		size = DefaultSeenFilterSize
+	}
+	if ttl <= 0 {
+		ttl = DefaultSeenFilterTTL
+	}
+	return &SeenFilter{
+		size: size,
+		ttl:  ttl,
+		seen: make(map[string]time.Time),
+	}
+}
+
+// Add marks a key as seen. It returns false if the key was already seen.
+func (sf *SeenFilter) Add(key string) bool {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+
+	now := time.Now()
+	sf.expireLocked(now)
+	if _, exists := sf.seen[key]; exists {
+		return false
+	}
+
+	sf.seen[key] = now
+	sf.order = append(sf.order, key)
+	for len(sf.order) > sf.size {
+		delete(sf.seen, sf.order[0])
+		sf.order = sf.order[1:]
+	}
+	return true
+}
+
+// Contains reports whether a key was seen recently
+func (sf *SeenFilter) Contains(key string) bool {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+
+	sf.expireLocked(time.Now())
+	_, exists := sf.seen[key]
+	return exists
+}
+
+// Remove forgets a key, so it is processed again the next time it is seen
+func (sf *SeenFilter) Remove(key string) {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+
+	if _, exists := sf.seen[key]; !exists {
+		return
+	}
+	delete(sf.seen, key)
+	for i, k := range sf.order {
+		if k == key {
+			sf.order = append(sf.order[:i], sf.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// Len returns the number of keys in the filter
+func (sf *SeenFilter) Len() int {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+
+	sf.expireLocked(time.Now())
+	return len(sf.seen)
+}
+
+// expireLocked forgets keys older than the ttl (assumes lock is held)
+func (sf *SeenFilter) expireLocked(now time.Time) {
+	expired := 0
+	for expired < len(sf.order) && now.Sub(sf.seen[sf.order[expired]]) > sf.ttl {
+		delete(sf.seen, sf.order[expired])
+		expired++
+	}
+	sf.order = sf.order[expired:]
+}
@@ -0,0 +1,131 @@
+package network
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestInvMessageRoundTrip(t *testing.T) {
+	vectors := []InvVector{
+		{Type: InvTypeTransaction, Hash: "ab12"},
+		{Type: InvTypeBlock, Hash: "00ff"},
+	}
+
+	msg, err := NewInvMessage(vectors)
+	if err != nil {
+		t.Fatalf("Failed to create inv message: %v", err)
+	}
+	if msg.Type != MessageTypeInv {
+		t.Errorf("Expected type %s, got %s", MessageTypeInv, msg.Type)
+	}
+
+	data, err := msg.Serialize()
+	if err != nil {
+		t.Fatalf("Failed to serialize: %v", err)
+	}
+	decoded, err := Deserialize(data)
+	if err != nil {
+		t.Fatalf("Failed to deserialize: %v", err)
+	}
+
+	parsed, err := ParseInvMessage(decoded)
+	if err != nil {
+		t.Fatalf("Failed to parse inv message: %v", err)
+	}
+	if len(parsed) != len(vectors) {
+		t.Fatalf("Expected %d vectors, got %d", len(vectors), len(parsed))
+	}
+	for i := range vectors {
+		if parsed[i] != vectors[i] {
+			t.Errorf("Vector %d: expected %+v, got %+v", i, vectors[i], parsed[i])
+		}
+	}
+
+	if _, err := ParseGetDataMessage(decoded); err == nil {
+		t.Error("Expected error parsing inv message as get data")
+	}
+}
+
+func TestGetDataMessage(t *testing.T) {
+	msg, err := NewGetDataMessage([]InvVector{{Type: InvTypeTransaction, Hash: "ab12"}})
+	if err != nil {
+		t.Fatalf("Failed to create get data message: %v", err)
+	}
+
+	parsed, err := ParseGetDataMessage(msg)
+	if err != nil {
+		t.Fatalf("Failed to parse get data message: %v", err)
+	}
+	if len(parsed) != 1 || parsed[0].Hash != "ab12" {
+		t.Errorf("Unexpected vectors: %+v", parsed)
+	}
+
+	if _, err := NewGetDataMessage(nil); err == nil {
+		t.Error("Expected error for empty inventory")
+	}
+}
+
+func TestParseInvMessageInvalid(t *testing.T) {
+	msg := NewMessage(MessageTypeInv, []byte{1, 9, 1, 'a'})
+	if _, err := ParseInvMessage(msg); err == nil {
+		t.Error("Expected error for unknown inventory type")
+	}
+
+	msg = NewMessage(MessageTypeInv, []byte{100, 1})
+	if _, err := ParseInvMessage(msg); err == nil {
+		t.Error("Expected error for count exceeding payload")
+	}
+
+	msg = NewMessage(MessageTypeInv, []byte{1, 1, 1, 'a', 0})
+	if _, err := ParseInvMessage(msg); err == nil {
+		t.Error("Expected error for trailing data")
+	}
+}
+
+func TestSeenFilter(t *testing.T) {
+	filter := NewSeenFilter(3, time.Minute)
+
+	if !filter.Add("a") {
+		t.Error("Expected first add to succeed")
+	}
+	if filter.Add("a") {
+		t.Error("Expected duplicate add to fail")
+	}
+	if !filter.Contains("a") {
+		t.Error("Expected filter to contain a")
+	}
+
+	// Oldest keys are forgotten beyond the size
+	for i := 0; i < 3; i++ {
+		filter.Add(fmt.Sprintf("key-%d", i))
+	}
+	if filter.Contains("a") {
+		t.Error("Expected oldest key to be evicted")
+	}
+	if filter.Len() != 3 {
+		t.Errorf("Expected 3 keys, got %d", filter.Len())
+	}
+
+	filter.Remove("key-1")
+	if filter.Contains("key-1") {
+		t.Error("Expected removed key to be forgotten")
+	}
+	if !filter.Add("key-1") {
+		t.Error("Expected removed key to be added again")
+	}
+}
+
+func TestSeenFilterExpiry(t *testing.T) {
+	filter := NewSeenFilter(10, 20*time.Millisecond)
+	filter.Add("a")
+
+	time.Sleep(40 * time.Millisecond)
+
+	if filter.Contains("a") {
+		t.Error("Expected key to expire")
+	}
+	if !filter.Add("a") {
+		t.Error("Expected expired key to be added again")
+	}
+}
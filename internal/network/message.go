@@ -44,6 +44,12 @@ const (
 	MessageTypeTransaction
 	MessageTypeGetBlockchain
 	MessageTypeBlockchain
+	MessageTypeInv
+	MessageTypeGetData
+	MessageTypeVersion
+	MessageTypeVerAck
+	MessageTypeGetHeaders
+	MessageTypeHeaders
 	MessageTypeUnknown
 )
 
@@ -69,6 +75,18 @@ func (mt MessageType) String() string {
 		return "GET_BLOCKCHAIN"
 	case MessageTypeBlockchain:
 		return "BLOCKCHAIN"
+	case MessageTypeInv:
+		return "INV"
+	case MessageTypeGetData:
+		return "GET_DATA"
+	case MessageTypeVersion:
+		return "VERSION"
+	case MessageTypeVerAck:
+		return "VERACK"
+	case MessageTypeGetHeaders:
+		return "GET_HEADERS"
+	case MessageTypeHeaders:
+		return "HEADERS"
 	default:
 		return "UNKNOWN"
 	}
@@ -231,6 +231,12 @@ func TestMessageTypeString(t *testing.T) {
 		{MessageTypeTransaction, "TRANSACTION"},
 		{MessageTypeGetBlockchain, "GET_BLOCKCHAIN"},
 		{MessageTypeBlockchain, "BLOCKCHAIN"},
+		{MessageTypeInv, "INV"},
+		{MessageTypeGetData, "GET_DATA"},
+		{MessageTypeVersion, "VERSION"},
+		{MessageTypeVerAck, "VERACK"},
+		{MessageTypeGetHeaders, "GET_HEADERS"},
+		{MessageTypeHeaders, "HEADERS"},
 		{MessageTypeUnknown, "UNKNOWN"},
 	}
 
@@ -17,6 +17,8 @@ type PeerInfo struct {
 	Port      int       `json:"port"`
 	LastSeen  time.Time `json:"last_seen"`
 	Version   string    `json:"version"`
+	NodeID    string    `json:"node_id,omitempty"` // verified during the handshake
+	Encrypted bool      `json:"encrypted"`
 	Connected bool      `json:"connected"`
 }
 
@@ -26,6 +28,7 @@ type Peer struct {
 	conn      net.Conn
 	sendChan  chan *Message
 	closeChan chan struct{}
+	handshake *handshakeState // nil for peers without a handshake
 	mu        sync.RWMutex
 }
 
@@ -36,8 +39,13 @@ func NewPeer(conn net.Conn, id string) *Peer {
 	portNum := 0
 	fmt.Sscanf(port, "%d", &portNum)
 
-	// Configure TCP keepalive
-	if tcpConn, ok := conn.(*net.TCPConn); ok {
+	// Configure TCP keepalive on the connection under any encryption
+	rawConn := conn
+	if wrapped, ok := conn.(interface{ NetConn() net.Conn }); ok {
+		rawConn = wrapped.NetConn()
+	}
+	_, encrypted := conn.(*secureConn)
+	if tcpConn, ok := rawConn.(*net.TCPConn); ok {
 		tcpConn.SetKeepAlive(true)
 		tcpConn.SetKeepAlivePeriod(30 * time.Second)
 		tcpConn.SetNoDelay(true) // Disable Nagle's algorithm for better latency
@@ -49,6 +57,7 @@ func NewPeer(conn net.Conn, id string) *Peer {
 			Address:   host,
 			Port:      portNum,
 			LastSeen:  time.Now(),
+			Encrypted: encrypted,
 			Connected: true,
 		},
 		conn:      conn,
@@ -124,37 +133,73 @@ func (p *Peer) IsConnected() bool {
 	return p.info.Connected
 }
 
-// startSender starts the sender goroutine
+// Encrypted reports whether the connection uses the encrypted transport
+func (p *Peer) Encrypted() bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.info.Encrypted
+}
+
+// startSender starts the sender goroutine. During a handshake only
+// handshake messages are written; queued messages wait until it completes.
 func (p *Peer) startSender() {
+	p.mu.RLock()
+	hs := p.handshake
+	p.mu.RUnlock()
+
+	var control chan *Message
+	var ready chan struct{}
+	if hs != nil {
+		control = hs.control
+		ready = hs.ready
+	}
+
 	go func() {
 		for {
-			select {
-			case msg := <-p.sendChan:
-				data, err := msg.Serialize()
-				if err != nil {
-					fmt.Printf("Error serializing message: %v\n", err)
-					continue
-				}
-
-				// Set write deadline to prevent blocking
-				if err := p.conn.SetWriteDeadline(time.Now().Add(5 * time.Second)); err != nil {
-					fmt.Printf("Error setting write deadline: %v\n", err)
-					p.Close()
-					return
-				}
+			queue := p.sendChan
+			if ready != nil {
+				queue = nil
+			}
 
-				if _, err := p.conn.Write(data); err != nil {
-					fmt.Printf("Error sending message: %v\n", err)
-					p.Close()
-					return
-				}
+			var msg *Message
+			select {
+			case msg = <-control:
+			case msg = <-queue:
+			case <-ready:
+				ready = nil
+				continue
 			case <-p.closeChan:
 				return
 			}
+
+			if err := p.writeMessage(msg); err != nil {
+				fmt.Printf("Error sending message: %v\n", err)
+				p.Close()
+				return
+			}
 		}
 	}()
 }
 
+// writeMessage serializes a message and writes it to the connection
+func (p *Peer) writeMessage(msg *Message) error {
+	data, err := msg.Serialize()
+	if err != nil {
+		fmt.Printf("Error serializing message: %v\n", err)
+		return nil
+	}
+
+	// Set write deadline to prevent blocking
+	if err := p.conn.SetWriteDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		return fmt.Errorf("failed to set write deadline: %w", err)
+	}
+
+	if _, err := p.conn.Write(data); err != nil {
+		return err
+	}
+	return nil
+}
+
 // startReceiver starts the receiver goroutine
 func (p *Peer) startReceiver(handler MessageHandler) error {
 	go func() {
@@ -177,6 +222,20 @@ func (p *Peer) startReceiver(handler MessageHandler) error {
 
 			p.UpdateLastSeen()
 
+			p.mu.RLock()
+			hs := p.handshake
+			p.mu.RUnlock()
+			if hs != nil {
+				msg, err = p.handleHandshakeMessage(msg)
+				if err != nil {
+					fmt.Printf("Handshake with %s failed: %v\n", p.GetInfo().ID, err)
+					return
+				}
+				if msg == nil {
+					continue
+				}
+			}
+
 			if handler != nil {
 				handler(p, msg)
 			}
@@ -291,6 +350,7 @@ type Server struct {
 	rateLimiter map[string]time.Time
 	rateMu      sync.RWMutex
 	cleanupDone chan struct{}
+	handshake   HandshakeConfig
 }
 
 // NewServer creates a new TCP server
@@ -304,6 +364,7 @@ func NewServer(address string, port int, handler MessageHandler) *Server {
 		maxPeers:    100,
 		rateLimiter: make(map[string]time.Time),
 		cleanupDone: make(chan struct{}),
+		handshake:   DefaultHandshakeConfig(),
 	}
 	// Start rate limiter cleanup goroutine
 	go s.rateLimiterCleanup()
@@ -349,6 +410,37 @@ func (s *Server) rateLimiterCleanup() {
 	}
 }
 
+// SetHandshakeConfig sets what the server advertises to new peers and which
+// network they must belong to
+func (s *Server) SetHandshakeConfig(config HandshakeConfig) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handshake = config
+}
+
+// GetHandshakeConfig returns the handshake configuration for new peers
+func (s *Server) GetHandshakeConfig() HandshakeConfig {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.handshake
+}
+
+// nodeHandshakeConfig returns the handshake configuration for new peers,
+// creating a node key for the lifetime of the server if none is set
+func (s *Server) nodeHandshakeConfig() (HandshakeConfig, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.handshake.NodeKey == nil {
+		key, err := NewNodeKey()
+		if err != nil {
+			return HandshakeConfig{}, err
+		}
+		s.handshake.NodeKey = key
+	}
+	return s.handshake, nil
+}
+
 // Stop stops the server
 func (s *Server) Stop() error {
 	close(s.closeChan)
@@ -426,7 +518,43 @@ func (s *Server) handleConnection(conn net.Conn) {
 	peerID := fmt.Sprintf("peer-%d", s.peerCounter)
 	s.mu.Unlock()
 
+	config, err := s.nodeHandshakeConfig()
+	if err != nil {
+		fmt.Printf("Error starting handshake: %v\n", err)
+		conn.Close()
+		return
+	}
+	if config.Encryption == EncryptionDisabled {
+		s.addPeer(conn, peerID, config)
+		return
+	}
+
+	// Telling encrypted connections from plaintext ones waits for the peer,
+	// so it must not hold up accepting others
+	go func() {
+		transportConn, err := acceptTransport(conn, config)
+		if err != nil {
+			fmt.Printf("Connection rejected from %s: %v\n", remoteAddr, err)
+			conn.Close()
+			return
+		}
+		select {
+		case <-s.closeChan:
+			conn.Close()
+		default:
+			s.addPeer(transportConn, peerID, config)
+		}
+	}()
+}
+
+// addPeer starts the handshake and message loops of a new connection
+func (s *Server) addPeer(conn net.Conn, peerID string, config HandshakeConfig) {
 	peer := NewPeer(conn, peerID)
+	if err := peer.startHandshake(config); err != nil {
+		fmt.Printf("Error starting handshake: %v\n", err)
+		conn.Close()
+		return
+	}
 	peer.startSender()
 
 	if err := peer.startReceiver(s.handler); err != nil {
@@ -467,6 +595,31 @@ func (s *Server) Broadcast(msg *Message) {
 	}
 }
 
+// Relay sends a message to all connected peers except the one it came from.
+// Unlike Broadcast it is not rate limited, as relayed inventory is already
+// deduplicated by the receivers.
+func (s *Server) Relay(msg *Message, except *Peer) {
+	s.peersMu.RLock()
+	defer s.peersMu.RUnlock()
+
+	for _, peer := range s.peers {
+		if peer == except || !peer.IsConnected() {
+			continue
+		}
+		if err := peer.Send(msg); err != nil {
+			fmt.Printf("Error relaying to peer %s: %v\n", peer.GetInfo().ID, err)
+		}
+	}
+}
+
+// Addr returns the address the server is listening on
+func (s *Server) Addr() string {
+	if s.listener == nil {
+		return fmt.Sprintf("%s:%d", s.address, s.port)
+	}
+	return s.listener.Addr().String()
+}
+
 // GetPeers returns all connected peers
 func (s *Server) GetPeers() []PeerInfo {
 	s.peersMu.RLock()
@@ -500,6 +653,7 @@ type Client struct {
 	serverAddr string
 	peer       *Peer
 	handler    MessageHandler
+	handshake  HandshakeConfig
 }
 
 // NewClient creates a new TCP client
@@ -507,9 +661,16 @@ func NewClient(serverAddr string, handler MessageHandler) *Client {
 	return &Client{
 		serverAddr: serverAddr,
 		handler:    handler,
+		handshake:  DefaultHandshakeConfig(),
 	}
 }
 
+// SetHandshakeConfig sets what the client advertises to the server. It must
+// be called before Connect.
+func (c *Client) SetHandshakeConfig(config HandshakeConfig) {
+	c.handshake = config
+}
+
 // Connect connects to the server
 func (c *Client) Connect() error {
 	conn, err := net.Dial("tcp", c.serverAddr)
@@ -517,7 +678,27 @@ func (c *Client) Connect() error {
 		return fmt.Errorf("failed to connect to server: %w", err)
 	}
 
+	config := c.handshake
+	if config.NodeKey == nil {
+		if config.NodeKey, err = NewNodeKey(); err != nil {
+			conn.Close()
+			return err
+		}
+	}
+	if config.Encryption != EncryptionDisabled {
+		secure, err := secureOutbound(conn, config)
+		if err != nil {
+			conn.Close()
+			return fmt.Errorf("failed to encrypt connection: %w", err)
+		}
+		conn = secure
+	}
+
 	c.peer = NewPeer(conn, "client")
+	if err := c.peer.startHandshake(config); err != nil {
+		conn.Close()
+		return err
+	}
 	c.peer.startSender()
 
 	if err := c.peer.startReceiver(c.handler); err != nil {
@@ -544,6 +725,11 @@ func (c *Client) Close() error {
 	return nil
 }
 
+// Peer returns the connection to the server, or nil before Connect
+func (c *Client) Peer() *Peer {
+	return c.peer
+}
+
 // IsConnected returns whether the client is connected
 func (c *Client) IsConnected() bool {
 	if c.peer == nil {
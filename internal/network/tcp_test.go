@@ -473,3 +473,60 @@ func TestServerContextCancellation(t *testing.T) {
 		t.Error("Expected error when connecting to stopped server")
 	}
 }
+
+func TestServerRelay(t *testing.T) {
+	received := make(chan int, 4)
+
+	server := NewServer("127.0.0.1", 0, nil)
+	if err := server.Start(); err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+	defer server.Stop()
+
+	for i := 0; i < 2; i++ {
+		id := i
+		client := NewClient(server.Addr(), func(peer *Peer, msg *Message) {
+			if msg.Type == MessageTypeInv {
+				received <- id
+			}
+		})
+		if err := client.Connect(); err != nil {
+			t.Fatalf("Failed to connect client: %v", err)
+		}
+		defer client.Close()
+	}
+
+	// Wait for connections to establish
+	time.Sleep(100 * time.Millisecond)
+
+	server.peersMu.RLock()
+	var except *Peer
+	for _, peer := range server.peers {
+		except = peer
+		break
+	}
+	server.peersMu.RUnlock()
+
+	msg, err := NewInvMessage([]InvVector{{Type: InvTypeTransaction, Hash: "ab12"}})
+	if err != nil {
+		t.Fatalf("Failed to create inv message: %v", err)
+	}
+
+	// Relays are not rate limited like broadcasts
+	server.Relay(msg, except)
+	server.Relay(msg, except)
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-received:
+		case <-time.After(3 * time.Second):
+			t.Fatalf("Timeout waiting for relay %d", i+1)
+		}
+	}
+
+	select {
+	case <-received:
+		t.Error("Expected the excluded peer not to receive the relay")
+	case <-time.After(200 * time.Millisecond):
+	}
+}
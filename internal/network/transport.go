@@ -0,0 +1,436 @@
+package network
+
+import (
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// EncryptionMode selects whether peer connections are encrypted
+type EncryptionMode uint8
+
+const (
+	// EncryptionDisabled sends everything in plaintext
+	EncryptionDisabled EncryptionMode = iota
+	// EncryptionEnabled encrypts outgoing connections and accepts both
+	// encrypted and plaintext incoming ones
+	EncryptionEnabled
+	// EncryptionRequired encrypts outgoing connections and rejects plaintext
+	// incoming ones
+	EncryptionRequired
+)
+
+func (em EncryptionMode) String() string {
+	switch em {
+	case EncryptionDisabled:
+		return "disabled"
+	case EncryptionEnabled:
+		return "enabled"
+	case EncryptionRequired:
+		return "required"
+	default:
+		return "unknown"
+	}
+}
+
+const (
+	// MaxFrameSize is the largest encrypted frame, including its tag
+	MaxFrameSize = 65535
+
+	// transportHello is the first byte of an encrypted connection. Plaintext
+	// connections start with a message header instead, whose first byte is
+	// the protocol version.
+	transportHello byte = 0xe0
+
+	transportProtocol = "mxm_XX_25519_ChaChaPoly_SHA256"
+	transportAuthTag  = "mxm transport auth"
+)
+
+// transportHandshake is the hash and key state of a Noise-style XX
+// handshake. Both sides exchange X25519 ephemeral keys, and then prove their
+// node key by signing the handshake hash, encrypted under the shared secret.
+// The initiator proves its key first, so the responder only reveals its
+// identity to authenticated peers and has accepted the connection by the
+// time the initiator completes:
+//
+//	-> e
+//	<- e, ee
+//	-> proof
+//	<- proof
+type transportHandshake struct {
+	hash     []byte // commits to everything sent so far
+	chainKey []byte
+	aead     cipher.AEAD // nil until the keys are mixed in
+	nonce    uint64
+}
+
+// newTransportHandshake starts a handshake on the network of magic, so
+// nodes of different networks fail to agree on keys
+func newTransportHandshake(magic uint32) *transportHandshake {
+	hash := sha256.Sum256([]byte(transportProtocol))
+	th := &transportHandshake{
+		hash:     hash[:],
+		chainKey: hash[:],
+	}
+	prologue := make([]byte, 4)
+	binary.BigEndian.PutUint32(prologue, magic)
+	th.mixHash(prologue)
+	return th
+}
+
+// mixHash adds data to the handshake hash
+func (th *transportHandshake) mixHash(data []byte) {
+	hash := sha256.New()
+	hash.Write(th.hash)
+	hash.Write(data)
+	th.hash = hash.Sum(nil)
+}
+
+// mixKey derives the next chaining key and handshake cipher from a shared
+// secret
+func (th *transportHandshake) mixKey(secret []byte) error {
+	keys, err := hkdf.Key(sha256.New, secret, th.chainKey, transportProtocol, 2*chacha20poly1305.KeySize)
+	if err != nil {
+		return fmt.Errorf("failed to derive keys: %w", err)
+	}
+	th.chainKey = keys[:chacha20poly1305.KeySize]
+	th.aead, err = chacha20poly1305.New(keys[chacha20poly1305.KeySize:])
+	if err != nil {
+		return fmt.Errorf("failed to create cipher: %w", err)
+	}
+	th.nonce = 0
+	return nil
+}
+
+// encryptAndHash encrypts a handshake payload bound to the handshake hash
+func (th *transportHandshake) encryptAndHash(plaintext []byte) []byte {
+	ciphertext := th.aead.Seal(nil, transportNonce(th.nonce), plaintext, th.hash)
+	th.nonce++
+	th.mixHash(ciphertext)
+	return ciphertext
+}
+
+// decryptAndHash decrypts a payload written by encryptAndHash
+func (th *transportHandshake) decryptAndHash(ciphertext []byte) ([]byte, error) {
+	plaintext, err := th.aead.Open(nil, transportNonce(th.nonce), ciphertext, th.hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt handshake: %w", err)
+	}
+	th.nonce++
+	th.mixHash(ciphertext)
+	return plaintext, nil
+}
+
+// proofDigest returns the digest a node signs to prove its key in the
+// handshake at its current hash
+func (th *transportHandshake) proofDigest() func(publicKey []byte) []byte {
+	handshakeHash := th.hash
+	return func(publicKey []byte) []byte {
+		hash := sha256.New()
+		hash.Write([]byte(transportAuthTag))
+		hash.Write(handshakeHash)
+		hash.Write(publicKey)
+		return hash.Sum(nil)
+	}
+}
+
+// exchangeEphemeral mixes the remote ephemeral key and the shared secret
+// into the handshake
+func (th *transportHandshake) exchangeEphemeral(local *ecdh.PrivateKey, remoteBytes []byte) error {
+	remote, err := ecdh.X25519().NewPublicKey(remoteBytes)
+	if err != nil {
+		return fmt.Errorf("invalid ephemeral key: %w", err)
+	}
+	secret, err := local.ECDH(remote)
+	if err != nil {
+		return fmt.Errorf("failed to agree on key: %w", err)
+	}
+	return th.mixKey(secret)
+}
+
+// split derives the ciphers for each direction once the handshake completed
+func (th *transportHandshake) split(initiator bool) (send, recv cipher.AEAD, err error) {
+	keys, err := hkdf.Key(sha256.New, nil, th.chainKey, transportProtocol, 2*chacha20poly1305.KeySize)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to derive keys: %w", err)
+	}
+	initiatorCipher, err := chacha20poly1305.New(keys[:chacha20poly1305.KeySize])
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	responderCipher, err := chacha20poly1305.New(keys[chacha20poly1305.KeySize:])
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	if initiator {
+		return initiatorCipher, responderCipher, nil
+	}
+	return responderCipher, initiatorCipher, nil
+}
+
+// secureOutbound runs the initiator side of the transport handshake and
+// returns the encrypted connection
+func secureOutbound(conn net.Conn, config HandshakeConfig) (*secureConn, error) {
+	if err := conn.SetDeadline(time.Now().Add(HandshakeTimeout)); err != nil {
+		return nil, fmt.Errorf("failed to set deadline: %w", err)
+	}
+
+	th := newTransportHandshake(config.Magic)
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate ephemeral key: %w", err)
+	}
+	th.mixHash(ephemeral.PublicKey().Bytes())
+	hello := append([]byte{transportHello}, ephemeral.PublicKey().Bytes()...)
+	if _, err := conn.Write(hello); err != nil {
+		return nil, fmt.Errorf("failed to send hello: %w", err)
+	}
+
+	remoteEphemeral := make([]byte, len(ephemeral.PublicKey().Bytes()))
+	if _, err := io.ReadFull(conn, remoteEphemeral); err != nil {
+		return nil, fmt.Errorf("failed to read ephemeral key: %w", err)
+	}
+	th.mixHash(remoteEphemeral)
+	if err := th.exchangeEphemeral(ephemeral, remoteEphemeral); err != nil {
+		return nil, err
+	}
+
+	if err := writeNodeProof(conn, th, config.NodeKey); err != nil {
+		return nil, err
+	}
+	remoteID, err := readNodeProof(conn, th)
+	if err != nil {
+		return nil, err
+	}
+	return newSecureConn(conn, th, true, remoteID)
+}
+
+// secureInbound runs the responder side of the transport handshake, after
+// the hello byte was read, and returns the encrypted connection
+func secureInbound(conn net.Conn, config HandshakeConfig) (*secureConn, error) {
+	if err := conn.SetDeadline(time.Now().Add(HandshakeTimeout)); err != nil {
+		return nil, fmt.Errorf("failed to set deadline: %w", err)
+	}
+
+	th := newTransportHandshake(config.Magic)
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate ephemeral key: %w", err)
+	}
+	remoteEphemeral := make([]byte, len(ephemeral.PublicKey().Bytes()))
+	if _, err := io.ReadFull(conn, remoteEphemeral); err != nil {
+		return nil, fmt.Errorf("failed to read ephemeral key: %w", err)
+	}
+	th.mixHash(remoteEphemeral)
+
+	th.mixHash(ephemeral.PublicKey().Bytes())
+	if _, err := conn.Write(ephemeral.PublicKey().Bytes()); err != nil {
+		return nil, fmt.Errorf("failed to send ephemeral key: %w", err)
+	}
+	if err := th.exchangeEphemeral(ephemeral, remoteEphemeral); err != nil {
+		return nil, err
+	}
+
+	remoteID, err := readNodeProof(conn, th)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeNodeProof(conn, th, config.NodeKey); err != nil {
+		return nil, err
+	}
+	return newSecureConn(conn, th, false, remoteID)
+}
+
+// writeNodeProof sends the encrypted proof of the node key
+func writeNodeProof(conn net.Conn, th *transportHandshake, key *NodeKey) error {
+	proof, err := signNodeProof(key, th.proofDigest())
+	if err != nil {
+		return fmt.Errorf("failed to sign handshake: %w", err)
+	}
+	if err := writeFrame(conn, th.encryptAndHash(proof)); err != nil {
+		return fmt.Errorf("failed to send node proof: %w", err)
+	}
+	return nil
+}
+
+// readNodeProof reads the peer's proof of its node key and returns its
+// node ID
+func readNodeProof(conn net.Conn, th *transportHandshake) (string, error) {
+	frame, err := readFrame(conn)
+	if err != nil {
+		return "", fmt.Errorf("failed to read node proof: %w", err)
+	}
+	digest := th.proofDigest()
+	proof, err := th.decryptAndHash(frame)
+	if err != nil {
+		return "", err
+	}
+	return verifyNodeProof(proof, digest)
+}
+
+// acceptTransport reads the first byte of an incoming connection to tell
+// encrypted connections from plaintext ones, and runs the transport
+// handshake for encrypted ones
+func acceptTransport(conn net.Conn, config HandshakeConfig) (net.Conn, error) {
+	if err := conn.SetReadDeadline(time.Now().Add(HandshakeTimeout)); err != nil {
+		return nil, fmt.Errorf("failed to set read deadline: %w", err)
+	}
+	first := make([]byte, 1)
+	if _, err := io.ReadFull(conn, first); err != nil {
+		return nil, fmt.Errorf("failed to read hello: %w", err)
+	}
+
+	if first[0] != transportHello {
+		if config.Encryption == EncryptionRequired {
+			return nil, fmt.Errorf("plaintext connection rejected: encryption required")
+		}
+		return &prefixConn{Conn: conn, prefix: first}, nil
+	}
+	return secureInbound(conn, config)
+}
+
+// transportNonce returns the AEAD nonce for a message counter
+func transportNonce(counter uint64) []byte {
+	nonce := make([]byte, chacha20poly1305.NonceSize)
+	binary.LittleEndian.PutUint64(nonce[4:], counter)
+	return nonce
+}
+
+// writeFrame writes a length prefixed frame
+func writeFrame(w io.Writer, frame []byte) error {
+	if len(frame) > MaxFrameSize {
+		return fmt.Errorf("frame size %d exceeds maximum %d", len(frame), MaxFrameSize)
+	}
+	data := make([]byte, 2+len(frame))
+	binary.BigEndian.PutUint16(data, uint16(len(frame)))
+	copy(data[2:], frame)
+	_, err := w.Write(data)
+	return err
+}
+
+// readFrame reads a frame written by writeFrame
+func readFrame(r io.Reader) ([]byte, error) {
+	lengthBytes := make([]byte, 2)
+	if _, err := io.ReadFull(r, lengthBytes); err != nil {
+		return nil, err
+	}
+	frame := make([]byte, binary.BigEndian.Uint16(lengthBytes))
+	if _, err := io.ReadFull(r, frame); err != nil {
+		return nil, err
+	}
+	return frame, nil
+}
+
+// secureConn encrypts everything written to a connection and decrypts
+// everything read from it, in frames of at most MaxFrameSize bytes
+type secureConn struct {
+	net.Conn
+	remoteID  string // node ID proven during the handshake
+	send      cipher.AEAD
+	recv      cipher.AEAD
+	sendNonce uint64
+	recvNonce uint64
+	readBuf   []byte // decrypted bytes not read yet
+	readMu    sync.Mutex
+	writeMu   sync.Mutex
+}
+
+// newSecureConn wraps conn with the ciphers of a completed handshake
+func newSecureConn(conn net.Conn, th *transportHandshake, initiator bool, remoteID string) (*secureConn, error) {
+	send, recv, err := th.split(initiator)
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		return nil, fmt.Errorf("failed to clear deadline: %w", err)
+	}
+	return &secureConn{
+		Conn:     conn,
+		remoteID: remoteID,
+		send:     send,
+		recv:     recv,
+	}, nil
+}
+
+// Read reads decrypted data, reading and decrypting the next frame when
+// the previous one is used up
+func (sc *secureConn) Read(b []byte) (int, error) {
+	sc.readMu.Lock()
+	defer sc.readMu.Unlock()
+
+	for len(sc.readBuf) == 0 {
+		frame, err := readFrame(sc.Conn)
+		if err != nil {
+			return 0, err
+		}
+		plaintext, err := sc.recv.Open(frame[:0], transportNonce(sc.recvNonce), frame, nil)
+		if err != nil {
+			return 0, fmt.Errorf("failed to decrypt frame: %w", err)
+		}
+		sc.recvNonce++
+		sc.readBuf = plaintext
+	}
+
+	n := copy(b, sc.readBuf)
+	sc.readBuf = sc.readBuf[n:]
+	return n, nil
+}
+
+// Write encrypts b and writes it in as many frames as needed
+func (sc *secureConn) Write(b []byte) (int, error) {
+	sc.writeMu.Lock()
+	defer sc.writeMu.Unlock()
+
+	maxPlaintext := MaxFrameSize - sc.send.Overhead()
+	written := 0
+	for written < len(b) {
+		chunk := b[written:]
+		if len(chunk) > maxPlaintext {
+			chunk = chunk[:maxPlaintext]
+		}
+		ciphertext := sc.send.Seal(nil, transportNonce(sc.sendNonce), chunk, nil)
+		sc.sendNonce++
+		if err := writeFrame(sc.Conn, ciphertext); err != nil {
+			return written, err
+		}
+		written += len(chunk)
+	}
+	return written, nil
+}
+
+// NetConn returns the underlying connection
+func (sc *secureConn) NetConn() net.Conn {
+	return sc.Conn
+}
+
+// prefixConn replays bytes already read from a connection before reading
+// from it again
+type prefixConn struct {
+	net.Conn
+	prefix []byte
+}
+
+// Read returns the replayed bytes first
+func (pc *prefixConn) Read(b []byte) (int, error) {
+	if len(pc.prefix) > 0 {
+		n := copy(b, pc.prefix)
+		pc.prefix = pc.prefix[n:]
+		return n, nil
+	}
+	return pc.Conn.Read(b)
+}
+
+// NetConn returns the underlying connection
+func (pc *prefixConn) NetConn() net.Conn {
+	return pc.Conn
+}
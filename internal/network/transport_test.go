@@ -0,0 +1,220 @@
+package network
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// newEncryptedServer starts a server requiring encryption with its own node
+// key
+func newEncryptedServer(t *testing.T, handler MessageHandler) (*Server, *NodeKey) {
+	t.Helper()
+
+	key, err := NewNodeKey()
+	if err != nil {
+		t.Fatalf("Failed to create node key: %v", err)
+	}
+	server := NewServer("127.0.0.1", 0, handler)
+	config := DefaultHandshakeConfig()
+	config.NodeKey = key
+	config.Encryption = EncryptionRequired
+	server.SetHandshakeConfig(config)
+	if err := server.Start(); err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+	t.Cleanup(func() { server.Stop() })
+	return server, key
+}
+
+func TestEncryptedTransport(t *testing.T) {
+	received := make(chan *Message, 4)
+	serverA, keyA := newEncryptedServer(t, func(peer *Peer, msg *Message) {
+		if msg.Type == MessageTypeBlockchain {
+			received <- msg
+			peer.Send(NewPongMessage())
+		}
+	})
+	serverB, keyB := newEncryptedServer(t, func(peer *Peer, msg *Message) {})
+
+	// B dials A with its own configuration, as discovery does
+	pongs := make(chan *Message, 4)
+	client := NewClient(serverA.Addr(), func(peer *Peer, msg *Message) {
+		if msg.Type == MessageTypePong {
+			pongs <- msg
+		}
+	})
+	client.SetHandshakeConfig(serverB.GetHandshakeConfig())
+	if err := client.Connect(); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer client.Close()
+
+	// Larger than a frame, so it is split and reassembled
+	payload := bytes.Repeat([]byte("mxm"), 3*MaxFrameSize)
+	if err := client.Send(NewMessage(MessageTypeBlockchain, payload)); err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+
+	select {
+	case msg := <-received:
+		if !bytes.Equal(msg.Payload, payload) {
+			t.Error("Expected payload to arrive intact")
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("Timeout waiting for message over encrypted transport")
+	}
+	select {
+	case <-pongs:
+	case <-time.After(3 * time.Second):
+		t.Fatal("Timeout waiting for reply over encrypted transport")
+	}
+
+	if !client.Peer().Encrypted() {
+		t.Error("Expected client connection to be encrypted")
+	}
+	if client.Peer().NodeID() != keyA.ID() {
+		t.Errorf("Expected server node ID %s, got %s", keyA.ID(), client.Peer().NodeID())
+	}
+	peers := serverA.GetPeers()
+	if len(peers) != 1 {
+		t.Fatalf("Expected 1 peer, got %d", len(peers))
+	}
+	if !peers[0].Encrypted {
+		t.Error("Expected server connection to be encrypted")
+	}
+	if peers[0].NodeID != keyB.ID() {
+		t.Errorf("Expected client node ID %s, got %s", keyB.ID(), peers[0].NodeID)
+	}
+}
+
+func TestEncryptionRequired(t *testing.T) {
+	received := make(chan *Message, 4)
+	server, _ := newEncryptedServer(t, func(peer *Peer, msg *Message) {
+		received <- msg
+	})
+
+	plaintextConfig := DefaultHandshakeConfig()
+	plaintextConfig.Encryption = EncryptionDisabled
+	plaintext := NewClient(server.Addr(), func(peer *Peer, msg *Message) {})
+	plaintext.SetHandshakeConfig(plaintextConfig)
+	if err := plaintext.Connect(); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer plaintext.Close()
+	plaintext.Send(NewPingMessage())
+
+	deadline := time.Now().Add(3 * time.Second)
+	for plaintext.IsConnected() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if plaintext.IsConnected() {
+		t.Error("Expected plaintext peer to be disconnected")
+	}
+
+	// Keys agreed on another network do not match
+	testnet := NewClient(server.Addr(), func(peer *Peer, msg *Message) {})
+	config := DefaultHandshakeConfig()
+	config.Magic = MagicTestnet
+	testnet.SetHandshakeConfig(config)
+	if err := testnet.Connect(); err == nil {
+		testnet.Close()
+		t.Error("Expected encrypted connection from another network to fail")
+	}
+
+	select {
+	case msg := <-received:
+		t.Errorf("Expected no message to reach the handler, got %s", msg.Type)
+	default:
+	}
+
+	// Servers that only enable encryption still accept plaintext peers
+	optional := NewServer("127.0.0.1", 0, func(peer *Peer, msg *Message) {})
+	if err := optional.Start(); err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+	defer optional.Stop()
+
+	client := NewClient(optional.Addr(), func(peer *Peer, msg *Message) {})
+	plain := NewClient(optional.Addr(), func(peer *Peer, msg *Message) {})
+	plain.SetHandshakeConfig(plaintextConfig)
+	for _, c := range []*Client{client, plain} {
+		if err := c.Connect(); err != nil {
+			t.Fatalf("Failed to connect: %v", err)
+		}
+		defer c.Close()
+	}
+
+	deadline = time.Now().Add(3 * time.Second)
+	for optional.GetPeerCount() < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if optional.GetPeerCount() != 2 {
+		t.Fatalf("Expected 2 peers, got %d", optional.GetPeerCount())
+	}
+	if !client.Peer().Encrypted() || plain.Peer().Encrypted() {
+		t.Error("Expected only the encrypting client to be encrypted")
+	}
+}
+
+func TestSecureConnRejectsTampering(t *testing.T) {
+	keyA, err := NewNodeKey()
+	if err != nil {
+		t.Fatalf("Failed to create node key: %v", err)
+	}
+	keyB, err := NewNodeKey()
+	if err != nil {
+		t.Fatalf("Failed to create node key: %v", err)
+	}
+
+	initiatorConn, responderConn := net.Pipe()
+	defer initiatorConn.Close()
+	defer responderConn.Close()
+
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	accepted := make(chan result, 1)
+	go func() {
+		config := DefaultHandshakeConfig()
+		config.NodeKey = keyB
+		conn, err := acceptTransport(responderConn, config)
+		accepted <- result{conn, err}
+	}()
+
+	config := DefaultHandshakeConfig()
+	config.NodeKey = keyA
+	initiator, err := secureOutbound(initiatorConn, config)
+	if err != nil {
+		t.Fatalf("Failed to encrypt connection: %v", err)
+	}
+	res := <-accepted
+	if res.err != nil {
+		t.Fatalf("Failed to accept connection: %v", res.err)
+	}
+	responder, ok := res.conn.(*secureConn)
+	if !ok {
+		t.Fatalf("Expected encrypted connection, got %T", res.conn)
+	}
+	if initiator.remoteID != keyB.ID() || responder.remoteID != keyA.ID() {
+		t.Error("Expected each side to learn the other's node ID")
+	}
+
+	go initiator.Write([]byte("hello"))
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(responder, buf); err != nil {
+		t.Fatalf("Failed to read: %v", err)
+	}
+	if string(buf) != "hello" {
+		t.Errorf("Expected hello, got %q", buf)
+	}
+
+	// A frame not sealed with the session key is rejected
+	go writeFrame(initiatorConn, bytes.Repeat([]byte{0x42}, 32))
+	if _, err := responder.Read(buf); err == nil {
+		t.Error("Expected error for tampered frame")
+	}
+}
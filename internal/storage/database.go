@@ -3,6 +3,7 @@ package storage
 import (
 	"database/sql"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
@@ -10,6 +11,7 @@ import (
 	_ "github.com/mattn/go-sqlite3"
 
 	"github.com/aliexe/blockChain/internal/blockchain"
+	"github.com/aliexe/blockChain/internal/transactions"
 )
 
 const (
@@ -78,9 +80,12 @@ func (ds *DatabaseStorage) initSchema() error {
 			"index" INTEGER UNIQUE NOT NULL,
 			timestamp INTEGER NOT NULL,
 			data BLOB NOT NULL,
+			transactions BLOB,
+			merkle_root BLOB,
 			prev_hash BLOB NOT NULL,
 			hash BLOB UNIQUE NOT NULL,
 			nonce INTEGER NOT NULL,
+			bits INTEGER NOT NULL,
 			difficulty INTEGER NOT NULL
 		);
 		CREATE INDEX IF NOT EXISTS idx_blocks_index ON blocks("index");
@@ -97,7 +102,7 @@ func (ds *DatabaseStorage) initSchema() error {
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
 			miner_id TEXT NOT NULL,
 			block_index INTEGER NOT NULL,
-			reward REAL NOT NULL,
+			reward INTEGER NOT NULL,
 			timestamp INTEGER NOT NULL,
 			difficulty INTEGER NOT NULL,
 			FOREIGN KEY (block_index) REFERENCES blocks("index") ON DELETE CASCADE
@@ -122,7 +127,7 @@ func (ds *DatabaseStorage) initSchema() error {
 
 	// Set schema version
 	_, err = ds.db.Exec(`
-		INSERT OR IGNORE INTO metadata (key, value) VALUES ('schema_version', '1')
+		INSERT OR IGNORE INTO metadata (key, value) VALUES ('schema_version', '5')
 	`)
 	if err != nil {
 		return fmt.Errorf("failed to set schema version: %w", err)
@@ -159,21 +164,26 @@ func (ds *DatabaseStorage) SaveBlockchain(bc *blockchain.Blockchain) error {
 
 	// Insert blocks
 	for i, block := range bc.Blocks {
-		_, err := tx.Exec(`
-			INSERT INTO blocks ("index", timestamp, data, prev_hash, hash, nonce, difficulty)
-			VALUES (?, ?, ?, ?, ?, ?, ?)
-		`, i, block.Timestamp, block.Data, block.PrevHash, block.Hash, block.Nonce, block.Difficulty)
+		txData, err := encodeBlockTransactions(block.Transactions)
+		if err != nil {
+			return fmt.Errorf("failed to encode transactions of block %d: %w", i, err)
+		}
+
+		_, err = tx.Exec(`
+			INSERT INTO blocks ("index", timestamp, data, transactions, merkle_root, prev_hash, hash, nonce, bits, difficulty)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, i, block.Timestamp, block.Data, txData, block.MerkleRoot, block.PrevHash, block.Hash, block.Nonce, block.Bits, block.Difficulty)
 		if err != nil {
 			return fmt.Errorf("failed to insert block %d: %w", i, err)
 		}
 	}
 
-	// Insert mining rewards
-	for _, reward := range bc.MiningRewards {
+	// Index coinbase rewards for reward queries
+	for _, reward := range bc.GetMiningRewards() {
 		_, err := tx.Exec(`
 			INSERT INTO mining_rewards (miner_id, block_index, reward, timestamp, difficulty)
 			VALUES (?, ?, ?, ?, ?)
-		`, reward.MinerID, reward.BlockIndex, reward.Reward, reward.Timestamp.Unix(), reward.Difficulty)
+		`, reward.MinerID, reward.BlockIndex, int64(reward.Reward), reward.Timestamp.Unix(), reward.Difficulty)
 		if err != nil {
 			return fmt.Errorf("failed to insert mining reward: %w", err)
 		}
@@ -192,7 +202,7 @@ func (ds *DatabaseStorage) LoadBlockchain() (*blockchain.Blockchain, error) {
 
 	// Load blocks
 	rows, err := ds.db.Query(`
-		SELECT "index", timestamp, data, prev_hash, hash, nonce, difficulty
+		SELECT "index", timestamp, data, transactions, merkle_root, prev_hash, hash, nonce, bits, difficulty
 		FROM blocks
 		ORDER BY "index" ASC
 	`)
@@ -205,23 +215,9 @@ func (ds *DatabaseStorage) LoadBlockchain() (*blockchain.Blockchain, error) {
 	bc.Blocks = []*blockchain.Block{} // Clear genesis block
 
 	for rows.Next() {
-		var index int
-		var timestamp int64
-		var data, prevHash, hash []byte
-		var nonce uint32
-		var difficulty int
-
-		if err := rows.Scan(&index, &timestamp, &data, &prevHash, &hash, &nonce, &difficulty); err != nil {
-			return nil, fmt.Errorf("failed to scan block: %w", err)
-		}
-
-		block := &blockchain.Block{
-			Timestamp:  timestamp,
-			Data:       data,
-			PrevHash:   prevHash,
-			Hash:       hash,
-			Nonce:      nonce,
-			Difficulty: difficulty,
+		block, err := scanBlock(rows)
+		if err != nil {
+			return nil, err
 		}
 
 		bc.Blocks = append(bc.Blocks, block)
@@ -231,47 +227,6 @@ func (ds *DatabaseStorage) LoadBlockchain() (*blockchain.Blockchain, error) {
 		return nil, fmt.Errorf("error iterating blocks: %w", err)
 	}
 
-	// Load mining rewards
-	rewardRows, err := ds.db.Query(`
-		SELECT miner_id, block_index, reward, timestamp, difficulty
-		FROM mining_rewards
-		ORDER BY id ASC
-	`)
-	if err != nil {
-		return nil, fmt.Errorf("failed to query mining rewards: %w", err)
-	}
-	defer rewardRows.Close()
-
-	bc.MiningRewards = []*blockchain.MiningReward{}
-	bc.TotalRewards = 0
-
-	for rewardRows.Next() {
-		var minerID string
-		var blockIndex int
-		var reward float64
-		var timestamp int64
-		var difficulty int
-
-		if err := rewardRows.Scan(&minerID, &blockIndex, &reward, &timestamp, &difficulty); err != nil {
-			return nil, fmt.Errorf("failed to scan mining reward: %w", err)
-		}
-
-		miningReward := &blockchain.MiningReward{
-			MinerID:    minerID,
-			BlockIndex: blockIndex,
-			Reward:     reward,
-			Timestamp:  time.Unix(timestamp, 0),
-			Difficulty: difficulty,
-		}
-
-		bc.MiningRewards = append(bc.MiningRewards, miningReward)
-		bc.TotalRewards += reward
-	}
-
-	if err := rewardRows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating mining rewards: %w", err)
-	}
-
 	// Validate loaded blockchain
 	if !bc.IsValid() {
 		return nil, fmt.Errorf("loaded blockchain is invalid")
@@ -284,65 +239,42 @@ func (ds *DatabaseStorage) GetBlockByIndex(index int) (*blockchain.Block, error)
 	ds.mu.RLock()
 	defer ds.mu.RUnlock()
 
-	var timestamp int64
-	var data, prevHash, hash []byte
-	var nonce uint32
-	var difficulty int
-
-	err := ds.db.QueryRow(`
-		SELECT timestamp, data, prev_hash, hash, nonce, difficulty
+	row := ds.db.QueryRow(`
+		SELECT "index", timestamp, data, transactions, merkle_root, prev_hash, hash, nonce, bits, difficulty
 		FROM blocks
 		WHERE "index" = ?
-	`, index).Scan(&timestamp, &data, &prevHash, &hash, &nonce, &difficulty)
+	`, index)
 
-	if err == sql.ErrNoRows {
+	block, err := scanBlock(row)
+	if errors.Is(err, sql.ErrNoRows) {
 		return nil, fmt.Errorf("block with index %d not found", index)
 	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to query block: %w", err)
 	}
 
-	return &blockchain.Block{
-		Timestamp:  timestamp,
-		Data:       data,
-		PrevHash:   prevHash,
-		Hash:       hash,
-		Nonce:      nonce,
-		Difficulty: difficulty,
-	}, nil
+	return block, nil
 }
 
 func (ds *DatabaseStorage) GetBlockByHash(hash []byte) (*blockchain.Block, error) {
 	ds.mu.RLock()
 	defer ds.mu.RUnlock()
 
-	var index int
-	var timestamp int64
-	var data, prevHash, blockHash []byte
-	var nonce uint32
-	var difficulty int
-
-	err := ds.db.QueryRow(`
-		SELECT "index", timestamp, data, prev_hash, hash, nonce, difficulty
+	row := ds.db.QueryRow(`
+		SELECT "index", timestamp, data, transactions, merkle_root, prev_hash, hash, nonce, bits, difficulty
 		FROM blocks
 		WHERE hash = ?
-	`, hash).Scan(&index, &timestamp, &data, &prevHash, &blockHash, &nonce, &difficulty)
+	`, hash)
 
-	if err == sql.ErrNoRows {
+	block, err := scanBlock(row)
+	if errors.Is(err, sql.ErrNoRows) {
 		return nil, fmt.Errorf("block with hash %s not found", hex.EncodeToString(hash))
 	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to query block: %w", err)
 	}
 
-	return &blockchain.Block{
-		Timestamp:  timestamp,
-		Data:       data,
-		PrevHash:   prevHash,
-		Hash:       blockHash,
-		Nonce:      nonce,
-		Difficulty: difficulty,
-	}, nil
+	return block, nil
 }
 
 func (ds *DatabaseStorage) GetBlocksByTimeRange(start, end time.Time) ([]*blockchain.Block, error) {
@@ -350,7 +282,7 @@ func (ds *DatabaseStorage) GetBlocksByTimeRange(start, end time.Time) ([]*blockc
 	defer ds.mu.RUnlock()
 
 	rows, err := ds.db.Query(`
-		SELECT "index", timestamp, data, prev_hash, hash, nonce, difficulty
+		SELECT "index", timestamp, data, transactions, merkle_root, prev_hash, hash, nonce, bits, difficulty
 		FROM blocks
 		WHERE timestamp BETWEEN ? AND ?
 		ORDER BY "index" ASC
@@ -362,29 +294,72 @@ func (ds *DatabaseStorage) GetBlocksByTimeRange(start, end time.Time) ([]*blockc
 
 	var blocks []*blockchain.Block
 	for rows.Next() {
-		var index int
-		var timestamp int64
-		var data, prevHash, hash []byte
-		var nonce uint32
-		var difficulty int
-
-		if err := rows.Scan(&index, &timestamp, &data, &prevHash, &hash, &nonce, &difficulty); err != nil {
-			return nil, fmt.Errorf("failed to scan block: %w", err)
+		block, err := scanBlock(rows)
+		if err != nil {
+			return nil, err
 		}
 
-		blocks = append(blocks, &blockchain.Block{
-			Timestamp:  timestamp,
-			Data:       data,
-			PrevHash:   prevHash,
-			Hash:       hash,
-			Nonce:      nonce,
-			Difficulty: difficulty,
-		})
+		blocks = append(blocks, block)
 	}
 
 	return blocks, nil
 }
 
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanBlock reads a block row selected as
+// "index", timestamp, data, transactions, merkle_root, prev_hash, hash, nonce, bits, difficulty
+func scanBlock(row rowScanner) (*blockchain.Block, error) {
+	var index int
+	var timestamp int64
+	var data, txData, merkleRoot, prevHash, hash []byte
+	var nonce, bits uint32
+	var difficulty int
+
+	if err := row.Scan(&index, &timestamp, &data, &txData, &merkleRoot, &prevHash, &hash, &nonce, &bits, &difficulty); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to scan block: %w", err)
+	}
+
+	txs, err := decodeBlockTransactions(txData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode transactions of block %d: %w", index, err)
+	}
+
+	return &blockchain.Block{
+		Timestamp:    timestamp,
+		Data:         data,
+		Transactions: txs,
+		MerkleRoot:   merkleRoot,
+		PrevHash:     prevHash,
+		Hash:         hash,
+		Nonce:        nonce,
+		Bits:         bits,
+		Difficulty:   difficulty,
+	}, nil
+}
+
+// encodeBlockTransactions serializes a block body for the transactions column
+func encodeBlockTransactions(txs []*transactions.Transaction) ([]byte, error) {
+	if len(txs) == 0 {
+		return nil, nil
+	}
+	return transactions.EncodeTransactions(txs), nil
+}
+
+// decodeBlockTransactions restores a block body from the transactions column
+func decodeBlockTransactions(data []byte) ([]*transactions.Transaction, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	return transactions.DecodeTransactions(data)
+}
+
 func (ds *DatabaseStorage) GetChainLength() (int, error) {
 	ds.mu.RLock()
 	defer ds.mu.RUnlock()
@@ -398,11 +373,11 @@ func (ds *DatabaseStorage) GetChainLength() (int, error) {
 	return count, nil
 }
 
-func (ds *DatabaseStorage) GetMinerRewards(minerID string) (float64, error) {
+func (ds *DatabaseStorage) GetMinerRewards(minerID string) (transactions.Amount, error) {
 	ds.mu.RLock()
 	defer ds.mu.RUnlock()
 
-	var total float64
+	var total transactions.Amount
 	err := ds.db.QueryRow(`
 		SELECT COALESCE(SUM(reward), 0)
 		FROM mining_rewards
@@ -427,7 +402,7 @@ func (ds *DatabaseStorage) GetMiningStats() (map[string]interface{}, error) {
 	}
 
 	// Get total rewards
-	var totalRewards float64
+	var totalRewards transactions.Amount
 	if err := ds.db.QueryRow("SELECT COALESCE(SUM(reward), 0) FROM mining_rewards").Scan(&totalRewards); err != nil {
 		return nil, fmt.Errorf("failed to sum rewards: %w", err)
 	}
@@ -443,12 +418,12 @@ func (ds *DatabaseStorage) GetMiningStats() (map[string]interface{}, error) {
 	}
 	defer rows.Close()
 
-	minerRewards := make(map[string]float64)
+	minerRewards := make(map[string]transactions.Amount)
 	minerBlocks := make(map[string]int)
 
 	for rows.Next() {
 		var minerID string
-		var reward float64
+		var reward transactions.Amount
 		var blockCount int
 
 		if err := rows.Scan(&minerID, &reward, &blockCount); err != nil {
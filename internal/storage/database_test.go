@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/aliexe/blockChain/internal/blockchain"
+	"github.com/aliexe/blockChain/internal/transactions"
 )
 
 func TestDatabaseNew(t *testing.T) {
@@ -27,8 +28,8 @@ func TestDatabaseNew(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Failed to get schema version: %v", err)
 	}
-	if version != "1" {
-		t.Errorf("Expected schema version 1, got %s", version)
+	if version != "5" {
+		t.Errorf("Expected schema version 5, got %s", version)
 	}
 }
 
@@ -82,7 +83,7 @@ func TestDatabaseSaveWithMining(t *testing.T) {
 
 	// Create blockchain with mined blocks
 	bc := blockchain.NewBlockchain()
-	_, err = bc.AddBlockWithMining("Mined block 1", "miner1", 2)
+	_, err = bc.AddBlockWithMining("Mined block 1", "mxm1qzyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg344kydn", 2)
 	if err != nil {
 		t.Fatalf("Failed to add mined block: %v", err)
 	}
@@ -100,13 +101,13 @@ func TestDatabaseSaveWithMining(t *testing.T) {
 
 	// Verify mining rewards
 	stats := loadedBC.GetMiningStats()
-	totalRewards := stats["total_rewards"].(float64)
+	totalRewards := stats["total_rewards"].(transactions.Amount)
 	if totalRewards == 0 {
 		t.Error("Mining rewards were not preserved")
 	}
 
 	// Verify miner rewards
-	minerRewards, err := ds.GetMinerRewards("miner1")
+	minerRewards, err := ds.GetMinerRewards("mxm1qzyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg344kydn")
 	if err != nil {
 		t.Fatalf("Failed to get miner rewards: %v", err)
 	}
@@ -278,15 +279,15 @@ func TestDatabaseGetMinerRewards(t *testing.T) {
 
 	// Create blockchain with mining rewards
 	bc := blockchain.NewBlockchain()
-	bc.AddBlockWithMining("Block 1", "miner1", 2)
-	bc.AddBlockWithMining("Block 2", "miner2", 2)
-	bc.AddBlockWithMining("Block 3", "miner1", 3)
+	bc.AddBlockWithMining("Block 1", "mxm1qzyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg344kydn", 2)
+	bc.AddBlockWithMining("Block 2", "mxm1qyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg3z6gnz9y", 2)
+	bc.AddBlockWithMining("Block 3", "mxm1qzyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg344kydn", 3)
 	if err := ds.SaveBlockchain(bc); err != nil {
 		t.Fatalf("Failed to save blockchain: %v", err)
 	}
 
 	// Get rewards for miner1
-	rewards1, err := ds.GetMinerRewards("miner1")
+	rewards1, err := ds.GetMinerRewards("mxm1qzyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg344kydn")
 	if err != nil {
 		t.Fatalf("Failed to get miner1 rewards: %v", err)
 	}
@@ -295,7 +296,7 @@ func TestDatabaseGetMinerRewards(t *testing.T) {
 	}
 
 	// Get rewards for miner2
-	rewards2, err := ds.GetMinerRewards("miner2")
+	rewards2, err := ds.GetMinerRewards("mxm1qyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg3z6gnz9y")
 	if err != nil {
 		t.Fatalf("Failed to get miner2 rewards: %v", err)
 	}
@@ -304,7 +305,7 @@ func TestDatabaseGetMinerRewards(t *testing.T) {
 	}
 
 	// Get rewards for non-existent miner
-	rewards3, err := ds.GetMinerRewards("miner3")
+	rewards3, err := ds.GetMinerRewards("mxm1qxvenxvenxvenxvenxvenxvenxvenxvengkylsk")
 	if err != nil {
 		t.Fatalf("Failed to get miner3 rewards: %v", err)
 	}
@@ -323,9 +324,9 @@ func TestDatabaseGetMiningStats(t *testing.T) {
 
 	// Create blockchain with mining rewards
 	bc := blockchain.NewBlockchain()
-	bc.AddBlockWithMining("Block 1", "miner1", 2)
-	bc.AddBlockWithMining("Block 2", "miner2", 2)
-	bc.AddBlockWithMining("Block 3", "miner1", 3)
+	bc.AddBlockWithMining("Block 1", "mxm1qzyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg344kydn", 2)
+	bc.AddBlockWithMining("Block 2", "mxm1qyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg3z6gnz9y", 2)
+	bc.AddBlockWithMining("Block 3", "mxm1qzyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg344kydn", 3)
 	if err := ds.SaveBlockchain(bc); err != nil {
 		t.Fatalf("Failed to save blockchain: %v", err)
 	}
@@ -341,22 +342,22 @@ func TestDatabaseGetMiningStats(t *testing.T) {
 		t.Errorf("Expected 4 blocks, got %d", totalBlocks)
 	}
 
-	totalRewards := stats["total_rewards"].(float64)
+	totalRewards := stats["total_rewards"].(transactions.Amount)
 	if totalRewards == 0 {
 		t.Error("Expected non-zero total rewards")
 	}
 
-	minerRewards := stats["miner_rewards"].(map[string]float64)
-	if _, ok := minerRewards["miner1"]; !ok {
+	minerRewards := stats["miner_rewards"].(map[string]transactions.Amount)
+	if _, ok := minerRewards["mxm1qzyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg344kydn"]; !ok {
 		t.Error("Expected miner1 in rewards")
 	}
-	if _, ok := minerRewards["miner2"]; !ok {
+	if _, ok := minerRewards["mxm1qyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg3z6gnz9y"]; !ok {
 		t.Error("Expected miner2 in rewards")
 	}
 
 	minerBlocks := stats["miner_blocks"].(map[string]int)
-	if minerBlocks["miner1"] != 2 {
-		t.Errorf("Expected 2 blocks for miner1, got %d", minerBlocks["miner1"])
+	if minerBlocks["mxm1qzyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg344kydn"] != 2 {
+		t.Errorf("Expected 2 blocks for miner1, got %d", minerBlocks["mxm1qzyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg344kydn"])
 	}
 }
 
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/aliexe/blockChain/internal/blockchain"
+	"github.com/aliexe/blockChain/internal/transactions"
 )
 
 func TestNewFileStorage(t *testing.T) {
@@ -88,7 +89,7 @@ func TestSaveBlockchainWithMining(t *testing.T) {
 
 	// Create blockchain with mined blocks
 	bc := blockchain.NewBlockchain()
-	_, err = bc.AddBlockWithMining("Mined block 1", "miner1", 2)
+	_, err = bc.AddBlockWithMining("Mined block 1", "mxm1qzyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg344kydn", 2)
 	if err != nil {
 		t.Fatalf("Failed to add mined block: %v", err)
 	}
@@ -106,7 +107,7 @@ func TestSaveBlockchainWithMining(t *testing.T) {
 
 	// Verify mining rewards
 	stats := loadedBC.GetMiningStats()
-	totalRewards := stats["total_rewards"].(float64)
+	totalRewards := stats["total_rewards"].(transactions.Amount)
 	if totalRewards == 0 {
 		t.Error("Mining rewards were not preserved")
 	}
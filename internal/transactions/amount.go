@@ -0,0 +1,150 @@
+package transactions
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+// Amount is a quantity of coins expressed in indivisible base units
+type Amount uint64
+
+const (
+	// AmountDecimals is the number of decimal places of one coin
+	AmountDecimals = 8
+	// Coin is the number of base units in one coin
+	Coin = 100_000_000
+	// MaxMoney is the total money supply cap; no amount may exceed it
+	MaxMoney Amount = 21_000_000 * Coin
+)
+
+// Add returns a+b, failing on overflow or when the result exceeds MaxMoney
+func (a Amount) Add(b Amount) (Amount, error) {
+	sum, carry := bits.Add64(uint64(a), uint64(b), 0)
+	if carry != 0 || Amount(sum) > MaxMoney {
+		return 0, fmt.Errorf("amount overflow: %s + %s exceeds maximum %s", a, b, MaxMoney)
+	}
+	return Amount(sum), nil
+}
+
+// Sub returns a-b, failing when b is larger than a
+func (a Amount) Sub(b Amount) (Amount, error) {
+	if b > a {
+		return 0, fmt.Errorf("amount underflow: %s - %s is negative", a, b)
+	}
+	return a - b, nil
+}
+
+// MulInt returns a*n, failing on overflow or when the result exceeds MaxMoney
+func (a Amount) MulInt(n uint64) (Amount, error) {
+	hi, lo := bits.Mul64(uint64(a), n)
+	if hi != 0 || Amount(lo) > MaxMoney {
+		return 0, fmt.Errorf("amount overflow: %s * %d exceeds maximum %s", a, n, MaxMoney)
+	}
+	return Amount(lo), nil
+}
+
+// IsValid reports whether the amount is within the money supply
+func (a Amount) IsValid() bool {
+	return a <= MaxMoney
+}
+
+// SumAmounts adds amounts with overflow checking
+func SumAmounts(amounts ...Amount) (Amount, error) {
+	var total Amount
+	for _, amount := range amounts {
+		var err error
+		if total, err = total.Add(amount); err != nil {
+			return 0, err
+		}
+	}
+	return total, nil
+}
+
+// ToCoins converts the amount to a floating point number of coins for display
+func (a Amount) ToCoins() float64 {
+	return float64(a) / float64(Coin)
+}
+
+// String formats the amount in coins with all decimal places, e.g. "1.50000000"
+func (a Amount) String() string {
+	return fmt.Sprintf("%d.%0*d", a/Coin, AmountDecimals, a%Coin)
+}
+
+// AmountFromCoins converts a floating point number of coins to an Amount,
+// rounding to the nearest base unit
+func AmountFromCoins(coins float64) (Amount, error) {
+	if math.IsNaN(coins) || math.IsInf(coins, 0) || coins < 0 {
+		return 0, fmt.Errorf("invalid coin amount: %v", coins)
+	}
+	units := math.Round(coins * float64(Coin))
+	if units > float64(MaxMoney) {
+		return 0, fmt.Errorf("amount %v exceeds maximum %s", coins, MaxMoney)
+	}
+	return Amount(units), nil
+}
+
+// ParseAmount parses a decimal coin amount such as "12.5" or "0.00000001"
+// without going through floating point
+func ParseAmount(s string) (Amount, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, fmt.Errorf("amount cannot be empty")
+	}
+
+	whole, frac, hasFrac := strings.Cut(s, ".")
+	if whole == "" && (!hasFrac || frac == "") {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	if len(frac) > AmountDecimals {
+		return 0, fmt.Errorf("amount %q has more than %d decimal places", s, AmountDecimals)
+	}
+
+	var coins uint64
+	if whole != "" {
+		var err error
+		if coins, err = strconv.ParseUint(whole, 10, 64); err != nil {
+			return 0, fmt.Errorf("invalid amount %q: %w", s, err)
+		}
+	}
+
+	var units uint64
+	if frac != "" {
+		var err error
+		if units, err = strconv.ParseUint(frac+strings.Repeat("0", AmountDecimals-len(frac)), 10, 64); err != nil {
+			return 0, fmt.Errorf("invalid amount %q: %w", s, err)
+		}
+	}
+
+	total, err := Amount(coins).MulInt(uint64(Coin))
+	if err != nil {
+		return 0, err
+	}
+	return total.Add(Amount(units))
+}
+
+// UnmarshalJSON accepts either a number of base units or a quoted decimal coin string
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		parsed, err := ParseAmount(s)
+		if err != nil {
+			return err
+		}
+		*a = parsed
+		return nil
+	}
+
+	units, err := strconv.ParseUint(string(data), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid amount %s: %w", data, err)
+	}
+	*a = Amount(units)
+	return nil
+}
@@ -0,0 +1,115 @@
+package transactions
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAmountString(t *testing.T) {
+	assert.Equal(t, "0.00000000", Amount(0).String())
+	assert.Equal(t, "0.00000001", Amount(1).String())
+	assert.Equal(t, "1.50000000", Amount(1.5*Coin).String())
+	assert.Equal(t, "21000000.00000000", MaxMoney.String())
+}
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    Amount
+		wantErr bool
+	}{
+		{"1", Coin, false},
+		{"1.5", 1.5 * Coin, false},
+		{"0.00000001", 1, false},
+		{".25", 0.25 * Coin, false},
+		{" 12.5 ", 12.5 * Coin, false},
+		{"21000000", MaxMoney, false},
+		{"21000000.00000001", 0, true},
+		{"0.000000001", 0, true},
+		{"-1", 0, true},
+		{"1e8", 0, true},
+		{"", 0, true},
+		{".", 0, true},
+		{"1.2.3", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseAmount(tt.input)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestAmountArithmetic(t *testing.T) {
+	sum, err := Amount(Coin).Add(Coin / 2)
+	require.NoError(t, err)
+	assert.Equal(t, Amount(1.5*Coin), sum)
+
+	_, err = MaxMoney.Add(1)
+	assert.Error(t, err)
+
+	_, err = Amount(1).Sub(2)
+	assert.Error(t, err)
+
+	product, err := Amount(Coin).MulInt(3)
+	require.NoError(t, err)
+	assert.Equal(t, Amount(3*Coin), product)
+
+	_, err = MaxMoney.MulInt(2)
+	assert.Error(t, err)
+
+	_, err = SumAmounts(MaxMoney, MaxMoney)
+	assert.Error(t, err)
+}
+
+func TestAmountFromCoins(t *testing.T) {
+	amount, err := AmountFromCoins(0.1 + 0.2)
+	require.NoError(t, err)
+	assert.Equal(t, Amount(0.3*Coin), amount)
+
+	_, err = AmountFromCoins(-1)
+	assert.Error(t, err)
+
+	_, err = AmountFromCoins(22_000_000)
+	assert.Error(t, err)
+}
+
+func TestAmountJSON(t *testing.T) {
+	output := TxOutput{Address: "mxm1qzyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg344kydn", Amount: 1.5 * Coin}
+	data, err := json.Marshal(output)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"amount":150000000`)
+
+	var decoded TxOutput
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, output.Amount, decoded.Amount)
+
+	require.NoError(t, json.Unmarshal([]byte(`{"amount":"0.25"}`), &decoded))
+	assert.Equal(t, Amount(0.25*Coin), decoded.Amount)
+
+	assert.Error(t, json.Unmarshal([]byte(`{"amount":1.5}`), &decoded))
+	assert.Error(t, json.Unmarshal([]byte(`{"amount":-1}`), &decoded))
+}
+
+func TestValidateBasicRejectsOutputOverflow(t *testing.T) {
+	tx := NewTransaction(
+		[]TxInput{{TxID: "prev", Index: 0}},
+		[]TxOutput{
+			{Address: "mxm1qzyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg344kydn", Amount: MaxMoney},
+			{Address: "mxm1qyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg3z6gnz9y", Amount: MaxMoney},
+		},
+	)
+
+	err := tx.ValidateBasic()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "overflow")
+}
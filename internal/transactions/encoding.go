@@ -0,0 +1,219 @@
+package transactions
+
+import (
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/aliexe/blockChain/internal/encoding"
+)
+
+// TxEncodingVersion is the version of the binary transaction encoding.
+// Version 2 added input unlocking scripts, version 3 lock times and input
+// sequence numbers.
+const TxEncodingVersion uint8 = 3
+
+// Minimum encoded sizes, used to bound counts before allocating
+const (
+	minInputSize       = 9 // Empty tx ID, index, sequence, signature, public key and script
+	minOutputSize      = 9 // Empty address and amount
+	minTransactionSize = 1 // Length prefix of an empty transaction
+)
+
+// MarshalBinary encodes the transaction, including its ID and signatures.
+// Output TxID and Index are not encoded; they are restored from the
+// transaction ID and output position when decoding.
+func (tx *Transaction) MarshalBinary() ([]byte, error) {
+	w := encoding.NewWriter()
+	w.WriteUint8(TxEncodingVersion)
+	w.WriteString(tx.ID)
+	tx.encodeBody(w, true)
+	return w.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a transaction produced by MarshalBinary
+func (tx *Transaction) UnmarshalBinary(data []byte) error {
+	r := encoding.NewReader(data)
+	r.ReadVersion(TxEncodingVersion)
+	decoded := &Transaction{ID: r.ReadString()}
+	decoded.decodeBody(r)
+	if err := r.Finish(); err != nil {
+		return fmt.Errorf("failed to decode transaction: %w", err)
+	}
+	*tx = *decoded
+	return nil
+}
+
+// encodeBody writes the transaction fields that follow the ID. Signatures,
+// public keys and unlocking scripts are only written when withWitness is set.
+func (tx *Transaction) encodeBody(w *encoding.Writer, withWitness bool) {
+	w.WriteInt64(tx.Timestamp)
+	w.WriteVarint(int64(tx.Height))
+	w.WriteUint32(tx.LockTime)
+
+	w.WriteUvarint(uint64(len(tx.Inputs)))
+	for _, input := range tx.Inputs {
+		input.encode(w, withWitness)
+	}
+
+	w.WriteUvarint(uint64(len(tx.Outputs)))
+	for _, output := range tx.Outputs {
+		output.encode(w)
+	}
+}
+
+// decodeBody reads the fields written by encodeBody with witness data
+func (tx *Transaction) decodeBody(r *encoding.Reader) {
+	tx.Timestamp = r.ReadInt64()
+	tx.Height = int(r.ReadVarint())
+	tx.LockTime = r.ReadUint32()
+
+	tx.Inputs = make([]TxInput, r.ReadCount(minInputSize))
+	for i := range tx.Inputs {
+		tx.Inputs[i].decode(r)
+	}
+
+	tx.Outputs = make([]TxOutput, r.ReadCount(minOutputSize))
+	for i := range tx.Outputs {
+		tx.Outputs[i].decode(r)
+		tx.Outputs[i].TxID = tx.ID
+		tx.Outputs[i].Index = i
+	}
+}
+
+// idPreimage returns the data hashed into the transaction ID. It excludes the
+// ID itself and all signatures, so signing does not change the ID.
+func (tx *Transaction) idPreimage() []byte {
+	w := encoding.NewWriter()
+	w.WriteUint8(TxEncodingVersion)
+	tx.encodeBody(w, false)
+	return w.Bytes()
+}
+
+// doubleSHA256 hashes data twice with SHA-256
+func doubleSHA256(data []byte) []byte {
+	first := sha256.Sum256(data)
+	second := sha256.Sum256(first[:])
+	return second[:]
+}
+
+// MarshalBinary encodes the input, including its signature, public key and
+// unlocking script
+func (in TxInput) MarshalBinary() ([]byte, error) {
+	w := encoding.NewWriter()
+	w.WriteUint8(TxEncodingVersion)
+	in.encode(w, true)
+	return w.Bytes(), nil
+}
+
+// UnmarshalBinary decodes an input produced by MarshalBinary
+func (in *TxInput) UnmarshalBinary(data []byte) error {
+	r := encoding.NewReader(data)
+	r.ReadVersion(TxEncodingVersion)
+	var decoded TxInput
+	decoded.decode(r)
+	if err := r.Finish(); err != nil {
+		return fmt.Errorf("failed to decode input: %w", err)
+	}
+	*in = decoded
+	return nil
+}
+
+func (in TxInput) encode(w *encoding.Writer, withWitness bool) {
+	w.WriteString(in.TxID)
+	w.WriteVarint(int64(in.Index))
+	w.WriteUint32(in.Sequence)
+	if withWitness {
+		w.WriteString(in.Signature)
+		w.WriteString(in.PublicKey)
+		w.WriteString(in.Script)
+	}
+}
+
+func (in *TxInput) decode(r *encoding.Reader) {
+	in.TxID = r.ReadString()
+	in.Index = int(r.ReadVarint())
+	in.Sequence = r.ReadUint32()
+	in.Signature = r.ReadString()
+	in.PublicKey = r.ReadString()
+	in.Script = r.ReadString()
+}
+
+// MarshalBinary encodes the output's address and amount
+func (out TxOutput) MarshalBinary() ([]byte, error) {
+	w := encoding.NewWriter()
+	w.WriteUint8(TxEncodingVersion)
+	out.encode(w)
+	return w.Bytes(), nil
+}
+
+// UnmarshalBinary decodes an output produced by MarshalBinary
+func (out *TxOutput) UnmarshalBinary(data []byte) error {
+	r := encoding.NewReader(data)
+	r.ReadVersion(TxEncodingVersion)
+	var decoded TxOutput
+	decoded.decode(r)
+	if err := r.Finish(); err != nil {
+		return fmt.Errorf("failed to decode output: %w", err)
+	}
+	*out = decoded
+	return nil
+}
+
+func (out TxOutput) encode(w *encoding.Writer) {
+	w.WriteString(out.Address)
+	w.WriteUint64(uint64(out.Amount))
+}
+
+func (out *TxOutput) decode(r *encoding.Reader) {
+	out.Address = r.ReadString()
+	out.Amount = Amount(r.ReadUint64())
+}
+
+// EncodeTransactions encodes a list of transactions
+func EncodeTransactions(txs []*Transaction) []byte {
+	w := encoding.NewWriter()
+	WriteTransactions(w, txs)
+	return w.Bytes()
+}
+
+// DecodeTransactions decodes a list produced by EncodeTransactions
+func DecodeTransactions(data []byte) ([]*Transaction, error) {
+	r := encoding.NewReader(data)
+	txs := ReadTransactions(r)
+	if err := r.Finish(); err != nil {
+		return nil, fmt.Errorf("failed to decode transactions: %w", err)
+	}
+	return txs, nil
+}
+
+// WriteTransactions writes a count followed by each length-prefixed transaction
+func WriteTransactions(w *encoding.Writer, txs []*Transaction) {
+	w.WriteUvarint(uint64(len(txs)))
+	for _, tx := range txs {
+		data, _ := tx.MarshalBinary()
+		w.WriteBytes(data)
+	}
+}
+
+// ReadTransactions reads a list written by WriteTransactions
+func ReadTransactions(r *encoding.Reader) []*Transaction {
+	count := r.ReadCount(minTransactionSize)
+	if r.Err() != nil {
+		return nil
+	}
+
+	txs := make([]*Transaction, 0, count)
+	for i := 0; i < count; i++ {
+		data := r.ReadBytes()
+		if r.Err() != nil {
+			return nil
+		}
+		tx := &Transaction{}
+		if err := tx.UnmarshalBinary(data); err != nil {
+			r.Fail(fmt.Errorf("transaction %d: %w", i, err))
+			return nil
+		}
+		txs = append(txs, tx)
+	}
+	return txs
+}
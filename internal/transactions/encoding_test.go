@@ -0,0 +1,66 @@
+package transactions
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransactionBinaryRoundTrip(t *testing.T) {
+	tx := NewTransaction(
+		[]TxInput{{TxID: "prev", Index: 1, Signature: "sig", PublicKey: "pub"}},
+		[]TxOutput{
+			{Address: "mxm1qzyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg344kydn", Amount: 2 * Coin},
+			{Address: "mxm1qyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg3z6gnz9y", Amount: 1},
+		},
+	)
+
+	data, err := tx.MarshalBinary()
+	require.NoError(t, err)
+
+	var decoded Transaction
+	require.NoError(t, decoded.UnmarshalBinary(data))
+	assert.Equal(t, tx.ID, decoded.ID)
+	assert.Equal(t, tx.Inputs, decoded.Inputs)
+	require.Len(t, decoded.Outputs, 2)
+	for i, output := range decoded.Outputs {
+		assert.Equal(t, tx.Outputs[i].Address, output.Address)
+		assert.Equal(t, tx.Outputs[i].Amount, output.Amount)
+		assert.Equal(t, tx.ID, output.TxID)
+		assert.Equal(t, i, output.Index)
+	}
+	assert.Equal(t, tx.Hash(), decoded.Hash())
+
+	assert.Error(t, decoded.UnmarshalBinary(data[:len(data)-1]))
+	assert.Error(t, decoded.UnmarshalBinary(append(data, 0)))
+
+	data[0] = TxEncodingVersion + 1
+	assert.Error(t, decoded.UnmarshalBinary(data))
+}
+
+func TestTransactionIDExcludesSignatures(t *testing.T) {
+	tx := NewTransaction(
+		[]TxInput{{TxID: "prev", Index: 0}},
+		[]TxOutput{{Address: "mxm1qzyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg344kydn", Amount: Coin}},
+	)
+	id := tx.ID
+	hash := tx.Hash()
+
+	tx.Inputs[0].Signature = "signature"
+	tx.Inputs[0].PublicKey = "key"
+	assert.Equal(t, id, tx.CalculateID())
+	assert.NotEqual(t, hash, tx.Hash())
+
+	tx.Outputs[0].Amount = 2 * Coin
+	assert.NotEqual(t, id, tx.CalculateID())
+}
+
+func TestDecodeTransactionsRejectsOversizedCount(t *testing.T) {
+	_, err := DecodeTransactions([]byte{0xff, 0xff, 0xff, 0xff, 0x0f})
+	assert.Error(t, err)
+
+	txs, err := DecodeTransactions(EncodeTransactions(nil))
+	require.NoError(t, err)
+	assert.Empty(t, txs)
+}
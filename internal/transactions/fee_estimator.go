@@ -0,0 +1,337 @@
+package transactions
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	// MaxConfirmationTarget is the largest number of blocks a fee estimate
+	// can target
+	MaxConfirmationTarget = 25
+	// DefaultFeeEstimatorWindow is the number of recent blocks whose
+	// confirmations are used for estimates
+	DefaultFeeEstimatorWindow = 200
+
+	// Fee rate buckets grow geometrically from the default minimum relay fee
+	// rate, in base units per byte
+	feeBucketMin     = 1000.0
+	feeBucketMax     = 10000000.0
+	feeBucketSpacing = 1.1
+
+	// A bucket passes for a target if this share of its transactions
+	// confirmed within the target, counting at least feeEstimateMinSamples
+	feeEstimateSuccess    = 0.85
+	feeEstimateMinSamples = 5
+
+	feeEstimatorVersion = 1
+)
+
+// ErrInsufficientFeeData is returned when too few transactions have been
+// observed to estimate a fee rate for a target
+var ErrInsufficientFeeData = errors.New("not enough fee history to estimate")
+
+// feeObservation is a transaction that confirmed, or left the mempool
+// unconfirmed, after waiting Blocks blocks
+type feeObservation struct {
+	FeeRate float64 `json:"fee_rate"`
+	Blocks  int     `json:"blocks"`
+}
+
+// blockFeeStats holds the observations made when a block was connected
+type blockFeeStats struct {
+	Height    int              `json:"height"`
+	Confirmed []feeObservation `json:"confirmed"`
+	Failed    []feeObservation `json:"failed,omitempty"`
+}
+
+// trackedFee is a mempool transaction waiting to confirm. Height is the first
+// block it could have been mined in.
+type trackedFee struct {
+	FeeRate float64
+	Height  int
+}
+
+// feeEstimatorStorage is the saved state of a fee estimator
+type feeEstimatorStorage struct {
+	Version int             `json:"version"`
+	Height  int             `json:"height"`
+	Blocks  []blockFeeStats `json:"blocks"`
+}
+
+// FeeEstimator estimates the fee rate needed to confirm within a number of
+// blocks. It watches the fee rates of transactions entering the mempool and
+// how many blocks each took to confirm, over a sliding window of recent
+// blocks, and groups them into fee rate buckets.
+type FeeEstimator struct {
+	window  int
+	buckets []float64             // lower bound of each bucket
+	tracked map[string]trackedFee // txID -> waiting transaction
+	blocks  []blockFeeStats       // oldest first
+	height  int                   // last connected block
+	mu      sync.RWMutex
+}
+
+// NewFeeEstimator creates a fee estimator keeping DefaultFeeEstimatorWindow
+// blocks of history
+func NewFeeEstimator() *FeeEstimator {
+	return NewFeeEstimatorWithWindow(DefaultFeeEstimatorWindow)
+}
+
+// NewFeeEstimatorWithWindow creates a fee estimator keeping the given number
+// of blocks of history
+func NewFeeEstimatorWithWindow(window int) *FeeEstimator {
+	if window < MaxConfirmationTarget {
+		window = MaxConfirmationTarget
+	}
+
+	var buckets []float64
+	for rate := feeBucketMin; rate <= feeBucketMax; rate *= feeBucketSpacing {
+		buckets = append(buckets, math.Floor(rate))
+	}
+
+	return &FeeEstimator{
+		window:  window,
+		buckets: buckets,
+		tracked: make(map[string]trackedFee),
+	}
+}
+
+// TrackTransaction starts watching a transaction that entered the mempool
+// and could first be mined in the block at height
+func (fe *FeeEstimator) TrackTransaction(txID string, feeRate float64, height int) {
+	fe.mu.Lock()
+	defer fe.mu.Unlock()
+
+	if _, exists := fe.tracked[txID]; exists {
+		return
+	}
+	fe.tracked[txID] = trackedFee{FeeRate: feeRate, Height: height}
+}
+
+// RemoveTransaction stops watching a transaction that left the mempool
+// without being mined. It counts as not confirming within the blocks it
+// waited.
+func (fe *FeeEstimator) RemoveTransaction(txID string) {
+	fe.mu.Lock()
+	defer fe.mu.Unlock()
+
+	tracked, exists := fe.tracked[txID]
+	if !exists {
+		return
+	}
+	delete(fe.tracked, txID)
+
+	waited := fe.height + 1 - tracked.Height
+	if waited <= 0 {
+		return
+	}
+	if len(fe.blocks) == 0 || fe.blocks[len(fe.blocks)-1].Height != fe.height {
+		fe.blocks = append(fe.blocks, blockFeeStats{Height: fe.height})
+	}
+	last := &fe.blocks[len(fe.blocks)-1]
+	last.Failed = append(last.Failed, feeObservation{FeeRate: tracked.FeeRate, Blocks: waited})
+}
+
+// ProcessBlock records the tracked transactions confirmed in the block at
+// height. A block at or below the last processed height replaces a block
+// disconnected by a reorganization, so the stats recorded from that height
+// up are discarded first.
+func (fe *FeeEstimator) ProcessBlock(height int, txIDs []string) {
+	fe.mu.Lock()
+	defer fe.mu.Unlock()
+
+	if height <= fe.height {
+		fe.rollbackLocked(height)
+	}
+	fe.height = height
+
+	stats := blockFeeStats{Height: height}
+	for _, txID := range txIDs {
+		tracked, exists := fe.tracked[txID]
+		if !exists {
+			continue
+		}
+		delete(fe.tracked, txID)
+
+		blocks := height + 1 - tracked.Height
+		if blocks < 1 {
+			blocks = 1
+		}
+		stats.Confirmed = append(stats.Confirmed, feeObservation{FeeRate: tracked.FeeRate, Blocks: blocks})
+	}
+	fe.blocks = append(fe.blocks, stats)
+
+	// Slide the window
+	start := 0
+	for start < len(fe.blocks) && fe.blocks[start].Height <= height-fe.window {
+		start++
+	}
+	fe.blocks = fe.blocks[start:]
+}
+
+// rollbackLocked discards the stats recorded for blocks at or above height
+// (assumes lock is held)
+func (fe *FeeEstimator) rollbackLocked(height int) {
+	end := len(fe.blocks)
+	for end > 0 && fe.blocks[end-1].Height >= height {
+		end--
+	}
+	fe.blocks = fe.blocks[:end]
+}
+
+// EstimateFeeRate returns the lowest fee rate, in base units per byte, at
+// which transactions recently confirmed within target blocks. Buckets are
+// checked from the highest fee rate down, merging sparse buckets, until one
+// confirms too rarely.
+func (fe *FeeEstimator) EstimateFeeRate(target int) (float64, error) {
+	if target < 1 || target > MaxConfirmationTarget {
+		return 0, fmt.Errorf("confirmation target must be between 1 and %d blocks", MaxConfirmationTarget)
+	}
+
+	fe.mu.RLock()
+	defer fe.mu.RUnlock()
+
+	confirmed := make([]int, len(fe.buckets))
+	total := make([]int, len(fe.buckets))
+	for _, block := range fe.blocks {
+		for _, observation := range block.Confirmed {
+			bucket := fe.bucketLocked(observation.FeeRate)
+			total[bucket]++
+			if observation.Blocks <= target {
+				confirmed[bucket]++
+			}
+		}
+		for _, observation := range block.Failed {
+			if observation.Blocks >= target {
+				total[fe.bucketLocked(observation.FeeRate)]++
+			}
+		}
+	}
+	for _, tracked := range fe.tracked {
+		if fe.height+1-tracked.Height >= target {
+			total[fe.bucketLocked(tracked.FeeRate)]++
+		}
+	}
+
+	estimate := -1.0
+	var groupConfirmed, groupTotal int
+	for bucket := len(fe.buckets) - 1; bucket >= 0; bucket-- {
+		groupConfirmed += confirmed[bucket]
+		groupTotal += total[bucket]
+		if groupTotal < feeEstimateMinSamples {
+			continue
+		}
+		if float64(groupConfirmed)/float64(groupTotal) < feeEstimateSuccess {
+			break
+		}
+		estimate = fe.buckets[bucket]
+		groupConfirmed, groupTotal = 0, 0
+	}
+
+	if estimate < 0 {
+		return 0, fmt.Errorf("%w: target %d blocks", ErrInsufficientFeeData, target)
+	}
+	return estimate, nil
+}
+
+// EstimateFee returns the fee for a transaction with the given number of
+// inputs and outputs to confirm within target blocks
+func (fe *FeeEstimator) EstimateFee(inputCount, outputCount, target int) (Amount, error) {
+	feeRate, err := fe.EstimateFeeRate(target)
+	if err != nil {
+		return 0, err
+	}
+	size := EstimateTransactionSize(inputCount, outputCount)
+	return Amount(math.Ceil(feeRate * float64(size))), nil
+}
+
+// bucketLocked returns the bucket a fee rate falls in (assumes lock is held)
+func (fe *FeeEstimator) bucketLocked(feeRate float64) int {
+	for bucket := len(fe.buckets) - 1; bucket > 0; bucket-- {
+		if feeRate >= fe.buckets[bucket] {
+			return bucket
+		}
+	}
+	return 0
+}
+
+// GetStats returns fee estimator statistics
+func (fe *FeeEstimator) GetStats() map[string]interface{} {
+	fe.mu.RLock()
+	defer fe.mu.RUnlock()
+
+	var confirmed, failed int
+	for _, block := range fe.blocks {
+		confirmed += len(block.Confirmed)
+		failed += len(block.Failed)
+	}
+
+	return map[string]interface{}{
+		"height":       fe.height,
+		"window":       fe.window,
+		"blocks":       len(fe.blocks),
+		"tracked":      len(fe.tracked),
+		"confirmed":    confirmed,
+		"failed":       failed,
+		"bucket_count": len(fe.buckets),
+	}
+}
+
+// SaveToFile saves the fee history to a file. Transactions still waiting in
+// the mempool are not saved.
+func (fe *FeeEstimator) SaveToFile(filename string) error {
+	fe.mu.RLock()
+	storage := feeEstimatorStorage{
+		Version: feeEstimatorVersion,
+		Height:  fe.height,
+		Blocks:  fe.blocks,
+	}
+	data, err := json.Marshal(storage)
+	fe.mu.RUnlock()
+	if err != nil {
+		return fmt.Errorf("failed to marshal fee estimates: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	if err := os.WriteFile(filename, data, 0644); err != nil {
+		return fmt.Errorf("failed to write fee estimates: %w", err)
+	}
+	return nil
+}
+
+// LoadFromFile replaces the fee history with the one saved in a file. Blocks
+// outside the window are dropped.
+func (fe *FeeEstimator) LoadFromFile(filename string) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("failed to read fee estimates: %w", err)
+	}
+
+	var storage feeEstimatorStorage
+	if err := json.Unmarshal(data, &storage); err != nil {
+		return fmt.Errorf("failed to unmarshal fee estimates: %w", err)
+	}
+	if storage.Version != feeEstimatorVersion {
+		return fmt.Errorf("unsupported fee estimates version %d", storage.Version)
+	}
+
+	fe.mu.Lock()
+	defer fe.mu.Unlock()
+
+	fe.height = storage.Height
+	fe.blocks = nil
+	for _, block := range storage.Blocks {
+		if block.Height > storage.Height-fe.window && block.Height <= storage.Height {
+			fe.blocks = append(fe.blocks, block)
+		}
+	}
+	return nil
+}
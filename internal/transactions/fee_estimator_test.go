@@ -0,0 +1,172 @@
+package transactions
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// confirmFeeRates tracks count transactions at feeRate and confirms them
+// after blocks blocks, starting at height. It returns the next height.
+func confirmFeeRates(fe *FeeEstimator, height int, feeRate float64, blocks, count int) int {
+	var txIDs []string
+	for i := 0; i < count; i++ {
+		txID := fmt.Sprintf("tx-%.0f-%d-%d", feeRate, height, i)
+		fe.TrackTransaction(txID, feeRate, height)
+		txIDs = append(txIDs, txID)
+	}
+	for i := 1; i < blocks; i++ {
+		fe.ProcessBlock(height, nil)
+		height++
+	}
+	fe.ProcessBlock(height, txIDs)
+	return height + 1
+}
+
+func TestFeeEstimator(t *testing.T) {
+	fe := NewFeeEstimator()
+
+	_, err := fe.EstimateFeeRate(1)
+	assert.ErrorIs(t, err, ErrInsufficientFeeData)
+
+	// High fee transactions confirm in the next block, low fee ones take
+	// three blocks
+	height := 1
+	for i := 0; i < 4; i++ {
+		height = confirmFeeRates(fe, height, 50000, 1, 5)
+		height = confirmFeeRates(fe, height, 2000, 3, 5)
+	}
+
+	fast, err := fe.EstimateFeeRate(1)
+	require.NoError(t, err)
+	assert.Greater(t, fast, 2000.0)
+	assert.LessOrEqual(t, fast, 50000.0)
+
+	slow, err := fe.EstimateFeeRate(3)
+	require.NoError(t, err)
+	assert.LessOrEqual(t, slow, 2000.0)
+	assert.Less(t, slow, fast)
+
+	fee, err := fe.EstimateFee(1, 2, 3)
+	require.NoError(t, err)
+	assert.Equal(t, Amount(slow*float64(EstimateTransactionSize(1, 2))), fee)
+
+	_, err = fe.EstimateFeeRate(0)
+	assert.Error(t, err)
+	_, err = fe.EstimateFeeRate(MaxConfirmationTarget + 1)
+	assert.Error(t, err)
+}
+
+func TestFeeEstimatorCountsUnconfirmed(t *testing.T) {
+	fe := NewFeeEstimator()
+	height := confirmFeeRates(fe, 1, 5000, 1, 5)
+
+	// Transactions that leave the mempool unconfirmed count against their
+	// fee rate for the blocks they waited
+	for i := 0; i < 10; i++ {
+		fe.TrackTransaction(fmt.Sprintf("stuck%d", i), 5000, height)
+	}
+	fe.ProcessBlock(height, nil)
+	for i := 0; i < 10; i++ {
+		fe.RemoveTransaction(fmt.Sprintf("stuck%d", i))
+	}
+
+	_, err := fe.EstimateFeeRate(1)
+	assert.ErrorIs(t, err, ErrInsufficientFeeData)
+	assert.Equal(t, 10, fe.GetStats()["failed"])
+	assert.Equal(t, 0, fe.GetStats()["tracked"])
+}
+
+func TestFeeEstimatorWindow(t *testing.T) {
+	fe := NewFeeEstimatorWithWindow(MaxConfirmationTarget)
+	height := confirmFeeRates(fe, 1, 5000, 1, 10)
+	_, err := fe.EstimateFeeRate(1)
+	require.NoError(t, err)
+
+	// Old confirmations slide out of the window
+	for i := 0; i < MaxConfirmationTarget; i++ {
+		fe.ProcessBlock(height+i, nil)
+	}
+	_, err = fe.EstimateFeeRate(1)
+	assert.ErrorIs(t, err, ErrInsufficientFeeData)
+	assert.Equal(t, MaxConfirmationTarget, fe.GetStats()["blocks"])
+}
+
+func TestFeeEstimatorReorg(t *testing.T) {
+	fe := NewFeeEstimator()
+	height := confirmFeeRates(fe, 1, 5000, 1, 5)
+	confirmFeeRates(fe, height, 5000, 1, 5)
+	assert.Equal(t, 10, fe.GetStats()["confirmed"])
+
+	// A block replacing the one at the tip discards its confirmations
+	fe.TrackTransaction("replacement", 5000, height)
+	fe.ProcessBlock(height, []string{"replacement"})
+	assert.Equal(t, height, fe.GetStats()["height"])
+	assert.Equal(t, 2, fe.GetStats()["blocks"])
+	assert.Equal(t, 6, fe.GetStats()["confirmed"])
+
+	// A deeper reorganization discards every block above the fork
+	fe.ProcessBlock(1, nil)
+	fe.ProcessBlock(2, nil)
+	assert.Equal(t, 2, fe.GetStats()["height"])
+	assert.Equal(t, 2, fe.GetStats()["blocks"])
+	assert.Equal(t, 0, fe.GetStats()["confirmed"])
+}
+
+func TestFeeEstimatorSaveLoad(t *testing.T) {
+	fe := NewFeeEstimator()
+	confirmFeeRates(fe, 1, 8000, 2, 10)
+	expected, err := fe.EstimateFeeRate(2)
+	require.NoError(t, err)
+
+	filename := filepath.Join(t.TempDir(), "estimates", "fees.json")
+	require.NoError(t, fe.SaveToFile(filename))
+
+	loaded := NewFeeEstimator()
+	require.NoError(t, loaded.LoadFromFile(filename))
+	actual, err := loaded.EstimateFeeRate(2)
+	require.NoError(t, err)
+	assert.Equal(t, expected, actual)
+	assert.Equal(t, 2, loaded.GetStats()["height"])
+
+	assert.Error(t, loaded.LoadFromFile(filepath.Join(t.TempDir(), "missing.json")))
+}
+
+func TestMempoolFeeEstimator(t *testing.T) {
+	mp := NewMempool()
+	fe := NewFeeEstimator()
+	mp.SetFeeEstimator(fe)
+	mp.UpdateLockContext(LockContext{Height: 2})
+
+	utxoSet := make(map[string]map[int]TxOutput)
+	var txs []*Transaction
+	for i := 0; i < 10; i++ {
+		prevID := fmt.Sprintf("prev%d", i)
+		utxoSet[prevID] = map[int]TxOutput{0: {Address: testAddressN(i), Amount: 2.0 * Coin}}
+		tx := NewTransaction(
+			[]TxInput{{TxID: prevID, Index: 0}},
+			[]TxOutput{{Address: testAddressN(i), Amount: 1.0 * Coin}},
+		)
+		signTestTx(t, mp, tx, utxoSet)
+		require.NoError(t, mp.AddTransaction(tx, utxoSet))
+		txs = append(txs, tx)
+	}
+	assert.Equal(t, 10, fe.GetStats()["tracked"])
+
+	// Confirmed transactions leave the pool and teach the estimator
+	mp.RemoveBlockTransactions(2, txs[:9])
+	assert.Equal(t, 1, mp.Size())
+	assert.Equal(t, 9, fe.GetStats()["confirmed"])
+
+	feeRate, err := fe.EstimateFeeRate(1)
+	require.NoError(t, err)
+	assert.LessOrEqual(t, feeRate, float64(txs[0].GetFee(utxoSet))/float64(EstimateTransactionSize(1, 1)))
+
+	// Evicted ones count as unconfirmed
+	assert.True(t, mp.RemoveTransaction(txs[9].ID))
+	assert.Equal(t, 0, fe.GetStats()["tracked"])
+	assert.Equal(t, 1, fe.GetStats()["failed"])
+}
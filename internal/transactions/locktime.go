@@ -0,0 +1,121 @@
+package transactions
+
+import (
+	"errors"
+	"fmt"
+)
+
+// LockTimeThreshold separates lock times given as block heights (below it)
+// from lock times given as Unix timestamps
+const LockTimeThreshold = 500000000
+
+// Relative lock times are encoded in input sequence numbers, as in BIP68. The
+// low 16 bits hold the lock value, counted in blocks or, with
+// SequenceLockTimeIsSeconds set, in units of 512 seconds.
+const (
+	// SequenceLockDisabled turns off the relative lock of an input
+	SequenceLockDisabled uint32 = 1 << 31
+	// SequenceReplaceable opts the transaction in to replace-by-fee in the
+	// mempool. It has no effect on the relative lock.
+	SequenceReplaceable uint32 = 1 << 30
+	// SequenceLockTimeIsSeconds marks the lock value as a time span
+	SequenceLockTimeIsSeconds uint32 = 1 << 22
+	// SequenceLockMask selects the lock value
+	SequenceLockMask uint32 = 0x0000ffff
+	// SequenceLockTimeGranularity is log2 of the seconds in one time unit
+	SequenceLockTimeGranularity = 9
+)
+
+// ErrNotFinal is returned for transactions whose absolute or relative lock
+// time has not passed yet. They may become valid in a later block.
+var ErrNotFinal = errors.New("transaction is not final")
+
+// LockContext describes the block a transaction would be included in
+type LockContext struct {
+	Height     int   // Height of the block
+	MedianTime int64 // Median time past of the block before it
+
+	// Confirmation returns the height of the block containing the
+	// transaction with txID and the median time past of the block before
+	// that one. ok is false for unconfirmed or unknown transactions.
+	Confirmation func(txID string) (height int, medianTime int64, ok bool)
+}
+
+// BlockSequence returns the sequence number of an input that can only be
+// mined the given number of blocks after the output it spends
+func BlockSequence(blocks uint16) uint32 {
+	return uint32(blocks)
+}
+
+// TimeSequence returns the sequence number of an input that can only be mined
+// once seconds have passed since the output it spends was mined. The time is
+// rounded up to a multiple of 512 seconds.
+func TimeSequence(seconds uint32) (uint32, error) {
+	units := (uint64(seconds) + 1<<SequenceLockTimeGranularity - 1) >> SequenceLockTimeGranularity
+	if units > uint64(SequenceLockMask) {
+		return 0, fmt.Errorf("relative lock of %d seconds is too long", seconds)
+	}
+	return SequenceLockTimeIsSeconds | uint32(units), nil
+}
+
+// IsFinal reports whether the absolute lock time allows the transaction in a
+// block at height whose previous block has the given median time past. A
+// transaction can be mined in the first block above a height lock time, or
+// once the median time past is beyond a time lock time.
+func (tx *Transaction) IsFinal(height int, medianTime int64) bool {
+	if tx.LockTime == 0 {
+		return true
+	}
+	if tx.LockTime < LockTimeThreshold {
+		return int64(tx.LockTime) < int64(height)
+	}
+	return int64(tx.LockTime) < medianTime
+}
+
+// CheckLocks checks the absolute lock time and the relative lock of every
+// input against the block described by ctx. It returns an error wrapping
+// ErrNotFinal if the transaction cannot be mined in that block yet.
+func (tx *Transaction) CheckLocks(ctx LockContext) error {
+	if tx.IsCoinbase() {
+		return nil
+	}
+	if !tx.IsFinal(ctx.Height, ctx.MedianTime) {
+		return fmt.Errorf("%w: locked until %s", ErrNotFinal, describeLockTime(tx.LockTime))
+	}
+
+	for i, input := range tx.Inputs {
+		value := input.Sequence & SequenceLockMask
+		if input.Sequence&SequenceLockDisabled != 0 || value == 0 {
+			continue
+		}
+
+		var height int
+		var medianTime int64
+		var ok bool
+		if ctx.Confirmation != nil {
+			height, medianTime, ok = ctx.Confirmation(input.TxID)
+		}
+		if !ok {
+			return fmt.Errorf("%w: input %d spends an unconfirmed output with a relative lock", ErrNotFinal, i)
+		}
+
+		if input.Sequence&SequenceLockTimeIsSeconds != 0 {
+			unlockTime := medianTime + int64(value)<<SequenceLockTimeGranularity
+			if ctx.MedianTime < unlockTime {
+				return fmt.Errorf("%w: input %d is locked until time %d", ErrNotFinal, i, unlockTime)
+			}
+		} else if ctx.Height < height+int(value) {
+			return fmt.Errorf("%w: input %d is locked until height %d", ErrNotFinal, i, height+int(value))
+		}
+	}
+
+	return nil
+}
+
+// describeLockTime formats a lock time as a height or a Unix time
+func describeLockTime(lockTime uint32) string {
+	if lockTime < LockTimeThreshold {
+		return fmt.Sprintf("height %d", lockTime)
+	}
+	return fmt.Sprintf("time %d", lockTime)
+}
@@ -0,0 +1,80 @@
+package transactions
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsFinal(t *testing.T) {
+	tx := NewTransaction([]TxInput{{TxID: "prev", Index: 0}}, []TxOutput{{Address: testAddress, Amount: Coin}})
+	assert.True(t, tx.IsFinal(0, 0))
+
+	tx.LockTime = 100
+	assert.False(t, tx.IsFinal(100, 0))
+	assert.True(t, tx.IsFinal(101, 0))
+
+	tx.LockTime = 1700000000
+	assert.False(t, tx.IsFinal(1000000, 1700000000))
+	assert.True(t, tx.IsFinal(0, 1700000001))
+}
+
+func TestCheckLocks(t *testing.T) {
+	timeSequence, err := TimeSequence(1024)
+	require.NoError(t, err)
+
+	tx := NewTransaction(
+		[]TxInput{
+			{TxID: "blocks", Index: 0, Sequence: BlockSequence(10)},
+			{TxID: "seconds", Index: 0, Sequence: timeSequence},
+			{TxID: "disabled", Index: 0, Sequence: SequenceLockDisabled | 50},
+		},
+		[]TxOutput{{Address: testAddress, Amount: Coin}},
+	)
+
+	confirmations := map[string][2]int64{
+		"blocks":  {100, 0},
+		"seconds": {90, 1700000000},
+	}
+	ctx := func(height int, medianTime int64) LockContext {
+		return LockContext{
+			Height:     height,
+			MedianTime: medianTime,
+			Confirmation: func(txID string) (int, int64, bool) {
+				conf, ok := confirmations[txID]
+				return int(conf[0]), conf[1], ok
+			},
+		}
+	}
+
+	err = tx.CheckLocks(ctx(109, 1700001024))
+	assert.ErrorIs(t, err, ErrNotFinal)
+	assert.Contains(t, err.Error(), "input 0")
+
+	err = tx.CheckLocks(ctx(110, 1700001023))
+	assert.ErrorIs(t, err, ErrNotFinal)
+	assert.Contains(t, err.Error(), "input 1")
+
+	assert.NoError(t, tx.CheckLocks(ctx(110, 1700001024)))
+
+	// Without a known confirmation the relative locks cannot pass
+	assert.ErrorIs(t, tx.CheckLocks(LockContext{Height: 1000, MedianTime: 1800000000}), ErrNotFinal)
+
+	coinbase := NewBlockCoinbaseTransaction(testAddress, Coin, 1)
+	coinbase.LockTime = 50
+	assert.NoError(t, coinbase.CheckLocks(LockContext{}))
+}
+
+func TestTimeSequence(t *testing.T) {
+	sequence, err := TimeSequence(1)
+	require.NoError(t, err)
+	assert.Equal(t, SequenceLockTimeIsSeconds|1, sequence, "rounded up to one unit")
+
+	sequence, err = TimeSequence(512 * 3)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(3), sequence&SequenceLockMask)
+
+	_, err = TimeSequence(512*0x10000 + 1)
+	assert.Error(t, err)
+}
@@ -2,20 +2,26 @@ package transactions
 
 import (
 	"container/heap"
+	"errors"
 	"fmt"
 	"sort"
 	"sync"
 	"time"
+
+	"github.com/aliexe/blockChain/internal/crypto"
 )
 
 // MempoolConfig defines configuration for the mempool
 type MempoolConfig struct {
-	MaxSize         int           // Maximum number of transactions in pool
-	MaxAge          time.Duration // Maximum age of transactions before removal
-	MinFeeRate      float64       // Minimum fee rate to accept transactions
-	MaxTxSize       int           // Maximum transaction size in bytes
-	ValidateTx      bool          // Whether to validate transactions before adding
-	CleanupInterval time.Duration // Interval for cleaning old transactions
+	MaxSize         int             // Maximum number of transactions in pool
+	MaxAge          time.Duration   // Maximum age of transactions before removal
+	MinFeeRate      float64         // Minimum fee rate to accept transactions, in base units per byte
+	MaxTxSize       int             // Maximum transaction size in bytes
+	ValidateTx      bool            // Whether to validate transactions before adding
+	CleanupInterval time.Duration   // Interval for cleaning old transactions
+	Network         *crypto.Network // Network output addresses must belong to, nil for any
+	PersistPath     string          // File the pool is saved to while running, empty to disable
+	PersistInterval time.Duration   // Interval for saving the pool to PersistPath
 }
 
 // DefaultMempoolConfig returns default mempool configuration
@@ -23,33 +29,45 @@ func DefaultMempoolConfig() MempoolConfig {
 	return MempoolConfig{
 		MaxSize:         5000,
 		MaxAge:          24 * time.Hour,
-		MinFeeRate:      0.00001,
+		MinFeeRate:      1000, // 0.00001 coins per byte
 		MaxTxSize:       100000, // 100KB
 		ValidateTx:      true,
 		CleanupInterval: 10 * time.Minute,
+		Network:         crypto.MainNet,
+		PersistInterval: 15 * time.Minute,
 	}
 }
 
 // MempoolEntry represents a transaction in the mempool with metadata
 type MempoolEntry struct {
 	Transaction *Transaction
-	FeeRate     float64
+	Fee         Amount
+	FeeRate     float64 // Base units per byte
 	Size        int
 	AddedAt     time.Time
 	Priority    int64
 }
 
-// Mempool manages pending transactions
+// Mempool manages pending transactions. Transactions that are valid but not
+// final yet are held outside the pool until UpdateLockContext reports a block
+// they can be mined in. A transaction may spend outputs of unconfirmed
+// parents in the pool, and a conflicting transaction may replace pool
+// transactions that opted in to replace-by-fee.
 type Mempool struct {
 	config        MempoolConfig
 	transactions  map[string]*MempoolEntry // txID -> entry
 	byAddress     map[string][]string      // address -> []txID
-	priorityQueue *PriorityQueue
-	removedEntries map[string]bool         // track removed entries in priority queue
+	spentBy       map[UTXOKey]string       // outpoint -> txID spending it
+	held          map[string]*MempoolEntry // txID -> not yet final entry
+	heldSpentBy   map[UTXOKey]string       // outpoint -> held txID spending it
+	lockContext   LockContext              // next block, for lock time checks
+	replaced      int                      // transactions evicted by replace-by-fee
+	feeEstimator  *FeeEstimator            // optional, told about pool changes
 	mu            sync.RWMutex
 	cleanupTicker *time.Ticker
 	cleanupStop   chan struct{}
 	running       bool
+	persistErr    error // last error saving to PersistPath
 }
 
 // NewMempool creates a new mempool with default configuration
@@ -63,17 +81,18 @@ func NewMempoolWithConfig(config MempoolConfig) *Mempool {
 		config:         config,
 		transactions:   make(map[string]*MempoolEntry),
 		byAddress:      make(map[string][]string),
-		priorityQueue:  &PriorityQueue{},
-		removedEntries: make(map[string]bool),
+		spentBy:        make(map[UTXOKey]string),
+		held:           make(map[string]*MempoolEntry),
+		heldSpentBy:    make(map[UTXOKey]string),
 		cleanupTicker:  time.NewTicker(config.CleanupInterval),
 		cleanupStop:    make(chan struct{}),
 		running:        false,
 	}
-	heap.Init(mp.priorityQueue)
 	return mp
 }
 
-// Start starts the mempool cleanup goroutine
+// Start starts the mempool cleanup goroutine. With PersistPath set it also
+// saves the pool periodically.
 func (mp *Mempool) Start() {
 	mp.mu.Lock()
 	defer mp.mu.Unlock()
@@ -83,10 +102,11 @@ func (mp *Mempool) Start() {
 	}
 
 	mp.running = true
-	go mp.cleanupLoop()
+	go mp.cleanupLoop(mp.cleanupTicker, mp.cleanupStop)
 }
 
-// Stop stops the mempool cleanup goroutine
+// Stop stops the mempool cleanup goroutine. With PersistPath set the pool is
+// saved one last time.
 func (mp *Mempool) Stop() {
 	mp.mu.Lock()
 	defer mp.mu.Unlock()
@@ -99,40 +119,88 @@ func (mp *Mempool) Stop() {
 	close(mp.cleanupStop)
 	mp.cleanupTicker.Stop()
 
+	if mp.config.PersistPath != "" {
+		mp.persistErr = mp.saveLocked(mp.config.PersistPath)
+	}
+
 	// Create new channels and ticker for potential restart
 	mp.cleanupStop = make(chan struct{})
 	mp.cleanupTicker = time.NewTicker(mp.config.CleanupInterval)
 }
 
-// cleanupLoop runs the periodic cleanup in a controlled goroutine
-func (mp *Mempool) cleanupLoop() {
-	defer mp.cleanupTicker.Stop()
+// cleanupLoop runs the periodic cleanup in a controlled goroutine until stop
+// is closed. Stop replaces the ticker and channel for a restart, so the loop
+// is given the ones it was started with.
+func (mp *Mempool) cleanupLoop(cleanupTicker *time.Ticker, stop chan struct{}) {
+	defer cleanupTicker.Stop()
+
+	var persist <-chan time.Time
+	if mp.config.PersistPath != "" && mp.config.PersistInterval > 0 {
+		persistTicker := time.NewTicker(mp.config.PersistInterval)
+		defer persistTicker.Stop()
+		persist = persistTicker.C
+	}
 
 	for {
 		select {
-		case <-mp.cleanupTicker.C:
+		case <-cleanupTicker.C:
 			mp.cleanupOldTransactions()
-		case <-mp.cleanupStop:
+		case <-persist:
+			err := mp.SaveToFile(mp.config.PersistPath)
+			mp.mu.Lock()
+			mp.persistErr = err
+			mp.mu.Unlock()
+		case <-stop:
 			return
 		}
 	}
 }
 
-// AddTransaction adds a transaction to the mempool
+// AddTransaction adds a transaction to the mempool. Every input must spend a
+// confirmed output or one of a pool transaction, and with ValidateTx its
+// unlocking script must satisfy that output. A transaction whose lock
+// time or input relative locks have not passed is held until they do. A
+// transaction spending an output already spent in the pool is rejected,
+// unless it replaces the pool transactions by the replace-by-fee rules.
 func (mp *Mempool) AddTransaction(tx *Transaction, utxoSet map[string]map[int]TxOutput) error {
 	mp.mu.Lock()
 	defer mp.mu.Unlock()
 
+	return mp.addTransactionLocked(tx, utxoSet, time.Now())
+}
+
+// addTransactionLocked validates tx and adds it to the pool or holds it, with
+// addedAt as the time it entered the mempool (assumes lock is held)
+func (mp *Mempool) addTransactionLocked(tx *Transaction, utxoSet map[string]map[int]TxOutput, addedAt time.Time) error {
 	// Check if transaction already exists
 	if _, exists := mp.transactions[tx.ID]; exists {
 		return fmt.Errorf("transaction %s already exists in mempool", tx.ID)
 	}
+	if _, exists := mp.held[tx.ID]; exists {
+		return fmt.Errorf("transaction %s is already held in mempool", tx.ID)
+	}
 
 	// Validate transaction if enabled
 	if mp.config.ValidateTx {
 		if err := tx.ValidateBasic(); err != nil {
 			return fmt.Errorf("transaction validation failed: %w", err)
 		}
+		for i, output := range tx.Outputs {
+			if err := ValidateAddressForNetwork(output.Address, mp.config.Network); err != nil {
+				return fmt.Errorf("output %d address validation failed: %w", i, err)
+			}
+		}
+	}
+
+	// Every input must spend a confirmed output or an output of a pool
+	// transaction
+	if err := mp.checkInputsLocked(tx, utxoSet); err != nil {
+		return err
+	}
+	if mp.config.ValidateTx {
+		if err := mp.verifyScriptsLocked(tx, utxoSet); err != nil {
+			return err
+		}
 	}
 
 	// Check transaction size
@@ -141,38 +209,79 @@ func (mp *Mempool) AddTransaction(tx *Transaction, utxoSet map[string]map[int]Tx
 		return fmt.Errorf("transaction size %d exceeds maximum %d", txSize, mp.config.MaxTxSize)
 	}
 
-	// Calculate fee rate
-	fee := tx.GetFee(utxoSet)
-	if fee <= 0 {
+	// Calculate fee rate, counting outputs of unconfirmed parents in the pool
+	fee := mp.feeLocked(tx, utxoSet)
+	if fee == 0 {
 		return fmt.Errorf("transaction must have positive fee")
 	}
 
-	feeRate := fee / float64(txSize)
+	feeRate := float64(fee) / float64(txSize)
 	if feeRate < mp.config.MinFeeRate {
-		return fmt.Errorf("fee rate %.8f below minimum %.8f", feeRate, mp.config.MinFeeRate)
+		return fmt.Errorf("fee rate %.2f below minimum %.2f base units per byte", feeRate, mp.config.MinFeeRate)
 	}
 
-	// Check pool size limit
-	if len(mp.transactions) >= mp.config.MaxSize {
-		// Try to evict lowest priority transaction
-		if err := mp.evictLowestPriority(); err != nil {
-			return fmt.Errorf("mempool is full and cannot evict transactions: %w", err)
-		}
-		// Double-check after eviction
-		if len(mp.transactions) >= mp.config.MaxSize {
-			return fmt.Errorf("mempool is critically full, cannot add transaction")
+	// Replace conflicting transactions only if the rules allow it
+	var replaced map[string]*MempoolEntry
+	if conflicts := mp.conflictsLocked(tx); len(conflicts) > 0 {
+		var err error
+		if replaced, err = mp.checkReplacementLocked(tx, fee, txSize, conflicts, utxoSet); err != nil {
+			return err
 		}
 	}
 
 	// Create mempool entry
 	entry := &MempoolEntry{
 		Transaction: tx,
+		Fee:         fee,
 		FeeRate:     feeRate,
 		Size:        txSize,
-		AddedAt:     time.Now(),
+		AddedAt:     addedAt,
 		Priority:    mp.calculatePriority(tx, feeRate),
 	}
 
+	// Hold transactions that cannot be mined in the next block yet
+	if err := tx.CheckLocks(mp.lockContext); err != nil {
+		if !errors.Is(err, ErrNotFinal) {
+			return err
+		}
+		if len(replaced) > 0 {
+			return fmt.Errorf("replacement cannot be held: %w", err)
+		}
+		if len(mp.held) >= mp.config.MaxSize {
+			return fmt.Errorf("too many held transactions: %w", err)
+		}
+		mp.holdLocked(entry)
+		return nil
+	}
+
+	for txID := range replaced {
+		if !mp.removeLocked(txID) {
+			mp.unholdLocked(txID)
+		}
+	}
+	mp.replaced += len(replaced)
+
+	return mp.addEntryLocked(entry)
+}
+
+// addEntryLocked adds an entry to the pool and its indexes, evicting the
+// transactions with the lowest descendant fee rate if the pool is full. The
+// ancestors of the entry are never evicted for it. (assumes lock is held)
+func (mp *Mempool) addEntryLocked(entry *MempoolEntry) error {
+	tx := entry.Transaction
+
+	// Check pool size limit
+	if len(mp.transactions) >= mp.config.MaxSize {
+		// Try to evict the cheapest transaction package
+		if err := mp.evictLocked(mp.ancestorsLocked(tx)); err != nil {
+			return fmt.Errorf("mempool is full and cannot evict transactions: %w", err)
+		}
+		// Double-check after eviction
+		if len(mp.transactions) >= mp.config.MaxSize {
+			return fmt.Errorf("mempool is critically full, cannot add transaction")
+		}
+	}
+
 	// Add to mempool
 	mp.transactions[tx.ID] = entry
 
@@ -183,8 +292,14 @@ func (mp *Mempool) AddTransaction(tx *Transaction, utxoSet map[string]map[int]Tx
 		mp.byAddress[output.Address] = append(mp.byAddress[output.Address], tx.ID)
 	}
 
-	// Add to priority queue
-	heap.Push(mp.priorityQueue, entry)
+	// Update outpoint index
+	for _, input := range tx.Inputs {
+		mp.spentBy[UTXOKey{TxID: input.TxID, Index: input.Index}] = tx.ID
+	}
+
+	if mp.feeEstimator != nil {
+		mp.feeEstimator.TrackTransaction(tx.ID, entry.FeeRate, mp.lockContext.Height)
+	}
 
 	return nil
 }
@@ -197,21 +312,219 @@ func (mp *Mempool) GetTransaction(txID string) (*Transaction, bool) {
 	if entry, exists := mp.transactions[txID]; exists {
 		return entry.Transaction, true
 	}
+	if entry, exists := mp.held[txID]; exists {
+		return entry.Transaction, true
+	}
 	return nil, false
 }
 
+// GetHeldTransactions returns the transactions held until they are final
+func (mp *Mempool) GetHeldTransactions() []*Transaction {
+	mp.mu.RLock()
+	defer mp.mu.RUnlock()
+
+	transactions := make([]*Transaction, 0, len(mp.held))
+	for _, entry := range mp.held {
+		transactions = append(transactions, entry.Transaction)
+	}
+	return transactions
+}
+
+// GetSpendingTransaction returns the ID of the pool transaction spending the
+// given output, if any
+func (mp *Mempool) GetSpendingTransaction(txID string, index int) (string, bool) {
+	mp.mu.RLock()
+	defer mp.mu.RUnlock()
+
+	spenderID, spent := mp.spentBy[UTXOKey{TxID: txID, Index: index}]
+	return spenderID, spent
+}
+
+// UTXOOverlay returns utxoSet as it would be with every pool transaction
+// applied: outputs spent in the pool are left out and outputs of pool
+// transactions not spent in the pool are added. utxoSet is not modified.
+func (mp *Mempool) UTXOOverlay(utxoSet map[string]map[int]TxOutput) map[string]map[int]TxOutput {
+	mp.mu.RLock()
+	defer mp.mu.RUnlock()
+
+	overlay := make(map[string]map[int]TxOutput, len(utxoSet)+len(mp.transactions))
+	add := func(txID string, index int, output TxOutput) {
+		if _, spent := mp.spentBy[UTXOKey{TxID: txID, Index: index}]; spent {
+			return
+		}
+		if overlay[txID] == nil {
+			overlay[txID] = make(map[int]TxOutput)
+		}
+		overlay[txID][index] = output
+	}
+
+	for txID, outputs := range utxoSet {
+		for index, output := range outputs {
+			add(txID, index, output)
+		}
+	}
+	for txID, entry := range mp.transactions {
+		for index, output := range entry.Transaction.Outputs {
+			output.TxID = txID
+			output.Index = index
+			add(txID, index, output)
+		}
+	}
+
+	return overlay
+}
+
+// UpdateLockContext sets the block that lock times are checked against,
+// normally the block after the new chain tip. Held transactions that became
+// final move into the pool, parents before their children, and pool
+// transactions that are no longer final, after a reorganization, are held
+// again together with their pool descendants. It returns the IDs of the
+// transactions moved into the pool.
+func (mp *Mempool) UpdateLockContext(ctx LockContext) []string {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	mp.lockContext = ctx
+
+	// Descendants cannot be mined before the transactions they spend
+	demoted := make(map[string]*MempoolEntry)
+	for txID, entry := range mp.transactions {
+		if err := entry.Transaction.CheckLocks(ctx); !errors.Is(err, ErrNotFinal) {
+			continue
+		}
+		demoted[txID] = entry
+		for descendantID, descendant := range mp.descendantsLocked(txID) {
+			demoted[descendantID] = descendant
+		}
+	}
+	for txID, entry := range demoted {
+		mp.removeLocked(txID)
+		mp.holdLocked(entry)
+	}
+
+	var promoted []string
+	for progress := true; progress; {
+		progress = false
+		for txID, entry := range mp.held {
+			if entry.Transaction.CheckLocks(ctx) != nil || mp.hasHeldParentLocked(entry.Transaction) {
+				continue
+			}
+			if len(mp.conflictsLocked(entry.Transaction)) > 0 {
+				continue // Spends an output already spent in the pool
+			}
+			if err := mp.addEntryLocked(entry); err != nil {
+				continue // Pool is full, try again after the next block
+			}
+			mp.unholdLocked(txID)
+			promoted = append(promoted, txID)
+			progress = true
+		}
+	}
+
+	return promoted
+}
+
+// holdLocked holds an entry until it is final, indexing the outputs it
+// spends so conflicting transactions are detected (assumes lock is held)
+func (mp *Mempool) holdLocked(entry *MempoolEntry) {
+	tx := entry.Transaction
+	mp.held[tx.ID] = entry
+	for _, input := range tx.Inputs {
+		mp.heldSpentBy[UTXOKey{TxID: input.TxID, Index: input.Index}] = tx.ID
+	}
+}
+
+// unholdLocked removes a held entry and its index entries, reporting
+// whether it was held (assumes lock is held)
+func (mp *Mempool) unholdLocked(txID string) bool {
+	entry, exists := mp.held[txID]
+	if !exists {
+		return false
+	}
+
+	delete(mp.held, txID)
+	for _, input := range entry.Transaction.Inputs {
+		key := UTXOKey{TxID: input.TxID, Index: input.Index}
+		if mp.heldSpentBy[key] == txID {
+			delete(mp.heldSpentBy, key)
+		}
+	}
+	return true
+}
+
+// hasHeldParentLocked reports whether tx spends an output of a held
+// transaction (assumes lock is held)
+func (mp *Mempool) hasHeldParentLocked(tx *Transaction) bool {
+	for _, input := range tx.Inputs {
+		if _, held := mp.held[input.TxID]; held {
+			return true
+		}
+	}
+	return false
+}
+
 // RemoveTransaction removes a transaction from the mempool
 func (mp *Mempool) RemoveTransaction(txID string) bool {
 	mp.mu.Lock()
 	defer mp.mu.Unlock()
 
-	_, exists := mp.transactions[txID]
+	if mp.unholdLocked(txID) {
+		return true
+	}
+	return mp.removeLocked(txID)
+}
+
+// RemoveBlockTransactions removes the transactions of the block at height
+// from the mempool and reports them to the fee estimator as confirmed
+func (mp *Mempool) RemoveBlockTransactions(height int, txs []*Transaction) {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	var txIDs []string
+	for _, tx := range txs {
+		if !tx.IsCoinbase() {
+			txIDs = append(txIDs, tx.ID)
+		}
+	}
+	if mp.feeEstimator != nil {
+		mp.feeEstimator.ProcessBlock(height, txIDs)
+	}
+
+	for _, txID := range txIDs {
+		mp.unholdLocked(txID)
+		mp.removeLocked(txID)
+	}
+}
+
+// SetFeeEstimator attaches a fee estimator that tracks transactions entering
+// the pool and learns from the blocks passed to RemoveBlockTransactions
+func (mp *Mempool) SetFeeEstimator(fe *FeeEstimator) {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	mp.feeEstimator = fe
+}
+
+// removeLocked removes a pool transaction and its index entries (assumes
+// lock is held)
+func (mp *Mempool) removeLocked(txID string) bool {
+	entry, exists := mp.transactions[txID]
 	if !exists {
 		return false
 	}
 
 	// Remove from main storage
 	delete(mp.transactions, txID)
+	if mp.feeEstimator != nil {
+		mp.feeEstimator.RemoveTransaction(txID)
+	}
+
+	// Remove from outpoint index
+	for _, input := range entry.Transaction.Inputs {
+		key := UTXOKey{TxID: input.TxID, Index: input.Index}
+		if mp.spentBy[key] == txID {
+			delete(mp.spentBy, key)
+		}
+	}
 
 	// Remove from address index
 	for address, txIDs := range mp.byAddress {
@@ -228,9 +541,6 @@ func (mp *Mempool) RemoveTransaction(txID string) bool {
 		}
 	}
 
-	// Mark entry as removed in priority queue tracking
-	mp.removedEntries[txID] = true
-
 	return true
 }
 
@@ -282,48 +592,71 @@ func (mp *Mempool) GetTransactionsByFeeRate(limit int) []*Transaction {
 	return transactions
 }
 
-// GetTransactionsForBlock returns the best transactions for a new block
+// GetTransactionsForBlock returns the best transactions for a new block.
+// Transactions are chosen by the fee rate of their package: the transaction
+// together with its unconfirmed ancestors not chosen yet, so a child paying
+// a high fee pulls in a parent paying too little on its own. Parents always
+// come before their children.
 func (mp *Mempool) GetTransactionsForBlock(maxSize, maxCount int) []*Transaction {
-	mp.mu.Lock()
-	defer mp.mu.Unlock()
-
-	if len(mp.transactions) == 0 {
-		return []*Transaction{}
-	}
-
-	// Create a copy of entries for selection
-	entries := make([]*MempoolEntry, 0, len(mp.transactions))
-	for _, entry := range mp.transactions {
-		if entry.Priority >= 0 { // Skip removed entries
-			entries = append(entries, entry)
-		}
-	}
-
-	// Sort by priority (highest first)
-	sort.Slice(entries, func(i, j int) bool {
-		return entries[i].Priority > entries[j].Priority
-	})
+	mp.mu.RLock()
+	defer mp.mu.RUnlock()
 
-	// Select transactions for block
-	var selected []*Transaction
+	// Package stats are kept up to date as ancestors are selected. Updated
+	// candidates are pushed again; the outdated copies left in the heap are
+	// skipped when popped.
+	candidates, current := mp.blockCandidatesLocked()
+	selected := make(map[string]bool)
+	skipped := make(map[string]bool)
+	var transactions []*Transaction
 	var currentSize int
 
-	for _, entry := range entries {
-		// Check count limit
-		if maxCount > 0 && len(selected) >= maxCount {
-			break
+	for candidates.Len() > 0 && (maxCount <= 0 || len(transactions) < maxCount) {
+		best := heap.Pop(candidates).(*packageCandidate)
+		txID := best.entry.Transaction.ID
+		if selected[txID] || skipped[txID] || current[txID] != best {
+			continue
 		}
 
-		// Check size limit
-		if maxSize > 0 && currentSize+entry.Size > maxSize {
+		// Check count and size limits
+		if maxCount > 0 && len(transactions)+best.stats.count > maxCount {
+			skipped[txID] = true
+			continue
+		}
+		if maxSize > 0 && currentSize+best.stats.size > maxSize {
+			skipped[txID] = true
 			continue
 		}
 
-		selected = append(selected, entry.Transaction)
-		currentSize += entry.Size
+		pkg := mp.blockPackageLocked(best.entry, selected)
+		for _, member := range pkg {
+			selected[member.Transaction.ID] = true
+			transactions = append(transactions, member.Transaction)
+		}
+		currentSize += best.stats.size
+
+		// The selected transactions leave the packages of their descendants
+		updated := make(map[string]*packageCandidate)
+		for _, member := range pkg {
+			for descendantID := range mp.descendantsLocked(member.Transaction.ID) {
+				if selected[descendantID] {
+					continue
+				}
+				candidate, exists := updated[descendantID]
+				if !exists {
+					previous := current[descendantID]
+					candidate = &packageCandidate{entry: previous.entry, stats: previous.stats, order: previous.order}
+					updated[descendantID] = candidate
+				}
+				candidate.stats.remove(member)
+			}
+		}
+		for descendantID, candidate := range updated {
+			current[descendantID] = candidate
+			heap.Push(candidates, candidate)
+		}
 	}
 
-	return selected
+	return transactions
 }
 
 // ValidateAndRemoveInvalid removes invalid transactions from the mempool
@@ -331,55 +664,63 @@ func (mp *Mempool) ValidateAndRemoveInvalid(utxoSet map[string]map[int]TxOutput)
 	mp.mu.Lock()
 	defer mp.mu.Unlock()
 
-	var removed []string
-
+	invalid := make(map[string]bool)
 	for txID, entry := range mp.transactions {
-		// Basic validation
-		if err := entry.Transaction.ValidateBasic(); err != nil {
-			delete(mp.transactions, txID)
-			removed = append(removed, txID)
+		tx := entry.Transaction
+		txSize := EstimateTransactionSize(len(tx.Inputs), len(tx.Outputs))
+
+		switch {
+		case tx.ValidateBasic() != nil: // Basic validation
+		case mp.checkInputsLocked(tx, utxoSet) != nil: // Spent or unknown inputs
+		case mp.feeLocked(tx, utxoSet) <= 0: // Fee validation
+		case txSize > mp.config.MaxTxSize: // Size validation
+		case time.Since(entry.AddedAt) > mp.config.MaxAge: // Age validation
+		default:
 			continue
 		}
 
-		// Fee validation
-		if entry.Transaction.GetFee(utxoSet) <= 0 {
-			delete(mp.transactions, txID)
-			removed = append(removed, txID)
-			continue
+		// Descendants spend outputs that no longer exist
+		invalid[txID] = true
+		for descendantID := range mp.descendantsLocked(txID) {
+			invalid[descendantID] = true
 		}
+	}
 
-		// Size validation
-		txSize := EstimateTransactionSize(len(entry.Transaction.Inputs), len(entry.Transaction.Outputs))
-		if txSize > mp.config.MaxTxSize {
-			delete(mp.transactions, txID)
-			removed = append(removed, txID)
-			continue
-		}
+	var removed []string
+	for txID := range invalid {
+		mp.removeLocked(txID)
+		removed = append(removed, txID)
+	}
 
-		// Age validation
-		if time.Since(entry.AddedAt) > mp.config.MaxAge {
-			delete(mp.transactions, txID)
-			removed = append(removed, txID)
-			continue
+	// Held transactions may spend outputs of other held transactions
+	if len(mp.held) == 0 {
+		return removed
+	}
+	withHeld := make(map[string]map[int]TxOutput, len(utxoSet)+len(mp.held))
+	for txID, outputs := range utxoSet {
+		withHeld[txID] = outputs
+	}
+	for txID, entry := range mp.held {
+		outputs := make(map[int]TxOutput, len(entry.Transaction.Outputs))
+		for index, output := range entry.Transaction.Outputs {
+			outputs[index] = output
 		}
+		withHeld[txID] = outputs
 	}
 
-	// Clean up address index for removed transactions
-	for _, txID := range removed {
-		for address, txIDs := range mp.byAddress {
-			var filtered []string
-			for _, id := range txIDs {
-				if id != txID {
-					filtered = append(filtered, id)
-				}
-			}
-			if len(filtered) == 0 {
-				delete(mp.byAddress, address)
-			} else {
-				mp.byAddress[address] = filtered
+	invalidHeld := make(map[string]bool)
+	for txID, entry := range mp.held {
+		if mp.checkInputsLocked(entry.Transaction, withHeld) != nil || mp.feeLocked(entry.Transaction, withHeld) <= 0 || time.Since(entry.AddedAt) > mp.config.MaxAge {
+			invalidHeld[txID] = true
+			for descendantID := range mp.heldDescendantsLocked(txID) {
+				invalidHeld[descendantID] = true
 			}
 		}
 	}
+	for txID := range invalidHeld {
+		mp.unholdLocked(txID)
+		removed = append(removed, txID)
+	}
 
 	return removed
 }
@@ -396,9 +737,14 @@ func (mp *Mempool) GetStats() map[string]interface{} {
 		"average_fee_rate":   mp.getAverageFeeRate(),
 		"oldest_transaction": mp.getOldestTransactionAge(),
 		"newest_transaction": mp.getNewestTransactionAge(),
+		"held_transactions":  len(mp.held),
+		"replaced_transactions": mp.replaced,
 		"addresses":          len(mp.byAddress),
 		"capacity_used":      float64(len(mp.transactions)) / float64(mp.config.MaxSize) * 100,
 	}
+	if mp.persistErr != nil {
+		stats["persist_error"] = mp.persistErr.Error()
+	}
 
 	return stats
 }
@@ -410,9 +756,9 @@ func (mp *Mempool) Clear() {
 
 	mp.transactions = make(map[string]*MempoolEntry)
 	mp.byAddress = make(map[string][]string)
-	mp.removedEntries = make(map[string]bool)
-	mp.priorityQueue = &PriorityQueue{}
-	heap.Init(mp.priorityQueue)
+	mp.spentBy = make(map[UTXOKey]string)
+	mp.held = make(map[string]*MempoolEntry)
+	mp.heldSpentBy = make(map[UTXOKey]string)
 }
 
 // Size returns the number of transactions in the mempool
@@ -433,28 +779,33 @@ func (mp *Mempool) IsEmpty() bool {
 func (mp *Mempool) calculatePriority(tx *Transaction, feeRate float64) int64 {
 	txTime := time.Unix(tx.Timestamp, 0)
 	age := time.Since(txTime)
-	return int64(feeRate*1e8) + int64(age.Seconds())
+	return int64(feeRate) + int64(age.Seconds())
 }
 
-// evictLowestPriority removes the lowest priority transaction
-func (mp *Mempool) evictLowestPriority() error {
-	// Pop and skip removed entries until we find a valid one or queue is empty
-	for mp.priorityQueue.Len() > 0 {
-		entry := heap.Pop(mp.priorityQueue).(*MempoolEntry)
-		txID := entry.Transaction.ID
-
-		// Skip if this entry has been removed
-		if mp.removedEntries[txID] {
-			delete(mp.removedEntries, txID)
+// evictLocked removes the transaction whose package with its descendants
+// pays the lowest fee rate, together with those descendants. Transactions in
+// keep are not evicted. (assumes lock is held)
+func (mp *Mempool) evictLocked(keep map[string]*MempoolEntry) error {
+	var worst *MempoolEntry
+	var worstStats packageStats
+	for _, entry := range mp.sortedEntriesLocked() {
+		if _, kept := keep[entry.Transaction.ID]; kept {
 			continue
 		}
-
-		// Found a valid entry to evict
-		delete(mp.transactions, txID)
-		return nil
+		stats := mp.descendantStatsLocked(entry)
+		if worst == nil || stats.feeRate() < worstStats.feeRate() {
+			worst, worstStats = entry, stats
+		}
+	}
+	if worst == nil {
+		return fmt.Errorf("no valid transactions to evict")
 	}
 
-	return fmt.Errorf("no valid transactions to evict")
+	for txID := range mp.descendantsLocked(worst.Transaction.ID) {
+		mp.removeLocked(txID)
+	}
+	mp.removeLocked(worst.Transaction.ID)
+	return nil
 }
 
 // cleanupOldTransactions removes transactions older than MaxAge
@@ -472,7 +823,12 @@ func (mp *Mempool) cleanupOldTransactions() {
 	}
 
 	for _, txID := range toRemove {
-		delete(mp.transactions, txID)
+		mp.removeLocked(txID)
+	}
+	for txID, entry := range mp.held {
+		if entry.AddedAt.Before(cutoff) {
+			mp.unholdLocked(txID)
+		}
 	}
 }
 
@@ -485,12 +841,11 @@ func (mp *Mempool) getTotalSize() int {
 	return total
 }
 
-func (mp *Mempool) getTotalFees() float64 {
-	total := 0.0
-	// Use stored fee rate * size to calculate total fees
-	// This avoids recalculating fees without proper UTXO set
+func (mp *Mempool) getTotalFees() Amount {
+	var total Amount
+	// Use the fee stored at admission to avoid recalculating fees without the UTXO set
 	for _, entry := range mp.transactions {
-		total += entry.FeeRate * float64(entry.Size)
+		total += entry.Fee
 	}
 	return total
 }
@@ -499,7 +854,7 @@ func (mp *Mempool) getAverageFeeRate() float64 {
 	if len(mp.transactions) == 0 {
 		return 0
 	}
-	return mp.getTotalFees() / float64(mp.getTotalSize())
+	return float64(mp.getTotalFees()) / float64(mp.getTotalSize())
 }
 
 func (mp *Mempool) getOldestTransactionAge() time.Duration {
@@ -0,0 +1,447 @@
+package transactions
+
+import (
+	"container/heap"
+	"fmt"
+	"sort"
+)
+
+// maxReplacedTransactions caps the pool transactions a single replacement may
+// evict, counting descendants of the transactions it conflicts with
+const maxReplacedTransactions = 100
+
+// SignalsReplacement reports whether the transaction opts in to
+// replace-by-fee through the sequence number of any of its inputs
+func (tx *Transaction) SignalsReplacement() bool {
+	for _, input := range tx.Inputs {
+		if input.Sequence&SequenceReplaceable != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// packageStats sums the fees and sizes of a group of related transactions
+type packageStats struct {
+	fee   Amount
+	size  int
+	count int
+}
+
+func (s *packageStats) add(entry *MempoolEntry) {
+	s.fee += entry.Fee
+	s.size += entry.Size
+	s.count++
+}
+
+func (s *packageStats) remove(entry *MempoolEntry) {
+	s.fee -= entry.Fee
+	s.size -= entry.Size
+	s.count--
+}
+
+func (s packageStats) feeRate() float64 {
+	if s.size == 0 {
+		return 0
+	}
+	return float64(s.fee) / float64(s.size)
+}
+
+// packageCandidate is a pool entry considered for a block, with the stats of
+// its package: the entry and its ancestors not selected yet
+type packageCandidate struct {
+	entry *MempoolEntry
+	stats packageStats
+	order int // Position in priority order, breaking fee rate ties
+}
+
+// packageHeap orders candidates by package fee rate, highest first
+type packageHeap []*packageCandidate
+
+func (h packageHeap) Len() int { return len(h) }
+
+func (h packageHeap) Less(i, j int) bool {
+	if rateI, rateJ := h[i].stats.feeRate(), h[j].stats.feeRate(); rateI != rateJ {
+		return rateI > rateJ
+	}
+	return h[i].order < h[j].order
+}
+
+func (h packageHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *packageHeap) Push(x interface{}) { *h = append(*h, x.(*packageCandidate)) }
+
+func (h *packageHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+	return item
+}
+
+// prevOutputLocked returns the output an input spends, either confirmed in
+// utxoSet or created by a transaction in the pool (assumes lock is held)
+func (mp *Mempool) prevOutputLocked(input TxInput, utxoSet map[string]map[int]TxOutput) (TxOutput, bool) {
+	if output, exists := utxoSet[input.TxID][input.Index]; exists {
+		return output, true
+	}
+	if parent, exists := mp.transactions[input.TxID]; exists {
+		if input.Index >= 0 && input.Index < len(parent.Transaction.Outputs) {
+			return parent.Transaction.Outputs[input.Index], true
+		}
+	}
+	return TxOutput{}, false
+}
+
+// checkInputsLocked checks that every input of tx spends an output that
+// exists, confirmed or in the pool (assumes lock is held)
+func (mp *Mempool) checkInputsLocked(tx *Transaction, utxoSet map[string]map[int]TxOutput) error {
+	for i, input := range tx.Inputs {
+		if _, exists := mp.prevOutputLocked(input, utxoSet); !exists {
+			return fmt.Errorf("input %d spends unknown output %s:%d", i, input.TxID, input.Index)
+		}
+	}
+	return nil
+}
+
+// VerifyInputScripts checks that every input of tx spends an output that
+// exists, confirmed in utxoSet or created by a pool transaction, and that its
+// unlocking script satisfies that output
+func (mp *Mempool) VerifyInputScripts(tx *Transaction, utxoSet map[string]map[int]TxOutput) error {
+	mp.mu.RLock()
+	defer mp.mu.RUnlock()
+
+	if err := mp.checkInputsLocked(tx, utxoSet); err != nil {
+		return err
+	}
+	return mp.verifyScriptsLocked(tx, utxoSet)
+}
+
+// verifyScriptsLocked runs the unlocking script of every input of tx against
+// the output it spends, confirmed or in the pool (assumes lock is held and
+// the inputs exist)
+func (mp *Mempool) verifyScriptsLocked(tx *Transaction, utxoSet map[string]map[int]TxOutput) error {
+	for i, input := range tx.Inputs {
+		output, _ := mp.prevOutputLocked(input, utxoSet)
+		if err := tx.VerifyInputScript(i, output); err != nil {
+			return fmt.Errorf("input %d script verification failed: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// feeLocked returns the fee of tx, counting outputs of unconfirmed parents in
+// the pool. Like GetFee it is 0 if the outputs exceed the known inputs.
+// (assumes lock is held)
+func (mp *Mempool) feeLocked(tx *Transaction, utxoSet map[string]map[int]TxOutput) Amount {
+	var inputAmount Amount
+	for _, input := range tx.Inputs {
+		if output, exists := mp.prevOutputLocked(input, utxoSet); exists {
+			inputAmount += output.Amount
+		}
+	}
+	fee, err := inputAmount.Sub(tx.GetOutputAmount())
+	if err != nil {
+		return 0
+	}
+	return fee
+}
+
+// parentsLocked returns the pool transactions whose outputs tx spends
+// (assumes lock is held)
+func (mp *Mempool) parentsLocked(tx *Transaction) []*MempoolEntry {
+	var parents []*MempoolEntry
+	seen := make(map[string]bool)
+	for _, input := range tx.Inputs {
+		if parent, exists := mp.transactions[input.TxID]; exists && !seen[input.TxID] {
+			seen[input.TxID] = true
+			parents = append(parents, parent)
+		}
+	}
+	return parents
+}
+
+// childrenLocked returns the pool transactions spending outputs of txID
+// (assumes lock is held)
+func (mp *Mempool) childrenLocked(txID string) []*MempoolEntry {
+	parent, exists := mp.transactions[txID]
+	if !exists {
+		return nil
+	}
+
+	var children []*MempoolEntry
+	seen := make(map[string]bool)
+	for i := range parent.Transaction.Outputs {
+		childID, spent := mp.spentBy[UTXOKey{TxID: txID, Index: i}]
+		if !spent || seen[childID] {
+			continue
+		}
+		if child, exists := mp.transactions[childID]; exists {
+			seen[childID] = true
+			children = append(children, child)
+		}
+	}
+	return children
+}
+
+// ancestorsLocked returns the pool ancestors of tx, not including tx itself
+// (assumes lock is held)
+func (mp *Mempool) ancestorsLocked(tx *Transaction) map[string]*MempoolEntry {
+	ancestors := make(map[string]*MempoolEntry)
+	pending := mp.parentsLocked(tx)
+	for len(pending) > 0 {
+		entry := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if _, seen := ancestors[entry.Transaction.ID]; seen {
+			continue
+		}
+		ancestors[entry.Transaction.ID] = entry
+		pending = append(pending, mp.parentsLocked(entry.Transaction)...)
+	}
+	return ancestors
+}
+
+// descendantsLocked returns the pool descendants of txID, not including the
+// transaction itself (assumes lock is held)
+func (mp *Mempool) descendantsLocked(txID string) map[string]*MempoolEntry {
+	descendants := make(map[string]*MempoolEntry)
+	pending := mp.childrenLocked(txID)
+	for len(pending) > 0 {
+		entry := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if _, seen := descendants[entry.Transaction.ID]; seen {
+			continue
+		}
+		descendants[entry.Transaction.ID] = entry
+		pending = append(pending, mp.childrenLocked(entry.Transaction.ID)...)
+	}
+	return descendants
+}
+
+// heldDescendantsLocked returns the held transactions spending outputs of
+// txID, a pool or held transaction, directly or through other held
+// transactions (assumes lock is held)
+func (mp *Mempool) heldDescendantsLocked(txID string) map[string]*MempoolEntry {
+	descendants := make(map[string]*MempoolEntry)
+	pending := []string{txID}
+	for len(pending) > 0 {
+		parentID := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		parent, exists := mp.transactions[parentID]
+		if !exists {
+			if parent, exists = mp.held[parentID]; !exists {
+				continue
+			}
+		}
+
+		for i := range parent.Transaction.Outputs {
+			childID, spent := mp.heldSpentBy[UTXOKey{TxID: parentID, Index: i}]
+			if _, seen := descendants[childID]; !spent || seen {
+				continue
+			}
+			if child, exists := mp.held[childID]; exists {
+				descendants[childID] = child
+				pending = append(pending, childID)
+			}
+		}
+	}
+	return descendants
+}
+
+// descendantStatsLocked sums an entry with its descendants (assumes lock is
+// held)
+func (mp *Mempool) descendantStatsLocked(entry *MempoolEntry) packageStats {
+	var stats packageStats
+	stats.add(entry)
+	for _, descendant := range mp.descendantsLocked(entry.Transaction.ID) {
+		stats.add(descendant)
+	}
+	return stats
+}
+
+// conflictsLocked returns the pool and held transactions spending an output
+// that tx also spends (assumes lock is held)
+func (mp *Mempool) conflictsLocked(tx *Transaction) []*MempoolEntry {
+	var conflicts []*MempoolEntry
+	seen := make(map[string]bool)
+	for _, input := range tx.Inputs {
+		key := UTXOKey{TxID: input.TxID, Index: input.Index}
+		spender, exists := mp.transactions[mp.spentBy[key]]
+		if !exists {
+			spender, exists = mp.held[mp.heldSpentBy[key]]
+		}
+		if !exists || spender.Transaction.ID == tx.ID || seen[spender.Transaction.ID] {
+			continue
+		}
+		seen[spender.Transaction.ID] = true
+		conflicts = append(conflicts, spender)
+	}
+	return conflicts
+}
+
+// isReplaceableLocked reports whether a pool transaction or one of its pool
+// ancestors signals replace-by-fee (assumes lock is held)
+func (mp *Mempool) isReplaceableLocked(entry *MempoolEntry) bool {
+	if entry.Transaction.SignalsReplacement() {
+		return true
+	}
+	for _, ancestor := range mp.ancestorsLocked(entry.Transaction) {
+		if ancestor.Transaction.SignalsReplacement() {
+			return true
+		}
+	}
+	return false
+}
+
+// checkReplacementLocked applies the replace-by-fee rules to a transaction
+// conflicting with pool transactions and returns every transaction it would
+// evict: the conflicts and their descendants. The originals must signal
+// replacement, and the replacement must pay a higher fee rate than each of
+// them and enough fee to cover everything evicted plus its own size at the
+// minimum fee rate. It may only spend unconfirmed outputs the originals
+// already spent. (assumes lock is held)
+func (mp *Mempool) checkReplacementLocked(tx *Transaction, fee Amount, size int, conflicts []*MempoolEntry, utxoSet map[string]map[int]TxOutput) (map[string]*MempoolEntry, error) {
+	feeRate := float64(fee) / float64(size)
+	replaced := make(map[string]*MempoolEntry)
+	originalSpends := make(map[UTXOKey]bool)
+
+	for _, conflict := range conflicts {
+		if !mp.isReplaceableLocked(conflict) {
+			return nil, fmt.Errorf("transaction conflicts with %s, which does not signal replacement", conflict.Transaction.ID)
+		}
+		if feeRate <= conflict.FeeRate {
+			return nil, fmt.Errorf("replacement fee rate %.2f does not exceed %.2f of %s", feeRate, conflict.FeeRate, conflict.Transaction.ID)
+		}
+
+		replaced[conflict.Transaction.ID] = conflict
+		for txID, descendant := range mp.descendantsLocked(conflict.Transaction.ID) {
+			replaced[txID] = descendant
+		}
+		for _, input := range conflict.Transaction.Inputs {
+			originalSpends[UTXOKey{TxID: input.TxID, Index: input.Index}] = true
+		}
+	}
+
+	// Held transactions spending outputs of the evicted ones go with them
+	evicted := make([]string, 0, len(replaced))
+	for txID := range replaced {
+		evicted = append(evicted, txID)
+	}
+	for _, txID := range evicted {
+		for heldID, entry := range mp.heldDescendantsLocked(txID) {
+			replaced[heldID] = entry
+		}
+	}
+	if len(replaced) > maxReplacedTransactions {
+		return nil, fmt.Errorf("replacement would evict %d transactions, more than %d", len(replaced), maxReplacedTransactions)
+	}
+
+	for _, input := range tx.Inputs {
+		if _, replacedParent := replaced[input.TxID]; replacedParent {
+			return nil, fmt.Errorf("replacement spends an output of %s, which it replaces", input.TxID)
+		}
+		_, confirmed := utxoSet[input.TxID][input.Index]
+		if !confirmed && !originalSpends[UTXOKey{TxID: input.TxID, Index: input.Index}] {
+			return nil, fmt.Errorf("replacement spends new unconfirmed output %s:%d", input.TxID, input.Index)
+		}
+	}
+
+	var replacedFees Amount
+	for _, entry := range replaced {
+		replacedFees += entry.Fee
+	}
+	requiredFee := replacedFees + Amount(mp.config.MinFeeRate*float64(size))
+	if fee < requiredFee {
+		return nil, fmt.Errorf("replacement fee %s is below %s: the replaced fees plus its own relay fee", fee, requiredFee)
+	}
+
+	return replaced, nil
+}
+
+// blockCandidatesLocked returns a heap of every pool entry with the stats of
+// its ancestor package, and the candidates by transaction ID (assumes lock is
+// held)
+func (mp *Mempool) blockCandidatesLocked() (*packageHeap, map[string]*packageCandidate) {
+	entries := mp.sortedEntriesLocked()
+	candidates := make(packageHeap, 0, len(entries))
+	byID := make(map[string]*packageCandidate, len(entries))
+	for i, entry := range entries {
+		candidate := &packageCandidate{entry: entry, order: i}
+		candidate.stats.add(entry)
+		for _, ancestor := range mp.ancestorsLocked(entry.Transaction) {
+			candidate.stats.add(ancestor)
+		}
+		candidates = append(candidates, candidate)
+		byID[entry.Transaction.ID] = candidate
+	}
+	heap.Init(&candidates)
+	return &candidates, byID
+}
+
+// blockPackageLocked returns the entry with its ancestors that are not in
+// selected, parents before children (assumes lock is held)
+func (mp *Mempool) blockPackageLocked(entry *MempoolEntry, selected map[string]bool) []*MempoolEntry {
+	var pkg []*MempoolEntry
+	visited := make(map[string]bool)
+
+	var visit func(entry *MempoolEntry)
+	visit = func(entry *MempoolEntry) {
+		txID := entry.Transaction.ID
+		if visited[txID] || selected[txID] {
+			return
+		}
+		visited[txID] = true
+		for _, parent := range mp.parentsLocked(entry.Transaction) {
+			visit(parent)
+		}
+		pkg = append(pkg, entry)
+	}
+	visit(entry)
+	return pkg
+}
+
+// GetPackageInfo returns the ancestor and descendant package fees of a pool
+// transaction, as used for block selection and eviction
+func (mp *Mempool) GetPackageInfo(txID string) (map[string]interface{}, error) {
+	mp.mu.RLock()
+	defer mp.mu.RUnlock()
+
+	entry, exists := mp.transactions[txID]
+	if !exists {
+		return nil, fmt.Errorf("transaction %s not in mempool", txID)
+	}
+
+	var ancestors packageStats
+	ancestors.add(entry)
+	for _, ancestor := range mp.ancestorsLocked(entry.Transaction) {
+		ancestors.add(ancestor)
+	}
+	descendants := mp.descendantStatsLocked(entry)
+
+	return map[string]interface{}{
+		"fee_rate":            entry.FeeRate,
+		"ancestor_count":      ancestors.count,
+		"ancestor_fees":       ancestors.fee,
+		"ancestor_fee_rate":   ancestors.feeRate(),
+		"descendant_count":    descendants.count,
+		"descendant_fees":     descendants.fee,
+		"descendant_fee_rate": descendants.feeRate(),
+		"replaceable":         mp.isReplaceableLocked(entry),
+	}, nil
+}
+
+// sortedEntriesLocked returns the pool entries in a fixed order, highest
+// priority first (assumes lock is held)
+func (mp *Mempool) sortedEntriesLocked() []*MempoolEntry {
+	entries := make([]*MempoolEntry, 0, len(mp.transactions))
+	for _, entry := range mp.transactions {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Priority != entries[j].Priority {
+			return entries[i].Priority > entries[j].Priority
+		}
+		return entries[i].Transaction.ID < entries[j].Transaction.ID
+	})
+	return entries
+}
@@ -0,0 +1,135 @@
+package transactions
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/aliexe/blockChain/internal/encoding"
+)
+
+// mempoolFileVersion is the version of the mempool file encoding
+const mempoolFileVersion uint8 = 1
+
+// minMempoolEntrySize bounds the entry count of a mempool file: an empty
+// transaction, time and fee rate
+const minMempoolEntrySize = minTransactionSize + 1 + 8
+
+// SaveToFile writes every pool and held transaction with the time it entered
+// the mempool and its fee rate, for LoadFromFile after a restart. Parents are
+// written before their children, so they can be added in file order.
+func (mp *Mempool) SaveToFile(filename string) error {
+	mp.mu.RLock()
+	defer mp.mu.RUnlock()
+
+	return mp.saveLocked(filename)
+}
+
+// saveLocked writes the pool to filename through a temporary file, so a
+// crash never leaves a partial file behind (assumes lock is held)
+func (mp *Mempool) saveLocked(filename string) error {
+	var entries []*MempoolEntry
+	selected := make(map[string]bool)
+	for _, entry := range mp.sortedEntriesLocked() {
+		for _, member := range mp.blockPackageLocked(entry, selected) {
+			selected[member.Transaction.ID] = true
+			entries = append(entries, member)
+		}
+	}
+
+	w := encoding.NewWriter()
+	w.WriteUint8(mempoolFileVersion)
+	w.WriteUvarint(uint64(len(entries) + len(mp.held)))
+	for _, entry := range entries {
+		writeMempoolEntry(w, entry)
+	}
+	for _, entry := range mp.held {
+		writeMempoolEntry(w, entry)
+	}
+
+	dir := filepath.Dir(filename)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	file, err := os.CreateTemp(dir, filepath.Base(filename)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary mempool file: %w", err)
+	}
+	tempFile := file.Name()
+	if _, err := file.Write(w.Bytes()); err != nil {
+		file.Close()
+		os.Remove(tempFile)
+		return fmt.Errorf("failed to write mempool file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(tempFile)
+		return fmt.Errorf("failed to write mempool file: %w", err)
+	}
+	if err := os.Rename(tempFile, filename); err != nil {
+		os.Remove(tempFile)
+		return fmt.Errorf("failed to rename mempool file: %w", err)
+	}
+	return nil
+}
+
+// LoadFromFile adds the transactions saved by SaveToFile. Each transaction is
+// revalidated against utxoSet and the pool like a new one, but keeps the time
+// it first entered the mempool, so transactions older than MaxAge are
+// dropped. The saved fee rates are recomputed. It returns the number of
+// transactions added or held.
+func (mp *Mempool) LoadFromFile(filename string, utxoSet map[string]map[int]TxOutput) (int, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read mempool file: %w", err)
+	}
+
+	r := encoding.NewReader(data)
+	r.ReadVersion(mempoolFileVersion)
+	count := r.ReadCount(minMempoolEntrySize)
+	entries := make([]*MempoolEntry, 0, count)
+	for i := 0; i < count && r.Err() == nil; i++ {
+		entries = append(entries, readMempoolEntry(r))
+	}
+	if err := r.Finish(); err != nil {
+		return 0, fmt.Errorf("failed to decode mempool file: %w", err)
+	}
+
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	loaded := 0
+	for _, entry := range entries {
+		if time.Since(entry.AddedAt) > mp.config.MaxAge {
+			continue
+		}
+		if err := mp.addTransactionLocked(entry.Transaction, utxoSet, entry.AddedAt); err != nil {
+			continue // Spent, conflicting or otherwise no longer valid
+		}
+		loaded++
+	}
+	return loaded, nil
+}
+
+// writeMempoolEntry writes an entry of a mempool file
+func writeMempoolEntry(w *encoding.Writer, entry *MempoolEntry) {
+	data, _ := entry.Transaction.MarshalBinary()
+	w.WriteBytes(data)
+	w.WriteVarint(entry.AddedAt.UnixNano())
+	w.WriteUint64(math.Float64bits(entry.FeeRate))
+}
+
+// readMempoolEntry reads an entry written by writeMempoolEntry
+func readMempoolEntry(r *encoding.Reader) *MempoolEntry {
+	tx := &Transaction{}
+	if err := tx.UnmarshalBinary(r.ReadBytes()); err != nil && r.Err() == nil {
+		r.Fail(err)
+	}
+	entry := &MempoolEntry{
+		Transaction: tx,
+		AddedAt:     time.Unix(0, r.ReadVarint()),
+		FeeRate:     math.Float64frombits(r.ReadUint64()),
+	}
+	return entry
+}
@@ -2,20 +2,94 @@ package transactions
 
 import (
 	"container/heap"
+	"crypto/ecdsa"
+	"crypto/rand"
 	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/aliexe/blockChain/internal/crypto"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
-const (
-	validAddr1 = "0x1234567890123456789012345678901234567890"
-	validAddr2 = "0xabcdefabcdefabcdefabcdefabcdefabcdefabcd"
-	validAddr3 = "0x1111111111111111111111111111111111111111"
+// Addresses test outputs pay to. Their keys are in testKeys, so spends of
+// them can be signed.
+var (
+	testKeysMu sync.Mutex
+	testKeys   = make(map[string]*ecdsa.PrivateKey)
+	testAddrs  = make(map[int]string)
+
+	validAddr1 = newTestKeyAddress()
+	validAddr2 = newTestKeyAddress()
+	validAddr3 = newTestKeyAddress()
 )
 
+// newTestKeyAddress generates a key and returns its pay-to-public-key-hash
+// address
+func newTestKeyAddress() string {
+	key, err := ecdsa.GenerateKey(crypto.Secp256k1(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	keyPair, err := crypto.GetKeyPairFromPrivate(key)
+	if err != nil {
+		panic(err)
+	}
+
+	testKeysMu.Lock()
+	defer testKeysMu.Unlock()
+	testKeys[keyPair.Address] = key
+	return keyPair.Address
+}
+
+// testAddressN returns a distinct valid address for each n
+func testAddressN(n int) string {
+	testKeysMu.Lock()
+	address, exists := testAddrs[n]
+	testKeysMu.Unlock()
+	if exists {
+		return address
+	}
+
+	address = newTestKeyAddress()
+	testKeysMu.Lock()
+	defer testKeysMu.Unlock()
+	if existing, exists := testAddrs[n]; exists {
+		return existing
+	}
+	testAddrs[n] = address
+	return address
+}
+
+// signTestTx signs every input of tx with the key of the output it spends,
+// confirmed in utxoSet or created by a transaction in mp. Inputs spending
+// unknown outputs are left unsigned.
+func signTestTx(t *testing.T, mp *Mempool, tx *Transaction, utxoSet map[string]map[int]TxOutput) {
+	t.Helper()
+	mp.mu.RLock()
+	prevOutputs := make([]TxOutput, len(tx.Inputs))
+	known := make([]bool, len(tx.Inputs))
+	for i, input := range tx.Inputs {
+		prevOutputs[i], known[i] = mp.prevOutputLocked(input, utxoSet)
+	}
+	mp.mu.RUnlock()
+
+	for i, prevOutput := range prevOutputs {
+		if !known[i] {
+			continue
+		}
+		testKeysMu.Lock()
+		key, exists := testKeys[prevOutput.Address]
+		testKeysMu.Unlock()
+		require.True(t, exists, "no test key for input %d", i)
+		require.NoError(t, tx.SignTransaction(i, key, prevOutputs))
+	}
+}
+
 func TestNewMempool(t *testing.T) {
 	mp := NewMempool()
 
@@ -30,7 +104,7 @@ func TestNewMempoolWithConfig(t *testing.T) {
 	config := MempoolConfig{
 		MaxSize:         1000,
 		MaxAge:          12 * time.Hour,
-		MinFeeRate:      0.0001,
+		MinFeeRate:      10000,
 		MaxTxSize:       50000,
 		ValidateTx:      false,
 		CleanupInterval: 5 * time.Minute,
@@ -41,7 +115,7 @@ func TestNewMempoolWithConfig(t *testing.T) {
 	assert.NotNil(t, mp)
 	assert.Equal(t, 1000, mp.config.MaxSize)
 	assert.Equal(t, 12*time.Hour, mp.config.MaxAge)
-	assert.Equal(t, 0.0001, mp.config.MinFeeRate)
+	assert.Equal(t, 10000.0, mp.config.MinFeeRate)
 	assert.Equal(t, 50000, mp.config.MaxTxSize)
 	assert.False(t, mp.config.ValidateTx)
 }
@@ -50,13 +124,12 @@ func TestAddTransaction(t *testing.T) {
 	mp := NewMempool()
 
 	// Create a coinbase transaction (which has no inputs and no fee requirement)
-	tx := NewCoinbaseTransaction(validAddr1, 1.0)
-	tx.ID = "tx1"
+	tx := NewCoinbaseTransaction(validAddr1, 1.0*Coin)
 
 	// Manually add to mempool transactions to bypass fee check
 	entry := &MempoolEntry{
 		Transaction: tx,
-		FeeRate:     0.0001,
+		FeeRate:     10000,
 		Size:        100,
 		AddedAt:     time.Now(),
 		Priority:    100,
@@ -65,14 +138,13 @@ func TestAddTransaction(t *testing.T) {
 	mp.mu.Lock()
 	mp.transactions[tx.ID] = entry
 	mp.byAddress[validAddr1] = append(mp.byAddress[validAddr1], tx.ID)
-	heap.Push(mp.priorityQueue, entry)
 	mp.mu.Unlock()
 
 	assert.Equal(t, 1, mp.Size())
 	assert.False(t, mp.IsEmpty())
 
 	// Verify transaction was added
-	retrieved, exists := mp.GetTransaction("tx1")
+	retrieved, exists := mp.GetTransaction(tx.ID)
 	assert.True(t, exists)
 	assert.Equal(t, tx, retrieved)
 }
@@ -83,17 +155,17 @@ func TestAddDuplicateTransaction(t *testing.T) {
 	// Create UTXO set with referenced output
 	utxoSet := map[string]map[int]TxOutput{
 		"prev1": {
-			0: {Address: validAddr1, Amount: 2.0},
+			0: {Address: validAddr1, Amount: 2.0 * Coin},
 		},
 	}
 
 	tx := NewTransaction(
 		[]TxInput{{TxID: "prev1", Index: 0}},
-		[]TxOutput{{Address: validAddr1, Amount: 1.0}},
+		[]TxOutput{{Address: validAddr1, Amount: 1.0 * Coin}},
 	)
-	tx.ID = "tx1"
 
 	// Add first time
+	signTestTx(t, mp, tx, utxoSet)
 	err := mp.AddTransaction(tx, utxoSet)
 	assert.NoError(t, err)
 
@@ -111,7 +183,7 @@ func TestAddInvalidTransaction(t *testing.T) {
 	tx := &Transaction{
 		ID:      "",
 		Inputs:  []TxInput{{TxID: "prev1", Index: 0}},
-		Outputs: []TxOutput{{Address: validAddr1, Amount: 1.0}},
+		Outputs: []TxOutput{{Address: validAddr1, Amount: 1.0 * Coin}},
 	}
 
 	err := mp.AddTransaction(tx, make(map[string]map[int]TxOutput))
@@ -120,23 +192,189 @@ func TestAddInvalidTransaction(t *testing.T) {
 	assert.Equal(t, 0, mp.Size())
 }
 
+func TestAddTransactionWrongNetwork(t *testing.T) {
+	utxoSet := map[string]map[int]TxOutput{
+		"prev1": {
+			0: {Address: validAddr1, Amount: 2.0 * Coin},
+		},
+	}
+	testnetAddr := "tmxm1qzg69v7ys40x77y352eufp27daufrg4ncsgzdjk"
+
+	tx := NewTransaction(
+		[]TxInput{{TxID: "prev1", Index: 0}},
+		[]TxOutput{{Address: testnetAddr, Amount: 1.0 * Coin}},
+	)
+
+	mp := NewMempool()
+	signTestTx(t, mp, tx, utxoSet)
+	err := mp.AddTransaction(tx, utxoSet)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "expected mainnet")
+	assert.Equal(t, 0, mp.Size())
+
+	config := DefaultMempoolConfig()
+	config.Network = crypto.TestNet
+	mp = NewMempoolWithConfig(config)
+	assert.NoError(t, mp.AddTransaction(tx, utxoSet))
+}
+
+func TestAddTransactionHoldsUntilFinal(t *testing.T) {
+	mp := NewMempool()
+	utxoSet := map[string]map[int]TxOutput{
+		"prev1": {0: {Address: validAddr1, Amount: 2.0 * Coin}},
+		"prev2": {0: {Address: validAddr1, Amount: 2.0 * Coin}},
+	}
+
+	locked := NewTransaction(
+		[]TxInput{{TxID: "prev1", Index: 0}},
+		[]TxOutput{{Address: validAddr2, Amount: 1.0 * Coin}},
+	)
+	locked.LockTime = 10
+	locked.ID = locked.CalculateID()
+
+	relative := NewTransaction(
+		[]TxInput{{TxID: "prev2", Index: 0, Sequence: BlockSequence(5)}},
+		[]TxOutput{{Address: validAddr2, Amount: 1.0 * Coin}},
+	)
+
+	signTestTx(t, mp, locked, utxoSet)
+	require.NoError(t, mp.AddTransaction(locked, utxoSet))
+	signTestTx(t, mp, relative, utxoSet)
+	require.NoError(t, mp.AddTransaction(relative, utxoSet))
+	assert.Equal(t, 0, mp.Size())
+	assert.Len(t, mp.GetHeldTransactions(), 2)
+	assert.Equal(t, 2, mp.GetStats()["held_transactions"])
+	assert.Empty(t, mp.GetTransactionsForBlock(0, 0))
+
+	_, found := mp.GetTransaction(locked.ID)
+	assert.True(t, found)
+	err := mp.AddTransaction(locked, utxoSet)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "already held")
+
+	confirmation := func(txID string) (int, int64, bool) {
+		return 7, 0, txID == "prev2"
+	}
+
+	// Height 10 is not above the lock time, and prev2 needs 5 confirmations
+	assert.Empty(t, mp.UpdateLockContext(LockContext{Height: 10, Confirmation: confirmation}))
+	assert.Equal(t, []string{locked.ID}, mp.UpdateLockContext(LockContext{Height: 11, Confirmation: confirmation}))
+	assert.Equal(t, []string{relative.ID}, mp.UpdateLockContext(LockContext{Height: 12, Confirmation: confirmation}))
+	assert.Equal(t, 2, mp.Size())
+	assert.Empty(t, mp.GetHeldTransactions())
+
+	// A reorganization below the locks holds the transactions again
+	assert.Empty(t, mp.UpdateLockContext(LockContext{Height: 11, Confirmation: confirmation}))
+	assert.Equal(t, 1, mp.Size())
+	assert.Len(t, mp.GetHeldTransactions(), 1)
+}
+
+func TestUpdateLockContextHoldsDescendants(t *testing.T) {
+	mp := NewMempool()
+	utxoSet := map[string]map[int]TxOutput{
+		"prev1": {0: {Address: validAddr1, Amount: 2.0 * Coin}},
+	}
+
+	parent := NewTransaction(
+		[]TxInput{{TxID: "prev1", Index: 0}},
+		[]TxOutput{{Address: validAddr2, Amount: 1.9 * Coin}},
+	)
+	parent.LockTime = 10
+	parent.ID = parent.CalculateID()
+
+	assert.Empty(t, mp.UpdateLockContext(LockContext{Height: 11}))
+	signTestTx(t, mp, parent, utxoSet)
+	require.NoError(t, mp.AddTransaction(parent, utxoSet))
+
+	child := NewTransaction(
+		[]TxInput{{TxID: parent.ID, Index: 0}},
+		[]TxOutput{{Address: validAddr3, Amount: 1.8 * Coin}},
+	)
+	signTestTx(t, mp, child, utxoSet)
+	require.NoError(t, mp.AddTransaction(child, utxoSet))
+	assert.Equal(t, 2, mp.Size())
+
+	// The child cannot stay in the pool without its parent
+	assert.Empty(t, mp.UpdateLockContext(LockContext{Height: 10}))
+	assert.Equal(t, 0, mp.Size())
+	assert.Len(t, mp.GetHeldTransactions(), 2)
+
+	// The held child still finds its parent's output
+	assert.Empty(t, mp.ValidateAndRemoveInvalid(utxoSet))
+	assert.Len(t, mp.GetHeldTransactions(), 2)
+
+	assert.Equal(t, []string{parent.ID, child.ID}, mp.UpdateLockContext(LockContext{Height: 11}))
+	assert.Equal(t, 2, mp.Size())
+	assert.Empty(t, mp.GetHeldTransactions())
+}
+
+func TestReplaceHeldTransaction(t *testing.T) {
+	mp := NewMempool()
+	utxoSet := map[string]map[int]TxOutput{
+		"prev1": {0: {Address: validAddr1, Amount: 2.0 * Coin}},
+		"prev2": {0: {Address: validAddr1, Amount: 2.0 * Coin}},
+	}
+
+	held := NewTransaction(
+		[]TxInput{{TxID: "prev1", Index: 0}},
+		[]TxOutput{{Address: validAddr2, Amount: 1.9 * Coin}},
+	)
+	held.LockTime = 10
+	held.ID = held.CalculateID()
+	signTestTx(t, mp, held, utxoSet)
+	require.NoError(t, mp.AddTransaction(held, utxoSet))
+
+	conflict := NewTransaction(
+		[]TxInput{{TxID: "prev1", Index: 0}},
+		[]TxOutput{{Address: validAddr1, Amount: 1.0 * Coin}},
+	)
+	signTestTx(t, mp, conflict, utxoSet)
+	err := mp.AddTransaction(conflict, utxoSet)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "does not signal replacement")
+	assert.Equal(t, 0, mp.Size())
+
+	replaceable := NewTransaction(
+		[]TxInput{{TxID: "prev2", Index: 0, Sequence: SequenceReplaceable}},
+		[]TxOutput{{Address: validAddr2, Amount: 1.9 * Coin}},
+	)
+	replaceable.LockTime = 10
+	replaceable.ID = replaceable.CalculateID()
+	signTestTx(t, mp, replaceable, utxoSet)
+	require.NoError(t, mp.AddTransaction(replaceable, utxoSet))
+
+	replacement := NewTransaction(
+		[]TxInput{{TxID: "prev2", Index: 0}},
+		[]TxOutput{{Address: validAddr1, Amount: 1.5 * Coin}},
+	)
+	signTestTx(t, mp, replacement, utxoSet)
+	require.NoError(t, mp.AddTransaction(replacement, utxoSet))
+
+	_, exists := mp.GetTransaction(replaceable.ID)
+	assert.False(t, exists)
+	_, exists = mp.GetTransaction(held.ID)
+	assert.True(t, exists)
+	assert.Equal(t, 1, mp.Size())
+	assert.Len(t, mp.GetHeldTransactions(), 1)
+}
+
 func TestAddTransactionZeroFee(t *testing.T) {
 	mp := NewMempool()
 
 	// Create UTXO set with referenced output
 	utxoSet := map[string]map[int]TxOutput{
 		"prev1": {
-			0: {Address: validAddr1, Amount: 2.0},
+			0: {Address: validAddr1, Amount: 2.0 * Coin},
 		},
 	}
 
 	// Create transaction with zero fee (input = output)
 	tx := NewTransaction(
 		[]TxInput{{TxID: "prev1", Index: 0}},
-		[]TxOutput{{Address: validAddr1, Amount: 2.0}}, // Match input amount
+		[]TxOutput{{Address: validAddr1, Amount: 2.0 * Coin}}, // Match input amount
 	)
-	tx.ID = "tx1"
 
+	signTestTx(t, mp, tx, utxoSet)
 	err := mp.AddTransaction(tx, utxoSet)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "positive fee")
@@ -144,22 +382,22 @@ func TestAddTransactionZeroFee(t *testing.T) {
 
 func TestAddTransactionLowFeeRate(t *testing.T) {
 	config := DefaultMempoolConfig()
-	config.MinFeeRate = 0.001 // Higher minimum fee rate
+	config.MinFeeRate = 100000 // Higher minimum fee rate
 	mp := NewMempoolWithConfig(config)
 
 	// Create UTXO set with referenced output
 	utxoSet := map[string]map[int]TxOutput{
 		"prev1": {
-			0: {Address: validAddr1, Amount: 2.0},
+			0: {Address: validAddr1, Amount: 2.0 * Coin},
 		},
 	}
 
 	tx := NewTransaction(
 		[]TxInput{{TxID: "prev1", Index: 0}},
-		[]TxOutput{{Address: validAddr1, Amount: 1.9999}}, // Very low fee
+		[]TxOutput{{Address: validAddr1, Amount: 1.9999 * Coin}}, // Very low fee
 	)
-	tx.ID = "tx1"
 
+	signTestTx(t, mp, tx, utxoSet)
 	err := mp.AddTransaction(tx, utxoSet)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "below minimum")
@@ -173,16 +411,16 @@ func TestAddTransactionTooLarge(t *testing.T) {
 	// Create UTXO set with referenced output
 	utxoSet := map[string]map[int]TxOutput{
 		"prev1": {
-			0: {Address: validAddr1, Amount: 2.0},
+			0: {Address: validAddr1, Amount: 2.0 * Coin},
 		},
 	}
 
 	tx := NewTransaction(
 		[]TxInput{{TxID: "prev1", Index: 0}},
-		[]TxOutput{{Address: validAddr1, Amount: 1.0}},
+		[]TxOutput{{Address: validAddr1, Amount: 1.0 * Coin}},
 	)
-	tx.ID = "tx1"
 
+	signTestTx(t, mp, tx, utxoSet)
 	err := mp.AddTransaction(tx, utxoSet)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "exceeds maximum")
@@ -194,27 +432,27 @@ func TestRemoveTransaction(t *testing.T) {
 	// Create UTXO set with referenced output
 	utxoSet := map[string]map[int]TxOutput{
 		"prev1": {
-			0: {Address: validAddr1, Amount: 2.0},
+			0: {Address: validAddr1, Amount: 2.0 * Coin},
 		},
 	}
 
 	tx := NewTransaction(
 		[]TxInput{{TxID: "prev1", Index: 0}},
-		[]TxOutput{{Address: validAddr1, Amount: 1.0}},
+		[]TxOutput{{Address: validAddr1, Amount: 1.0 * Coin}},
 	)
-	tx.ID = "tx1"
 
 	// Add transaction
+	signTestTx(t, mp, tx, utxoSet)
 	err := mp.AddTransaction(tx, utxoSet)
 	require.NoError(t, err)
 
 	// Remove transaction
-	removed := mp.RemoveTransaction("tx1")
+	removed := mp.RemoveTransaction(tx.ID)
 	assert.True(t, removed)
 	assert.Equal(t, 0, mp.Size())
 
 	// Verify transaction is gone
-	_, exists := mp.GetTransaction("tx1")
+	_, exists := mp.GetTransaction(tx.ID)
 	assert.False(t, exists)
 
 	// Try to remove non-existent transaction
@@ -228,41 +466,41 @@ func TestGetTransactionsByAddress(t *testing.T) {
 	// Create UTXO sets
 	utxoSet1 := map[string]map[int]TxOutput{
 		"prev1": {
-			0: {Address: validAddr1, Amount: 2.0},
+			0: {Address: validAddr1, Amount: 2.0 * Coin},
 		},
 	}
 	utxoSet2 := map[string]map[int]TxOutput{
 		"prev2": {
-			0: {Address: validAddr1, Amount: 3.0},
+			0: {Address: validAddr1, Amount: 3.0 * Coin},
 		},
 	}
 	utxoSet3 := map[string]map[int]TxOutput{
 		"prev3": {
-			0: {Address: validAddr2, Amount: 2.0},
+			0: {Address: validAddr2, Amount: 2.0 * Coin},
 		},
 	}
 
 	// Add transactions for different addresses
 	tx1 := NewTransaction(
 		[]TxInput{{TxID: "prev1", Index: 0}},
-		[]TxOutput{{Address: validAddr1, Amount: 1.0}},
+		[]TxOutput{{Address: validAddr1, Amount: 1.0 * Coin}},
 	)
-	tx1.ID = "tx1"
 
 	tx2 := NewTransaction(
 		[]TxInput{{TxID: "prev2", Index: 0}},
-		[]TxOutput{{Address: validAddr1, Amount: 2.0}},
+		[]TxOutput{{Address: validAddr1, Amount: 2.0 * Coin}},
 	)
-	tx2.ID = "tx2"
 
 	tx3 := NewTransaction(
 		[]TxInput{{TxID: "prev3", Index: 0}},
-		[]TxOutput{{Address: validAddr2, Amount: 1.0}},
+		[]TxOutput{{Address: validAddr2, Amount: 1.0 * Coin}},
 	)
-	tx3.ID = "tx3"
 
+	signTestTx(t, mp, tx1, utxoSet1)
 	mp.AddTransaction(tx1, utxoSet1)
+	signTestTx(t, mp, tx2, utxoSet2)
 	mp.AddTransaction(tx2, utxoSet2)
+	signTestTx(t, mp, tx3, utxoSet3)
 	mp.AddTransaction(tx3, utxoSet3)
 
 	// Get transactions for validAddr1
@@ -284,56 +522,56 @@ func TestGetTransactionsByFeeRate(t *testing.T) {
 	// Create UTXO sets
 	utxoSet1 := map[string]map[int]TxOutput{
 		"prev1": {
-			0: {Address: validAddr1, Amount: 2.0},
+			0: {Address: validAddr1, Amount: 2.0 * Coin},
 		},
 	}
 	utxoSet2 := map[string]map[int]TxOutput{
 		"prev2": {
-			0: {Address: validAddr2, Amount: 2.0},
+			0: {Address: validAddr2, Amount: 2.0 * Coin},
 		},
 	}
 	utxoSet3 := map[string]map[int]TxOutput{
 		"prev3": {
-			0: {Address: validAddr3, Amount: 2.0},
+			0: {Address: validAddr3, Amount: 2.0 * Coin},
 		},
 	}
 
 	// Add transactions with different fee rates
 	tx1 := NewTransaction(
 		[]TxInput{{TxID: "prev1", Index: 0}},
-		[]TxOutput{{Address: validAddr1, Amount: 0.9}}, // High fee
+		[]TxOutput{{Address: validAddr1, Amount: 0.9 * Coin}}, // High fee
 	)
-	tx1.ID = "tx1"
 
 	tx2 := NewTransaction(
 		[]TxInput{{TxID: "prev2", Index: 0}},
-		[]TxOutput{{Address: validAddr2, Amount: 0.99}}, // Low fee
+		[]TxOutput{{Address: validAddr2, Amount: 0.99 * Coin}}, // Low fee
 	)
-	tx2.ID = "tx2"
 
 	tx3 := NewTransaction(
 		[]TxInput{{TxID: "prev3", Index: 0}},
-		[]TxOutput{{Address: validAddr3, Amount: 0.95}}, // Medium fee
+		[]TxOutput{{Address: validAddr3, Amount: 0.95 * Coin}}, // Medium fee
 	)
-	tx3.ID = "tx3"
 
+	signTestTx(t, mp, tx1, utxoSet1)
 	mp.AddTransaction(tx1, utxoSet1)
+	signTestTx(t, mp, tx2, utxoSet2)
 	mp.AddTransaction(tx2, utxoSet2)
+	signTestTx(t, mp, tx3, utxoSet3)
 	mp.AddTransaction(tx3, utxoSet3)
 
 	// Get all transactions sorted by fee rate
 	allTxs := mp.GetTransactionsByFeeRate(0)
 	assert.Len(t, allTxs, 3)
 	// Should be sorted by fee rate (highest first)
-	assert.Equal(t, "tx1", allTxs[0].ID)
-	assert.Equal(t, "tx3", allTxs[1].ID)
-	assert.Equal(t, "tx2", allTxs[2].ID)
+	assert.Equal(t, tx1.ID, allTxs[0].ID)
+	assert.Equal(t, tx3.ID, allTxs[1].ID)
+	assert.Equal(t, tx2.ID, allTxs[2].ID)
 
 	// Get limited number of transactions
 	limitedTxs := mp.GetTransactionsByFeeRate(2)
 	assert.Len(t, limitedTxs, 2)
-	assert.Equal(t, "tx1", limitedTxs[0].ID)
-	assert.Equal(t, "tx3", limitedTxs[1].ID)
+	assert.Equal(t, tx1.ID, limitedTxs[0].ID)
+	assert.Equal(t, tx3.ID, limitedTxs[1].ID)
 }
 
 func TestGetTransactionsForBlock(t *testing.T) {
@@ -345,14 +583,14 @@ func TestGetTransactionsForBlock(t *testing.T) {
 		txID := fmt.Sprintf("prev%d", i)
 		utxoSet := map[string]map[int]TxOutput{
 			txID: {
-				0: {Address: "0x" + fmt.Sprintf("%040d", i), Amount: 2.0},
+				0: {Address: testAddressN(i), Amount: 2.0 * Coin},
 			},
 		}
 		tx := NewTransaction(
 			[]TxInput{{TxID: txID, Index: 0}},
-			[]TxOutput{{Address: "0x" + fmt.Sprintf("%040d", i), Amount: 1.0}},
+			[]TxOutput{{Address: testAddressN(i), Amount: 1.0 * Coin}},
 		)
-		tx.ID = fmt.Sprintf("tx%d", i)
+		signTestTx(t, mp, tx, utxoSet)
 		err := mp.AddTransaction(tx, utxoSet)
 		require.NoError(t, err)
 	}
@@ -376,37 +614,35 @@ func TestValidateAndRemoveInvalid(t *testing.T) {
 	// Create UTXO set for valid transaction
 	utxoSet := map[string]map[int]TxOutput{
 		"prev1": {
-			0: {Address: "0x" + fmt.Sprintf("%040d", 0), Amount: 2.0},
+			0: {Address: testAddressN(0), Amount: 2.0 * Coin},
 		},
 	}
 
 	// Add valid transaction
 	validTx := NewTransaction(
 		[]TxInput{{TxID: "prev1", Index: 0}},
-		[]TxOutput{{Address: "0x" + fmt.Sprintf("%040d", 0), Amount: 1.0}},
+		[]TxOutput{{Address: testAddressN(0), Amount: 1.0 * Coin}},
 	)
-	validTx.ID = "valid"
 
 	// Add invalid transaction (empty ID)
 	invalidTx := &Transaction{
 		ID:      "",
 		Inputs:  []TxInput{{TxID: "prev2", Index: 0}},
-		Outputs: []TxOutput{{Address: "0x" + fmt.Sprintf("%040d", 1), Amount: 1.0}},
+		Outputs: []TxOutput{{Address: testAddressN(1), Amount: 1.0 * Coin}},
 	}
-	invalidTx.ID = "invalid"
 
 	// Add transactions directly to bypass validation
-	mp.transactions["valid"] = &MempoolEntry{
+	mp.transactions[validTx.ID] = &MempoolEntry{
 		Transaction: validTx,
-		FeeRate:     0.0001,
+		FeeRate:     10000,
 		Size:        100,
 		AddedAt:     time.Now(),
 		Priority:    100,
 	}
 
-	mp.transactions["invalid"] = &MempoolEntry{
+	mp.transactions[invalidTx.ID] = &MempoolEntry{
 		Transaction: invalidTx,
-		FeeRate:     0.0001,
+		FeeRate:     10000,
 		Size:        100,
 		AddedAt:     time.Now(),
 		Priority:    100,
@@ -414,8 +650,8 @@ func TestValidateAndRemoveInvalid(t *testing.T) {
 
 	// Validate and remove invalid
 	removed := mp.ValidateAndRemoveInvalid(utxoSet)
-	assert.Contains(t, removed, "invalid")
-	assert.NotContains(t, removed, "valid")
+	assert.Contains(t, removed, invalidTx.ID)
+	assert.NotContains(t, removed, validTx.ID)
 	assert.Equal(t, 1, mp.Size())
 }
 
@@ -428,14 +664,14 @@ func TestGetStats(t *testing.T) {
 		txID := fmt.Sprintf("prev%d", i)
 		utxoSet := map[string]map[int]TxOutput{
 			txID: {
-				0: {Address: "0x" + fmt.Sprintf("%040d", i), Amount: 2.0},
+				0: {Address: testAddressN(i), Amount: 2.0 * Coin},
 			},
 		}
 		tx := NewTransaction(
 			[]TxInput{{TxID: txID, Index: 0}},
-			[]TxOutput{{Address: "0x" + fmt.Sprintf("%040d", i), Amount: 1.0}},
+			[]TxOutput{{Address: testAddressN(i), Amount: 1.0 * Coin}},
 		)
-		tx.ID = fmt.Sprintf("tx%d", i)
+		signTestTx(t, mp, tx, utxoSet)
 		err := mp.AddTransaction(tx, utxoSet)
 		require.NoError(t, err)
 	}
@@ -444,7 +680,7 @@ func TestGetStats(t *testing.T) {
 	assert.Equal(t, 3, stats["total_transactions"])
 	assert.Greater(t, stats["total_size"], 0)
 	// Note: total_fees will be 0 with empty UTXO set, but that's expected
-	assert.GreaterOrEqual(t, stats["total_fees"].(float64), 0.0)
+	assert.GreaterOrEqual(t, stats["total_fees"].(Amount), Amount(0))
 	assert.GreaterOrEqual(t, stats["average_fee_rate"].(float64), 0.0)
 	// oldest/newest_transaction can be negative if timestamps are not set, so skip checking
 	assert.Greater(t, stats["addresses"], 0)
@@ -460,14 +696,14 @@ func TestClear(t *testing.T) {
 		txID := fmt.Sprintf("prev%d", i)
 		utxoSet := map[string]map[int]TxOutput{
 			txID: {
-				0: {Address: "0x" + fmt.Sprintf("%040d", i), Amount: 2.0},
+				0: {Address: testAddressN(i), Amount: 2.0 * Coin},
 			},
 		}
 		tx := NewTransaction(
 			[]TxInput{{TxID: txID, Index: 0}},
-			[]TxOutput{{Address: "0x" + fmt.Sprintf("%040d", i), Amount: 1.0}},
+			[]TxOutput{{Address: testAddressN(i), Amount: 1.0 * Coin}},
 		)
-		tx.ID = fmt.Sprintf("tx%d", i)
+		signTestTx(t, mp, tx, utxoSet)
 		err := mp.AddTransaction(tx, utxoSet)
 		require.NoError(t, err)
 	}
@@ -488,36 +724,36 @@ func TestPoolSizeLimit(t *testing.T) {
 	// Create UTXO sets
 	utxoSet1 := map[string]map[int]TxOutput{
 		"prev1": {
-			0: {Address: validAddr1, Amount: 2.0},
+			0: {Address: validAddr1, Amount: 2.0 * Coin},
 		},
 	}
 	utxoSet2 := map[string]map[int]TxOutput{
 		"prev2": {
-			0: {Address: validAddr2, Amount: 2.0},
+			0: {Address: validAddr2, Amount: 2.0 * Coin},
 		},
 	}
 	utxoSet3 := map[string]map[int]TxOutput{
 		"prev3": {
-			0: {Address: validAddr3, Amount: 2.0},
+			0: {Address: validAddr3, Amount: 2.0 * Coin},
 		},
 	}
 
 	// Add transactions up to limit
 	tx1 := NewTransaction(
 		[]TxInput{{TxID: "prev1", Index: 0}},
-		[]TxOutput{{Address: validAddr1, Amount: 1.0}},
+		[]TxOutput{{Address: validAddr1, Amount: 1.0 * Coin}},
 	)
-	tx1.ID = "tx1"
 
 	tx2 := NewTransaction(
 		[]TxInput{{TxID: "prev2", Index: 0}},
-		[]TxOutput{{Address: validAddr2, Amount: 1.0}},
+		[]TxOutput{{Address: validAddr2, Amount: 1.0 * Coin}},
 	)
-	tx2.ID = "tx2"
 
+	signTestTx(t, mp, tx1, utxoSet1)
 	err := mp.AddTransaction(tx1, utxoSet1)
 	assert.NoError(t, err)
 
+	signTestTx(t, mp, tx2, utxoSet2)
 	err = mp.AddTransaction(tx2, utxoSet2)
 	assert.NoError(t, err)
 	assert.Equal(t, 2, mp.Size())
@@ -525,10 +761,10 @@ func TestPoolSizeLimit(t *testing.T) {
 	// Add third transaction - should evict lowest priority
 	tx3 := NewTransaction(
 		[]TxInput{{TxID: "prev3", Index: 0}},
-		[]TxOutput{{Address: validAddr3, Amount: 1.0}},
+		[]TxOutput{{Address: validAddr3, Amount: 1.0 * Coin}},
 	)
-	tx3.ID = "tx3"
 
+	signTestTx(t, mp, tx3, utxoSet3)
 	err = mp.AddTransaction(tx3, utxoSet3)
 	assert.NoError(t, err)
 	assert.Equal(t, 2, mp.Size()) // Still at limit
@@ -597,7 +833,7 @@ func TestMempoolConcurrency(t *testing.T) {
 	// Create UTXO set
 	utxoSet := map[string]map[int]TxOutput{
 		"prev1": {
-			0: {Address: "addr1", Amount: 2.0},
+			0: {Address: "addr1", Amount: 2.0 * Coin},
 		},
 	}
 
@@ -609,9 +845,8 @@ func TestMempoolConcurrency(t *testing.T) {
 		for i := 0; i < 100; i++ {
 			tx := NewTransaction(
 				[]TxInput{{TxID: "prev1", Index: 0}},
-				[]TxOutput{{Address: "addr1", Amount: 1.0}},
+				[]TxOutput{{Address: "addr1", Amount: 1.0 * Coin}},
 			)
-			tx.ID = fmt.Sprintf("tx%d", i)
 			mp.AddTransaction(tx, utxoSet)
 		}
 		done <- true
@@ -645,21 +880,20 @@ func TestMempoolAgeBasedCleanup(t *testing.T) {
 	// Create UTXO set
 	utxoSet1 := map[string]map[int]TxOutput{
 		"prev1": {
-			0: {Address: "addr1", Amount: 2.0},
+			0: {Address: "addr1", Amount: 2.0 * Coin},
 		},
 	}
 	utxoSet2 := map[string]map[int]TxOutput{
 		"prev2": {
-			0: {Address: "addr2", Amount: 2.0},
+			0: {Address: "addr2", Amount: 2.0 * Coin},
 		},
 	}
 
 	// Add transaction
 	tx := NewTransaction(
 		[]TxInput{{TxID: "prev1", Index: 0}},
-		[]TxOutput{{Address: "addr1", Amount: 1.0}},
+		[]TxOutput{{Address: "addr1", Amount: 1.0 * Coin}},
 	)
-	tx.ID = "tx1"
 
 	mp.AddTransaction(tx, utxoSet1)
 	assert.Equal(t, 1, mp.Size())
@@ -670,9 +904,8 @@ func TestMempoolAgeBasedCleanup(t *testing.T) {
 	// Add another transaction to trigger cleanup
 	tx2 := NewTransaction(
 		[]TxInput{{TxID: "prev2", Index: 0}},
-		[]TxOutput{{Address: "addr2", Amount: 1.0}},
+		[]TxOutput{{Address: "addr2", Amount: 1.0 * Coin}},
 	)
-	tx2.ID = "tx2"
 
 	mp.AddTransaction(tx2, utxoSet2)
 
@@ -685,7 +918,7 @@ func TestDefaultMempoolConfig(t *testing.T) {
 
 	assert.Equal(t, 5000, config.MaxSize)
 	assert.Equal(t, 24*time.Hour, config.MaxAge)
-	assert.Equal(t, 0.00001, config.MinFeeRate)
+	assert.Equal(t, 1000.0, config.MinFeeRate)
 	assert.Equal(t, 100000, config.MaxTxSize)
 	assert.True(t, config.ValidateTx)
 	assert.Equal(t, 10*time.Minute, config.CleanupInterval)
@@ -696,11 +929,10 @@ func TestMempoolCalculatePriority(t *testing.T) {
 
 	tx := NewTransaction(
 		[]TxInput{{TxID: "prev1", Index: 0}},
-		[]TxOutput{{Address: "addr1", Amount: 1.0}},
+		[]TxOutput{{Address: "addr1", Amount: 1.0 * Coin}},
 	)
-	tx.ID = "tx1"
 
-	priority := mp.calculatePriority(tx, 0.0001)
+	priority := mp.calculatePriority(tx, 10000)
 	assert.Greater(t, priority, int64(0))
 }
 
@@ -712,32 +944,32 @@ func TestMempoolEviction(t *testing.T) {
 	// Create UTXO sets
 	utxoSet1 := map[string]map[int]TxOutput{
 		"prev1": {
-			0: {Address: validAddr1, Amount: 2.0},
+			0: {Address: validAddr1, Amount: 2.0 * Coin},
 		},
 	}
 	utxoSet2 := map[string]map[int]TxOutput{
 		"prev2": {
-			0: {Address: validAddr2, Amount: 2.0},
+			0: {Address: validAddr2, Amount: 2.0 * Coin},
 		},
 	}
 
 	// Add first transaction
 	tx1 := NewTransaction(
 		[]TxInput{{TxID: "prev1", Index: 0}},
-		[]TxOutput{{Address: validAddr1, Amount: 1.0}},
+		[]TxOutput{{Address: validAddr1, Amount: 1.0 * Coin}},
 	)
-	tx1.ID = "tx1"
 
+	signTestTx(t, mp, tx1, utxoSet1)
 	err := mp.AddTransaction(tx1, utxoSet1)
 	assert.NoError(t, err)
 
 	// Add second transaction - should evict first
 	tx2 := NewTransaction(
 		[]TxInput{{TxID: "prev2", Index: 0}},
-		[]TxOutput{{Address: validAddr2, Amount: 1.0}},
+		[]TxOutput{{Address: validAddr2, Amount: 1.0 * Coin}},
 	)
-	tx2.ID = "tx2"
 
+	signTestTx(t, mp, tx2, utxoSet2)
 	err = mp.AddTransaction(tx2, utxoSet2)
 	assert.NoError(t, err)
 
@@ -753,7 +985,7 @@ func TestMempoolValidationDisabled(t *testing.T) {
 	// Create UTXO set
 	utxoSet := map[string]map[int]TxOutput{
 		"prev1": {
-			0: {Address: "0x" + fmt.Sprintf("%040d", 0), Amount: 2.0},
+			0: {Address: testAddressN(0), Amount: 2.0 * Coin},
 		},
 	}
 
@@ -761,7 +993,7 @@ func TestMempoolValidationDisabled(t *testing.T) {
 	tx := &Transaction{
 		ID:      "",
 		Inputs:  []TxInput{{TxID: "prev1", Index: 0}},
-		Outputs: []TxOutput{{Address: "0x" + fmt.Sprintf("%040d", 0), Amount: 1.0}},
+		Outputs: []TxOutput{{Address: testAddressN(0), Amount: 1.0 * Coin}},
 	}
 
 	err := mp.AddTransaction(tx, utxoSet)
@@ -776,7 +1008,7 @@ func TestMempoolStatistics(t *testing.T) {
 	stats := mp.GetStats()
 	assert.Equal(t, 0, stats["total_transactions"])
 	assert.Equal(t, 0, stats["total_size"])
-	assert.Equal(t, 0.0, stats["total_fees"])
+	assert.Equal(t, Amount(0), stats["total_fees"])
 	assert.Equal(t, 0.0, stats["average_fee_rate"])
 	assert.Equal(t, time.Duration(0), stats["oldest_transaction"])
 	assert.Equal(t, time.Duration(0), stats["newest_transaction"])
@@ -789,14 +1021,14 @@ func TestMempoolStatistics(t *testing.T) {
 		txID := fmt.Sprintf("prev%d", i)
 		utxoSet := map[string]map[int]TxOutput{
 			txID: {
-				0: {Address: "0x" + fmt.Sprintf("%040d", i), Amount: 2.0},
+				0: {Address: testAddressN(i), Amount: 2.0 * Coin},
 			},
 		}
 		tx := NewTransaction(
 			[]TxInput{{TxID: txID, Index: 0}},
-			[]TxOutput{{Address: "0x" + fmt.Sprintf("%040d", i), Amount: 1.0}},
+			[]TxOutput{{Address: testAddressN(i), Amount: 1.0 * Coin}},
 		)
-		tx.ID = fmt.Sprintf("tx%d", i)
+		signTestTx(t, mp, tx, utxoSet)
 		err := mp.AddTransaction(tx, utxoSet)
 		require.NoError(t, err)
 	}
@@ -805,9 +1037,459 @@ func TestMempoolStatistics(t *testing.T) {
 	assert.Equal(t, 5, stats["total_transactions"])
 	assert.Greater(t, stats["total_size"], 0)
 	// Note: total_fees will be 0 with empty UTXO set, but that's expected
-	assert.GreaterOrEqual(t, stats["total_fees"].(float64), 0.0)
+	assert.GreaterOrEqual(t, stats["total_fees"].(Amount), Amount(0))
 	assert.GreaterOrEqual(t, stats["average_fee_rate"].(float64), 0.0)
 	// oldest/newest_transaction can be negative if timestamps are not set, so skip checking
 	assert.Greater(t, stats["addresses"], 0)
 	assert.Greater(t, stats["capacity_used"].(float64), 0.0)
 }
+
+func TestReplaceByFee(t *testing.T) {
+	mp := NewMempool()
+	utxoSet := map[string]map[int]TxOutput{
+		"prev1": {
+			0: {Address: validAddr1, Amount: 2.0 * Coin},
+		},
+	}
+
+	original := NewTransaction(
+		[]TxInput{{TxID: "prev1", Index: 0, Sequence: SequenceReplaceable}},
+		[]TxOutput{{Address: validAddr2, Amount: 1.9 * Coin}},
+	)
+	signTestTx(t, mp, original, utxoSet)
+	require.NoError(t, mp.AddTransaction(original, utxoSet))
+
+	// A child of the original is evicted together with it
+	child := NewTransaction(
+		[]TxInput{{TxID: original.ID, Index: 0}},
+		[]TxOutput{{Address: validAddr3, Amount: 1.8 * Coin}},
+	)
+	signTestTx(t, mp, child, utxoSet)
+	require.NoError(t, mp.AddTransaction(child, utxoSet))
+
+	// The replacement must pay for everything it evicts
+	cheap := NewTransaction(
+		[]TxInput{{TxID: "prev1", Index: 0}},
+		[]TxOutput{{Address: validAddr1, Amount: 1.85 * Coin}},
+	)
+	signTestTx(t, mp, cheap, utxoSet)
+	err := mp.AddTransaction(cheap, utxoSet)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "replaced fees")
+
+	replacement := NewTransaction(
+		[]TxInput{{TxID: "prev1", Index: 0}},
+		[]TxOutput{{Address: validAddr1, Amount: 1.5 * Coin}},
+	)
+	signTestTx(t, mp, replacement, utxoSet)
+	require.NoError(t, mp.AddTransaction(replacement, utxoSet))
+
+	_, exists := mp.GetTransaction(original.ID)
+	assert.False(t, exists)
+	_, exists = mp.GetTransaction(child.ID)
+	assert.False(t, exists)
+	assert.Equal(t, 1, mp.Size())
+	assert.Equal(t, 2, mp.GetStats()["replaced_transactions"])
+}
+
+func TestReplaceByFeeRequiresSignal(t *testing.T) {
+	mp := NewMempool()
+	utxoSet := map[string]map[int]TxOutput{
+		"prev1": {
+			0: {Address: validAddr1, Amount: 2.0 * Coin},
+		},
+	}
+
+	original := NewTransaction(
+		[]TxInput{{TxID: "prev1", Index: 0}},
+		[]TxOutput{{Address: validAddr2, Amount: 1.9 * Coin}},
+	)
+	signTestTx(t, mp, original, utxoSet)
+	require.NoError(t, mp.AddTransaction(original, utxoSet))
+
+	replacement := NewTransaction(
+		[]TxInput{{TxID: "prev1", Index: 0}},
+		[]TxOutput{{Address: validAddr1, Amount: 1.0 * Coin}},
+	)
+	signTestTx(t, mp, replacement, utxoSet)
+	err := mp.AddTransaction(replacement, utxoSet)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "does not signal replacement")
+
+	_, exists := mp.GetTransaction(original.ID)
+	assert.True(t, exists)
+}
+
+func TestChildPaysForParent(t *testing.T) {
+	mp := NewMempool()
+	utxoSet := map[string]map[int]TxOutput{
+		"prev1": {
+			0: {Address: validAddr1, Amount: 2.0 * Coin},
+		},
+		"prev2": {
+			0: {Address: validAddr2, Amount: 2.0 * Coin},
+		},
+	}
+
+	// The parent pays the least fee in the pool
+	parent := NewTransaction(
+		[]TxInput{{TxID: "prev1", Index: 0}},
+		[]TxOutput{{Address: validAddr1, Amount: 1.99 * Coin}},
+	)
+	signTestTx(t, mp, parent, utxoSet)
+	require.NoError(t, mp.AddTransaction(parent, utxoSet))
+
+	other := NewTransaction(
+		[]TxInput{{TxID: "prev2", Index: 0}},
+		[]TxOutput{{Address: validAddr2, Amount: 1.9 * Coin}},
+	)
+	signTestTx(t, mp, other, utxoSet)
+	require.NoError(t, mp.AddTransaction(other, utxoSet))
+
+	// Its child pays enough for both
+	child := NewTransaction(
+		[]TxInput{{TxID: parent.ID, Index: 0}},
+		[]TxOutput{{Address: validAddr3, Amount: 1.5 * Coin}},
+	)
+	signTestTx(t, mp, child, utxoSet)
+	require.NoError(t, mp.AddTransaction(child, utxoSet))
+
+	blockTxs := mp.GetTransactionsForBlock(0, 2)
+	require.Len(t, blockTxs, 2)
+	assert.Equal(t, parent.ID, blockTxs[0].ID)
+	assert.Equal(t, child.ID, blockTxs[1].ID)
+
+	info, err := mp.GetPackageInfo(parent.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, info["ancestor_count"])
+	assert.Equal(t, 2, info["descendant_count"])
+	assert.Equal(t, Amount(0.5*Coin), info["descendant_fees"])
+	assert.Equal(t, false, info["replaceable"])
+
+	_, err = mp.GetPackageInfo("missing")
+	assert.Error(t, err)
+}
+
+func TestGetTransactionsForBlockUpdatesPackages(t *testing.T) {
+	mp := NewMempool()
+	utxoSet := map[string]map[int]TxOutput{
+		"prev1": {0: {Address: validAddr1, Amount: 2.0 * Coin}},
+		"prev2": {0: {Address: validAddr2, Amount: 1.0 * Coin}},
+	}
+
+	// A cheap parent with two children paying well
+	parent := NewTransaction(
+		[]TxInput{{TxID: "prev1", Index: 0}},
+		[]TxOutput{{Address: validAddr1, Amount: 0.99 * Coin}, {Address: validAddr1, Amount: 0.99 * Coin}},
+	)
+	signTestTx(t, mp, parent, utxoSet)
+	require.NoError(t, mp.AddTransaction(parent, utxoSet))
+
+	var children []*Transaction
+	for i, amount := range []Amount{0.59 * Coin, 0.79 * Coin} {
+		child := NewTransaction(
+			[]TxInput{{TxID: parent.ID, Index: i}},
+			[]TxOutput{{Address: validAddr3, Amount: amount}},
+		)
+		signTestTx(t, mp, child, utxoSet)
+		require.NoError(t, mp.AddTransaction(child, utxoSet))
+		children = append(children, child)
+	}
+
+	other := NewTransaction(
+		[]TxInput{{TxID: "prev2", Index: 0}},
+		[]TxOutput{{Address: validAddr2, Amount: 0.85 * Coin}},
+	)
+	signTestTx(t, mp, other, utxoSet)
+	require.NoError(t, mp.AddTransaction(other, utxoSet))
+
+	// With the parent selected alongside child1, child2 alone pays a higher
+	// fee rate than other, although its package with the parent did not
+	var ids []string
+	for _, tx := range mp.GetTransactionsForBlock(0, 0) {
+		ids = append(ids, tx.ID)
+	}
+	assert.Equal(t, []string{parent.ID, children[0].ID, children[1].ID, other.ID}, ids)
+
+	// A package that does not fit is skipped, not the ones after it
+	ids = nil
+	for _, tx := range mp.GetTransactionsForBlock(0, 1) {
+		ids = append(ids, tx.ID)
+	}
+	assert.Equal(t, []string{other.ID}, ids)
+}
+
+func TestEvictionRemovesDescendants(t *testing.T) {
+	config := DefaultMempoolConfig()
+	config.MaxSize = 2
+	mp := NewMempoolWithConfig(config)
+	utxoSet := map[string]map[int]TxOutput{
+		"prev1": {
+			0: {Address: validAddr1, Amount: 2.0 * Coin},
+		},
+		"prev2": {
+			0: {Address: validAddr2, Amount: 2.0 * Coin},
+		},
+	}
+
+	parent := NewTransaction(
+		[]TxInput{{TxID: "prev1", Index: 0}},
+		[]TxOutput{{Address: validAddr1, Amount: 1.99 * Coin}},
+	)
+	signTestTx(t, mp, parent, utxoSet)
+	require.NoError(t, mp.AddTransaction(parent, utxoSet))
+
+	child := NewTransaction(
+		[]TxInput{{TxID: parent.ID, Index: 0}},
+		[]TxOutput{{Address: validAddr3, Amount: 1.97 * Coin}},
+	)
+	signTestTx(t, mp, child, utxoSet)
+	require.NoError(t, mp.AddTransaction(child, utxoSet))
+
+	// A better paying transaction evicts the parent and its child
+	better := NewTransaction(
+		[]TxInput{{TxID: "prev2", Index: 0}},
+		[]TxOutput{{Address: validAddr2, Amount: 1.0 * Coin}},
+	)
+	signTestTx(t, mp, better, utxoSet)
+	require.NoError(t, mp.AddTransaction(better, utxoSet))
+
+	assert.Equal(t, 1, mp.Size())
+	_, exists := mp.GetTransaction(child.ID)
+	assert.False(t, exists)
+}
+
+func TestMempoolChainedUnconfirmed(t *testing.T) {
+	mp := NewMempool()
+	utxoSet := map[string]map[int]TxOutput{
+		"prev1": {
+			0: {Address: validAddr1, Amount: 2.0 * Coin},
+			1: {Address: validAddr1, Amount: 1.0 * Coin},
+		},
+	}
+
+	parent := NewTransaction(
+		[]TxInput{{TxID: "prev1", Index: 0}},
+		[]TxOutput{
+			{Address: validAddr2, Amount: 1.0 * Coin},
+			{Address: validAddr1, Amount: 0.9 * Coin},
+		},
+	)
+	signTestTx(t, mp, parent, utxoSet)
+	require.NoError(t, mp.AddTransaction(parent, utxoSet))
+
+	// A child may spend an output of its unconfirmed parent
+	child := NewTransaction(
+		[]TxInput{{TxID: parent.ID, Index: 0}},
+		[]TxOutput{{Address: validAddr3, Amount: 0.9 * Coin}},
+	)
+	signTestTx(t, mp, child, utxoSet)
+	require.NoError(t, mp.AddTransaction(child, utxoSet))
+
+	// But not an output that exists nowhere
+	orphan := NewTransaction(
+		[]TxInput{{TxID: parent.ID, Index: 5}},
+		[]TxOutput{{Address: validAddr3, Amount: 0.1 * Coin}},
+	)
+	signTestTx(t, mp, orphan, utxoSet)
+	err := mp.AddTransaction(orphan, utxoSet)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown output")
+
+	spender, spent := mp.GetSpendingTransaction(parent.ID, 0)
+	assert.True(t, spent)
+	assert.Equal(t, child.ID, spender)
+	_, spent = mp.GetSpendingTransaction(parent.ID, 1)
+	assert.False(t, spent)
+
+	overlay := mp.UTXOOverlay(utxoSet)
+	assert.NotContains(t, overlay["prev1"], 0)
+	assert.Contains(t, overlay["prev1"], 1)
+	assert.NotContains(t, overlay[parent.ID], 0)
+	assert.Equal(t, Amount(0.9*Coin), overlay[parent.ID][1].Amount)
+	assert.Equal(t, Amount(0.9*Coin), overlay[child.ID][0].Amount)
+	assert.Len(t, utxoSet["prev1"], 2, "the confirmed set is not modified")
+
+	// Once the parent's input is spent elsewhere both are invalid
+	delete(utxoSet["prev1"], 0)
+	removed := mp.ValidateAndRemoveInvalid(utxoSet)
+	assert.ElementsMatch(t, []string{parent.ID, child.ID}, removed)
+	assert.True(t, mp.IsEmpty())
+	_, spent = mp.GetSpendingTransaction("prev1", 0)
+	assert.False(t, spent)
+}
+
+func TestMempoolVerifiesInputScripts(t *testing.T) {
+	mp := NewMempool()
+	utxoSet := map[string]map[int]TxOutput{
+		"prev1": {0: {Address: validAddr1, Amount: 2.0 * Coin}},
+	}
+
+	unsigned := NewTransaction(
+		[]TxInput{{TxID: "prev1", Index: 0}},
+		[]TxOutput{{Address: validAddr2, Amount: 1.0 * Coin}},
+	)
+	err := mp.AddTransaction(unsigned, utxoSet)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "script verification failed")
+
+	parent := NewTransaction(
+		[]TxInput{{TxID: "prev1", Index: 0}},
+		[]TxOutput{{Address: validAddr2, Amount: 1.0 * Coin}},
+	)
+	signTestTx(t, mp, parent, utxoSet)
+	require.NoError(t, mp.AddTransaction(parent, utxoSet))
+
+	// The output of the unconfirmed parent is only found in the pool
+	child := NewTransaction(
+		[]TxInput{{TxID: parent.ID, Index: 0}},
+		[]TxOutput{{Address: validAddr3, Amount: 0.9 * Coin}},
+	)
+	err = mp.AddTransaction(child, utxoSet)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "script verification failed")
+
+	require.NoError(t, child.SignTransaction(0, testPrivateKey, parent.Outputs))
+	assert.Error(t, mp.AddTransaction(child, utxoSet), "signed by a key not owning the output")
+
+	signTestTx(t, mp, child, utxoSet)
+	require.NoError(t, mp.AddTransaction(child, utxoSet))
+	assert.Equal(t, 2, mp.Size())
+}
+
+func TestMempoolRejectsDoubleSpend(t *testing.T) {
+	mp := NewMempool()
+	utxoSet := map[string]map[int]TxOutput{
+		"prev1": {
+			0: {Address: validAddr1, Amount: 2.0 * Coin},
+		},
+	}
+
+	first := NewTransaction(
+		[]TxInput{{TxID: "prev1", Index: 0}},
+		[]TxOutput{{Address: validAddr2, Amount: 1.0 * Coin}},
+	)
+	signTestTx(t, mp, first, utxoSet)
+	require.NoError(t, mp.AddTransaction(first, utxoSet))
+
+	second := NewTransaction(
+		[]TxInput{{TxID: "prev1", Index: 0}},
+		[]TxOutput{{Address: validAddr3, Amount: 1.5 * Coin}},
+	)
+	signTestTx(t, mp, second, utxoSet)
+	assert.Error(t, mp.AddTransaction(second, utxoSet))
+	assert.Equal(t, 1, mp.Size())
+
+	// Once the first spend leaves the pool the output is free again
+	assert.True(t, mp.RemoveTransaction(first.ID))
+	assert.NoError(t, mp.AddTransaction(second, utxoSet))
+}
+
+func TestMempoolSaveLoad(t *testing.T) {
+	mp := NewMempool()
+	utxoSet := map[string]map[int]TxOutput{
+		"prev1": {0: {Address: validAddr1, Amount: 2.0 * Coin}},
+		"prev2": {0: {Address: validAddr2, Amount: 2.0 * Coin}},
+		"prev3": {0: {Address: validAddr3, Amount: 2.0 * Coin}},
+		"prev4": {0: {Address: validAddr3, Amount: 2.0 * Coin}},
+	}
+
+	parent := NewTransaction(
+		[]TxInput{{TxID: "prev1", Index: 0}},
+		[]TxOutput{{Address: validAddr2, Amount: 1.9 * Coin}},
+	)
+	parent.ID = parent.CalculateID()
+	child := NewTransaction(
+		[]TxInput{{TxID: parent.ID, Index: 0}},
+		[]TxOutput{{Address: validAddr3, Amount: 1.0 * Coin}},
+	)
+	child.ID = child.CalculateID()
+	spent := NewTransaction(
+		[]TxInput{{TxID: "prev2", Index: 0}},
+		[]TxOutput{{Address: validAddr1, Amount: 1.0 * Coin}},
+	)
+	spent.ID = spent.CalculateID()
+	expired := NewTransaction(
+		[]TxInput{{TxID: "prev3", Index: 0}},
+		[]TxOutput{{Address: validAddr1, Amount: 1.0 * Coin}},
+	)
+	expired.ID = expired.CalculateID()
+	held := NewTransaction(
+		[]TxInput{{TxID: "prev4", Index: 0}},
+		[]TxOutput{{Address: validAddr1, Amount: 1.0 * Coin}},
+	)
+	held.LockTime = 100
+	held.ID = held.CalculateID()
+
+	for _, tx := range []*Transaction{parent, child, spent, expired, held} {
+		signTestTx(t, mp, tx, utxoSet)
+		require.NoError(t, mp.AddTransaction(tx, utxoSet))
+	}
+	addedAt := time.Now().Add(-time.Hour).Round(0)
+	mp.mu.Lock()
+	mp.transactions[parent.ID].AddedAt = addedAt
+	mp.transactions[expired.ID].AddedAt = time.Now().Add(-48 * time.Hour)
+	mp.mu.Unlock()
+
+	filename := filepath.Join(t.TempDir(), "data", "mempool.dat")
+	require.NoError(t, mp.SaveToFile(filename))
+
+	// Outputs spent while the node was down are no longer available
+	delete(utxoSet, "prev2")
+
+	loaded := NewMempool()
+	count, err := loaded.LoadFromFile(filename, utxoSet)
+	require.NoError(t, err)
+	assert.Equal(t, 3, count)
+	assert.Equal(t, 2, loaded.Size())
+	assert.Len(t, loaded.GetHeldTransactions(), 1)
+
+	_, exists := loaded.GetTransaction(child.ID)
+	assert.True(t, exists, "children are loaded after their parents")
+	_, exists = loaded.GetTransaction(spent.ID)
+	assert.False(t, exists)
+	_, exists = loaded.GetTransaction(expired.ID)
+	assert.False(t, exists)
+
+	loaded.mu.RLock()
+	assert.True(t, addedAt.Equal(loaded.transactions[parent.ID].AddedAt))
+	assert.Equal(t, mp.transactions[child.ID].FeeRate, loaded.transactions[child.ID].FeeRate)
+	loaded.mu.RUnlock()
+
+	// Loading again adds nothing new
+	count, err = loaded.LoadFromFile(filename, utxoSet)
+	require.NoError(t, err)
+	assert.Equal(t, 0, count)
+
+	require.NoError(t, os.WriteFile(filename, []byte{0xff}, 0644))
+	_, err = loaded.LoadFromFile(filename, utxoSet)
+	assert.Error(t, err)
+	_, err = loaded.LoadFromFile(filepath.Join(t.TempDir(), "missing.dat"), utxoSet)
+	assert.Error(t, err)
+}
+
+func TestMempoolPersistOnStop(t *testing.T) {
+	config := DefaultMempoolConfig()
+	config.PersistPath = filepath.Join(t.TempDir(), "mempool.dat")
+	mp := NewMempoolWithConfig(config)
+	utxoSet := map[string]map[int]TxOutput{
+		"prev1": {0: {Address: validAddr1, Amount: 2.0 * Coin}},
+	}
+
+	tx := NewTransaction(
+		[]TxInput{{TxID: "prev1", Index: 0}},
+		[]TxOutput{{Address: validAddr2, Amount: 1.0 * Coin}},
+	)
+	tx.ID = tx.CalculateID()
+	signTestTx(t, mp, tx, utxoSet)
+	require.NoError(t, mp.AddTransaction(tx, utxoSet))
+
+	mp.Start()
+	mp.Stop()
+	assert.NotContains(t, mp.GetStats(), "persist_error")
+
+	restarted := NewMempoolWithConfig(config)
+	count, err := restarted.LoadFromFile(config.PersistPath, utxoSet)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
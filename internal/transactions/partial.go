@@ -0,0 +1,441 @@
+package transactions
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"sort"
+
+	"github.com/aliexe/blockChain/internal/crypto"
+	"github.com/aliexe/blockChain/internal/encoding"
+)
+
+// PartialTransactionVersion is the version of the partially-signed
+// transaction encoding
+const PartialTransactionVersion uint8 = 1
+
+// partialTransactionMagic starts every encoded partially-signed transaction
+var partialTransactionMagic = []byte("mxpt")
+
+// PartialTransaction is a transaction being signed by several parties. It
+// carries the outputs its inputs spend and the signatures collected so far,
+// so every signer can check what they sign and copies signed by different
+// parties can be merged. Finalize turns it into a transaction ready for
+// broadcast once enough signatures are collected.
+type PartialTransaction struct {
+	Transaction *Transaction
+	Inputs      []PartialInput
+}
+
+// PartialInput holds what is needed to unlock one input
+type PartialInput struct {
+	PrevOutput   TxOutput
+	RedeemScript Script            // Needed for pay-to-script-hash outputs
+	Signatures   map[string][]byte // Hex compressed public key -> signature
+}
+
+// NewPartialTransaction starts signing tx, whose inputs spend prevOutputs.
+// Any signatures or unlocking scripts already on tx are dropped.
+func NewPartialTransaction(tx *Transaction, prevOutputs []TxOutput) (*PartialTransaction, error) {
+	if len(prevOutputs) != len(tx.Inputs) {
+		return nil, fmt.Errorf("got %d spent outputs for %d inputs", len(prevOutputs), len(tx.Inputs))
+	}
+	if tx.IsCoinbase() {
+		return nil, fmt.Errorf("coinbase transactions are not signed")
+	}
+
+	unsigned := tx.CloneTransaction()
+	for i := range unsigned.Inputs {
+		unsigned.Inputs[i].Signature = ""
+		unsigned.Inputs[i].PublicKey = ""
+		unsigned.Inputs[i].Script = ""
+	}
+	unsigned.ID = unsigned.CalculateID()
+
+	p := &PartialTransaction{Transaction: unsigned}
+	for _, prevOutput := range prevOutputs {
+		p.Inputs = append(p.Inputs, PartialInput{
+			PrevOutput: prevOutput,
+			Signatures: make(map[string][]byte),
+		})
+	}
+	return p, nil
+}
+
+// AddInput adds an input spending prevOutput. Signatures that committed to
+// the previous set of inputs no longer verify and are dropped.
+func (p *PartialTransaction) AddInput(input TxInput, prevOutput TxOutput) {
+	input.Signature, input.PublicKey, input.Script = "", "", ""
+	p.Transaction.Inputs = append(p.Transaction.Inputs, input)
+	p.Inputs = append(p.Inputs, PartialInput{
+		PrevOutput: prevOutput,
+		Signatures: make(map[string][]byte),
+	})
+	p.refresh()
+}
+
+// AddOutput adds an output. Signatures that committed to the previous set of
+// outputs no longer verify and are dropped.
+func (p *PartialTransaction) AddOutput(output TxOutput) {
+	output.Index = len(p.Transaction.Outputs)
+	p.Transaction.Outputs = append(p.Transaction.Outputs, output)
+	p.refresh()
+}
+
+// refresh recalculates the transaction ID after a change and drops the
+// signatures it invalidated
+func (p *PartialTransaction) refresh() {
+	p.Transaction.ID = p.Transaction.CalculateID()
+	for i := range p.Transaction.Outputs {
+		p.Transaction.Outputs[i].TxID = p.Transaction.ID
+	}
+	for i, input := range p.Inputs {
+		for publicKey, signature := range input.Signatures {
+			if p.checkSignature(i, publicKey, signature) != nil {
+				delete(input.Signatures, publicKey)
+			}
+		}
+	}
+}
+
+// SetRedeemScript sets the redeem script of an input spending a
+// pay-to-script-hash output. It must hash to the output's address.
+func (p *PartialTransaction) SetRedeemScript(inputIndex int, redeemScript Script) error {
+	if inputIndex < 0 || inputIndex >= len(p.Inputs) {
+		return fmt.Errorf("input index %d out of range", inputIndex)
+	}
+	locking, err := p.Inputs[inputIndex].PrevOutput.LockingScript()
+	if err != nil {
+		return fmt.Errorf("input %d: %w", inputIndex, err)
+	}
+	if !bytes.Equal(locking, PayToScriptHashScript(crypto.Hash160(redeemScript))) {
+		return fmt.Errorf("redeem script does not match the address of input %d", inputIndex)
+	}
+	p.Inputs[inputIndex].RedeemScript = append(Script{}, redeemScript...)
+	return nil
+}
+
+// CanSign reports whether a signature by publicKey helps unlock an input
+func (p *PartialTransaction) CanSign(inputIndex int, publicKey *ecdsa.PublicKey) bool {
+	template, err := p.signerTemplate(inputIndex)
+	return err == nil && template.canSign(crypto.CompressPublicKey(publicKey))
+}
+
+// Sign adds a signature of an input, committing to the parts of the
+// transaction selected by hashType
+func (p *PartialTransaction) Sign(inputIndex int, privateKey *ecdsa.PrivateKey, hashType SigHashType) error {
+	if !p.CanSign(inputIndex, &privateKey.PublicKey) {
+		return fmt.Errorf("key cannot sign input %d", inputIndex)
+	}
+
+	signature, err := p.Transaction.CreateInputSignature(inputIndex, privateKey, p.Inputs[inputIndex].PrevOutput, hashType)
+	if err != nil {
+		return err
+	}
+	publicKey := hex.EncodeToString(crypto.CompressPublicKey(&privateKey.PublicKey))
+	p.Inputs[inputIndex].Signatures[publicKey] = signature
+	return nil
+}
+
+// Merge adds the redeem scripts and signatures of another copy of the same
+// transaction. Signatures that do not verify are rejected.
+func (p *PartialTransaction) Merge(other *PartialTransaction) error {
+	if p.Transaction.CalculateID() != other.Transaction.CalculateID() {
+		return fmt.Errorf("cannot merge different transactions")
+	}
+
+	for i := range p.Inputs {
+		input, otherInput := &p.Inputs[i], other.Inputs[i]
+		if input.PrevOutput != otherInput.PrevOutput {
+			return fmt.Errorf("input %d spends a different output", i)
+		}
+
+		if len(otherInput.RedeemScript) > 0 {
+			if len(input.RedeemScript) > 0 && !bytes.Equal(input.RedeemScript, otherInput.RedeemScript) {
+				return fmt.Errorf("input %d has conflicting redeem scripts", i)
+			}
+			if err := p.SetRedeemScript(i, otherInput.RedeemScript); err != nil {
+				return err
+			}
+		}
+
+		for publicKey, signature := range otherInput.Signatures {
+			if _, exists := input.Signatures[publicKey]; exists {
+				continue
+			}
+			if err := p.checkSignature(i, publicKey, signature); err != nil {
+				return fmt.Errorf("input %d: %w", i, err)
+			}
+			input.Signatures[publicKey] = signature
+		}
+	}
+	return nil
+}
+
+// IsComplete reports whether every input has the signatures it needs
+func (p *PartialTransaction) IsComplete() bool {
+	_, err := p.Finalize()
+	return err == nil
+}
+
+// Finalize builds the unlocking script of every input from the collected
+// signatures and returns the signed transaction. The partial transaction is
+// left unchanged.
+func (p *PartialTransaction) Finalize() (*Transaction, error) {
+	tx := p.Transaction.CloneTransaction()
+
+	for i, input := range p.Inputs {
+		template, err := p.signerTemplate(i)
+		if err != nil {
+			return nil, err
+		}
+		items, err := template.unlockingItems(input.Signatures)
+		if err != nil {
+			return nil, fmt.Errorf("input %d: %w", i, err)
+		}
+
+		if len(input.RedeemScript) > 0 {
+			items = append(items, input.RedeemScript)
+			if err := tx.SetUnlockingScript(i, NewUnlockingScript(items...)); err != nil {
+				return nil, err
+			}
+		} else {
+			tx.Inputs[i].Signature = hex.EncodeToString(items[0])
+			tx.Inputs[i].PublicKey = hex.EncodeToString(items[1])
+		}
+	}
+
+	for i, input := range p.Inputs {
+		if err := tx.VerifyInputScript(i, input.PrevOutput); err != nil {
+			return nil, fmt.Errorf("input %d: %w", i, err)
+		}
+	}
+	return tx, nil
+}
+
+// checkSignature verifies a collected signature of an input
+func (p *PartialTransaction) checkSignature(inputIndex int, publicKey string, signature []byte) error {
+	keyBytes, err := hex.DecodeString(publicKey)
+	if err != nil {
+		return fmt.Errorf("invalid public key: %w", err)
+	}
+	engine := &scriptEngine{tx: p.Transaction, inputIndex: inputIndex, prevOutput: p.Inputs[inputIndex].PrevOutput}
+	if !engine.checkSig(signature, keyBytes) {
+		return fmt.Errorf("invalid signature by %s", publicKey)
+	}
+	return nil
+}
+
+// signerTemplate returns who must sign an input
+func (p *PartialTransaction) signerTemplate(inputIndex int) (*signerTemplate, error) {
+	if inputIndex < 0 || inputIndex >= len(p.Inputs) {
+		return nil, fmt.Errorf("input index %d out of range", inputIndex)
+	}
+	input := p.Inputs[inputIndex]
+
+	locking, err := input.PrevOutput.LockingScript()
+	if err != nil {
+		return nil, fmt.Errorf("input %d: %w", inputIndex, err)
+	}
+	if !isPayToScriptHash(locking) {
+		return matchSignerTemplate(locking)
+	}
+	if len(input.RedeemScript) == 0 {
+		return nil, fmt.Errorf("input %d needs its redeem script", inputIndex)
+	}
+	return matchSignerTemplate(input.RedeemScript)
+}
+
+// signerTemplate describes the signatures a script needs: one by the key
+// with pubKeyHash, or required of keys in key order
+type signerTemplate struct {
+	pubKeyHash []byte
+	required   int
+	keys       [][]byte
+}
+
+// matchSignerTemplate recognizes pay-to-public-key-hash and multisig
+// scripts, optionally behind lock time checks
+func matchSignerTemplate(script Script) (*signerTemplate, error) {
+	ops, err := parseScript(script)
+	if err != nil {
+		return nil, err
+	}
+	for len(ops) >= 3 && ops[2].opcode == OpDrop &&
+		(ops[1].opcode == OpCheckLockTimeVerify || ops[1].opcode == OpCheckSequenceVerify) {
+		ops = ops[3:]
+	}
+
+	if len(ops) == 5 && ops[0].opcode == OpDup && ops[1].opcode == OpHash160 &&
+		len(ops[2].data) == crypto.AddressSize && ops[3].opcode == OpEqualVerify && ops[4].opcode == OpCheckSig {
+		return &signerTemplate{pubKeyHash: ops[2].data}, nil
+	}
+
+	if len(ops) >= 4 && ops[len(ops)-1].opcode == OpCheckMultiSig {
+		required, requiredOK := smallScriptNumber(ops[0])
+		count, countOK := smallScriptNumber(ops[len(ops)-2])
+		keyOps := ops[1 : len(ops)-2]
+		if requiredOK && countOK && count == len(keyOps) && required >= 1 && required <= count {
+			template := &signerTemplate{required: required}
+			for _, op := range keyOps {
+				if len(op.data) != crypto.PublicKeySize {
+					return nil, fmt.Errorf("multisig script has an invalid public key")
+				}
+				template.keys = append(template.keys, op.data)
+			}
+			return template, nil
+		}
+	}
+
+	return nil, fmt.Errorf("cannot sign script %s", script)
+}
+
+// smallScriptNumber returns the number pushed by an opcode, if any
+func smallScriptNumber(op scriptOp) (int, bool) {
+	if op.opcode >= Op1 && op.opcode <= Op16 {
+		return int(op.opcode-Op1) + 1, true
+	}
+	if op.data == nil {
+		return 0, false
+	}
+	n, err := parseScriptNum(op.data, 4)
+	return int(n), err == nil
+}
+
+// canSign reports whether publicKey is one of the signers
+func (t *signerTemplate) canSign(publicKey []byte) bool {
+	if t.pubKeyHash != nil {
+		return bytes.Equal(crypto.Hash160(publicKey), t.pubKeyHash)
+	}
+	for _, key := range t.keys {
+		if bytes.Equal(key, publicKey) {
+			return true
+		}
+	}
+	return false
+}
+
+// unlockingItems returns the items the unlocking script pushes before any
+// redeem script
+func (t *signerTemplate) unlockingItems(signatures map[string][]byte) ([][]byte, error) {
+	if t.pubKeyHash != nil {
+		for publicKey, signature := range signatures {
+			keyBytes, err := hex.DecodeString(publicKey)
+			if err == nil && t.canSign(keyBytes) {
+				return [][]byte{signature, keyBytes}, nil
+			}
+		}
+		return nil, fmt.Errorf("missing signature")
+	}
+
+	var items [][]byte
+	for _, key := range t.keys {
+		if signature, exists := signatures[hex.EncodeToString(key)]; exists {
+			items = append(items, signature)
+			if len(items) == t.required {
+				return items, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("has %d of %d signatures", len(items), t.required)
+}
+
+// MarshalBinary encodes the partial transaction
+func (p *PartialTransaction) MarshalBinary() ([]byte, error) {
+	txData, err := p.Transaction.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	w := encoding.NewWriter()
+	w.WriteBytes(partialTransactionMagic)
+	w.WriteUint8(PartialTransactionVersion)
+	w.WriteBytes(txData)
+	for _, input := range p.Inputs {
+		input.PrevOutput.encode(w)
+		w.WriteBytes(input.RedeemScript)
+
+		publicKeys := make([]string, 0, len(input.Signatures))
+		for publicKey := range input.Signatures {
+			publicKeys = append(publicKeys, publicKey)
+		}
+		sort.Strings(publicKeys)
+		w.WriteUvarint(uint64(len(publicKeys)))
+		for _, publicKey := range publicKeys {
+			w.WriteString(publicKey)
+			w.WriteBytes(input.Signatures[publicKey])
+		}
+	}
+	return w.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a partial transaction produced by MarshalBinary.
+// Collected signatures are verified.
+func (p *PartialTransaction) UnmarshalBinary(data []byte) error {
+	r := encoding.NewReader(data)
+	if magic := r.ReadBytes(); r.Err() == nil && !bytes.Equal(magic, partialTransactionMagic) {
+		return fmt.Errorf("not a partially-signed transaction")
+	}
+	r.ReadVersion(PartialTransactionVersion)
+
+	var decoded PartialTransaction
+	decoded.Transaction = &Transaction{}
+	txData := r.ReadBytes()
+	if r.Err() == nil {
+		if err := decoded.Transaction.UnmarshalBinary(txData); err != nil {
+			return err
+		}
+	}
+
+	decoded.Inputs = make([]PartialInput, len(decoded.Transaction.Inputs))
+	for i := range decoded.Inputs {
+		input := &decoded.Inputs[i]
+		input.PrevOutput.decode(r)
+		if redeemScript := r.ReadBytes(); len(redeemScript) > 0 {
+			input.RedeemScript = redeemScript
+		}
+		input.Signatures = make(map[string][]byte)
+		for count := r.ReadCount(2); count > 0; count-- {
+			publicKey := r.ReadString()
+			input.Signatures[publicKey] = r.ReadBytes()
+		}
+	}
+	if err := r.Finish(); err != nil {
+		return fmt.Errorf("failed to decode partial transaction: %w", err)
+	}
+
+	for i, input := range decoded.Inputs {
+		for publicKey, signature := range input.Signatures {
+			if err := decoded.checkSignature(i, publicKey, signature); err != nil {
+				return fmt.Errorf("input %d: %w", i, err)
+			}
+		}
+	}
+	*p = decoded
+	return nil
+}
+
+// Encode returns the partial transaction as base64 text for passing between
+// signers
+func (p *PartialTransaction) Encode() (string, error) {
+	data, err := p.MarshalBinary()
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(data), nil
+}
+
+// DecodePartialTransaction decodes the text produced by Encode
+func DecodePartialTransaction(text string) (*PartialTransaction, error) {
+	data, err := base64.StdEncoding.DecodeString(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid partial transaction encoding: %w", err)
+	}
+	var p PartialTransaction
+	if err := p.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
@@ -0,0 +1,133 @@
+package transactions
+
+import (
+	"crypto/ecdsa"
+	"testing"
+
+	"github.com/aliexe/blockChain/internal/crypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPartialTransactionMultiSig(t *testing.T) {
+	keys := newScriptTestKeys(t, 4)
+	redeemScript, err := MultiSigScript(2, []*ecdsa.PublicKey{&keys[0].PublicKey, &keys[1].PublicKey, &keys[2].PublicKey})
+	require.NoError(t, err)
+	escrowAddress, err := ScriptAddress(crypto.MainNet, redeemScript)
+	require.NoError(t, err)
+
+	utxoSet := NewUTXOSet()
+	require.NoError(t, utxoSet.Add("escrow", 0, TxOutput{Address: escrowAddress, Amount: 5 * Coin}))
+	require.NoError(t, utxoSet.Add("change", 0, TxOutput{Address: keyAddress(t, keys[3]), Amount: 2 * Coin}))
+	prevOutputs := make([]TxOutput, 2)
+	prevOutputs[0], err = utxoSet.Get("escrow", 0)
+	require.NoError(t, err)
+	prevOutputs[1], err = utxoSet.Get("change", 0)
+	require.NoError(t, err)
+
+	tx := NewTransaction(
+		[]TxInput{{TxID: "escrow", Index: 0}, {TxID: "change", Index: 0}},
+		[]TxOutput{{Address: testAddress, Amount: 6 * Coin}},
+	)
+	p, err := NewPartialTransaction(tx, prevOutputs)
+	require.NoError(t, err)
+	require.NoError(t, p.SetRedeemScript(0, redeemScript))
+	assert.Error(t, p.SetRedeemScript(1, redeemScript), "redeem script must match the address")
+
+	encoded, err := p.Encode()
+	require.NoError(t, err)
+
+	// Each signer works on their own copy
+	sign := func(key *ecdsa.PrivateKey, inputIndex int) *PartialTransaction {
+		signer, err := DecodePartialTransaction(encoded)
+		require.NoError(t, err)
+		require.NoError(t, signer.Sign(inputIndex, key, SigHashAll))
+		return signer
+	}
+	first := sign(keys[0], 0)
+	third := sign(keys[2], 0)
+	owner := sign(keys[3], 1)
+
+	assert.Error(t, first.Sign(1, keys[0], SigHashAll), "key is not a signer of input 1")
+	assert.False(t, first.IsComplete())
+
+	require.NoError(t, first.Merge(owner))
+	assert.False(t, first.IsComplete(), "multisig input has one of two signatures")
+	require.NoError(t, first.Merge(third))
+	assert.True(t, first.IsComplete())
+
+	// Merged copies survive encoding
+	encoded, err = first.Encode()
+	require.NoError(t, err)
+	merged, err := DecodePartialTransaction(encoded)
+	require.NoError(t, err)
+
+	signed, err := merged.Finalize()
+	require.NoError(t, err)
+	assert.NoError(t, utxoSet.ValidateTransaction(signed))
+}
+
+func TestPartialTransactionAnyoneCanPay(t *testing.T) {
+	keys := newScriptTestKeys(t, 2)
+	prevOutputs := []TxOutput{
+		{Address: keyAddress(t, keys[0]), Amount: 3 * Coin},
+		{Address: keyAddress(t, keys[1]), Amount: 3 * Coin},
+	}
+
+	// The first backer pledges to the goal and lets others add inputs
+	tx := NewTransaction(
+		[]TxInput{{TxID: "backer1", Index: 0}},
+		[]TxOutput{{Address: testAddress, Amount: 5 * Coin}},
+	)
+	p, err := NewPartialTransaction(tx, prevOutputs[:1])
+	require.NoError(t, err)
+	require.NoError(t, p.Sign(0, keys[0], SigHashAll|SigHashAnyoneCanPay))
+
+	p.AddInput(TxInput{TxID: "backer2", Index: 0}, prevOutputs[1])
+	assert.Len(t, p.Inputs[0].Signatures, 1, "pledge survives added inputs")
+	require.NoError(t, p.Sign(1, keys[1], SigHashAll|SigHashAnyoneCanPay))
+
+	signed, err := p.Finalize()
+	require.NoError(t, err)
+	assert.Equal(t, signed.CalculateID(), signed.ID)
+
+	// Changing the goal invalidates every pledge
+	p.AddOutput(TxOutput{Address: testAddress2, Amount: Coin})
+	assert.Empty(t, p.Inputs[0].Signatures)
+	assert.Empty(t, p.Inputs[1].Signatures)
+}
+
+func TestPartialTransactionRejectsInvalidSignatures(t *testing.T) {
+	keys := newScriptTestKeys(t, 1)
+	prevOutput := TxOutput{Address: keyAddress(t, keys[0]), Amount: 2 * Coin}
+	tx := NewTransaction(
+		[]TxInput{{TxID: "prev", Index: 0}},
+		[]TxOutput{{Address: testAddress, Amount: Coin}},
+	)
+
+	p, err := NewPartialTransaction(tx, []TxOutput{prevOutput})
+	require.NoError(t, err)
+	other, err := NewPartialTransaction(tx, []TxOutput{prevOutput})
+	require.NoError(t, err)
+	require.NoError(t, other.Sign(0, keys[0], SigHashAll))
+
+	// Corrupted signatures are rejected when merging and decoding
+	for publicKey := range other.Inputs[0].Signatures {
+		other.Inputs[0].Signatures[publicKey][10] ^= 0xff
+	}
+	assert.Error(t, p.Merge(other))
+	encoded, err := other.Encode()
+	require.NoError(t, err)
+	_, err = DecodePartialTransaction(encoded)
+	assert.Error(t, err)
+
+	different, err := NewPartialTransaction(NewTransaction(
+		[]TxInput{{TxID: "prev", Index: 0}},
+		[]TxOutput{{Address: testAddress2, Amount: Coin}},
+	), []TxOutput{prevOutput})
+	require.NoError(t, err)
+	assert.Error(t, p.Merge(different))
+
+	_, err = DecodePartialTransaction("bm90IGEgdHJhbnNhY3Rpb24=")
+	assert.Error(t, err)
+}
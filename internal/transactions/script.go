@@ -0,0 +1,796 @@
+package transactions
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+
+	"github.com/aliexe/blockChain/internal/crypto"
+)
+
+// Script is a program for the stack-based script language. Every output is
+// locked by a script, and an input spends it by providing an unlocking script
+// that leaves a true value on the stack once both have run.
+type Script []byte
+
+// Opcodes of the script language. Values match Bitcoin's opcodes of the same
+// name. Opcodes 0x01 to 0x4b push that many following bytes.
+const (
+	Op0                   byte = 0x00 // Push an empty item (false)
+	OpPushData1           byte = 0x4c // Push up to 255 bytes; length in the next byte
+	OpPushData2           byte = 0x4d // Push up to 65535 bytes; little-endian length in the next 2 bytes
+	Op1Negate             byte = 0x4f // Push -1
+	Op1                   byte = 0x51 // Op1 to Op16 push the numbers 1 to 16
+	Op16                  byte = 0x60
+	OpVerify              byte = 0x69 // Fail unless the top item is true
+	OpDrop                byte = 0x75 // Remove the top item
+	OpDup                 byte = 0x76 // Duplicate the top item
+	OpEqual               byte = 0x87 // Replace the top two items with whether they are equal
+	OpEqualVerify         byte = 0x88 // OpEqual then OpVerify
+	OpHash160             byte = 0xa9 // Replace the top item with its crypto.Hash160
+	OpCheckSig            byte = 0xac // Check a signature against a public key
+	OpCheckSigVerify      byte = 0xad // OpCheckSig then OpVerify
+	OpCheckMultiSig       byte = 0xae // Check m signatures against n public keys
+	OpCheckMultiSigVerify byte = 0xaf // OpCheckMultiSig then OpVerify
+	OpCheckLockTimeVerify byte = 0xb1 // Fail unless the transaction lock time has reached the lock time on the stack
+	OpCheckSequenceVerify byte = 0xb2 // Fail unless the input sequence has reached the relative lock on the stack
+)
+
+// Script limits, bounding the work needed to validate an input
+const (
+	MaxScriptSize        = 10000
+	MaxScriptElementSize = 520
+	MaxScriptOps         = 201 // Non-push opcodes per script
+	MaxMultiSigKeys      = 20
+	maxScriptStackSize   = 1000
+	maxLockTimeSize      = 5 // Bytes in a lock time or sequence operand
+)
+
+// ScriptBuilder assembles a script from opcodes and data pushes
+type ScriptBuilder struct {
+	script Script
+}
+
+// NewScriptBuilder creates an empty script builder
+func NewScriptBuilder() *ScriptBuilder {
+	return &ScriptBuilder{}
+}
+
+// AddOp appends an opcode
+func (b *ScriptBuilder) AddOp(opcode byte) *ScriptBuilder {
+	b.script = append(b.script, opcode)
+	return b
+}
+
+// AddData appends the shortest push of data
+func (b *ScriptBuilder) AddData(data []byte) *ScriptBuilder {
+	switch {
+	case len(data) == 0:
+		b.script = append(b.script, Op0)
+	case len(data) < int(OpPushData1):
+		b.script = append(b.script, byte(len(data)))
+	case len(data) <= 0xff:
+		b.script = append(b.script, OpPushData1, byte(len(data)))
+	default:
+		b.script = append(b.script, OpPushData2)
+		b.script = binary.LittleEndian.AppendUint16(b.script, uint16(len(data)))
+	}
+	b.script = append(b.script, data...)
+	return b
+}
+
+// AddInt64 appends a push of a number, using Op1Negate and Op1 to Op16 for
+// small values
+func (b *ScriptBuilder) AddInt64(n int64) *ScriptBuilder {
+	switch {
+	case n == -1:
+		return b.AddOp(Op1Negate)
+	case n >= 1 && n <= 16:
+		return b.AddOp(Op1 + byte(n-1))
+	default:
+		return b.AddData(scriptNumBytes(n))
+	}
+}
+
+// Script returns the assembled script
+func (b *ScriptBuilder) Script() Script {
+	return append(Script{}, b.script...)
+}
+
+// PayToPubKeyHashScript locks an output to the owner of the public key with
+// the given hash: OP_DUP OP_HASH160 <hash> OP_EQUALVERIFY OP_CHECKSIG
+func PayToPubKeyHashScript(hash []byte) Script {
+	return NewScriptBuilder().AddOp(OpDup).AddOp(OpHash160).AddData(hash).
+		AddOp(OpEqualVerify).AddOp(OpCheckSig).Script()
+}
+
+// PayToScriptHashScript locks an output to any redeem script with the given
+// hash: OP_HASH160 <hash> OP_EQUAL. The spender reveals the redeem script as
+// the last item of the unlocking script, and it must then succeed as well.
+func PayToScriptHashScript(hash []byte) Script {
+	return NewScriptBuilder().AddOp(OpHash160).AddData(hash).AddOp(OpEqual).Script()
+}
+
+// MultiSigScript requires signatures from required of the given public keys:
+// <required> <key>... <n> OP_CHECKMULTISIG. Signatures must be given in the
+// same order as the keys.
+func MultiSigScript(required int, publicKeys []*ecdsa.PublicKey) (Script, error) {
+	if len(publicKeys) == 0 || len(publicKeys) > MaxMultiSigKeys {
+		return nil, fmt.Errorf("multisig needs 1 to %d public keys, got %d", MaxMultiSigKeys, len(publicKeys))
+	}
+	if required < 1 || required > len(publicKeys) {
+		return nil, fmt.Errorf("multisig cannot require %d of %d signatures", required, len(publicKeys))
+	}
+
+	b := NewScriptBuilder().AddInt64(int64(required))
+	for _, publicKey := range publicKeys {
+		b.AddData(crypto.CompressPublicKey(publicKey))
+	}
+	return b.AddInt64(int64(len(publicKeys))).AddOp(OpCheckMultiSig).Script(), nil
+}
+
+// TimeLockScript prefixes script with a lock time check, so the output can
+// only be spent by a transaction whose LockTime is at least lockTime, both
+// given as heights or both as times:
+// <lockTime> OP_CHECKLOCKTIMEVERIFY OP_DROP <script>
+func TimeLockScript(lockTime int64, script Script) Script {
+	prefix := NewScriptBuilder().AddInt64(lockTime).AddOp(OpCheckLockTimeVerify).AddOp(OpDrop).Script()
+	return append(prefix, script...)
+}
+
+// SequenceLockScript prefixes script with a relative lock check, so the
+// output can only be spent by an input whose Sequence is at least sequence,
+// as built by BlockSequence or TimeSequence:
+// <sequence> OP_CHECKSEQUENCEVERIFY OP_DROP <script>
+func SequenceLockScript(sequence uint32, script Script) Script {
+	prefix := NewScriptBuilder().AddInt64(int64(sequence)).AddOp(OpCheckSequenceVerify).AddOp(OpDrop).Script()
+	return append(prefix, script...)
+}
+
+// NewUnlockingScript builds an unlocking script that pushes each item in order
+func NewUnlockingScript(items ...[]byte) Script {
+	b := NewScriptBuilder()
+	for _, item := range items {
+		b.AddData(item)
+	}
+	return b.Script()
+}
+
+// ScriptAddress returns the pay-to-script-hash address of a redeem script
+func ScriptAddress(network *crypto.Network, redeemScript Script) (string, error) {
+	if len(redeemScript) > MaxScriptElementSize {
+		return "", fmt.Errorf("redeem script too large: %d bytes", len(redeemScript))
+	}
+	return crypto.EncodeAddress(network, crypto.AddressScriptHash, crypto.Hash160(redeemScript))
+}
+
+// LockingScript returns the script locking the output, as given by the type
+// of its address
+func (out TxOutput) LockingScript() (Script, error) {
+	address, err := crypto.DecodeAddress(out.Address)
+	if err != nil {
+		return nil, err
+	}
+	if address.Type == crypto.AddressScriptHash {
+		return PayToScriptHashScript(address.Hash), nil
+	}
+	return PayToPubKeyHashScript(address.Hash), nil
+}
+
+// UnlockingScript returns the script that unlocks the spent output. Inputs
+// signed with SignTransaction have no script; their signature and public key
+// form the pay-to-public-key-hash unlocking script <signature> <public key>.
+func (in TxInput) UnlockingScript() (Script, error) {
+	if in.Script != "" {
+		script, err := hex.DecodeString(in.Script)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode unlocking script: %w", err)
+		}
+		return script, nil
+	}
+
+	signature, err := hex.DecodeString(in.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode signature: %w", err)
+	}
+	publicKey, err := hex.DecodeString(in.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode public key: %w", err)
+	}
+	return NewUnlockingScript(signature, publicKey), nil
+}
+
+// SetUnlockingScript sets the unlocking script of an input
+func (tx *Transaction) SetUnlockingScript(inputIndex int, script Script) error {
+	if inputIndex < 0 || inputIndex >= len(tx.Inputs) {
+		return fmt.Errorf("input index %d out of range", inputIndex)
+	}
+	tx.Inputs[inputIndex].Script = hex.EncodeToString(script)
+	return nil
+}
+
+// CreateInputSignature signs an input for use in an unlocking script.
+// prevOutput is the output the input spends and hashType selects what the
+// signature commits to.
+func (tx *Transaction) CreateInputSignature(inputIndex int, privateKey *ecdsa.PrivateKey, prevOutput TxOutput, hashType SigHashType) ([]byte, error) {
+	if privateKey == nil || privateKey.Curve != crypto.Secp256k1() {
+		return nil, fmt.Errorf("private key must be on secp256k1")
+	}
+	hash, err := tx.signatureHash(inputIndex, &prevOutput, hashType)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := ecdsa.SignASN1(rand.Reader, privateKey, hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign input %d: %w", inputIndex, err)
+	}
+	return appendHashType(signature, hashType), nil
+}
+
+// VerifyInputScript runs the unlocking script of an input followed by the
+// locking script of prevOutput, the output it spends. For pay-to-script-hash
+// outputs the redeem script, the last item pushed by the unlocking script,
+// is then run on the remaining items.
+func (tx *Transaction) VerifyInputScript(inputIndex int, prevOutput TxOutput) error {
+	if inputIndex < 0 || inputIndex >= len(tx.Inputs) {
+		return fmt.Errorf("input index %d out of range", inputIndex)
+	}
+
+	unlocking, err := tx.Inputs[inputIndex].UnlockingScript()
+	if err != nil {
+		return err
+	}
+	if !unlocking.IsPushOnly() {
+		return fmt.Errorf("unlocking script must only push data")
+	}
+	locking, err := prevOutput.LockingScript()
+	if err != nil {
+		return fmt.Errorf("invalid locking script: %w", err)
+	}
+
+	engine := &scriptEngine{tx: tx, inputIndex: inputIndex, prevOutput: prevOutput}
+	if err := engine.execute(unlocking); err != nil {
+		return fmt.Errorf("unlocking script failed: %w", err)
+	}
+	unlockedStack := append([][]byte{}, engine.stack...)
+
+	if err := engine.execute(locking); err != nil {
+		return fmt.Errorf("locking script failed: %w", err)
+	}
+	if !engine.topIsTrue() {
+		return fmt.Errorf("locking script evaluated to false")
+	}
+	if !isPayToScriptHash(locking) {
+		return nil
+	}
+
+	if len(unlockedStack) == 0 {
+		return fmt.Errorf("missing redeem script")
+	}
+	redeemScript := Script(unlockedStack[len(unlockedStack)-1])
+	engine.stack = unlockedStack[:len(unlockedStack)-1]
+	if err := engine.execute(redeemScript); err != nil {
+		return fmt.Errorf("redeem script failed: %w", err)
+	}
+	if !engine.topIsTrue() {
+		return fmt.Errorf("redeem script evaluated to false")
+	}
+	return nil
+}
+
+// IsPushOnly reports whether the script only pushes data
+func (s Script) IsPushOnly() bool {
+	ops, err := parseScript(s)
+	if err != nil {
+		return false
+	}
+	for _, op := range ops {
+		if !isPushOpcode(op.opcode) {
+			return false
+		}
+	}
+	return true
+}
+
+// String disassembles the script, showing pushed data as hex
+func (s Script) String() string {
+	ops, err := parseScript(s)
+	if err != nil {
+		return fmt.Sprintf("[invalid script: %v]", err)
+	}
+	var buf bytes.Buffer
+	for i, op := range ops {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		switch {
+		case op.opcode == Op0:
+			buf.WriteString("0")
+		case op.opcode <= OpPushData2:
+			buf.WriteString(hex.EncodeToString(op.data))
+		case op.opcode == Op1Negate:
+			buf.WriteString("-1")
+		case op.opcode >= Op1 && op.opcode <= Op16:
+			fmt.Fprintf(&buf, "%d", op.opcode-Op1+1)
+		default:
+			buf.WriteString(opcodeName(op.opcode))
+		}
+	}
+	return buf.String()
+}
+
+// opcodeName returns the name of a non-push opcode
+func opcodeName(opcode byte) string {
+	if isPushOpcode(opcode) {
+		return "OP_PUSH"
+	}
+	switch opcode {
+	case OpVerify:
+		return "OP_VERIFY"
+	case OpDrop:
+		return "OP_DROP"
+	case OpDup:
+		return "OP_DUP"
+	case OpEqual:
+		return "OP_EQUAL"
+	case OpEqualVerify:
+		return "OP_EQUALVERIFY"
+	case OpHash160:
+		return "OP_HASH160"
+	case OpCheckSig:
+		return "OP_CHECKSIG"
+	case OpCheckSigVerify:
+		return "OP_CHECKSIGVERIFY"
+	case OpCheckMultiSig:
+		return "OP_CHECKMULTISIG"
+	case OpCheckMultiSigVerify:
+		return "OP_CHECKMULTISIGVERIFY"
+	case OpCheckLockTimeVerify:
+		return "OP_CHECKLOCKTIMEVERIFY"
+	case OpCheckSequenceVerify:
+		return "OP_CHECKSEQUENCEVERIFY"
+	default:
+		return fmt.Sprintf("OP_UNKNOWN_%02x", opcode)
+	}
+}
+
+// isPushOpcode reports whether an opcode only pushes a value
+func isPushOpcode(opcode byte) bool {
+	return opcode <= OpPushData2 || opcode == Op1Negate || (opcode >= Op1 && opcode <= Op16)
+}
+
+// isPayToScriptHash reports whether a locking script is OP_HASH160 <20 bytes> OP_EQUAL
+func isPayToScriptHash(script Script) bool {
+	return len(script) == crypto.AddressSize+3 &&
+		script[0] == OpHash160 &&
+		script[1] == crypto.AddressSize &&
+		script[len(script)-1] == OpEqual
+}
+
+// scriptOp is a parsed opcode with the data it pushes
+type scriptOp struct {
+	opcode byte
+	data   []byte
+}
+
+// parseScript splits a script into opcodes
+func parseScript(script Script) ([]scriptOp, error) {
+	if len(script) > MaxScriptSize {
+		return nil, fmt.Errorf("script too large: %d bytes", len(script))
+	}
+
+	var ops []scriptOp
+	for i := 0; i < len(script); {
+		opcode := script[i]
+		i++
+
+		var size int
+		switch {
+		case opcode < OpPushData1:
+			size = int(opcode)
+		case opcode == OpPushData1:
+			if i+1 > len(script) {
+				return nil, fmt.Errorf("truncated push length at offset %d", i-1)
+			}
+			size = int(script[i])
+			i++
+		case opcode == OpPushData2:
+			if i+2 > len(script) {
+				return nil, fmt.Errorf("truncated push length at offset %d", i-1)
+			}
+			size = int(binary.LittleEndian.Uint16(script[i:]))
+			i += 2
+		default:
+			ops = append(ops, scriptOp{opcode: opcode})
+			continue
+		}
+
+		if i+size > len(script) {
+			return nil, fmt.Errorf("push of %d bytes exceeds script at offset %d", size, i)
+		}
+		ops = append(ops, scriptOp{opcode: opcode, data: script[i : i+size]})
+		i += size
+	}
+	return ops, nil
+}
+
+// scriptEngine executes scripts for one input of a transaction
+type scriptEngine struct {
+	tx         *Transaction
+	inputIndex int
+	prevOutput TxOutput
+	stack      [][]byte
+	sigHashes  map[SigHashType][]byte
+}
+
+// execute runs a script on the current stack
+func (e *scriptEngine) execute(script Script) error {
+	ops, err := parseScript(script)
+	if err != nil {
+		return err
+	}
+
+	opCount := 0
+	for _, op := range ops {
+		if !isPushOpcode(op.opcode) {
+			opCount++
+			if opCount > MaxScriptOps {
+				return fmt.Errorf("too many operations")
+			}
+		}
+		if err := e.step(op, &opCount); err != nil {
+			return fmt.Errorf("%s: %w", opcodeName(op.opcode), err)
+		}
+		if len(e.stack) > maxScriptStackSize {
+			return fmt.Errorf("stack overflow")
+		}
+	}
+	return nil
+}
+
+// step executes a single opcode
+func (e *scriptEngine) step(op scriptOp, opCount *int) error {
+	switch {
+	case op.opcode <= OpPushData2:
+		if len(op.data) > MaxScriptElementSize {
+			return fmt.Errorf("pushed item of %d bytes exceeds limit", len(op.data))
+		}
+		e.push(append([]byte{}, op.data...))
+		return nil
+	case op.opcode == Op1Negate:
+		e.push(scriptNumBytes(-1))
+		return nil
+	case op.opcode >= Op1 && op.opcode <= Op16:
+		e.push(scriptNumBytes(int64(op.opcode - Op1 + 1)))
+		return nil
+	}
+
+	switch op.opcode {
+	case OpVerify:
+		return e.verify()
+
+	case OpDrop:
+		_, err := e.pop()
+		return err
+
+	case OpDup:
+		top, err := e.peek()
+		if err != nil {
+			return err
+		}
+		e.push(append([]byte{}, top...))
+
+	case OpEqual, OpEqualVerify:
+		a, err := e.pop()
+		if err != nil {
+			return err
+		}
+		b, err := e.pop()
+		if err != nil {
+			return err
+		}
+		e.pushBool(bytes.Equal(a, b))
+		if op.opcode == OpEqualVerify {
+			return e.verify()
+		}
+
+	case OpHash160:
+		data, err := e.pop()
+		if err != nil {
+			return err
+		}
+		e.push(crypto.Hash160(data))
+
+	case OpCheckSig, OpCheckSigVerify:
+		publicKey, err := e.pop()
+		if err != nil {
+			return err
+		}
+		signature, err := e.pop()
+		if err != nil {
+			return err
+		}
+		e.pushBool(e.checkSig(signature, publicKey))
+		if op.opcode == OpCheckSigVerify {
+			return e.verify()
+		}
+
+	case OpCheckMultiSig, OpCheckMultiSigVerify:
+		valid, err := e.checkMultiSig(opCount)
+		if err != nil {
+			return err
+		}
+		e.pushBool(valid)
+		if op.opcode == OpCheckMultiSigVerify {
+			return e.verify()
+		}
+
+	case OpCheckLockTimeVerify:
+		return e.checkLockTime()
+
+	case OpCheckSequenceVerify:
+		return e.checkSequence()
+
+	default:
+		return fmt.Errorf("unknown opcode")
+	}
+	return nil
+}
+
+// checkSig verifies a signature of the input, a DER signature followed by
+// its hash type, by a compressed public key
+func (e *scriptEngine) checkSig(signature, publicKey []byte) bool {
+	key, err := crypto.DecompressPublicKey(publicKey)
+	if err != nil {
+		return false
+	}
+	signature, hashType, err := splitSignature(signature)
+	if err != nil {
+		return false
+	}
+
+	hash, cached := e.sigHashes[hashType]
+	if !cached {
+		if hash, err = e.tx.signatureHash(e.inputIndex, &e.prevOutput, hashType); err != nil {
+			return false
+		}
+		if e.sigHashes == nil {
+			e.sigHashes = make(map[SigHashType][]byte)
+		}
+		e.sigHashes[hashType] = hash
+	}
+	return ecdsa.VerifyASN1(key, hash, signature)
+}
+
+// checkMultiSig pops <sig>... <m> <key>... <n> and reports whether the
+// signatures match m of the keys, in order
+func (e *scriptEngine) checkMultiSig(opCount *int) (bool, error) {
+	keyCount, err := e.popNumber(4)
+	if err != nil {
+		return false, err
+	}
+	if keyCount < 0 || keyCount > MaxMultiSigKeys {
+		return false, fmt.Errorf("invalid public key count %d", keyCount)
+	}
+	*opCount += int(keyCount)
+	if *opCount > MaxScriptOps {
+		return false, fmt.Errorf("too many operations")
+	}
+	publicKeys, err := e.popItems(int(keyCount))
+	if err != nil {
+		return false, err
+	}
+
+	sigCount, err := e.popNumber(4)
+	if err != nil {
+		return false, err
+	}
+	if sigCount < 0 || sigCount > keyCount {
+		return false, fmt.Errorf("invalid signature count %d", sigCount)
+	}
+	signatures, err := e.popItems(int(sigCount))
+	if err != nil {
+		return false, err
+	}
+
+	key := 0
+	for _, signature := range signatures {
+		for key < len(publicKeys) && !e.checkSig(signature, publicKeys[key]) {
+			key++
+		}
+		if key == len(publicKeys) {
+			return false, nil
+		}
+		key++
+	}
+	return true, nil
+}
+
+// checkLockTime fails unless the transaction LockTime has reached the lock
+// time on top of the stack, which is left in place. Both must be heights or
+// both times; CheckLocks then makes sure the chain has passed LockTime.
+func (e *scriptEngine) checkLockTime() error {
+	top, err := e.peek()
+	if err != nil {
+		return err
+	}
+	lockTime, err := parseScriptNum(top, maxLockTimeSize)
+	if err != nil {
+		return err
+	}
+	if lockTime < 0 || lockTime > math.MaxUint32 {
+		return fmt.Errorf("lock time %d out of range", lockTime)
+	}
+	txLockTime := int64(e.tx.LockTime)
+	if (lockTime < LockTimeThreshold) != (txLockTime < LockTimeThreshold) {
+		return fmt.Errorf("lock time %d and transaction lock time %d differ in type", lockTime, txLockTime)
+	}
+	if txLockTime < lockTime {
+		return fmt.Errorf("locked until %s, transaction lock time is %d", describeLockTime(uint32(lockTime)), txLockTime)
+	}
+	return nil
+}
+
+// checkSequence fails unless the input Sequence has reached the relative
+// lock on top of the stack, which is left in place. An operand with
+// SequenceLockDisabled set always passes. CheckLocks then makes sure the
+// chain has passed the input's relative lock.
+func (e *scriptEngine) checkSequence() error {
+	top, err := e.peek()
+	if err != nil {
+		return err
+	}
+	operand, err := parseScriptNum(top, maxLockTimeSize)
+	if err != nil {
+		return err
+	}
+	if operand < 0 || operand > math.MaxUint32 {
+		return fmt.Errorf("sequence %d out of range", operand)
+	}
+	required := uint32(operand)
+	if required&SequenceLockDisabled != 0 {
+		return nil
+	}
+
+	sequence := e.tx.Inputs[e.inputIndex].Sequence
+	if sequence&SequenceLockDisabled != 0 {
+		return fmt.Errorf("input %d has no relative lock", e.inputIndex)
+	}
+	if required&SequenceLockTimeIsSeconds != sequence&SequenceLockTimeIsSeconds {
+		return fmt.Errorf("relative lock %d and input sequence %d differ in type", required, sequence)
+	}
+	if sequence&SequenceLockMask < required&SequenceLockMask {
+		return fmt.Errorf("relative lock %d not reached, input sequence is %d", required&SequenceLockMask, sequence&SequenceLockMask)
+	}
+	return nil
+}
+
+func (e *scriptEngine) push(item []byte) {
+	e.stack = append(e.stack, item)
+}
+
+func (e *scriptEngine) pushBool(value bool) {
+	if value {
+		e.push([]byte{1})
+	} else {
+		e.push(nil)
+	}
+}
+
+func (e *scriptEngine) peek() ([]byte, error) {
+	if len(e.stack) == 0 {
+		return nil, fmt.Errorf("stack is empty")
+	}
+	return e.stack[len(e.stack)-1], nil
+}
+
+func (e *scriptEngine) pop() ([]byte, error) {
+	top, err := e.peek()
+	if err != nil {
+		return nil, err
+	}
+	e.stack = e.stack[:len(e.stack)-1]
+	return top, nil
+}
+
+// popItems pops count items, returning them in the order they were pushed
+func (e *scriptEngine) popItems(count int) ([][]byte, error) {
+	if count > len(e.stack) {
+		return nil, fmt.Errorf("stack has %d items, need %d", len(e.stack), count)
+	}
+	items := append([][]byte{}, e.stack[len(e.stack)-count:]...)
+	e.stack = e.stack[:len(e.stack)-count]
+	return items, nil
+}
+
+func (e *scriptEngine) popNumber(maxSize int) (int64, error) {
+	item, err := e.pop()
+	if err != nil {
+		return 0, err
+	}
+	return parseScriptNum(item, maxSize)
+}
+
+// verify pops the top item and fails unless it is true
+func (e *scriptEngine) verify() error {
+	item, err := e.pop()
+	if err != nil {
+		return err
+	}
+	if !castToBool(item) {
+		return fmt.Errorf("verify failed")
+	}
+	return nil
+}
+
+func (e *scriptEngine) topIsTrue() bool {
+	top, err := e.peek()
+	return err == nil && castToBool(top)
+}
+
+// castToBool treats an item as false if it is zero, including negative zero
+func castToBool(item []byte) bool {
+	for i, b := range item {
+		if b != 0 {
+			return i != len(item)-1 || b != 0x80
+		}
+	}
+	return false
+}
+
+// scriptNumBytes encodes a number as a minimal little-endian value with the
+// sign in the top bit
+func scriptNumBytes(n int64) []byte {
+	if n == 0 {
+		return nil
+	}
+	negative := n < 0
+	magnitude := uint64(n)
+	if negative {
+		magnitude = uint64(-n)
+	}
+
+	var out []byte
+	for magnitude > 0 {
+		out = append(out, byte(magnitude))
+		magnitude >>= 8
+	}
+	switch {
+	case out[len(out)-1]&0x80 != 0 && negative:
+		out = append(out, 0x80)
+	case out[len(out)-1]&0x80 != 0:
+		out = append(out, 0x00)
+	case negative:
+		out[len(out)-1] |= 0x80
+	}
+	return out
+}
+
+// parseScriptNum decodes a minimally encoded number of at most maxSize bytes
+func parseScriptNum(data []byte, maxSize int) (int64, error) {
+	if len(data) > maxSize {
+		return 0, fmt.Errorf("number of %d bytes exceeds %d", len(data), maxSize)
+	}
+	if len(data) == 0 {
+		return 0, nil
+	}
+	last := data[len(data)-1]
+	if last&0x7f == 0 && (len(data) == 1 || data[len(data)-2]&0x80 == 0) {
+		return 0, fmt.Errorf("number is not minimally encoded")
+	}
+
+	var n int64
+	for i, b := range data {
+		n |= int64(b) << (8 * i)
+	}
+	if last&0x80 != 0 {
+		n &^= int64(0x80) << (8 * (len(data) - 1))
+		n = -n
+	}
+	return n, nil
+}
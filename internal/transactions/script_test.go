@@ -0,0 +1,234 @@
+package transactions
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"testing"
+
+	"github.com/aliexe/blockChain/internal/crypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newScriptTestKeys(t *testing.T, count int) []*ecdsa.PrivateKey {
+	keys := make([]*ecdsa.PrivateKey, count)
+	for i := range keys {
+		key, err := ecdsa.GenerateKey(crypto.Secp256k1(), rand.Reader)
+		require.NoError(t, err)
+		keys[i] = key
+	}
+	return keys
+}
+
+func TestScriptNumEncoding(t *testing.T) {
+	for _, n := range []int64{0, 1, -1, 16, 127, 128, -128, 255, 256, -32768, 1 << 31, 1<<39 - 1} {
+		encoded := scriptNumBytes(n)
+		decoded, err := parseScriptNum(encoded, 8)
+		require.NoError(t, err, n)
+		assert.Equal(t, n, decoded)
+	}
+
+	_, err := parseScriptNum([]byte{0x00}, 4)
+	assert.Error(t, err, "zero must be empty")
+	_, err = parseScriptNum([]byte{0x01, 0x00}, 4)
+	assert.Error(t, err, "padding byte is not minimal")
+	_, err = parseScriptNum([]byte{1, 2, 3, 4, 5}, 4)
+	assert.Error(t, err)
+}
+
+func TestPayToPubKeyHashScript(t *testing.T) {
+	prevOutput := TxOutput{Address: testKeyAddress, Amount: 2 * Coin}
+	tx := NewTransaction(
+		[]TxInput{{TxID: "prev", Index: 0}},
+		[]TxOutput{{Address: testAddress, Amount: Coin}},
+	)
+
+	locking, err := prevOutput.LockingScript()
+	require.NoError(t, err)
+	assert.Equal(t, PayToPubKeyHashScript(crypto.PublicKeyHash(testPublicKey)), locking)
+
+	assert.Error(t, tx.VerifyInputScript(0, prevOutput), "unsigned input")
+
+	require.NoError(t, tx.SignTransaction(0, testPrivateKey, []TxOutput{prevOutput}))
+	assert.NoError(t, tx.VerifyInputScript(0, prevOutput))
+
+	// The key must hash to the address
+	other := TxOutput{Address: testAddress2, Amount: 2 * Coin}
+	assert.Error(t, tx.VerifyInputScript(0, other))
+
+	// The signature commits to the spent output
+	assert.Error(t, tx.VerifyInputScript(0, TxOutput{Address: testKeyAddress, Amount: 3 * Coin}))
+}
+
+func TestMultiSigScriptHash(t *testing.T) {
+	keys := newScriptTestKeys(t, 3)
+	publicKeys := []*ecdsa.PublicKey{&keys[0].PublicKey, &keys[1].PublicKey, &keys[2].PublicKey}
+
+	redeemScript, err := MultiSigScript(2, publicKeys)
+	require.NoError(t, err)
+	address, err := ScriptAddress(crypto.MainNet, redeemScript)
+	require.NoError(t, err)
+	require.NoError(t, ValidateAddressFormat(address))
+
+	prevOutput := TxOutput{Address: address, Amount: 5 * Coin}
+	tx := NewTransaction(
+		[]TxInput{{TxID: "treasury", Index: 0}},
+		[]TxOutput{{Address: testAddress, Amount: 4 * Coin}},
+	)
+
+	sig0, err := tx.CreateInputSignature(0, keys[0], prevOutput, SigHashAll)
+	require.NoError(t, err)
+	sig1, err := tx.CreateInputSignature(0, keys[1], prevOutput, SigHashAll)
+	require.NoError(t, err)
+	sig2, err := tx.CreateInputSignature(0, keys[2], prevOutput, SigHashAll)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		unlocking Script
+		wantErr   bool
+	}{
+		{"first and third key", NewUnlockingScript(sig0, sig2, redeemScript), false},
+		{"first and second key", NewUnlockingScript(sig0, sig1, redeemScript), false},
+		{"one signature", NewUnlockingScript(sig1, redeemScript), true},
+		{"signatures out of order", NewUnlockingScript(sig2, sig0, redeemScript), true},
+		{"same signature twice", NewUnlockingScript(sig0, sig0, redeemScript), true},
+		{"missing redeem script", NewUnlockingScript(sig0, sig2), true},
+		{"non-push unlocking script", append(NewUnlockingScript(sig0, sig2, redeemScript), OpDup), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.NoError(t, tx.SetUnlockingScript(0, tt.unlocking))
+			err := tx.VerifyInputScript(0, prevOutput)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+
+	// A different redeem script does not match the address
+	otherScript, err := MultiSigScript(1, publicKeys)
+	require.NoError(t, err)
+	require.NoError(t, tx.SetUnlockingScript(0, NewUnlockingScript(sig0, otherScript)))
+	assert.Error(t, tx.VerifyInputScript(0, prevOutput))
+}
+
+func TestMultiSigScriptLimits(t *testing.T) {
+	keys := newScriptTestKeys(t, 2)
+	publicKeys := []*ecdsa.PublicKey{&keys[0].PublicKey, &keys[1].PublicKey}
+
+	_, err := MultiSigScript(0, publicKeys)
+	assert.Error(t, err)
+	_, err = MultiSigScript(3, publicKeys)
+	assert.Error(t, err)
+	_, err = MultiSigScript(1, nil)
+	assert.Error(t, err)
+}
+
+func TestTimeLockScript(t *testing.T) {
+	const lockTime = 1700000000
+	redeemScript := TimeLockScript(lockTime, PayToPubKeyHashScript(crypto.PublicKeyHash(testPublicKey)))
+	address, err := ScriptAddress(crypto.MainNet, redeemScript)
+	require.NoError(t, err)
+	prevOutput := TxOutput{Address: address, Amount: 2 * Coin}
+
+	spend := func(txLockTime uint32) error {
+		tx := NewTransaction(
+			[]TxInput{{TxID: "vesting", Index: 0}},
+			[]TxOutput{{Address: testAddress, Amount: Coin}},
+		)
+		tx.LockTime = txLockTime
+		tx.ID = tx.CalculateID()
+
+		signature, err := tx.CreateInputSignature(0, testPrivateKey, prevOutput, SigHashAll)
+		require.NoError(t, err)
+		publicKey := crypto.CompressPublicKey(testPublicKey)
+		require.NoError(t, tx.SetUnlockingScript(0, NewUnlockingScript(signature, publicKey, redeemScript)))
+		return tx.VerifyInputScript(0, prevOutput)
+	}
+
+	err = spend(lockTime - 1)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "locked until")
+	assert.NoError(t, spend(lockTime))
+	assert.NoError(t, spend(lockTime+3600))
+	assert.Error(t, spend(0), "no lock time")
+	assert.Error(t, spend(800000), "height lock time against a time lock")
+}
+
+func TestSequenceLockScript(t *testing.T) {
+	redeemScript := SequenceLockScript(BlockSequence(10), PayToPubKeyHashScript(crypto.PublicKeyHash(testPublicKey)))
+	address, err := ScriptAddress(crypto.MainNet, redeemScript)
+	require.NoError(t, err)
+	prevOutput := TxOutput{Address: address, Amount: 2 * Coin}
+
+	spend := func(sequence uint32) error {
+		tx := NewTransaction(
+			[]TxInput{{TxID: "channel", Index: 0, Sequence: sequence}},
+			[]TxOutput{{Address: testAddress, Amount: Coin}},
+		)
+
+		signature, err := tx.CreateInputSignature(0, testPrivateKey, prevOutput, SigHashAll)
+		require.NoError(t, err)
+		publicKey := crypto.CompressPublicKey(testPublicKey)
+		require.NoError(t, tx.SetUnlockingScript(0, NewUnlockingScript(signature, publicKey, redeemScript)))
+		return tx.VerifyInputScript(0, prevOutput)
+	}
+
+	assert.NoError(t, spend(BlockSequence(10)))
+	assert.NoError(t, spend(BlockSequence(20)))
+	assert.Error(t, spend(BlockSequence(9)))
+	assert.Error(t, spend(SequenceLockDisabled|10))
+
+	timeSequence, err := TimeSequence(10 * 512)
+	require.NoError(t, err)
+	assert.Error(t, spend(timeSequence), "time sequence against a block lock")
+}
+
+func TestUTXOSetValidatesMultiSigSpend(t *testing.T) {
+	keys := newScriptTestKeys(t, 2)
+	redeemScript, err := MultiSigScript(2, []*ecdsa.PublicKey{&keys[0].PublicKey, &keys[1].PublicKey})
+	require.NoError(t, err)
+	address, err := ScriptAddress(crypto.MainNet, redeemScript)
+	require.NoError(t, err)
+
+	utxoSet := NewUTXOSet()
+	require.NoError(t, utxoSet.Add("escrow", 0, TxOutput{Address: address, Amount: 3 * Coin}))
+	prevOutput, err := utxoSet.Get("escrow", 0)
+	require.NoError(t, err)
+
+	tx := NewTransaction(
+		[]TxInput{{TxID: "escrow", Index: 0}},
+		[]TxOutput{{Address: testAddress, Amount: 2 * Coin}},
+	)
+	sig0, err := tx.CreateInputSignature(0, keys[0], prevOutput, SigHashAll)
+	require.NoError(t, err)
+
+	require.NoError(t, tx.SetUnlockingScript(0, NewUnlockingScript(sig0, redeemScript)))
+	assert.Error(t, utxoSet.ValidateTransaction(tx))
+
+	sig1, err := tx.CreateInputSignature(0, keys[1], prevOutput, SigHashAll)
+	require.NoError(t, err)
+	require.NoError(t, tx.SetUnlockingScript(0, NewUnlockingScript(sig0, sig1, redeemScript)))
+	assert.NoError(t, utxoSet.ValidateTransaction(tx))
+
+	// Unlocking scripts travel with the transaction
+	data, err := tx.MarshalBinary()
+	require.NoError(t, err)
+	var decoded Transaction
+	require.NoError(t, decoded.UnmarshalBinary(data))
+	assert.NoError(t, utxoSet.ValidateTransaction(&decoded))
+}
+
+func TestScriptString(t *testing.T) {
+	hash := make([]byte, crypto.AddressSize)
+	script := PayToPubKeyHashScript(hash)
+	assert.Equal(t, "OP_DUP OP_HASH160 0000000000000000000000000000000000000000 OP_EQUALVERIFY OP_CHECKSIG", script.String())
+	assert.Equal(t, "2 OP_CHECKLOCKTIMEVERIFY OP_DROP 0", TimeLockScript(2, NewUnlockingScript(nil)).String())
+	assert.False(t, script.IsPushOnly())
+	assert.True(t, NewUnlockingScript([]byte{1}, nil).IsPushOnly())
+	assert.False(t, Script{OpPushData1}.IsPushOnly())
+}
@@ -0,0 +1,158 @@
+package transactions
+
+import (
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/aliexe/blockChain/internal/encoding"
+)
+
+// SigHashType selects the parts of a transaction a signature commits to. It is
+// appended to every signature as its last byte.
+type SigHashType uint8
+
+const (
+	// SigHashAll signs every input and output
+	SigHashAll SigHashType = 0x01
+	// SigHashNone signs the inputs only, so anyone may change the outputs
+	SigHashNone SigHashType = 0x02
+	// SigHashSingle signs the inputs and the output with the same index as
+	// the signed input
+	SigHashSingle SigHashType = 0x03
+	// SigHashAnyoneCanPay is combined with one of the above to sign only the
+	// signed input, so others may add inputs of their own
+	SigHashAnyoneCanPay SigHashType = 0x80
+
+	sigHashBaseMask SigHashType = 0x1f
+)
+
+// base returns the type without the SigHashAnyoneCanPay flag
+func (t SigHashType) base() SigHashType {
+	return t & sigHashBaseMask
+}
+
+// AnyoneCanPay reports whether the SigHashAnyoneCanPay flag is set
+func (t SigHashType) AnyoneCanPay() bool {
+	return t&SigHashAnyoneCanPay != 0
+}
+
+// Validate checks that the type is one of the defined combinations
+func (t SigHashType) Validate() error {
+	if t&^(sigHashBaseMask|SigHashAnyoneCanPay) != 0 {
+		return fmt.Errorf("invalid signature hash type 0x%02x", uint8(t))
+	}
+	switch t.base() {
+	case SigHashAll, SigHashNone, SigHashSingle:
+		return nil
+	default:
+		return fmt.Errorf("invalid signature hash type 0x%02x", uint8(t))
+	}
+}
+
+// String returns the name of the type, such as "ALL" or "SINGLE|ANYONECANPAY"
+func (t SigHashType) String() string {
+	var name string
+	switch t.base() {
+	case SigHashAll:
+		name = "ALL"
+	case SigHashNone:
+		name = "NONE"
+	case SigHashSingle:
+		name = "SINGLE"
+	default:
+		return fmt.Sprintf("UNKNOWN_%02x", uint8(t))
+	}
+	if t.AnyoneCanPay() {
+		name += "|ANYONECANPAY"
+	}
+	return name
+}
+
+// ParseSigHashType parses a type name as returned by String
+func ParseSigHashType(name string) (SigHashType, error) {
+	for _, t := range []SigHashType{SigHashAll, SigHashNone, SigHashSingle} {
+		if name == t.String() {
+			return t, nil
+		}
+		if name == (t | SigHashAnyoneCanPay).String() {
+			return t | SigHashAnyoneCanPay, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown signature hash type %q", name)
+}
+
+// signatureHash returns the hash signed by input inputIndex spending
+// referencedOutput, which may be nil. The transaction ID is left out, since
+// it changes whenever another signer adds an input or output the hash type
+// allows. Inputs other than the signed one are hashed without their
+// sequence numbers unless every output is signed.
+func (tx *Transaction) signatureHash(inputIndex int, referencedOutput *TxOutput, hashType SigHashType) ([]byte, error) {
+	if err := hashType.Validate(); err != nil {
+		return nil, err
+	}
+	if inputIndex < 0 || inputIndex >= len(tx.Inputs) {
+		return nil, fmt.Errorf("input index %d out of range", inputIndex)
+	}
+
+	w := encoding.NewWriter()
+	w.WriteUint8(TxEncodingVersion)
+	w.WriteUint8(uint8(hashType))
+	w.WriteInt64(tx.Timestamp)
+	w.WriteVarint(int64(tx.Height))
+	w.WriteUint32(tx.LockTime)
+
+	if hashType.AnyoneCanPay() {
+		w.WriteUvarint(1)
+		tx.Inputs[inputIndex].encode(w, false)
+	} else {
+		w.WriteVarint(int64(inputIndex))
+		w.WriteUvarint(uint64(len(tx.Inputs)))
+		for i, input := range tx.Inputs {
+			if i != inputIndex && hashType.base() != SigHashAll {
+				input.Sequence = 0
+			}
+			input.encode(w, false)
+		}
+	}
+
+	switch hashType.base() {
+	case SigHashAll:
+		w.WriteUvarint(uint64(len(tx.Outputs)))
+		for _, output := range tx.Outputs {
+			output.encode(w)
+		}
+	case SigHashNone:
+		w.WriteUvarint(0)
+	case SigHashSingle:
+		if inputIndex >= len(tx.Outputs) {
+			return nil, fmt.Errorf("no output %d to sign with %s", inputIndex, hashType)
+		}
+		w.WriteUvarint(1)
+		tx.Outputs[inputIndex].encode(w)
+	}
+
+	// Include the referenced output data
+	if referencedOutput != nil {
+		referencedOutput.encode(w)
+	}
+
+	hash := sha256.Sum256(w.Bytes())
+	return hash[:], nil
+}
+
+// appendHashType appends the hash type byte to a DER signature
+func appendHashType(signature []byte, hashType SigHashType) []byte {
+	return append(signature[:len(signature):len(signature)], byte(hashType))
+}
+
+// splitSignature splits a signature into its DER part and hash type
+func splitSignature(signature []byte) ([]byte, SigHashType, error) {
+	if len(signature) < 2 {
+		return nil, 0, fmt.Errorf("signature too short")
+	}
+	hashType := SigHashType(signature[len(signature)-1])
+	if err := hashType.Validate(); err != nil {
+		return nil, 0, err
+	}
+	return signature[:len(signature)-1], hashType, nil
+}
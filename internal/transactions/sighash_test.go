@@ -0,0 +1,99 @@
+package transactions
+
+import (
+	"crypto/ecdsa"
+	"testing"
+
+	"github.com/aliexe/blockChain/internal/crypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// keyAddress returns the pay-to-public-key-hash address of a key
+func keyAddress(t *testing.T, key *ecdsa.PrivateKey) string {
+	keyPair, err := crypto.GetKeyPairFromPrivate(key)
+	require.NoError(t, err)
+	return keyPair.Address
+}
+
+func TestSigHashTypeNames(t *testing.T) {
+	for _, hashType := range []SigHashType{SigHashAll, SigHashNone, SigHashSingle, SigHashAll | SigHashAnyoneCanPay, SigHashSingle | SigHashAnyoneCanPay} {
+		require.NoError(t, hashType.Validate())
+		parsed, err := ParseSigHashType(hashType.String())
+		require.NoError(t, err)
+		assert.Equal(t, hashType, parsed)
+	}
+	assert.Equal(t, "NONE|ANYONECANPAY", (SigHashNone | SigHashAnyoneCanPay).String())
+
+	assert.Error(t, SigHashType(0).Validate())
+	assert.Error(t, SigHashType(0x04).Validate())
+	assert.Error(t, SigHashType(0x41).Validate())
+	_, err := ParseSigHashType("EVERYTHING")
+	assert.Error(t, err)
+}
+
+func TestSigHashModes(t *testing.T) {
+	keys := newScriptTestKeys(t, 2)
+	prevOutputs := []TxOutput{
+		{Address: keyAddress(t, keys[0]), Amount: 3 * Coin},
+		{Address: keyAddress(t, keys[1]), Amount: 2 * Coin},
+	}
+	newTx := func() *Transaction {
+		return NewTransaction(
+			[]TxInput{{TxID: "prev1", Index: 0}, {TxID: "prev2", Index: 0}},
+			[]TxOutput{{Address: testAddress, Amount: 2 * Coin}, {Address: testAddress2, Amount: 2 * Coin}},
+		)
+	}
+
+	tests := []struct {
+		name     string
+		hashType SigHashType
+		change   func(tx *Transaction)
+		valid    bool
+	}{
+		{"all signs outputs", SigHashAll, func(tx *Transaction) { tx.Outputs[1].Amount = Coin }, false},
+		{"all signs other inputs", SigHashAll, func(tx *Transaction) { tx.Inputs[1].Sequence = 5 }, false},
+		{"none leaves outputs open", SigHashNone, func(tx *Transaction) { tx.Outputs[0].Address = testAddress2 }, true},
+		{"none leaves other sequences open", SigHashNone, func(tx *Transaction) { tx.Inputs[1].Sequence = 5 }, true},
+		{"none signs other inputs", SigHashNone, func(tx *Transaction) { tx.Inputs[1].TxID = "prev3" }, false},
+		{"single signs its output", SigHashSingle, func(tx *Transaction) { tx.Outputs[0].Amount = Coin }, false},
+		{"single leaves other outputs open", SigHashSingle, func(tx *Transaction) { tx.Outputs[1].Amount = Coin }, true},
+		{"all signs input list", SigHashAll, func(tx *Transaction) {
+			tx.Inputs = append(tx.Inputs, TxInput{TxID: "prev3", Index: 0})
+		}, false},
+		{"anyone can pay leaves inputs open", SigHashAll | SigHashAnyoneCanPay, func(tx *Transaction) {
+			tx.Inputs = append(tx.Inputs[:1], TxInput{TxID: "prev3", Index: 0})
+		}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx := newTx()
+			signature, err := tx.CreateInputSignature(0, keys[0], prevOutputs[0], tt.hashType)
+			require.NoError(t, err)
+			require.NoError(t, tx.SetUnlockingScript(0, NewUnlockingScript(signature, crypto.CompressPublicKey(&keys[0].PublicKey))))
+			require.NoError(t, tx.VerifyInputScript(0, prevOutputs[0]))
+
+			tt.change(tx)
+			tx.ID = tx.CalculateID()
+			err = tx.VerifyInputScript(0, prevOutputs[0])
+			if tt.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+
+	// SINGLE needs an output with the index of the input
+	tx := newTx()
+	tx.Outputs = tx.Outputs[:1]
+	_, err := tx.CreateInputSignature(1, keys[1], prevOutputs[1], SigHashSingle)
+	assert.Error(t, err)
+
+	// The hash type travels with the signature
+	tx = newTx()
+	require.NoError(t, tx.SignTransactionWithHashType(0, keys[0], prevOutputs, SigHashNone))
+	tx.Outputs[0].Amount = Coin
+	assert.NoError(t, tx.VerifyInputSignature(0, prevOutputs))
+}
@@ -2,16 +2,22 @@ package transactions
 
 import (
 	"crypto/ecdsa"
-	"crypto/elliptic"
 	"crypto/rand"
-	"crypto/sha256"
 	"encoding/hex"
-	"encoding/json"
 	"fmt"
-	"math/big"
+
+	"github.com/aliexe/blockChain/internal/crypto"
 )
 
+// SignTransaction signs an input with SigHashAll, committing to the whole
+// transaction
 func (tx *Transaction) SignTransaction(inputIndex int, privateKey *ecdsa.PrivateKey, referencedTxOutputs []TxOutput) error {
+	return tx.SignTransactionWithHashType(inputIndex, privateKey, referencedTxOutputs, SigHashAll)
+}
+
+// SignTransactionWithHashType signs an input, committing to the parts of the
+// transaction selected by hashType
+func (tx *Transaction) SignTransactionWithHashType(inputIndex int, privateKey *ecdsa.PrivateKey, referencedTxOutputs []TxOutput, hashType SigHashType) error {
 	if inputIndex >= len(tx.Inputs) {
 		return fmt.Errorf("input index %d out of range", inputIndex)
 	}
@@ -22,11 +28,15 @@ func (tx *Transaction) SignTransaction(inputIndex int, privateKey *ecdsa.Private
 	}
 
 	// Create the message to sign (transaction data + referenced output)
-	message, err := tx.getSigningMessage(inputIndex, referencedTxOutputs)
+	message, err := tx.getSigningMessage(inputIndex, referencedTxOutputs, hashType)
 	if err != nil {
 		return fmt.Errorf("failed to create signing message: %w", err)
 	}
 
+	if privateKey == nil || privateKey.Curve != crypto.Secp256k1() {
+		return fmt.Errorf("private key must be on secp256k1")
+	}
+
 	// Sign the message
 	signature, err := ecdsa.SignASN1(rand.Reader, privateKey, message)
 	if err != nil {
@@ -34,58 +44,21 @@ func (tx *Transaction) SignTransaction(inputIndex int, privateKey *ecdsa.Private
 	}
 
 	// Store signature and public key
-	tx.Inputs[inputIndex].Signature = hex.EncodeToString(signature)
+	tx.Inputs[inputIndex].Signature = hex.EncodeToString(appendHashType(signature, hashType))
 	tx.Inputs[inputIndex].PublicKey = encodePublicKey(&privateKey.PublicKey)
 
 	return nil
 }
 
-// getSigningMessage creates the message to be signed
-func (tx *Transaction) getSigningMessage(inputIndex int, referencedTxOutputs []TxOutput) ([]byte, error) {
-	// Hash the transaction data (excluding signatures and public keys)
-	txCopy := tx.copyWithEmptySignatures()
-	txData, err := json.Marshal(txCopy)
-	if err != nil {
-		return nil, err
-	}
-
-	// Include the referenced output data
+// getSigningMessage creates the message to be signed: the signature hash of
+// the parts selected by hashType, followed by the referenced output when one
+// is given for the input
+func (tx *Transaction) getSigningMessage(inputIndex int, referencedTxOutputs []TxOutput, hashType SigHashType) ([]byte, error) {
+	var referencedOutput *TxOutput
 	if inputIndex < len(referencedTxOutputs) {
-		outputData, err := json.Marshal(referencedTxOutputs[inputIndex])
-		if err != nil {
-			return nil, err
-		}
-
-		// Combine transaction data and referenced output data
-		combinedData := append(txData, outputData...)
-		hash := sha256.Sum256(combinedData)
-		return hash[:], nil
-	}
-
-	// If no referenced output, just hash the transaction data
-	hash := sha256.Sum256(txData)
-	return hash[:], nil
-}
-
-// copyWithEmptySignatures creates a copy of the transaction with empty signatures
-func (tx *Transaction) copyWithEmptySignatures() *Transaction {
-	copy := &Transaction{
-		ID:        tx.ID,
-		Inputs:    make([]TxInput, len(tx.Inputs)),
-		Outputs:   tx.Outputs,
-		Timestamp: tx.Timestamp,
-	}
-
-	for i, input := range tx.Inputs {
-		copy.Inputs[i] = TxInput{
-			TxID:      input.TxID,
-			Index:     input.Index,
-			Signature: "", // Empty for signing
-			PublicKey: "", // Empty for signing
-		}
+		referencedOutput = &referencedTxOutputs[inputIndex]
 	}
-
-	return copy
+	return tx.signatureHash(inputIndex, referencedOutput, hashType)
 }
 
 // VerifyInputSignature verifies the signature of a transaction input
@@ -108,8 +81,14 @@ func (tx *Transaction) VerifyInputSignature(inputIndex int, referencedTxOutputs
 		return fmt.Errorf("failed to decode public key: %w", err)
 	}
 
+	// Split off the hash type
+	signature, hashType, err := splitSignature(signature)
+	if err != nil {
+		return fmt.Errorf("input %d: %w", inputIndex, err)
+	}
+
 	// Create the message that was signed
-	message, err := tx.getSigningMessage(inputIndex, referencedTxOutputs)
+	message, err := tx.getSigningMessage(inputIndex, referencedTxOutputs, hashType)
 	if err != nil {
 		return fmt.Errorf("failed to create signing message: %w", err)
 	}
@@ -122,44 +101,23 @@ func (tx *Transaction) VerifyInputSignature(inputIndex int, referencedTxOutputs
 	return nil
 }
 
-// encodePublicKey encodes a public key to hex string
+// encodePublicKey encodes a public key as the hex of its 33-byte compressed form
 func encodePublicKey(publicKey *ecdsa.PublicKey) string {
-	// Use uncompressed format: 0x04 + X + Y
-	keyBytes := make([]byte, 0, 65)
-	keyBytes = append(keyBytes, 0x04)
-	keyBytes = append(keyBytes, publicKey.X.Bytes()...)
-	keyBytes = append(keyBytes, publicKey.Y.Bytes()...)
-	return hex.EncodeToString(keyBytes)
+	return hex.EncodeToString(crypto.CompressPublicKey(publicKey))
 }
 
-// decodePublicKey decodes a hex string to public key
+// decodePublicKey decodes a hex compressed secp256k1 public key
 func decodePublicKey(hexKey string) (*ecdsa.PublicKey, error) {
 	keyBytes, err := hex.DecodeString(hexKey)
 	if err != nil {
 		return nil, err
 	}
 
-	if len(keyBytes) != 65 || keyBytes[0] != 0x04 {
+	if len(keyBytes) != crypto.PublicKeySize {
 		return nil, fmt.Errorf("invalid public key format")
 	}
 
-	// Extract X and Y coordinates
-	x := new(big.Int).SetBytes(keyBytes[1:33])
-	y := new(big.Int).SetBytes(keyBytes[33:65])
-
-	// Create public key
-	publicKey := &ecdsa.PublicKey{
-		Curve: elliptic.P256(),
-		X:     x,
-		Y:     y,
-	}
-
-	// Verify the point is on the curve
-	if !publicKey.Curve.IsOnCurve(x, y) {
-		return nil, fmt.Errorf("public key point is not on the curve")
-	}
-
-	return publicKey, nil
+	return crypto.DecompressPublicKey(keyBytes)
 }
 
 // GetInputPublicKey extracts the public key from a transaction input
@@ -228,7 +186,7 @@ func (tx *Transaction) GetSignatureInfo() map[string]interface{} {
 	}
 
 	for _, input := range tx.Inputs {
-		if input.Signature != "" && input.PublicKey != "" {
+		if input.Script != "" || (input.Signature != "" && input.PublicKey != "") {
 			info["signed_inputs"] = info["signed_inputs"].(int) + 1
 		} else {
 			info["unsigned_inputs"] = info["unsigned_inputs"].(int) + 1
@@ -1,31 +1,41 @@
 package transactions
 
 import (
-	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"strings"
 )
 
 type TxOutput struct {
-	Address string  `json:"address"`
-	Amount  float64 `json:"amount"`
-	TxID    string  `json:"tx_id"`
-	Index   int     `json:"index"`
+	Address string `json:"address"`
+	Amount  Amount `json:"amount"`
+	TxID    string `json:"tx_id"`
+	Index   int    `json:"index"`
 }
 
 type TxInput struct {
-	TxID      string `json:"tx_id"`
-	Index     int    `json:"index"`
+	TxID  string `json:"tx_id"`
+	Index int    `json:"index"`
+	// Sequence holds the relative lock time of the input, see BlockSequence
+	// and TimeSequence
+	Sequence  uint32 `json:"sequence,omitempty"`
 	Signature string `json:"signature"`
 	PublicKey string `json:"public_key"`
+	// Script is the hex unlocking script. When empty, Signature and PublicKey
+	// unlock a pay-to-public-key-hash output.
+	Script string `json:"script,omitempty"`
 }
 type Transaction struct {
 	ID        string     `json:"id"`
 	Inputs    []TxInput  `json:"inputs"`
 	Outputs   []TxOutput `json:"outputs"`
 	Timestamp int64      `json:"timestamp"`
+	// Height is the block height a coinbase transaction belongs to.
+	// It makes coinbase IDs unique across blocks.
+	Height int `json:"height,omitempty"`
+	// LockTime is the block height (below LockTimeThreshold) or Unix time
+	// the chain must pass before the transaction can be mined; 0 for none
+	LockTime uint32 `json:"lock_time,omitempty"`
 }
 
 func NewTransaction(inputs []TxInput, outputs []TxOutput) *Transaction {
@@ -37,7 +47,7 @@ func NewTransaction(inputs []TxInput, outputs []TxOutput) *Transaction {
 	tx.ID = tx.CalculateID()
 	return tx
 }
-func NewCoinbaseTransaction(toAddress string, amount float64) *Transaction {
+func NewCoinbaseTransaction(toAddress string, amount Amount) *Transaction {
 	// Coinbase has no inputs (special case)
 	output := TxOutput{
 		Address: toAddress,
@@ -62,31 +72,44 @@ func NewCoinbaseTransaction(toAddress string, amount float64) *Transaction {
 
 	return tx
 }
-func (tx *Transaction) CalculateID() string {
-	// Create a copy for ID calculation (without ID field)
-	txCopy := &Transaction{
-		Inputs:    tx.Inputs,
-		Outputs:   tx.Outputs,
-		Timestamp: tx.Timestamp,
+
+// NewBlockCoinbaseTransaction creates the coinbase transaction for the block at
+// the given height, paying amount (subsidy plus fees) to toAddress
+func NewBlockCoinbaseTransaction(toAddress string, amount Amount, height int) *Transaction {
+	tx := &Transaction{
+		Inputs:    []TxInput{},
+		Outputs:   []TxOutput{{Address: toAddress, Amount: amount}},
+		Timestamp: 0,
+		Height:    height,
 	}
 
-	// Serialize to JSON (sorted for consistency)
-	jsonData, err := json.Marshal(txCopy)
-	if err != nil {
-		return ""
+	tx.ID = tx.CalculateID()
+	for i := range tx.Outputs {
+		tx.Outputs[i].TxID = tx.ID
+		tx.Outputs[i].Index = i
 	}
 
-	// Double SHA256 (like Bitcoin)
-	firstHash := sha256.Sum256(jsonData)
-	secondHash := sha256.Sum256(firstHash[:])
+	return tx
+}
+
+// CalculateID returns the double SHA256 of the canonical binary encoding of
+// the transaction without its ID and signatures
+func (tx *Transaction) CalculateID() string {
+	return hex.EncodeToString(doubleSHA256(tx.idPreimage()))
+}
 
-	return hex.EncodeToString(secondHash[:])
+// Hash returns the double SHA256 of the complete binary encoding, including the
+// ID and input signatures. Blocks commit to this value in their Merkle root.
+func (tx *Transaction) Hash() []byte {
+	data, _ := tx.MarshalBinary()
+	return doubleSHA256(data)
 }
+
 func (tx *Transaction) IsCoinbase() bool {
 	return len(tx.Inputs) == 0
 }
-func (tx *Transaction) GetInputAmount(utxoSet map[string]map[int]TxOutput) float64 {
-	var amount float64
+func (tx *Transaction) GetInputAmount(utxoSet map[string]map[int]TxOutput) Amount {
+	var amount Amount
 	for _, input := range tx.Inputs {
 		// Look up the referenced output in the UTXO set
 		if outputs, exists := utxoSet[input.TxID]; exists {
@@ -97,19 +120,36 @@ func (tx *Transaction) GetInputAmount(utxoSet map[string]map[int]TxOutput) float
 	}
 	return amount
 }
-func (tx *Transaction) GetOutputAmount() float64 {
-	var amount float64
+func (tx *Transaction) GetOutputAmount() Amount {
+	var amount Amount
 	for _, output := range tx.Outputs {
 		amount += output.Amount
 	}
 	return amount
 }
 
-func (tx *Transaction) GetFee(utxoSet map[string]map[int]TxOutput) float64 {
+// outputTotal sums the outputs with overflow checking
+func (tx *Transaction) outputTotal() (Amount, error) {
+	var total Amount
+	for i, output := range tx.Outputs {
+		var err error
+		if total, err = total.Add(output.Amount); err != nil {
+			return 0, fmt.Errorf("invalid output total at output %d: %w", i, err)
+		}
+	}
+	return total, nil
+}
+
+// GetFee returns inputs minus outputs, or 0 when the outputs exceed the inputs
+func (tx *Transaction) GetFee(utxoSet map[string]map[int]TxOutput) Amount {
 	if tx.IsCoinbase() {
 		return 0 // Coinbase transactions have no fee
 	}
-	return tx.GetInputAmount(utxoSet) - tx.GetOutputAmount()
+	fee, err := tx.GetInputAmount(utxoSet).Sub(tx.GetOutputAmount())
+	if err != nil {
+		return 0
+	}
+	return fee
 }
 func (tx *Transaction) ToJSON() (string, error) {
 	jsonData, err := json.MarshalIndent(tx, "", "  ")
@@ -144,14 +184,21 @@ func (tx *Transaction) ValidateBasic() error {
 		if output.Address == "" {
 			return fmt.Errorf("output %d has empty address", i)
 		}
-		if output.Amount <= 0 {
-			return fmt.Errorf("output %d has invalid amount: %f", i, output.Amount)
+		if output.Amount == 0 {
+			return fmt.Errorf("output %d has invalid amount: %s", i, output.Amount)
+		}
+		if !output.Amount.IsValid() {
+			return fmt.Errorf("output %d amount %s exceeds maximum %s", i, output.Amount, MaxMoney)
 		}
-		if !strings.HasPrefix(output.Address, "0x") {
-			return fmt.Errorf("output %d has invalid address format: %s", i, output.Address)
+		if err := ValidateAddressFormat(output.Address); err != nil {
+			return fmt.Errorf("output %d has invalid address format: %w", i, err)
 		}
 	}
 
+	if _, err := tx.outputTotal(); err != nil {
+		return err
+	}
+
 	// Validate inputs (except for coinbase)
 	if !tx.IsCoinbase() {
 		for i, input := range tx.Inputs {
@@ -164,12 +211,16 @@ func (tx *Transaction) ValidateBasic() error {
 		}
 	}
 
+	if tx.ID != tx.CalculateID() {
+		return fmt.Errorf("transaction ID %s does not match its contents", tx.ID)
+	}
+
 	return nil
 }
 
 // String returns a string representation of the transaction
 func (tx *Transaction) String() string {
-	return fmt.Sprintf("Transaction{ID: %s, Inputs: %d, Outputs: %d, Amount: %.8f}",
+	return fmt.Sprintf("Transaction{ID: %s, Inputs: %d, Outputs: %d, Amount: %s}",
 		tx.ID[:8]+"...", len(tx.Inputs), len(tx.Outputs), tx.GetOutputAmount())
 }
 
@@ -2,13 +2,13 @@ package transactions
 
 import (
 	"crypto/ecdsa"
-	"crypto/elliptic"
 	"crypto/rand"
 	"log"
 	"math"
 	"strings"
 	"testing"
 
+	"github.com/aliexe/blockChain/internal/crypto"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
@@ -18,17 +18,24 @@ import (
 var (
 	testPrivateKey *ecdsa.PrivateKey
 	testPublicKey  *ecdsa.PublicKey
-	testAddress    = "0x1234567890123456789012345678901234567890"
-	testAddress2   = "0xabcdefabcdefabcdefabcdefabcdefabcdefabcd"
+	testAddress    = "mxm1qzg69v7yszg69v7yszg69v7yszg69v7yspnqvlg"
+	testAddress2   = "mxm1q40x7l27da74ummatehh6hn0040x7l27d089jkk"
+	testKeyAddress string // Pay-to-public-key-hash address of testPrivateKey
 )
 
 func init() {
 	var err error
-	testPrivateKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	testPrivateKey, err = ecdsa.GenerateKey(crypto.Secp256k1(), rand.Reader)
 	if err != nil {
 		log.Fatalf("Failed to generate test key: %v", err)
 	}
 	testPublicKey = &testPrivateKey.PublicKey
+
+	keyPair, err := crypto.GetKeyPairFromPrivate(testPrivateKey)
+	if err != nil {
+		log.Fatalf("Failed to derive test address: %v", err)
+	}
+	testKeyAddress = keyPair.Address
 }
 
 // TransactionTestSuite defines the test suite
@@ -46,7 +53,7 @@ func (suite *TransactionTestSuite) TestNewTransaction() {
 		{TxID: "tx123", Index: 0, Signature: "", PublicKey: ""},
 	}
 	outputs := []TxOutput{
-		{Address: testAddress, Amount: 1.0, TxID: "", Index: 0},
+		{Address: testAddress, Amount: 1.0 * Coin, TxID: "", Index: 0},
 	}
 
 	tx := NewTransaction(inputs, outputs)
@@ -57,7 +64,7 @@ func (suite *TransactionTestSuite) TestNewTransaction() {
 }
 
 func TestNewCoinbaseTransaction(t *testing.T) {
-	tx := NewCoinbaseTransaction(testAddress, 12.5)
+	tx := NewCoinbaseTransaction(testAddress, 12.5*Coin)
 
 	if !tx.IsCoinbase() {
 		t.Error("Transaction should be coinbase")
@@ -75,8 +82,8 @@ func TestNewCoinbaseTransaction(t *testing.T) {
 		t.Errorf("Expected address %s, got %s", testAddress, tx.Outputs[0].Address)
 	}
 
-	if tx.Outputs[0].Amount != 12.5 {
-		t.Errorf("Expected amount 12.5, got %f", tx.Outputs[0].Amount)
+	if tx.Outputs[0].Amount != 12.5*Coin {
+		t.Errorf("Expected amount 12.5, got %v", tx.Outputs[0].Amount)
 	}
 }
 
@@ -85,7 +92,7 @@ func TestCalculateID(t *testing.T) {
 		{TxID: "tx123", Index: 0, Signature: "", PublicKey: ""},
 	}
 	outputs := []TxOutput{
-		{Address: testAddress, Amount: 1.0, TxID: "", Index: 0},
+		{Address: testAddress, Amount: 1.0 * Coin, TxID: "", Index: 0},
 	}
 
 	tx := NewTransaction(inputs, outputs)
@@ -97,7 +104,7 @@ func TestCalculateID(t *testing.T) {
 	}
 
 	// Modify transaction and check ID changes
-	tx.Outputs[0].Amount = 2.0
+	tx.Outputs[0].Amount = 2.0 * Coin
 	id3 := tx.CalculateID()
 
 	if id1 == id3 {
@@ -107,15 +114,15 @@ func TestCalculateID(t *testing.T) {
 
 func TestGetOutputAmount(t *testing.T) {
 	outputs := []TxOutput{
-		{Address: testAddress, Amount: 1.5, TxID: "", Index: 0},
-		{Address: testAddress2, Amount: 2.5, TxID: "", Index: 1},
+		{Address: testAddress, Amount: 1.5 * Coin, TxID: "", Index: 0},
+		{Address: testAddress2, Amount: 2.5 * Coin, TxID: "", Index: 1},
 	}
 
 	tx := NewTransaction([]TxInput{}, outputs)
 	amount := tx.GetOutputAmount()
 
-	if amount != 4.0 {
-		t.Errorf("Expected total amount 4.0, got %f", amount)
+	if amount != 4.0*Coin {
+		t.Errorf("Expected total amount 4.0, got %v", amount)
 	}
 }
 
@@ -129,7 +136,7 @@ func TestValidateBasic(t *testing.T) {
 			name: "valid transaction",
 			tx: NewTransaction(
 				[]TxInput{{TxID: "tx123", Index: 0}},
-				[]TxOutput{{Address: testAddress, Amount: 1.0}},
+				[]TxOutput{{Address: testAddress, Amount: 1.0 * Coin}},
 			),
 			wantErr: false,
 		},
@@ -142,15 +149,15 @@ func TestValidateBasic(t *testing.T) {
 			name: "empty address",
 			tx: NewTransaction(
 				[]TxInput{{TxID: "tx123", Index: 0}},
-				[]TxOutput{{Address: "", Amount: 1.0}},
+				[]TxOutput{{Address: "", Amount: 1.0 * Coin}},
 			),
 			wantErr: true,
 		},
 		{
-			name: "negative amount",
+			name: "zero amount",
 			tx: NewTransaction(
 				[]TxInput{{TxID: "tx123", Index: 0}},
-				[]TxOutput{{Address: testAddress, Amount: -1.0}},
+				[]TxOutput{{Address: testAddress, Amount: 0}},
 			),
 			wantErr: true,
 		},
@@ -172,13 +179,13 @@ func TestSignTransaction(t *testing.T) {
 		{TxID: "tx123", Index: 0, Signature: "", PublicKey: ""},
 	}
 	outputs := []TxOutput{
-		{Address: testAddress, Amount: 1.0, TxID: "", Index: 0},
+		{Address: testAddress, Amount: 1.0 * Coin, TxID: "", Index: 0},
 	}
 	tx := NewTransaction(inputs, outputs)
 
 	// Create referenced output
 	referencedOutputs := []TxOutput{
-		{Address: testAddress2, Amount: 2.0, TxID: "tx123", Index: 0},
+		{Address: testAddress2, Amount: 2.0 * Coin, TxID: "tx123", Index: 0},
 	}
 
 	// Sign transaction
@@ -204,12 +211,12 @@ func TestVerifyInputSignature(t *testing.T) {
 		{TxID: "tx123", Index: 0, Signature: "", PublicKey: ""},
 	}
 	outputs := []TxOutput{
-		{Address: testAddress, Amount: 1.0, TxID: "", Index: 0},
+		{Address: testAddress, Amount: 1.0 * Coin, TxID: "", Index: 0},
 	}
 	tx := NewTransaction(inputs, outputs)
 
 	referencedOutputs := []TxOutput{
-		{Address: testAddress2, Amount: 2.0, TxID: "tx123", Index: 0},
+		{Address: testAddress2, Amount: 2.0 * Coin, TxID: "tx123", Index: 0},
 	}
 
 	err := tx.SignTransaction(0, testPrivateKey, referencedOutputs)
@@ -250,7 +257,7 @@ func TestValidateAmounts(t *testing.T) {
 	}{
 		{
 			name:    "valid coinbase",
-			tx:      NewCoinbaseTransaction(testAddress, 12.5),
+			tx:      NewCoinbaseTransaction(testAddress, 12.5*Coin),
 			wantErr: false,
 		},
 		{
@@ -260,7 +267,7 @@ func TestValidateAmounts(t *testing.T) {
 		},
 		{
 			name:    "valid regular transaction",
-			tx:      NewCoinbaseTransaction(testAddress, 1.0),
+			tx:      NewCoinbaseTransaction(testAddress, 1.0*Coin),
 			wantErr: false,
 		},
 	}
@@ -279,38 +286,38 @@ func TestValidateAmounts(t *testing.T) {
 func TestCalculateChange(t *testing.T) {
 	tests := []struct {
 		name         string
-		inputAmount  float64
-		outputAmount float64
-		desiredFee   float64
-		wantChange   float64
-		wantFee      float64
+		inputAmount  Amount
+		outputAmount Amount
+		desiredFee   Amount
+		wantChange   Amount
+		wantFee      Amount
 		wantErr      bool
 	}{
 		{
 			name:         "normal case",
-			inputAmount:  1.0,
-			outputAmount: 0.8,
-			desiredFee:   0.1,
-			wantChange:   0.1,
-			wantFee:      0.2,
+			inputAmount:  1.0 * Coin,
+			outputAmount: 0.8 * Coin,
+			desiredFee:   0.1 * Coin,
+			wantChange:   0.1 * Coin,
+			wantFee:      0.2 * Coin,
 			wantErr:      false,
 		},
 		{
 			name:         "no change",
-			inputAmount:  1.0,
-			outputAmount: 0.9,
-			desiredFee:   0.1,
-			wantChange:   0.0,
-			wantFee:      0.1,
+			inputAmount:  1.0 * Coin,
+			outputAmount: 0.9 * Coin,
+			desiredFee:   0.1 * Coin,
+			wantChange:   0.0 * Coin,
+			wantFee:      0.1 * Coin,
 			wantErr:      false,
 		},
 		{
 			name:         "insufficient input",
-			inputAmount:  0.5,
-			outputAmount: 0.8,
-			desiredFee:   0.1,
-			wantChange:   0.0,
-			wantFee:      0.0,
+			inputAmount:  0.5 * Coin,
+			outputAmount: 0.8 * Coin,
+			desiredFee:   0.1 * Coin,
+			wantChange:   0.0 * Coin,
+			wantFee:      0.0 * Coin,
 			wantErr:      true,
 		},
 	}
@@ -322,10 +329,10 @@ func TestCalculateChange(t *testing.T) {
 				t.Errorf("CalculateChange() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if math.Abs(change-tt.wantChange) > 1e-8 {
+			if change != tt.wantChange {
 				t.Errorf("CalculateChange() change = %v, want %v", change, tt.wantChange)
 			}
-			if math.Abs(fee-tt.wantFee) > 1e-8 {
+			if fee != tt.wantFee {
 				t.Errorf("CalculateChange() fee = %v, want %v", fee, tt.wantFee)
 			}
 		})
@@ -338,12 +345,13 @@ func TestValidateAddressFormat(t *testing.T) {
 		address string
 		wantErr bool
 	}{
-		{"valid address", "0x1234567890123456789012345678901234567890", false},
+		{"valid address", "mxm1qzg69v7yszg69v7yszg69v7yszg69v7yspnqvlg", false},
 		{"empty address", "", true},
-		{"too short", "0x123", true},
-		{"too long", "0x12345678901234567890123456789012345678901", true},
-		{"missing prefix", "1234567890123456789012345678901234567890", true},
-		{"invalid hex", "0xg234567890123456789012345678901234567890", true},
+		{"too short", "mxm1qzg69v7ys", true},
+		{"too long", "mxm1qzg69v7yszg69v7yszg69v7yszg69v7yspnqvlgq", true},
+		{"missing prefix", "qzg69v7yszg69v7yszg69v7yszg69v7yspnqvlg", true},
+		{"typo", "mxm1qzg69v7yszg69v7yszg69v7yszg69v8yspnqvlg", true},
+		{"old hex format", "0x1234567890123456789012345678901234567890", true},
 	}
 
 	for _, tt := range tests {
@@ -357,7 +365,7 @@ func TestValidateAddressFormat(t *testing.T) {
 }
 
 func TestCreateSimpleTransaction(t *testing.T) {
-	tx := CreateSimpleTransaction("tx123", 0, testAddress, 1.0, testAddress2)
+	tx := CreateSimpleTransaction("tx123", 0, testAddress, 1.0*Coin, testAddress2)
 
 	if len(tx.Inputs) != 1 {
 		t.Errorf("Expected 1 input, got %d", len(tx.Inputs))
@@ -375,8 +383,8 @@ func TestCreateSimpleTransaction(t *testing.T) {
 		t.Errorf("Expected first output address %s, got %s", testAddress, tx.Outputs[0].Address)
 	}
 
-	if tx.Outputs[0].Amount != 1.0 {
-		t.Errorf("Expected first output amount 1.0, got %f", tx.Outputs[0].Amount)
+	if tx.Outputs[0].Amount != 1.0*Coin {
+		t.Errorf("Expected first output amount 1.0, got %v", tx.Outputs[0].Amount)
 	}
 }
 
@@ -386,19 +394,19 @@ func TestCalculateOptimalFee(t *testing.T) {
 		inputCount  int
 		outputCount int
 		priority    float64
-		expected    float64
+		expected    Amount
 	}{
-		{"low priority", 1, 1, 0.5, 0.00005},
-		{"normal priority", 1, 1, 1.0, 0.0001},
-		{"high priority", 1, 1, 2.0, 0.0002},
-		{"multiple inputs", 3, 2, 1.0, 0.000105},
+		{"low priority", 1, 1, 0.5, 0.00005 * Coin},
+		{"normal priority", 1, 1, 1.0, 0.0001 * Coin},
+		{"high priority", 1, 1, 2.0, 0.0002 * Coin},
+		{"multiple inputs", 3, 2, 1.0, 0.000105 * Coin},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			fee := CalculateOptimalFee(tt.inputCount, tt.outputCount, tt.priority)
 			// Allow for small rounding differences
-			if fee < tt.expected*0.9 || fee > tt.expected*1.1 {
+			if fee < tt.expected*9/10 || fee > tt.expected*11/10 {
 				t.Errorf("CalculateOptimalFee() = %v, expected around %v", fee, tt.expected)
 			}
 		})
@@ -430,7 +438,7 @@ func TestEstimateTransactionSize(t *testing.T) {
 func TestGetTransactionSummary(t *testing.T) {
 	tx := NewTransaction(
 		[]TxInput{{TxID: "tx123", Index: 0}},
-		[]TxOutput{{Address: testAddress, Amount: 1.0}},
+		[]TxOutput{{Address: testAddress, Amount: 1.0 * Coin}},
 	)
 
 	summary := tx.GetTransactionSummary(make(map[string]map[int]TxOutput))
@@ -443,7 +451,7 @@ func TestGetTransactionSummary(t *testing.T) {
 		t.Errorf("Expected output_count 1, got %v", summary["output_count"])
 	}
 
-	if summary["total_output"].(float64) != 1.0 {
+	if summary["total_output"].(Amount) != 1.0*Coin {
 		t.Errorf("Expected total_output 1.0, got %v", summary["total_output"])
 	}
 }
@@ -451,7 +459,7 @@ func TestGetTransactionSummary(t *testing.T) {
 func TestCloneTransaction(t *testing.T) {
 	original := NewTransaction(
 		[]TxInput{{TxID: "tx123", Index: 0}},
-		[]TxOutput{{Address: testAddress, Amount: 1.0}},
+		[]TxOutput{{Address: testAddress, Amount: 1.0 * Coin}},
 	)
 
 	clone := original.CloneTransaction()
@@ -466,8 +474,8 @@ func TestCloneTransaction(t *testing.T) {
 	}
 
 	// Modify clone and verify original is unchanged
-	clone.Outputs[0].Amount = 2.0
-	if original.Outputs[0].Amount != 1.0 {
+	clone.Outputs[0].Amount = 2.0 * Coin
+	if original.Outputs[0].Amount != 1.0*Coin {
 		t.Error("Original should not be affected by clone modification")
 	}
 }
@@ -480,14 +488,14 @@ func TestGetTransactionType(t *testing.T) {
 	}{
 		{
 			name:     "coinbase",
-			tx:       NewCoinbaseTransaction(testAddress, 12.5),
+			tx:       NewCoinbaseTransaction(testAddress, 12.5*Coin),
 			expected: "coinbase",
 		},
 		{
 			name: "simple transfer",
 			tx: NewTransaction(
 				[]TxInput{{TxID: "tx123", Index: 0}},
-				[]TxOutput{{Address: testAddress, Amount: 1.0}},
+				[]TxOutput{{Address: testAddress, Amount: 1.0 * Coin}},
 			),
 			expected: "simple_transfer",
 		},
@@ -496,9 +504,9 @@ func TestGetTransactionType(t *testing.T) {
 			tx: NewTransaction(
 				[]TxInput{{TxID: "tx123", Index: 0}},
 				[]TxOutput{
-					{Address: testAddress, Amount: 0.5},
-					{Address: testAddress2, Amount: 0.3},
-					{Address: testAddress, Amount: 0.2},
+					{Address: testAddress, Amount: 0.5 * Coin},
+					{Address: testAddress2, Amount: 0.3 * Coin},
+					{Address: testAddress, Amount: 0.2 * Coin},
 				},
 			),
 			expected: "multi_output",
@@ -518,7 +526,7 @@ func TestGetTransactionType(t *testing.T) {
 func TestToJSONFromJSON(t *testing.T) {
 	original := NewTransaction(
 		[]TxInput{{TxID: "tx123", Index: 0}},
-		[]TxOutput{{Address: testAddress, Amount: 1.0}},
+		[]TxOutput{{Address: testAddress, Amount: 1.0 * Coin}},
 	)
 
 	// Convert to JSON
@@ -550,7 +558,7 @@ func TestToJSONFromJSON(t *testing.T) {
 func TestString(t *testing.T) {
 	tx := NewTransaction(
 		[]TxInput{{TxID: "tx123", Index: 0}},
-		[]TxOutput{{Address: testAddress, Amount: 1.0}},
+		[]TxOutput{{Address: testAddress, Amount: 1.0 * Coin}},
 	)
 
 	str := tx.String()
@@ -565,7 +573,7 @@ func TestString(t *testing.T) {
 func TestGetInfo(t *testing.T) {
 	tx := NewTransaction(
 		[]TxInput{{TxID: "tx123", Index: 0}},
-		[]TxOutput{{Address: testAddress, Amount: 1.0}},
+		[]TxOutput{{Address: testAddress, Amount: 1.0 * Coin}},
 	)
 
 	utxoSet := make(map[string]map[int]TxOutput)
@@ -579,17 +587,17 @@ func TestGetInfo(t *testing.T) {
 }
 
 func TestCalculateDustThreshold(t *testing.T) {
-	threshold := CalculateDustThreshold(0.00001)
+	threshold := CalculateDustThreshold(1000)
 	if threshold <= 0 {
 		t.Error("Dust threshold should be positive")
 	}
 }
 
 func TestIsDustOutput(t *testing.T) {
-	if !IsDustOutput(0.000001, 0.00001) {
+	if !IsDustOutput(0.000001*Coin, 1000) {
 		t.Error("Very small output should be dust")
 	}
-	if IsDustOutput(1.0, 0.00001) {
+	if IsDustOutput(1.0*Coin, 1000) {
 		t.Error("Large output should not be dust")
 	}
 }
@@ -598,13 +606,13 @@ func TestOptimizeTransaction(t *testing.T) {
 	tx := NewTransaction(
 		[]TxInput{{TxID: "tx123", Index: 0}},
 		[]TxOutput{
-			{Address: testAddress, Amount: 1.0},
-			{Address: testAddress2, Amount: 0.000001}, // dust
+			{Address: testAddress, Amount: 1.0 * Coin},
+			{Address: testAddress2, Amount: 0.000001 * Coin}, // dust
 		},
 	)
 
 	originalOutputs := len(tx.Outputs)
-	tx.OptimizeTransaction(0.00001)
+	tx.OptimizeTransaction(0.00001 * Coin)
 	if len(tx.Outputs) >= originalOutputs {
 		t.Error("Dust should be removed or consolidated")
 	}
@@ -613,11 +621,11 @@ func TestOptimizeTransaction(t *testing.T) {
 func TestMergeTransactions(t *testing.T) {
 	tx1 := NewTransaction(
 		[]TxInput{{TxID: "tx1", Index: 0}},
-		[]TxOutput{{Address: testAddress, Amount: 1.0}},
+		[]TxOutput{{Address: testAddress, Amount: 1.0 * Coin}},
 	)
 	tx2 := NewTransaction(
 		[]TxInput{{TxID: "tx2", Index: 0}},
-		[]TxOutput{{Address: testAddress2, Amount: 2.0}},
+		[]TxOutput{{Address: testAddress2, Amount: 2.0 * Coin}},
 	)
 
 	merged := MergeTransactions([]*Transaction{tx1, tx2})
@@ -632,11 +640,11 @@ func TestMergeTransactions(t *testing.T) {
 func TestValidateTransactionBalance(t *testing.T) {
 	tx := NewTransaction(
 		[]TxInput{{TxID: "tx123", Index: 0}},
-		[]TxOutput{{Address: testAddress, Amount: 1.0}},
+		[]TxOutput{{Address: testAddress, Amount: 1.0 * Coin}},
 	)
 
 	utxoSet := map[string]map[int]TxOutput{
-		"tx123": {0: {Address: testAddress2, Amount: 2.0}},
+		"tx123": {0: {Address: testAddress2, Amount: 2.0 * Coin}},
 	}
 
 	err := tx.ValidateTransactionBalance(utxoSet)
@@ -645,7 +653,7 @@ func TestValidateTransactionBalance(t *testing.T) {
 	// Test with insufficient input
 	tx2 := NewTransaction(
 		[]TxInput{{TxID: "tx123", Index: 0}},
-		[]TxOutput{{Address: testAddress, Amount: 3.0}}, // More than input
+		[]TxOutput{{Address: testAddress, Amount: 3.0 * Coin}}, // More than input
 	)
 	err = tx2.ValidateTransactionBalance(utxoSet)
 	assert.Error(t, err, "Should error with insufficient input")
@@ -659,11 +667,11 @@ func TestValidateTransactionBalance(t *testing.T) {
 func TestValidateInputs(t *testing.T) {
 	tx := NewTransaction(
 		[]TxInput{{TxID: "tx123", Index: 0}},
-		[]TxOutput{{Address: testAddress, Amount: 1.0}},
+		[]TxOutput{{Address: testAddress, Amount: 1.0 * Coin}},
 	)
 
 	utxoSet := map[string]map[int]TxOutput{
-		"tx123": {0: {Address: testAddress2, Amount: 2.0}},
+		"tx123": {0: {Address: testAddress2, Amount: 2.0 * Coin}},
 	}
 
 	err := tx.ValidateInputs(utxoSet)
@@ -673,17 +681,17 @@ func TestValidateInputs(t *testing.T) {
 }
 
 func TestCreateChangeOutput(t *testing.T) {
-	output := CreateChangeOutput(testAddress, 0.5)
+	output := CreateChangeOutput(testAddress, 0.5*Coin)
 	if output.Address != testAddress {
 		t.Errorf("Expected address %s, got %s", testAddress, output.Address)
 	}
-	if output.Amount != 0.5 {
-		t.Errorf("Expected amount 0.5, got %f", output.Amount)
+	if output.Amount != 0.5*Coin {
+		t.Errorf("Expected amount 0.5, got %v", output.Amount)
 	}
 }
 
 func TestValidateTransactionStructure(t *testing.T) {
-	tx := NewCoinbaseTransaction(testAddress, 1.0)
+	tx := NewCoinbaseTransaction(testAddress, 1.0*Coin)
 	utxoSet := map[string]map[int]TxOutput{}
 
 	err := tx.ValidateTransactionStructure(utxoSet)
@@ -693,7 +701,7 @@ func TestValidateTransactionStructure(t *testing.T) {
 }
 
 func TestGetValidationReport(t *testing.T) {
-	tx := NewCoinbaseTransaction(testAddress, 1.0)
+	tx := NewCoinbaseTransaction(testAddress, 1.0*Coin)
 	utxoSet := map[string]map[int]TxOutput{}
 
 	report := tx.GetValidationReport(utxoSet)
@@ -708,11 +716,11 @@ func TestGetValidationReport(t *testing.T) {
 func TestGetInputPublicKey(t *testing.T) {
 	tx := NewTransaction(
 		[]TxInput{{TxID: "tx123", Index: 0}},
-		[]TxOutput{{Address: testAddress, Amount: 1.0}},
+		[]TxOutput{{Address: testAddress, Amount: 1.0 * Coin}},
 	)
 
 	referencedOutputs := []TxOutput{
-		{Address: testAddress2, Amount: 2.0},
+		{Address: testAddress2, Amount: 2.0 * Coin},
 	}
 
 	err := tx.SignTransaction(0, testPrivateKey, referencedOutputs)
@@ -732,11 +740,11 @@ func TestGetInputPublicKey(t *testing.T) {
 func TestSignAllInputs(t *testing.T) {
 	tx := NewTransaction(
 		[]TxInput{{TxID: "tx123", Index: 0}},
-		[]TxOutput{{Address: testAddress, Amount: 1.0}},
+		[]TxOutput{{Address: testAddress, Amount: 1.0 * Coin}},
 	)
 
 	referencedOutputs := [][]TxOutput{
-		{{Address: testAddress2, Amount: 2.0}},
+		{{Address: testAddress2, Amount: 2.0 * Coin}},
 	}
 
 	err := tx.SignAllInputs([]*ecdsa.PrivateKey{testPrivateKey}, referencedOutputs)
@@ -750,11 +758,11 @@ func TestSignAllInputs(t *testing.T) {
 func TestVerifyAllSignatures(t *testing.T) {
 	tx := NewTransaction(
 		[]TxInput{{TxID: "tx123", Index: 0}},
-		[]TxOutput{{Address: testAddress, Amount: 1.0}},
+		[]TxOutput{{Address: testAddress, Amount: 1.0 * Coin}},
 	)
 
 	referencedOutputs := [][]TxOutput{
-		{{Address: testAddress2, Amount: 2.0}},
+		{{Address: testAddress2, Amount: 2.0 * Coin}},
 	}
 
 	err := tx.SignAllInputs([]*ecdsa.PrivateKey{testPrivateKey}, referencedOutputs)
@@ -766,7 +774,7 @@ func TestVerifyAllSignatures(t *testing.T) {
 	// Test with unsigned transaction
 	tx2 := NewTransaction(
 		[]TxInput{{TxID: "tx123", Index: 0}},
-		[]TxOutput{{Address: testAddress, Amount: 1.0}},
+		[]TxOutput{{Address: testAddress, Amount: 1.0 * Coin}},
 	)
 	err = tx2.VerifyAllSignatures(referencedOutputs)
 	assert.Error(t, err, "Should error on unsigned transaction")
@@ -775,7 +783,7 @@ func TestVerifyAllSignatures(t *testing.T) {
 func TestGetSignatureInfo(t *testing.T) {
 	tx := NewTransaction(
 		[]TxInput{{TxID: "tx123", Index: 0}},
-		[]TxOutput{{Address: testAddress, Amount: 1.0}},
+		[]TxOutput{{Address: testAddress, Amount: 1.0 * Coin}},
 	)
 
 	info := tx.GetSignatureInfo()
@@ -802,7 +810,7 @@ func TestValidateTransactionStructureInvalid(t *testing.T) {
 
 func TestValidateTransactionStructureInvalidAddress(t *testing.T) {
 	// Transaction with invalid address
-	tx := NewCoinbaseTransaction("invalid_address", 1.0)
+	tx := NewCoinbaseTransaction("invalid_address", 1.0*Coin)
 	utxoSet := map[string]map[int]TxOutput{}
 
 	err := tx.ValidateTransactionStructure(utxoSet)
@@ -821,7 +829,7 @@ func TestTransactionTestSuite(t *testing.T) {
 // Benchmark tests
 func BenchmarkNewTransaction(b *testing.B) {
 	inputs := []TxInput{{TxID: "tx123", Index: 0}}
-	outputs := []TxOutput{{Address: testAddress, Amount: 1.0}}
+	outputs := []TxOutput{{Address: testAddress, Amount: 1.0 * Coin}}
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
@@ -832,7 +840,7 @@ func BenchmarkNewTransaction(b *testing.B) {
 func BenchmarkCalculateID(b *testing.B) {
 	tx := NewTransaction(
 		[]TxInput{{TxID: "tx123", Index: 0}},
-		[]TxOutput{{Address: testAddress, Amount: 1.0}},
+		[]TxOutput{{Address: testAddress, Amount: 1.0 * Coin}},
 	)
 
 	b.ResetTimer()
@@ -844,10 +852,10 @@ func BenchmarkCalculateID(b *testing.B) {
 func BenchmarkSignTransaction(b *testing.B) {
 	tx := NewTransaction(
 		[]TxInput{{TxID: "tx123", Index: 0}},
-		[]TxOutput{{Address: testAddress, Amount: 1.0}},
+		[]TxOutput{{Address: testAddress, Amount: 1.0 * Coin}},
 	)
 	referencedOutputs := []TxOutput{
-		{Address: testAddress2, Amount: 2.0, TxID: "tx123", Index: 0},
+		{Address: testAddress2, Amount: 2.0 * Coin, TxID: "tx123", Index: 0},
 	}
 
 	b.ResetTimer()
@@ -874,7 +882,7 @@ func TestCalculateIDWithInvalidData(t *testing.T) {
 	tx := &Transaction{
 		ID:        "",
 		Inputs:    []TxInput{{TxID: "", Index: -1}},
-		Outputs:   []TxOutput{{Address: "", Amount: -1}},
+		Outputs:   []TxOutput{{Address: "", Amount: 0}},
 		Timestamp: 0,
 	}
 
@@ -889,8 +897,8 @@ func TestToJSONWithComplexTransaction(t *testing.T) {
 			{TxID: "tx456", Index: 1, Signature: "sig456", PublicKey: "key456"},
 		},
 		[]TxOutput{
-			{Address: testAddress, Amount: 1.5, TxID: "out1", Index: 0},
-			{Address: testAddress2, Amount: 2.5, TxID: "out2", Index: 1},
+			{Address: testAddress, Amount: 1.5 * Coin, TxID: "out1", Index: 0},
+			{Address: testAddress2, Amount: 2.5 * Coin, TxID: "out2", Index: 1},
 		},
 	)
 	tx.Timestamp = 1234567890
@@ -914,7 +922,7 @@ func TestValidateAmountsComprehensive(t *testing.T) {
 			tx: &Transaction{
 				ID:      "test",
 				Inputs:  []TxInput{},
-				Outputs: []TxOutput{{Address: testAddress, Amount: 1.0}, {Address: testAddress2, Amount: 2.0}},
+				Outputs: []TxOutput{{Address: testAddress, Amount: 1.0 * Coin}, {Address: testAddress2, Amount: 2.0 * Coin}},
 			},
 			wantErr: true,
 			errMsg:  "coinbase transaction must have exactly one output",
@@ -934,7 +942,7 @@ func TestValidateAmountsComprehensive(t *testing.T) {
 			tx: &Transaction{
 				ID:      "test",
 				Inputs:  []TxInput{{TxID: "prev", Index: 0}},
-				Outputs: []TxOutput{{Address: testAddress, Amount: 2.0}},
+				Outputs: []TxOutput{{Address: testAddress, Amount: 2.0 * Coin}},
 			},
 			wantErr: true,
 			errMsg:  "exceeds input amount",
@@ -965,10 +973,10 @@ func TestValidateTransactionStructureComprehensive(t *testing.T) {
 			name: "valid transaction",
 			tx: NewTransaction(
 				[]TxInput{{TxID: "prev", Index: 0}},
-				[]TxOutput{{Address: testAddress, Amount: 1.0}},
+				[]TxOutput{{Address: testAddress, Amount: 1.0 * Coin}},
 			),
 			utxoSet: map[string]map[int]TxOutput{
-				"prev": {0: {Address: testAddress2, Amount: 2.0}},
+				"prev": {0: {Address: testAddress2, Amount: 2.0 * Coin}},
 			},
 			wantErr: true, // Will fail signature verification
 		},
@@ -976,10 +984,10 @@ func TestValidateTransactionStructureComprehensive(t *testing.T) {
 			name: "transaction with invalid address format",
 			tx: NewTransaction(
 				[]TxInput{{TxID: "prev", Index: 0}},
-				[]TxOutput{{Address: "invalid", Amount: 1.0}},
+				[]TxOutput{{Address: "invalid", Amount: 1.0 * Coin}},
 			),
 			utxoSet: map[string]map[int]TxOutput{
-				"prev": {0: {Address: testAddress2, Amount: 2.0}},
+				"prev": {0: {Address: testAddress2, Amount: 2.0 * Coin}},
 			},
 			wantErr: true,
 		},
@@ -987,7 +995,7 @@ func TestValidateTransactionStructureComprehensive(t *testing.T) {
 			name: "transaction with unknown UTXO",
 			tx: NewTransaction(
 				[]TxInput{{TxID: "unknown", Index: 0}},
-				[]TxOutput{{Address: testAddress, Amount: 1.0}},
+				[]TxOutput{{Address: testAddress, Amount: 1.0 * Coin}},
 			),
 			utxoSet: map[string]map[int]TxOutput{},
 			wantErr: true,
@@ -1008,7 +1016,7 @@ func TestValidateTransactionStructureComprehensive(t *testing.T) {
 
 func TestGetValidationReportComprehensive(t *testing.T) {
 	// Test valid coinbase
-	tx := NewCoinbaseTransaction(testAddress, 1.0)
+	tx := NewCoinbaseTransaction(testAddress, 1.0*Coin)
 	utxoSet := map[string]map[int]TxOutput{}
 
 	report := tx.GetValidationReport(utxoSet)
@@ -1031,7 +1039,7 @@ func TestGetInputPublicKeyErrorCases(t *testing.T) {
 			name: "index out of range",
 			tx: NewTransaction(
 				[]TxInput{{TxID: "prev", Index: 0}},
-				[]TxOutput{{Address: testAddress, Amount: 1.0}},
+				[]TxOutput{{Address: testAddress, Amount: 1.0 * Coin}},
 			),
 			inputIndex: 5,
 			wantErr:    true,
@@ -1046,7 +1054,7 @@ func TestGetInputPublicKeyErrorCases(t *testing.T) {
 					Signature: "sig",
 					PublicKey: "invalid_key",
 				}},
-				Outputs: []TxOutput{{Address: testAddress, Amount: 1.0}},
+				Outputs: []TxOutput{{Address: testAddress, Amount: 1.0 * Coin}},
 			},
 			inputIndex: 0,
 			wantErr:    true,
@@ -1073,14 +1081,14 @@ func TestGetTransactionTypeAllCases(t *testing.T) {
 	}{
 		{
 			name:     "coinbase",
-			tx:       NewCoinbaseTransaction(testAddress, 1.0),
+			tx:       NewCoinbaseTransaction(testAddress, 1.0*Coin),
 			expected: "coinbase",
 		},
 		{
 			name: "simple transfer",
 			tx: NewTransaction(
 				[]TxInput{{TxID: "prev", Index: 0}},
-				[]TxOutput{{Address: testAddress, Amount: 1.0}},
+				[]TxOutput{{Address: testAddress, Amount: 1.0 * Coin}},
 			),
 			expected: "simple_transfer",
 		},
@@ -1089,9 +1097,9 @@ func TestGetTransactionTypeAllCases(t *testing.T) {
 			tx: NewTransaction(
 				[]TxInput{{TxID: "prev", Index: 0}},
 				[]TxOutput{
-					{Address: testAddress, Amount: 0.5},
-					{Address: testAddress2, Amount: 0.3},
-					{Address: testAddress, Amount: 0.2},
+					{Address: testAddress, Amount: 0.5 * Coin},
+					{Address: testAddress2, Amount: 0.3 * Coin},
+					{Address: testAddress, Amount: 0.2 * Coin},
 				},
 			),
 			expected: "multi_output",
@@ -1104,7 +1112,7 @@ func TestGetTransactionTypeAllCases(t *testing.T) {
 					{TxID: "prev2", Index: 0},
 					{TxID: "prev3", Index: 0},
 				},
-				[]TxOutput{{Address: testAddress, Amount: 1.0}},
+				[]TxOutput{{Address: testAddress, Amount: 1.0 * Coin}},
 			),
 			expected: "consolidation",
 		},
@@ -1113,8 +1121,8 @@ func TestGetTransactionTypeAllCases(t *testing.T) {
 			tx: NewTransaction(
 				[]TxInput{{TxID: "prev", Index: 0}},
 				[]TxOutput{
-					{Address: testAddress, Amount: 0.7},
-					{Address: testAddress2, Amount: 0.3},
+					{Address: testAddress, Amount: 0.7 * Coin},
+					{Address: testAddress2, Amount: 0.3 * Coin},
 				},
 			),
 			expected: "standard",
@@ -1143,11 +1151,11 @@ func TestSignTransactionErrorCases(t *testing.T) {
 			name: "input index out of range",
 			tx: NewTransaction(
 				[]TxInput{{TxID: "prev", Index: 0}},
-				[]TxOutput{{Address: testAddress, Amount: 1.0}},
+				[]TxOutput{{Address: testAddress, Amount: 1.0 * Coin}},
 			),
 			inputIndex:          5,
 			privateKey:          testPrivateKey,
-			referencedTxOutputs: []TxOutput{{Address: testAddress2, Amount: 2.0}},
+			referencedTxOutputs: []TxOutput{{Address: testAddress2, Amount: 2.0 * Coin}},
 			wantErr:             true,
 			errMsg:              "input index 5 out of range",
 		},
@@ -1161,11 +1169,11 @@ func TestSignTransactionErrorCases(t *testing.T) {
 					Signature: "",
 					PublicKey: "",
 				}},
-				Outputs: []TxOutput{{Address: testAddress, Amount: 1.0}},
+				Outputs: []TxOutput{{Address: testAddress, Amount: 1.0 * Coin}},
 			},
 			inputIndex:          0,
 			privateKey:          testPrivateKey,
-			referencedTxOutputs: []TxOutput{{Address: testAddress2, Amount: 2.0}},
+			referencedTxOutputs: []TxOutput{{Address: testAddress2, Amount: 2.0 * Coin}},
 			wantErr:             true,
 			errMsg:              "input 0 has empty tx ID",
 		},
@@ -1211,23 +1219,23 @@ func TestDecodePublicKeyInvalidCases(t *testing.T) {
 func TestGetSigningMessageErrorCases(t *testing.T) {
 	tx := NewTransaction(
 		[]TxInput{{TxID: "prev", Index: 0}},
-		[]TxOutput{{Address: testAddress, Amount: 1.0}},
+		[]TxOutput{{Address: testAddress, Amount: 1.0 * Coin}},
 	)
 
 	// Test with invalid referenced output (index out of range)
-	_, err := tx.getSigningMessage(0, []TxOutput{})
+	_, err := tx.getSigningMessage(0, []TxOutput{}, SigHashAll)
 	assert.NoError(t, err) // Should handle empty case gracefully
 }
 
 func TestValidateInputsComprehensive(t *testing.T) {
 	tx := NewTransaction(
 		[]TxInput{{TxID: "prev", Index: 0}},
-		[]TxOutput{{Address: testAddress, Amount: 1.0}},
+		[]TxOutput{{Address: testAddress, Amount: 1.0 * Coin}},
 	)
 
 	// Test with non-existent output in UTXO set
 	utxoSet := map[string]map[int]TxOutput{
-		"prev": {1: {Address: testAddress2, Amount: 2.0}}, // Different index
+		"prev": {1: {Address: testAddress2, Amount: 2.0 * Coin}}, // Different index
 	}
 	err := tx.ValidateInputs(utxoSet)
 	assert.Error(t, err)
@@ -1235,7 +1243,7 @@ func TestValidateInputsComprehensive(t *testing.T) {
 
 	// Test with valid UTXO but no signature
 	utxoSetValid := map[string]map[int]TxOutput{
-		"prev": {0: {Address: testAddress2, Amount: 2.0}},
+		"prev": {0: {Address: testAddress2, Amount: 2.0 * Coin}},
 	}
 	err = tx.ValidateInputs(utxoSetValid)
 	assert.Error(t, err) // Should fail due to missing signature
@@ -1246,7 +1254,7 @@ func TestValidateAmountsWithValidFee(t *testing.T) {
 	tx := &Transaction{
 		ID:      "test",
 		Inputs:  []TxInput{{TxID: "prev", Index: 0}},
-		Outputs: []TxOutput{{Address: testAddress, Amount: 1.0}},
+		Outputs: []TxOutput{{Address: testAddress, Amount: 1.0 * Coin}},
 	}
 
 	// Mock the GetInputAmount to return a higher value
@@ -1257,18 +1265,27 @@ func TestValidateAmountsWithValidFee(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestValidateAddressForNetwork(t *testing.T) {
+	assert.NoError(t, ValidateAddressForNetwork("mxm1qzg69v7ys40x77y352eufp27daufrg4nc86pypu", crypto.MainNet))
+	assert.Error(t, ValidateAddressForNetwork("tmxm1qzg69v7ys40x77y352eufp27daufrg4ncsgzdjk", crypto.MainNet))
+	assert.NoError(t, ValidateAddressForNetwork("tmxm1qzg69v7ys40x77y352eufp27daufrg4ncsgzdjk", crypto.TestNet))
+}
+
 func TestValidateAddressFormatEdgeCases(t *testing.T) {
 	tests := []struct {
 		name    string
 		address string
 		wantErr bool
 	}{
-		{"valid lowercase", "0x1234567890abcdef1234567890abcdef12345678", false},
-		{"valid uppercase", "0X1234567890ABCDEF1234567890ABCDEF12345678", false},
-		{"mixed case", "0x1234567890AbCdEf1234567890AbCdEf12345678", false},
-		{"invalid character in middle", "0x1234567890g234567890123456789012345678", true},
+		{"valid lowercase", "mxm1qzg69v7ys40x77y352eufp27daufrg4nc86pypu", false},
+		{"valid testnet", "tmxm1qzg69v7ys40x77y352eufp27daufrg4ncsgzdjk", false},
+		{"valid script hash", "mxm1pzg69v7ys40x77y352eufp27daufrg4ncvyk0vh", false},
+		{"uppercase is not canonical", "MXM1QZG69V7YS40X77Y352EUFP27DAUFRG4NC86PYPU", true},
+		{"mixed case", "mxm1qzg69v7ys40x77y352EUFP27daufrg4nc86pypu", true},
+		{"invalid character in middle", "mxm1qzg69v7ys40x77y352eufb27daufrg4nc86pypu", true},
+		{"unknown network", "btc1qzg69v7ys40x77y352eufp27daufrg4nc86pypu", true},
 		{"empty string", "", true},
-		{"only prefix", "0x", true},
+		{"only prefix", "mxm1", true},
 	}
 
 	for _, tt := range tests {
@@ -1286,16 +1303,16 @@ func TestValidateAddressFormatEdgeCases(t *testing.T) {
 func TestValidateTransactionStructureWithSignedTransaction(t *testing.T) {
 	tx := NewTransaction(
 		[]TxInput{{TxID: "prev", Index: 0}},
-		[]TxOutput{{Address: testAddress, Amount: 1.0}},
+		[]TxOutput{{Address: testAddress, Amount: 1.0 * Coin}},
 	)
 
 	// Sign the transaction
-	referencedOutputs := []TxOutput{{Address: testAddress2, Amount: 2.0}}
+	referencedOutputs := []TxOutput{{Address: testKeyAddress, Amount: 2.0 * Coin}}
 	err := tx.SignTransaction(0, testPrivateKey, referencedOutputs)
 	require.NoError(t, err)
 
 	utxoSet := map[string]map[int]TxOutput{
-		"prev": {0: {Address: testAddress2, Amount: 2.0}},
+		"prev": {0: {Address: testKeyAddress, Amount: 2.0 * Coin}},
 	}
 
 	// With proper UTXO set, the transaction should pass all validation
@@ -1307,12 +1324,12 @@ func TestValidateTransactionStructureWithSignedTransaction(t *testing.T) {
 func TestGetValidationReportWithWarnings(t *testing.T) {
 	tx := NewTransaction(
 		[]TxInput{{TxID: "prev", Index: 0}},
-		[]TxOutput{{Address: testAddress, Amount: 0.001}}, // Small amount
+		[]TxOutput{{Address: testAddress, Amount: 0.001 * Coin}}, // Small amount
 	)
 
 	// Create a UTXO that would result in high fee
 	utxoSet := map[string]map[int]TxOutput{
-		"prev": {0: {Address: testAddress2, Amount: 1.0}},
+		"prev": {0: {Address: testAddress2, Amount: 1.0 * Coin}},
 	}
 
 	report := tx.GetValidationReport(utxoSet)
@@ -1330,8 +1347,8 @@ func TestToJSONErrorHandling(t *testing.T) {
 			{TxID: "tx2", Index: 1, Signature: "sig2", PublicKey: "key2"},
 		},
 		[]TxOutput{
-			{Address: testAddress, Amount: 1.5, TxID: "out1", Index: 0},
-			{Address: testAddress2, Amount: 2.5, TxID: "out2", Index: 1},
+			{Address: testAddress, Amount: 1.5 * Coin, TxID: "out1", Index: 0},
+			{Address: testAddress2, Amount: 2.5 * Coin, TxID: "out2", Index: 1},
 		},
 	)
 	tx.Timestamp = 1234567890
@@ -1348,7 +1365,7 @@ func TestCalculateIDJSONErrorHandling(t *testing.T) {
 	tx := &Transaction{
 		ID:        "test",
 		Inputs:    []TxInput{{TxID: "test", Index: 0, Signature: "", PublicKey: ""}},
-		Outputs:   []TxOutput{{Address: testAddress, Amount: 1.5}},
+		Outputs:   []TxOutput{{Address: testAddress, Amount: 1.5 * Coin}},
 		Timestamp: 0,
 	}
 
@@ -1364,7 +1381,7 @@ func TestGetSignatureInfoWithMixedSignatures(t *testing.T) {
 			{TxID: "prev2", Index: 0, Signature: "", PublicKey: ""}, // Unsigned
 			{TxID: "prev3", Index: 0, Signature: "sig3", PublicKey: "key3"},
 		},
-		[]TxOutput{{Address: testAddress, Amount: 1.0}},
+		[]TxOutput{{Address: testAddress, Amount: 1.0 * Coin}},
 	)
 
 	info := tx.GetSignatureInfo()
@@ -1379,7 +1396,7 @@ func TestValidateAmountsWithPositiveAmounts(t *testing.T) {
 	tx := &Transaction{
 		ID:      "test",
 		Inputs:  []TxInput{{TxID: "prev", Index: 0}},
-		Outputs: []TxOutput{{Address: testAddress, Amount: 1.0}},
+		Outputs: []TxOutput{{Address: testAddress, Amount: 1.0 * Coin}},
 	}
 
 	// This should fail due to input amount being 0, but covers the validation logic
@@ -1391,10 +1408,10 @@ func TestValidateAmountsWithPositiveAmounts(t *testing.T) {
 func TestVerifyInputSignatureWithInvalidSignature(t *testing.T) {
 	tx := NewTransaction(
 		[]TxInput{{TxID: "prev", Index: 0, Signature: "invalid_signature", PublicKey: ""}},
-		[]TxOutput{{Address: testAddress, Amount: 1.0}},
+		[]TxOutput{{Address: testAddress, Amount: 1.0 * Coin}},
 	)
 
-	referencedOutputs := []TxOutput{{Address: testAddress2, Amount: 2.0}}
+	referencedOutputs := []TxOutput{{Address: testAddress2, Amount: 2.0 * Coin}}
 	err := tx.VerifyInputSignature(0, referencedOutputs)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "failed to decode signature")
@@ -1407,7 +1424,7 @@ func TestValidateBasicWithInvalidInputIndex(t *testing.T) {
 			TxID:  "prev",
 			Index: -1, // Invalid index
 		}},
-		Outputs: []TxOutput{{Address: testAddress, Amount: 1.0}},
+		Outputs: []TxOutput{{Address: testAddress, Amount: 1.0 * Coin}},
 	}
 
 	err := tx.ValidateBasic()
@@ -1415,6 +1432,20 @@ func TestValidateBasicWithInvalidInputIndex(t *testing.T) {
 	assert.Contains(t, err.Error(), "invalid index")
 }
 
+func TestValidateBasicRejectsMismatchedID(t *testing.T) {
+	tx := NewTransaction(
+		[]TxInput{{TxID: "prev", Index: 0}},
+		[]TxOutput{{Address: testAddress, Amount: 1.0 * Coin}},
+	)
+	require.NoError(t, tx.ValidateBasic())
+
+	// Changing the contents without recomputing the ID breaks the commitment
+	tx.Outputs[0].Amount = 2.0 * Coin
+	err := tx.ValidateBasic()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "does not match its contents")
+}
+
 func TestToJSONWithEmptyTransaction(t *testing.T) {
 	tx := &Transaction{
 		ID:        "test",
@@ -1431,7 +1462,7 @@ func TestToJSONWithEmptyTransaction(t *testing.T) {
 func TestValidateTransactionBalanceEdgeCases(t *testing.T) {
 	tx := NewTransaction(
 		[]TxInput{{TxID: "prev", Index: 0}},
-		[]TxOutput{{Address: testAddress, Amount: 1.0}},
+		[]TxOutput{{Address: testAddress, Amount: 1.0 * Coin}},
 	)
 
 	// Test with empty UTXO set
@@ -1448,20 +1479,20 @@ func TestValidateAmountsFullCoverage(t *testing.T) {
 		wantErr bool
 	}{
 		{
-			name: "coinbase with negative amount",
+			name: "coinbase with amount above maximum",
 			tx: &Transaction{
 				ID:      "test",
 				Inputs:  []TxInput{},
-				Outputs: []TxOutput{{Address: testAddress, Amount: -1.0}},
+				Outputs: []TxOutput{{Address: testAddress, Amount: MaxMoney + 1}},
 			},
 			wantErr: true,
 		},
 		{
-			name: "regular transaction with negative output amount",
+			name: "regular transaction with output amount above maximum",
 			tx: &Transaction{
 				ID:      "test",
 				Inputs:  []TxInput{{TxID: "prev", Index: 0}},
-				Outputs: []TxOutput{{Address: testAddress, Amount: -1.0}},
+				Outputs: []TxOutput{{Address: testAddress, Amount: MaxMoney + 1}},
 			},
 			wantErr: true,
 		},
@@ -1470,7 +1501,7 @@ func TestValidateAmountsFullCoverage(t *testing.T) {
 			tx: &Transaction{
 				ID:      "test",
 				Inputs:  []TxInput{{TxID: "prev", Index: 0}},
-				Outputs: []TxOutput{{Address: testAddress, Amount: 0.0}},
+				Outputs: []TxOutput{{Address: testAddress, Amount: 0.0 * Coin}},
 			},
 			wantErr: true,
 		},
@@ -1494,12 +1525,15 @@ func TestValidateAmountsWithMultipleOutputs(t *testing.T) {
 		ID:     "test",
 		Inputs: []TxInput{{TxID: "prev", Index: 0}},
 		Outputs: []TxOutput{
-			{Address: testAddress, Amount: 0.5},
-			{Address: testAddress2, Amount: -1.0}, // Invalid
+			{Address: testAddress, Amount: 0.5 * Coin},
+			{Address: testAddress2, Amount: 0}, // Invalid
 		},
 	}
 
-	err := tx.ValidateAmounts(make(map[string]map[int]TxOutput))
+	utxoSet := map[string]map[int]TxOutput{
+		"prev": {0: {Address: testAddress, Amount: 1.0 * Coin}},
+	}
+	err := tx.ValidateAmounts(utxoSet)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "has invalid amount")
 }
@@ -1509,7 +1543,7 @@ func TestValidateAmountsWithEqualAmounts(t *testing.T) {
 	tx := &Transaction{
 		ID:      "test",
 		Inputs:  []TxInput{{TxID: "prev", Index: 0}},
-		Outputs: []TxOutput{{Address: testAddress, Amount: 1.0}},
+		Outputs: []TxOutput{{Address: testAddress, Amount: 1.0 * Coin}},
 	}
 
 	err := tx.ValidateAmounts(make(map[string]map[int]TxOutput))
@@ -1523,7 +1557,7 @@ func TestToJSONWithInvalidData(t *testing.T) {
 	tx := &Transaction{
 		ID:        "test",
 		Inputs:    []TxInput{{TxID: "test", Index: 0, Signature: "sig", PublicKey: "key"}},
-		Outputs:   []TxOutput{{Address: testAddress, Amount: 1.5}},
+		Outputs:   []TxOutput{{Address: testAddress, Amount: 1.5 * Coin}},
 		Timestamp: 1234567890,
 	}
 
@@ -1534,7 +1568,7 @@ func TestToJSONWithInvalidData(t *testing.T) {
 
 func TestValidateTransactionStructureWithCoinbase(t *testing.T) {
 	// Test ValidateTransactionStructure with coinbase (should skip input validation)
-	tx := NewCoinbaseTransaction(testAddress, 1.0)
+	tx := NewCoinbaseTransaction(testAddress, 1.0*Coin)
 	utxoSet := map[string]map[int]TxOutput{}
 
 	err := tx.ValidateTransactionStructure(utxoSet)
@@ -1543,7 +1577,7 @@ func TestValidateTransactionStructureWithCoinbase(t *testing.T) {
 
 func TestGetValidationReportWithCoinbase(t *testing.T) {
 	// Test GetValidationReport with coinbase transaction
-	tx := NewCoinbaseTransaction(testAddress, 1.0)
+	tx := NewCoinbaseTransaction(testAddress, 1.0*Coin)
 	utxoSet := map[string]map[int]TxOutput{}
 
 	report := tx.GetValidationReport(utxoSet)
@@ -1555,7 +1589,7 @@ func TestGetValidationReportWithCoinbase(t *testing.T) {
 
 func TestValidateInputsWithCoinbase(t *testing.T) {
 	// Test ValidateInputs with coinbase (should return nil immediately)
-	tx := NewCoinbaseTransaction(testAddress, 1.0)
+	tx := NewCoinbaseTransaction(testAddress, 1.0*Coin)
 	utxoSet := map[string]map[int]TxOutput{}
 
 	err := tx.ValidateInputs(utxoSet)
@@ -1564,7 +1598,7 @@ func TestValidateInputsWithCoinbase(t *testing.T) {
 
 func TestVerifyAllSignaturesWithCoinbase(t *testing.T) {
 	// Test VerifyAllSignatures with coinbase (should return nil immediately)
-	tx := NewCoinbaseTransaction(testAddress, 1.0)
+	tx := NewCoinbaseTransaction(testAddress, 1.0*Coin)
 	referencedOutputs := [][]TxOutput{}
 
 	err := tx.VerifyAllSignatures(referencedOutputs)
@@ -1582,7 +1616,7 @@ func TestToJSONEdgeCases(t *testing.T) {
 			tx: &Transaction{
 				ID:        "test",
 				Inputs:    nil,
-				Outputs:   []TxOutput{{Address: testAddress, Amount: 1.0}},
+				Outputs:   []TxOutput{{Address: testAddress, Amount: 1.0 * Coin}},
 				Timestamp: 12345,
 			},
 		},
@@ -1626,10 +1660,10 @@ func TestVerifyInputSignatureEdgeCases(t *testing.T) {
 					Signature: "invalid_hex_signature",
 					PublicKey: encodePublicKey(testPublicKey),
 				}},
-				Outputs: []TxOutput{{Address: testAddress, Amount: 1.0}},
+				Outputs: []TxOutput{{Address: testAddress, Amount: 1.0 * Coin}},
 			},
 			inputIndex:        0,
-			referencedOutputs: []TxOutput{{Address: testAddress2, Amount: 2.0}},
+			referencedOutputs: []TxOutput{{Address: testAddress2, Amount: 2.0 * Coin}},
 			wantErr:           true,
 			errMsg:            "failed to decode signature",
 		},
@@ -1643,10 +1677,10 @@ func TestVerifyInputSignatureEdgeCases(t *testing.T) {
 					Signature: "304402207deaddeaddeaddeaddeaddeaddeaddeaddeaddeaddeaddeaddeaddeaddeaddead02207deaddeaddeaddeaddeaddeaddeaddeaddeaddeaddeaddeaddeaddeaddeaddead",
 					PublicKey: "invalid_public_key",
 				}},
-				Outputs: []TxOutput{{Address: testAddress, Amount: 1.0}},
+				Outputs: []TxOutput{{Address: testAddress, Amount: 1.0 * Coin}},
 			},
 			inputIndex:        0,
-			referencedOutputs: []TxOutput{{Address: testAddress2, Amount: 2.0}},
+			referencedOutputs: []TxOutput{{Address: testAddress2, Amount: 2.0 * Coin}},
 			wantErr:           true,
 			errMsg:            "failed to decode public key",
 		},
@@ -1683,7 +1717,7 @@ func TestCalculateIDEdgeCases(t *testing.T) {
 				}},
 				Outputs: []TxOutput{{
 					Address: strings.Repeat("d", 1000),
-					Amount:  1.0,
+					Amount:  1.0 * Coin,
 				}},
 				Timestamp: 1234567890,
 			},
@@ -1700,7 +1734,7 @@ func TestCalculateIDEdgeCases(t *testing.T) {
 				}},
 				Outputs: []TxOutput{{
 					Address: "addr\u0000\u0001",
-					Amount:  1.0,
+					Amount:  1.0 * Coin,
 				}},
 				Timestamp: 1234567890,
 			},
@@ -1731,7 +1765,7 @@ func TestValidateBasicEdgeCases(t *testing.T) {
 				Inputs: []TxInput{{TxID: "prev", Index: 0}},
 				Outputs: []TxOutput{{
 					Address: "invalid_address_no_0x",
-					Amount:  1.0,
+					Amount:  1.0 * Coin,
 				}},
 			},
 			wantErr: true,
@@ -1742,7 +1776,7 @@ func TestValidateBasicEdgeCases(t *testing.T) {
 			tx: &Transaction{
 				ID:      "test",
 				Inputs:  []TxInput{{TxID: "prev", Index: -1}},
-				Outputs: []TxOutput{{Address: testAddress, Amount: 1.0}},
+				Outputs: []TxOutput{{Address: testAddress, Amount: 1.0 * Coin}},
 			},
 			wantErr: true,
 			errMsg:  "invalid index",
@@ -1752,7 +1786,7 @@ func TestValidateBasicEdgeCases(t *testing.T) {
 			tx: &Transaction{
 				ID:      "",
 				Inputs:  []TxInput{{TxID: "prev", Index: 0}},
-				Outputs: []TxOutput{{Address: testAddress, Amount: 1.0}},
+				Outputs: []TxOutput{{Address: testAddress, Amount: 1.0 * Coin}},
 			},
 			wantErr: true,
 			errMsg:  "transaction ID is empty",
@@ -1785,10 +1819,10 @@ func TestValidateTransactionBalanceAdvanced(t *testing.T) {
 			name: "transaction with non-existent output index",
 			tx: NewTransaction(
 				[]TxInput{{TxID: "prev", Index: 5}}, // Non-existent index
-				[]TxOutput{{Address: testAddress, Amount: 1.0}},
+				[]TxOutput{{Address: testAddress, Amount: 1.0 * Coin}},
 			),
 			utxoSet: map[string]map[int]TxOutput{
-				"prev": {0: {Address: testAddress2, Amount: 2.0}},
+				"prev": {0: {Address: testAddress2, Amount: 2.0 * Coin}},
 			},
 			wantErr: true,
 			errMsg:  "non-existent output",
@@ -1797,10 +1831,10 @@ func TestValidateTransactionBalanceAdvanced(t *testing.T) {
 			name: "transaction with insufficient balance",
 			tx: NewTransaction(
 				[]TxInput{{TxID: "prev", Index: 0}},
-				[]TxOutput{{Address: testAddress, Amount: 5.0}}, // More than available
+				[]TxOutput{{Address: testAddress, Amount: 5.0 * Coin}}, // More than available
 			),
 			utxoSet: map[string]map[int]TxOutput{
-				"prev": {0: {Address: testAddress2, Amount: 2.0}},
+				"prev": {0: {Address: testAddress2, Amount: 2.0 * Coin}},
 			},
 			wantErr: true,
 			errMsg:  "insufficient input amount",
@@ -1809,10 +1843,10 @@ func TestValidateTransactionBalanceAdvanced(t *testing.T) {
 			name: "transaction with exact balance (no fee)",
 			tx: NewTransaction(
 				[]TxInput{{TxID: "prev", Index: 0}},
-				[]TxOutput{{Address: testAddress, Amount: 2.0}}, // Exactly equal
+				[]TxOutput{{Address: testAddress, Amount: 2.0 * Coin}}, // Exactly equal
 			),
 			utxoSet: map[string]map[int]TxOutput{
-				"prev": {0: {Address: testAddress2, Amount: 2.0}},
+				"prev": {0: {Address: testAddress2, Amount: 2.0 * Coin}},
 			},
 			wantErr: false,
 		},
@@ -1851,14 +1885,14 @@ func TestToJSONWithComplexData(t *testing.T) {
 		},
 		Outputs: []TxOutput{
 			{
-				Address: "0x1234567890123456789012345678901234567890",
-				Amount:  1.23456789,
+				Address: "mxm1qzg69v7yszg69v7yszg69v7yszg69v7yspnqvlg",
+				Amount:  1.23456789 * Coin,
 				TxID:    "parent_tx",
 				Index:   0,
 			},
 			{
-				Address: "0xabcdefabcdefabcdefabcdefabcdefabcdefabcd",
-				Amount:  0.00000001,
+				Address: "mxm1q40x7l27da74ummatehh6hn0040x7l27d089jkk",
+				Amount:  0.00000001 * Coin,
 				TxID:    "parent_tx",
 				Index:   1,
 			},
@@ -1869,7 +1903,7 @@ func TestToJSONWithComplexData(t *testing.T) {
 	jsonStr, err := tx.ToJSON()
 	assert.NoError(t, err)
 	assert.Contains(t, jsonStr, "test_complex")
-	assert.Contains(t, jsonStr, "1.23456789")
+	assert.Contains(t, jsonStr, "123456789")
 	assert.Contains(t, jsonStr, "1234567890")
 }
 
@@ -1877,11 +1911,11 @@ func TestVerifyInputSignatureComprehensive(t *testing.T) {
 	// Test more signature verification scenarios
 	tx := NewTransaction(
 		[]TxInput{{TxID: "prev", Index: 0}},
-		[]TxOutput{{Address: testAddress, Amount: 1.0}},
+		[]TxOutput{{Address: testAddress, Amount: 1.0 * Coin}},
 	)
 
 	// Sign with valid key first
-	referencedOutputs := []TxOutput{{Address: testAddress2, Amount: 2.0}}
+	referencedOutputs := []TxOutput{{Address: testAddress2, Amount: 2.0 * Coin}}
 	err := tx.SignTransaction(0, testPrivateKey, referencedOutputs)
 	require.NoError(t, err)
 
@@ -1890,7 +1924,7 @@ func TestVerifyInputSignatureComprehensive(t *testing.T) {
 	assert.NoError(t, err)
 
 	// Test verification with modified referenced output
-	modifiedOutputs := []TxOutput{{Address: testAddress2, Amount: 3.0}} // Different amount
+	modifiedOutputs := []TxOutput{{Address: testAddress2, Amount: 3.0 * Coin}} // Different amount
 	err = tx.VerifyInputSignature(0, modifiedOutputs)
 	assert.Error(t, err)
 }
@@ -1909,7 +1943,7 @@ func TestCalculateIDWithComplexScenarios(t *testing.T) {
 					{TxID: strings.Repeat("f", 64), Index: 2147483647, Signature: strings.Repeat("s", 200), PublicKey: strings.Repeat("k", 130)},
 				},
 				Outputs: []TxOutput{
-					{Address: strings.Repeat("a", 42), Amount: math.MaxFloat64, TxID: "max_tx", Index: 2147483647},
+					{Address: strings.Repeat("a", 42), Amount: math.MaxUint64, TxID: "max_tx", Index: 2147483647},
 				},
 				Timestamp: 9223372036854775807, // Max int64
 			},
@@ -1922,7 +1956,7 @@ func TestCalculateIDWithComplexScenarios(t *testing.T) {
 					{TxID: "", Index: -2147483648, Signature: "", PublicKey: ""},
 				},
 				Outputs: []TxOutput{
-					{Address: "", Amount: math.SmallestNonzeroFloat64, TxID: "", Index: -2147483648},
+					{Address: "", Amount: 1, TxID: "", Index: -2147483648},
 				},
 				Timestamp: -9223372036854775808, // Min int64
 			},
@@ -1942,16 +1976,16 @@ func TestGetSigningMessageWithVariousInputs(t *testing.T) {
 	// Test getSigningMessage with different input scenarios
 	tx := NewTransaction(
 		[]TxInput{{TxID: "prev", Index: 0}},
-		[]TxOutput{{Address: testAddress, Amount: 1.0}},
+		[]TxOutput{{Address: testAddress, Amount: 1.0 * Coin}},
 	)
 
 	// Test with empty referenced outputs
-	message, err := tx.getSigningMessage(0, []TxOutput{})
+	message, err := tx.getSigningMessage(0, []TxOutput{}, SigHashAll)
 	assert.NoError(t, err)
 	assert.NotEmpty(t, message)
 
 	// Test with nil referenced outputs slice
-	message, err = tx.getSigningMessage(0, nil)
+	message, err = tx.getSigningMessage(0, nil, SigHashAll)
 	assert.NoError(t, err)
 	assert.NotEmpty(t, message)
 }
@@ -1968,7 +2002,7 @@ func TestToJSONWithUnmarshalableData(t *testing.T) {
 		}},
 		Outputs: []TxOutput{{
 			Address: testAddress,
-			Amount:  1.797693134862315708145274237317043567981e+308, // Near max float64
+			Amount:  MaxMoney, // Maximum allowed amount
 		}},
 		Timestamp: 9223372036854775807, // Max int64
 	}
@@ -1993,7 +2027,7 @@ func TestCalculateIDWithJSONErrorPath(t *testing.T) {
 		}},
 		Outputs: []TxOutput{{
 			Address: testAddress,
-			Amount:  1.0,
+			Amount:  1.0 * Coin,
 		}},
 		Timestamp: 0,
 	}
@@ -2012,22 +2046,22 @@ func TestValidateAmountsComplexScenarios(t *testing.T) {
 		wantErr bool
 	}{
 		{
-			name: "coinbase with very small amount",
+			name: "coinbase with smallest amount",
 			tx: &Transaction{
 				ID:      "test",
 				Inputs:  []TxInput{},
-				Outputs: []TxOutput{{Address: testAddress, Amount: math.SmallestNonzeroFloat64}},
+				Outputs: []TxOutput{{Address: testAddress, Amount: 1}},
 			},
-			wantErr: false, // Should pass - small positive amount
+			wantErr: false, // Should pass - one base unit
 		},
 		{
-			name: "regular transaction with sub-normal amount",
+			name: "regular transaction with smallest amount",
 			tx: &Transaction{
 				ID:      "test",
 				Inputs:  []TxInput{{TxID: "prev", Index: 0}},
-				Outputs: []TxOutput{{Address: testAddress, Amount: 1e-310}}, // Very small
+				Outputs: []TxOutput{{Address: testAddress, Amount: 1}},
 			},
-			wantErr: true, // Should fail - too small
+			wantErr: true, // Should fail - the input is unknown
 		},
 	}
 
@@ -2060,11 +2094,11 @@ func TestValidateBasicComplexValidation(t *testing.T) {
 			wantErr: true,
 		},
 		{
-			name: "transaction with negative amount in output",
+			name: "transaction with amount above maximum in output",
 			tx: &Transaction{
 				ID:      "test",
 				Inputs:  []TxInput{{TxID: "prev", Index: 0}},
-				Outputs: []TxOutput{{Address: testAddress, Amount: -0.1}},
+				Outputs: []TxOutput{{Address: testAddress, Amount: MaxMoney + 1}},
 			},
 			wantErr: true,
 		},
@@ -2073,7 +2107,7 @@ func TestValidateBasicComplexValidation(t *testing.T) {
 			tx: &Transaction{
 				ID:      "test",
 				Inputs:  []TxInput{{TxID: "prev", Index: 0}},
-				Outputs: []TxOutput{{Address: testAddress, Amount: 0.0}},
+				Outputs: []TxOutput{{Address: testAddress, Amount: 0.0 * Coin}},
 			},
 			wantErr: true,
 		},
@@ -2095,12 +2129,12 @@ func TestValidateTransactionStructureComplexPaths(t *testing.T) {
 	// Test complex validation paths in ValidateTransactionStructure
 	tx := NewTransaction(
 		[]TxInput{{TxID: "prev", Index: 0}},
-		[]TxOutput{{Address: testAddress, Amount: 1.0}},
+		[]TxOutput{{Address: testAddress, Amount: 1.0 * Coin}},
 	)
 
 	// Create UTXO set with invalid address in referenced output
 	utxoSet := map[string]map[int]TxOutput{
-		"prev": {0: {Address: "invalid", Amount: 2.0}},
+		"prev": {0: {Address: "invalid", Amount: 2.0 * Coin}},
 	}
 
 	err := tx.ValidateTransactionStructure(utxoSet)
@@ -2111,12 +2145,12 @@ func TestGetValidationReportComplexPaths(t *testing.T) {
 	// Test complex paths in GetValidationReport
 	tx := NewTransaction(
 		[]TxInput{{TxID: "prev", Index: 0}},
-		[]TxOutput{{Address: testAddress, Amount: 0.001}}, // Small amount
+		[]TxOutput{{Address: testAddress, Amount: 0.001 * Coin}}, // Small amount
 	)
 
 	// Create UTXO set that would cause multiple validation errors
 	utxoSet := map[string]map[int]TxOutput{
-		"prev": {0: {Address: testAddress2, Amount: 10.0}},
+		"prev": {0: {Address: testAddress2, Amount: 10.0 * Coin}},
 	}
 
 	report := tx.GetValidationReport(utxoSet)
@@ -6,7 +6,7 @@ import (
 )
 
 // CreateSimpleTransaction creates a simple transaction with one input and one output
-func CreateSimpleTransaction(fromTxID string, fromIndex int, toAddress string, amount float64, changeAddress string) *Transaction {
+func CreateSimpleTransaction(fromTxID string, fromIndex int, toAddress string, amount Amount, changeAddress string) *Transaction {
 	input := TxInput{
 		TxID:      fromTxID,
 		Index:     fromIndex,
@@ -38,21 +38,19 @@ func CreateSimpleTransaction(fromTxID string, fromIndex int, toAddress string, a
 }
 
 // CalculateOptimalFee calculates the optimal transaction fee based on size and priority
-func CalculateOptimalFee(inputCount, outputCount int, priority float64) float64 {
+func CalculateOptimalFee(inputCount, outputCount int, priority float64) Amount {
 	// Base fee calculation
-	baseFee := 0.0001 // Base fee in BTC-like units
+	baseFee := Amount(Coin / 10000) // 0.0001 coins
 
 	// Size-based component (approximate)
 	size := inputCount*148 + outputCount*34 + 10 // Approximate transaction size
-	sizeFee := float64(size) * 0.00000001        // 1 satoshi per byte
+	sizeFee := Amount(size)                      // 1 base unit per byte
 
 	// Priority multiplier (0.1 = low priority, 1.0 = normal, 10.0 = high priority)
 	priorityMultiplier := math.Max(0.1, math.Min(10.0, priority))
 
-	totalFee := (baseFee + sizeFee) * priorityMultiplier
-
-	// Round to 8 decimal places (like Bitcoin)
-	return math.Round(totalFee*1e8) / 1e8
+	// Round to the nearest base unit
+	return Amount(math.Round(float64(baseFee+sizeFee) * priorityMultiplier))
 }
 
 // EstimateTransactionSize estimates the size of a transaction in bytes
@@ -66,8 +64,9 @@ func EstimateTransactionSize(inputCount, outputCount int) int {
 	return 10 + inputCount*148 + outputCount*34
 }
 
-// CalculateDustThreshold calculates the minimum output amount to avoid dust
-func CalculateDustThreshold(feeRate float64) float64 {
+// CalculateDustThreshold calculates the minimum output amount to avoid dust.
+// The fee rate is in base units per byte.
+func CalculateDustThreshold(feeRate float64) Amount {
 	// Dust is an output that costs more to spend than it's worth
 	// Calculation based on the cost to spend the output
 
@@ -77,19 +76,19 @@ func CalculateDustThreshold(feeRate float64) float64 {
 	// Add small buffer
 	dustThreshold := costToSpend * 3
 
-	return math.Round(dustThreshold*1e8) / 1e8
+	return Amount(math.Round(math.Max(0, dustThreshold)))
 }
 
 // IsDustOutput checks if an output is considered dust
-func IsDustOutput(amount, feeRate float64) bool {
+func IsDustOutput(amount Amount, feeRate float64) bool {
 	dustThreshold := CalculateDustThreshold(feeRate)
 	return amount < dustThreshold
 }
 
 // OptimizeTransaction optimizes a transaction by removing dust outputs and consolidating amounts
-func (tx *Transaction) OptimizeTransaction(minOutputValue float64) {
+func (tx *Transaction) OptimizeTransaction(minOutputValue Amount) {
 	var optimizedOutputs []TxOutput
-	var totalDust float64
+	var totalDust Amount
 
 	// Filter out dust outputs
 	for _, output := range tx.Outputs {
@@ -114,7 +113,7 @@ func (tx *Transaction) OptimizeTransaction(minOutputValue float64) {
 func (tx *Transaction) GetTransactionSummary(utxoSet map[string]map[int]TxOutput) map[string]interface{} {
 	fee := tx.GetFee(utxoSet)
 	estimatedSize := EstimateTransactionSize(len(tx.Inputs), len(tx.Outputs))
-	feeRate := fee / float64(estimatedSize)
+	feeRate := float64(fee) / float64(estimatedSize)
 
 	summary := map[string]interface{}{
 		"tx_id":          tx.ID,
@@ -161,6 +160,8 @@ func (tx *Transaction) CloneTransaction() *Transaction {
 		Inputs:    make([]TxInput, len(tx.Inputs)),
 		Outputs:   make([]TxOutput, len(tx.Outputs)),
 		Timestamp: tx.Timestamp,
+		Height:    tx.Height,
+		LockTime:  tx.LockTime,
 	}
 
 	// Copy inputs
@@ -168,8 +169,10 @@ func (tx *Transaction) CloneTransaction() *Transaction {
 		clone.Inputs[i] = TxInput{
 			TxID:      input.TxID,
 			Index:     input.Index,
+			Sequence:  input.Sequence,
 			Signature: input.Signature,
 			PublicKey: input.PublicKey,
+			Script:    input.Script,
 		}
 	}
 
@@ -207,11 +210,14 @@ func (tx *Transaction) ValidateTransactionBalance(utxoSet map[string]map[int]TxO
 	}
 
 	// Calculate actual input amount from UTXO set
-	var actualInputAmount float64
+	var actualInputAmount Amount
 	for _, input := range tx.Inputs {
 		if outputs, exists := utxoSet[input.TxID]; exists {
 			if output, exists := outputs[input.Index]; exists {
-				actualInputAmount += output.Amount
+				var err error
+				if actualInputAmount, err = actualInputAmount.Add(output.Amount); err != nil {
+					return fmt.Errorf("invalid input total: %w", err)
+				}
 			} else {
 				return fmt.Errorf("input references non-existent output %d in tx %s",
 					input.Index, input.TxID)
@@ -221,11 +227,14 @@ func (tx *Transaction) ValidateTransactionBalance(utxoSet map[string]map[int]TxO
 		}
 	}
 
-	outputAmount := tx.GetOutputAmount()
+	outputAmount, err := tx.outputTotal()
+	if err != nil {
+		return err
+	}
 
 	// Check balance
 	if actualInputAmount < outputAmount {
-		return fmt.Errorf("insufficient input amount: have %.8f, need %.8f",
+		return fmt.Errorf("insufficient input amount: have %s, need %s",
 			actualInputAmount, outputAmount)
 	}
 
@@ -21,7 +21,7 @@ type UTXOSet struct {
 	utxos      map[UTXOKey]TxOutput
 	mu         sync.RWMutex
 	totalCount int
-	totalValue float64
+	totalValue Amount
 }
 
 // NewUTXOSet creates a new empty UTXO set
@@ -43,6 +43,11 @@ func (us *UTXOSet) Add(txID string, index int, output TxOutput) error {
 		return fmt.Errorf("UTXO already exists: %s", key.String())
 	}
 
+	totalValue, err := us.totalValue.Add(output.Amount)
+	if err != nil {
+		return fmt.Errorf("failed to add UTXO %s: %w", key.String(), err)
+	}
+
 	// Set transaction info on output
 	output.TxID = txID
 	output.Index = index
@@ -50,7 +55,7 @@ func (us *UTXOSet) Add(txID string, index int, output TxOutput) error {
 	// Add to set
 	us.utxos[key] = output
 	us.totalCount++
-	us.totalValue += output.Amount
+	us.totalValue = totalValue
 
 	return nil
 }
@@ -67,10 +72,15 @@ func (us *UTXOSet) Spend(txID string, index int) error {
 		return fmt.Errorf("UTXO not found: %s", key.String())
 	}
 
+	totalValue, err := us.totalValue.Sub(output.Amount)
+	if err != nil {
+		return fmt.Errorf("failed to remove UTXO %s: %w", key.String(), err)
+	}
+
 	// Remove from set
 	delete(us.utxos, key)
 	us.totalCount--
-	us.totalValue -= output.Amount
+	us.totalValue = totalValue
 
 	return nil
 }
@@ -114,6 +124,23 @@ func (us *UTXOSet) GetAll() map[UTXOKey]TxOutput {
 	return result
 }
 
+// ToMap returns the UTXOs indexed by transaction ID and output index,
+// the form used by fee and mempool validation
+func (us *UTXOSet) ToMap() map[string]map[int]TxOutput {
+	us.mu.RLock()
+	defer us.mu.RUnlock()
+
+	result := make(map[string]map[int]TxOutput)
+	for key, output := range us.utxos {
+		if result[key.TxID] == nil {
+			result[key.TxID] = make(map[int]TxOutput)
+		}
+		result[key.TxID][key.Index] = output
+	}
+
+	return result
+}
+
 // GetByAddress returns all UTXOs for a specific address
 func (us *UTXOSet) GetByAddress(address string) []TxOutput {
 	us.mu.RLock()
@@ -130,7 +157,7 @@ func (us *UTXOSet) GetByAddress(address string) []TxOutput {
 }
 
 // GetByAmount returns UTXOs greater than or equal to the specified amount
-func (us *UTXOSet) GetByAmount(minAmount float64) []TxOutput {
+func (us *UTXOSet) GetByAmount(minAmount Amount) []TxOutput {
 	us.mu.RLock()
 	defer us.mu.RUnlock()
 
@@ -146,11 +173,11 @@ func (us *UTXOSet) GetByAmount(minAmount float64) []TxOutput {
 
 // SelectForAmount selects UTXOs to cover the specified amount
 // Returns selected UTXOs and the total amount selected
-func (us *UTXOSet) SelectForAmount(targetAmount float64, address string) ([]TxOutput, float64, error) {
+func (us *UTXOSet) SelectForAmount(targetAmount Amount, address string) ([]TxOutput, Amount, error) {
 	us.mu.RLock()
 	defer us.mu.RUnlock()
 
-	if targetAmount <= 0 {
+	if targetAmount == 0 {
 		return nil, 0, fmt.Errorf("target amount must be positive")
 	}
 
@@ -176,53 +203,52 @@ func (us *UTXOSet) SelectForAmount(targetAmount float64, address string) ([]TxOu
 	}
 
 	var selected []TxOutput
-	var totalAmount float64
+	var totalAmount Amount
 
 	// Select UTXOs until we reach the target amount
 	for _, output := range addressUTXOs {
 		selected = append(selected, output)
-		totalAmount += output.Amount
+		var err error
+		if totalAmount, err = totalAmount.Add(output.Amount); err != nil {
+			return nil, 0, err
+		}
 		if totalAmount >= targetAmount {
 			break
 		}
 	}
 
 	if totalAmount < targetAmount {
-		return nil, 0, fmt.Errorf("insufficient funds: have %.8f, need %.8f", totalAmount, targetAmount)
+		return nil, 0, fmt.Errorf("insufficient funds: have %s, need %s", totalAmount, targetAmount)
 	}
 
 	return selected, totalAmount, nil
 }
 
-// ValidateTransaction validates a transaction against the UTXO set
+// ValidateTransaction validates a transaction against the UTXO set. Each
+// input's unlocking script is run against the locking script of the output
+// it spends.
 func (us *UTXOSet) ValidateTransaction(tx *Transaction) error {
 	us.mu.RLock()
 	defer us.mu.RUnlock()
 
-	// Coinbase transactions don't need UTXO validation
+	if err := us.validateTransactionLocked(tx); err != nil {
+		return err
+	}
+	return us.verifyScriptsLocked(tx)
+}
+
+// verifyScriptsLocked runs the unlocking script of every input against the
+// output it spends (assumes lock is held and the inputs exist)
+func (us *UTXOSet) verifyScriptsLocked(tx *Transaction) error {
 	if tx.IsCoinbase() {
 		return nil
 	}
-
-	// Check that all inputs reference existing UTXOs
 	for i, input := range tx.Inputs {
-		key := UTXOKey{TxID: input.TxID, Index: input.Index}
-
-		if _, exists := us.utxos[key]; !exists {
-			return fmt.Errorf("input %d references non-existent UTXO: %s", i, key.String())
+		output := us.utxos[UTXOKey{TxID: input.TxID, Index: input.Index}]
+		if err := tx.VerifyInputScript(i, output); err != nil {
+			return fmt.Errorf("input %d script verification failed: %w", i, err)
 		}
 	}
-
-	// Check for double spending within this transaction
-	inputKeys := make(map[UTXOKey]bool)
-	for i, input := range tx.Inputs {
-		key := UTXOKey{TxID: input.TxID, Index: input.Index}
-		if inputKeys[key] {
-			return fmt.Errorf("input %d attempts double spend of UTXO: %s", i, key.String())
-		}
-		inputKeys[key] = true
-	}
-
 	return nil
 }
 
@@ -235,19 +261,21 @@ func (us *UTXOSet) ProcessTransaction(tx *Transaction) error {
 	if err := us.validateTransactionLocked(tx); err != nil {
 		return fmt.Errorf("transaction validation failed: %w", err)
 	}
+	totalValue, err := us.valueAfterLocked(tx)
+	if err != nil {
+		return fmt.Errorf("transaction validation failed: %w", err)
+	}
 
 	// Spend inputs (remove UTXOs)
 	for _, input := range tx.Inputs {
 		key := UTXOKey{TxID: input.TxID, Index: input.Index}
-		output, exists := us.utxos[key]
-		if !exists {
+		if _, exists := us.utxos[key]; !exists {
 			// This should not happen if validation passed
 			return fmt.Errorf("UTXO not found during processing: %s", key.String())
 		}
 
 		delete(us.utxos, key)
 		us.totalCount--
-		us.totalValue -= output.Amount
 	}
 
 	// Add outputs (create new UTXOs)
@@ -260,12 +288,170 @@ func (us *UTXOSet) ProcessTransaction(tx *Transaction) error {
 
 		us.utxos[key] = output
 		us.totalCount++
-		us.totalValue += output.Amount
 	}
+	us.totalValue = totalValue
 
 	return nil
 }
 
+// valueAfterLocked returns the total value of the set once tx is applied,
+// failing if it would exceed the money supply (assumes lock is held and the
+// inputs exist)
+func (us *UTXOSet) valueAfterLocked(tx *Transaction) (Amount, error) {
+	total := us.totalValue
+	var err error
+	for _, input := range tx.Inputs {
+		output := us.utxos[UTXOKey{TxID: input.TxID, Index: input.Index}]
+		if total, err = total.Sub(output.Amount); err != nil {
+			return 0, fmt.Errorf("UTXO set value: %w", err)
+		}
+	}
+	for _, output := range tx.Outputs {
+		if total, err = total.Add(output.Amount); err != nil {
+			return 0, fmt.Errorf("UTXO set value: %w", err)
+		}
+	}
+	return total, nil
+}
+
+// SpentOutput records a UTXO consumed by a transaction so that it can be
+// restored when the transaction is reverted
+type SpentOutput struct {
+	Key    UTXOKey  `json:"key"`
+	Output TxOutput `json:"output"`
+}
+
+// ApplyTransactions atomically processes a list of transactions in order,
+// running the script of every input against the output it spends. Later
+// transactions may spend outputs created by earlier ones. Either every
+// transaction is applied or, on error, the set is left unchanged. The returned
+// spent outputs are ordered by transaction and input and form the undo log
+// for RevertTransactions.
+func (us *UTXOSet) ApplyTransactions(txs []*Transaction) ([]SpentOutput, error) {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+
+	var spent []SpentOutput
+	for i, tx := range txs {
+		txSpent, err := us.applyTransactionLocked(tx)
+		if err != nil {
+			if revertErr := us.revertTransactionsLocked(txs[:i], spent); revertErr != nil {
+				return nil, fmt.Errorf("transaction %d (%s) failed: %w (rollback failed: %v)", i, tx.ID, err, revertErr)
+			}
+			return nil, fmt.Errorf("transaction %d (%s) failed: %w", i, tx.ID, err)
+		}
+		spent = append(spent, txSpent...)
+	}
+
+	return spent, nil
+}
+
+// RevertTransactions undoes ApplyTransactions, removing the outputs created by
+// txs and restoring the outputs they spent
+func (us *UTXOSet) RevertTransactions(txs []*Transaction, spent []SpentOutput) error {
+	inputCount := 0
+	for _, tx := range txs {
+		if !tx.IsCoinbase() {
+			inputCount += len(tx.Inputs)
+		}
+	}
+	if inputCount != len(spent) {
+		return fmt.Errorf("undo log has %d spent outputs, transactions have %d inputs", len(spent), inputCount)
+	}
+
+	us.mu.Lock()
+	defer us.mu.Unlock()
+
+	return us.revertTransactionsLocked(txs, spent)
+}
+
+// applyTransactionLocked validates and applies a single transaction, including
+// the scripts of its inputs (assumes lock is held). The set is only modified
+// once the transaction is known to apply cleanly.
+func (us *UTXOSet) applyTransactionLocked(tx *Transaction) ([]SpentOutput, error) {
+	if err := us.validateTransactionLocked(tx); err != nil {
+		return nil, err
+	}
+	if err := us.verifyScriptsLocked(tx); err != nil {
+		return nil, err
+	}
+
+	for i := range tx.Outputs {
+		key := UTXOKey{TxID: tx.ID, Index: i}
+		if _, exists := us.utxos[key]; exists {
+			return nil, fmt.Errorf("output %d already exists as unspent: %s", i, key.String())
+		}
+	}
+	totalValue, err := us.valueAfterLocked(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	var spent []SpentOutput
+	if !tx.IsCoinbase() {
+		spent = make([]SpentOutput, 0, len(tx.Inputs))
+		for _, input := range tx.Inputs {
+			key := UTXOKey{TxID: input.TxID, Index: input.Index}
+			output := us.utxos[key]
+			spent = append(spent, SpentOutput{Key: key, Output: output})
+
+			delete(us.utxos, key)
+			us.totalCount--
+		}
+	}
+
+	for i, output := range tx.Outputs {
+		output.TxID = tx.ID
+		output.Index = i
+
+		us.utxos[UTXOKey{TxID: tx.ID, Index: i}] = output
+		us.totalCount++
+	}
+	us.totalValue = totalValue
+
+	return spent, nil
+}
+
+// revertTransactionsLocked undoes txs in reverse order (assumes lock is held)
+func (us *UTXOSet) revertTransactionsLocked(txs []*Transaction, spent []SpentOutput) error {
+	end := len(spent)
+	for i := len(txs) - 1; i >= 0; i-- {
+		tx := txs[i]
+
+		for index := range tx.Outputs {
+			key := UTXOKey{TxID: tx.ID, Index: index}
+			if output, exists := us.utxos[key]; exists {
+				totalValue, err := us.totalValue.Sub(output.Amount)
+				if err != nil {
+					return fmt.Errorf("failed to remove UTXO %s: %w", key.String(), err)
+				}
+				delete(us.utxos, key)
+				us.totalCount--
+				us.totalValue = totalValue
+			}
+		}
+
+		if tx.IsCoinbase() {
+			continue
+		}
+
+		start := end - len(tx.Inputs)
+		for _, entry := range spent[start:end] {
+			if _, exists := us.utxos[entry.Key]; !exists {
+				totalValue, err := us.totalValue.Add(entry.Output.Amount)
+				if err != nil {
+					return fmt.Errorf("failed to restore UTXO %s: %w", entry.Key.String(), err)
+				}
+				us.utxos[entry.Key] = entry.Output
+				us.totalCount++
+				us.totalValue = totalValue
+			}
+		}
+		end = start
+	}
+	return nil
+}
+
 // validateTransactionLocked validates a transaction (assumes lock is held)
 func (us *UTXOSet) validateTransactionLocked(tx *Transaction) error {
 	// Coinbase transactions don't need UTXO validation
@@ -303,25 +489,32 @@ func (us *UTXOSet) GetCount() int {
 }
 
 // GetTotalValue returns the total value of all UTXOs in the set
-func (us *UTXOSet) GetTotalValue() float64 {
+func (us *UTXOSet) GetTotalValue() Amount {
 	us.mu.RLock()
 	defer us.mu.RUnlock()
 	return us.totalValue
 }
 
 // GetBalance returns the balance for a specific address
-func (us *UTXOSet) GetBalance(address string) float64 {
+func (us *UTXOSet) GetBalance(address string) (Amount, error) {
 	us.mu.RLock()
 	defer us.mu.RUnlock()
+	return us.balanceLocked(address)
+}
 
-	var balance float64
+// balanceLocked sums the UTXOs of an address (assumes lock is held)
+func (us *UTXOSet) balanceLocked(address string) (Amount, error) {
+	var balance Amount
+	var err error
 	for _, output := range us.utxos {
-		if output.Address == address {
-			balance += output.Amount
+		if output.Address != address {
+			continue
+		}
+		if balance, err = balance.Add(output.Amount); err != nil {
+			return 0, fmt.Errorf("balance of %s: %w", address, err)
 		}
 	}
-
-	return balance
+	return balance, nil
 }
 
 // Clear removes all UTXOs from the set
@@ -359,35 +552,45 @@ func (us *UTXOSet) GetStats() map[string]interface{} {
 
 	// Calculate address distribution
 	addressCounts := make(map[string]int)
-	addressValues := make(map[string]float64)
+	addressValues := make(map[string]Amount)
+	var valueErr error
 
 	for _, output := range us.utxos {
 		addressCounts[output.Address]++
-		addressValues[output.Address] += output.Amount
+		value, err := addressValues[output.Address].Add(output.Amount)
+		if err != nil {
+			valueErr = fmt.Errorf("value of %s: %w", output.Address, err)
+			continue
+		}
+		addressValues[output.Address] = value
 	}
 
-	return map[string]interface{}{
+	stats := map[string]interface{}{
 		"total_count":    us.totalCount,
 		"total_value":    us.totalValue,
 		"address_count":  len(addressCounts),
 		"address_counts": addressCounts,
 		"address_values": addressValues,
-		"average_utxo_value": func() float64 {
+		"average_utxo_value": func() Amount {
 			if us.totalCount == 0 {
 				return 0
 			}
-			return us.totalValue / float64(us.totalCount)
+			return us.totalValue / Amount(us.totalCount)
 		}(),
 	}
+	if valueErr != nil {
+		stats["address_value_error"] = valueErr.Error()
+	}
+	return stats
 }
 
 // FindUTXOsForAmount finds the minimum number of UTXOs needed to reach the target amount
 // Uses a simple greedy algorithm (can be improved with more sophisticated selection)
-func (us *UTXOSet) FindUTXOsForAmount(targetAmount float64, address string) ([]TxOutput, float64, error) {
+func (us *UTXOSet) FindUTXOsForAmount(targetAmount Amount, address string) ([]TxOutput, Amount, error) {
 	us.mu.RLock()
 	defer us.mu.RUnlock()
 
-	if targetAmount <= 0 {
+	if targetAmount == 0 {
 		return nil, 0, fmt.Errorf("target amount must be positive")
 	}
 
@@ -415,7 +618,7 @@ func (us *UTXOSet) FindUTXOsForAmount(targetAmount float64, address string) ([]T
 	// Sort by amount descending (simple greedy approach)
 	// In a real implementation, you might want more sophisticated selection
 	var selected []TxOutput
-	var totalAmount float64
+	var totalAmount Amount
 
 	// First try to find exact matches or larger amounts
 	for _, output := range addressUTXOs {
@@ -439,14 +642,17 @@ func (us *UTXOSet) FindUTXOsForAmount(targetAmount float64, address string) ([]T
 	// Select UTXOs until we reach the target amount
 	for _, output := range addressUTXOs {
 		selected = append(selected, output)
-		totalAmount += output.Amount
+		var err error
+		if totalAmount, err = totalAmount.Add(output.Amount); err != nil {
+			return nil, 0, err
+		}
 		if totalAmount >= targetAmount {
 			break
 		}
 	}
 
 	if totalAmount < targetAmount {
-		return nil, 0, fmt.Errorf("insufficient funds: have %.8f, need %.8f", totalAmount, targetAmount)
+		return nil, 0, fmt.Errorf("insufficient funds: have %s, need %s", totalAmount, targetAmount)
 	}
 
 	return selected, totalAmount, nil
@@ -465,8 +671,8 @@ func (us *UTXOSet) ValidateUTXO(txID string, index int) error {
 	}
 
 	// Validate output
-	if output.Amount <= 0 {
-		return fmt.Errorf("invalid UTXO amount: %.8f", output.Amount)
+	if output.Amount == 0 || !output.Amount.IsValid() {
+		return fmt.Errorf("invalid UTXO amount: %s", output.Amount)
 	}
 
 	if output.Address == "" {
@@ -487,9 +693,13 @@ func (us *UTXOSet) PruneSpent(spentUTXOs []UTXOKey) error {
 			continue // UTXO already spent or doesn't exist
 		}
 
+		totalValue, err := us.totalValue.Sub(output.Amount)
+		if err != nil {
+			return fmt.Errorf("failed to remove UTXO %s: %w", key.String(), err)
+		}
 		delete(us.utxos, key)
 		us.totalCount--
-		us.totalValue -= output.Amount
+		us.totalValue = totalValue
 	}
 
 	return nil
@@ -509,6 +719,11 @@ func (us *UTXOSet) AddBatch(utxos map[string]map[int]TxOutput) error {
 				return fmt.Errorf("UTXO already exists: %s", key.String())
 			}
 
+			totalValue, err := us.totalValue.Add(output.Amount)
+			if err != nil {
+				return fmt.Errorf("failed to add UTXO %s: %w", key.String(), err)
+			}
+
 			// Set transaction info on output
 			output.TxID = txID
 			output.Index = index
@@ -516,7 +731,7 @@ func (us *UTXOSet) AddBatch(utxos map[string]map[int]TxOutput) error {
 			// Add to set
 			us.utxos[key] = output
 			us.totalCount++
-			us.totalValue += output.Amount
+			us.totalValue = totalValue
 		}
 	}
 
@@ -537,16 +752,19 @@ func (us *UTXOSet) GetKeys() []UTXOKey {
 }
 
 // HasSufficientBalance checks if an address has sufficient balance
-func (us *UTXOSet) HasSufficientBalance(address string, amount float64) bool {
+func (us *UTXOSet) HasSufficientBalance(address string, amount Amount) (bool, error) {
 	us.mu.RLock()
 	defer us.mu.RUnlock()
 
-	balance := us.GetBalance(address)
-	return balance >= amount
+	balance, err := us.balanceLocked(address)
+	if err != nil {
+		return false, err
+	}
+	return balance >= amount, nil
 }
 
 // GetUTXOsByRange returns UTXOs within the specified amount range
-func (us *UTXOSet) GetUTXOsByRange(minAmount, maxAmount float64) []TxOutput {
+func (us *UTXOSet) GetUTXOsByRange(minAmount, maxAmount Amount) []TxOutput {
 	us.mu.RLock()
 	defer us.mu.RUnlock()
 
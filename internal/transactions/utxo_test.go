@@ -2,7 +2,6 @@ package transactions
 
 import (
 	"fmt"
-	"math"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -13,7 +12,7 @@ func TestNewUTXOSetSimple(t *testing.T) {
 	utxoSet := NewUTXOSet()
 	assert.NotNil(t, utxoSet)
 	assert.Equal(t, 0, utxoSet.GetCount())
-	assert.Equal(t, 0.0, utxoSet.GetTotalValue())
+	assert.Equal(t, Amount(0), utxoSet.GetTotalValue())
 }
 
 func TestUTXOKeyStringSimple(t *testing.T) {
@@ -23,12 +22,12 @@ func TestUTXOKeyStringSimple(t *testing.T) {
 
 func TestAddSimple(t *testing.T) {
 	utxoSet := NewUTXOSet()
-	output := TxOutput{Address: "addr1", Amount: 1.5}
+	output := TxOutput{Address: "addr1", Amount: 1.5 * Coin}
 
 	err := utxoSet.Add("tx1", 0, output)
 	assert.NoError(t, err)
 	assert.Equal(t, 1, utxoSet.GetCount())
-	assert.Equal(t, 1.5, utxoSet.GetTotalValue())
+	assert.Equal(t, Amount(1.5*Coin), utxoSet.GetTotalValue())
 
 	// Test adding duplicate UTXO
 	err = utxoSet.Add("tx1", 0, output)
@@ -38,7 +37,7 @@ func TestAddSimple(t *testing.T) {
 
 func TestSpendSimple(t *testing.T) {
 	utxoSet := NewUTXOSet()
-	output := TxOutput{Address: "addr1", Amount: 1.5}
+	output := TxOutput{Address: "addr1", Amount: 1.5 * Coin}
 	err := utxoSet.Add("tx1", 0, output)
 	require.NoError(t, err)
 
@@ -46,7 +45,7 @@ func TestSpendSimple(t *testing.T) {
 	err = utxoSet.Spend("tx1", 0)
 	assert.NoError(t, err)
 	assert.Equal(t, 0, utxoSet.GetCount())
-	assert.Equal(t, 0.0, utxoSet.GetTotalValue())
+	assert.Equal(t, Amount(0), utxoSet.GetTotalValue())
 
 	// Test spending non-existent UTXO
 	err = utxoSet.Spend("tx1", 0)
@@ -56,7 +55,7 @@ func TestSpendSimple(t *testing.T) {
 
 func TestGetSimple(t *testing.T) {
 	utxoSet := NewUTXOSet()
-	output := TxOutput{Address: "addr1", Amount: 1.5}
+	output := TxOutput{Address: "addr1", Amount: 1.5 * Coin}
 	err := utxoSet.Add("tx1", 0, output)
 	require.NoError(t, err)
 
@@ -64,7 +63,7 @@ func TestGetSimple(t *testing.T) {
 	retrieved, err := utxoSet.Get("tx1", 0)
 	assert.NoError(t, err)
 	assert.Equal(t, "addr1", retrieved.Address)
-	assert.Equal(t, 1.5, retrieved.Amount)
+	assert.Equal(t, Amount(1.5*Coin), retrieved.Amount)
 	assert.Equal(t, "tx1", retrieved.TxID)
 	assert.Equal(t, 0, retrieved.Index)
 
@@ -76,7 +75,7 @@ func TestGetSimple(t *testing.T) {
 
 func TestExistsSimple(t *testing.T) {
 	utxoSet := NewUTXOSet()
-	output := TxOutput{Address: "addr1", Amount: 1.5}
+	output := TxOutput{Address: "addr1", Amount: 1.5 * Coin}
 	err := utxoSet.Add("tx1", 0, output)
 	require.NoError(t, err)
 
@@ -92,9 +91,9 @@ func TestGetByAddressSimple(t *testing.T) {
 
 	// Add UTXOs for different addresses
 	outputs := []TxOutput{
-		{Address: "addr1", Amount: 1.0},
-		{Address: "addr2", Amount: 2.0},
-		{Address: "addr1", Amount: 1.5},
+		{Address: "addr1", Amount: 1.0 * Coin},
+		{Address: "addr2", Amount: 2.0 * Coin},
+		{Address: "addr1", Amount: 1.5 * Coin},
 	}
 
 	for i, output := range outputs {
@@ -120,8 +119,8 @@ func TestValidateTransactionSimple(t *testing.T) {
 
 	// Add some UTXOs
 	outputs := []TxOutput{
-		{Address: "addr1", Amount: 1.0},
-		{Address: "addr2", Amount: 2.0},
+		{Address: testKeyAddress, Amount: 1.0 * Coin},
+		{Address: testAddress2, Amount: 2.0 * Coin},
 	}
 
 	for i, output := range outputs {
@@ -132,16 +131,22 @@ func TestValidateTransactionSimple(t *testing.T) {
 	// Create valid transaction
 	tx := NewTransaction(
 		[]TxInput{{TxID: "tx1", Index: 0}},
-		[]TxOutput{{Address: "addr3", Amount: 0.9}},
+		[]TxOutput{{Address: testAddress, Amount: 0.9 * Coin}},
 	)
 
+	// Unsigned spends fail the locking script
 	err := utxoSet.ValidateTransaction(tx)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "script verification failed")
+
+	require.NoError(t, tx.SignTransaction(0, testPrivateKey, outputs))
+	err = utxoSet.ValidateTransaction(tx)
 	assert.NoError(t, err)
 
 	// Test transaction with non-existent UTXO
 	invalidTx := NewTransaction(
 		[]TxInput{{TxID: "tx2", Index: 0}},
-		[]TxOutput{{Address: "addr3", Amount: 0.9}},
+		[]TxOutput{{Address: "addr3", Amount: 0.9 * Coin}},
 	)
 
 	err = utxoSet.ValidateTransaction(invalidTx)
@@ -149,7 +154,7 @@ func TestValidateTransactionSimple(t *testing.T) {
 	assert.Contains(t, err.Error(), "non-existent UTXO")
 
 	// Test coinbase transaction (should always be valid)
-	coinbaseTx := NewCoinbaseTransaction("addr1", 1.0)
+	coinbaseTx := NewCoinbaseTransaction("addr1", 1.0*Coin)
 	err = utxoSet.ValidateTransaction(coinbaseTx)
 	assert.NoError(t, err)
 }
@@ -159,8 +164,8 @@ func TestProcessTransactionSimple(t *testing.T) {
 
 	// Add initial UTXOs
 	outputs := []TxOutput{
-		{Address: "addr1", Amount: 1.0},
-		{Address: "addr2", Amount: 2.0},
+		{Address: "addr1", Amount: 1.0 * Coin},
+		{Address: "addr2", Amount: 2.0 * Coin},
 	}
 
 	for i, output := range outputs {
@@ -174,7 +179,7 @@ func TestProcessTransactionSimple(t *testing.T) {
 	// Create and process transaction
 	tx := NewTransaction(
 		[]TxInput{{TxID: "tx1", Index: 0}},
-		[]TxOutput{{Address: "addr3", Amount: 0.8}, {Address: "addr1", Amount: 0.1}},
+		[]TxOutput{{Address: "addr3", Amount: 0.8 * Coin}, {Address: "addr1", Amount: 0.1 * Coin}},
 	)
 
 	tx.ID = "tx2" // Set transaction ID
@@ -183,8 +188,8 @@ func TestProcessTransactionSimple(t *testing.T) {
 	assert.NoError(t, err)
 
 	// Check that inputs were spent and outputs added
-	assert.Equal(t, initialCount+1, utxoSet.GetCount())        // 1 spent, 2 added = +1
-	assert.Equal(t, initialValue-0.1, utxoSet.GetTotalValue()) // Fee of 0.1
+	assert.Equal(t, initialCount+1, utxoSet.GetCount())             // 1 spent, 2 added = +1
+	assert.Equal(t, initialValue-0.1*Coin, utxoSet.GetTotalValue()) // Fee of 0.1
 }
 
 func TestGetBalanceSimple(t *testing.T) {
@@ -192,9 +197,9 @@ func TestGetBalanceSimple(t *testing.T) {
 
 	// Add UTXOs for different addresses
 	outputs := []TxOutput{
-		{Address: "addr1", Amount: 1.0},
-		{Address: "addr2", Amount: 2.0},
-		{Address: "addr1", Amount: 1.5},
+		{Address: "addr1", Amount: 1.0 * Coin},
+		{Address: "addr2", Amount: 2.0 * Coin},
+		{Address: "addr1", Amount: 1.5 * Coin},
 	}
 
 	for i, output := range outputs {
@@ -202,9 +207,17 @@ func TestGetBalanceSimple(t *testing.T) {
 		require.NoError(t, err)
 	}
 
-	assert.Equal(t, 2.5, utxoSet.GetBalance("addr1"))
-	assert.Equal(t, 2.0, utxoSet.GetBalance("addr2"))
-	assert.Equal(t, 0.0, utxoSet.GetBalance("addr3"))
+	assert.Equal(t, Amount(2.5*Coin), mustBalance(t, utxoSet, "addr1"))
+	assert.Equal(t, Amount(2.0*Coin), mustBalance(t, utxoSet, "addr2"))
+	assert.Equal(t, Amount(0), mustBalance(t, utxoSet, "addr3"))
+}
+
+// mustBalance returns the balance of an address, failing the test on error
+func mustBalance(t *testing.T, utxoSet *UTXOSet, address string) Amount {
+	t.Helper()
+	balance, err := utxoSet.GetBalance(address)
+	require.NoError(t, err)
+	return balance
 }
 
 func TestSelectForAmountSimple(t *testing.T) {
@@ -212,9 +225,9 @@ func TestSelectForAmountSimple(t *testing.T) {
 
 	// Add UTXOs for an address
 	outputs := []TxOutput{
-		{Address: "addr1", Amount: 0.5},
-		{Address: "addr1", Amount: 1.0},
-		{Address: "addr1", Amount: 2.0},
+		{Address: "addr1", Amount: 0.5 * Coin},
+		{Address: "addr1", Amount: 1.0 * Coin},
+		{Address: "addr1", Amount: 2.0 * Coin},
 	}
 
 	for i, output := range outputs {
@@ -223,20 +236,20 @@ func TestSelectForAmountSimple(t *testing.T) {
 	}
 
 	// Select UTXOs for 1.2 amount
-	selected, total, err := utxoSet.SelectForAmount(1.2, "addr1")
+	selected, total, err := utxoSet.SelectForAmount(1.2*Coin, "addr1")
 	assert.NoError(t, err)
-	assert.Len(t, selected, 2)  // Selects until target is reached
-	assert.Equal(t, 1.5, total) // 0.5 + 1.0
+	assert.Len(t, selected, 2)               // Selects until target is reached
+	assert.Equal(t, Amount(1.5*Coin), total) // 0.5 + 1.0
 
 	// Test insufficient funds
-	_, _, err = utxoSet.SelectForAmount(5.0, "addr1")
+	_, _, err = utxoSet.SelectForAmount(5.0*Coin, "addr1")
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "insufficient funds")
 }
 
 func TestClearSimple(t *testing.T) {
 	utxoSet := NewUTXOSet()
-	output := TxOutput{Address: "addr1", Amount: 1.0}
+	output := TxOutput{Address: "addr1", Amount: 1.0 * Coin}
 	err := utxoSet.Add("tx1", 0, output)
 	require.NoError(t, err)
 
@@ -244,7 +257,7 @@ func TestClearSimple(t *testing.T) {
 
 	utxoSet.Clear()
 	assert.Equal(t, 0, utxoSet.GetCount())
-	assert.Equal(t, 0.0, utxoSet.GetTotalValue())
+	assert.Equal(t, Amount(0), utxoSet.GetTotalValue())
 }
 
 func TestCloneSimple(t *testing.T) {
@@ -252,8 +265,8 @@ func TestCloneSimple(t *testing.T) {
 
 	// Add some UTXOs
 	outputs := []TxOutput{
-		{Address: "addr1", Amount: 1.0},
-		{Address: "addr2", Amount: 2.0},
+		{Address: "addr1", Amount: 1.0 * Coin},
+		{Address: "addr2", Amount: 2.0 * Coin},
 	}
 
 	for i, output := range outputs {
@@ -276,9 +289,9 @@ func TestGetStatsSimple(t *testing.T) {
 
 	// Add UTXOs for different addresses
 	outputs := []TxOutput{
-		{Address: "addr1", Amount: 1.0},
-		{Address: "addr2", Amount: 2.0},
-		{Address: "addr1", Amount: 1.5},
+		{Address: "addr1", Amount: 1.0 * Coin},
+		{Address: "addr2", Amount: 2.0 * Coin},
+		{Address: "addr1", Amount: 1.5 * Coin},
 	}
 
 	for i, output := range outputs {
@@ -288,9 +301,9 @@ func TestGetStatsSimple(t *testing.T) {
 
 	stats := utxoSet.GetStats()
 	assert.Equal(t, 3, stats["total_count"])
-	assert.Equal(t, 4.5, stats["total_value"])
+	assert.Equal(t, Amount(4.5*Coin), stats["total_value"])
 	assert.Equal(t, 2, stats["address_count"])
-	assert.Equal(t, 1.5, stats["average_utxo_value"])
+	assert.Equal(t, Amount(1.5*Coin), stats["average_utxo_value"])
 }
 
 func TestFindUTXOsForAmountSimple(t *testing.T) {
@@ -298,9 +311,9 @@ func TestFindUTXOsForAmountSimple(t *testing.T) {
 
 	// Add UTXOs for an address
 	outputs := []TxOutput{
-		{Address: "addr1", Amount: 0.5},
-		{Address: "addr1", Amount: 1.0},
-		{Address: "addr1", Amount: 2.0},
+		{Address: "addr1", Amount: 0.5 * Coin},
+		{Address: "addr1", Amount: 1.0 * Coin},
+		{Address: "addr1", Amount: 2.0 * Coin},
 	}
 
 	for i, output := range outputs {
@@ -309,13 +322,13 @@ func TestFindUTXOsForAmountSimple(t *testing.T) {
 	}
 
 	// Find UTXOs for 1.2 amount
-	selected, total, err := utxoSet.FindUTXOsForAmount(1.2, "addr1")
+	selected, total, err := utxoSet.FindUTXOsForAmount(1.2*Coin, "addr1")
 	assert.NoError(t, err)
 	assert.Len(t, selected, 1) // Should select 2.0 (single sufficient UTXO)
-	assert.Equal(t, 2.0, total)
+	assert.Equal(t, Amount(2.0*Coin), total)
 
 	// Test insufficient funds
-	_, _, err = utxoSet.FindUTXOsForAmount(5.0, "addr1")
+	_, _, err = utxoSet.FindUTXOsForAmount(5.0*Coin, "addr1")
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "insufficient funds")
 }
@@ -324,7 +337,7 @@ func TestValidateUTXOSimple(t *testing.T) {
 	utxoSet := NewUTXOSet()
 
 	// Add a valid UTXO
-	output := TxOutput{Address: "addr1", Amount: 1.0}
+	output := TxOutput{Address: "addr1", Amount: 1.0 * Coin}
 	err := utxoSet.Add("tx1", 0, output)
 	require.NoError(t, err)
 
@@ -343,18 +356,18 @@ func TestAddBatchSimple(t *testing.T) {
 
 	utxos := map[string]map[int]TxOutput{
 		"tx1": {
-			0: {Address: "addr1", Amount: 1.0},
-			1: {Address: "addr2", Amount: 2.0},
+			0: {Address: "addr1", Amount: 1.0 * Coin},
+			1: {Address: "addr2", Amount: 2.0 * Coin},
 		},
 		"tx2": {
-			0: {Address: "addr3", Amount: 1.5},
+			0: {Address: "addr3", Amount: 1.5 * Coin},
 		},
 	}
 
 	err := utxoSet.AddBatch(utxos)
 	assert.NoError(t, err)
 	assert.Equal(t, 3, utxoSet.GetCount())
-	assert.Equal(t, 4.5, utxoSet.GetTotalValue())
+	assert.Equal(t, Amount(4.5*Coin), utxoSet.GetTotalValue())
 }
 
 func TestHasSufficientBalanceSimple(t *testing.T) {
@@ -362,8 +375,8 @@ func TestHasSufficientBalanceSimple(t *testing.T) {
 
 	// Add UTXOs for an address
 	outputs := []TxOutput{
-		{Address: "addr1", Amount: 1.0},
-		{Address: "addr1", Amount: 2.0},
+		{Address: "addr1", Amount: 1.0 * Coin},
+		{Address: "addr1", Amount: 2.0 * Coin},
 	}
 
 	for i, output := range outputs {
@@ -371,22 +384,28 @@ func TestHasSufficientBalanceSimple(t *testing.T) {
 		require.NoError(t, err)
 	}
 
+	hasBalance := func(address string, amount Amount) bool {
+		ok, err := utxoSet.HasSufficientBalance(address, amount)
+		require.NoError(t, err)
+		return ok
+	}
+
 	// Test sufficient balance
-	assert.True(t, utxoSet.HasSufficientBalance("addr1", 2.5))
-	assert.True(t, utxoSet.HasSufficientBalance("addr1", 3.0))
+	assert.True(t, hasBalance("addr1", 2.5*Coin))
+	assert.True(t, hasBalance("addr1", 3.0*Coin))
 
 	// Test insufficient balance
-	assert.False(t, utxoSet.HasSufficientBalance("addr1", 3.1))
+	assert.False(t, hasBalance("addr1", 3.1*Coin))
 
 	// Test non-existent address
-	assert.False(t, utxoSet.HasSufficientBalance("nonexistent", 1.0))
+	assert.False(t, hasBalance("nonexistent", 1.0*Coin))
 }
 
 func TestDoubleSpendingPreventionSimple(t *testing.T) {
 	utxoSet := NewUTXOSet()
 
 	// Add a UTXO
-	output := TxOutput{Address: "addr1", Amount: 2.0}
+	output := TxOutput{Address: "addr1", Amount: 2.0 * Coin}
 	err := utxoSet.Add("tx1", 0, output)
 	require.NoError(t, err)
 
@@ -396,7 +415,7 @@ func TestDoubleSpendingPreventionSimple(t *testing.T) {
 			{TxID: "tx1", Index: 0},
 			{TxID: "tx1", Index: 0}, // Same UTXO twice
 		},
-		[]TxOutput{{Address: "addr2", Amount: 1.5}},
+		[]TxOutput{{Address: "addr2", Amount: 1.5 * Coin}},
 	)
 
 	err = utxoSet.ValidateTransaction(doubleSpendTx)
@@ -409,8 +428,8 @@ func TestUTXOSetUpdateSimple(t *testing.T) {
 
 	// Add initial UTXOs
 	outputs := []TxOutput{
-		{Address: "addr1", Amount: 1.0},
-		{Address: "addr2", Amount: 2.0},
+		{Address: "addr1", Amount: 1.0 * Coin},
+		{Address: "addr2", Amount: 2.0 * Coin},
 	}
 
 	for i, output := range outputs {
@@ -422,8 +441,8 @@ func TestUTXOSetUpdateSimple(t *testing.T) {
 	tx := NewTransaction(
 		[]TxInput{{TxID: "tx1", Index: 0}}, // Spend 1.0
 		[]TxOutput{
-			{Address: "addr3", Amount: 0.7},
-			{Address: "addr1", Amount: 0.2}, // Change
+			{Address: "addr3", Amount: 0.7 * Coin},
+			{Address: "addr1", Amount: 0.2 * Coin}, // Change
 		},
 	)
 	tx.ID = "tx2"
@@ -432,8 +451,8 @@ func TestUTXOSetUpdateSimple(t *testing.T) {
 	assert.NoError(t, err)
 
 	// Verify UTXO set was updated correctly
-	assert.Equal(t, 3, utxoSet.GetCount())                  // 1 spent, 2 added
-	assert.InDelta(t, 2.9, utxoSet.GetTotalValue(), 0.0001) // 3.0 - 0.1 fee
+	assert.Equal(t, 3, utxoSet.GetCount())                     // 1 spent, 2 added
+	assert.Equal(t, Amount(2.9*Coin), utxoSet.GetTotalValue()) // 3.0 - 0.1 fee
 
 	// Verify old UTXO is gone
 	assert.False(t, utxoSet.Exists("tx1", 0))
@@ -454,8 +473,8 @@ func TestUTXOEdgeCases(t *testing.T) {
 	err = utxoSet.Spend("tx1", 0)
 	assert.Error(t, err)
 
-	// Test zero and negative amounts
-	zeroOutput := TxOutput{Address: "addr1", Amount: 0.0}
+	// Test zero and out of range amounts
+	zeroOutput := TxOutput{Address: "addr1", Amount: 0}
 	err = utxoSet.Add("tx1", 0, zeroOutput)
 	assert.NoError(t, err)
 
@@ -463,16 +482,19 @@ func TestUTXOEdgeCases(t *testing.T) {
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "invalid UTXO amount")
 
-	negativeOutput := TxOutput{Address: "addr1", Amount: -1.0}
-	err = utxoSet.Add("tx2", 0, negativeOutput)
-	assert.NoError(t, err)
+	// An excessive amount overflows the set total, so place it directly
+	excessiveOutput := TxOutput{Address: "addr1", Amount: MaxMoney + 1}
+	err = utxoSet.Add("tx2", 0, excessiveOutput)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "amount overflow")
+	utxoSet.utxos[UTXOKey{TxID: "tx2", Index: 0}] = excessiveOutput
 
 	err = utxoSet.ValidateUTXO("tx2", 0)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "invalid UTXO amount")
 
 	// Test empty address
-	emptyAddrOutput := TxOutput{Address: "", Amount: 1.0}
+	emptyAddrOutput := TxOutput{Address: "", Amount: 1.0 * Coin}
 	err = utxoSet.Add("tx3", 0, emptyAddrOutput)
 	assert.NoError(t, err)
 
@@ -485,20 +507,26 @@ func TestUTXOLargeValues(t *testing.T) {
 	utxoSet := NewUTXOSet()
 
 	// Test with very large amounts
-	largeAmount := math.MaxFloat64 / 2
+	largeAmount := MaxMoney
 	output := TxOutput{Address: "addr1", Amount: largeAmount}
 
 	err := utxoSet.Add("tx1", 0, output)
 	assert.NoError(t, err)
 	assert.Equal(t, largeAmount, utxoSet.GetTotalValue())
-	assert.Equal(t, largeAmount, utxoSet.GetBalance("addr1"))
+	assert.Equal(t, largeAmount, mustBalance(t, utxoSet, "addr1"))
+
+	// Nothing more fits once the set holds the whole money supply
+	err = utxoSet.Add("tx2", 0, TxOutput{Address: "addr1", Amount: 1})
+	assert.Error(t, err)
+	assert.Equal(t, largeAmount, utxoSet.GetTotalValue())
+	assert.Equal(t, 1, utxoSet.GetCount())
 }
 
 func TestUTXOMultipleTransactions(t *testing.T) {
 	utxoSet := NewUTXOSet()
 
 	// Add initial funding UTXO
-	fundingOutput := TxOutput{Address: "addr1", Amount: 10.0}
+	fundingOutput := TxOutput{Address: "addr1", Amount: 10.0 * Coin}
 	err := utxoSet.Add("funding", 0, fundingOutput)
 	require.NoError(t, err)
 
@@ -506,9 +534,9 @@ func TestUTXOMultipleTransactions(t *testing.T) {
 	tx1 := NewTransaction(
 		[]TxInput{{TxID: "funding", Index: 0}},
 		[]TxOutput{
-			{Address: "addr1", Amount: 3.0},
-			{Address: "addr2", Amount: 4.0},
-			{Address: "addr3", Amount: 2.5},
+			{Address: "addr1", Amount: 3.0 * Coin},
+			{Address: "addr2", Amount: 4.0 * Coin},
+			{Address: "addr3", Amount: 2.5 * Coin},
 		},
 	)
 	tx1.ID = "tx1"
@@ -523,8 +551,8 @@ func TestUTXOMultipleTransactions(t *testing.T) {
 			{TxID: "tx1", Index: 2}, // 2.5 from addr3
 		},
 		[]TxOutput{
-			{Address: "addr4", Amount: 5.0},
-			{Address: "addr2", Amount: 1.0}, // Change
+			{Address: "addr4", Amount: 5.0 * Coin},
+			{Address: "addr2", Amount: 1.0 * Coin}, // Change
 		},
 	)
 	tx2.ID = "tx2"
@@ -534,13 +562,13 @@ func TestUTXOMultipleTransactions(t *testing.T) {
 
 	// Verify final state
 	assert.Equal(t, 3, utxoSet.GetCount())
-	assert.Equal(t, 9.0, utxoSet.GetTotalValue()) // 10.0 - 1.0 total fees
+	assert.Equal(t, Amount(9.0*Coin), utxoSet.GetTotalValue()) // 10.0 - 1.0 total fees
 
 	// Verify balances
-	assert.Equal(t, 3.0, utxoSet.GetBalance("addr1"))
-	assert.Equal(t, 1.0, utxoSet.GetBalance("addr2"))
-	assert.Equal(t, 0.0, utxoSet.GetBalance("addr3"))
-	assert.Equal(t, 5.0, utxoSet.GetBalance("addr4"))
+	assert.Equal(t, Amount(3.0*Coin), mustBalance(t, utxoSet, "addr1"))
+	assert.Equal(t, Amount(1.0*Coin), mustBalance(t, utxoSet, "addr2"))
+	assert.Equal(t, Amount(0), mustBalance(t, utxoSet, "addr3"))
+	assert.Equal(t, Amount(5.0*Coin), mustBalance(t, utxoSet, "addr4"))
 }
 
 func TestUTXOPruning(t *testing.T) {
@@ -548,9 +576,9 @@ func TestUTXOPruning(t *testing.T) {
 
 	// Add some UTXOs
 	outputs := []TxOutput{
-		{Address: "addr1", Amount: 1.0},
-		{Address: "addr2", Amount: 2.0},
-		{Address: "addr3", Amount: 1.5},
+		{Address: "addr1", Amount: 1.0 * Coin},
+		{Address: "addr2", Amount: 2.0 * Coin},
+		{Address: "addr3", Amount: 1.5 * Coin},
 	}
 
 	for i, output := range outputs {
@@ -567,7 +595,7 @@ func TestUTXOPruning(t *testing.T) {
 	err := utxoSet.PruneSpent(spentUTXOs)
 	assert.NoError(t, err)
 	assert.Equal(t, 1, utxoSet.GetCount())
-	assert.Equal(t, 2.0, utxoSet.GetTotalValue())
+	assert.Equal(t, Amount(2.0*Coin), utxoSet.GetTotalValue())
 
 	// Verify remaining UTXO
 	exists := utxoSet.Exists("tx1", 1)
@@ -579,9 +607,9 @@ func TestUTXOGetByAmount(t *testing.T) {
 
 	// Add UTXOs with different amounts
 	outputs := []TxOutput{
-		{Address: "addr1", Amount: 0.5},
-		{Address: "addr2", Amount: 2.0},
-		{Address: "addr1", Amount: 1.5},
+		{Address: "addr1", Amount: 0.5 * Coin},
+		{Address: "addr2", Amount: 2.0 * Coin},
+		{Address: "addr1", Amount: 1.5 * Coin},
 	}
 
 	for i, output := range outputs {
@@ -590,15 +618,15 @@ func TestUTXOGetByAmount(t *testing.T) {
 	}
 
 	// Get UTXOs with amount >= 1.0
-	highValueUTXOs := utxoSet.GetByAmount(1.0)
+	highValueUTXOs := utxoSet.GetByAmount(1.0 * Coin)
 	assert.Len(t, highValueUTXOs, 2)
 
 	// Get UTXOs with amount >= 2.0
-	veryHighValueUTXOs := utxoSet.GetByAmount(2.0)
+	veryHighValueUTXOs := utxoSet.GetByAmount(2.0 * Coin)
 	assert.Len(t, veryHighValueUTXOs, 1)
 
 	// Get UTXOs with amount > 2.0
-	noUTXOs := utxoSet.GetByAmount(2.1)
+	noUTXOs := utxoSet.GetByAmount(2.1 * Coin)
 	assert.Len(t, noUTXOs, 0)
 }
 
@@ -607,8 +635,8 @@ func TestUTXOGetKeys(t *testing.T) {
 
 	// Add some UTXOs
 	outputs := []TxOutput{
-		{Address: "addr1", Amount: 1.0},
-		{Address: "addr2", Amount: 2.0},
+		{Address: "addr1", Amount: 1.0 * Coin},
+		{Address: "addr2", Amount: 2.0 * Coin},
 	}
 
 	for i, output := range outputs {
@@ -634,9 +662,9 @@ func TestUTXOGetByRange(t *testing.T) {
 
 	// Add UTXOs with different amounts
 	outputs := []TxOutput{
-		{Address: "addr1", Amount: 0.5},
-		{Address: "addr2", Amount: 1.5},
-		{Address: "addr3", Amount: 2.5},
+		{Address: "addr1", Amount: 0.5 * Coin},
+		{Address: "addr2", Amount: 1.5 * Coin},
+		{Address: "addr3", Amount: 2.5 * Coin},
 	}
 
 	for i, output := range outputs {
@@ -645,17 +673,17 @@ func TestUTXOGetByRange(t *testing.T) {
 	}
 
 	// Get UTXOs in range [1.0, 2.0]
-	rangeUTXOs := utxoSet.GetUTXOsByRange(1.0, 2.0)
+	rangeUTXOs := utxoSet.GetUTXOsByRange(1.0*Coin, 2.0*Coin)
 	assert.Len(t, rangeUTXOs, 1)
-	assert.Equal(t, 1.5, rangeUTXOs[0].Amount)
+	assert.Equal(t, Amount(1.5*Coin), rangeUTXOs[0].Amount)
 
 	// Get UTXOs in range [0.0, 1.0]
-	rangeUTXOs = utxoSet.GetUTXOsByRange(0.0, 1.0)
+	rangeUTXOs = utxoSet.GetUTXOsByRange(0.0*Coin, 1.0*Coin)
 	assert.Len(t, rangeUTXOs, 1)
-	assert.Equal(t, 0.5, rangeUTXOs[0].Amount)
+	assert.Equal(t, Amount(0.5*Coin), rangeUTXOs[0].Amount)
 
 	// Get UTXOs in range [3.0, 4.0] (empty)
-	rangeUTXOs = utxoSet.GetUTXOsByRange(3.0, 4.0)
+	rangeUTXOs = utxoSet.GetUTXOsByRange(3.0*Coin, 4.0*Coin)
 	assert.Len(t, rangeUTXOs, 0)
 }
 
@@ -668,8 +696,8 @@ func TestUTXOComprehensiveOperations(t *testing.T) {
 
 	// Add UTXOs and test GetAll
 	outputs := []TxOutput{
-		{Address: "addr1", Amount: 1.0},
-		{Address: "addr2", Amount: 2.0},
+		{Address: "addr1", Amount: 1.0 * Coin},
+		{Address: "addr2", Amount: 2.0 * Coin},
 	}
 	for i, output := range outputs {
 		err := utxoSet.Add("tx1", i, output)
@@ -681,29 +709,29 @@ func TestUTXOComprehensiveOperations(t *testing.T) {
 
 	// Test GetCount and GetTotalValue
 	assert.Equal(t, 2, utxoSet.GetCount())
-	assert.Equal(t, 3.0, utxoSet.GetTotalValue())
+	assert.Equal(t, Amount(3.0*Coin), utxoSet.GetTotalValue())
 
 	// Test Clear
 	utxoSet.Clear()
 	assert.Equal(t, 0, utxoSet.GetCount())
-	assert.Equal(t, 0.0, utxoSet.GetTotalValue())
+	assert.Equal(t, Amount(0), utxoSet.GetTotalValue())
 }
 
 func TestUTXOValidationEdgeCases(t *testing.T) {
 	utxoSet := NewUTXOSet()
 
 	// Add UTXO with invalid data for validation
-	invalidOutput := TxOutput{Address: "addr1", Amount: -1.0}
+	invalidOutput := TxOutput{Address: "addr1", Amount: 0}
 	err := utxoSet.Add("tx1", 0, invalidOutput)
 	require.NoError(t, err)
 
-	// Validate should fail for negative amount
+	// Validate should fail for zero amount
 	err = utxoSet.ValidateUTXO("tx1", 0)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "invalid UTXO amount")
 
 	// Add UTXO with empty address
-	emptyAddrOutput := TxOutput{Address: "", Amount: 1.0}
+	emptyAddrOutput := TxOutput{Address: "", Amount: 1.0 * Coin}
 	err = utxoSet.Add("tx2", 0, emptyAddrOutput)
 	require.NoError(t, err)
 
@@ -717,14 +745,14 @@ func TestUTXOTransactionValidationEdgeCases(t *testing.T) {
 	utxoSet := NewUTXOSet()
 
 	// Add some UTXOs
-	output := TxOutput{Address: "addr1", Amount: 2.0}
+	output := TxOutput{Address: "addr1", Amount: 2.0 * Coin}
 	err := utxoSet.Add("tx1", 0, output)
 	require.NoError(t, err)
 
 	// Test transaction with invalid input index
 	invalidTx := NewTransaction(
 		[]TxInput{{TxID: "tx1", Index: 5}}, // Non-existent index
-		[]TxOutput{{Address: "addr2", Amount: 1.0}},
+		[]TxOutput{{Address: "addr2", Amount: 1.0 * Coin}},
 	)
 	err = utxoSet.ValidateTransaction(invalidTx)
 	assert.Error(t, err)
@@ -733,7 +761,7 @@ func TestUTXOTransactionValidationEdgeCases(t *testing.T) {
 	// Test transaction with empty inputs (non-coinbase)
 	emptyInputTx := NewTransaction(
 		[]TxInput{},
-		[]TxOutput{{Address: "addr2", Amount: 1.0}},
+		[]TxOutput{{Address: "addr2", Amount: 1.0 * Coin}},
 	)
 	err = utxoSet.ValidateTransaction(emptyInputTx)
 	assert.NoError(t, err) // Empty inputs are technically valid
@@ -743,7 +771,7 @@ func TestUTXOProcessingEdgeCases(t *testing.T) {
 	utxoSet := NewUTXOSet()
 
 	// Test processing coinbase transaction
-	coinbaseTx := NewCoinbaseTransaction("addr1", 1.0)
+	coinbaseTx := NewCoinbaseTransaction("addr1", 1.0*Coin)
 	coinbaseTx.ID = "coinbase1"
 
 	err := utxoSet.ProcessTransaction(coinbaseTx)
@@ -754,7 +782,7 @@ func TestUTXOProcessingEdgeCases(t *testing.T) {
 	// Test processing transaction that fails validation
 	invalidTx := NewTransaction(
 		[]TxInput{{TxID: "nonexistent", Index: 0}},
-		[]TxOutput{{Address: "addr2", Amount: 1.0}},
+		[]TxOutput{{Address: "addr2", Amount: 1.0 * Coin}},
 	)
 	invalidTx.ID = "invalid1"
 
@@ -768,11 +796,11 @@ func TestUTXOSelectionStrategies(t *testing.T) {
 
 	// Add UTXOs with varying amounts
 	outputs := []TxOutput{
-		{Address: "addr1", Amount: 0.1},
-		{Address: "addr1", Amount: 0.5},
-		{Address: "addr1", Amount: 1.0},
-		{Address: "addr1", Amount: 2.0},
-		{Address: "addr1", Amount: 5.0},
+		{Address: "addr1", Amount: 0.1 * Coin},
+		{Address: "addr1", Amount: 0.5 * Coin},
+		{Address: "addr1", Amount: 1.0 * Coin},
+		{Address: "addr1", Amount: 2.0 * Coin},
+		{Address: "addr1", Amount: 5.0 * Coin},
 	}
 
 	for i, output := range outputs {
@@ -781,19 +809,19 @@ func TestUTXOSelectionStrategies(t *testing.T) {
 	}
 
 	// Test exact match selection
-	selected, total, err := utxoSet.FindUTXOsForAmount(1.0, "addr1")
+	selected, total, err := utxoSet.FindUTXOsForAmount(1.0*Coin, "addr1")
 	assert.NoError(t, err)
 	assert.Len(t, selected, 1)
-	assert.Equal(t, 1.0, total)
+	assert.Equal(t, Amount(1.0*Coin), total)
 
 	// Test selection requiring multiple UTXOs
-	selected, total, err = utxoSet.FindUTXOsForAmount(6.0, "addr1")
+	selected, total, err = utxoSet.FindUTXOsForAmount(6.0*Coin, "addr1")
 	assert.NoError(t, err)
 	assert.Greater(t, len(selected), 1)
-	assert.GreaterOrEqual(t, total, 6.0)
+	assert.GreaterOrEqual(t, total, Amount(6.0*Coin))
 
 	// Test selection with insufficient funds
-	_, _, err = utxoSet.FindUTXOsForAmount(10.0, "addr1")
+	_, _, err = utxoSet.FindUTXOsForAmount(10.0*Coin, "addr1")
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "insufficient funds")
 }
@@ -804,16 +832,16 @@ func TestUTXOStatisticsAndAnalytics(t *testing.T) {
 	// Test stats on empty set
 	stats := utxoSet.GetStats()
 	assert.Equal(t, 0, stats["total_count"])
-	assert.Equal(t, 0.0, stats["total_value"])
+	assert.Equal(t, Amount(0), stats["total_value"])
 	assert.Equal(t, 0, stats["address_count"])
-	assert.Equal(t, 0.0, stats["average_utxo_value"])
+	assert.Equal(t, Amount(0), stats["average_utxo_value"])
 
 	// Add UTXOs for multiple addresses
 	outputs := []TxOutput{
-		{Address: "addr1", Amount: 1.0},
-		{Address: "addr1", Amount: 2.0},
-		{Address: "addr2", Amount: 3.0},
-		{Address: "addr3", Amount: 4.0},
+		{Address: "addr1", Amount: 1.0 * Coin},
+		{Address: "addr1", Amount: 2.0 * Coin},
+		{Address: "addr2", Amount: 3.0 * Coin},
+		{Address: "addr3", Amount: 4.0 * Coin},
 	}
 
 	for i, output := range outputs {
@@ -823,9 +851,9 @@ func TestUTXOStatisticsAndAnalytics(t *testing.T) {
 
 	stats = utxoSet.GetStats()
 	assert.Equal(t, 4, stats["total_count"])
-	assert.Equal(t, 10.0, stats["total_value"])
+	assert.Equal(t, Amount(10.0*Coin), stats["total_value"])
 	assert.Equal(t, 3, stats["address_count"])
-	assert.Equal(t, 2.5, stats["average_utxo_value"])
+	assert.Equal(t, Amount(2.5*Coin), stats["average_utxo_value"])
 
 	// Verify address-specific stats
 	addressCounts := stats["address_counts"].(map[string]int)
@@ -833,10 +861,10 @@ func TestUTXOStatisticsAndAnalytics(t *testing.T) {
 	assert.Equal(t, 1, addressCounts["addr2"])
 	assert.Equal(t, 1, addressCounts["addr3"])
 
-	addressValues := stats["address_values"].(map[string]float64)
-	assert.Equal(t, 3.0, addressValues["addr1"])
-	assert.Equal(t, 3.0, addressValues["addr2"])
-	assert.Equal(t, 4.0, addressValues["addr3"])
+	addressValues := stats["address_values"].(map[string]Amount)
+	assert.Equal(t, Amount(3.0*Coin), addressValues["addr1"])
+	assert.Equal(t, Amount(3.0*Coin), addressValues["addr2"])
+	assert.Equal(t, Amount(4.0*Coin), addressValues["addr3"])
 }
 
 func TestUTXOBatchOperations(t *testing.T) {
@@ -845,22 +873,22 @@ func TestUTXOBatchOperations(t *testing.T) {
 	// Test AddBatch with multiple transactions
 	batchUTXOs := map[string]map[int]TxOutput{
 		"tx1": {
-			0: {Address: "addr1", Amount: 1.0},
-			1: {Address: "addr2", Amount: 2.0},
+			0: {Address: "addr1", Amount: 1.0 * Coin},
+			1: {Address: "addr2", Amount: 2.0 * Coin},
 		},
 		"tx2": {
-			0: {Address: "addr3", Amount: 3.0},
-			1: {Address: "addr1", Amount: 1.5},
+			0: {Address: "addr3", Amount: 3.0 * Coin},
+			1: {Address: "addr1", Amount: 1.5 * Coin},
 		},
 		"tx3": {
-			0: {Address: "addr2", Amount: 2.5},
+			0: {Address: "addr2", Amount: 2.5 * Coin},
 		},
 	}
 
 	err := utxoSet.AddBatch(batchUTXOs)
 	assert.NoError(t, err)
 	assert.Equal(t, 5, utxoSet.GetCount())
-	assert.Equal(t, 10.0, utxoSet.GetTotalValue())
+	assert.Equal(t, Amount(10.0*Coin), utxoSet.GetTotalValue())
 
 	// Test AddBatch with duplicate UTXOs
 	err = utxoSet.AddBatch(batchUTXOs)
@@ -877,7 +905,7 @@ func TestUTXOBatchOperations(t *testing.T) {
 	err = utxoSet.PruneSpent(spentUTXOs)
 	assert.NoError(t, err)
 	assert.Equal(t, 2, utxoSet.GetCount())
-	assert.Equal(t, 3.5, utxoSet.GetTotalValue())
+	assert.Equal(t, Amount(3.5*Coin), utxoSet.GetTotalValue())
 }
 
 func TestUTXOComplexTransactionScenarios(t *testing.T) {
@@ -886,9 +914,9 @@ func TestUTXOComplexTransactionScenarios(t *testing.T) {
 	// Create initial funding
 	fundingUTXOs := map[string]map[int]TxOutput{
 		"funding": {
-			0: {Address: "alice", Amount: 10.0},
-			1: {Address: "bob", Amount: 5.0},
-			2: {Address: "charlie", Amount: 3.0},
+			0: {Address: "alice", Amount: 10.0 * Coin},
+			1: {Address: "bob", Amount: 5.0 * Coin},
+			2: {Address: "charlie", Amount: 3.0 * Coin},
 		},
 	}
 
@@ -899,9 +927,9 @@ func TestUTXOComplexTransactionScenarios(t *testing.T) {
 	tx1 := NewTransaction(
 		[]TxInput{{TxID: "funding", Index: 0}}, // Alice spends 10.0
 		[]TxOutput{
-			{Address: "bob", Amount: 6.0},
-			{Address: "charlie", Amount: 2.0},
-			{Address: "alice", Amount: 1.5}, // Change
+			{Address: "bob", Amount: 6.0 * Coin},
+			{Address: "charlie", Amount: 2.0 * Coin},
+			{Address: "alice", Amount: 1.5 * Coin}, // Change
 		},
 	)
 	tx1.ID = "tx1"
@@ -910,15 +938,15 @@ func TestUTXOComplexTransactionScenarios(t *testing.T) {
 	assert.NoError(t, err)
 
 	// Verify state
-	assert.Equal(t, 5, utxoSet.GetCount())         // 3 spent, 3 added = +0
-	assert.Equal(t, 17.5, utxoSet.GetTotalValue()) // 18.0 - 0.5 fee
+	assert.Equal(t, 5, utxoSet.GetCount())                      // 3 spent, 3 added = +0
+	assert.Equal(t, Amount(17.5*Coin), utxoSet.GetTotalValue()) // 18.0 - 0.5 fee
 
 	// Another transaction: Bob pays Dave
 	tx2 := NewTransaction(
 		[]TxInput{{TxID: "funding", Index: 1}}, // Bob spends 5.0
 		[]TxOutput{
-			{Address: "dave", Amount: 4.0},
-			{Address: "bob", Amount: 0.8}, // Change
+			{Address: "dave", Amount: 4.0 * Coin},
+			{Address: "bob", Amount: 0.8 * Coin}, // Change
 		},
 	)
 	tx2.ID = "tx2"
@@ -927,10 +955,10 @@ func TestUTXOComplexTransactionScenarios(t *testing.T) {
 	assert.NoError(t, err)
 
 	// Verify final balances
-	assert.Equal(t, 1.5, utxoSet.GetBalance("alice"))
-	assert.Equal(t, 6.8, utxoSet.GetBalance("bob"))     // 1.0 + 5.0 + 0.8
-	assert.Equal(t, 5.0, utxoSet.GetBalance("charlie")) // 2.0 + 3.0
-	assert.Equal(t, 4.0, utxoSet.GetBalance("dave"))
+	assert.Equal(t, Amount(1.5*Coin), mustBalance(t, utxoSet, "alice"))
+	assert.Equal(t, Amount(6.8*Coin), mustBalance(t, utxoSet, "bob"))     // 1.0 + 5.0 + 0.8
+	assert.Equal(t, Amount(5.0*Coin), mustBalance(t, utxoSet, "charlie")) // 2.0 + 3.0
+	assert.Equal(t, Amount(4.0*Coin), mustBalance(t, utxoSet, "dave"))
 }
 
 func TestUTXOErrorHandlingAndRecovery(t *testing.T) {
@@ -968,7 +996,7 @@ func TestUTXOErrorHandlingAndRecovery(t *testing.T) {
 		{
 			name: "select from non-existent address",
 			testFunc: func(t *testing.T) {
-				_, _, err := utxoSet.SelectForAmount(1.0, "nonexistent")
+				_, _, err := utxoSet.SelectForAmount(1.0*Coin, "nonexistent")
 				assert.Error(t, err)
 				assert.Contains(t, err.Error(), "no UTXOs found for address")
 			},
@@ -976,7 +1004,7 @@ func TestUTXOErrorHandlingAndRecovery(t *testing.T) {
 		{
 			name: "find for non-existent address",
 			testFunc: func(t *testing.T) {
-				_, _, err := utxoSet.FindUTXOsForAmount(1.0, "nonexistent")
+				_, _, err := utxoSet.FindUTXOsForAmount(1.0*Coin, "nonexistent")
 				assert.Error(t, err)
 				assert.Contains(t, err.Error(), "no UTXOs found")
 			},
@@ -984,7 +1012,7 @@ func TestUTXOErrorHandlingAndRecovery(t *testing.T) {
 		{
 			name: "invalid target amount",
 			testFunc: func(t *testing.T) {
-				_, _, err := utxoSet.SelectForAmount(-1.0, "addr1")
+				_, _, err := utxoSet.SelectForAmount(0, "addr1")
 				assert.Error(t, err)
 				assert.Contains(t, err.Error(), "target amount must be positive")
 			},
@@ -1004,7 +1032,7 @@ func TestUTXOMemoryEfficiency(t *testing.T) {
 	for i := 0; i < numUTXOs; i++ {
 		output := TxOutput{
 			Address: fmt.Sprintf("addr%d", i%10),
-			Amount:  float64(i) + 0.5,
+			Amount:  Amount(i)*Coin + Coin/2,
 		}
 		err := utxoSet.Add(fmt.Sprintf("tx%d", i), 0, output)
 		require.NoError(t, err)
@@ -1019,11 +1047,11 @@ func TestUTXOMemoryEfficiency(t *testing.T) {
 	}
 
 	// Test balance calculations
-	totalBalance := 0.0
+	var totalBalance Amount
 	for i := 0; i < 10; i++ {
-		balance := utxoSet.GetBalance(fmt.Sprintf("addr%d", i))
+		balance := mustBalance(t, utxoSet, fmt.Sprintf("addr%d", i))
 		totalBalance += balance
-		assert.Greater(t, balance, 0.0)
+		assert.Greater(t, balance, Amount(0))
 	}
 
 	assert.Equal(t, utxoSet.GetTotalValue(), totalBalance)
@@ -1038,3 +1066,54 @@ func TestUTXOMemoryEfficiency(t *testing.T) {
 	assert.Equal(t, numUTXOs-1, utxoSet.GetCount())
 	assert.Equal(t, numUTXOs, clone.GetCount())
 }
+
+func TestApplyAndRevertTransactions(t *testing.T) {
+	utxoSet := NewUTXOSet()
+	prevOutput := TxOutput{Address: testKeyAddress, Amount: 10 * Coin}
+	require.NoError(t, utxoSet.Add("tx0", 0, prevOutput))
+
+	// tx2 spends an output created by tx1 in the same batch
+	tx1 := NewTransaction([]TxInput{{TxID: "tx0", Index: 0}}, []TxOutput{{Address: testKeyAddress, Amount: 10 * Coin}})
+	require.NoError(t, tx1.SignTransaction(0, testPrivateKey, []TxOutput{prevOutput}))
+	tx2 := NewTransaction([]TxInput{{TxID: tx1.ID, Index: 0}}, []TxOutput{{Address: "addr3", Amount: 6 * Coin}, {Address: "addr4", Amount: 4 * Coin}})
+	require.NoError(t, tx2.SignTransaction(0, testPrivateKey, tx1.Outputs))
+	txs := []*Transaction{tx1, tx2}
+
+	spent, err := utxoSet.ApplyTransactions(txs)
+	require.NoError(t, err)
+	assert.Len(t, spent, 2)
+	assert.Equal(t, testKeyAddress, spent[0].Output.Address)
+	assert.False(t, utxoSet.Exists("tx0", 0))
+	assert.False(t, utxoSet.Exists(tx1.ID, 0))
+	assert.True(t, utxoSet.Exists(tx2.ID, 1))
+	assert.Equal(t, 2, utxoSet.GetCount())
+
+	require.NoError(t, utxoSet.RevertTransactions(txs, spent))
+	assert.True(t, utxoSet.Exists("tx0", 0))
+	assert.False(t, utxoSet.Exists(tx1.ID, 0))
+	assert.False(t, utxoSet.Exists(tx2.ID, 0))
+	assert.Equal(t, 1, utxoSet.GetCount())
+	assert.Equal(t, Amount(10.0*Coin), utxoSet.GetTotalValue())
+
+	// Mismatched undo log is rejected
+	assert.Error(t, utxoSet.RevertTransactions(txs, spent[:1]))
+}
+
+func TestApplyTransactionsIsAtomic(t *testing.T) {
+	utxoSet := NewUTXOSet()
+	prevOutput := TxOutput{Address: testKeyAddress, Amount: 10 * Coin}
+	require.NoError(t, utxoSet.Add("tx0", 0, prevOutput))
+
+	tx1 := NewTransaction([]TxInput{{TxID: "tx0", Index: 0}}, []TxOutput{{Address: "addr2", Amount: 10 * Coin}})
+	require.NoError(t, tx1.SignTransaction(0, testPrivateKey, []TxOutput{prevOutput}))
+	doubleSpend := NewTransaction([]TxInput{{TxID: "tx0", Index: 0}}, []TxOutput{{Address: "addr3", Amount: 10 * Coin}})
+
+	_, err := utxoSet.ApplyTransactions([]*Transaction{tx1, doubleSpend})
+	assert.Error(t, err)
+
+	// Nothing from the failed batch remains applied
+	assert.True(t, utxoSet.Exists("tx0", 0))
+	assert.False(t, utxoSet.Exists(tx1.ID, 0))
+	assert.Equal(t, 1, utxoSet.GetCount())
+	assert.Equal(t, Amount(10.0*Coin), utxoSet.GetTotalValue())
+}
@@ -2,7 +2,8 @@ package transactions
 
 import (
 	"fmt"
-	"math"
+
+	"github.com/aliexe/blockChain/internal/crypto"
 )
 
 // ValidateAmounts validates transaction amounts and sums
@@ -11,35 +12,35 @@ func (tx *Transaction) ValidateAmounts(utxoSet map[string]map[int]TxOutput) erro
 		if len(tx.Outputs) != 1 {
 			return fmt.Errorf("coinbase transaction must have exactly one output")
 		}
-		if tx.Outputs[0].Amount <= 0 {
+		if tx.Outputs[0].Amount == 0 {
 			return fmt.Errorf("coinbase amount must be positive")
 		}
+		if !tx.Outputs[0].Amount.IsValid() {
+			return fmt.Errorf("coinbase amount %s exceeds maximum %s", tx.Outputs[0].Amount, MaxMoney)
+		}
 		return nil
 	}
 
 	// Calculate total input and output amounts
 	inputAmount := tx.GetInputAmount(utxoSet)
-	outputAmount := tx.GetOutputAmount()
+	outputAmount, err := tx.outputTotal()
+	if err != nil {
+		return err
+	}
 
 	// Check that output amount doesn't exceed input amount
 	if outputAmount > inputAmount {
-		return fmt.Errorf("output amount (%.8f) exceeds input amount (%.8f)",
+		return fmt.Errorf("output amount (%s) exceeds input amount (%s)",
 			outputAmount, inputAmount)
 	}
 
-	// Check that fee is non-negative
-	fee := tx.GetFee(utxoSet)
-	if fee < 0 {
-		return fmt.Errorf("transaction fee cannot be negative: %.8f", fee)
-	}
-
 	// Validate individual output amounts
 	for i, output := range tx.Outputs {
-		if output.Amount <= 0 {
-			return fmt.Errorf("output %d has invalid amount: %.8f", i, output.Amount)
+		if output.Amount == 0 {
+			return fmt.Errorf("output %d has invalid amount: %s", i, output.Amount)
 		}
-		if math.IsNaN(outputAmount) || math.IsInf(outputAmount, 0) {
-			return fmt.Errorf("output %d has invalid amount value: %f", i, output.Amount)
+		if !output.Amount.IsValid() {
+			return fmt.Errorf("output %d amount %s exceeds maximum %s", i, output.Amount, MaxMoney)
 		}
 	}
 
@@ -66,10 +67,9 @@ func (tx *Transaction) ValidateInputs(utxoSet map[string]map[int]TxOutput) error
 				i, input.Index, input.TxID)
 		}
 
-		// Validate the signature
-		err := tx.VerifyInputSignature(i, []TxOutput{output})
-		if err != nil {
-			return fmt.Errorf("input %d signature verification failed: %w", i, err)
+		// Run the unlocking script against the output's locking script
+		if err := tx.VerifyInputScript(i, output); err != nil {
+			return fmt.Errorf("input %d script verification failed: %w", i, err)
 		}
 	}
 
@@ -77,9 +77,9 @@ func (tx *Transaction) ValidateInputs(utxoSet map[string]map[int]TxOutput) error
 }
 
 // CalculateChange calculates the change amount for a transaction
-func CalculateChange(inputAmount, outputAmount, desiredFee float64) (float64, float64, error) {
+func CalculateChange(inputAmount, outputAmount, desiredFee Amount) (Amount, Amount, error) {
 	if inputAmount <= outputAmount {
-		return 0, 0, fmt.Errorf("input amount (%.8f) must be greater than output amount (%.8f)",
+		return 0, 0, fmt.Errorf("input amount (%s) must be greater than output amount (%s)",
 			inputAmount, outputAmount)
 	}
 
@@ -87,9 +87,8 @@ func CalculateChange(inputAmount, outputAmount, desiredFee float64) (float64, fl
 	actualFee := inputAmount - outputAmount
 
 	// Calculate change (if any)
-	change := inputAmount - outputAmount - desiredFee
-
-	if change < 0 {
+	change, err := actualFee.Sub(desiredFee)
+	if err != nil {
 		change = 0
 	}
 
@@ -97,7 +96,7 @@ func CalculateChange(inputAmount, outputAmount, desiredFee float64) (float64, fl
 }
 
 // CreateChangeOutput creates a change output
-func CreateChangeOutput(address string, amount float64) TxOutput {
+func CreateChangeOutput(address string, amount Amount) TxOutput {
 	return TxOutput{
 		Address: address,
 		Amount:  amount,
@@ -106,40 +105,32 @@ func CreateChangeOutput(address string, amount float64) TxOutput {
 	}
 }
 
-// ValidateAddressFormat validates a blockchain address format
+// ValidateAddressFormat checks that an address is a canonical (lowercase)
+// address of a known network with a valid checksum
 func ValidateAddressFormat(address string) error {
+	return ValidateAddressForNetwork(address, nil)
+}
+
+// ValidateAddressForNetwork checks an address like ValidateAddressFormat and,
+// if network is not nil, that it belongs to network
+func ValidateAddressForNetwork(address string, network *crypto.Network) error {
 	if address == "" {
 		return fmt.Errorf("address cannot be empty")
 	}
 
-	if len(address) != 42 { // 0x + 40 hex characters
-		return fmt.Errorf("address must be 42 characters long, got %d", len(address))
+	decoded, err := crypto.DecodeAddressForNetwork(address, network)
+	if err != nil {
+		return err
 	}
 
-	if !HasHexPrefix(address) {
-		return fmt.Errorf("address must start with 0x prefix")
-	}
-
-	// Validate hex characters
-	for _, char := range address[2:] {
-		if !isHexChar(byte(char)) {
-			return fmt.Errorf("address contains invalid hex character: %c", char)
-		}
+	// Outputs are matched by string, so each address has one spelling
+	if decoded.String() != address {
+		return fmt.Errorf("address must be lowercase: %s", address)
 	}
 
 	return nil
 }
 
-// HasHexPrefix checks if string has 0x prefix
-func HasHexPrefix(s string) bool {
-	return len(s) >= 2 && s[0] == '0' && (s[1] == 'x' || s[1] == 'X')
-}
-
-// isHexChar checks if character is a valid hex character
-func isHexChar(c byte) bool {
-	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
-}
-
 // ValidateTransactionStructure performs comprehensive validation
 func (tx *Transaction) ValidateTransactionStructure(utxoSet map[string]map[int]TxOutput) error {
 	// Basic validation
@@ -194,7 +185,7 @@ func (tx *Transaction) GetValidationReport(utxoSet map[string]map[int]TxOutput)
 	}
 
 	// Check for warnings
-	if tx.GetFee(utxoSet) > 0.01 {
+	if tx.GetFee(utxoSet) > Coin/100 {
 		report["warnings"] = append(report["warnings"].([]string), "High transaction fee")
 	}
 
@@ -7,9 +7,11 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"sync"
 	"time"
 
@@ -19,7 +21,18 @@ import (
 	"github.com/aliexe/blockChain/internal/transactions"
 )
 
-// Wallet represents a cryptocurrency wallet
+const (
+	// ReceivePath is the BIP44 chain that wallet addresses are derived from
+	ReceivePath = "m/44'/0'/0'/0"
+	// DefaultGapLimit is the number of consecutive unused addresses scanned
+	// past the last used one when restoring a wallet
+	DefaultGapLimit = 20
+)
+
+// Wallet represents a cryptocurrency wallet. Addresses are derived from the
+// seed of its mnemonic phrase, so the phrase alone is enough to restore them.
+// Wallets created before mnemonics were introduced have no phrase and keep
+// generating independent random keys.
 type Wallet struct {
 	Name      string                     `json:"name"`
 	CreatedAt time.Time                  `json:"created_at"`
@@ -28,7 +41,11 @@ type Wallet struct {
 	Addresses []string                   `json:"addresses"`
 	Encrypted bool                       `json:"encrypted"`
 	Metadata  map[string]string          `json:"metadata"`
-	mu        sync.RWMutex               `json:"-"`
+	Mnemonic  string                     `json:"-"`          // Recovery phrase, cleared while encrypted
+	NextIndex uint32                     `json:"next_index"` // Next child index on ReceivePath
+	Network   *crypto.Network            `json:"-"`          // Network addresses are encoded for
+	chainKey  *crypto.ExtendedKey
+	mu        sync.RWMutex `json:"-"`
 }
 
 // WalletStorage represents the serialized wallet format
@@ -41,6 +58,9 @@ type WalletStorage struct {
 	Encrypted      bool                 `json:"encrypted"`
 	EncryptionData *EncryptionData      `json:"encryption_data,omitempty"`
 	Metadata       map[string]string    `json:"metadata"`
+	Mnemonic       string               `json:"mnemonic,omitempty"`
+	NextIndex      uint32               `json:"next_index,omitempty"`
+	Network        string               `json:"network,omitempty"`
 }
 
 // EncryptionData contains encryption metadata
@@ -55,6 +75,8 @@ type WalletConfig struct {
 	Name        string
 	Passphrase  string
 	Description string
+	Mnemonic    string          // Recovery phrase to restore; a new one is generated if empty
+	Network     *crypto.Network // Network of the wallet's addresses, mainnet if nil
 }
 
 // NewWallet creates a new wallet
@@ -72,12 +94,28 @@ func NewWallet(config WalletConfig) (*Wallet, error) {
 		Addresses: []string{},
 		Encrypted: false,
 		Metadata:  make(map[string]string),
+		Network:   config.Network,
+	}
+	if wallet.Network == nil {
+		wallet.Network = crypto.MainNet
 	}
 
 	if config.Description != "" {
 		wallet.Metadata["description"] = config.Description
 	}
 
+	mnemonic := config.Mnemonic
+	if mnemonic == "" {
+		var err error
+		mnemonic, err = crypto.NewMnemonic(crypto.DefaultEntropyBits)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate mnemonic: %w", err)
+		}
+	}
+	if err := wallet.setMnemonicLocked(mnemonic); err != nil {
+		return nil, err
+	}
+
 	// Generate initial address
 	_, err := wallet.GenerateNewAddress()
 	if err != nil {
@@ -104,20 +142,191 @@ func (w *Wallet) GenerateNewAddress() (string, error) {
 		return "", fmt.Errorf("cannot generate address on encrypted wallet")
 	}
 
-	// Generate new key pair
-	keyPair, err := crypto.NewKeyPair()
+	var keyPair *crypto.KeyPair
+	var err error
+	if w.chainKey != nil {
+		keyPair, err = w.deriveNextLocked()
+	} else {
+		keyPair, err = crypto.NewKeyPairForNetwork(w.networkLocked())
+	}
 	if err != nil {
 		return "", fmt.Errorf("failed to generate key pair: %w", err)
 	}
 
 	// Store key pair
-	w.KeyPairs[keyPair.Address] = keyPair
-	w.Addresses = append(w.Addresses, keyPair.Address)
+	w.addKeyPairLocked(keyPair)
 	w.UpdatedAt = time.Now()
 
 	return keyPair.Address, nil
 }
 
+// setMnemonicLocked validates a recovery phrase and derives the receive chain
+// key from its seed (assumes lock is held)
+func (w *Wallet) setMnemonicLocked(mnemonic string) error {
+	if !crypto.ValidateMnemonic(mnemonic) {
+		return fmt.Errorf("invalid mnemonic phrase")
+	}
+	seed, err := crypto.MnemonicToSeed(mnemonic, "")
+	if err != nil {
+		return err
+	}
+	master, err := crypto.NewMasterKey(seed)
+	if err != nil {
+		return fmt.Errorf("failed to derive master key: %w", err)
+	}
+	chainKey, err := master.DerivePath(ReceivePath)
+	if err != nil {
+		return fmt.Errorf("failed to derive receive chain: %w", err)
+	}
+
+	w.Mnemonic = mnemonic
+	w.chainKey = chainKey
+	return nil
+}
+
+// deriveKeyLocked derives the key pair at a child index of the receive chain.
+// The returned index is the next one to use, skipping indexes that give no
+// valid key (assumes lock is held).
+func (w *Wallet) deriveKeyLocked(index uint32) (*crypto.KeyPair, uint32, error) {
+	for {
+		child, err := w.chainKey.Child(index)
+		index++
+		if err == crypto.ErrInvalidChild {
+			continue
+		}
+		if err != nil {
+			return nil, index, err
+		}
+		keyPair, err := child.KeyPairForNetwork(w.networkLocked())
+		return keyPair, index, err
+	}
+}
+
+// deriveNextLocked derives the key pair at NextIndex and advances it
+// (assumes lock is held)
+func (w *Wallet) deriveNextLocked() (*crypto.KeyPair, error) {
+	keyPair, next, err := w.deriveKeyLocked(w.NextIndex)
+	if err != nil {
+		return nil, err
+	}
+	w.NextIndex = next
+	return keyPair, nil
+}
+
+// deriveUpToLocked makes sure the wallet holds every derived key below index
+// (assumes lock is held)
+func (w *Wallet) deriveUpToLocked(index uint32) error {
+	next := uint32(0)
+	for next < index {
+		keyPair, n, err := w.deriveKeyLocked(next)
+		if err != nil {
+			return fmt.Errorf("failed to derive address %d: %w", next, err)
+		}
+		w.addKeyPairLocked(keyPair)
+		next = n
+	}
+	if next > w.NextIndex {
+		w.NextIndex = next
+	}
+	return nil
+}
+
+// addKeyPairLocked stores a key pair and lists its address once
+// (assumes lock is held)
+func (w *Wallet) addKeyPairLocked(keyPair *crypto.KeyPair) {
+	w.KeyPairs[keyPair.Address] = keyPair
+	if !slices.Contains(w.Addresses, keyPair.Address) {
+		w.Addresses = append(w.Addresses, keyPair.Address)
+	}
+}
+
+// networkLocked returns the wallet's network, mainnet if unset
+// (assumes lock is held)
+func (w *Wallet) networkLocked() *crypto.Network {
+	if w.Network == nil {
+		return crypto.MainNet
+	}
+	return w.Network
+}
+
+// restoreKeysLocked rebuilds the key pairs of a decoded wallet from its key
+// stores and recovery phrase (assumes lock is held)
+func (w *Wallet) restoreKeysLocked(walletStorage *WalletStorage) error {
+	w.KeyPairs = make(map[string]*crypto.KeyPair)
+	for _, keyStore := range walletStorage.KeyStores {
+		keyPair, err := crypto.FromStorage(keyStore)
+		if err != nil {
+			return fmt.Errorf("failed to restore key pair: %w", err)
+		}
+		w.KeyPairs[keyPair.Address] = keyPair
+	}
+
+	if walletStorage.Mnemonic == "" {
+		return nil
+	}
+	if err := w.setMnemonicLocked(walletStorage.Mnemonic); err != nil {
+		return err
+	}
+	// A backup holding only the phrase still knows how many addresses were used
+	return w.deriveUpToLocked(max(walletStorage.NextIndex, 1))
+}
+
+// MnemonicPhrase returns the recovery phrase of the wallet
+func (w *Wallet) MnemonicPhrase() (string, error) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	if w.Encrypted {
+		return "", fmt.Errorf("wallet is encrypted")
+	}
+	if w.Mnemonic == "" {
+		return "", fmt.Errorf("wallet has no mnemonic phrase")
+	}
+	return w.Mnemonic, nil
+}
+
+// ScanAddresses derives addresses in order and adds every address up to the
+// last one holding outputs in utxoSet. Scanning stops after gapLimit
+// consecutive unused addresses. It returns the number of used addresses.
+func (w *Wallet) ScanAddresses(utxoSet *transactions.UTXOSet, gapLimit int) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.Encrypted {
+		return 0, fmt.Errorf("cannot scan addresses on encrypted wallet")
+	}
+	if w.chainKey == nil {
+		return 0, fmt.Errorf("wallet has no mnemonic phrase")
+	}
+	if gapLimit <= 0 {
+		gapLimit = DefaultGapLimit
+	}
+
+	used := 0
+	lastUsed := uint32(0)
+	index := uint32(0)
+	for gap := 0; gap < gapLimit; {
+		keyPair, next, err := w.deriveKeyLocked(index)
+		if err != nil {
+			return used, fmt.Errorf("failed to derive address %d: %w", index, err)
+		}
+		if len(utxoSet.GetByAddress(keyPair.Address)) > 0 {
+			used++
+			lastUsed = next
+			gap = 0
+		} else {
+			gap++
+		}
+		index = next
+	}
+
+	if err := w.deriveUpToLocked(lastUsed); err != nil {
+		return used, err
+	}
+	w.UpdatedAt = time.Now()
+	return used, nil
+}
+
 // GetKeyPair retrieves a key pair by address
 func (w *Wallet) GetKeyPair(address string) (*crypto.KeyPair, error) {
 	w.mu.RLock()
@@ -154,7 +363,7 @@ func (w *Wallet) GetAddressCount() int {
 }
 
 // CalculateBalance calculates the total balance for the wallet
-func (w *Wallet) CalculateBalance(utxoSet map[string]map[int]transactions.TxOutput) (float64, error) {
+func (w *Wallet) CalculateBalance(utxoSet map[string]map[int]transactions.TxOutput) (transactions.Amount, error) {
 	w.mu.RLock()
 	defer w.mu.RUnlock()
 
@@ -162,7 +371,7 @@ func (w *Wallet) CalculateBalance(utxoSet map[string]map[int]transactions.TxOutp
 		return 0, fmt.Errorf("cannot calculate balance on encrypted wallet")
 	}
 
-	var totalBalance float64
+	var totalBalance transactions.Amount
 
 	for _, address := range w.Addresses {
 		// Find all UTXOs for this address
@@ -183,7 +392,7 @@ func (w *Wallet) CalculateBalance(utxoSet map[string]map[int]transactions.TxOutp
 }
 
 // GetAddressBalance calculates balance for a specific address
-func (w *Wallet) GetAddressBalance(address string, utxoSet map[string]map[int]transactions.TxOutput) (float64, error) {
+func (w *Wallet) GetAddressBalance(address string, utxoSet map[string]map[int]transactions.TxOutput) (transactions.Amount, error) {
 	w.mu.RLock()
 	defer w.mu.RUnlock()
 
@@ -197,7 +406,7 @@ func (w *Wallet) GetAddressBalance(address string, utxoSet map[string]map[int]tr
 		return 0, fmt.Errorf("address not found in wallet: %s", address)
 	}
 
-	var addressBalance float64
+	var addressBalance transactions.Amount
 
 	// Find all UTXOs for this address
 	for _, outputs := range utxoSet {
@@ -243,6 +452,9 @@ func (w *Wallet) Encrypt(passphrase string) error {
 		Addresses: w.Addresses,
 		Encrypted: true,
 		Metadata:  w.Metadata,
+		Mnemonic:  w.Mnemonic,
+		NextIndex: w.NextIndex,
+		Network:   w.networkLocked().Name,
 	}
 
 	data, err := json.Marshal(walletData)
@@ -258,6 +470,8 @@ func (w *Wallet) Encrypt(passphrase string) error {
 
 	// Clear unencrypted data
 	w.KeyPairs = make(map[string]*crypto.KeyPair)
+	w.Mnemonic = ""
+	w.chainKey = nil
 
 	// Store encrypted data in metadata temporarily
 	w.Metadata["encrypted_data"] = hex.EncodeToString(encryptedData)
@@ -326,13 +540,8 @@ func (w *Wallet) Decrypt(passphrase string) error {
 	}
 
 	// Restore key pairs
-	w.KeyPairs = make(map[string]*crypto.KeyPair)
-	for _, keyStore := range walletStorage.KeyStores {
-		keyPair, err := crypto.FromStorage(keyStore)
-		if err != nil {
-			return fmt.Errorf("failed to restore key pair: %w", err)
-		}
-		w.KeyPairs[keyPair.Address] = keyPair
+	if err := w.restoreKeysLocked(&walletStorage); err != nil {
+		return err
 	}
 
 	// Clear encrypted data from metadata
@@ -371,6 +580,8 @@ func (w *Wallet) SaveToFile(filename string) error {
 			Addresses: w.Addresses,
 			Encrypted: true,
 			Metadata:  make(map[string]string),
+			NextIndex: w.NextIndex,
+			Network:   w.networkLocked().Name,
 		}
 
 		// Copy encryption metadata
@@ -411,6 +622,9 @@ func (w *Wallet) SaveToFile(filename string) error {
 			Addresses: w.Addresses,
 			Encrypted: false,
 			Metadata:  w.Metadata,
+			Mnemonic:  w.Mnemonic,
+			NextIndex: w.NextIndex,
+			Network:   w.networkLocked().Name,
 		}
 	}
 
@@ -446,6 +660,15 @@ func LoadFromFile(filename string) (*Wallet, error) {
 		return nil, fmt.Errorf("failed to unmarshal wallet storage: %w", err)
 	}
 
+	// Wallets saved before networks were introduced are mainnet wallets
+	network := crypto.MainNet
+	if walletStorage.Network != "" {
+		network, err = crypto.NetworkByName(walletStorage.Network)
+		if err != nil {
+			return nil, fmt.Errorf("invalid wallet network: %w", err)
+		}
+	}
+
 	wallet := &Wallet{
 		Name:      walletStorage.Name,
 		CreatedAt: walletStorage.CreatedAt,
@@ -453,8 +676,13 @@ func LoadFromFile(filename string) (*Wallet, error) {
 		Addresses: walletStorage.Addresses,
 		Encrypted: walletStorage.Encrypted,
 		Metadata:  walletStorage.Metadata,
+		NextIndex: walletStorage.NextIndex,
+		Network:   network,
 		KeyPairs:  make(map[string]*crypto.KeyPair),
 	}
+	if wallet.Metadata == nil {
+		wallet.Metadata = make(map[string]string)
+	}
 
 	if walletStorage.Encrypted {
 		// For encrypted wallets, restore encryption metadata
@@ -469,19 +697,16 @@ func LoadFromFile(filename string) (*Wallet, error) {
 		}
 	} else {
 		// For unencrypted wallets, restore key pairs
-		for _, keyStore := range walletStorage.KeyStores {
-			keyPair, err := crypto.FromStorage(keyStore)
-			if err != nil {
-				return nil, fmt.Errorf("failed to restore key pair: %w", err)
-			}
-			wallet.KeyPairs[keyPair.Address] = keyPair
+		if err := wallet.restoreKeysLocked(&walletStorage); err != nil {
+			return nil, err
 		}
 	}
 
 	return wallet, nil
 }
 
-// Backup creates a backup of the wallet
+// Backup creates a backup of the wallet. Backups of wallets with a mnemonic
+// include the phrase, so addresses generated later can still be restored.
 func (w *Wallet) Backup(backupDir string) error {
 	w.mu.RLock()
 	defer w.mu.RUnlock()
@@ -496,11 +721,41 @@ func (w *Wallet) Backup(backupDir string) error {
 	return w.SaveToFile(backupFilename)
 }
 
-// Restore restores a wallet from a backup file
+// Restore restores a wallet from a backup file. A backup holding just the
+// name and mnemonic is enough to rebuild the keys.
 func Restore(backupFile string) (*Wallet, error) {
 	return LoadFromFile(backupFile)
 }
 
+// RestoreFromMnemonic rebuilds a wallet from its recovery phrase alone. The
+// addresses in use are found by scanning utxoSet up to gapLimit unused
+// addresses ahead; with a nil utxoSet only the first address is restored.
+func RestoreFromMnemonic(config WalletConfig, utxoSet *transactions.UTXOSet, gapLimit int) (*Wallet, error) {
+	if config.Mnemonic == "" {
+		return nil, fmt.Errorf("mnemonic phrase cannot be empty")
+	}
+
+	passphrase := config.Passphrase
+	config.Passphrase = ""
+	wallet, err := NewWallet(config)
+	if err != nil {
+		return nil, err
+	}
+
+	if utxoSet != nil {
+		if _, err := wallet.ScanAddresses(utxoSet, gapLimit); err != nil {
+			return nil, fmt.Errorf("failed to scan addresses: %w", err)
+		}
+	}
+
+	if passphrase != "" {
+		if err := wallet.Encrypt(passphrase); err != nil {
+			return nil, fmt.Errorf("failed to encrypt wallet: %w", err)
+		}
+	}
+	return wallet, nil
+}
+
 // GetInfo returns wallet information
 func (w *Wallet) GetInfo() map[string]interface{} {
 	w.mu.RLock()
@@ -513,6 +768,8 @@ func (w *Wallet) GetInfo() map[string]interface{} {
 		"address_count": len(w.Addresses),
 		"encrypted":     w.Encrypted,
 		"metadata":      w.Metadata,
+		"next_index":    w.NextIndex,
+		"network":       w.networkLocked().Name,
 	}
 
 	if !w.Encrypted {
@@ -550,6 +807,9 @@ func (w *Wallet) Validate() error {
 				return fmt.Errorf("key pair address mismatch: expected %s, got %s",
 					address, keyPair.Address)
 			}
+			if err := transactions.ValidateAddressForNetwork(address, w.networkLocked()); err != nil {
+				return fmt.Errorf("invalid wallet address: %w", err)
+			}
 		}
 
 		// Check all addresses are in key pairs
@@ -662,7 +922,16 @@ func deriveKey(passphrase string, salt []byte) []byte {
 	return argon2.IDKey([]byte(passphrase), salt, 3, 64*1024, 4, 32)
 }
 
-// SignTransaction signs a transaction using the appropriate wallet key
+// ValidateAddress checks that an address is well formed and belongs to the
+// wallet's network
+func (w *Wallet) ValidateAddress(address string) error {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return transactions.ValidateAddressForNetwork(address, w.networkLocked())
+}
+
+// SignTransaction signs a transaction using the appropriate wallet key. Every
+// output address is validated first, so a typo cannot send funds nowhere.
 func (w *Wallet) SignTransaction(tx *transactions.Transaction, inputIndex int, referencedTxOutputs []transactions.TxOutput) error {
 	w.mu.RLock()
 	defer w.mu.RUnlock()
@@ -680,6 +949,11 @@ func (w *Wallet) SignTransaction(tx *transactions.Transaction, inputIndex int, r
 		return fmt.Errorf("referenced output not found for input %d", inputIndex)
 	}
 
+	// Catch mistyped recipients before anything is signed
+	if err := w.validateOutputsLocked(tx); err != nil {
+		return err
+	}
+
 	referencedOutput := referencedTxOutputs[inputIndex]
 	keyPair, exists := w.KeyPairs[referencedOutput.Address]
 	if !exists {
@@ -690,6 +964,102 @@ func (w *Wallet) SignTransaction(tx *transactions.Transaction, inputIndex int, r
 	return tx.SignTransaction(inputIndex, keyPair.PrivateKey, referencedTxOutputs)
 }
 
+// validateOutputsLocked checks that every output pays an address on the
+// wallet's network (assumes lock is held)
+func (w *Wallet) validateOutputsLocked(tx *transactions.Transaction) error {
+	for i, output := range tx.Outputs {
+		if err := transactions.ValidateAddressForNetwork(output.Address, w.networkLocked()); err != nil {
+			return fmt.Errorf("output %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// ImportPartialTransaction decodes a partially-signed transaction received
+// from another signer. Every output must pay an address on the wallet's
+// network.
+func (w *Wallet) ImportPartialTransaction(encoded string) (*transactions.PartialTransaction, error) {
+	p, err := transactions.DecodePartialTransaction(encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if err := w.validateOutputsLocked(p.Transaction); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// SignPartialTransaction adds a signature with hashType to every input of p
+// that a wallet key can sign and returns the number of signatures added
+func (w *Wallet) SignPartialTransaction(p *transactions.PartialTransaction, hashType transactions.SigHashType) (int, error) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	if w.Encrypted {
+		return 0, fmt.Errorf("cannot sign transaction with encrypted wallet")
+	}
+	if err := w.validateOutputsLocked(p.Transaction); err != nil {
+		return 0, err
+	}
+
+	signed := 0
+	for i := range p.Inputs {
+		for _, address := range w.Addresses {
+			keyPair := w.KeyPairs[address]
+			if keyPair == nil || !p.CanSign(i, keyPair.PublicKey) {
+				continue
+			}
+			if err := p.Sign(i, keyPair.PrivateKey, hashType); err != nil {
+				return signed, fmt.Errorf("failed to sign input %d: %w", i, err)
+			}
+			signed++
+		}
+	}
+	return signed, nil
+}
+
+// MergePartialTransactions imports copies of the same partially-signed
+// transaction signed by different parties and combines their signatures
+func (w *Wallet) MergePartialTransactions(encoded ...string) (*transactions.PartialTransaction, error) {
+	if len(encoded) == 0 {
+		return nil, fmt.Errorf("no partial transactions to merge")
+	}
+
+	merged, err := w.ImportPartialTransaction(encoded[0])
+	if err != nil {
+		return nil, err
+	}
+	for i, text := range encoded[1:] {
+		other, err := w.ImportPartialTransaction(text)
+		if err != nil {
+			return nil, fmt.Errorf("partial transaction %d: %w", i+1, err)
+		}
+		if err := merged.Merge(other); err != nil {
+			return nil, fmt.Errorf("partial transaction %d: %w", i+1, err)
+		}
+	}
+	return merged, nil
+}
+
+// FinalizePartialTransaction builds the signed transaction for broadcast
+// once p has every signature it needs
+func (w *Wallet) FinalizePartialTransaction(p *transactions.PartialTransaction) (*transactions.Transaction, error) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	if err := w.validateOutputsLocked(p.Transaction); err != nil {
+		return nil, err
+	}
+	tx, err := p.Finalize()
+	if err != nil {
+		return nil, fmt.Errorf("transaction is not fully signed: %w", err)
+	}
+	return tx, nil
+}
+
 // GetUnspentOutputs returns unspent outputs for the wallet
 func (w *Wallet) GetUnspentOutputs(utxoSet map[string]map[int]transactions.TxOutput) []transactions.TxOutput {
 	w.mu.RLock()
@@ -722,3 +1092,23 @@ func (w *Wallet) GetUnspentOutputs(utxoSet map[string]map[int]transactions.TxOut
 
 	return unspentOutputs
 }
+
+// EstimateFee returns the fee for a transaction with the given number of
+// inputs and outputs to confirm within target blocks. Until the estimator
+// has seen enough confirmations it falls back to CalculateOptimalFee at
+// normal priority.
+func (w *Wallet) EstimateFee(estimator *transactions.FeeEstimator, inputCount, outputCount, target int) (transactions.Amount, error) {
+	if estimator != nil {
+		fee, err := estimator.EstimateFee(inputCount, outputCount, target)
+		if err == nil {
+			return fee, nil
+		}
+		if !errors.Is(err, transactions.ErrInsufficientFeeData) {
+			return 0, fmt.Errorf("failed to estimate fee: %w", err)
+		}
+	}
+	if target < 1 || target > transactions.MaxConfirmationTarget {
+		return 0, fmt.Errorf("confirmation target must be between 1 and %d blocks", transactions.MaxConfirmationTarget)
+	}
+	return transactions.CalculateOptimalFee(inputCount, outputCount, 1.0), nil
+}
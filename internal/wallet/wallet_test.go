@@ -2,13 +2,12 @@ package wallet
 
 import (
 	"crypto/ecdsa"
-	"crypto/elliptic"
 	"crypto/rand"
 	"encoding/json"
 	"fmt"
-	"math"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -224,17 +223,17 @@ func (suite *WalletTestSuite) TestCalculateBalance() {
 	// Create mock UTXO set
 	utxoSet := map[string]map[int]transactions.TxOutput{
 		"tx1": {
-			0: {Address: wallet.GetAddresses()[0], Amount: 1.5},
-			1: {Address: "other_address", Amount: 2.0},
+			0: {Address: wallet.GetAddresses()[0], Amount: 1.5 * transactions.Coin},
+			1: {Address: "other_address", Amount: 2.0 * transactions.Coin},
 		},
 		"tx2": {
-			0: {Address: wallet.GetAddresses()[0], Amount: 0.5},
+			0: {Address: wallet.GetAddresses()[0], Amount: 0.5 * transactions.Coin},
 		},
 	}
 
 	balance, err := wallet.CalculateBalance(utxoSet)
 	assert.NoError(suite.T(), err)
-	assert.Equal(suite.T(), 2.0, balance) // 1.5 + 0.5
+	assert.Equal(suite.T(), transactions.Amount(2.0*transactions.Coin), balance) // 1.5 + 0.5
 }
 
 func (suite *WalletTestSuite) TestCalculateBalanceEncrypted() {
@@ -259,14 +258,14 @@ func (suite *WalletTestSuite) TestGetAddressBalance() {
 	addresses := wallet.GetAddresses()
 	utxoSet := map[string]map[int]transactions.TxOutput{
 		"tx1": {
-			0: {Address: addresses[0], Amount: 1.5},
-			1: {Address: addresses[0], Amount: 0.5},
+			0: {Address: addresses[0], Amount: 1.5 * transactions.Coin},
+			1: {Address: addresses[0], Amount: 0.5 * transactions.Coin},
 		},
 	}
 
 	balance, err := wallet.GetAddressBalance(addresses[0], utxoSet)
 	assert.NoError(suite.T(), err)
-	assert.Equal(suite.T(), 2.0, balance)
+	assert.Equal(suite.T(), transactions.Amount(2.0*transactions.Coin), balance)
 
 	// Test non-existent address
 	_, err = wallet.GetAddressBalance("nonexistent", utxoSet)
@@ -296,7 +295,7 @@ func (suite *WalletTestSuite) TestGetAddressBalanceEmptyUtxoSet() {
 	utxoSet := map[string]map[int]transactions.TxOutput{}
 	balance, err := wallet.GetAddressBalance(wallet.GetAddresses()[0], utxoSet)
 	assert.NoError(suite.T(), err)
-	assert.Equal(suite.T(), 0.0, balance)
+	assert.Equal(suite.T(), transactions.Amount(0), balance)
 }
 
 func (suite *WalletTestSuite) TestEncryptDecrypt() {
@@ -497,13 +496,13 @@ func (suite *WalletTestSuite) TestSignTransaction() {
 		{TxID: "tx123", Index: 0},
 	}
 	outputs := []transactions.TxOutput{
-		{Address: "recipient", Amount: 1.0},
+		{Address: testRecipient, Amount: 1.0 * transactions.Coin},
 	}
 	tx := transactions.NewTransaction(inputs, outputs)
 
 	// Create referenced output
 	referencedOutputs := []transactions.TxOutput{
-		{Address: wallet.GetAddresses()[0], Amount: 2.0},
+		{Address: wallet.GetAddresses()[0], Amount: 2.0 * transactions.Coin},
 	}
 
 	// Sign transaction
@@ -525,9 +524,9 @@ func (suite *WalletTestSuite) TestSignTransactionEncrypted() {
 
 	// Create transaction
 	tx := transactions.NewTransaction([]transactions.TxInput{{TxID: "tx123", Index: 0}},
-		[]transactions.TxOutput{{Address: "recipient", Amount: 1.0}})
+		[]transactions.TxOutput{{Address: testRecipient, Amount: 1.0 * transactions.Coin}})
 
-	referencedOutputs := []transactions.TxOutput{{Address: wallet.GetAddresses()[0], Amount: 2.0}}
+	referencedOutputs := []transactions.TxOutput{{Address: wallet.GetAddresses()[0], Amount: 2.0 * transactions.Coin}}
 
 	// Should fail on encrypted wallet
 	err = wallet.SignTransaction(tx, 0, referencedOutputs)
@@ -543,11 +542,11 @@ func (suite *WalletTestSuite) TestGetUnspentOutputs() {
 	// Create mock UTXO set
 	utxoSet := map[string]map[int]transactions.TxOutput{
 		"tx1": {
-			0: {Address: wallet.GetAddresses()[0], Amount: 1.5},
-			1: {Address: "other_address", Amount: 2.0},
+			0: {Address: wallet.GetAddresses()[0], Amount: 1.5 * transactions.Coin},
+			1: {Address: "other_address", Amount: 2.0 * transactions.Coin},
 		},
 		"tx2": {
-			0: {Address: wallet.GetAddresses()[0], Amount: 0.5},
+			0: {Address: wallet.GetAddresses()[0], Amount: 0.5 * transactions.Coin},
 		},
 	}
 
@@ -555,14 +554,14 @@ func (suite *WalletTestSuite) TestGetUnspentOutputs() {
 	assert.Len(suite.T(), unspent, 2) // 2 outputs for our wallet
 
 	// Verify outputs
-	totalAmount := 0.0
+	var totalAmount transactions.Amount
 	for _, output := range unspent {
 		totalAmount += output.Amount
 		assert.Equal(suite.T(), wallet.GetAddresses()[0], output.Address)
 		assert.NotEmpty(suite.T(), output.TxID)
 		assert.GreaterOrEqual(suite.T(), output.Index, 0)
 	}
-	assert.Equal(suite.T(), 2.0, totalAmount)
+	assert.Equal(suite.T(), transactions.Amount(2.0*transactions.Coin), totalAmount)
 }
 
 func (suite *WalletTestSuite) TestGetUnspentOutputsEncrypted() {
@@ -874,10 +873,10 @@ func (suite *WalletTestSuite) TestSignTransactionInvalidInput() {
 	require.NoError(suite.T(), err)
 
 	tx := transactions.NewTransaction([]transactions.TxInput{{TxID: "tx123", Index: 0}},
-		[]transactions.TxOutput{{Address: "recipient", Amount: 1.0}})
+		[]transactions.TxOutput{{Address: testRecipient, Amount: 1.0 * transactions.Coin}})
 
 	// Invalid input index
-	referencedOutputs := []transactions.TxOutput{{Address: wallet.GetAddresses()[0], Amount: 2.0}}
+	referencedOutputs := []transactions.TxOutput{{Address: wallet.GetAddresses()[0], Amount: 2.0 * transactions.Coin}}
 	err = wallet.SignTransaction(tx, 5, referencedOutputs)
 	assert.Error(suite.T(), err)
 	assert.Contains(suite.T(), err.Error(), "input index 5 out of range")
@@ -894,10 +893,10 @@ func (suite *WalletTestSuite) TestSignTransactionAddressMismatch() {
 	require.NoError(suite.T(), err)
 
 	tx := transactions.NewTransaction([]transactions.TxInput{{TxID: "tx123", Index: 0}},
-		[]transactions.TxOutput{{Address: "recipient", Amount: 1.0}})
+		[]transactions.TxOutput{{Address: testRecipient, Amount: 1.0 * transactions.Coin}})
 
 	// Referenced output with different address
-	referencedOutputs := []transactions.TxOutput{{Address: "different_address", Amount: 2.0}}
+	referencedOutputs := []transactions.TxOutput{{Address: "different_address", Amount: 2.0 * transactions.Coin}}
 	err = wallet.SignTransaction(tx, 0, referencedOutputs)
 	assert.Error(suite.T(), err)
 	assert.Contains(suite.T(), err.Error(), "no key pair found for address")
@@ -935,7 +934,7 @@ func (suite *WalletTestSuite) BenchmarkCalculateBalance(b *testing.B) {
 	for i := 0; i < 1000; i++ {
 		txID := fmt.Sprintf("tx%d", i)
 		utxoSet[txID] = map[int]transactions.TxOutput{
-			0: {Address: wallet.GetAddresses()[i%len(wallet.GetAddresses())], Amount: 1.0},
+			0: {Address: wallet.GetAddresses()[i%len(wallet.GetAddresses())], Amount: 1.0 * transactions.Coin},
 		}
 	}
 
@@ -985,7 +984,7 @@ func (suite *WalletTestSuite) TestWalletWithExternalKeyPair() {
 	require.NoError(suite.T(), err)
 
 	// Generate external key pair
-	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	privateKey, err := ecdsa.GenerateKey(crypto.Secp256k1(), rand.Reader)
 	require.NoError(suite.T(), err)
 
 	externalKeyPair, err := crypto.GetKeyPairFromPrivate(privateKey)
@@ -1013,33 +1012,33 @@ func (suite *WalletTestSuite) TestCalculateBalanceWithEdgeCases() {
 	tests := []struct {
 		name     string
 		utxoSet  map[string]map[int]transactions.TxOutput
-		expected float64
+		expected transactions.Amount
 	}{
 		{
 			name:     "empty UTXO set",
 			utxoSet:  map[string]map[int]transactions.TxOutput{},
-			expected: 0.0,
+			expected: 0,
 		},
 		{
 			name: "no matching addresses",
 			utxoSet: map[string]map[int]transactions.TxOutput{
-				"tx1": {0: {Address: "other_address", Amount: 1.0}},
+				"tx1": {0: {Address: "other_address", Amount: 1.0 * transactions.Coin}},
 			},
-			expected: 0.0,
+			expected: 0,
 		},
 		{
 			name: "very small amounts",
 			utxoSet: map[string]map[int]transactions.TxOutput{
-				"tx1": {0: {Address: wallet.GetAddresses()[0], Amount: 0.00000001}},
+				"tx1": {0: {Address: wallet.GetAddresses()[0], Amount: 0.00000001 * transactions.Coin}},
 			},
-			expected: 0.00000001,
+			expected: 1,
 		},
 		{
 			name: "very large amounts",
 			utxoSet: map[string]map[int]transactions.TxOutput{
-				"tx1": {0: {Address: wallet.GetAddresses()[0], Amount: math.MaxFloat64 / 2}},
+				"tx1": {0: {Address: wallet.GetAddresses()[0], Amount: transactions.MaxMoney}},
 			},
-			expected: math.MaxFloat64 / 2,
+			expected: transactions.MaxMoney,
 		},
 	}
 
@@ -1156,21 +1155,21 @@ func (suite *WalletTestSuite) TestMultipleAddressesBalance() {
 	for i, addr := range addresses {
 		txID := fmt.Sprintf("tx%d", i)
 		utxoSet[txID] = map[int]transactions.TxOutput{
-			0: {Address: addr, Amount: float64(i+1) * 0.5},
+			0: {Address: addr, Amount: transactions.Amount(i+1) * transactions.Coin / 2},
 		}
 	}
 
 	// Test total balance
 	totalBalance, err := wallet.CalculateBalance(utxoSet)
 	assert.NoError(suite.T(), err)
-	expectedTotal := 0.5 + 1.0 + 1.5 + 2.0 + 2.5 // 7.5
+	expectedTotal := transactions.Amount(7.5 * transactions.Coin) // 0.5 + 1.0 + 1.5 + 2.0 + 2.5
 	assert.Equal(suite.T(), expectedTotal, totalBalance)
 
 	// Test individual address balances
 	for i, addr := range addresses {
 		balance, err := wallet.GetAddressBalance(addr, utxoSet)
 		assert.NoError(suite.T(), err)
-		assert.Equal(suite.T(), float64(i+1)*0.5, balance)
+		assert.Equal(suite.T(), transactions.Amount(i+1)*transactions.Coin/2, balance)
 	}
 }
 
@@ -1206,6 +1205,111 @@ func (suite *WalletTestSuite) TestBackupAndRestoreEncrypted() {
 	assert.Equal(suite.T(), wallet.GetAddresses(), restoreWallet.GetAddresses())
 }
 
+// Test HD derivation and mnemonic recovery
+
+const testMnemonic = "legal winner thank year wave sausage worth useful legal winner thank yellow"
+
+// testRecipient is a valid mainnet address that no test wallet owns
+const testRecipient = "mxm1qzg69v7ys40x77y352eufp27daufrg4nc86pypu"
+
+func (suite *WalletTestSuite) TestMnemonicDerivesDeterministicAddresses() {
+	wallet, err := NewWallet(WalletConfig{Name: "HD Wallet", Mnemonic: testMnemonic})
+	require.NoError(suite.T(), err)
+	_, err = wallet.GenerateNewAddress()
+	require.NoError(suite.T(), err)
+
+	other, err := NewWallet(WalletConfig{Name: "HD Copy", Mnemonic: testMnemonic})
+	require.NoError(suite.T(), err)
+	_, err = other.GenerateNewAddress()
+	require.NoError(suite.T(), err)
+
+	assert.Equal(suite.T(), wallet.GetAddresses(), other.GetAddresses())
+	assert.Equal(suite.T(), uint32(2), wallet.NextIndex)
+	assert.NoError(suite.T(), wallet.Validate())
+
+	phrase, err := wallet.MnemonicPhrase()
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), testMnemonic, phrase)
+
+	_, err = NewWallet(WalletConfig{Name: "Bad", Mnemonic: "abandon abandon abandon"})
+	assert.Error(suite.T(), err)
+}
+
+func (suite *WalletTestSuite) TestRestoreFromMnemonicScansGapLimit() {
+	source, err := NewWallet(WalletConfig{Name: "Source", Mnemonic: testMnemonic})
+	require.NoError(suite.T(), err)
+	for i := 0; i < 7; i++ {
+		_, err = source.GenerateNewAddress()
+		require.NoError(suite.T(), err)
+	}
+	addresses := source.GetAddresses()
+
+	// Funds on the first and sixth addresses, with a gap of four between them
+	utxoSet := transactions.NewUTXOSet()
+	require.NoError(suite.T(), utxoSet.Add("tx1", 0, transactions.TxOutput{Amount: 10, Address: addresses[0]}))
+	require.NoError(suite.T(), utxoSet.Add("tx2", 0, transactions.TxOutput{Amount: 20, Address: addresses[5]}))
+
+	restored, err := RestoreFromMnemonic(WalletConfig{Name: "Restored", Mnemonic: testMnemonic}, utxoSet, 5)
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), addresses[:6], restored.GetAddresses())
+	assert.Equal(suite.T(), uint32(6), restored.NextIndex)
+
+	// A gap limit smaller than the gap misses the later address
+	short, err := RestoreFromMnemonic(WalletConfig{Name: "Short", Mnemonic: testMnemonic}, utxoSet, 3)
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), addresses[:1], short.GetAddresses())
+
+	// The next address continues after the restored ones
+	next, err := restored.GenerateNewAddress()
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), addresses[6], next)
+}
+
+func (suite *WalletTestSuite) TestRestoreFromPhraseOnlyBackup() {
+	wallet, err := NewWallet(WalletConfig{Name: "Phrase Wallet"})
+	require.NoError(suite.T(), err)
+	_, err = wallet.GenerateNewAddress()
+	require.NoError(suite.T(), err)
+	phrase, err := wallet.MnemonicPhrase()
+	require.NoError(suite.T(), err)
+
+	// A backup with no keys at all
+	data, err := json.Marshal(WalletStorage{Name: wallet.Name, Mnemonic: phrase, NextIndex: wallet.NextIndex})
+	require.NoError(suite.T(), err)
+	backupFile := filepath.Join(suite.tempDir, "phrase-backup.json")
+	require.NoError(suite.T(), os.WriteFile(backupFile, data, 0600))
+
+	restored, err := Restore(backupFile)
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), wallet.GetAddresses(), restored.GetAddresses())
+	assert.NoError(suite.T(), restored.Validate())
+}
+
+func (suite *WalletTestSuite) TestEncryptedWalletKeepsMnemonic() {
+	wallet, err := NewWallet(WalletConfig{Name: "Encrypted HD", Passphrase: "secret", Mnemonic: testMnemonic})
+	require.NoError(suite.T(), err)
+
+	_, err = wallet.MnemonicPhrase()
+	assert.Error(suite.T(), err)
+
+	filename := filepath.Join(suite.tempDir, "encrypted-hd.json")
+	require.NoError(suite.T(), wallet.SaveToFile(filename))
+	data, err := os.ReadFile(filename)
+	require.NoError(suite.T(), err)
+	assert.NotContains(suite.T(), string(data), "legal winner")
+
+	loaded, err := LoadFromFile(filename)
+	require.NoError(suite.T(), err)
+	require.NoError(suite.T(), loaded.Decrypt("secret"))
+	phrase, err := loaded.MnemonicPhrase()
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), testMnemonic, phrase)
+
+	address, err := loaded.GenerateNewAddress()
+	require.NoError(suite.T(), err)
+	assert.NotContains(suite.T(), wallet.GetAddresses(), address)
+}
+
 func (suite *WalletTestSuite) TestSignAllInputsTransaction() {
 	config := WalletConfig{Name: "Test Wallet"}
 	wallet, err := NewWallet(config)
@@ -1221,14 +1325,14 @@ func (suite *WalletTestSuite) TestSignAllInputsTransaction() {
 		{TxID: "tx2", Index: 0},
 	}
 	outputs := []transactions.TxOutput{
-		{Address: "recipient", Amount: 1.5},
+		{Address: testRecipient, Amount: 1.5 * transactions.Coin},
 	}
 	tx := transactions.NewTransaction(inputs, outputs)
 
 	// Create referenced outputs
 	referencedOutputs := []transactions.TxOutput{
-		{Address: wallet.GetAddresses()[0], Amount: 1.0},
-		{Address: secondAddr, Amount: 1.0},
+		{Address: wallet.GetAddresses()[0], Amount: 1.0 * transactions.Coin},
+		{Address: secondAddr, Amount: 1.0 * transactions.Coin},
 	}
 
 	// Sign both inputs
@@ -1243,3 +1347,167 @@ func (suite *WalletTestSuite) TestSignAllInputsTransaction() {
 	err = tx.VerifyInputSignature(1, referencedOutputs)
 	assert.NoError(suite.T(), err)
 }
+
+func (suite *WalletTestSuite) TestTestnetWalletAddresses() {
+	wallet, err := NewWallet(WalletConfig{Name: "Testnet", Mnemonic: testMnemonic, Network: crypto.TestNet})
+	require.NoError(suite.T(), err)
+	mainnet, err := NewWallet(WalletConfig{Name: "Mainnet", Mnemonic: testMnemonic})
+	require.NoError(suite.T(), err)
+
+	address := wallet.GetAddresses()[0]
+	assert.True(suite.T(), strings.HasPrefix(address, "tmxm1"))
+	assert.True(suite.T(), strings.HasPrefix(mainnet.GetAddresses()[0], "mxm1"))
+	assert.NoError(suite.T(), wallet.ValidateAddress(address))
+	assert.Error(suite.T(), wallet.ValidateAddress(mainnet.GetAddresses()[0]))
+	assert.Equal(suite.T(), "testnet", wallet.GetInfo()["network"])
+
+	filename := filepath.Join(suite.tempDir, "testnet.json")
+	require.NoError(suite.T(), wallet.SaveToFile(filename))
+	loaded, err := LoadFromFile(filename)
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), crypto.TestNet, loaded.Network)
+	assert.NoError(suite.T(), loaded.Validate())
+
+	next, err := loaded.GenerateNewAddress()
+	require.NoError(suite.T(), err)
+	assert.True(suite.T(), strings.HasPrefix(next, "tmxm1"))
+}
+
+func (suite *WalletTestSuite) TestSignTransactionRejectsBadRecipient() {
+	wallet, err := NewWallet(WalletConfig{Name: "Test Wallet"})
+	require.NoError(suite.T(), err)
+	referencedOutputs := []transactions.TxOutput{{Address: wallet.GetAddresses()[0], Amount: 2.0 * transactions.Coin}}
+
+	// Last character changed from the valid testRecipient
+	typo := testRecipient[:len(testRecipient)-1] + "q"
+	testnet := "tmxm1qzg69v7ys40x77y352eufp27daufrg4ncsgzdjk"
+	for _, address := range []string{typo, testnet, "recipient"} {
+		tx := transactions.NewTransaction([]transactions.TxInput{{TxID: "tx1", Index: 0}},
+			[]transactions.TxOutput{{Address: address, Amount: 1.0 * transactions.Coin}})
+		err := wallet.SignTransaction(tx, 0, referencedOutputs)
+		assert.Error(suite.T(), err, address)
+		assert.Empty(suite.T(), tx.Inputs[0].Signature)
+	}
+}
+
+func (suite *WalletTestSuite) TestPartialTransactionRoundTrip() {
+	alice, err := NewWallet(WalletConfig{Name: "Alice"})
+	require.NoError(suite.T(), err)
+	bob, err := NewWallet(WalletConfig{Name: "Bob"})
+	require.NoError(suite.T(), err)
+	carol, err := NewWallet(WalletConfig{Name: "Carol"})
+	require.NoError(suite.T(), err)
+
+	// Alice and Bob share a 2-of-2 multisig output; Carol pays the fee input
+	aliceKey, err := alice.GetKeyPair(alice.GetAddresses()[0])
+	require.NoError(suite.T(), err)
+	bobKey, err := bob.GetKeyPair(bob.GetAddresses()[0])
+	require.NoError(suite.T(), err)
+	redeemScript, err := transactions.MultiSigScript(2, []*ecdsa.PublicKey{aliceKey.PublicKey, bobKey.PublicKey})
+	require.NoError(suite.T(), err)
+	sharedAddress, err := transactions.ScriptAddress(crypto.MainNet, redeemScript)
+	require.NoError(suite.T(), err)
+
+	prevOutputs := []transactions.TxOutput{
+		{Address: sharedAddress, Amount: 5 * transactions.Coin},
+		{Address: carol.GetAddresses()[0], Amount: 1 * transactions.Coin},
+	}
+	tx := transactions.NewTransaction(
+		[]transactions.TxInput{{TxID: "shared", Index: 0}, {TxID: "fee", Index: 0}},
+		[]transactions.TxOutput{{Address: testRecipient, Amount: 5 * transactions.Coin}},
+	)
+	p, err := transactions.NewPartialTransaction(tx, prevOutputs)
+	require.NoError(suite.T(), err)
+	require.NoError(suite.T(), p.SetRedeemScript(0, redeemScript))
+	encoded, err := p.Encode()
+	require.NoError(suite.T(), err)
+
+	var copies []string
+	for _, w := range []*Wallet{alice, bob, carol} {
+		imported, err := w.ImportPartialTransaction(encoded)
+		require.NoError(suite.T(), err)
+		signed, err := w.SignPartialTransaction(imported, transactions.SigHashAll)
+		require.NoError(suite.T(), err)
+		assert.Equal(suite.T(), 1, signed)
+
+		_, err = w.FinalizePartialTransaction(imported)
+		assert.Error(suite.T(), err, "one signer is not enough")
+
+		text, err := imported.Encode()
+		require.NoError(suite.T(), err)
+		copies = append(copies, text)
+	}
+
+	merged, err := carol.MergePartialTransactions(copies...)
+	require.NoError(suite.T(), err)
+	final, err := carol.FinalizePartialTransaction(merged)
+	require.NoError(suite.T(), err)
+
+	utxoSet := transactions.NewUTXOSet()
+	require.NoError(suite.T(), utxoSet.Add("shared", 0, prevOutputs[0]))
+	require.NoError(suite.T(), utxoSet.Add("fee", 0, prevOutputs[1]))
+	assert.NoError(suite.T(), utxoSet.ValidateTransaction(final))
+}
+
+func (suite *WalletTestSuite) TestPartialTransactionWalletChecks() {
+	wallet, err := NewWallet(WalletConfig{Name: "Test Wallet"})
+	require.NoError(suite.T(), err)
+
+	// Outputs paying another network are refused on import
+	tx := transactions.NewTransaction([]transactions.TxInput{{TxID: "tx1", Index: 0}},
+		[]transactions.TxOutput{{Address: "tmxm1qzg69v7ys40x77y352eufp27daufrg4ncsgzdjk", Amount: transactions.Coin}})
+	p, err := transactions.NewPartialTransaction(tx, []transactions.TxOutput{{Address: wallet.GetAddresses()[0], Amount: 2 * transactions.Coin}})
+	require.NoError(suite.T(), err)
+	encoded, err := p.Encode()
+	require.NoError(suite.T(), err)
+	_, err = wallet.ImportPartialTransaction(encoded)
+	assert.Error(suite.T(), err)
+
+	_, err = wallet.ImportPartialTransaction("not base64!")
+	assert.Error(suite.T(), err)
+	_, err = wallet.MergePartialTransactions()
+	assert.Error(suite.T(), err)
+
+	// Encrypted wallets cannot sign
+	tx = transactions.NewTransaction([]transactions.TxInput{{TxID: "tx1", Index: 0}},
+		[]transactions.TxOutput{{Address: testRecipient, Amount: transactions.Coin}})
+	p, err = transactions.NewPartialTransaction(tx, []transactions.TxOutput{{Address: wallet.GetAddresses()[0], Amount: 2 * transactions.Coin}})
+	require.NoError(suite.T(), err)
+	require.NoError(suite.T(), wallet.Encrypt("passphrase"))
+	_, err = wallet.SignPartialTransaction(p, transactions.SigHashAll)
+	assert.Error(suite.T(), err)
+}
+
+func (suite *WalletTestSuite) TestEstimateFee() {
+	wallet, err := NewWallet(WalletConfig{Name: "Test Wallet"})
+	require.NoError(suite.T(), err)
+
+	// Without fee history the static estimate is used
+	estimator := transactions.NewFeeEstimator()
+	fee, err := wallet.EstimateFee(estimator, 1, 2, 6)
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), transactions.CalculateOptimalFee(1, 2, 1.0), fee)
+	fee, err = wallet.EstimateFee(nil, 1, 2, 6)
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), transactions.CalculateOptimalFee(1, 2, 1.0), fee)
+
+	// With history the estimator decides
+	var txIDs []string
+	for i := 0; i < 10; i++ {
+		txID := fmt.Sprintf("tx%d", i)
+		estimator.TrackTransaction(txID, 20000, 1)
+		txIDs = append(txIDs, txID)
+	}
+	estimator.ProcessBlock(1, txIDs)
+
+	expected, err := estimator.EstimateFee(1, 2, 6)
+	require.NoError(suite.T(), err)
+	fee, err = wallet.EstimateFee(estimator, 1, 2, 6)
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), expected, fee)
+
+	_, err = wallet.EstimateFee(estimator, 1, 2, 0)
+	assert.Error(suite.T(), err)
+	_, err = wallet.EstimateFee(nil, 1, 2, transactions.MaxConfirmationTarget+1)
+	assert.Error(suite.T(), err)
+}